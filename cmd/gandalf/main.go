@@ -11,7 +11,7 @@ import (
 var version = "dev"
 
 func main() {
-	configPath := flag.String("config", "configs/gandalf.yaml", "path to config file")
+	configPath := flag.String("config", "configs/gandalf.yaml", "path to config file (empty = defaults plus GANDALF_* environment)")
 	showVersion := flag.Bool("version", false, "print version and exit")
 	flag.Parse()
 
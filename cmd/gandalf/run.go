@@ -5,9 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
@@ -32,11 +35,13 @@ import (
 	"github.com/eugener/gandalf/internal/provider/openai"
 	"github.com/eugener/gandalf/internal/ratelimit"
 	"github.com/eugener/gandalf/internal/server"
+	"github.com/eugener/gandalf/internal/storage"
 	"github.com/eugener/gandalf/internal/storage/sqlite"
 	"github.com/eugener/gandalf/internal/telemetry"
 	"github.com/eugener/gandalf/internal/tokencount"
 	"github.com/eugener/gandalf/internal/worker"
 	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
 )
 
 func run(configPath string) error {
@@ -49,7 +54,7 @@ func run(configPath string) error {
 	slog.Info("starting gandalf", "version", version, "addr", cfg.Server.Addr)
 
 	// Open database
-	store, err := sqlite.New(cfg.Database.DSN)
+	store, err := sqlite.NewWithReplicas(cfg.Database.DSN, cfg.Database.ReadReplicas)
 	if err != nil {
 		return err
 	}
@@ -59,13 +64,16 @@ func run(configPath string) error {
 	if i := strings.IndexByte(dsnLog, '?'); i >= 0 {
 		dsnLog = dsnLog[:i]
 	}
-	slog.Info("database opened", "dsn", dsnLog)
+	slog.Info("database opened", "dsn", dsnLog, "read_replicas", len(cfg.Database.ReadReplicas))
 
 	// Bootstrap from config
 	ctx := context.Background()
 	if err := config.Bootstrap(ctx, cfg, store); err != nil {
 		return err
 	}
+	if err := config.ValidateRoutes(ctx, cfg, store); err != nil {
+		return err
+	}
 
 	// Log seeded API keys (names only, never log key material).
 	for _, k := range cfg.Keys {
@@ -81,8 +89,16 @@ func run(configPath string) error {
 	// The refresh goroutine is started later with workerCtx for clean shutdown.
 	dnsResolver := &dnscache.Resolver{}
 
+	if err := provider.SetFinishReasons(cfg.FinishReasons); err != nil {
+		return fmt.Errorf("finish_reasons: %w", err)
+	}
+
 	// Register providers
 	reg := provider.NewRegistry()
+	var upstreamLimits *provider.UpstreamLimits
+	if cfg.UpstreamRateLimits.Enabled {
+		upstreamLimits = provider.NewUpstreamLimits(cfg.UpstreamRateLimits.LowHeadroom)
+	}
 	for _, p := range cfg.Providers {
 		if !p.IsEnabled() {
 			slog.Info("provider skipped (disabled)", "name", p.Name)
@@ -90,7 +106,7 @@ func run(configPath string) error {
 		}
 
 		// Build HTTP client with auth transport chain.
-		client, err := buildProviderClient(ctx, p, dnsResolver)
+		client, err := buildProviderClient(ctx, p, dnsResolver, upstreamLimits, cfg.Server.ProviderBaseURLAllowlist)
 		if err != nil {
 			return fmt.Errorf("provider %q: %w", p.Name, err)
 		}
@@ -104,31 +120,61 @@ func run(configPath string) error {
 				prov = openai.New(p.Name, p.BaseURL, client)
 			}
 		case "anthropic":
+			var a *anthropic.Client
 			if h := p.ResolvedHosting(); h == "vertex" || h == "bedrock" {
-				prov = anthropic.NewWithHosting(p.Name, p.BaseURL, client, h, p.Region, p.Project)
+				a = anthropic.NewWithHosting(p.Name, p.BaseURL, client, h, p.Region, p.Project)
 			} else {
-				prov = anthropic.New(p.Name, p.BaseURL, client)
+				a = anthropic.New(p.Name, p.BaseURL, client)
+			}
+			if p.DefaultMaxTokens != nil {
+				a.SetDefaultMaxTokens(*p.DefaultMaxTokens)
+			}
+			if p.InlineImages != nil {
+				a.SetImageFetcher(imageFetcher(*p.InlineImages))
 			}
+			prov = a
 		case "gemini":
+			var g *gemini.Client
 			if h := p.ResolvedHosting(); h == "vertex" {
-				prov = gemini.NewWithHosting(p.Name, p.BaseURL, client, h, p.Region, p.Project)
+				g = gemini.NewWithHosting(p.Name, p.BaseURL, client, h, p.Region, p.Project)
 			} else {
-				prov = gemini.New(p.Name, p.BaseURL, client)
+				g = gemini.New(p.Name, p.BaseURL, client)
 			}
+			if p.InlineImages != nil {
+				g.SetImageFetcher(imageFetcher(*p.InlineImages))
+			}
+			prov = g
 		case "ollama":
 			prov = ollama.New(p.Name, p.BaseURL, client)
 		default:
 			slog.Warn("unknown provider type, skipping", "name", p.Name, "type", p.ResolvedType())
 			continue
 		}
+		if fg, ok := prov.(interface{ SetFinishGrace(time.Duration) }); ok {
+			fg.SetFinishGrace(p.StreamFinishGrace)
+		}
 		_, hasNative := prov.(gateway.NativeProxy)
 		reg.Register(p.Name, prov)
+		reg.SetModelsTTL(p.Name, p.ModelsCacheTTL)
+		for _, f := range p.RequiredFields {
+			if !app.IsChatField(f) {
+				slog.Warn("unknown required field ignored", "provider", p.Name, "field", f)
+			}
+		}
+		reg.SetRequiredFields(p.Name, p.RequiredFields)
+		for _, sp := range p.SamplingParams {
+			if !app.IsSamplingParam(sp) {
+				slog.Warn("unknown sampling param ignored", "provider", p.Name, "param", sp)
+			}
+		}
+		reg.SetSamplingParams(p.Name, p.SamplingParams)
 		slog.Info("provider registered",
 			"name", p.Name,
 			"type", p.ResolvedType(),
 			"hosting", p.ResolvedHosting(),
 			"auth", p.ResolvedAuthType(),
 			"native_proxy", hasNative,
+			"models_cache_ttl", p.ModelsCacheTTL,
 		)
 	}
 
@@ -145,6 +191,9 @@ func run(configPath string) error {
 		"shutdown", cfg.Server.ShutdownTimeout,
 	)
 
+	// Upstream latency percentiles, fed by the proxy service.
+	latencyStats := app.NewLatencyStats(0)
+
 	// Prometheus metrics.
 	var metrics *telemetry.Metrics
 	var metricsHandler http.Handler
@@ -153,6 +202,19 @@ func run(configPath string) error {
 		promRegistry.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
 		promRegistry.MustRegister(collectors.NewGoCollector())
 		metrics = telemetry.NewMetrics(promRegistry)
+		promRegistry.MustRegister(telemetry.NewProviderLatencyCollector(func() []telemetry.ProviderLatency {
+			stats := latencyStats.Snapshot()
+			out := make([]telemetry.ProviderLatency, len(stats))
+			for i, p := range stats {
+				out[i] = telemetry.ProviderLatency{
+					Provider:  p.Provider,
+					Count:     p.Count,
+					Sum:       p.Sum,
+					Quantiles: map[float64]time.Duration{0.5: p.P50, 0.95: p.P95, 0.99: p.P99},
+				}
+			}
+			return out
+		}))
 		metricsHandler = promhttp.HandlerFor(promRegistry, promhttp.HandlerOpts{})
 		slog.Info("prometheus metrics enabled")
 	}
@@ -189,6 +251,17 @@ func run(configPath string) error {
 	}
 
 	routerSvc := app.NewRouterService(store)
+	routerSvc.SetModelNormalization(cfg.NormalizeModelNames)
+	if upstreamLimits != nil {
+		routerSvc.SetUpstreamLimits(upstreamLimits)
+		slog.Info("adaptive throttling enabled")
+	}
+	prices := make(map[string]gateway.ModelPrice, len(cfg.Pricing))
+	for model, p := range cfg.Pricing {
+		prices[model] = p.Price()
+	}
+	routerSvc.SetBalancedScorer(app.NewBalancedScorer(prices,
+		cfg.BalancedRouting.CostWeight, cfg.BalancedRouting.LatencyWeight))
 
 	// Circuit breaker.
 	var breakers *circuitbreaker.Registry
@@ -220,7 +293,56 @@ func run(configPath string) error {
 		)
 	}
 
+	// Model capability overrides from config.
+	capabilities := capabilityOverrides(cfg.ModelCapabilities)
+
 	proxySvc := app.NewProxyService(reg, routerSvc, tracer, breakers)
+	proxySvc.SetEmptyRetries(cfg.EmptyResponseRetries)
+	proxySvc.SetTruncateEmbeddings(cfg.TruncateEmbeddings)
+	proxySvc.SetModelDiagnostics(cfg.ModelNotFoundThreshold)
+	errorLog := app.NewErrorLog(0)
+	proxySvc.SetErrorLog(errorLog)
+	proxySvc.SetLatencyStats(latencyStats)
+	proxySvc.SetCapabilityOverrides(capabilities)
+	if h := cfg.Hedging; h.Enabled {
+		if h.MaxRatio <= 0 || h.MaxRatio > 1 {
+			return fmt.Errorf("hedging: max_ratio must be in (0, 1], got %v", h.MaxRatio)
+		}
+		proxySvc.SetHedging(app.HedgePolicy{
+			Percentile: h.Percentile,
+			MinSamples: h.MinSamples,
+			Delay:      h.Delay,
+			MaxRatio:   h.MaxRatio,
+		})
+		slog.Info("request hedging enabled",
+			"percentile", h.Percentile,
+			"delay", h.Delay,
+			"max_ratio", h.MaxRatio,
+		)
+	}
+	var outputFilter *app.OutputFilter
+	if of := cfg.OutputFilter; len(of.Detectors) > 0 || len(of.Terms) > 0 || len(of.Patterns) > 0 {
+		if of.Streams != "pass" && of.Streams != "buffer" {
+			return fmt.Errorf("output_filter: unknown streams mode %q (want pass or buffer)", of.Streams)
+		}
+		outputFilter, err = app.NewOutputFilter(app.OutputFilterPolicy{
+			Action:      of.Action,
+			Detectors:   of.Detectors,
+			Terms:       of.Terms,
+			Patterns:    of.Patterns,
+			Replacement: of.Replacement,
+		})
+		if err != nil {
+			return err
+		}
+		slog.Info("output filter enabled",
+			"action", of.Action,
+			"detectors", of.Detectors,
+			"terms", len(of.Terms),
+			"patterns", len(of.Patterns),
+			"streams", of.Streams,
+		)
+	}
 	keys := app.NewKeyManager(store)
 
 	// Usage recorder (async batch flush to DB).
@@ -231,10 +353,35 @@ func run(configPath string) error {
 	slog.Info("rate limits configured",
 		"default_rpm", cfg.RateLimits.DefaultRPM,
 		"default_tpm", cfg.RateLimits.DefaultTPM,
+		"default_max_streams", cfg.RateLimits.DefaultMaxStreams,
 	)
 
-	// Token counter.
-	tokenCounter := tokencount.NewCounter()
+	// Global concurrency limit with priority queueing.
+	var concurrency *ratelimit.ConcurrencyLimiter
+	if cfg.Server.MaxConcurrentRequests > 0 {
+		concurrency = ratelimit.NewConcurrencyLimiter(cfg.Server.MaxConcurrentRequests)
+		slog.Info("concurrency limit enabled", "max_concurrent_requests", cfg.Server.MaxConcurrentRequests)
+	}
+
+	// Token estimation for TPM limits.
+	var tokenCounter server.TokenCounter
+	var fixedTokenEstimate int64
+	switch rl := cfg.RateLimits; rl.TokenEstimate {
+	case "", "counter":
+		tokenCounter = tokencount.NewCounter()
+	case "bytes":
+		slog.Info("TPM limits use a byte-size token estimate")
+	case "fixed":
+		if rl.FixedTokenEstimate <= 0 {
+			return fmt.Errorf("rate_limits: token_estimate fixed requires fixed_token_estimate > 0")
+		}
+		fixedTokenEstimate = rl.FixedTokenEstimate
+		slog.Warn("TPM limits charge a flat token estimate per request; large requests may pass and small ones be denied until usage is reconciled",
+			"fixed_token_estimate", fixedTokenEstimate,
+		)
+	default:
+		return fmt.Errorf("rate_limits: unknown token_estimate %q (want counter, bytes, or fixed)", rl.TokenEstimate)
+	}
 
 	// Response cache.
 	var responseCache server.Cache
@@ -253,13 +400,103 @@ func run(configPath string) error {
 	// Quota tracker.
 	quotaTracker := ratelimit.NewQuotaTracker()
 
+	// Request-count quotas, seeded from recorded usage.
+	requestQuota := ratelimit.NewRequestQuotaTracker(store)
+
+	// Token budgets (raw token caps, separate from the USD quota).
+	var tokenBudget server.TokenBudgetChecker
+	if len(cfg.TokenBudgets) > 0 {
+		tb := ratelimit.NewTokenBudgetTracker()
+		for _, b := range cfg.TokenBudgets {
+			scope, id := ratelimit.ScopeKey, b.KeyID
+			if id == "" {
+				scope, id = ratelimit.ScopeOrg, b.OrgID
+			}
+			if id == "" || b.MaxTokens <= 0 {
+				slog.Warn("token budget skipped (needs key_id or org_id and max_tokens)", "model", b.Model)
+				continue
+			}
+			tb.SetLimit(scope, id, b.Model, b.MaxTokens)
+		}
+		tokenBudget = tb
+		slog.Info("token budgets configured", "count", len(cfg.TokenBudgets))
+	}
+
 	// Workers.
 	workers := []worker.Worker{usageRecorder}
 	workers = append(workers, worker.NewQuotaSyncWorkerWithBudgets(quotaTracker, store, store))
 	workers = append(workers, worker.NewUsageRollupWorker(store))
+	if cfg.Quota.Period != "" || len(cfg.Quota.OrgPeriods) > 0 {
+		qr, err := buildQuotaResetWorker(cfg.Quota, quotaTracker, store)
+		if err != nil {
+			return err
+		}
+		workers = append(workers, qr)
+	}
+
+	var anomalies server.AnomalySource // stays nil (no endpoint) when disabled
+	if ad := cfg.AnomalyDetection; ad.Enabled {
+		var notifier worker.AnomalyNotifier
+		if ad.WebhookURL != "" {
+			notifier = &worker.WebhookNotifier{URL: ad.WebhookURL}
+		}
+		aw := worker.NewUsageAnomalyWorker(store, worker.AnomalyConfig{
+			Sigma:       ad.Sigma,
+			Window:      ad.Window,
+			MinBaseline: ad.MinBaseline,
+			MinCostUSD:  ad.MinCostUSD,
+		}, notifier)
+		workers = append(workers, aw)
+		anomalies = aw
+		slog.Info("usage anomaly detection enabled", "webhook", ad.WebhookURL != "")
+	}
 
 	runner := worker.NewRunner(workers...)
 
+	// Server-side conversation threads (opt-in: persists message content).
+	var threads storage.ThreadStore
+	if cfg.Server.Threads {
+		threads = store
+	}
+
+	// Shadow evaluation (opt-in: persists request and response content).
+	var shadowEval *app.ShadowEvaluator
+	if cfg.ShadowEval.SampleRate > 0 && len(cfg.ShadowEval.Targets) > 0 {
+		targets := make([]gateway.RouteTarget, len(cfg.ShadowEval.Targets))
+		for i, t := range cfg.ShadowEval.Targets {
+			targets[i] = gateway.RouteTarget{ProviderID: t.Provider, Model: t.Model}
+		}
+		shadowEval = app.NewShadowEvaluator(reg, store, cfg.ShadowEval.SampleRate, targets, cfg.ShadowEval.Models, outputFilter)
+		slog.Info("shadow evaluation enabled",
+			"sample_rate", cfg.ShadowEval.SampleRate,
+			"targets", len(targets),
+		)
+	}
+
+	// Eval dataset sampling (opt-in: persists request and response content).
+	var evalSampler *app.EvalSampler
+	if ec := cfg.EvalCapture; ec.SampleRate > 0 || len(ec.Models) > 0 {
+		for alias, rate := range ec.Models {
+			if rate < 0 || rate > 1 {
+				return fmt.Errorf("eval_capture: models.%s rate must be in [0, 1], got %v", alias, rate)
+			}
+		}
+		if ec.SampleRate < 0 || ec.SampleRate > 1 {
+			return fmt.Errorf("eval_capture: sample_rate must be in [0, 1], got %v", ec.SampleRate)
+		}
+		evalSampler = app.NewEvalSampler(store, ec.SampleRate, ec.Models, outputFilter)
+		slog.Info("eval capture sampling enabled",
+			"sample_rate", ec.SampleRate,
+			"models", len(ec.Models),
+		)
+	}
+
+	// Configuration backup/restore (opt-in: requires a signing key).
+	var backup storage.BackupStore
+	if cfg.Auth.BackupSigningKey != "" {
+		backup = store
+	}
+
 	// Create HTTP server
 	handler := server.New(server.Deps{
 		Auth:         apiKeyAuth,
@@ -271,15 +508,53 @@ func run(configPath string) error {
 		ReadyCheck:   store.Ping,
 		Usage:        usageRecorder,
 		RateLimiter:  rateLimiter,
+		Concurrency:  concurrency,
 		TokenCounter: tokenCounter,
+		FixedTokenEstimate: fixedTokenEstimate,
 		Cache:          responseCache,
 		Quota:          quotaTracker,
+		RequestQuota:   requestQuota,
+		TokenBudget:    tokenBudget,
+		CostModel:      app.NewStaticCostModel(prices),
+		Threads:        threads,
+		Backup:         backup,
+		ShadowEval:     shadowEval,
+		EvalSampler:    evalSampler,
+		Evals:          store,
 		KeyInvalidator: apiKeyAuth,
+		ErrorLog:       errorLog,
+		LatencyStats:   latencyStats,
+		Audit:          store,
+		Anomalies:      anomalies,
+		OutputFilter:   outputFilter,
+		FilterStreams:  cfg.OutputFilter.Streams == "buffer",
 		Metrics:        metrics,
 		MetricsHandler: metricsHandler,
 		Tracer:         tracer,
 		DefaultRPM:     cfg.RateLimits.DefaultRPM,
 		DefaultTPM:     cfg.RateLimits.DefaultTPM,
+		Streams:        ratelimit.NewStreamLimiter(),
+		DefaultMaxStreams: cfg.RateLimits.DefaultMaxStreams,
+		MaxDeadline:    cfg.Server.WriteTimeout,
+		SlowRequestThreshold: time.Duration(cfg.Server.LogSlowRequestsMs) * time.Millisecond,
+		LogSampleRate:        cfg.Server.LogSampleRate,
+		StrictContentType:    cfg.Server.StrictContentType,
+		ModelAllowlist:       cfg.ModelPolicy.Allow,
+		ModelDenylist:        cfg.ModelPolicy.Deny,
+		RequireUserOrgs:      cfg.RequireUserOrgs,
+		OrgDeniedTools:       cfg.OrgDeniedTools,
+		ReplaceDuplicateRoutes: cfg.Server.ReplaceDuplicateRoutes,
+		MaxRouteTargets:        cfg.Server.MaxRouteTargets,
+		StreamDowngrade:        cfg.Server.StreamDowngrade,
+		ResponseMetadata:     cfg.Server.ResponseMetadata,
+		RequestFingerprint:   cfg.Server.RequestFingerprint,
+		BufferStreams:        cfg.Server.BufferStreams,
+		RepairToolArguments:  cfg.Server.RepairToolArguments,
+		StreamUsageEvent:     cfg.Server.StreamUsageEvent,
+		ProviderBaseURLAllowlist: cfg.Server.ProviderBaseURLAllowlist,
+		BetaFeatures:         cfg.Server.BetaFeatures,
+		BackupSigningKey:     []byte(cfg.Auth.BackupSigningKey),
+		Capabilities:   capabilities,
 	})
 
 	srv := &http.Server{
@@ -355,6 +630,23 @@ func run(configPath string) error {
 		close(errCh)
 	}()
 
+	// gRPC health service (grpc.health.v1), backed by the same readiness check.
+	var grpcHealth *grpc.Server
+	if addr := cfg.Server.GRPCHealthAddr; addr != "" {
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			workerCancel()
+			return fmt.Errorf("grpc health listen: %w", err)
+		}
+		grpcHealth = server.NewGRPCHealthServer(store.Ping)
+		go func() {
+			if err := grpcHealth.Serve(lis); err != nil {
+				slog.Error("grpc health server stopped", "error", err)
+			}
+		}()
+		slog.Info("grpc health enabled", "addr", addr)
+	}
+
 	slog.Info("universal API enabled",
 		"endpoints", []string{
 			"POST /v1/chat/completions",
@@ -380,11 +672,22 @@ func run(configPath string) error {
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
+	if grpcHealth != nil {
+		grpcHealth.GracefulStop()
+	}
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		workerCancel()
 		return err
 	}
 
+	// Let sampled shadow calls and eval samples finish storing their captures.
+	if shadowEval != nil {
+		shadowEval.Wait()
+	}
+	if evalSampler != nil {
+		evalSampler.Wait()
+	}
+
 	// Cancel workers and wait for drain.
 	workerCancel()
 	if err := <-workerDone; err != nil {
@@ -402,18 +705,80 @@ func run(configPath string) error {
 	return nil
 }
 
+// capabilityOverrides converts model_capabilities config entries; nil when
+// none are configured.
+func capabilityOverrides(entries map[string]config.CapabilityEntry) map[string]gateway.CapabilityOverride {
+	if len(entries) == 0 {
+		return nil
+	}
+	out := make(map[string]gateway.CapabilityOverride, len(entries))
+	for model, entry := range entries {
+		out[model] = entry.Override()
+	}
+	return out
+}
+
+// imageFetcher returns the fetcher for a provider's inline_images setting:
+// a downloader when enabled, nil (send links as-is) when disabled.
+func imageFetcher(inline bool) *provider.ImageFetcher {
+	if !inline {
+		return nil
+	}
+	return provider.NewImageFetcher(0)
+}
+
+// dialAllowlist returns the hosts a provider's connections may reach even
+// when they resolve to internal addresses: server.provider_base_url_allowlist
+// plus the entry's own base URL host and the proxy it connects through,
+// which come from the trusted config file.
+func dialAllowlist(p config.ProviderEntry, allowlist []string, proxy func(*http.Request) (*url.URL, error)) []string {
+	out := slices.Clone(allowlist)
+	baseURL := p.BaseURL
+	if baseURL == "" && p.ResolvedType() == "ollama" {
+		baseURL = "http://localhost:11434" // the adapter's default
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Hostname() == "" {
+		return out
+	}
+	out = append(out, u.Hostname())
+	if proxy != nil {
+		if pu, err := proxy(&http.Request{URL: u}); err == nil && pu != nil {
+			out = append(out, pu.Hostname())
+		}
+	}
+	return out
+}
+
 // buildProviderClient assembles an *http.Client with the auth transport chain
-// for a provider entry. The base transport includes DNS caching and HTTP/2
-// (except Ollama which uses HTTP/1.1).
-func buildProviderClient(ctx context.Context, p config.ProviderEntry, resolver *dnscache.Resolver) (*http.Client, error) {
+// and response size cap for a provider entry. The base transport includes
+// DNS caching and HTTP/2 (except Ollama which uses HTTP/1.1). limits, when
+// non-nil, records the provider's rate-limit response headers. Connections
+// to internal addresses are refused at dial time unless allowlisted; see
+// dialAllowlist.
+func buildProviderClient(ctx context.Context, p config.ProviderEntry, resolver *dnscache.Resolver, limits *provider.UpstreamLimits, allowlist []string) (*http.Client, error) {
 	useHTTP2 := p.ResolvedType() != "ollama"
 	base := provider.NewTransport(resolver, useHTTP2)
+	proxy, err := provider.ProxyFunc(p.HTTPProxy)
+	if err != nil {
+		return nil, fmt.Errorf("http_proxy: %w", err)
+	}
+	base.Proxy = proxy
+	provider.DenyInternalDials(base, resolver, provider.ParseAddrAllowlist(dialAllowlist(p, allowlist, proxy)))
+	if err := provider.PinCertificates(base, p.TLSPins); err != nil {
+		return nil, fmt.Errorf("tls_pins: %w", err)
+	}
 
-	var transport http.RoundTripper = base
+	pool := provider.NewPoolTransport(base, p.Name, p.MaxConnLifetime, p.ResetFlushThreshold)
+	var transport http.RoundTripper = pool
+	var refresh cloudauth.RefreshPolicy
+	if p.Auth != nil {
+		refresh = cloudauth.RefreshPolicy{Before: p.Auth.RefreshBefore, Jitter: p.Auth.RefreshJitter}
+	}
 
 	switch p.ResolvedAuthType() {
 	case "gcp_oauth":
-		gcpTransport, err := cloudauth.NewGCPOAuthTransport(ctx, base,
+		gcpTransport, err := cloudauth.NewGCPOAuthTransport(ctx, pool, refresh,
 			"https://www.googleapis.com/auth/cloud-platform",
 		)
 		if err != nil {
@@ -425,21 +790,54 @@ func buildProviderClient(ctx context.Context, p config.ProviderEntry, resolver *
 		if err != nil {
 			return nil, fmt.Errorf("aws credentials: %w", err)
 		}
-		transport = cloudauth.NewAWSSigV4Transport(base, awsCfg.Credentials, p.Region, "bedrock-runtime")
+		transport = cloudauth.NewAWSSigV4Transport(pool, awsCfg.Credentials, refresh, p.Region, "bedrock-runtime")
 	case "api_key":
-		apiKey := p.ResolvedAPIKey()
-		if apiKey != "" {
+		apiKeys := p.ResolvedAPIKeys()
+		if len(apiKeys) > 0 {
 			headerName, prefix := authHeaderForType(p.ResolvedType(), p.ResolvedHosting())
 			transport = &cloudauth.APIKeyTransport{
-				Key:        apiKey,
+				Key:        apiKeys[0],
+				Keys:       apiKeys,
 				HeaderName: headerName,
 				Prefix:     prefix,
-				Base:       base,
+				Base:       pool,
 			}
 		}
 		// Empty API key: no auth transport (e.g. local Ollama).
 	default:
-		return nil, fmt.Errorf("unsupported auth type: %q", p.ResolvedAuthType())
+		if !cloudauth.HasSigner(p.ResolvedAuthType()) {
+			return nil, fmt.Errorf("unsupported auth type: %q", p.ResolvedAuthType())
+		}
+		signing, err := cloudauth.NewSigningTransport(p.ResolvedAuthType(), pool, p.Auth.Params)
+		if err != nil {
+			return nil, err
+		}
+		transport = signing
+	}
+
+	transport = &provider.DecompressTransport{Base: transport}
+
+	// Outside the auth transports so only the response returned after any
+	// API key rotation is observed.
+	if limits != nil {
+		transport = &provider.UpstreamLimitTransport{Base: transport, Provider: p.Name, Limits: limits}
+	}
+	transport = &provider.LimitTransport{Base: transport, Limit: p.MaxResponseBytes}
+
+	// Outside the auth transports so request signatures cover the rewrite.
+	if p.Transform != nil {
+		tt := &provider.TransformTransport{Base: transport, Provider: p.Name}
+		if len(p.Transform.Request) > 0 {
+			if tt.Request, err = provider.ParseTransform(p.Transform.Request); err != nil {
+				return nil, fmt.Errorf("transform.request: %w", err)
+			}
+		}
+		if len(p.Transform.Response) > 0 {
+			if tt.Response, err = provider.ParseTransform(p.Transform.Response); err != nil {
+				return nil, fmt.Errorf("transform.response: %w", err)
+			}
+		}
+		transport = tt
 	}
 
 	client := &http.Client{Transport: transport}
@@ -467,3 +865,22 @@ func authHeaderForType(provType, hosting string) (string, string) {
 		return "Authorization", "Bearer "
 	}
 }
+
+// buildQuotaResetWorker parses the configured budget periods into a worker
+// that renews key budgets at each period boundary.
+func buildQuotaResetWorker(cfg config.QuotaConfig, tracker *ratelimit.QuotaTracker, store *sqlite.Store) (*worker.QuotaResetWorker, error) {
+	period, err := ratelimit.ParseBudgetPeriod(cfg.Period)
+	if err != nil {
+		return nil, fmt.Errorf("quota.period: %w", err)
+	}
+	orgPeriods := make(map[string]ratelimit.BudgetPeriod, len(cfg.OrgPeriods))
+	for org, s := range cfg.OrgPeriods {
+		p, err := ratelimit.ParseBudgetPeriod(s)
+		if err != nil {
+			return nil, fmt.Errorf("quota.org_periods[%s]: %w", org, err)
+		}
+		orgPeriods[org] = p
+	}
+	slog.Info("quota periods configured", "period", string(period), "org_overrides", len(orgPeriods))
+	return worker.NewQuotaResetWorker(tracker, store, store, period, orgPeriods), nil
+}
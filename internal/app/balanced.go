@@ -0,0 +1,123 @@
+package app
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+// StrategyBalanced orders route targets by a weighted blend of price and
+// observed latency instead of static priority.
+const StrategyBalanced = "balanced"
+
+// latencyAlpha is the EWMA weight of each new latency sample.
+const latencyAlpha = 0.2
+
+// LatencyTracker keeps an exponentially weighted moving average of upstream
+// latency per provider/model pair. ProxyService feeds it from successful
+// non-streaming chat completions.
+type LatencyTracker struct {
+	mu   sync.Mutex
+	ewma map[string]time.Duration
+}
+
+// NewLatencyTracker returns an empty tracker.
+func NewLatencyTracker() *LatencyTracker {
+	return &LatencyTracker{ewma: make(map[string]time.Duration)}
+}
+
+// Observe folds one latency sample into the average for providerID/model.
+func (t *LatencyTracker) Observe(providerID, model string, d time.Duration) {
+	key := providerID + "/" + model
+	t.mu.Lock()
+	if cur, ok := t.ewma[key]; ok {
+		d = time.Duration(latencyAlpha*float64(d) + (1-latencyAlpha)*float64(cur))
+	}
+	t.ewma[key] = d
+	t.mu.Unlock()
+}
+
+// Get returns the average latency for providerID/model, if any was observed.
+func (t *LatencyTracker) Get(providerID, model string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d, ok := t.ewma[providerID+"/"+model]
+	return d, ok
+}
+
+// BalancedScorer ranks targets by
+//
+//	costWeight*cost/maxCost + latencyWeight*latency/maxLatency
+//
+// where the maxima are taken over the route's targets, so both terms fall in
+// [0, 1]. Cost is the target model's input+output price per 1M tokens. A
+// target with no price counts as the most expensive; a target with no latency
+// sample yet counts as the fastest so it gets traffic and a measurement.
+type BalancedScorer struct {
+	prices        map[string]gateway.ModelPrice
+	latency       *LatencyTracker
+	costWeight    float64
+	latencyWeight float64
+}
+
+// NewBalancedScorer returns a scorer over prices (keyed by provider-side
+// model name) with the given weights.
+func NewBalancedScorer(prices map[string]gateway.ModelPrice, costWeight, latencyWeight float64) *BalancedScorer {
+	return &BalancedScorer{
+		prices:        prices,
+		latency:       NewLatencyTracker(),
+		costWeight:    costWeight,
+		latencyWeight: latencyWeight,
+	}
+}
+
+// Order returns a copy of targets sorted by ascending blended score. Ties
+// keep the incoming (priority) order.
+func (s *BalancedScorer) Order(targets []ResolvedTarget) []ResolvedTarget {
+	costs := make([]float64, len(targets))
+	lats := make([]float64, len(targets))
+	priced := make([]bool, len(targets))
+	var maxCost, maxLat float64
+	for i, t := range targets {
+		if p, ok := s.prices[t.Model]; ok {
+			costs[i], priced[i] = p.InputPer1M+p.OutputPer1M, true
+			maxCost = max(maxCost, costs[i])
+		}
+		if d, ok := s.latency.Get(t.ProviderID, t.Model); ok {
+			lats[i] = float64(d)
+			maxLat = max(maxLat, lats[i])
+		}
+	}
+
+	type scored struct {
+		t     ResolvedTarget
+		score float64
+	}
+	ranked := make([]scored, len(targets))
+	for i, t := range targets {
+		normCost := 1.0
+		if priced[i] {
+			normCost = 0
+			if maxCost > 0 {
+				normCost = costs[i] / maxCost
+			}
+		}
+		var normLat float64
+		if maxLat > 0 {
+			normLat = lats[i] / maxLat
+		}
+		ranked[i] = scored{t: t, score: s.costWeight*normCost + s.latencyWeight*normLat}
+	}
+	slices.SortStableFunc(ranked, func(a, b scored) int {
+		return cmp.Compare(a.score, b.score)
+	})
+
+	out := make([]ResolvedTarget, len(ranked))
+	for i, r := range ranked {
+		out[i] = r.t
+	}
+	return out
+}
@@ -0,0 +1,146 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
+	"github.com/eugener/gandalf/internal/testutil"
+)
+
+// balancedTargets is a cheap-but-slow target and a pricey-but-fast one.
+var balancedTargets = []ResolvedTarget{
+	{ProviderID: "cheap", Model: "mini", Priority: 1},
+	{ProviderID: "fast", Model: "turbo", Priority: 2},
+}
+
+func newTestScorer(costWeight, latencyWeight float64) *BalancedScorer {
+	s := NewBalancedScorer(map[string]gateway.ModelPrice{
+		"mini":  {InputPer1M: 0.15, OutputPer1M: 0.60},
+		"turbo": {InputPer1M: 2.50, OutputPer1M: 10.00},
+	}, costWeight, latencyWeight)
+	s.latency.Observe("cheap", "mini", 2*time.Second)
+	s.latency.Observe("fast", "turbo", 200*time.Millisecond)
+	return s
+}
+
+func providerOrder(targets []ResolvedTarget) []string {
+	out := make([]string, len(targets))
+	for i, t := range targets {
+		out[i] = t.ProviderID
+	}
+	return out
+}
+
+func TestBalancedScorer_WeightsChangeOrder(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name                      string
+		costWeight, latencyWeight float64
+		want                      string
+	}{
+		{"cost only", 1, 0, "cheap"},
+		{"latency only", 0, 1, "fast"},
+		{"cost heavy", 0.8, 0.2, "cheap"},
+		{"latency heavy", 0.2, 0.8, "fast"},
+	}
+	for _, tt := range tests {
+		got := newTestScorer(tt.costWeight, tt.latencyWeight).Order(balancedTargets)
+		if got[0].ProviderID != tt.want {
+			t.Errorf("%s: order = %v, want %s first", tt.name, providerOrder(got), tt.want)
+		}
+	}
+}
+
+func TestBalancedScorer_Unknowns(t *testing.T) {
+	t.Parallel()
+	s := NewBalancedScorer(map[string]gateway.ModelPrice{
+		"mini": {InputPer1M: 0.15, OutputPer1M: 0.60},
+	}, 1, 0)
+	// "turbo" has no price: it ranks as the most expensive.
+	if got := s.Order(balancedTargets); got[0].ProviderID != "cheap" {
+		t.Errorf("unpriced target: order = %v, want cheap first", providerOrder(got))
+	}
+
+	// Only "cheap" has a latency sample: the unmeasured target goes first.
+	s = NewBalancedScorer(nil, 0, 1)
+	s.latency.Observe("cheap", "mini", time.Second)
+	if got := s.Order(balancedTargets); got[0].ProviderID != "fast" {
+		t.Errorf("unmeasured target: order = %v, want fast first", providerOrder(got))
+	}
+
+	// Equal scores keep priority order.
+	s = NewBalancedScorer(nil, 0.5, 0.5)
+	if got := s.Order(balancedTargets); got[0].ProviderID != "cheap" {
+		t.Errorf("tie: order = %v, want priority order", providerOrder(got))
+	}
+}
+
+func TestLatencyTracker_EWMA(t *testing.T) {
+	t.Parallel()
+	lt := NewLatencyTracker()
+	if _, ok := lt.Get("p", "m"); ok {
+		t.Fatal("Get on empty tracker = ok, want not ok")
+	}
+	lt.Observe("p", "m", time.Second)
+	lt.Observe("p", "m", 2*time.Second)
+	if d, _ := lt.Get("p", "m"); d != 1200*time.Millisecond {
+		t.Errorf("ewma = %v, want 1.2s", d)
+	}
+}
+
+func TestResolveModel_BalancedStrategy(t *testing.T) {
+	t.Parallel()
+	store := testutil.NewFakeStore()
+	targets := []byte(`[{"provider_id":"cheap","model":"mini","priority":1},{"provider_id":"fast","model":"turbo","priority":2}]`)
+	store.AddRoute(&gateway.Route{ID: "r-1", ModelAlias: "smart", Targets: targets, Strategy: StrategyBalanced})
+	store.AddRoute(&gateway.Route{ID: "r-2", ModelAlias: "fixed", Targets: targets, Strategy: "priority"})
+	ctx := context.Background()
+
+	rs := NewRouterService(store)
+	rs.SetBalancedScorer(newTestScorer(0, 1))
+
+	got, err := rs.ResolveModel(ctx, "smart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].ProviderID != "fast" {
+		t.Errorf("balanced route order = %v, want fast first", providerOrder(got))
+	}
+	got, _ = rs.ResolveModel(ctx, "fixed")
+	if got[0].ProviderID != "cheap" {
+		t.Errorf("priority route order = %v, want priority order", providerOrder(got))
+	}
+
+	// Without a scorer, balanced routes keep priority order.
+	got, _ = NewRouterService(store).ResolveModel(ctx, "smart")
+	if got[0].ProviderID != "cheap" {
+		t.Errorf("no scorer: order = %v, want priority order", providerOrder(got))
+	}
+}
+
+func TestProxyService_ObservesLatency(t *testing.T) {
+	t.Parallel()
+	reg := provider.NewRegistry()
+	reg.Register("fast", &testutil.FakeProvider{ProviderName: "fast"})
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:         "r-1",
+		ModelAlias: "smart",
+		Targets:    []byte(`[{"provider_id":"fast","model":"turbo","priority":1}]`),
+		Strategy:   StrategyBalanced,
+	})
+	rs := NewRouterService(store)
+	scorer := NewBalancedScorer(nil, 0.5, 0.5)
+	rs.SetBalancedScorer(scorer)
+	ps := NewProxyService(reg, rs, nil, nil)
+
+	if _, err := ps.ChatCompletion(context.Background(), &gateway.ChatRequest{Model: "smart"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := scorer.latency.Get("fast", "turbo"); !ok {
+		t.Error("no latency sample recorded for fast/turbo")
+	}
+}
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/tidwall/gjson"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+// SetCapabilityOverrides applies config overrides, keyed by provider-side
+// model name, on top of provider-reported capabilities when filtering
+// route targets. nil (the default) uses reported capabilities only.
+func (ps *ProxyService) SetCapabilityOverrides(m map[string]gateway.CapabilityOverride) {
+	ps.capabilities = m
+}
+
+// requiredCapabilities returns the capabilities a target needs to serve req:
+// those requested via gateway.SetRequiredCapabilities, plus "vision" when a
+// message has image parts and "tools" when the request declares tools.
+func requiredCapabilities(ctx context.Context, req *gateway.ChatRequest) []string {
+	need := gateway.RequiredCapabilitiesFromContext(ctx)
+	if len(req.Tools) > 0 && string(req.Tools) != "null" && !slices.Contains(need, "tools") {
+		need = append(slices.Clip(need), "tools")
+	}
+	if hasImageParts(req.Messages) && !slices.Contains(need, "vision") {
+		need = append(slices.Clip(need), "vision")
+	}
+	return need
+}
+
+// hasImageParts reports whether any message content is an array with an
+// image part.
+func hasImageParts(msgs []gateway.Message) bool {
+	for _, m := range msgs {
+		if len(m.Content) == 0 || m.Content[0] != '[' {
+			continue
+		}
+		found := false
+		gjson.ParseBytes(m.Content).ForEach(func(_, part gjson.Result) bool {
+			switch part.Get("type").String() {
+			case "image_url", "input_image", "image":
+				found = true
+			}
+			return !found
+		})
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// filterByCapability drops the targets known to lack a capability req
+// needs. A target is known when its provider reports capabilities or an
+// override names its model; unknown targets are kept. targets is never
+// modified, since the router caches it. Fails with ErrNoCapableTarget when
+// nothing is left.
+func (ps *ProxyService) filterByCapability(ctx context.Context, req *gateway.ChatRequest, targets []ResolvedTarget) ([]ResolvedTarget, error) {
+	need := requiredCapabilities(ctx, req)
+	if len(need) == 0 {
+		return targets, nil
+	}
+	kept := make([]ResolvedTarget, 0, len(targets))
+	for _, t := range targets {
+		if ps.lacksCapability(t, need) {
+			continue
+		}
+		kept = append(kept, t)
+	}
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("%w %v for model %q", gateway.ErrNoCapableTarget, need, req.Model)
+	}
+	return kept, nil
+}
+
+// lacksCapability reports whether target is known to lack any of need.
+func (ps *ProxyService) lacksCapability(target ResolvedTarget, need []string) bool {
+	var caps gateway.Capabilities
+	known := false
+	if p, err := ps.providers.Get(target.ProviderID); err == nil {
+		if cr, ok := p.(gateway.CapabilityReporter); ok {
+			caps, known = cr.Capabilities(target.Model), true
+		}
+	}
+	if o, ok := ps.capabilities[target.Model]; ok {
+		caps, known = o.Apply(caps), true
+	}
+	if !known {
+		return false
+	}
+	for _, name := range need {
+		if !caps.Supports(name) {
+			return true
+		}
+	}
+	return false
+}
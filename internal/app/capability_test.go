@@ -0,0 +1,198 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
+	"github.com/eugener/gandalf/internal/testutil"
+)
+
+// capableProvider is a FakeProvider that reports fixed capabilities.
+type capableProvider struct {
+	*testutil.FakeProvider
+	caps gateway.Capabilities
+}
+
+func (p capableProvider) Capabilities(string) gateway.Capabilities { return p.caps }
+
+// newCapabilityProxy routes "model-a" to a text-only target first, then a
+// vision target, then a target whose provider reports nothing.
+func newCapabilityProxy() *ProxyService {
+	answer := func(id string) func(context.Context, *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+		return func(context.Context, *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			return completion(id, `"ok"`), nil
+		}
+	}
+	reg := provider.NewRegistry()
+	reg.Register("text", capableProvider{
+		FakeProvider: &testutil.FakeProvider{ProviderName: "text", ChatFn: answer("text")},
+		caps:         gateway.Capabilities{Chat: true, Streaming: true},
+	})
+	reg.Register("vision", capableProvider{
+		FakeProvider: &testutil.FakeProvider{ProviderName: "vision", ChatFn: answer("vision")},
+		caps:         gateway.Capabilities{Chat: true, Vision: true, Streaming: true},
+	})
+	reg.Register("unknown", &testutil.FakeProvider{ProviderName: "unknown", ChatFn: answer("unknown")})
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:         "r-1",
+		ModelAlias: "model-a",
+		Targets: []byte(`[{"provider_id":"text","model":"m-text","priority":1},` +
+			`{"provider_id":"vision","model":"m-vision","priority":2},` +
+			`{"provider_id":"unknown","model":"m-unknown","priority":3}]`),
+		Strategy: "priority",
+	})
+	return NewProxyService(reg, NewRouterService(store), nil, nil)
+}
+
+func TestChatCompletion_CapabilityRouting(t *testing.T) {
+	t.Parallel()
+	text := []gateway.Message{{Role: "user", Content: json.RawMessage(`"hi"`)}}
+	image := []gateway.Message{{Role: "user", Content: json.RawMessage(
+		`[{"type":"text","text":"what is this?"},{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]`)}}
+	tools := json.RawMessage(`[{"type":"function","function":{"name":"f"}}]`)
+
+	tests := []struct {
+		name    string
+		msgs    []gateway.Message
+		tools   json.RawMessage
+		require []string // via context, as from X-Gandalf-Require
+		want    string
+	}{
+		{"text", text, nil, nil, "text"},
+		{"image skips text-only target", image, nil, nil, "vision"},
+		{"required via context", text, nil, []string{"vision"}, "vision"},
+		// Neither reporting provider supports tools; the unreporting one is kept.
+		{"tools", text, tools, nil, "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := gateway.ContextWithRequestID(context.Background(), "req-1")
+			gateway.SetRequiredCapabilities(ctx, tt.require)
+			resp, err := newCapabilityProxy().ChatCompletion(ctx, &gateway.ChatRequest{Model: "model-a", Messages: tt.msgs, Tools: tt.tools})
+			if err != nil {
+				t.Fatalf("ChatCompletion: %v", err)
+			}
+			if resp.ID != tt.want {
+				t.Errorf("served by %q, want %q", resp.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestChatCompletion_NoCapableTarget(t *testing.T) {
+	t.Parallel()
+	ps := newCapabilityProxy()
+	// Mark the unreporting target text-only by its provider-side model.
+	no := false
+	ps.SetCapabilityOverrides(map[string]gateway.CapabilityOverride{"m-unknown": {Tools: &no}})
+
+	_, err := ps.ChatCompletion(context.Background(), &gateway.ChatRequest{
+		Model: "model-a",
+		Tools: json.RawMessage(`[{"type":"function","function":{"name":"f"}}]`),
+	})
+	if !errors.Is(err, gateway.ErrNoCapableTarget) {
+		t.Errorf("err = %v, want ErrNoCapableTarget", err)
+	}
+}
+
+func TestHasImageParts(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		content string
+		want    bool
+	}{
+		{`"see https://example.com/a.png"`, false},
+		{`[{"type":"text","text":"hi"}]`, false},
+		{`[{"type":"text","text":"hi"},{"type":"image_url","image_url":{"url":"data:image/png;base64,AA=="}}]`, true},
+		{`null`, false},
+	}
+	for _, tt := range tests {
+		msgs := []gateway.Message{{Role: "user", Content: json.RawMessage(tt.content)}}
+		if got := hasImageParts(msgs); got != tt.want {
+			t.Errorf("hasImageParts(%s) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestChatCompletionStream_FailoverToNonStreaming(t *testing.T) {
+	t.Parallel()
+	var gotStream *bool
+	reg := provider.NewRegistry()
+	reg.Register("streamer", capableProvider{
+		FakeProvider: &testutil.FakeProvider{
+			ProviderName: "streamer",
+			StreamFn: func(context.Context, *gateway.ChatRequest) (<-chan gateway.StreamChunk, error) {
+				return nil, errors.New("upstream 503")
+			},
+		},
+		caps: gateway.Capabilities{Chat: true, Streaming: true},
+	})
+	reg.Register("batch", capableProvider{
+		FakeProvider: &testutil.FakeProvider{
+			ProviderName: "batch",
+			StreamFn: func(context.Context, *gateway.ChatRequest) (<-chan gateway.StreamChunk, error) {
+				t.Error("non-streaming provider was asked to stream")
+				return nil, errors.New("cannot stream")
+			},
+			ChatFn: func(_ context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+				gotStream = &req.Stream
+				resp := completion("batch-1", `"from batch"`)
+				resp.Usage = &gateway.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5}
+				return resp, nil
+			},
+		},
+		caps: gateway.Capabilities{Chat: true},
+	})
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:         "r-1",
+		ModelAlias: "mixed",
+		Targets:    []byte(`[{"provider_id":"streamer","model":"s","priority":1},{"provider_id":"batch","model":"b","priority":2}]`),
+	})
+	ps := NewProxyService(reg, NewRouterService(store), nil, nil)
+
+	req := &gateway.ChatRequest{
+		Model:         "mixed",
+		Stream:        true,
+		StreamOptions: &gateway.StreamOptions{IncludeUsage: true},
+		Messages:      []gateway.Message{{Role: "user", Content: json.RawMessage(`"hi"`)}},
+	}
+	ctx := gateway.ContextWithRequestID(context.Background(), "req-1")
+	ch, err := ps.ChatCompletionStream(ctx, req)
+	if err != nil {
+		t.Fatalf("ChatCompletionStream: %v", err)
+	}
+	var data []string
+	var final gateway.StreamChunk
+	for c := range ch {
+		if c.Done {
+			final = c
+			continue
+		}
+		data = append(data, string(c.Data))
+	}
+
+	if gotStream == nil || *gotStream {
+		t.Error("secondary was not called without streaming")
+	}
+	if !req.Stream || req.StreamOptions == nil {
+		t.Error("caller's request was modified")
+	}
+	if len(data) != 2 || !strings.Contains(data[0], `"object":"chat.completion.chunk"`) ||
+		!strings.Contains(data[0], `"content":"from batch"`) || !strings.Contains(data[1], `"usage"`) {
+		t.Errorf("chunks = %v, want one content chunk and one usage chunk", data)
+	}
+	if final.Usage == nil || final.Usage.TotalTokens != 5 {
+		t.Errorf("final chunk = %+v, want usage", final)
+	}
+	if p, m := gateway.RequestTargetFromContext(ctx); p != "batch" || m != "b" {
+		t.Errorf("request target = %s/%s, want batch/b", p, m)
+	}
+}
@@ -0,0 +1,34 @@
+package app
+
+import gateway "github.com/eugener/gandalf/internal"
+
+// flatCostPerToken is the USD charged per token for models without a price:
+// $0.01 per 1K tokens, a rough average.
+const flatCostPerToken = 0.00001
+
+// StaticCostModel prices usage from a fixed table of per-model list prices.
+// It is the default cost model; deployments with negotiated, tiered, or
+// per-org pricing supply their own and can wrap this one.
+type StaticCostModel struct {
+	prices map[string]gateway.ModelPrice
+}
+
+// NewStaticCostModel returns a cost model over prices (USD per 1M tokens,
+// keyed by model). A nil table charges every model the flat rate.
+func NewStaticCostModel(prices map[string]gateway.ModelPrice) *StaticCostModel {
+	return &StaticCostModel{prices: prices}
+}
+
+// Cost returns the USD cost of usage on model: prompt and completion tokens
+// at the model's input and output prices, or the flat rate for all tokens
+// when the model has no price. The identity is ignored.
+func (m *StaticCostModel) Cost(model string, usage *gateway.Usage, _ *gateway.Identity) float64 {
+	if usage == nil {
+		return 0
+	}
+	p, ok := m.prices[model]
+	if !ok {
+		return float64(usage.TotalTokens) * flatCostPerToken
+	}
+	return (float64(usage.PromptTokens)*p.InputPer1M + float64(usage.CompletionTokens)*p.OutputPer1M) / 1e6
+}
@@ -0,0 +1,34 @@
+package app
+
+import (
+	"math"
+	"testing"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+func TestStaticCostModel(t *testing.T) {
+	t.Parallel()
+	m := NewStaticCostModel(map[string]gateway.ModelPrice{
+		"gpt-4o": {InputPer1M: 2.5, OutputPer1M: 10},
+	})
+	tests := []struct {
+		name  string
+		model string
+		usage *gateway.Usage
+		want  float64
+	}{
+		{"nil usage", "gpt-4o", nil, 0},
+		{"priced", "gpt-4o", &gateway.Usage{PromptTokens: 1000, CompletionTokens: 500, TotalTokens: 1500}, 0.0075},
+		{"unpriced 100 tokens", "llama3", &gateway.Usage{TotalTokens: 100}, 0.001},
+		{"unpriced 1000 tokens", "llama3", &gateway.Usage{TotalTokens: 1000}, 0.01},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := m.Cost(tt.model, tt.usage, nil); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("Cost() = %f, want %f", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/circuitbreaker"
+)
+
+// Debug attempt outcomes for targets that were never called.
+const (
+	outcomeOK          = "ok"
+	outcomeCircuitOpen = "circuit_open"
+	outcomeUnavailable = "unavailable"
+)
+
+// debugRoute records the resolved targets when the request carries a debug
+// trace. No-op otherwise.
+func debugRoute(ctx context.Context, targets []ResolvedTarget) {
+	dt := gateway.DebugTraceFromContext(ctx)
+	if dt == nil {
+		return
+	}
+	dt.Route = make([]gateway.DebugTarget, len(targets))
+	for i, t := range targets {
+		dt.Route[i] = gateway.DebugTarget{Provider: t.ProviderID, Model: t.Model, Priority: t.Priority}
+	}
+}
+
+// debugAttempt records one provider call. outcome overrides the error
+// classification for targets that were skipped; pass "" otherwise.
+func debugAttempt(ctx context.Context, t ResolvedTarget, outcome string, d time.Duration, err error) {
+	dt := gateway.DebugTraceFromContext(ctx)
+	if dt == nil {
+		return
+	}
+	a := gateway.DebugAttempt{Provider: t.ProviderID, Model: t.Model, Outcome: outcome, LatencyMs: d.Milliseconds()}
+	if a.Outcome == "" {
+		a.Outcome = outcomeOK
+		if err != nil {
+			a.Outcome = circuitbreaker.ErrorCategory(err)
+			var he httpStatusError
+			if errors.As(err, &he) {
+				a.Status = he.HTTPStatus()
+			}
+		}
+	}
+	dt.Attempts = append(dt.Attempts, a)
+}
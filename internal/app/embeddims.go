@@ -0,0 +1,82 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+// SetTruncateEmbeddings makes the service shorten embeddings to the
+// request's dimensions when the provider ignored them (every provider but
+// OpenAI). Vectors are cut to the first n values and rescaled to unit
+// length, which is how OpenAI's v3 models shorten them too. Off by default:
+// oversized vectors then count as a dimension mismatch.
+func (ps *ProxyService) SetTruncateEmbeddings(on bool) {
+	ps.truncateEmbeddings = on
+}
+
+// checkDimensions rejects a non-positive dimensions value before any
+// provider is called.
+func checkDimensions(dims *int) error {
+	if dims != nil && *dims <= 0 {
+		return fmt.Errorf("%w: dimensions must be positive", gateway.ErrBadRequest)
+	}
+	return nil
+}
+
+// truncateEmbeddings cuts every embedding in an OpenAI-format data array
+// longer than dims to its first dims values and renormalizes it to unit
+// length. Base64 embeddings are decoded first; results are float arrays,
+// so callers transcode afterwards.
+func truncateEmbeddings(data json.RawMessage, dims int) (json.RawMessage, error) {
+	var items []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("decode embedding data: %w", err)
+	}
+	for i, item := range items {
+		raw, ok := item["embedding"]
+		if !ok {
+			continue
+		}
+		if len(raw) > 0 && raw[0] == '"' {
+			var err error
+			if raw, err = base64ToFloats(raw); err != nil {
+				return nil, fmt.Errorf("embedding %d: %w", i, err)
+			}
+		}
+		var vec []float64
+		if err := json.Unmarshal(raw, &vec); err != nil {
+			return nil, fmt.Errorf("embedding %d: %w", i, err)
+		}
+		if len(vec) > dims {
+			raw = normalizedFloats(vec[:dims])
+		}
+		item["embedding"] = raw
+	}
+	return json.Marshal(items)
+}
+
+// normalizedFloats returns vec scaled to unit length as a JSON float array
+// at float32 precision. A zero vector is returned as is.
+func normalizedFloats(vec []float64) json.RawMessage {
+	var sum float64
+	for _, f := range vec {
+		sum += f * f
+	}
+	norm := math.Sqrt(sum)
+	if norm == 0 {
+		norm = 1
+	}
+	out := make([]byte, 0, 2+len(vec)*12)
+	out = append(out, '[')
+	for i, f := range vec {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = strconv.AppendFloat(out, f/norm, 'g', -1, 32)
+	}
+	return append(out, ']')
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
+	"github.com/eugener/gandalf/internal/testutil"
+)
+
+func TestTruncateEmbeddings(t *testing.T) {
+	t.Parallel()
+	data := []byte(`[{"index":0,"embedding":[3,4,12]},{"index":1,"embedding":"` + encodeFloat32s(0, 2, 5) + `"},{"index":2,"embedding":[1]}]`)
+	got, err := truncateEmbeddings(data, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"embedding":[0.6,0.8],"index":0},{"embedding":[0,1],"index":1},{"embedding":[1],"index":2}]`
+	if string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestEmbeddings_Dimensions(t *testing.T) {
+	t.Parallel()
+
+	var sawDims *int
+	reg := provider.NewRegistry()
+	reg.Register("gemini", &testutil.FakeProvider{
+		ProviderName: "gemini",
+		EmbedFn: func(_ context.Context, req *gateway.EmbeddingRequest) (*gateway.EmbeddingResponse, error) {
+			sawDims = req.Dimensions
+			// Provider ignores dimensions and returns the full vector.
+			return &gateway.EmbeddingResponse{
+				Object: "list",
+				Data:   []byte(`[{"object":"embedding","index":0,"embedding":[3,4,12,0]}]`),
+				Model:  req.Model,
+			}, nil
+		},
+	})
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:         "r-1",
+		ModelAlias: "text-embed",
+		Targets:    []byte(`[{"provider_id":"gemini","model":"text-embed","priority":1}]`),
+	})
+	dims := 2
+	req := &gateway.EmbeddingRequest{Model: "text-embed", Dimensions: &dims}
+
+	// Without truncation the oversized vector is a mismatch.
+	ps := NewProxyService(reg, NewRouterService(store), nil, nil)
+	if _, err := ps.Embeddings(context.Background(), req); !errors.Is(err, gateway.ErrDimensionMismatch) {
+		t.Errorf("truncation off: err = %v, want ErrDimensionMismatch", err)
+	}
+
+	ps.SetTruncateEmbeddings(true)
+	resp, err := ps.Embeddings(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Embeddings: %v", err)
+	}
+	if sawDims == nil || *sawDims != 2 {
+		t.Errorf("provider saw dimensions %v, want 2", sawDims)
+	}
+	if got := embeddingDims(resp.Data); got != 2 {
+		t.Errorf("dims = %d, want 2", got)
+	}
+	want := `[{"embedding":[0.6,0.8],"index":0,"object":"embedding"}]`
+	if string(resp.Data) != want {
+		t.Errorf("data = %s, want %s", resp.Data, want)
+	}
+
+	zero := 0
+	if _, err := ps.Embeddings(context.Background(), &gateway.EmbeddingRequest{Model: "text-embed", Dimensions: &zero}); !errors.Is(err, gateway.ErrBadRequest) {
+		t.Errorf("dimensions 0: err = %v, want ErrBadRequest", err)
+	}
+}
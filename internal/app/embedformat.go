@@ -0,0 +1,128 @@
+package app
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/tidwall/gjson"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+// Embedding encoding formats accepted in EmbeddingRequest.EncodingFormat.
+// An empty format means float, matching OpenAI.
+const (
+	encodingFloat  = "float"
+	encodingBase64 = "base64"
+)
+
+// transcodeEmbeddings rewrites each item's "embedding" in an OpenAI-format
+// data array to the requested encoding. Providers that ignore
+// encoding_format return floats; OpenAI returns whatever was asked. Base64
+// is little-endian float32, as OpenAI encodes it. Data already in the
+// requested format is returned unchanged without re-encoding.
+func transcodeEmbeddings(data json.RawMessage, format string) (json.RawMessage, error) {
+	if format == "" {
+		format = encodingFloat
+	}
+	if !needsTranscode(data, format) {
+		return data, nil
+	}
+
+	var items []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("decode embedding data: %w", err)
+	}
+	for i, item := range items {
+		raw, ok := item["embedding"]
+		if !ok {
+			continue
+		}
+		var (
+			out json.RawMessage
+			err error
+		)
+		if format == encodingBase64 {
+			out, err = floatsToBase64(raw)
+		} else {
+			out, err = base64ToFloats(raw)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("embedding %d: %w", i, err)
+		}
+		item["embedding"] = out
+	}
+	return json.Marshal(items)
+}
+
+// checkEncodingFormat rejects encoding formats gandalf can't transcode to,
+// before any provider is called.
+func checkEncodingFormat(format string) error {
+	switch format {
+	case "", encodingFloat, encodingBase64:
+		return nil
+	}
+	return fmt.Errorf("%w: unsupported encoding_format %q", gateway.ErrBadRequest, format)
+}
+
+// needsTranscode reports whether any item's embedding is not already in format.
+func needsTranscode(data []byte, format string) bool {
+	need := false
+	gjson.ParseBytes(data).ForEach(func(_, item gjson.Result) bool {
+		e := item.Get("embedding")
+		isBase64 := e.Type == gjson.String
+		if e.Exists() && isBase64 != (format == encodingBase64) {
+			need = true
+			return false
+		}
+		return true
+	})
+	return need
+}
+
+// floatsToBase64 encodes a JSON float array as a base64 JSON string.
+func floatsToBase64(raw json.RawMessage) (json.RawMessage, error) {
+	var vec []float64
+	if err := json.Unmarshal(raw, &vec); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4*len(vec))
+	for i, f := range vec {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(float32(f)))
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(buf))
+}
+
+// base64ToFloats decodes a base64 JSON string into a JSON float array.
+// Values are formatted at float32 precision so 0.1 stays 0.1 rather than
+// 0.10000000149011612.
+func base64ToFloats(raw json.RawMessage) (json.RawMessage, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, err
+	}
+	buf, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf)%4 != 0 {
+		return nil, fmt.Errorf("base64 embedding is %d bytes, not a multiple of 4", len(buf))
+	}
+	out := make([]byte, 0, 2+len(buf)*3)
+	out = append(out, '[')
+	for i := 0; i < len(buf); i += 4 {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		f := math.Float32frombits(binary.LittleEndian.Uint32(buf[i:]))
+		if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+			return nil, fmt.Errorf("base64 embedding has non-finite value at index %d", i/4)
+		}
+		out = strconv.AppendFloat(out, float64(f), 'g', -1, 32)
+	}
+	return append(out, ']'), nil
+}
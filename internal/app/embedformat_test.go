@@ -0,0 +1,148 @@
+package app
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
+	"github.com/eugener/gandalf/internal/testutil"
+)
+
+// encodeFloat32s returns the OpenAI base64 encoding of vec.
+func encodeFloat32s(vec ...float32) string {
+	buf := make([]byte, 4*len(vec))
+	for i, f := range vec {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+func TestTranscodeEmbeddings_FloatToBase64(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`[{"object":"embedding","index":0,"embedding":[0.1,-2.5,3]},{"object":"embedding","index":1,"embedding":[1]}]`)
+	got, err := transcodeEmbeddings(data, "base64")
+	if err != nil {
+		t.Fatalf("transcode: %v", err)
+	}
+
+	var items []struct {
+		Object    string `json:"object"`
+		Index     int    `json:"index"`
+		Embedding string `json:"embedding"`
+	}
+	if err := json.Unmarshal(got, &items); err != nil {
+		t.Fatalf("decode %s: %v", got, err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("items = %d, want 2", len(items))
+	}
+	if want := encodeFloat32s(0.1, -2.5, 3); items[0].Embedding != want {
+		t.Errorf("item 0 embedding = %q, want %q", items[0].Embedding, want)
+	}
+	if want := encodeFloat32s(1); items[1].Embedding != want {
+		t.Errorf("item 1 embedding = %q, want %q", items[1].Embedding, want)
+	}
+	if items[1].Object != "embedding" || items[1].Index != 1 {
+		t.Errorf("item 1 fields not preserved: %+v", items[1])
+	}
+}
+
+func TestTranscodeEmbeddings_Base64ToFloat(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`[{"object":"embedding","index":0,"embedding":"` + encodeFloat32s(0.1, -2.5, 3) + `"}]`)
+	for _, format := range []string{"", "float"} {
+		got, err := transcodeEmbeddings(data, format)
+		if err != nil {
+			t.Fatalf("format %q: transcode: %v", format, err)
+		}
+		var items []struct {
+			Embedding json.RawMessage `json:"embedding"`
+		}
+		if err := json.Unmarshal(got, &items); err != nil {
+			t.Fatalf("format %q: decode %s: %v", format, got, err)
+		}
+		if s := string(items[0].Embedding); s != `[0.1,-2.5,3]` {
+			t.Errorf("format %q: embedding = %s, want [0.1,-2.5,3]", format, s)
+		}
+	}
+}
+
+func TestTranscodeEmbeddings_AlreadyInFormat(t *testing.T) {
+	t.Parallel()
+
+	floats := []byte(`[{"index":0,"embedding":[0.1, 0.2]}]`)
+	got, err := transcodeEmbeddings(floats, "float")
+	if err != nil || string(got) != string(floats) {
+		t.Errorf("float data = %s (err %v), want unchanged", got, err)
+	}
+
+	b64 := []byte(`[{"index":0,"embedding":"` + encodeFloat32s(1, 2) + `"}]`)
+	got, err = transcodeEmbeddings(b64, "base64")
+	if err != nil || string(got) != string(b64) {
+		t.Errorf("base64 data = %s (err %v), want unchanged", got, err)
+	}
+}
+
+func TestTranscodeEmbeddings_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, data := range []string{
+		`[{"embedding":"not base64!"}]`,
+		`[{"embedding":"AAA="}]`, // 2 bytes, not a float32
+	} {
+		if _, err := transcodeEmbeddings([]byte(data), "float"); err == nil {
+			t.Errorf("transcode(%s) = nil error, want error", data)
+		}
+	}
+}
+
+func TestEmbeddings_EncodingFormat(t *testing.T) {
+	t.Parallel()
+
+	var sawFormat string
+	reg := provider.NewRegistry()
+	reg.Register("gemini", &testutil.FakeProvider{
+		ProviderName: "gemini",
+		EmbedFn: func(_ context.Context, req *gateway.EmbeddingRequest) (*gateway.EmbeddingResponse, error) {
+			sawFormat = req.EncodingFormat
+			// Provider ignores encoding_format and returns floats.
+			return &gateway.EmbeddingResponse{
+				Object: "list",
+				Data:   []byte(`[{"object":"embedding","index":0,"embedding":[0.5,-1]}]`),
+				Model:  req.Model,
+			}, nil
+		},
+	})
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:         "r-1",
+		ModelAlias: "text-embed",
+		Targets:    []byte(`[{"provider_id":"gemini","model":"text-embed","priority":1}]`),
+	})
+	ps := NewProxyService(reg, NewRouterService(store), nil, nil)
+
+	resp, err := ps.Embeddings(context.Background(), &gateway.EmbeddingRequest{Model: "text-embed", EncodingFormat: "base64"})
+	if err != nil {
+		t.Fatalf("Embeddings: %v", err)
+	}
+	if sawFormat != "base64" {
+		t.Errorf("provider saw encoding_format %q, want base64", sawFormat)
+	}
+	want := `[{"embedding":"` + encodeFloat32s(0.5, -1) + `","index":0,"object":"embedding"}]`
+	if string(resp.Data) != want {
+		t.Errorf("data = %s, want %s", resp.Data, want)
+	}
+
+	_, err = ps.Embeddings(context.Background(), &gateway.EmbeddingRequest{Model: "text-embed", EncodingFormat: "int8"})
+	if !errors.Is(err, gateway.ErrBadRequest) {
+		t.Errorf("unsupported format: err = %v, want ErrBadRequest", err)
+	}
+}
@@ -0,0 +1,29 @@
+package app
+
+import (
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
+)
+
+// outcomeEmpty marks a debug attempt whose completion had no content and
+// was retried.
+const outcomeEmpty = "empty"
+
+// SetEmptyRetries makes non-streaming chat completions that come back with
+// no content (and no tool calls) retriable, up to n extra attempts per
+// request. Each retry fails over to the next target; once the last target
+// is reached it is retried itself. When the budget runs out the empty
+// response is returned as-is. 0 (the default) disables retries.
+func (ps *ProxyService) SetEmptyRetries(n int) {
+	ps.emptyRetries = max(n, 0)
+}
+
+// emptyCompletion reports whether resp's first choice carries neither
+// content nor tool calls.
+func emptyCompletion(resp *gateway.ChatResponse) bool {
+	if len(resp.Choices) == 0 {
+		return true
+	}
+	msg := resp.Choices[0].Message
+	return len(msg.ToolCalls) == 0 && provider.ContentText(msg.Content) == ""
+}
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
+	"github.com/eugener/gandalf/internal/testutil"
+)
+
+// completion returns a one-choice response with the given raw content.
+func completion(id, content string) *gateway.ChatResponse {
+	return &gateway.ChatResponse{
+		ID: id,
+		Choices: []gateway.Choice{{
+			Message:      gateway.Message{Role: "assistant", Content: json.RawMessage(content)},
+			FinishReason: "stop",
+		}},
+	}
+}
+
+func TestChatCompletion_EmptyFailsOver(t *testing.T) {
+	t.Parallel()
+
+	reg := provider.NewRegistry()
+	reg.Register("primary", &testutil.FakeProvider{
+		ProviderName: "primary",
+		ChatFn: func(context.Context, *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			return completion("from-primary", `""`), nil
+		},
+	})
+	reg.Register("secondary", &testutil.FakeProvider{
+		ProviderName: "secondary",
+		ChatFn: func(context.Context, *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			return completion("from-secondary", `"Hello!"`), nil
+		},
+	})
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:         "r-1",
+		ModelAlias: "model-a",
+		Targets:    []byte(`[{"provider_id":"primary","model":"model-a","priority":1},{"provider_id":"secondary","model":"model-a","priority":2}]`),
+		Strategy:   "priority",
+	})
+
+	ps := NewProxyService(reg, NewRouterService(store), nil, nil)
+	ps.SetEmptyRetries(1)
+	resp, err := ps.ChatCompletion(context.Background(), &gateway.ChatRequest{Model: "model-a"})
+	if err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	if resp.ID != "from-secondary" {
+		t.Errorf("id = %q, want from-secondary", resp.ID)
+	}
+}
+
+func TestChatCompletion_EmptyRetriesSameTarget(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		retries   int
+		emptyFor  int32 // calls that return empty content
+		wantCalls int32
+		wantEmpty bool
+	}{
+		{"disabled", 0, 1, 1, true},
+		{"retried until content", 2, 2, 3, false},
+		{"budget exhausted", 2, 10, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var calls atomic.Int32
+			reg := provider.NewRegistry()
+			reg.Register("openai", &testutil.FakeProvider{
+				ProviderName: "openai",
+				ChatFn: func(context.Context, *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+					if calls.Add(1) <= tt.emptyFor {
+						return completion("empty", `null`), nil
+					}
+					return completion("full", `"Hello!"`), nil
+				},
+			})
+			store := testutil.NewFakeStore()
+			store.AddRoute(&gateway.Route{
+				ID:         "r-1",
+				ModelAlias: "gpt-4o",
+				Targets:    []byte(`[{"provider_id":"openai","model":"gpt-4o","priority":1}]`),
+				Strategy:   "priority",
+			})
+
+			ps := NewProxyService(reg, NewRouterService(store), nil, nil)
+			ps.SetEmptyRetries(tt.retries)
+			resp, err := ps.ChatCompletion(context.Background(), &gateway.ChatRequest{Model: "gpt-4o"})
+			if err != nil {
+				t.Fatalf("ChatCompletion: %v", err)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+			if got := emptyCompletion(resp); got != tt.wantEmpty {
+				t.Errorf("empty response = %v, want %v", got, tt.wantEmpty)
+			}
+		})
+	}
+}
+
+func TestEmptyCompletion(t *testing.T) {
+	t.Parallel()
+	toolCall := completion("t", `null`)
+	toolCall.Choices[0].Message.ToolCalls = json.RawMessage(`[{"id":"call_1","type":"function","function":{"name":"f","arguments":"{}"}}]`)
+	tests := []struct {
+		name string
+		resp *gateway.ChatResponse
+		want bool
+	}{
+		{"no choices", &gateway.ChatResponse{}, true},
+		{"missing content", completion("m", ``), true},
+		{"empty string", completion("e", `""`), true},
+		{"text", completion("x", `"hi"`), false},
+		{"content parts", completion("p", `[{"type":"text","text":"hi"}]`), false},
+		{"tool calls", toolCall, false},
+	}
+	for _, tt := range tests {
+		if got := emptyCompletion(tt.resp); got != tt.want {
+			t.Errorf("%s: emptyCompletion = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/circuitbreaker"
+)
+
+// Error event kinds.
+const (
+	ErrorKindProvider      = "provider_error"  // a provider call failed
+	ErrorKindBreakerOpen   = "breaker_open"    // a provider's circuit breaker tripped
+	ErrorKindRateLimited   = "rate_limited"    // the gateway rejected a request with 429
+	ErrorKindModelNotFound = "model_not_found" // a route target's model is unknown to its provider
+)
+
+// DefaultErrorLogSize is the number of events an ErrorLog keeps when no
+// size is given.
+const DefaultErrorLogSize = 200
+
+// ErrorEvent is one entry in the recent-errors log. Message is always
+// gateway-generated (an error category or limit name), never upstream text,
+// so events are safe to show to operators.
+type ErrorEvent struct {
+	Time      time.Time `json:"time"`
+	Kind      string    `json:"kind"`
+	Provider  string    `json:"provider,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	OrgID     string    `json:"org_id,omitempty"` // org of the request that hit the error
+	Status    int       `json:"status,omitempty"`
+	Message   string    `json:"message"`
+
+	// Suggestions lists provider models close to Model (model_not_found only).
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// ErrorLog keeps the most recent error events in a fixed-size ring buffer
+// for quick incident triage. Safe for concurrent use.
+type ErrorLog struct {
+	mu     sync.Mutex
+	events []ErrorEvent
+	next   int  // slot the next event is written to
+	full   bool // every slot has been written at least once
+}
+
+// NewErrorLog returns a log holding the last size events
+// (DefaultErrorLogSize when size <= 0).
+func NewErrorLog(size int) *ErrorLog {
+	if size <= 0 {
+		size = DefaultErrorLogSize
+	}
+	return &ErrorLog{events: make([]ErrorEvent, size)}
+}
+
+// Add records e, overwriting the oldest event once the log is full. A zero
+// Time is set to now, and an empty RequestID and OrgID are taken from ctx.
+func (l *ErrorLog) Add(ctx context.Context, e ErrorEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.RequestID == "" {
+		e.RequestID = gateway.RequestIDFromContext(ctx)
+	}
+	if e.OrgID == "" {
+		if identity := gateway.IdentityFromContext(ctx); identity != nil {
+			e.OrgID = identity.OrgID
+		}
+	}
+	l.mu.Lock()
+	l.events[l.next] = e
+	l.next = (l.next + 1) % len(l.events)
+	if l.next == 0 {
+		l.full = true
+	}
+	l.mu.Unlock()
+}
+
+// Recent returns up to n events, newest first. n <= 0 returns all of them.
+func (l *ErrorLog) Recent(n int) []ErrorEvent {
+	return l.RecentForOrg("", n)
+}
+
+// RecentForOrg is like Recent but returns only the events of requests from
+// orgID. An empty orgID returns every event.
+func (l *ErrorLog) RecentForOrg(orgID string, n int) []ErrorEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	count := l.next
+	if l.full {
+		count = len(l.events)
+	}
+	if n <= 0 || n > count {
+		n = count
+	}
+	out := make([]ErrorEvent, 0, n)
+	for i := 0; i < count && len(out) < n; i++ {
+		e := l.events[(l.next-1-i+len(l.events))%len(l.events)]
+		if orgID == "" || e.OrgID == orgID {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// SetErrorLog makes the service record failed provider calls, circuit
+// breaker trips, and model diagnostics in l. nil (the default) records nothing.
+func (ps *ProxyService) SetErrorLog(l *ErrorLog) {
+	ps.errorLog = l
+}
+
+// recordProviderError records a failed provider call for target: the
+// circuit breaker counts it, and the error log gets an event (plus one for
+// the breaker if this error tripped it). Client cancellations are ignored.
+func (ps *ProxyService) recordProviderError(ctx context.Context, target ResolvedTarget, err error) {
+	tripped := false
+	if ps.breakers != nil {
+		if weight := circuitbreaker.ClassifyError(err); weight > 0 {
+			tripped = ps.breakers.GetOrCreate(target.ProviderID).RecordError(weight)
+		}
+	}
+	ps.diagnoseModel(ctx, target, err)
+	if ps.errorLog == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	e := ErrorEvent{
+		Kind:     ErrorKindProvider,
+		Provider: target.ProviderID,
+		Model:    target.Model,
+		Message:  circuitbreaker.ErrorCategory(err),
+	}
+	var he httpStatusError
+	if errors.As(err, &he) {
+		e.Status = he.HTTPStatus()
+	}
+	ps.errorLog.Add(ctx, e)
+	if tripped {
+		ps.errorLog.Add(ctx, ErrorEvent{
+			Kind:     ErrorKindBreakerOpen,
+			Provider: target.ProviderID,
+			Model:    target.Model,
+			Message:  "circuit breaker opened",
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/circuitbreaker"
+	"github.com/eugener/gandalf/internal/provider"
+	"github.com/eugener/gandalf/internal/testutil"
+)
+
+func TestErrorLog_Ring(t *testing.T) {
+	t.Parallel()
+	l := NewErrorLog(3)
+	if got := l.Recent(10); len(got) != 0 {
+		t.Fatalf("empty log returned %d events", len(got))
+	}
+	for _, m := range []string{"a", "b", "c", "d"} {
+		l.Add(context.Background(), ErrorEvent{Kind: ErrorKindProvider, Message: m})
+	}
+
+	got := l.Recent(0)
+	if len(got) != 3 {
+		t.Fatalf("got %d events, want 3", len(got))
+	}
+	for i, want := range []string{"d", "c", "b"} {
+		if got[i].Message != want {
+			t.Errorf("event %d = %q, want %q", i, got[i].Message, want)
+		}
+		if got[i].Time.IsZero() {
+			t.Errorf("event %d has no time", i)
+		}
+	}
+	if got := l.Recent(2); len(got) != 2 || got[0].Message != "d" {
+		t.Errorf("Recent(2) = %+v", got)
+	}
+}
+
+func TestChatCompletion_ErrorLog(t *testing.T) {
+	t.Parallel()
+
+	reg := provider.NewRegistry()
+	reg.Register("flaky", &testutil.FakeProvider{
+		ProviderName: "flaky",
+		ChatFn: func(context.Context, *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			return nil, errors.New("connection refused")
+		},
+	})
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:         "r-1",
+		ModelAlias: "model-a",
+		Targets:    []byte(`[{"provider_id":"flaky","model":"model-a-v2","priority":1}]`),
+		Strategy:   "priority",
+	})
+	cbReg := circuitbreaker.NewRegistry(circuitbreaker.Config{
+		ErrorThreshold: 0.5,
+		MinSamples:     2,
+		WindowSeconds:  60,
+		OpenTimeout:    30 * time.Second,
+	})
+
+	ps := NewProxyService(reg, NewRouterService(store), nil, cbReg)
+	l := NewErrorLog(10)
+	ps.SetErrorLog(l)
+	ctx := gateway.ContextWithRequestID(context.Background(), "req-1")
+	for range 2 {
+		ps.ChatCompletion(ctx, &gateway.ChatRequest{Model: "model-a"})
+	}
+
+	got := l.Recent(0)
+	if len(got) != 3 {
+		t.Fatalf("got %d events, want 3: %+v", len(got), got)
+	}
+	if got[0].Kind != ErrorKindBreakerOpen || got[0].Provider != "flaky" {
+		t.Errorf("newest event = %+v, want breaker_open for flaky", got[0])
+	}
+	for _, e := range got[1:] {
+		if e.Kind != ErrorKindProvider || e.Model != "model-a-v2" || e.RequestID != "req-1" || e.Message != circuitbreaker.CategoryServerError {
+			t.Errorf("provider event = %+v", e)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/storage"
+)
+
+// LabelSample labels captures stored by EvalSampler.
+const LabelSample = "sample"
+
+// EvalSampler captures a sampled fraction of full request/response pairs
+// into the eval capture store, building evaluation datasets from real
+// traffic. Captures are separate from usage records and are stored in the
+// background after the response has been served.
+type EvalSampler struct {
+	store      storage.EvalCaptureStore
+	rate       float64
+	modelRates map[string]float64 // per model alias; overrides rate
+	redactor   captureRedactor
+	random     func() float64
+	wg         sync.WaitGroup
+}
+
+// NewEvalSampler samples rate (0..1) of requests, or modelRates[alias] for
+// the aliases listed there. Captured message and response text is redacted
+// with the built-in PII detectors, and with redactor when set, before it is
+// stored.
+func NewEvalSampler(store storage.EvalCaptureStore, rate float64, modelRates map[string]float64, redactor *OutputFilter) *EvalSampler {
+	return &EvalSampler{
+		store:      store,
+		rate:       rate,
+		modelRates: modelRates,
+		redactor:   newCaptureRedactor(redactor),
+		random:     rand.Float64,
+	}
+}
+
+// Observe decides whether a served non-streaming request is sampled and, if
+// so, stores it with its response. req.Model is the client's alias; the
+// provider and model that answered come from ctx (see
+// gateway.SetRequestTarget). Observe does not block on the store.
+func (e *EvalSampler) Observe(ctx context.Context, req *gateway.ChatRequest, resp *gateway.ChatResponse, latency time.Duration) {
+	rate, ok := e.modelRates[req.Model]
+	if !ok {
+		rate = e.rate
+	}
+	if e.random() >= rate {
+		return
+	}
+
+	reqJSON, err := json.Marshal(e.redactor.request(req))
+	if err != nil {
+		return
+	}
+	respJSON, _ := json.Marshal(e.redactor.response(resp))
+	providerID, model := gateway.RequestTargetFromContext(ctx)
+	id := uuid.Must(uuid.NewV7()).String()
+	c := gateway.EvalCapture{
+		ID:         id,
+		GroupID:    id,
+		RequestID:  gateway.RequestIDFromContext(ctx),
+		OrgID:      captureOrg(ctx),
+		Label:      LabelSample,
+		ProviderID: providerID,
+		Model:      model,
+		Request:    reqJSON,
+		Response:   respJSON,
+		LatencyMs:  int(latency.Milliseconds()),
+		CreatedAt:  time.Now(),
+	}
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		ctx := context.WithoutCancel(ctx)
+		if err := e.store.SaveEvalCaptures(ctx, []gateway.EvalCapture{c}); err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "eval sample: save capture failed",
+				slog.String("id", id),
+				slog.String("error", err.Error()),
+			)
+		}
+	}()
+}
+
+// captureRedactor redacts captured content before it is stored: always
+// with the built-in PII detectors, then with the output filter when one is
+// configured. Captures are never stored unredacted.
+type captureRedactor struct {
+	filters []*OutputFilter
+}
+
+// piiRedactor redacts every built-in detector.
+var piiRedactor = func() *OutputFilter {
+	f, err := NewOutputFilter(OutputFilterPolicy{Detectors: []string{"email", "phone", "ssn", "credit_card"}})
+	if err != nil {
+		panic(err)
+	}
+	return f
+}()
+
+// newCaptureRedactor adds extra, when non-nil, to the built-in detectors.
+func newCaptureRedactor(extra *OutputFilter) captureRedactor {
+	r := captureRedactor{filters: []*OutputFilter{piiRedactor}}
+	if extra != nil {
+		r.filters = append(r.filters, extra)
+	}
+	return r
+}
+
+// request returns req with its string message contents redacted. req
+// itself is never modified.
+func (c captureRedactor) request(req *gateway.ChatRequest) *gateway.ChatRequest {
+	out := *req
+	out.Messages = make([]gateway.Message, len(req.Messages))
+	for i, m := range req.Messages {
+		m.Content = c.content(m.Content)
+		out.Messages[i] = m
+	}
+	return &out
+}
+
+// response returns resp with its string choice contents redacted. resp
+// itself is never modified.
+func (c captureRedactor) response(resp *gateway.ChatResponse) *gateway.ChatResponse {
+	if resp == nil {
+		return nil
+	}
+	out := *resp
+	out.Choices = make([]gateway.Choice, len(resp.Choices))
+	for i, ch := range resp.Choices {
+		ch.Message.Content = c.content(ch.Message.Content)
+		out.Choices[i] = ch
+	}
+	return &out
+}
+
+// content redacts plain string content; null and multi-part content are
+// returned unchanged, as the output filter does.
+func (c captureRedactor) content(content json.RawMessage) json.RawMessage {
+	var text string
+	if len(content) == 0 || content[0] != '"' || json.Unmarshal(content, &text) != nil {
+		return content
+	}
+	for _, f := range c.filters {
+		text = f.Redact(text)
+	}
+	out, err := json.Marshal(text)
+	if err != nil {
+		return content
+	}
+	return out
+}
+
+// captureOrg returns the caller's org from ctx, for EvalCapture.OrgID.
+func captureOrg(ctx context.Context) string {
+	if id := gateway.IdentityFromContext(ctx); id != nil {
+		return id.OrgID
+	}
+	return ""
+}
+
+// Wait blocks until in-flight captures have been stored. Call on shutdown.
+func (e *EvalSampler) Wait() {
+	e.wg.Wait()
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/testutil"
+)
+
+func TestEvalSampler_Rate(t *testing.T) {
+	t.Parallel()
+	store := testutil.NewFakeStore()
+	e := NewEvalSampler(store, 0.2, map[string]float64{"gpt-4o": 0.5, "o3": 0}, nil)
+
+	const n = 2000
+	resp := &gateway.ChatResponse{ID: "resp"}
+	for _, model := range []string{"gpt-4o", "claude", "o3"} {
+		for range n {
+			e.Observe(context.Background(), &gateway.ChatRequest{Model: model}, resp, time.Millisecond)
+		}
+	}
+	e.Wait()
+
+	counts := map[string]int{}
+	for _, c := range store.EvalCaptures() {
+		var req gateway.ChatRequest
+		if err := json.Unmarshal(c.Request, &req); err != nil {
+			t.Fatal(err)
+		}
+		counts[req.Model]++
+		if c.Label != LabelSample || !strings.Contains(string(c.Response), `"resp"`) {
+			t.Errorf("capture = %+v", c)
+		}
+	}
+	// Binomial(2000, p): bounds are several standard deviations wide.
+	tests := []struct {
+		model    string
+		min, max int
+	}{
+		{"gpt-4o", 880, 1120}, // per-model rate 0.5
+		{"claude", 320, 480},  // default rate 0.2
+		{"o3", 0, 0},          // per-model rate 0 disables
+	}
+	for _, tt := range tests {
+		if got := counts[tt.model]; got < tt.min || got > tt.max {
+			t.Errorf("%s: captured %d of %d, want %d..%d", tt.model, got, n, tt.min, tt.max)
+		}
+	}
+}
+
+func TestEvalSampler_Redacts(t *testing.T) {
+	t.Parallel()
+	store := testutil.NewFakeStore()
+	f, err := NewOutputFilter(OutputFilterPolicy{Action: OutputBlock, Detectors: []string{"ssn"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEvalSampler(store, 1, nil, f)
+
+	ctx := gateway.ContextWithRequestID(context.Background(), "req-1")
+	gateway.SetRequestTarget(ctx, "openai", "gpt-4o")
+	req := &gateway.ChatRequest{Model: "gpt-4o", Messages: []gateway.Message{
+		{Role: "user", Content: json.RawMessage(`"my ssn is 123-45-6789"`)},
+		{Role: "user", Content: json.RawMessage(`[{"type":"text","text":"parts"}]`)},
+	}}
+	resp := textResponse("noted: 123-45-6789")
+	e.Observe(ctx, req, resp, 5*time.Millisecond)
+	e.Wait()
+
+	captures := store.EvalCaptures()
+	if len(captures) != 1 {
+		t.Fatalf("captures = %d, want 1", len(captures))
+	}
+	c := captures[0]
+	if c.RequestID != "req-1" || c.ProviderID != "openai" || c.Model != "gpt-4o" || c.LatencyMs != 5 {
+		t.Errorf("capture = %+v", c)
+	}
+	if strings.Contains(string(c.Request), "123-45-6789") || strings.Contains(string(c.Response), "123-45-6789") {
+		t.Errorf("capture not redacted: request %s, response %s", c.Request, c.Response)
+	}
+	// Redaction applies even though the filter's action is block.
+	if !strings.Contains(string(c.Response), "noted: [REDACTED]") {
+		t.Errorf("response = %s, want redacted text", c.Response)
+	}
+	if string(req.Messages[0].Content) != `"my ssn is 123-45-6789"` || choiceText(t, resp) != "noted: 123-45-6789" {
+		t.Error("caller's request or response was modified")
+	}
+}
+
+func TestEvalSampler_AlwaysRedactsPII(t *testing.T) {
+	t.Parallel()
+	store := testutil.NewFakeStore()
+	e := NewEvalSampler(store, 1, nil, nil)
+
+	ctx := gateway.ContextWithIdentity(context.Background(), &gateway.Identity{OrgID: "acme"})
+	req := &gateway.ChatRequest{Model: "gpt-4o", Messages: []gateway.Message{
+		{Role: "user", Content: json.RawMessage(`"mail jane@example.com"`)},
+	}}
+	e.Observe(ctx, req, textResponse("call 555-123-4567"), 0)
+	e.Wait()
+
+	captures := store.EvalCaptures()
+	if len(captures) != 1 {
+		t.Fatalf("captures = %d, want 1", len(captures))
+	}
+	c := captures[0]
+	if c.OrgID != "acme" {
+		t.Errorf("org_id = %q, want acme", c.OrgID)
+	}
+	if strings.Contains(string(c.Request), "jane@example.com") || strings.Contains(string(c.Response), "555-123-4567") {
+		t.Errorf("capture not redacted without an output filter: request %s, response %s", c.Request, c.Response)
+	}
+}
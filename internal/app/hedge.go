@@ -0,0 +1,228 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+// outcomeHedgeCanceled marks the call that lost a hedge race and was
+// canceled before it finished.
+const outcomeHedgeCanceled = "hedge_canceled"
+
+// hedgeBurst caps the hedge budget, so a long quiet period cannot save up
+// for a burst of hedges. The budget starts empty, so hedges never exceed
+// MaxRatio of eligible requests, startup included.
+const hedgeBurst = 10
+
+// hedgeDelayTTL is how long a computed per-provider hedge delay is reused
+// before the percentile is recomputed.
+const hedgeDelayTTL = time.Second
+
+// HedgePolicy configures request hedging. A non-streaming chat completion
+// still running after Delay is also sent to the route's next target, and
+// the first successful response is returned.
+type HedgePolicy struct {
+	// Percentile, when > 0 and latency stats are set, replaces Delay with
+	// that percentile of the primary provider's recent latency once it has
+	// MinSamples samples.
+	Percentile int
+	MinSamples int
+	Delay      time.Duration
+
+	// MaxRatio caps hedged requests as a fraction (0..1] of the requests
+	// that could be hedged, bounding the extra upstream cost.
+	MaxRatio float64
+}
+
+// hedger holds the hedge budget and cached per-provider delays.
+type hedger struct {
+	policy HedgePolicy
+
+	mu     sync.Mutex
+	budget float64 // hedges available, starting at 0; eligible requests add MaxRatio, hedges spend 1
+	delays map[string]hedgeDelay
+}
+
+type hedgeDelay struct {
+	d       time.Duration
+	expires time.Time
+}
+
+// SetHedging enables request hedging for non-streaming chat completions.
+// A zero MaxRatio disables it (the default).
+func (ps *ProxyService) SetHedging(p HedgePolicy) {
+	if p.MaxRatio <= 0 {
+		ps.hedger = nil
+		return
+	}
+	ps.hedger = &hedger{policy: p, delays: make(map[string]hedgeDelay)}
+}
+
+// earn credits the budget for one request that could be hedged.
+func (h *hedger) earn() {
+	h.mu.Lock()
+	h.budget = min(h.budget+h.policy.MaxRatio, hedgeBurst)
+	h.mu.Unlock()
+}
+
+// spend takes one hedge from the budget, reporting false when it is empty.
+func (h *hedger) spend() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.budget < 1 {
+		return false
+	}
+	h.budget--
+	return true
+}
+
+// delay returns how long to wait on providerID before hedging.
+func (h *hedger) delay(stats *LatencyStats, providerID string) time.Duration {
+	if stats == nil || h.policy.Percentile <= 0 {
+		return h.policy.Delay
+	}
+	now := time.Now()
+	h.mu.Lock()
+	cached, ok := h.delays[providerID]
+	h.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.d
+	}
+	d := h.policy.Delay
+	if p, n := stats.Percentile(providerID, h.policy.Percentile); n > 0 && n >= h.policy.MinSamples {
+		d = p
+	}
+	h.mu.Lock()
+	h.delays[providerID] = hedgeDelay{d: d, expires: now.Add(hedgeDelayTTL)}
+	h.mu.Unlock()
+	return d
+}
+
+// hedgeOutcome reports a hedge that was sent. When answered is set, the
+// response or error chatWithHedge returned came from target, taking elapsed.
+type hedgeOutcome struct {
+	target   ResolvedTarget
+	elapsed  time.Duration
+	answered bool
+}
+
+type chatResult struct {
+	resp    *gateway.ChatResponse
+	err     error
+	elapsed time.Duration
+	hedge   bool
+}
+
+// chatWithHedge calls p for target and, when hedging is enabled and the call
+// outlasts the hedge delay, races it against rest[0]. The first successful
+// response wins and the other call is canceled; if both fail, the later
+// error is returned. The attempt that is not returned is recorded here (in
+// the debug trace and, if it failed, the breaker and error log); the caller
+// records the returned one. The hedge outcome is nil when no hedge was sent.
+func (ps *ProxyService) chatWithHedge(ctx context.Context, req *gateway.ChatRequest, p gateway.Provider, target ResolvedTarget, rest []ResolvedTarget) (*gateway.ChatResponse, *hedgeOutcome, error) {
+	if ps.hedger == nil || len(rest) == 0 {
+		resp, err := p.ChatCompletion(ctx, req)
+		return resp, nil, err
+	}
+	next := rest[0]
+	ps.hedger.earn()
+	delay := ps.hedger.delay(ps.latencyStats, target.ProviderID)
+
+	raceCtx, cancel := context.WithCancel(ctx)
+	defer cancel() // stops the losing call
+	results := make(chan chatResult, 2)
+	call := func(ctx context.Context, p gateway.Provider, req gateway.ChatRequest, hedge bool) {
+		start := time.Now()
+		resp, err := p.ChatCompletion(ctx, &req)
+		results <- chatResult{resp: resp, err: err, elapsed: time.Since(start), hedge: hedge}
+	}
+	// Each call gets its own copy: the caller restores req.Model as soon as
+	// this returns, while the loser may still be running.
+	primaryStart := time.Now()
+	go call(raceCtx, p, *req, false)
+
+	timer := time.NewTimer(delay)
+	select {
+	case r := <-results:
+		timer.Stop()
+		return r.resp, nil, r.err
+	case <-timer.C:
+	}
+	hp := ps.hedgeProvider(req, next)
+	if hp == nil || !ps.hedger.spend() {
+		r := <-results
+		return r.resp, nil, r.err
+	}
+
+	slog.LogAttrs(ctx, slog.LevelDebug, "hedging request",
+		slog.String("provider", target.ProviderID),
+		slog.String("hedge_provider", next.ProviderID),
+		slog.Duration("delay", delay),
+	)
+	hedgeCtx := raceCtx
+	if ps.tracer != nil {
+		var span trace.Span
+		hedgeCtx, span = ps.tracer.Start(raceCtx, "provider.ChatCompletion",
+			trace.WithAttributes(
+				attribute.String("provider", next.ProviderID),
+				attribute.String("model", next.Model),
+				attribute.Bool("hedge", true),
+			),
+		)
+		defer span.End()
+	}
+	hedgeReq := *stripUnsupportedParams(ctx, req, ps.providers, next.ProviderID, hp)
+	hedgeReq.Model = next.Model
+	hedgeStart := time.Now()
+	go call(hedgeCtx, hp, hedgeReq, true)
+
+	r := <-results
+	if r.err != nil {
+		ps.recordHedgeAttempt(ctx, target, next, r)
+		r = <-results
+	} else {
+		// The other call is still running; it is canceled on return.
+		lost, lostStart := target, primaryStart
+		if !r.hedge {
+			lost, lostStart = next, hedgeStart
+		}
+		debugAttempt(ctx, lost, outcomeHedgeCanceled, time.Since(lostStart), nil)
+	}
+	out := &hedgeOutcome{target: next}
+	if r.hedge {
+		out.answered, out.elapsed = true, r.elapsed
+	}
+	return r.resp, out, r.err
+}
+
+// hedgeProvider returns the provider to hedge to, or nil when next can't
+// take the request right now.
+func (ps *ProxyService) hedgeProvider(req *gateway.ChatRequest, next ResolvedTarget) gateway.Provider {
+	if ps.breakers != nil {
+		if cb := ps.breakers.Get(next.ProviderID); cb != nil && !cb.Allow() {
+			return nil
+		}
+	}
+	hp, err := ps.providers.Get(next.ProviderID)
+	if err != nil || ps.checkRequiredFields(req, next.ProviderID, hp) != nil {
+		return nil
+	}
+	return hp
+}
+
+// recordHedgeAttempt records a hedge race call that failed first.
+func (ps *ProxyService) recordHedgeAttempt(ctx context.Context, primary, next ResolvedTarget, r chatResult) {
+	t := primary
+	if r.hedge {
+		t = next
+	}
+	debugAttempt(ctx, t, "", r.elapsed, r.err)
+	ps.recordProviderError(ctx, t, r.err)
+}
@@ -0,0 +1,182 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
+	"github.com/eugener/gandalf/internal/testutil"
+)
+
+// hedgeRoute routes "model-a" to the given providers in priority order.
+func hedgeRoute(providers ...string) *testutil.FakeStore {
+	targets := make([]gateway.RouteTarget, len(providers))
+	for i, p := range providers {
+		targets[i] = gateway.RouteTarget{ProviderID: p, Model: "model-a", Priority: i + 1}
+	}
+	data, _ := json.Marshal(targets)
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{ID: "r-1", ModelAlias: "model-a", Targets: data, Strategy: "priority"})
+	return store
+}
+
+func respondWith(id string) func(context.Context, *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+	return func(_ context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+		return &gateway.ChatResponse{ID: id, Model: req.Model}, nil
+	}
+}
+
+func TestChatCompletion_HedgesSlowPrimary(t *testing.T) {
+	t.Parallel()
+	canceled := make(chan struct{})
+	reg := provider.NewRegistry()
+	reg.Register("primary", &testutil.FakeProvider{
+		ProviderName: "primary",
+		ChatFn: func(ctx context.Context, _ *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			<-ctx.Done()
+			close(canceled)
+			return nil, ctx.Err()
+		},
+	})
+	reg.Register("secondary", &testutil.FakeProvider{ProviderName: "secondary", ChatFn: respondWith("from-secondary")})
+
+	ps := NewProxyService(reg, NewRouterService(hedgeRoute("primary", "secondary")), nil, nil)
+	stats := NewLatencyStats(0)
+	ps.SetLatencyStats(stats)
+	ps.SetHedging(HedgePolicy{Delay: 10 * time.Millisecond, MaxRatio: 1})
+
+	resp, err := ps.ChatCompletion(context.Background(), &gateway.ChatRequest{Model: "model-a"})
+	if err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	if resp.ID != "from-secondary" {
+		t.Errorf("id = %q, want from-secondary", resp.ID)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("slow primary was not canceled")
+	}
+	if got := stats.Snapshot(); len(got) != 1 || got[0].Provider != "secondary" {
+		t.Errorf("latency stats = %+v, want only the winning secondary", got)
+	}
+}
+
+func TestChatCompletion_NoHedgeForFastPrimary(t *testing.T) {
+	t.Parallel()
+	var hedged atomic.Int32
+	reg := provider.NewRegistry()
+	reg.Register("primary", &testutil.FakeProvider{ProviderName: "primary", ChatFn: respondWith("from-primary")})
+	reg.Register("secondary", &testutil.FakeProvider{
+		ProviderName: "secondary",
+		ChatFn: func(context.Context, *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			hedged.Add(1)
+			return &gateway.ChatResponse{ID: "from-secondary"}, nil
+		},
+	})
+
+	ps := NewProxyService(reg, NewRouterService(hedgeRoute("primary", "secondary")), nil, nil)
+	ps.SetHedging(HedgePolicy{Delay: time.Second, MaxRatio: 1})
+
+	resp, err := ps.ChatCompletion(context.Background(), &gateway.ChatRequest{Model: "model-a"})
+	if err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	if resp.ID != "from-primary" || hedged.Load() != 0 {
+		t.Errorf("id = %q, hedges = %d; want from-primary and no hedge", resp.ID, hedged.Load())
+	}
+}
+
+func TestChatCompletion_HedgeBudget(t *testing.T) {
+	t.Parallel()
+	var hedged atomic.Int32
+	reg := provider.NewRegistry()
+	reg.Register("primary", &testutil.FakeProvider{
+		ProviderName: "primary",
+		ChatFn: func(context.Context, *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			time.Sleep(20 * time.Millisecond)
+			return &gateway.ChatResponse{ID: "from-primary"}, nil
+		},
+	})
+	reg.Register("secondary", &testutil.FakeProvider{
+		ProviderName: "secondary",
+		ChatFn: func(context.Context, *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			hedged.Add(1)
+			return &gateway.ChatResponse{ID: "from-secondary"}, nil
+		},
+	})
+
+	ps := NewProxyService(reg, NewRouterService(hedgeRoute("primary", "secondary")), nil, nil)
+	ps.SetHedging(HedgePolicy{Delay: time.Millisecond, MaxRatio: 0.25})
+
+	// The budget starts empty, so even the first requests are held to the
+	// ratio: every fourth slow request is hedged, the rest wait for the
+	// primary.
+	for range 12 {
+		if _, err := ps.ChatCompletion(context.Background(), &gateway.ChatRequest{Model: "model-a"}); err != nil {
+			t.Fatalf("ChatCompletion: %v", err)
+		}
+	}
+	if got := hedged.Load(); got != 3 {
+		t.Errorf("hedges = %d, want 3 (25%% of 12)", got)
+	}
+}
+
+func TestChatCompletion_HedgeBothFailFailsOver(t *testing.T) {
+	t.Parallel()
+	var secondaryCalls atomic.Int32
+	reg := provider.NewRegistry()
+	reg.Register("primary", &testutil.FakeProvider{
+		ProviderName: "primary",
+		ChatFn: func(context.Context, *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			time.Sleep(20 * time.Millisecond)
+			return nil, errors.New("primary down")
+		},
+	})
+	reg.Register("secondary", &testutil.FakeProvider{
+		ProviderName: "secondary",
+		ChatFn: func(context.Context, *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			secondaryCalls.Add(1)
+			return nil, errors.New("secondary down")
+		},
+	})
+	reg.Register("tertiary", &testutil.FakeProvider{ProviderName: "tertiary", ChatFn: respondWith("from-tertiary")})
+
+	ps := NewProxyService(reg, NewRouterService(hedgeRoute("primary", "secondary", "tertiary")), nil, nil)
+	ps.SetHedging(HedgePolicy{Delay: time.Millisecond, MaxRatio: 1})
+
+	resp, err := ps.ChatCompletion(context.Background(), &gateway.ChatRequest{Model: "model-a"})
+	if err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	// The hedge was the secondary's turn: failover goes straight on.
+	if resp.ID != "from-tertiary" || secondaryCalls.Load() != 1 {
+		t.Errorf("id = %q, secondary calls = %d; want from-tertiary after 1 call", resp.ID, secondaryCalls.Load())
+	}
+}
+
+func TestHedger_PercentileDelay(t *testing.T) {
+	t.Parallel()
+	stats := NewLatencyStats(0)
+	for i := 1; i <= 100; i++ {
+		stats.Observe("openai", time.Duration(i)*time.Millisecond)
+	}
+
+	h := &hedger{policy: HedgePolicy{Percentile: 95, MinSamples: 20, Delay: time.Second}, delays: make(map[string]hedgeDelay)}
+	if got := h.delay(stats, "openai"); got != 95*time.Millisecond {
+		t.Errorf("delay = %v, want p95 95ms", got)
+	}
+	if got := h.delay(stats, "anthropic"); got != time.Second {
+		t.Errorf("delay without samples = %v, want the 1s fallback", got)
+	}
+
+	h = &hedger{policy: HedgePolicy{Percentile: 95, MinSamples: 200, Delay: time.Second}, delays: make(map[string]hedgeDelay)}
+	if got := h.delay(stats, "openai"); got != time.Second {
+		t.Errorf("delay under min_samples = %v, want the 1s fallback", got)
+	}
+}
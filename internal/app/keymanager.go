@@ -24,16 +24,23 @@ func NewKeyManager(store storage.APIKeyStore) *KeyManager {
 
 // CreateKeyOpts holds all fields for API key creation.
 type CreateKeyOpts struct {
-	OrgID         string
-	UserID        string
-	TeamID        string
-	Name          string
-	Role          string
-	AllowedModels []string
-	RPMLimit      *int64
-	TPMLimit      *int64
-	MaxBudget     *float64
-	ExpiresAt     *time.Time
+	OrgID              string
+	UserID             string
+	TeamID             string
+	Name               string
+	Role               string
+	AllowedModels      []string
+	RPMLimit           *int64
+	TPMLimit           *int64
+	MaxBudget          *float64
+	MaxStreams         *int64
+	DefaultModel       string
+	MaxRequests        *int64
+	RequestPeriod      string
+	Pool               string
+	ExpiresAt          *time.Time
+	PreferredProviders []string
+	MaxPriority        string
 }
 
 // CreateKey generates a new API key with the given options, stores its hash,
@@ -57,19 +64,26 @@ func (km *KeyManager) CreateKey(ctx context.Context, opts CreateKeyOpts) (string
 	}
 
 	key := &gateway.APIKey{
-		ID:            uuid.Must(uuid.NewV7()).String(),
-		KeyHash:       hash,
-		KeyPrefix:     prefix,
-		OrgID:         opts.OrgID,
-		UserID:        opts.UserID,
-		TeamID:        opts.TeamID,
-		Role:          role,
-		AllowedModels: opts.AllowedModels,
-		RPMLimit:      opts.RPMLimit,
-		TPMLimit:      opts.TPMLimit,
-		MaxBudget:     opts.MaxBudget,
-		ExpiresAt:     opts.ExpiresAt,
-		CreatedAt:     time.Now().UTC(),
+		ID:                 uuid.Must(uuid.NewV7()).String(),
+		KeyHash:            hash,
+		KeyPrefix:          prefix,
+		OrgID:              opts.OrgID,
+		UserID:             opts.UserID,
+		TeamID:             opts.TeamID,
+		Role:               role,
+		AllowedModels:      opts.AllowedModels,
+		RPMLimit:           opts.RPMLimit,
+		TPMLimit:           opts.TPMLimit,
+		MaxBudget:          opts.MaxBudget,
+		MaxStreams:         opts.MaxStreams,
+		DefaultModel:       opts.DefaultModel,
+		MaxRequests:        opts.MaxRequests,
+		RequestPeriod:      opts.RequestPeriod,
+		Pool:               opts.Pool,
+		ExpiresAt:          opts.ExpiresAt,
+		PreferredProviders: opts.PreferredProviders,
+		MaxPriority:        opts.MaxPriority,
+		CreatedAt:          time.Now().UTC(),
 	}
 
 	if err := km.store.CreateKey(ctx, key); err != nil {
@@ -35,6 +35,12 @@ func (s *fakeKeyStore) ListKeys(context.Context, string, int, int) ([]*gateway.A
 	return nil, nil
 }
 func (s *fakeKeyStore) CountKeys(context.Context, string) (int, error) { return 0, nil }
+func (s *fakeKeyStore) CountKeysPrimary(context.Context, string) (int, error) {
+	return 0, nil
+}
+func (s *fakeKeyStore) ListPoolKeys(context.Context, string, string) ([]*gateway.APIKey, error) {
+	return nil, nil
+}
 func (s *fakeKeyStore) UpdateKey(context.Context, *gateway.APIKey) error {
 	return nil
 }
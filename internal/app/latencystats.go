@@ -0,0 +1,141 @@
+package app
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyWindow is the number of recent samples per provider a
+// LatencyStats keeps when no size is given.
+const DefaultLatencyWindow = 1024
+
+// LatencyPercentiles summarizes one provider's recent upstream latency.
+// Percentiles cover the rolling window; Count and Sum cover every sample
+// since startup, as Prometheus summaries expect.
+type LatencyPercentiles struct {
+	Provider string
+	Samples  int // samples in the window
+	P50      time.Duration
+	P95      time.Duration
+	P99      time.Duration
+	Count    uint64
+	Sum      time.Duration
+}
+
+// LatencyStats keeps the most recent latency samples per provider in
+// fixed-size ring buffers. Observe is O(1); percentiles are computed from
+// a sorted copy when Snapshot is called, so the cost lands on readers
+// (admin requests and scrapes), not the request path. Safe for concurrent
+// use.
+type LatencyStats struct {
+	mu        sync.Mutex
+	window    int
+	providers map[string]*latencyWindow
+}
+
+type latencyWindow struct {
+	samples []time.Duration
+	next    int  // slot the next sample is written to
+	full    bool // every slot has been written at least once
+	count   uint64
+	sum     time.Duration
+}
+
+// NewLatencyStats returns stats keeping the last window samples per
+// provider (DefaultLatencyWindow when window <= 0).
+func NewLatencyStats(window int) *LatencyStats {
+	if window <= 0 {
+		window = DefaultLatencyWindow
+	}
+	return &LatencyStats{window: window, providers: make(map[string]*latencyWindow)}
+}
+
+// Observe records one upstream call latency for providerID.
+func (l *LatencyStats) Observe(providerID string, d time.Duration) {
+	l.mu.Lock()
+	w, ok := l.providers[providerID]
+	if !ok {
+		w = &latencyWindow{samples: make([]time.Duration, l.window)}
+		l.providers[providerID] = w
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % len(w.samples)
+	if w.next == 0 {
+		w.full = true
+	}
+	w.count++
+	w.sum += d
+	l.mu.Unlock()
+}
+
+// Snapshot returns the percentiles of every provider with at least one
+// sample, sorted by provider ID.
+func (l *LatencyStats) Snapshot() []LatencyPercentiles {
+	l.mu.Lock()
+	out := make([]LatencyPercentiles, 0, len(l.providers))
+	samples := make([][]time.Duration, 0, len(l.providers))
+	for id, w := range l.providers {
+		n := w.next
+		if w.full {
+			n = len(w.samples)
+		}
+		out = append(out, LatencyPercentiles{Provider: id, Samples: n, Count: w.count, Sum: w.sum})
+		samples = append(samples, slices.Clone(w.samples[:n]))
+	}
+	l.mu.Unlock()
+
+	for i, s := range samples {
+		slices.Sort(s)
+		out[i].P50 = percentile(s, 50)
+		out[i].P95 = percentile(s, 95)
+		out[i].P99 = percentile(s, 99)
+	}
+	slices.SortFunc(out, func(a, b LatencyPercentiles) int {
+		return cmp.Compare(a.Provider, b.Provider)
+	})
+	return out
+}
+
+// Percentile returns the nearest-rank pth percentile of providerID's window
+// and the number of samples it was computed from (0 when there are none).
+func (l *LatencyStats) Percentile(providerID string, p int) (time.Duration, int) {
+	l.mu.Lock()
+	w, ok := l.providers[providerID]
+	if !ok {
+		l.mu.Unlock()
+		return 0, 0
+	}
+	n := w.next
+	if w.full {
+		n = len(w.samples)
+	}
+	s := slices.Clone(w.samples[:n])
+	l.mu.Unlock()
+
+	slices.Sort(s)
+	return percentile(s, p), n
+}
+
+// percentile returns the nearest-rank pth percentile of sorted samples.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100 // ceil(p/100 * n)
+	return sorted[max(rank, 1)-1]
+}
+
+// SetLatencyStats makes the service record the latency of successful
+// non-streaming provider calls (chat and embeddings) in l. nil (the
+// default) records nothing.
+func (ps *ProxyService) SetLatencyStats(l *LatencyStats) {
+	ps.latencyStats = l
+}
+
+func (ps *ProxyService) observeProviderLatency(providerID string, d time.Duration) {
+	if ps.latencyStats != nil {
+		ps.latencyStats.Observe(providerID, d)
+	}
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"context"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
+	"github.com/eugener/gandalf/internal/testutil"
+)
+
+func TestLatencyStats_Percentiles(t *testing.T) {
+	t.Parallel()
+	l := NewLatencyStats(1000)
+	// 1ms..1000ms in random order: pN is N% of the way up the range.
+	for _, i := range rand.Perm(1000) {
+		l.Observe("openai", time.Duration(i+1)*time.Millisecond)
+	}
+
+	got := l.Snapshot()
+	if len(got) != 1 || got[0].Provider != "openai" {
+		t.Fatalf("Snapshot = %+v, want one openai entry", got)
+	}
+	p := got[0]
+	for _, c := range []struct {
+		name      string
+		got, want time.Duration
+	}{
+		{"p50", p.P50, 500 * time.Millisecond},
+		{"p95", p.P95, 950 * time.Millisecond},
+		{"p99", p.P99, 990 * time.Millisecond},
+	} {
+		if diff := c.got - c.want; diff < -5*time.Millisecond || diff > 5*time.Millisecond {
+			t.Errorf("%s = %v, want %v +/- 5ms", c.name, c.got, c.want)
+		}
+	}
+	if p.Samples != 1000 || p.Count != 1000 || p.Sum != 500500*time.Millisecond {
+		t.Errorf("samples, count, sum = %d, %d, %v", p.Samples, p.Count, p.Sum)
+	}
+}
+
+func TestLatencyStats_Window(t *testing.T) {
+	t.Parallel()
+	l := NewLatencyStats(10)
+	for range 10 {
+		l.Observe("openai", time.Second)
+	}
+	// Newer samples push the old ones out of the window but still count.
+	for range 10 {
+		l.Observe("openai", 10*time.Millisecond)
+	}
+
+	p := l.Snapshot()[0]
+	if p.P99 != 10*time.Millisecond || p.Samples != 10 {
+		t.Errorf("p99, samples = %v, %d; want 10ms, 10", p.P99, p.Samples)
+	}
+	if p.Count != 20 {
+		t.Errorf("count = %d, want 20", p.Count)
+	}
+}
+
+func TestProxyService_RecordsLatencyStats(t *testing.T) {
+	t.Parallel()
+	reg := provider.NewRegistry()
+	reg.Register("openai", &testutil.FakeProvider{
+		ProviderName: "openai",
+		EmbedFn: func(context.Context, *gateway.EmbeddingRequest) (*gateway.EmbeddingResponse, error) {
+			return &gateway.EmbeddingResponse{}, nil
+		},
+	})
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:         "r-1",
+		ModelAlias: "gpt-4o",
+		Targets:    []byte(`[{"provider_id":"openai","model":"gpt-4o","priority":1}]`),
+		Strategy:   "priority",
+	})
+	ps := NewProxyService(reg, NewRouterService(store), nil, nil)
+	stats := NewLatencyStats(0)
+	ps.SetLatencyStats(stats)
+
+	if _, err := ps.ChatCompletion(context.Background(), &gateway.ChatRequest{Model: "gpt-4o"}); err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	if _, err := ps.Embeddings(context.Background(), &gateway.EmbeddingRequest{Model: "gpt-4o", Input: []byte(`"hi"`)}); err != nil {
+		t.Fatalf("Embeddings: %v", err)
+	}
+	got := stats.Snapshot()
+	if len(got) != 1 || got[0].Provider != "openai" || got[0].Count != 2 {
+		t.Errorf("Snapshot = %+v, want 2 openai samples", got)
+	}
+}
@@ -0,0 +1,209 @@
+package app
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eugener/gandalf/internal/provider"
+)
+
+// maxModelSuggestions caps the close matches reported for a missing model.
+const maxModelSuggestions = 3
+
+// modelListTimeout bounds the ListModels call made to diagnose a target.
+const modelListTimeout = 5 * time.Second
+
+// modelDiagnoser counts model-not-found errors per route target and, every
+// threshold errors, compares the target's model with the provider's model
+// list so a misconfigured route can be fixed. Diagnostics run in the
+// background, at most one per target at a time. Safe for concurrent use.
+type modelDiagnoser struct {
+	threshold int
+
+	mu      sync.Mutex
+	misses  map[ResolvedTarget]int
+	running map[ResolvedTarget]bool
+	wg      sync.WaitGroup
+}
+
+// SetModelDiagnostics makes the service diagnose route targets whose
+// provider keeps answering model-not-found: after threshold such errors
+// for the same provider and model it fetches the provider's model list,
+// logs a warning naming the closest matches, and adds a model_not_found
+// event with them to the error log. The list is fetched in the background,
+// from the registry's models cache when warm, so the failing request and
+// its failover never wait on it. 0 (the default) disables diagnostics.
+func (ps *ProxyService) SetModelDiagnostics(threshold int) {
+	if threshold <= 0 {
+		ps.modelDiag = nil
+		return
+	}
+	ps.modelDiag = &modelDiagnoser{
+		threshold: threshold,
+		misses:    make(map[ResolvedTarget]int),
+		running:   make(map[ResolvedTarget]bool),
+	}
+}
+
+// miss counts a model-not-found error for target and reports whether it is
+// time to diagnose it. Errors arriving while target is being diagnosed are
+// not counted. On true, the caller must call done with the returned key.
+func (d *modelDiagnoser) miss(target ResolvedTarget) (ResolvedTarget, bool) {
+	key := ResolvedTarget{ProviderID: target.ProviderID, Model: target.Model}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.running[key] {
+		return key, false
+	}
+	d.misses[key]++
+	if d.misses[key] < d.threshold {
+		return key, false
+	}
+	delete(d.misses, key)
+	d.running[key] = true
+	d.wg.Add(1)
+	return key, true
+}
+
+// done marks the diagnosis of key finished.
+func (d *modelDiagnoser) done(key ResolvedTarget) {
+	d.mu.Lock()
+	delete(d.running, key)
+	d.mu.Unlock()
+	d.wg.Done()
+}
+
+// diagnoseModel starts model diagnostics for a failed call to target in the
+// background when err is a model-not-found error. It never blocks.
+func (ps *ProxyService) diagnoseModel(ctx context.Context, target ResolvedTarget, err error) {
+	if ps.modelDiag == nil || !isModelNotFound(err) {
+		return
+	}
+	key, ok := ps.modelDiag.miss(target)
+	if !ok {
+		return
+	}
+	go func() {
+		defer ps.modelDiag.done(key)
+		ps.runModelDiagnosis(context.WithoutCancel(ctx), key)
+	}()
+}
+
+// runModelDiagnosis compares target's model with the provider's model list
+// and reports the closest matches.
+func (ps *ProxyService) runModelDiagnosis(ctx context.Context, target ResolvedTarget) {
+	listCtx, cancel := context.WithTimeout(ctx, modelListTimeout)
+	defer cancel()
+	models, listErr := ps.providers.ListModels(listCtx, target.ProviderID)
+	if listErr != nil {
+		slog.LogAttrs(ctx, slog.LevelWarn, "model not found at provider",
+			slog.String("provider", target.ProviderID),
+			slog.String("model", target.Model),
+			slog.Int("errors", ps.modelDiag.threshold),
+			slog.String("list_error", listErr.Error()),
+		)
+		return
+	}
+	suggestions := suggestModels(target.Model, models)
+	slog.LogAttrs(ctx, slog.LevelWarn, "model not found at provider",
+		slog.String("provider", target.ProviderID),
+		slog.String("model", target.Model),
+		slog.Int("errors", ps.modelDiag.threshold),
+		slog.Int("available", len(models)),
+		slog.Any("suggestions", suggestions),
+	)
+	if ps.errorLog != nil {
+		msg := "model not found; no similar models at provider"
+		if len(suggestions) > 0 {
+			msg = "model not found; see suggestions"
+		}
+		ps.errorLog.Add(ctx, ErrorEvent{
+			Kind:        ErrorKindModelNotFound,
+			Provider:    target.ProviderID,
+			Model:       target.Model,
+			Status:      http.StatusNotFound,
+			Message:     msg,
+			Suggestions: suggestions,
+		})
+	}
+}
+
+// isModelNotFound reports whether err is a provider saying it does not
+// know the requested model: a 404 or 400 whose body says so (some
+// OpenAI-compatible servers answer unknown models with 400). A 404 whose
+// body doesn't mention a missing model, such as a wrong base URL path, is
+// not one.
+func isModelNotFound(err error) bool {
+	var apiErr *provider.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.StatusCode != http.StatusNotFound && apiErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	body := strings.ToLower(apiErr.Body)
+	if strings.Contains(body, "model_not_found") || strings.Contains(body, "deploymentnotfound") {
+		return true
+	}
+	return (strings.Contains(body, "model") || strings.Contains(body, "deployment")) &&
+		(strings.Contains(body, "not found") || strings.Contains(body, "does not exist"))
+}
+
+// suggestModels returns up to maxModelSuggestions models from available
+// that look like model: same name ignoring case, one name containing the
+// other, or a small edit distance. Closest first.
+func suggestModels(model string, available []string) []string {
+	want := strings.ToLower(model)
+	type match struct {
+		name string
+		dist int
+	}
+	var matches []match
+	for _, name := range available {
+		got := strings.ToLower(name)
+		if name == model {
+			continue
+		}
+		dist := editDistance(want, got)
+		if dist > max(2, len(want)/3) && !strings.Contains(got, want) && !strings.Contains(want, got) {
+			continue
+		}
+		matches = append(matches, match{name, dist})
+	}
+	slices.SortFunc(matches, func(a, b match) int {
+		return cmp.Or(cmp.Compare(a.dist, b.dist), cmp.Compare(a.name, b.name))
+	})
+	out := make([]string, 0, min(len(matches), maxModelSuggestions))
+	for _, m := range matches[:min(len(matches), maxModelSuggestions)] {
+		out = append(out, m.name)
+	}
+	return out
+}
+
+// editDistance returns the Levenshtein distance between a and b in bytes.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
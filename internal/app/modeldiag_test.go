@@ -0,0 +1,158 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
+	"github.com/eugener/gandalf/internal/testutil"
+)
+
+func TestModelDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	reg := provider.NewRegistry()
+	reg.Register("openai", &testutil.FakeProvider{
+		ProviderName: "openai",
+		ChatFn: func(_ context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			return nil, &provider.APIError{Provider: "openai", StatusCode: 404,
+				Body: fmt.Sprintf(`{"error":{"code":"model_not_found","message":"The model %s does not exist"}}`, req.Model)}
+		},
+		ModelsFn: func(context.Context) ([]string, error) {
+			return []string{"gpt-4o", "gpt-4o-mini", "o3", "text-embedding-3-small"}, nil
+		},
+	})
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:         "r-1",
+		ModelAlias: "chat",
+		Targets:    []byte(`[{"provider_id":"openai","model":"gpt4o","priority":1}]`),
+		Strategy:   "priority",
+	})
+
+	ps := NewProxyService(reg, NewRouterService(store), nil, nil)
+	l := NewErrorLog(10)
+	ps.SetErrorLog(l)
+	ps.SetModelDiagnostics(2)
+
+	diagnosed := func() []ErrorEvent {
+		var out []ErrorEvent
+		for _, e := range l.Recent(0) {
+			if e.Kind == ErrorKindModelNotFound {
+				out = append(out, e)
+			}
+		}
+		return out
+	}
+
+	ps.ChatCompletion(context.Background(), &gateway.ChatRequest{Model: "chat"})
+	ps.modelDiag.wg.Wait()
+	if got := diagnosed(); len(got) != 0 {
+		t.Fatalf("diagnosed after 1 error, want after 2: %+v", got)
+	}
+	ps.ChatCompletion(context.Background(), &gateway.ChatRequest{Model: "chat"})
+	ps.modelDiag.wg.Wait()
+	got := diagnosed()
+	if len(got) != 1 {
+		t.Fatalf("got %d model_not_found events, want 1", len(got))
+	}
+	e := got[0]
+	if e.Provider != "openai" || e.Model != "gpt4o" {
+		t.Errorf("event = %+v, want openai/gpt4o", e)
+	}
+	if len(e.Suggestions) == 0 || e.Suggestions[0] != "gpt-4o" {
+		t.Errorf("suggestions = %v, want gpt-4o first", e.Suggestions)
+	}
+	if slices.Contains(e.Suggestions, "text-embedding-3-small") {
+		t.Errorf("suggestions = %v, want no unrelated models", e.Suggestions)
+	}
+}
+
+// TestModelDiagnostics_Background checks that a slow model list never holds
+// up the failing request and that a target has one diagnosis at a time.
+func TestModelDiagnostics_Background(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	var lists atomic.Int32
+	reg := provider.NewRegistry()
+	reg.Register("openai", &testutil.FakeProvider{
+		ProviderName: "openai",
+		ChatFn: func(context.Context, *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			return nil, &provider.APIError{Provider: "openai", StatusCode: 404, Body: `{"error":{"code":"model_not_found"}}`}
+		},
+		ModelsFn: func(context.Context) ([]string, error) {
+			lists.Add(1)
+			<-release
+			return []string{"gpt-4o"}, nil
+		},
+	})
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:         "r-1",
+		ModelAlias: "chat",
+		Targets:    []byte(`[{"provider_id":"openai","model":"gpt4o","priority":1}]`),
+		Strategy:   "priority",
+	})
+	ps := NewProxyService(reg, NewRouterService(store), nil, nil)
+	ps.SetModelDiagnostics(1)
+
+	for range 3 {
+		if _, err := ps.ChatCompletion(context.Background(), &gateway.ChatRequest{Model: "chat"}); err == nil {
+			t.Fatal("ChatCompletion succeeded, want the provider's 404")
+		}
+	}
+	close(release)
+	ps.modelDiag.wg.Wait()
+	if n := lists.Load(); n != 1 {
+		t.Errorf("model list fetched %d times, want 1 (one diagnosis in flight)", n)
+	}
+}
+
+func TestIsModelNotFound(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"404 unknown model", &provider.APIError{StatusCode: 404, Body: `{"error":{"code":"model_not_found"}}`}, true},
+		{"404 azure deployment", &provider.APIError{StatusCode: 404, Body: `{"error":{"code":"DeploymentNotFound"}}`}, true},
+		{"404 wrong path", &provider.APIError{StatusCode: 404, Body: "404 page not found"}, false},
+		{"404 empty", &provider.APIError{StatusCode: 404}, false},
+		{"400 unknown model", &provider.APIError{StatusCode: 400, Body: `{"error":"model 'llama9' not found"}`}, true},
+		{"400 other", &provider.APIError{StatusCode: 400, Body: `{"error":"messages is required"}`}, false},
+		{"500", &provider.APIError{StatusCode: 500, Body: "model not found"}, false},
+		{"not an API error", errors.New("connection refused"), false},
+	}
+	for _, tt := range tests {
+		if got := isModelNotFound(tt.err); got != tt.want {
+			t.Errorf("%s: isModelNotFound = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSuggestModels(t *testing.T) {
+	t.Parallel()
+	available := []string{"claude-sonnet-4-5", "claude-opus-4-1", "claude-3-5-haiku-latest", "gpt-4o"}
+	tests := []struct {
+		model string
+		want  []string
+	}{
+		{"claude-sonnet-4.5", []string{"claude-sonnet-4-5"}},
+		{"Claude-Opus-4-1", []string{"claude-opus-4-1"}},
+		{"claude-3-5-haiku", []string{"claude-3-5-haiku-latest"}},
+		{"mistral-large", nil},
+	}
+	for _, tt := range tests {
+		got := suggestModels(tt.model, available)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("suggestModels(%q) = %v, want %v", tt.model, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package app
+
+import (
+	"regexp"
+	"strings"
+)
+
+// versionSuffix matches the dated or pinned version tails providers append
+// to model names: -2024-08-06, -20241022, -0613, @20240229, -latest.
+var versionSuffix = regexp.MustCompile(`(-\d{4}-\d{2}-\d{2}|-\d{8}|-\d{4}|@\d{8}|-latest)$`)
+
+// modelCandidates returns the alias names to try for model, most specific
+// first: the exact name, then lowercased and trimmed, then without a version
+// suffix ("GPT-4o-2024-08-06" ends at "gpt-4o"). Duplicates are dropped so a
+// name that is already normal costs one lookup.
+func modelCandidates(model string) []string {
+	out := []string{model}
+	lower := strings.ToLower(strings.TrimSpace(model))
+	if lower != model {
+		out = append(out, lower)
+	}
+	if norm := versionSuffix.ReplaceAllString(lower, ""); norm != lower {
+		out = append(out, norm)
+	}
+	return out
+}
@@ -0,0 +1,28 @@
+package app
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestModelCandidates(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"gpt-4o", []string{"gpt-4o"}},
+		{"GPT-4o", []string{"GPT-4o", "gpt-4o"}},
+		{"gpt-4o-2024-08-06", []string{"gpt-4o-2024-08-06", "gpt-4o"}},
+		{"Claude-3-5-Sonnet-20241022", []string{"Claude-3-5-Sonnet-20241022", "claude-3-5-sonnet-20241022", "claude-3-5-sonnet"}},
+		{"gpt-3.5-turbo-0125", []string{"gpt-3.5-turbo-0125", "gpt-3.5-turbo"}},
+		{"gemini-1.5-pro@20240229", []string{"gemini-1.5-pro@20240229", "gemini-1.5-pro"}},
+		{"claude-3-opus-latest", []string{"claude-3-opus-latest", "claude-3-opus"}},
+		{"text-embedding-3-small", []string{"text-embedding-3-small"}},
+	}
+	for _, tt := range tests {
+		if got := modelCandidates(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("modelCandidates(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
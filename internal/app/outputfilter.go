@@ -0,0 +1,184 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
+)
+
+// Output filter actions.
+const (
+	OutputRedact = "redact" // replace each match, keep the rest of the text
+	OutputBlock  = "block"  // withhold the whole choice, finish_reason content_filter
+)
+
+// DefaultRedaction replaces redacted matches when no replacement is set.
+const DefaultRedaction = "[REDACTED]"
+
+// builtinDetectors are the PII detectors selectable by name. Patterns are
+// deliberately conservative (separators required for phone numbers,
+// Luhn-checked card numbers) to keep false positives down.
+var builtinDetectors = map[string]detector{
+	"email":       {re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	"phone":       {re: regexp.MustCompile(`(?:\+?1[ .-])?(?:\(\d{3}\) ?|\b\d{3}[ .-])\d{3}[ .-]\d{4}\b`)},
+	"ssn":         {re: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)},
+	"credit_card": {re: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), valid: luhn},
+}
+
+// OutputFilterPolicy configures an OutputFilter.
+type OutputFilterPolicy struct {
+	Action      string   // OutputRedact (default) or OutputBlock
+	Detectors   []string // built-in detectors: email, phone, ssn, credit_card
+	Terms       []string // blocked terms, matched case-insensitively
+	Patterns    []string // extra regular expressions
+	Replacement string   // redaction text; DefaultRedaction when empty
+}
+
+// OutputFilter scans completion text for disallowed content and redacts or
+// blocks it. Safe for concurrent use.
+type OutputFilter struct {
+	block       bool
+	replacement string
+	detectors   []detector
+}
+
+type detector struct {
+	name  string
+	re    *regexp.Regexp
+	valid func(match string) bool // nil = every match counts
+}
+
+// NewOutputFilter compiles p. It fails on an unknown action or detector
+// name, an invalid pattern, or a policy with nothing to detect.
+func NewOutputFilter(p OutputFilterPolicy) (*OutputFilter, error) {
+	f := &OutputFilter{replacement: p.Replacement}
+	switch p.Action {
+	case "", OutputRedact:
+	case OutputBlock:
+		f.block = true
+	default:
+		return nil, fmt.Errorf("output filter: unknown action %q (want redact or block)", p.Action)
+	}
+	if f.replacement == "" {
+		f.replacement = DefaultRedaction
+	}
+	for _, name := range p.Detectors {
+		d, ok := builtinDetectors[name]
+		if !ok {
+			return nil, fmt.Errorf("output filter: unknown detector %q", name)
+		}
+		d.name = name
+		f.detectors = append(f.detectors, d)
+	}
+	var terms []string
+	for _, t := range p.Terms {
+		if t != "" {
+			terms = append(terms, regexp.QuoteMeta(t))
+		}
+	}
+	if len(terms) > 0 {
+		f.detectors = append(f.detectors, detector{name: "term", re: regexp.MustCompile(`(?i)` + strings.Join(terms, "|"))})
+	}
+	for _, pat := range p.Patterns {
+		re, err := regexp.Compile(pat)
+		if err != nil {
+			return nil, fmt.Errorf("output filter: pattern %q: %w", pat, err)
+		}
+		f.detectors = append(f.detectors, detector{name: "pattern", re: re})
+	}
+	if len(f.detectors) == 0 {
+		return nil, fmt.Errorf("output filter: no detectors, terms, or patterns configured")
+	}
+	return f, nil
+}
+
+// Apply scans each choice's text content. Matches are replaced in place, or
+// with the block action the choice's content and tool calls are dropped and
+// its finish_reason set to content_filter. Returns the names of the
+// detectors that matched, nil for a clean response. Like stop sequences,
+// only plain string content is scanned; tool call arguments are not.
+func (f *OutputFilter) Apply(resp *gateway.ChatResponse) []string {
+	if resp == nil {
+		return nil
+	}
+	var matched []string
+	for i := range resp.Choices {
+		c := &resp.Choices[i]
+		var text string
+		if len(c.Message.Content) == 0 || c.Message.Content[0] != '"' ||
+			json.Unmarshal(c.Message.Content, &text) != nil {
+			continue // null or multi-part content
+		}
+		filtered, hits := f.scan(text)
+		if len(hits) == 0 {
+			continue
+		}
+		for _, h := range hits {
+			if !slices.Contains(matched, h) {
+				matched = append(matched, h)
+			}
+		}
+		if f.block {
+			c.Message.Content = json.RawMessage(`""`)
+			c.Message.ToolCalls = nil
+			c.FinishReason = provider.FinishContentFilter
+			continue
+		}
+		c.Message.Content, _ = json.Marshal(filtered)
+	}
+	return matched
+}
+
+// Redact returns text with every match replaced, whatever the filter's
+// action. Eval sampling uses it to scrub content before storing it.
+func (f *OutputFilter) Redact(text string) string {
+	out, _ := f.scan(text)
+	return out
+}
+
+// scan returns text with every match redacted and the names of the
+// detectors that matched.
+func (f *OutputFilter) scan(text string) (string, []string) {
+	var hits []string
+	for _, d := range f.detectors {
+		found := false
+		text = d.re.ReplaceAllStringFunc(text, func(m string) string {
+			if d.valid != nil && !d.valid(m) {
+				return m
+			}
+			found = true
+			return f.replacement
+		})
+		if found {
+			hits = append(hits, d.name)
+		}
+	}
+	return text, hits
+}
+
+// luhn reports whether the digits in s pass the Luhn checksum used by card
+// numbers. Separators are skipped.
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
+)
+
+func textResponse(text string) *gateway.ChatResponse {
+	content, _ := json.Marshal(text)
+	return &gateway.ChatResponse{Choices: []gateway.Choice{{
+		Message:      gateway.Message{Role: "assistant", Content: content},
+		FinishReason: "stop",
+	}}}
+}
+
+func choiceText(t *testing.T, resp *gateway.ChatResponse) string {
+	t.Helper()
+	var s string
+	if err := json.Unmarshal(resp.Choices[0].Message.Content, &s); err != nil {
+		t.Fatalf("content %s: %v", resp.Choices[0].Message.Content, err)
+	}
+	return s
+}
+
+func TestOutputFilter_RedactTerm(t *testing.T) {
+	t.Parallel()
+	f, err := NewOutputFilter(OutputFilterPolicy{Terms: []string{"Project Falcon"}})
+	if err != nil {
+		t.Fatalf("NewOutputFilter: %v", err)
+	}
+	resp := textResponse("The plan is project falcon, launching soon.")
+	matched := f.Apply(resp)
+	if !slices.Equal(matched, []string{"term"}) {
+		t.Errorf("matched = %v, want [term]", matched)
+	}
+	if got := choiceText(t, resp); got != "The plan is [REDACTED], launching soon." {
+		t.Errorf("content = %q", got)
+	}
+	if resp.Choices[0].FinishReason != "stop" {
+		t.Errorf("finish_reason = %q, want stop", resp.Choices[0].FinishReason)
+	}
+}
+
+func TestOutputFilter_BlockTerm(t *testing.T) {
+	t.Parallel()
+	f, err := NewOutputFilter(OutputFilterPolicy{Action: OutputBlock, Terms: []string{"falcon"}})
+	if err != nil {
+		t.Fatalf("NewOutputFilter: %v", err)
+	}
+	resp := textResponse("Falcon is a go.")
+	if matched := f.Apply(resp); len(matched) != 1 {
+		t.Errorf("matched = %v, want one detector", matched)
+	}
+	if got := choiceText(t, resp); got != "" {
+		t.Errorf("content = %q, want empty", got)
+	}
+	if resp.Choices[0].FinishReason != provider.FinishContentFilter {
+		t.Errorf("finish_reason = %q, want %q", resp.Choices[0].FinishReason, provider.FinishContentFilter)
+	}
+}
+
+func TestOutputFilter_Detectors(t *testing.T) {
+	t.Parallel()
+	f, err := NewOutputFilter(OutputFilterPolicy{
+		Detectors:   []string{"email", "ssn", "credit_card"},
+		Replacement: "***",
+	})
+	if err != nil {
+		t.Fatalf("NewOutputFilter: %v", err)
+	}
+	tests := []struct {
+		name, in, want string
+	}{
+		{"email", "mail jane.doe@example.com now", "mail *** now"},
+		{"ssn", "ssn 123-45-6789.", "ssn ***."},
+		{"card", "card 4111 1111 1111 1111 ok", "card *** ok"},
+		{"non-luhn digits", "order 1234 5678 9012 3456", "order 1234 5678 9012 3456"},
+		{"clean", "nothing to see", "nothing to see"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := textResponse(tt.in)
+			f.Apply(resp)
+			if got := choiceText(t, resp); got != tt.want {
+				t.Errorf("content = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputFilter_SkipsNonStringContent(t *testing.T) {
+	t.Parallel()
+	f, _ := NewOutputFilter(OutputFilterPolicy{Terms: []string{"secret"}})
+	parts := json.RawMessage(`[{"type":"text","text":"secret"}]`)
+	resp := &gateway.ChatResponse{Choices: []gateway.Choice{
+		{Message: gateway.Message{Role: "assistant", Content: parts}},
+		{Message: gateway.Message{Role: "assistant"}},
+	}}
+	if matched := f.Apply(resp); matched != nil {
+		t.Errorf("matched = %v, want nil", matched)
+	}
+	if string(resp.Choices[0].Message.Content) != string(parts) {
+		t.Errorf("content = %s, want unchanged", resp.Choices[0].Message.Content)
+	}
+}
+
+func TestNewOutputFilter_Invalid(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		p    OutputFilterPolicy
+	}{
+		{"empty", OutputFilterPolicy{}},
+		{"unknown action", OutputFilterPolicy{Action: "drop", Terms: []string{"x"}}},
+		{"unknown detector", OutputFilterPolicy{Detectors: []string{"passport"}}},
+		{"bad pattern", OutputFilterPolicy{Patterns: []string{"("}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewOutputFilter(tt.p); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
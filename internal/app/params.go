@@ -0,0 +1,68 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
+)
+
+// samplingParam is a ChatRequest sampling parameter a provider may declare
+// support for, with how to clear it from a request.
+type samplingParam struct {
+	name  string
+	clear func(*gateway.ChatRequest)
+}
+
+var samplingParams = []samplingParam{
+	{"temperature", func(r *gateway.ChatRequest) { r.Temperature = nil }},
+	{"top_p", func(r *gateway.ChatRequest) { r.TopP = nil }},
+	{"presence_penalty", func(r *gateway.ChatRequest) { r.PresencePenalty = nil }},
+	{"frequency_penalty", func(r *gateway.ChatRequest) { r.FrequencyPenalty = nil }},
+	{"seed", func(r *gateway.ChatRequest) { r.Seed = nil }},
+}
+
+// IsSamplingParam reports whether name is a sampling parameter providers
+// may declare support for.
+func IsSamplingParam(name string) bool {
+	return slices.ContainsFunc(samplingParams, func(sp samplingParam) bool { return sp.name == name })
+}
+
+// stripUnsupportedParams returns req without the sampling parameters the
+// target's provider does not support: those configured on the registry,
+// else those the provider reports via gateway.SamplingParamsReporter.
+// Providers with neither get req unchanged. req itself is never modified;
+// a copy is returned when anything is stripped, so failover to another
+// provider still sends the client's parameters.
+func stripUnsupportedParams(ctx context.Context, req *gateway.ChatRequest, reg *provider.Registry, providerID string, p gateway.Provider) *gateway.ChatRequest {
+	supported := reg.SamplingParams(providerID)
+	if supported == nil {
+		sr, ok := p.(gateway.SamplingParamsReporter)
+		if !ok {
+			return req
+		}
+		supported = sr.SupportedSamplingParams()
+	}
+	out := req
+	var stripped []string
+	for _, sp := range samplingParams {
+		if !chatFieldSet[sp.name](req) || slices.Contains(supported, sp.name) {
+			continue
+		}
+		if out == req {
+			cp := *req
+			out = &cp
+		}
+		sp.clear(out)
+		stripped = append(stripped, sp.name)
+	}
+	if len(stripped) > 0 {
+		slog.LogAttrs(ctx, slog.LevelDebug, "stripped unsupported sampling params",
+			slog.String("provider", providerID),
+			slog.Any("params", stripped),
+		)
+	}
+	return out
+}
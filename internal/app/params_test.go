@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
+	"github.com/eugener/gandalf/internal/testutil"
+)
+
+// samplingProvider declares the sampling params it supports.
+type samplingProvider struct {
+	*testutil.FakeProvider
+	params []string
+}
+
+func (p samplingProvider) SupportedSamplingParams() []string { return p.params }
+
+// capturingProvider records the last chat request it received.
+func capturingProvider(name string, got **gateway.ChatRequest, err error) *testutil.FakeProvider {
+	return &testutil.FakeProvider{
+		ProviderName: name,
+		ChatFn: func(_ context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			cp := *req
+			*got = &cp
+			return &gateway.ChatResponse{ID: name}, err
+		},
+	}
+}
+
+func TestChatCompletion_StripsUnsupportedParams(t *testing.T) {
+	t.Parallel()
+
+	var toOllama, toOpenAI, toConfigured *gateway.ChatRequest
+	reg := provider.NewRegistry()
+	reg.Register("ollama", samplingProvider{
+		FakeProvider: capturingProvider("ollama", &toOllama, errors.New("down")),
+		params:       []string{"temperature", "top_p", "seed"},
+	})
+	reg.Register("openai", capturingProvider("openai", &toOpenAI, nil))
+	reg.Register("local", samplingProvider{
+		FakeProvider: capturingProvider("local", &toConfigured, nil),
+		params:       []string{"temperature", "presence_penalty"},
+	})
+	reg.SetSamplingParams("local", []string{"frequency_penalty"}) // replaces the declaration
+
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:         "r-1",
+		ModelAlias: "llama",
+		Targets:    []byte(`[{"provider_id":"ollama","model":"llama3","priority":1},{"provider_id":"openai","model":"gpt-4o","priority":2}]`),
+	})
+	store.AddRoute(&gateway.Route{
+		ID:         "r-2",
+		ModelAlias: "local",
+		Targets:    []byte(`[{"provider_id":"local","model":"local","priority":1}]`),
+	})
+	ps := NewProxyService(reg, NewRouterService(store), nil, nil)
+
+	temp, penalty, seed := 0.2, 0.5, 7
+	newReq := func(model string) *gateway.ChatRequest {
+		return &gateway.ChatRequest{Model: model, Temperature: &temp, PresencePenalty: &penalty, FrequencyPenalty: &penalty, Seed: &seed}
+	}
+
+	// Ollama fails, so the request fails over to OpenAI.
+	req := newReq("llama")
+	if _, err := ps.ChatCompletion(context.Background(), req); err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	if toOllama.PresencePenalty != nil || toOllama.FrequencyPenalty != nil {
+		t.Errorf("ollama got penalties %v/%v, want them stripped", toOllama.PresencePenalty, toOllama.FrequencyPenalty)
+	}
+	if toOllama.Temperature == nil || toOllama.Seed == nil {
+		t.Error("ollama lost supported params")
+	}
+	if toOpenAI.PresencePenalty == nil || toOpenAI.FrequencyPenalty == nil || toOpenAI.Temperature == nil || toOpenAI.Seed == nil {
+		t.Errorf("openai got %+v, want every param preserved", toOpenAI)
+	}
+	if req.PresencePenalty == nil || req.Model != "llama" {
+		t.Errorf("caller's request was modified: %+v", req)
+	}
+
+	if _, err := ps.ChatCompletion(context.Background(), newReq("local")); err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	if toConfigured.FrequencyPenalty == nil || toConfigured.Temperature != nil || toConfigured.PresencePenalty != nil || toConfigured.Seed != nil {
+		t.Errorf("configured provider got %+v, want only frequency_penalty", toConfigured)
+	}
+}
@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"sync"
+	"time"
 
+	"github.com/tidwall/gjson"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 
@@ -15,6 +18,12 @@ import (
 	"github.com/eugener/gandalf/internal/provider"
 )
 
+// ListModels fan-out limits.
+const (
+	listModelsWorkers = 8               // providers queried at once
+	listModelsTimeout = 5 * time.Second // per provider
+)
+
 // ProxyService forwards chat completion requests to the appropriate LLM provider
 // based on model routing configuration. It supports priority failover: on
 // provider/network errors it tries the next target; on client errors (4xx)
@@ -24,6 +33,16 @@ type ProxyService struct {
 	router    *RouterService
 	tracer    trace.Tracer                // nil disables tracing (saves ~3.7 allocs/op)
 	breakers  *circuitbreaker.Registry    // nil disables circuit breaking
+
+	emptyRetries       int             // extra attempts for empty chat completions (0 = none)
+	truncateEmbeddings bool            // shorten embeddings the provider didn't reduce to req.Dimensions
+	errorLog           *ErrorLog       // nil = failed calls are not logged
+	latencyStats       *LatencyStats   // nil = no per-provider percentiles
+	hedger             *hedger         // nil = no request hedging
+	modelDiag          *modelDiagnoser // nil = no model-not-found diagnostics
+	listTimeout        time.Duration   // per-provider ListModels timeout (0 = listModelsTimeout)
+
+	capabilities map[string]gateway.CapabilityOverride // by provider-side model; nil = reported only
 }
 
 // NewProxyService returns a ProxyService wired to the given provider registry and router.
@@ -43,12 +62,23 @@ func (ps *ProxyService) ChatCompletion(ctx context.Context, req *gateway.ChatReq
 	if err != nil {
 		return nil, err
 	}
+	if targets, err = ps.filterByCapability(ctx, req, targets); err != nil {
+		return nil, err
+	}
+	debugRoute(ctx, targets)
+	schema, schemaPolicy := ps.router.ResponseSchema(ctx, req.Model)
 
 	var lastErr error
-	for _, target := range targets {
+	var unavailable int // targets whose provider is disabled or unregistered
+	var empty *gateway.ChatResponse
+	var emptyTarget ResolvedTarget
+	retried, schemaRetried := 0, 0
+	for i := 0; i < len(targets); i++ {
+		target := targets[i]
 		if ps.breakers != nil {
 			if cb := ps.breakers.Get(target.ProviderID); cb != nil && !cb.Allow() {
 				lastErr = fmt.Errorf("%w: circuit breaker open for %s", gateway.ErrProviderError, target.ProviderID)
+				debugAttempt(ctx, target, outcomeCircuitOpen, 0, nil)
 				continue
 			}
 		}
@@ -57,11 +87,18 @@ func (ps *ProxyService) ChatCompletion(ctx context.Context, req *gateway.ChatReq
 		if err != nil {
 			// Use %w (not %v) to preserve error chain for errors.Is upstream.
 			lastErr = fmt.Errorf("%w: %w", gateway.ErrProviderError, err)
+			unavailable++
+			debugAttempt(ctx, target, outcomeUnavailable, 0, nil)
 			continue
 		}
+		// A request the provider would reject is a client error: no failover.
+		if err := ps.checkRequiredFields(req, target.ProviderID, p); err != nil {
+			return nil, err
+		}
 
-		origModel := req.Model
-		req.Model = target.Model
+		callReq := stripUnsupportedParams(ctx, req, ps.providers, target.ProviderID, p)
+		origModel := callReq.Model
+		callReq.Model = target.Model
 
 		callCtx := ctx
 		var span trace.Span
@@ -73,14 +110,35 @@ func (ps *ProxyService) ChatCompletion(ctx context.Context, req *gateway.ChatReq
 				),
 			)
 		}
-		resp, err := p.ChatCompletion(callCtx, req)
+		start := time.Now()
+		resp, hedge, err := ps.chatWithHedge(callCtx, callReq, p, target, targets[i+1:])
 		if span != nil {
 			span.End()
 		}
-		req.Model = origModel
+		callReq.Model = origModel
+		elapsed := time.Since(start)
+		if hedge != nil {
+			i++ // the hedge target has had its turn
+			if hedge.answered {
+				target, elapsed = hedge.target, hedge.elapsed
+			}
+		}
+		retryEmpty := err == nil && retried < ps.emptyRetries && emptyCompletion(resp)
+		var schemaErr error
+		if err == nil && !retryEmpty && schema != nil {
+			schemaErr = checkResponseSchema(schema, resp)
+		}
+		retrySchema := schemaErr != nil && schemaRetry(ctx, schemaPolicy, schemaRetried, target.ProviderID, schemaErr)
+		outcome := ""
+		if retryEmpty {
+			outcome = outcomeEmpty
+		} else if retrySchema {
+			outcome = outcomeSchema
+		}
+		debugAttempt(ctx, target, outcome, elapsed, err)
 
 		if err != nil {
-			ps.recordBreakerError(target.ProviderID, err)
+			ps.recordProviderError(ctx, target, err)
 			if lastErr, ok := failoverErr(ctx, err, target.ProviderID, "provider failed, trying next"); ok {
 				return nil, lastErr
 			}
@@ -88,24 +146,82 @@ func (ps *ProxyService) ChatCompletion(ctx context.Context, req *gateway.ChatReq
 			continue
 		}
 		ps.recordBreakerSuccess(target.ProviderID)
+		ps.router.observeLatency(target.ProviderID, target.Model, elapsed)
+		ps.observeProviderLatency(target.ProviderID, elapsed)
+		if retryEmpty {
+			slog.LogAttrs(ctx, slog.LevelWarn, "provider returned empty completion, retrying",
+				slog.String("provider", target.ProviderID),
+				slog.Int("retry", retried+1),
+			)
+			retried++
+			empty, emptyTarget = resp, target
+			if i == len(targets)-1 {
+				i-- // nothing left to fail over to: retry the last target
+			}
+			continue
+		}
+		if retrySchema {
+			schemaRetried++
+			lastErr = fmt.Errorf("%w: %w", gateway.ErrSchemaViolation, schemaErr)
+			if i == len(targets)-1 {
+				i--
+			}
+			continue
+		}
+		if schemaErr != nil {
+			if schemaPolicy != gateway.SchemaAnnotate {
+				return nil, fmt.Errorf("%w: %w", gateway.ErrSchemaViolation, schemaErr)
+			}
+			gateway.SetSchemaViolation(ctx, schemaErr.Error())
+		}
+		gateway.SetRequestTarget(ctx, target.ProviderID, target.Model)
+		ApplyStopSequences(resp, req.Stop)
 		return resp, nil
 	}
+	// Retries ended in errors: an empty answer beats none.
+	if empty != nil {
+		gateway.SetRequestTarget(ctx, emptyTarget.ProviderID, emptyTarget.Model)
+		return empty, nil
+	}
+	if unavailable == len(targets) {
+		return nil, noProviderErr(req.Model)
+	}
 	return nil, lastErr
 }
 
 // ChatCompletionStream resolves the model and forwards a streaming request
-// with priority failover.
+// with priority failover. A target known not to stream (see
+// gateway.CapabilityReporter and SetCapabilityOverrides) is called without
+// streaming and its response replayed as a stream. So is every request on
+// a route with a response schema, which must see the whole response before
+// anything is sent. A stream is cut at the request's stop sequences for
+// providers that send them anyway (see trimStream).
 func (ps *ProxyService) ChatCompletionStream(ctx context.Context, req *gateway.ChatRequest) (<-chan gateway.StreamChunk, error) {
+	if schema, _ := ps.router.ResponseSchema(ctx, req.Model); schema != nil {
+		call := *req
+		call.Stream, call.StreamOptions = false, nil
+		resp, err := ps.ChatCompletion(ctx, &call)
+		if err != nil {
+			return nil, err
+		}
+		return replayStream(resp, req.StreamOptions != nil && req.StreamOptions.IncludeUsage), nil
+	}
 	targets, err := ps.router.ResolveModel(ctx, req.Model)
 	if err != nil {
 		return nil, err
 	}
+	if targets, err = ps.filterByCapability(ctx, req, targets); err != nil {
+		return nil, err
+	}
+	debugRoute(ctx, targets)
 
 	var lastErr error
+	var unavailable int // targets whose provider is disabled or unregistered
 	for _, target := range targets {
 		if ps.breakers != nil {
 			if cb := ps.breakers.Get(target.ProviderID); cb != nil && !cb.Allow() {
 				lastErr = fmt.Errorf("%w: circuit breaker open for %s", gateway.ErrProviderError, target.ProviderID)
+				debugAttempt(ctx, target, outcomeCircuitOpen, 0, nil)
 				continue
 			}
 		}
@@ -113,16 +229,30 @@ func (ps *ProxyService) ChatCompletionStream(ctx context.Context, req *gateway.C
 		p, err := ps.providers.Get(target.ProviderID)
 		if err != nil {
 			lastErr = fmt.Errorf("%w: %w", gateway.ErrProviderError, err)
+			unavailable++
+			debugAttempt(ctx, target, outcomeUnavailable, 0, nil)
 			continue
 		}
+		// A request the provider would reject is a client error: no failover.
+		if err := ps.checkRequiredFields(req, target.ProviderID, p); err != nil {
+			return nil, err
+		}
 
-		origModel := req.Model
-		req.Model = target.Model
-		ch, err := p.ChatCompletionStream(ctx, req)
-		req.Model = origModel
+		callReq := stripUnsupportedParams(ctx, req, ps.providers, target.ProviderID, p)
+		origModel := callReq.Model
+		callReq.Model = target.Model
+		start := time.Now()
+		var ch <-chan gateway.StreamChunk
+		if ps.lacksCapability(target, streamingCapability) {
+			ch, err = restream(ctx, p, callReq)
+		} else {
+			ch, err = p.ChatCompletionStream(ctx, callReq)
+		}
+		callReq.Model = origModel
+		debugAttempt(ctx, target, "", time.Since(start), err)
 
 		if err != nil {
-			ps.recordBreakerError(target.ProviderID, err)
+			ps.recordProviderError(ctx, target, err)
 			if lastErr, ok := failoverErr(ctx, err, target.ProviderID, "provider stream failed, trying next"); ok {
 				return nil, lastErr
 			}
@@ -130,20 +260,45 @@ func (ps *ProxyService) ChatCompletionStream(ctx context.Context, req *gateway.C
 			continue
 		}
 		ps.recordBreakerSuccess(target.ProviderID)
+		gateway.SetRequestTarget(ctx, target.ProviderID, target.Model)
+		if len(req.Stop) > 0 {
+			if seqs := stopSequences(req.Stop); len(seqs) > 0 {
+				ch = trimStream(ctx, ch, seqs)
+			}
+		}
 		return ch, nil
 	}
+	if unavailable == len(targets) {
+		return nil, noProviderErr(req.Model)
+	}
 	return nil, lastErr
 }
 
 // Embeddings resolves the model and forwards an embedding request with
-// priority failover.
+// priority failover. The response is transcoded to the requested
+// encoding_format when the provider didn't honor it.
 func (ps *ProxyService) Embeddings(ctx context.Context, req *gateway.EmbeddingRequest) (*gateway.EmbeddingResponse, error) {
+	if err := checkEncodingFormat(req.EncodingFormat); err != nil {
+		return nil, err
+	}
+	if err := checkDimensions(req.Dimensions); err != nil {
+		return nil, err
+	}
 	targets, err := ps.router.ResolveModel(ctx, req.Model)
 	if err != nil {
 		return nil, err
 	}
 
+	// Expected vector size from the request or else the route; a mismatch
+	// is treated like a provider failure so failover never mixes dimensions
+	// silently.
+	expected := ps.router.EmbeddingDimensions(ctx, req.Model)
+	if req.Dimensions != nil {
+		expected = *req.Dimensions
+	}
+
 	var lastErr error
+	var unavailable int // targets whose provider is disabled or unregistered
 	for _, target := range targets {
 		if ps.breakers != nil {
 			if cb := ps.breakers.Get(target.ProviderID); cb != nil && !cb.Allow() {
@@ -155,16 +310,18 @@ func (ps *ProxyService) Embeddings(ctx context.Context, req *gateway.EmbeddingRe
 		p, err := ps.providers.Get(target.ProviderID)
 		if err != nil {
 			lastErr = fmt.Errorf("%w: %w", gateway.ErrProviderError, err)
+			unavailable++
 			continue
 		}
 
 		origModel := req.Model
 		req.Model = target.Model
+		start := time.Now()
 		resp, err := p.Embeddings(ctx, req)
 		req.Model = origModel
 
 		if err != nil {
-			ps.recordBreakerError(target.ProviderID, err)
+			ps.recordProviderError(ctx, target, err)
 			if lastErr, ok := failoverErr(ctx, err, target.ProviderID, "provider embeddings failed, trying next"); ok {
 				return nil, lastErr
 			}
@@ -172,57 +329,188 @@ func (ps *ProxyService) Embeddings(ctx context.Context, req *gateway.EmbeddingRe
 			continue
 		}
 		ps.recordBreakerSuccess(target.ProviderID)
+		ps.observeProviderLatency(target.ProviderID, time.Since(start))
+		if req.Dimensions != nil && ps.truncateEmbeddings && embeddingDims(resp.Data) > expected {
+			data, err := truncateEmbeddings(resp.Data, expected)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", gateway.ErrProviderError, target.ProviderID, err)
+			}
+			resp.Data = data
+		}
+		if expected > 0 {
+			if got := embeddingDims(resp.Data); got != expected {
+				slog.LogAttrs(ctx, slog.LevelWarn, "embedding dimensions mismatch, trying next",
+					slog.String("provider", target.ProviderID),
+					slog.Int("expected", expected),
+					slog.Int("got", got),
+				)
+				lastErr = fmt.Errorf("%w: expected %d, got %d", gateway.ErrDimensionMismatch, expected, got)
+				continue
+			}
+		}
+		// Providers may ignore encoding_format; serve what the client asked for.
+		data, err := transcodeEmbeddings(resp.Data, req.EncodingFormat)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", gateway.ErrProviderError, target.ProviderID, err)
+		}
+		resp.Data = data
+		gateway.SetRequestTarget(ctx, target.ProviderID, target.Model)
 		return resp, nil
 	}
+	if unavailable == len(targets) {
+		return nil, noProviderErr(req.Model)
+	}
 	return nil, lastErr
 }
 
-// failoverErr checks whether err is a client error (non-retriable). If so it
-// returns (err, true). Otherwise it logs a warning and returns ("", false) so
-// the caller continues to the next target. Kept as a helper to avoid repeating
-// the log+check pattern in every failover loop.
+// noProviderErr reports that a route exists but none of its targets maps to
+// a registered provider, so the caller gets a clear 503 instead of a generic
+// provider failure.
+func noProviderErr(model string) error {
+	return fmt.Errorf("%w %q", gateway.ErrNoProvider, model)
+}
+
+// embeddingDims returns the vector size shared by every item in an
+// OpenAI-format embedding data array, or -1 if items disagree or the data
+// can't be read. Handles both float arrays and base64 (little-endian
+// float32) encodings without decoding the vectors.
+func embeddingDims(data []byte) int {
+	dims := -1
+	consistent := true
+	gjson.ParseBytes(data).ForEach(func(_, item gjson.Result) bool {
+		n := -1
+		switch e := item.Get("embedding"); e.Type {
+		case gjson.JSON:
+			if e.IsArray() {
+				n = int(e.Get("#").Int())
+			}
+		case gjson.String:
+			n = base64Len(e.Str) / 4
+		}
+		if dims == -1 {
+			dims = n
+		}
+		if n != dims || n < 0 {
+			consistent = false
+			return false
+		}
+		return true
+	})
+	if !consistent {
+		return -1
+	}
+	return dims
+}
+
+// base64Len returns the decoded byte length of a padded standard base64 string.
+func base64Len(s string) int {
+	n := len(s) / 4 * 3
+	for i := len(s) - 1; i >= 0 && s[i] == '='; i-- {
+		n--
+	}
+	return n
+}
+
+// failoverErr checks whether err is a client error (non-retriable) or the
+// request context is done. If so it returns (err, true). Otherwise it logs
+// a warning and returns ("", false) so the caller continues to the next
+// target. Kept as a helper to avoid repeating the log+check pattern in
+// every failover loop.
 func failoverErr(ctx context.Context, err error, providerID, msg string) (error, bool) {
 	if isClientError(err) {
 		return err, true
 	}
+	// The caller's deadline passed or it went away; no later target can
+	// finish in time either.
+	if ctx.Err() != nil {
+		return err, true
+	}
 	slog.LogAttrs(ctx, slog.LevelWarn, msg,
 		slog.String("provider", providerID),
+		slog.String("error_category", circuitbreaker.ErrorCategory(err)),
 		slog.String("error", err.Error()),
 	)
 	return nil, false
 }
 
-// ListModels aggregates model lists from all registered providers.
+// ListModels aggregates model lists from all registered providers,
+// de-duplicated in provider name order. Per-provider results may be served
+// from the registry's models cache. Providers are queried concurrently,
+// listModelsWorkers at a time, and one that fails or takes longer than
+// listModelsTimeout is skipped, so a slow provider cannot stall /v1/models.
 func (ps *ProxyService) ListModels(ctx context.Context) ([]string, error) {
+	names := ps.providers.List()
+	results := make([][]string, len(names))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(listModelsWorkers, len(names)) {
+		wg.Go(func() {
+			for i := range jobs {
+				results[i] = ps.listProviderModels(ctx, names[i])
+			}
+		})
+	}
+	for i := range names {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
 	var all []string
-	for _, name := range ps.providers.List() {
-		p, err := ps.providers.Get(name)
-		if err != nil {
-			continue
-		}
-		models, err := p.ListModels(ctx)
-		if err != nil {
-			continue
+	seen := make(map[string]bool)
+	for _, models := range results {
+		for _, m := range models {
+			if !seen[m] {
+				seen[m] = true
+				all = append(all, m)
+			}
 		}
-		all = append(all, models...)
 	}
 	return all, nil
 }
 
-// recordBreakerSuccess records a successful request to the circuit breaker.
-func (ps *ProxyService) recordBreakerSuccess(providerID string) {
-	if ps.breakers != nil {
-		ps.breakers.GetOrCreate(providerID).RecordSuccess()
+// listProviderModels returns name's models, or nil when the provider fails
+// or does not answer within listModelsTimeout. A provider that ignores
+// cancellation is abandoned; its late answer is dropped.
+func (ps *ProxyService) listProviderModels(ctx context.Context, name string) []string {
+	ctx, cancel := context.WithTimeout(ctx, ps.listModelsTimeout())
+	defer cancel()
+	type result struct {
+		models []string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		models, err := ps.providers.ListModels(ctx, name)
+		done <- result{models, err}
+	}()
+	var r result
+	select {
+	case r = <-done:
+	case <-ctx.Done():
+		r.err = ctx.Err()
 	}
+	if r.err != nil {
+		slog.LogAttrs(ctx, slog.LevelWarn, "list models failed, skipping provider",
+			slog.String("provider", name),
+			slog.String("error", r.err.Error()),
+		)
+		return nil
+	}
+	return r.models
 }
 
-// recordBreakerError records a failed request to the circuit breaker.
-func (ps *ProxyService) recordBreakerError(providerID string, err error) {
+func (ps *ProxyService) listModelsTimeout() time.Duration {
+	if ps.listTimeout > 0 {
+		return ps.listTimeout
+	}
+	return listModelsTimeout
+}
+
+// recordBreakerSuccess records a successful request to the circuit breaker.
+func (ps *ProxyService) recordBreakerSuccess(providerID string) {
 	if ps.breakers != nil {
-		weight := circuitbreaker.ClassifyError(err)
-		if weight > 0 {
-			ps.breakers.GetOrCreate(providerID).RecordError(weight)
-		}
+		ps.breakers.GetOrCreate(providerID).RecordSuccess()
 	}
 }
 
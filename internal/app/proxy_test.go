@@ -3,6 +3,7 @@ package app
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -71,6 +72,48 @@ func TestChatCompletion_FailoverToSecondary(t *testing.T) {
 	}
 }
 
+func TestChatCompletion_PreferredProviders(t *testing.T) {
+	t.Parallel()
+
+	reg := provider.NewRegistry()
+	for _, name := range []string{"shared", "dedicated"} {
+		reg.Register(name, &testutil.FakeProvider{
+			ProviderName: name,
+			ChatFn: func(context.Context, *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+				return &gateway.ChatResponse{ID: name}, nil
+			},
+		})
+	}
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:         "r-1",
+		ModelAlias: "gpt-4o",
+		Targets:    []byte(`[{"provider_id":"shared","model":"gpt-4o","priority":1},{"provider_id":"dedicated","model":"gpt-4o","priority":2}]`),
+		Strategy:   "priority",
+	})
+	ps := NewProxyService(reg, NewRouterService(store), nil, nil)
+
+	tests := []struct {
+		name     string
+		identity *gateway.Identity
+		want     string
+	}{
+		{"default order", &gateway.Identity{KeyID: "key-shared"}, "shared"},
+		{"preferred provider", &gateway.Identity{KeyID: "key-dedicated", PreferredProviders: []string{"dedicated"}}, "dedicated"},
+		{"preference not on route", &gateway.Identity{KeyID: "key-other", PreferredProviders: []string{"azure"}}, "shared"},
+	}
+	for _, tt := range tests {
+		ctx := gateway.ContextWithIdentity(context.Background(), tt.identity)
+		resp, err := ps.ChatCompletion(ctx, &gateway.ChatRequest{Model: "gpt-4o"})
+		if err != nil {
+			t.Fatalf("%s: ChatCompletion: %v", tt.name, err)
+		}
+		if resp.ID != tt.want {
+			t.Errorf("%s: served by %q, want %q", tt.name, resp.ID, tt.want)
+		}
+	}
+}
+
 func TestChatCompletion_ClientErrorNoFailover(t *testing.T) {
 	t.Parallel()
 
@@ -455,6 +498,57 @@ func TestListModels_SkipsFailingProvider(t *testing.T) {
 	}
 }
 
+func TestListModels_ManyProvidersWithSlowOnes(t *testing.T) {
+	t.Parallel()
+
+	reg := provider.NewRegistry()
+	release := make(chan struct{})
+	defer close(release)
+	want := map[string]bool{"shared-model": true}
+	for i := range 40 {
+		name := fmt.Sprintf("p%02d", i)
+		fp := &testutil.FakeProvider{ProviderName: name}
+		switch {
+		case i%10 == 3: // honors cancellation
+			fp.ModelsFn = func(ctx context.Context) ([]string, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+		case i%10 == 7: // ignores cancellation
+			fp.ModelsFn = func(context.Context) ([]string, error) {
+				<-release
+				return []string{name + "-late"}, nil
+			}
+		default:
+			want[name+"-model"] = true
+			fp.ModelsFn = func(context.Context) ([]string, error) {
+				return []string{name + "-model", "shared-model"}, nil
+			}
+		}
+		reg.Register(name, fp)
+	}
+
+	ps := NewProxyService(reg, NewRouterService(testutil.NewFakeStore()), nil, nil)
+	ps.listTimeout = 50 * time.Millisecond
+	start := time.Now()
+	models, err := ps.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels: %v", err)
+	}
+	// 8 slow providers, 8 workers: one timeout round, not one per provider.
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("ListModels took %v, want bounded by the per-provider timeout", elapsed)
+	}
+	if len(models) != len(want) {
+		t.Errorf("got %d models, want %d (fast providers + one shared): %v", len(models), len(want), models)
+	}
+	for _, m := range models {
+		if !want[m] {
+			t.Errorf("unexpected model %q", m)
+		}
+	}
+}
+
 // --- Circuit Breaker Integration ---
 
 func TestChatCompletion_CircuitBreakerSkipsOpenProvider(t *testing.T) {
@@ -726,3 +820,165 @@ func TestEmbeddings_CircuitBreakerRecordsErrors(t *testing.T) {
 		t.Fatalf("state = %v, want open", cb.State())
 	}
 }
+
+func TestNoAvailableProvider(t *testing.T) {
+	t.Parallel()
+
+	// Route exists but neither target's provider is registered (disabled).
+	reg := provider.NewRegistry()
+	reg.Register("other", &testutil.FakeProvider{ProviderName: "other"})
+
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:         "r-1",
+		ModelAlias: "gpt-4o",
+		Targets:    []byte(`[{"provider_id":"openai","model":"gpt-4o","priority":1},{"provider_id":"azure","model":"gpt-4o","priority":2}]`),
+		Strategy:   "priority",
+	})
+	ps := NewProxyService(reg, NewRouterService(store), nil, nil)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"chat", func() error {
+			_, err := ps.ChatCompletion(ctx, &gateway.ChatRequest{Model: "gpt-4o"})
+			return err
+		}},
+		{"stream", func() error {
+			_, err := ps.ChatCompletionStream(ctx, &gateway.ChatRequest{Model: "gpt-4o"})
+			return err
+		}},
+		{"embeddings", func() error {
+			_, err := ps.Embeddings(ctx, &gateway.EmbeddingRequest{Model: "gpt-4o"})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.call()
+			if !errors.Is(err, gateway.ErrNoProvider) {
+				t.Errorf("err = %v, want ErrNoProvider", err)
+			}
+		})
+	}
+}
+
+func TestPartiallyAvailableProviderKeepsProviderError(t *testing.T) {
+	t.Parallel()
+
+	// One target is registered but failing: the generic provider error is kept.
+	reg := provider.NewRegistry()
+	reg.Register("openai", &testutil.FakeProvider{
+		ProviderName: "openai",
+		ChatFn: func(context.Context, *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			return nil, errors.New("upstream down")
+		},
+	})
+
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:         "r-1",
+		ModelAlias: "gpt-4o",
+		Targets:    []byte(`[{"provider_id":"openai","model":"gpt-4o","priority":1},{"provider_id":"azure","model":"gpt-4o","priority":2}]`),
+		Strategy:   "priority",
+	})
+	ps := NewProxyService(reg, NewRouterService(store), nil, nil)
+
+	_, err := ps.ChatCompletion(context.Background(), &gateway.ChatRequest{Model: "gpt-4o"})
+	if errors.Is(err, gateway.ErrNoProvider) {
+		t.Error("should not report ErrNoProvider when a target was tried")
+	}
+	if !errors.Is(err, gateway.ErrProviderError) {
+		t.Errorf("err = %v, want ErrProviderError", err)
+	}
+}
+
+// embedProvider returns a fake whose embeddings have the given data payload.
+func embedProvider(name, data string) *testutil.FakeProvider {
+	return &testutil.FakeProvider{
+		ProviderName: name,
+		EmbedFn: func(_ context.Context, req *gateway.EmbeddingRequest) (*gateway.EmbeddingResponse, error) {
+			return &gateway.EmbeddingResponse{Object: "list", Model: name, Data: []byte(data)}, nil
+		},
+	}
+}
+
+func TestEmbeddings_DimensionMismatch(t *testing.T) {
+	t.Parallel()
+
+	const (
+		dims2 = `[{"object":"embedding","index":0,"embedding":[0.1,0.2]}]`
+		dims3 = `[{"object":"embedding","index":0,"embedding":[0.1,0.2,0.3]}]`
+		// 3 little-endian float32s (12 bytes) in base64.
+		dims3b64 = `[{"object":"embedding","index":0,"embedding":"AAAAAAAAAAAAAAAA"}]`
+	)
+
+	tests := []struct {
+		name      string
+		dims      int
+		primary   string
+		secondary string
+		wantModel string
+		wantErr   bool
+	}{
+		{"match primary", 3, dims3, dims2, "primary", false},
+		{"mismatch fails over", 3, dims2, dims3, "secondary", false},
+		{"base64 counted", 3, dims2, dims3b64, "secondary", false},
+		{"all mismatch", 3, dims2, dims2, "", true},
+		{"no check when unset", 0, dims2, dims3, "primary", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			reg := provider.NewRegistry()
+			reg.Register("primary", embedProvider("primary", tt.primary))
+			reg.Register("secondary", embedProvider("secondary", tt.secondary))
+
+			store := testutil.NewFakeStore()
+			store.AddRoute(&gateway.Route{
+				ID:                  "r-1",
+				ModelAlias:          "text-embed",
+				Targets:             []byte(`[{"provider_id":"primary","model":"text-embed","priority":1},{"provider_id":"secondary","model":"text-embed","priority":2}]`),
+				Strategy:            "priority",
+				EmbeddingDimensions: tt.dims,
+			})
+			ps := NewProxyService(reg, NewRouterService(store), nil, nil)
+
+			resp, err := ps.Embeddings(context.Background(), &gateway.EmbeddingRequest{Model: "text-embed"})
+			if tt.wantErr {
+				if !errors.Is(err, gateway.ErrDimensionMismatch) {
+					t.Fatalf("err = %v, want ErrDimensionMismatch", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Embeddings: %v", err)
+			}
+			if resp.Model != tt.wantModel {
+				t.Errorf("served by %q, want %q", resp.Model, tt.wantModel)
+			}
+		})
+	}
+}
+
+func TestEmbeddingDims(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		data string
+		want int
+	}{
+		{`[{"embedding":[1,2,3]},{"embedding":[4,5,6]}]`, 3},
+		{`[{"embedding":[1,2,3]},{"embedding":[4,5]}]`, -1},
+		{`[{"embedding":"AAAAAA=="}]`, 1},
+		{`[{"index":0}]`, -1},
+		{`[]`, -1},
+	}
+	for _, tt := range tests {
+		if got := embeddingDims([]byte(tt.data)); got != tt.want {
+			t.Errorf("embeddingDims(%s) = %d, want %d", tt.data, got, tt.want)
+		}
+	}
+}
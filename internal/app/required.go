@@ -0,0 +1,52 @@
+package app
+
+import (
+	"fmt"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+// chatFieldSet reports, per ChatRequest JSON field name, whether a request
+// sets that field. Names outside this table can't be required.
+var chatFieldSet = map[string]func(*gateway.ChatRequest) bool{
+	"messages":          func(r *gateway.ChatRequest) bool { return len(r.Messages) > 0 },
+	"max_tokens":        func(r *gateway.ChatRequest) bool { return r.MaxTokens != nil },
+	"temperature":       func(r *gateway.ChatRequest) bool { return r.Temperature != nil },
+	"top_p":             func(r *gateway.ChatRequest) bool { return r.TopP != nil },
+	"stop":              func(r *gateway.ChatRequest) bool { return len(r.Stop) > 0 },
+	"presence_penalty":  func(r *gateway.ChatRequest) bool { return r.PresencePenalty != nil },
+	"frequency_penalty": func(r *gateway.ChatRequest) bool { return r.FrequencyPenalty != nil },
+	"seed":              func(r *gateway.ChatRequest) bool { return r.Seed != nil },
+	"user":              func(r *gateway.ChatRequest) bool { return r.User != "" },
+	"tools":             func(r *gateway.ChatRequest) bool { return len(r.Tools) > 0 },
+	"tool_choice":       func(r *gateway.ChatRequest) bool { return len(r.ToolChoice) > 0 },
+	"response_format":   func(r *gateway.ChatRequest) bool { return len(r.ResponseFormat) > 0 },
+}
+
+// IsChatField reports whether name is a ChatRequest field that providers
+// may require.
+func IsChatField(name string) bool {
+	_, ok := chatFieldSet[name]
+	return ok
+}
+
+// checkRequiredFields returns an ErrMissingField error naming the first
+// field the target's provider requires (declared by the provider or
+// configured on the registry) that req leaves unset.
+func (ps *ProxyService) checkRequiredFields(req *gateway.ChatRequest, providerID string, p gateway.Provider) error {
+	if rr, ok := p.(gateway.RequiredFieldsReporter); ok {
+		if err := missingField(req, providerID, rr.RequiredChatFields()); err != nil {
+			return err
+		}
+	}
+	return missingField(req, providerID, ps.providers.RequiredFields(providerID))
+}
+
+func missingField(req *gateway.ChatRequest, providerID string, fields []string) error {
+	for _, f := range fields {
+		if set, ok := chatFieldSet[f]; ok && !set(req) {
+			return fmt.Errorf("%w: %s is required by provider %s", gateway.ErrMissingField, f, providerID)
+		}
+	}
+	return nil
+}
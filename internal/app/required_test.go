@@ -0,0 +1,80 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
+	"github.com/eugener/gandalf/internal/testutil"
+)
+
+// requiringProvider declares required chat fields.
+type requiringProvider struct {
+	*testutil.FakeProvider
+	fields []string
+}
+
+func (p requiringProvider) RequiredChatFields() []string { return p.fields }
+
+func TestChatCompletion_RequiredFields(t *testing.T) {
+	t.Parallel()
+
+	var calls int
+	fp := &testutil.FakeProvider{
+		ProviderName: "anthropic",
+		ChatFn: func(context.Context, *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			calls++
+			return &gateway.ChatResponse{ID: "ok"}, nil
+		},
+	}
+	reg := provider.NewRegistry()
+	reg.Register("anthropic", requiringProvider{FakeProvider: fp, fields: []string{"messages", "max_tokens"}})
+	reg.Register("openai", &testutil.FakeProvider{ProviderName: "openai"})
+	reg.SetRequiredFields("openai", []string{"user"})
+
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:         "r-1",
+		ModelAlias: "claude",
+		Targets:    []byte(`[{"provider_id":"anthropic","model":"claude-sonnet-4-6","priority":1}]`),
+	})
+	store.AddRoute(&gateway.Route{
+		ID:         "r-2",
+		ModelAlias: "gpt-4o",
+		Targets:    []byte(`[{"provider_id":"openai","model":"gpt-4o","priority":1}]`),
+	})
+	ps := NewProxyService(reg, NewRouterService(store), nil, nil)
+
+	msgs := []gateway.Message{{Role: "user", Content: json.RawMessage(`"hi"`)}}
+	maxTok := 64
+	tests := []struct {
+		name    string
+		req     *gateway.ChatRequest
+		missing string // "" = expect success
+	}{
+		{"declared max_tokens missing", &gateway.ChatRequest{Model: "claude", Messages: msgs}, "max_tokens is required by provider anthropic"},
+		{"declared messages missing", &gateway.ChatRequest{Model: "claude", MaxTokens: &maxTok}, "messages is required by provider anthropic"},
+		{"declared fields present", &gateway.ChatRequest{Model: "claude", Messages: msgs, MaxTokens: &maxTok}, ""},
+		{"configured field missing", &gateway.ChatRequest{Model: "gpt-4o", Messages: msgs}, "user is required by provider openai"},
+		{"configured field present", &gateway.ChatRequest{Model: "gpt-4o", Messages: msgs, User: "u-1"}, ""},
+	}
+	for _, tt := range tests {
+		_, err := ps.ChatCompletion(context.Background(), tt.req)
+		if tt.missing == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, gateway.ErrMissingField) || !strings.Contains(err.Error(), tt.missing) {
+			t.Errorf("%s: err = %v, want ErrMissingField %q", tt.name, err, tt.missing)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("anthropic calls = %d, want 1 (rejected requests never reach the provider)", calls)
+	}
+}
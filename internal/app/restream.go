@@ -0,0 +1,111 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+// streamingCapability is the capability a target needs to be called with
+// ChatCompletionStream.
+var streamingCapability = []string{"streaming"}
+
+// restream answers a stream request from a provider that cannot stream: it
+// makes a non-streaming call and replays the response as a finished stream,
+// one chunk per choice, then usage and Done.
+func restream(ctx context.Context, p gateway.Provider, req *gateway.ChatRequest) (<-chan gateway.StreamChunk, error) {
+	call := *req
+	call.Stream, call.StreamOptions = false, nil
+	resp, err := p.ChatCompletion(ctx, &call)
+	if err != nil {
+		return nil, err
+	}
+	return replayStream(resp, req.StreamOptions != nil && req.StreamOptions.IncludeUsage), nil
+}
+
+// replayStream returns a closed, buffered channel carrying resp as stream
+// chunks (see ResponseChunks) followed by usage and Done.
+func replayStream(resp *gateway.ChatResponse, includeUsage bool) <-chan gateway.StreamChunk {
+	chunks := ResponseChunks(resp, includeUsage)
+	ch := make(chan gateway.StreamChunk, len(chunks)+1)
+	for _, data := range chunks {
+		ch <- gateway.StreamChunk{Data: data}
+	}
+	ch <- gateway.StreamChunk{Usage: resp.Usage, Done: true}
+	close(ch)
+	return ch
+}
+
+// ResponseChunks renders a complete chat response as chat.completion.chunk
+// payloads: one per choice carrying the whole message as its delta, then a
+// usage-only chunk when the client asked for one via stream_options.
+func ResponseChunks(resp *gateway.ChatResponse, includeUsage bool) [][]byte {
+	type delta struct {
+		Role      string          `json:"role,omitempty"`
+		Content   json.RawMessage `json:"content,omitempty"`
+		ToolCalls json.RawMessage `json:"tool_calls,omitempty"`
+	}
+	type choice struct {
+		Index        int     `json:"index"`
+		Delta        delta   `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	}
+	type chunk struct {
+		ID      string         `json:"id"`
+		Object  string         `json:"object"`
+		Created int64          `json:"created"`
+		Model   string         `json:"model"`
+		Choices []choice       `json:"choices"`
+		Usage   *gateway.Usage `json:"usage,omitempty"`
+	}
+
+	out := make([][]byte, 0, len(resp.Choices)+1)
+	for _, c := range resp.Choices {
+		d := delta{Role: c.Message.Role, Content: c.Message.Content, ToolCalls: indexToolCalls(c.Message.ToolCalls)}
+		if string(d.Content) == "null" {
+			d.Content = nil
+		}
+		ch := choice{Index: c.Index, Delta: d}
+		if c.FinishReason != "" {
+			ch.FinishReason = &c.FinishReason
+		}
+		data, err := json.Marshal(chunk{
+			ID: resp.ID, Object: "chat.completion.chunk", Created: resp.Created, Model: resp.Model,
+			Choices: []choice{ch},
+		})
+		if err == nil {
+			out = append(out, data)
+		}
+	}
+	if includeUsage && resp.Usage != nil {
+		data, err := json.Marshal(chunk{
+			ID: resp.ID, Object: "chat.completion.chunk", Created: resp.Created, Model: resp.Model,
+			Choices: []choice{}, Usage: resp.Usage,
+		})
+		if err == nil {
+			out = append(out, data)
+		}
+	}
+	return out
+}
+
+// indexToolCalls adds the "index" field stream deltas require to each tool
+// call of a complete message. Malformed input is returned unchanged.
+func indexToolCalls(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return nil
+	}
+	var calls []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &calls); err != nil {
+		return raw
+	}
+	for i, c := range calls {
+		c["index"], _ = json.Marshal(i)
+	}
+	data, err := json.Marshal(calls)
+	if err != nil {
+		return raw
+	}
+	return data
+}
@@ -3,13 +3,17 @@ package app
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"slices"
 	"time"
 
 	"github.com/maypok86/otter/v2"
 
 	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/jsonschema"
+	"github.com/eugener/gandalf/internal/provider"
 	"github.com/eugener/gandalf/internal/storage"
 )
 
@@ -17,9 +21,36 @@ import (
 // using the route store. Resolved targets are cached to avoid repeated
 // JSON unmarshalling on the hot path.
 type RouterService struct {
-	routeStore storage.RouteStore
-	cache      *otter.Cache[string, []ResolvedTarget]
-	ttlCache   *otter.Cache[string, time.Duration]
+	routeStore    storage.RouteStore
+	cache         *otter.Cache[string, []ResolvedTarget]
+	settingsCache *otter.Cache[string, routeSettings]
+
+	// normalizeModels retries unmatched names lowercased and without a
+	// version suffix. Off by default so exact-name deployments are unaffected.
+	normalizeModels bool
+
+	// balanced reorders targets of "balanced" routes per request. nil =
+	// such routes fall back to priority order.
+	balanced *BalancedScorer
+
+	// upstream moves targets whose provider reports little rate-limit
+	// budget left behind the others. nil = upstream limits are ignored.
+	upstream *provider.UpstreamLimits
+}
+
+// routeSettings holds per-route request settings that are looked up on the
+// hot path. Cached separately from targets because a missing route still
+// yields valid (zero) settings.
+type routeSettings struct {
+	alias               string // the matched route's alias; "" = no route
+	cacheTTL            time.Duration
+	defaultTemperature  *float64
+	embeddingDimensions int
+	strategy            string
+	deniedTools         []string
+	cacheStopOnly       bool
+	responseSchema      *jsonschema.Schema
+	schemaPolicy        string
 }
 
 // NewRouterService returns a RouterService backed by the given route store.
@@ -28,11 +59,37 @@ func NewRouterService(routes storage.RouteStore) *RouterService {
 		MaximumSize:      256,
 		ExpiryCalculator: otter.ExpiryWriting[string, []ResolvedTarget](routeCacheTTL),
 	})
-	ttlCache := otter.Must(&otter.Options[string, time.Duration]{
+	settingsCache := otter.Must(&otter.Options[string, routeSettings]{
 		MaximumSize:      256,
-		ExpiryCalculator: otter.ExpiryWriting[string, time.Duration](routeCacheTTL),
+		ExpiryCalculator: otter.ExpiryWriting[string, routeSettings](routeCacheTTL),
 	})
-	return &RouterService{routeStore: routes, cache: cache, ttlCache: ttlCache}
+	return &RouterService{routeStore: routes, cache: cache, settingsCache: settingsCache}
+}
+
+// SetModelNormalization enables fallback lookup of model names that don't
+// match an alias exactly: "GPT-4o" and "gpt-4o-2024-08-06" then resolve to
+// the "gpt-4o" route. An exact alias always wins. Call before serving.
+func (rs *RouterService) SetModelNormalization(on bool) {
+	rs.normalizeModels = on
+}
+
+// SetBalancedScorer enables the "balanced" route strategy. Call before serving.
+func (rs *RouterService) SetBalancedScorer(s *BalancedScorer) {
+	rs.balanced = s
+}
+
+// SetUpstreamLimits enables adaptive throttling: targets whose provider is
+// near its own rate limit (see provider.UpstreamLimits) are tried after the
+// route's other targets. Call before serving.
+func (rs *RouterService) SetUpstreamLimits(l *provider.UpstreamLimits) {
+	rs.upstream = l
+}
+
+// observeLatency records a successful upstream call for balanced scoring.
+func (rs *RouterService) observeLatency(providerID, model string, d time.Duration) {
+	if rs.balanced != nil {
+		rs.balanced.latency.Observe(providerID, model, d)
+	}
 }
 
 // routeCacheTTL is how long resolved targets stay cached before re-reading
@@ -48,14 +105,85 @@ type ResolvedTarget struct {
 }
 
 // ResolveModel maps a model alias to an ordered list of targets sorted by
-// priority (ascending). Returns an error if no route is found for the model.
-// Results are cached to avoid per-request JSON parsing.
+// priority (ascending). Targets on the calling key's preferred providers
+// come first, in the key's order. Targets whose provider is near its
+// upstream rate limit move to the end, keeping their relative order.
+// Returns an error if no route is found for the model. Results are cached
+// to avoid per-request JSON parsing.
 func (rs *RouterService) ResolveModel(ctx context.Context, model string) ([]ResolvedTarget, error) {
+	targets, err := rs.resolveTargets(ctx, model)
+	if err != nil || len(targets) < 2 {
+		return targets, err
+	}
+	if rs.balanced != nil && rs.settings(ctx, model).strategy == StrategyBalanced {
+		targets = rs.balanced.Order(targets)
+	}
+	if id := gateway.IdentityFromContext(ctx); id != nil && len(id.PreferredProviders) > 0 {
+		targets = preferProviders(targets, id.PreferredProviders)
+	}
+	return rs.deprioritizeConstrained(targets), nil
+}
+
+// preferProviders returns targets with those on a preferred provider first,
+// in preferred order, then the rest in their existing order. The cached
+// slice is never modified.
+func preferProviders(targets []ResolvedTarget, preferred []string) []ResolvedTarget {
+	out := make([]ResolvedTarget, 0, len(targets))
+	for _, p := range preferred {
+		for _, t := range targets {
+			if t.ProviderID == p {
+				out = append(out, t)
+			}
+		}
+	}
+	if len(out) == 0 {
+		return targets
+	}
+	for _, t := range targets {
+		if !slices.Contains(preferred, t.ProviderID) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// deprioritizeConstrained returns targets with those whose provider is near
+// its upstream rate limit moved last. The cached slice is never modified.
+func (rs *RouterService) deprioritizeConstrained(targets []ResolvedTarget) []ResolvedTarget {
+	if rs.upstream == nil {
+		return targets
+	}
+	constrained := make([]bool, len(targets))
+	n := 0
+	for i, t := range targets {
+		if constrained[i] = rs.upstream.Constrained(t.ProviderID); constrained[i] {
+			n++
+		}
+	}
+	if n == 0 || n == len(targets) {
+		return targets
+	}
+	out := make([]ResolvedTarget, 0, len(targets))
+	for i, t := range targets {
+		if !constrained[i] {
+			out = append(out, t)
+		}
+	}
+	for i, t := range targets {
+		if constrained[i] {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// resolveTargets returns the route's targets in priority order.
+func (rs *RouterService) resolveTargets(ctx context.Context, model string) ([]ResolvedTarget, error) {
 	if cached, ok := rs.cache.GetIfPresent(model); ok {
 		return cached, nil
 	}
 
-	route, err := rs.routeStore.GetRouteByAlias(ctx, model)
+	route, err := rs.lookupRoute(ctx, model)
 	if err != nil {
 		// Wrap with %w to preserve original error (e.g. ErrNotFound) for callers.
 		return nil, fmt.Errorf("resolve model %q: %w", model, err)
@@ -91,14 +219,113 @@ func (rs *RouterService) ResolveModel(ctx context.Context, model string) ([]Reso
 // or 0 if no route or no TTL is configured. Results are cached to avoid
 // per-request DB queries on cache-eligible requests.
 func (rs *RouterService) CacheTTL(ctx context.Context, model string) time.Duration {
-	if ttl, ok := rs.ttlCache.GetIfPresent(model); ok {
-		return ttl
+	return rs.settings(ctx, model).cacheTTL
+}
+
+// DefaultTemperature returns the route-configured default temperature for a
+// model alias, or nil if no route or no default is configured.
+func (rs *RouterService) DefaultTemperature(ctx context.Context, model string) *float64 {
+	return rs.settings(ctx, model).defaultTemperature
+}
+
+// EmbeddingDimensions returns the route-configured expected embedding size
+// for a model alias, or 0 if no check is configured.
+func (rs *RouterService) EmbeddingDimensions(ctx context.Context, model string) int {
+	return rs.settings(ctx, model).embeddingDimensions
+}
+
+// DeniedTools returns the route-configured tool names that requests for a
+// model alias may not declare, or nil if every tool is allowed.
+func (rs *RouterService) DeniedTools(ctx context.Context, model string) []string {
+	return rs.settings(ctx, model).deniedTools
+}
+
+// PolicyModels returns the names a request for model goes by, for model
+// policy checks. names holds the requested name, its normalized forms (see
+// SetModelNormalization), and the alias of the route it resolves to;
+// targets holds that route's target models. Both come from the route
+// caches, so the check adds no store reads on the hot path.
+func (rs *RouterService) PolicyModels(ctx context.Context, model string) (names, targets []string) {
+	names = modelCandidates(model)
+	if alias := rs.settings(ctx, model).alias; alias != "" && !slices.Contains(names, alias) {
+		names = append(names, alias)
+	}
+	resolved, _ := rs.resolveTargets(ctx, model)
+	for _, t := range resolved {
+		if !slices.Contains(targets, t.Model) {
+			targets = append(targets, t.Model)
+		}
 	}
-	var ttl time.Duration
+	return names, targets
+}
+
+// CacheStopOnly reports whether the route for a model alias caches only
+// responses that finished with "stop".
+func (rs *RouterService) CacheStopOnly(ctx context.Context, model string) bool {
+	return rs.settings(ctx, model).cacheStopOnly
+}
+
+// ResponseSchema returns the compiled response schema for a model alias and
+// its violation policy, or nil if responses are not checked.
+func (rs *RouterService) ResponseSchema(ctx context.Context, model string) (*jsonschema.Schema, string) {
+	st := rs.settings(ctx, model)
+	return st.responseSchema, st.schemaPolicy
+}
+
+// settings returns the cached per-route settings for a model alias,
+// reading through to the route store on a miss.
+func (rs *RouterService) settings(ctx context.Context, model string) routeSettings {
+	if st, ok := rs.settingsCache.GetIfPresent(model); ok {
+		return st
+	}
+	var st routeSettings
+	route, err := rs.lookupRoute(ctx, model)
+	if err != nil && !errors.Is(err, gateway.ErrNotFound) {
+		// A store failure is not a missing route; caching it would drop the
+		// route's settings until the entry expires.
+		return st
+	}
+	if err == nil {
+		st.alias = route.ModelAlias
+		if route.CacheTTLs > 0 {
+			st.cacheTTL = time.Duration(route.CacheTTLs) * time.Second
+		}
+		st.defaultTemperature = route.DefaultTemperature
+		st.embeddingDimensions = route.EmbeddingDimensions
+		st.strategy = route.Strategy
+		st.deniedTools = route.DeniedTools
+		st.cacheStopOnly = route.CacheStopOnly
+		if len(route.ResponseSchema) > 0 && string(route.ResponseSchema) != "null" {
+			// Schemas are checked when a route is written; one that still
+			// fails here is left unenforced rather than failing every request.
+			if st.responseSchema, err = jsonschema.Compile(route.ResponseSchema); err != nil {
+				slog.LogAttrs(ctx, slog.LevelError, "invalid route response schema, not enforced",
+					slog.String("model", model),
+					slog.String("error", err.Error()),
+				)
+			}
+			st.schemaPolicy = route.SchemaPolicy
+		}
+	}
+	rs.settingsCache.Set(model, st)
+	return st
+}
+
+// lookupRoute fetches the route for model. With normalization enabled, a
+// not-found exact name is retried as each of its normalized candidates.
+func (rs *RouterService) lookupRoute(ctx context.Context, model string) (*gateway.Route, error) {
 	route, err := rs.routeStore.GetRouteByAlias(ctx, model)
-	if err == nil && route.CacheTTLs > 0 {
-		ttl = time.Duration(route.CacheTTLs) * time.Second
+	if !rs.normalizeModels || !errors.Is(err, gateway.ErrNotFound) {
+		return route, err
+	}
+	for _, name := range modelCandidates(model)[1:] {
+		r, nerr := rs.routeStore.GetRouteByAlias(ctx, name)
+		if nerr == nil {
+			return r, nil
+		}
+		if !errors.Is(nerr, gateway.ErrNotFound) {
+			return nil, nerr
+		}
 	}
-	rs.ttlCache.Set(model, ttl)
-	return ttl
+	return nil, err
 }
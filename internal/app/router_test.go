@@ -2,9 +2,16 @@ package app
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
+	"github.com/eugener/gandalf/internal/storage"
 	"github.com/eugener/gandalf/internal/testutil"
 )
 
@@ -65,3 +72,191 @@ func TestResolveModel_EmptyTargets(t *testing.T) {
 		t.Fatal("expected error for empty targets")
 	}
 }
+
+func TestRouteSettings(t *testing.T) {
+	t.Parallel()
+
+	temp := 0.2
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:                 "r-3",
+		ModelAlias:         "gpt-4o",
+		Targets:            []byte(`[{"provider_id":"openai","model":"gpt-4o","priority":1}]`),
+		Strategy:           "priority",
+		CacheTTLs:          60,
+		DefaultTemperature: &temp,
+	})
+
+	rs := NewRouterService(store)
+	ctx := context.Background()
+
+	if ttl := rs.CacheTTL(ctx, "gpt-4o"); ttl != 60*time.Second {
+		t.Errorf("CacheTTL = %v, want 60s", ttl)
+	}
+	got := rs.DefaultTemperature(ctx, "gpt-4o")
+	if got == nil || *got != 0.2 {
+		t.Errorf("DefaultTemperature = %v, want 0.2", got)
+	}
+
+	// Unrouted model yields zero settings.
+	if ttl := rs.CacheTTL(ctx, "unknown"); ttl != 0 {
+		t.Errorf("CacheTTL(unknown) = %v, want 0", ttl)
+	}
+	if got := rs.DefaultTemperature(ctx, "unknown"); got != nil {
+		t.Errorf("DefaultTemperature(unknown) = %v, want nil", *got)
+	}
+}
+
+// failingRouteStore fails alias lookups while fail is set.
+type failingRouteStore struct {
+	storage.RouteStore
+	fail atomic.Bool
+}
+
+func (s *failingRouteStore) GetRouteByAlias(ctx context.Context, alias string) (*gateway.Route, error) {
+	if s.fail.Load() {
+		return nil, errors.New("database is locked")
+	}
+	return s.RouteStore.GetRouteByAlias(ctx, alias)
+}
+
+func TestRouteSettings_StoreErrorNotCached(t *testing.T) {
+	t.Parallel()
+
+	fake := testutil.NewFakeStore()
+	fake.AddRoute(&gateway.Route{
+		ID:         "r-4",
+		ModelAlias: "gpt-4o",
+		Targets:    []byte(`[{"provider_id":"openai","model":"gpt-4o","priority":1}]`),
+		Strategy:   "priority",
+		CacheTTLs:  60,
+	})
+	store := &failingRouteStore{RouteStore: fake}
+	rs := NewRouterService(store)
+	ctx := context.Background()
+
+	store.fail.Store(true)
+	if ttl := rs.CacheTTL(ctx, "gpt-4o"); ttl != 0 {
+		t.Errorf("CacheTTL during store error = %v, want 0", ttl)
+	}
+	store.fail.Store(false)
+	if ttl := rs.CacheTTL(ctx, "gpt-4o"); ttl != 60*time.Second {
+		t.Errorf("CacheTTL after store recovers = %v, want 60s", ttl)
+	}
+}
+
+func TestResolveModel_Normalization(t *testing.T) {
+	t.Parallel()
+
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:         "r-1",
+		ModelAlias: "gpt-4o",
+		Targets:    []byte(`[{"provider_id":"openai","model":"gpt-4o","priority":1}]`),
+		CacheTTLs:  60,
+	})
+	store.AddRoute(&gateway.Route{
+		ID:         "r-2",
+		ModelAlias: "gpt-4o-2024-05-13",
+		Targets:    []byte(`[{"provider_id":"azure","model":"gpt-4o-2024-05-13","priority":1}]`),
+	})
+	ctx := context.Background()
+
+	exact := NewRouterService(store)
+	if _, err := exact.ResolveModel(ctx, "GPT-4o"); err == nil {
+		t.Error("GPT-4o resolved with normalization disabled, want error")
+	}
+
+	rs := NewRouterService(store)
+	rs.SetModelNormalization(true)
+	for _, model := range []string{"GPT-4o", " gpt-4o ", "gpt-4o-2024-08-06", "GPT-4o-2024-08-06"} {
+		targets, err := rs.ResolveModel(ctx, model)
+		if err != nil {
+			t.Errorf("ResolveModel(%q): %v", model, err)
+			continue
+		}
+		if targets[0].ProviderID != "openai" {
+			t.Errorf("ResolveModel(%q) provider = %q, want openai", model, targets[0].ProviderID)
+		}
+	}
+	if ttl := rs.CacheTTL(ctx, "GPT-4o"); ttl != time.Minute {
+		t.Errorf("CacheTTL(GPT-4o) = %v, want 1m", ttl)
+	}
+
+	// An exact alias wins over its normalized form.
+	targets, err := rs.ResolveModel(ctx, "gpt-4o-2024-05-13")
+	if err != nil || targets[0].ProviderID != "azure" {
+		t.Errorf("exact dated alias = %v, %v; want azure target", targets, err)
+	}
+}
+
+func TestResolveModel_DeprioritizesConstrainedProviders(t *testing.T) {
+	t.Parallel()
+
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:         "r-1",
+		ModelAlias: "chat",
+		Targets:    []byte(`[{"provider_id":"openai","model":"gpt-4o","priority":1},{"provider_id":"anthropic","model":"claude-sonnet-4-6","priority":2},{"provider_id":"gemini","model":"gemini-2.5-pro","priority":3}]`),
+		Strategy:   "priority",
+	})
+	limits := provider.NewUpstreamLimits(0)
+	rs := NewRouterService(store)
+	rs.SetUpstreamLimits(limits)
+
+	order := func() []string {
+		targets, err := rs.ResolveModel(context.Background(), "chat")
+		if err != nil {
+			t.Fatalf("ResolveModel: %v", err)
+		}
+		ids := make([]string, len(targets))
+		for i, t := range targets {
+			ids[i] = t.ProviderID
+		}
+		return ids
+	}
+
+	if got := order(); !slices.Equal(got, []string{"openai", "anthropic", "gemini"}) {
+		t.Fatalf("order = %v, want priority order", got)
+	}
+
+	// OpenAI reports 2% of its request budget left.
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+	resp.Header.Set("x-ratelimit-limit-requests", "100")
+	resp.Header.Set("x-ratelimit-remaining-requests", "2")
+	resp.Header.Set("x-ratelimit-reset-requests", "30s")
+	limits.Observe("openai", resp)
+	if got := order(); !slices.Equal(got, []string{"anthropic", "gemini", "openai"}) {
+		t.Errorf("order = %v, want openai last", got)
+	}
+
+	// Once every provider is constrained, priority order applies again.
+	limits.Observe("anthropic", resp)
+	limits.Observe("gemini", resp)
+	if got := order(); !slices.Equal(got, []string{"openai", "anthropic", "gemini"}) {
+		t.Errorf("order = %v, want priority order", got)
+	}
+}
+
+func TestPreferProviders(t *testing.T) {
+	t.Parallel()
+	targets := []ResolvedTarget{
+		{ProviderID: "a", Model: "m1"},
+		{ProviderID: "b", Model: "m1"},
+		{ProviderID: "c", Model: "m1"},
+		{ProviderID: "b", Model: "m2"},
+	}
+	got := preferProviders(targets, []string{"c", "b"})
+	want := []ResolvedTarget{
+		{ProviderID: "c", Model: "m1"},
+		{ProviderID: "b", Model: "m1"},
+		{ProviderID: "b", Model: "m2"},
+		{ProviderID: "a", Model: "m1"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("preferProviders = %v, want %v", got, want)
+	}
+	if targets[0].ProviderID != "a" {
+		t.Error("preferProviders modified its input")
+	}
+}
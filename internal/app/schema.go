@@ -0,0 +1,50 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/jsonschema"
+	"github.com/eugener/gandalf/internal/provider"
+)
+
+// outcomeSchema marks a debug attempt whose response broke the route's
+// response schema and was retried.
+const outcomeSchema = "schema_violation"
+
+// schemaRetries is how many extra attempts the retry policy makes before
+// rejecting. Like empty retries, each fails over to the next target and the
+// last target is retried itself.
+const schemaRetries = 2
+
+// checkResponseSchema validates the text content of every choice against
+// schema. Choices that only carry tool calls are skipped: they are a step
+// in a conversation, not the final answer.
+func checkResponseSchema(schema *jsonschema.Schema, resp *gateway.ChatResponse) error {
+	for i, c := range resp.Choices {
+		text := provider.ContentText(c.Message.Content)
+		if text == "" && len(c.Message.ToolCalls) > 0 {
+			continue
+		}
+		if err := schema.ValidateJSON([]byte(text)); err != nil {
+			return fmt.Errorf("choice %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// schemaRetry reports whether a schema violation should be retried under
+// policy, logging the decision. retried is the number of retries so far.
+func schemaRetry(ctx context.Context, policy string, retried int, providerID string, err error) bool {
+	if policy != gateway.SchemaRetry || retried >= schemaRetries {
+		return false
+	}
+	slog.LogAttrs(ctx, slog.LevelWarn, "response does not match route schema, retrying",
+		slog.String("provider", providerID),
+		slog.Int("retry", retried+1),
+		slog.String("error", err.Error()),
+	)
+	return true
+}
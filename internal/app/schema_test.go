@@ -0,0 +1,121 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
+	"github.com/eugener/gandalf/internal/testutil"
+)
+
+const ticketSchema = `{"type":"object","required":["priority"],"properties":{"priority":{"enum":["low","high"]}}}`
+
+// schemaProxy serves alias "tickets" from one provider whose first bad
+// calls return content breaking ticketSchema.
+func schemaProxy(policy string, bad int32, calls *atomic.Int32) *ProxyService {
+	reg := provider.NewRegistry()
+	reg.Register("openai", &testutil.FakeProvider{
+		ProviderName: "openai",
+		ChatFn: func(context.Context, *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			if calls.Add(1) <= bad {
+				return completion("bad", `"{\"priority\":\"urgent\"}"`), nil
+			}
+			return completion("good", `"{\"priority\":\"high\"}"`), nil
+		},
+	})
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:             "r-1",
+		ModelAlias:     "tickets",
+		Targets:        []byte(`[{"provider_id":"openai","model":"gpt-4o","priority":1}]`),
+		Strategy:       "priority",
+		ResponseSchema: []byte(ticketSchema),
+		SchemaPolicy:   policy,
+	})
+	return NewProxyService(reg, NewRouterService(store), nil, nil)
+}
+
+func TestChatCompletion_ResponseSchema(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		policy        string
+		bad           int32 // calls that break the schema
+		wantCalls     int32
+		wantID        string // "" = ErrSchemaViolation
+		wantAnnotated bool
+	}{
+		{"conforming", gateway.SchemaReject, 0, 1, "good", false},
+		{"reject", "", 1, 1, "", false},
+		{"retry succeeds", gateway.SchemaRetry, 2, 3, "good", false},
+		{"retry exhausted", gateway.SchemaRetry, 10, 3, "", false},
+		{"annotate", gateway.SchemaAnnotate, 1, 1, "bad", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var calls atomic.Int32
+			ps := schemaProxy(tt.policy, tt.bad, &calls)
+			ctx := gateway.ContextWithRequestID(context.Background(), "req-1")
+
+			resp, err := ps.ChatCompletion(ctx, &gateway.ChatRequest{Model: "tickets"})
+			if tt.wantID == "" {
+				if !errors.Is(err, gateway.ErrSchemaViolation) {
+					t.Fatalf("err = %v, want ErrSchemaViolation", err)
+				}
+			} else if err != nil {
+				t.Fatalf("ChatCompletion: %v", err)
+			} else if resp.ID != tt.wantID {
+				t.Errorf("id = %q, want %q", resp.ID, tt.wantID)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+			if got := gateway.SchemaViolationFromContext(ctx) != ""; got != tt.wantAnnotated {
+				t.Errorf("annotated = %v, want %v", got, tt.wantAnnotated)
+			}
+		})
+	}
+}
+
+func TestChatCompletionStream_ResponseSchemaReplayed(t *testing.T) {
+	t.Parallel()
+	var calls atomic.Int32
+	ps := schemaProxy(gateway.SchemaReject, 1, &calls)
+
+	// A stream request cannot bypass the schema: the violation is reported
+	// before any chunk is sent.
+	if _, err := ps.ChatCompletionStream(context.Background(), &gateway.ChatRequest{Model: "tickets", Stream: true}); !errors.Is(err, gateway.ErrSchemaViolation) {
+		t.Fatalf("err = %v, want ErrSchemaViolation", err)
+	}
+
+	ch, err := ps.ChatCompletionStream(context.Background(), &gateway.ChatRequest{Model: "tickets", Stream: true})
+	if err != nil {
+		t.Fatalf("ChatCompletionStream: %v", err)
+	}
+	var chunks int
+	for c := range ch {
+		if c.Done {
+			break
+		}
+		chunks++
+	}
+	if chunks != 1 {
+		t.Errorf("got %d data chunks, want the conforming response replayed as 1", chunks)
+	}
+}
+
+func TestCheckResponseSchema_SkipsToolCalls(t *testing.T) {
+	t.Parallel()
+	ps := schemaProxy(gateway.SchemaReject, 0, new(atomic.Int32))
+	schema, _ := ps.router.ResponseSchema(context.Background(), "tickets")
+	resp := completion("tools", `null`)
+	resp.Choices[0].Message.ToolCalls = []byte(`[{"id":"c1","type":"function","function":{"name":"f","arguments":"{}"}}]`)
+	if err := checkResponseSchema(schema, resp); err != nil {
+		t.Errorf("tool-call choice checked against the schema: %v", err)
+	}
+}
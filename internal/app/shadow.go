@@ -0,0 +1,176 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
+	"github.com/eugener/gandalf/internal/storage"
+)
+
+// Capture labels for EvalCapture.Label.
+const (
+	LabelPrimary = "primary"
+	LabelShadow  = "shadow"
+)
+
+// shadowTimeout bounds the background fan-out for one sampled request.
+const shadowTimeout = 60 * time.Second
+
+// ShadowEvaluator fans a sampled fraction of chat completions out to extra
+// provider targets and stores every response, labeled, for offline quality
+// comparison. The client only sees the primary response; shadow calls run in
+// the background after it has been served.
+type ShadowEvaluator struct {
+	providers *provider.Registry
+	store     storage.EvalCaptureStore
+	rate      float64
+	targets   []gateway.RouteTarget
+	models    map[string]bool // nil = every model alias
+	redactor  captureRedactor
+	random    func() float64
+	wg        sync.WaitGroup
+}
+
+// NewShadowEvaluator samples rate (0..1) of requests for the given model
+// aliases (empty = all) and replays them against targets. Stored content is
+// redacted as EvalSampler redacts it, with redactor when set.
+func NewShadowEvaluator(providers *provider.Registry, store storage.EvalCaptureStore, rate float64, targets []gateway.RouteTarget, models []string, redactor *OutputFilter) *ShadowEvaluator {
+	e := &ShadowEvaluator{
+		providers: providers,
+		store:     store,
+		rate:      rate,
+		targets:   targets,
+		redactor:  newCaptureRedactor(redactor),
+		random:    rand.Float64,
+	}
+	if len(models) > 0 {
+		e.models = make(map[string]bool, len(models))
+		for _, m := range models {
+			e.models[m] = true
+		}
+	}
+	return e
+}
+
+// Observe decides whether a served non-streaming request is sampled and, if
+// so, captures the primary response and starts the shadow calls. req.Model
+// is the client's alias; the primary provider and model come from ctx (see
+// gateway.SetRequestTarget). Observe does not block on the shadows.
+func (e *ShadowEvaluator) Observe(ctx context.Context, req *gateway.ChatRequest, resp *gateway.ChatResponse, latency time.Duration) {
+	if e.models != nil && !e.models[req.Model] {
+		return
+	}
+	if e.random() >= e.rate {
+		return
+	}
+
+	reqJSON, err := json.Marshal(e.redactor.request(req))
+	if err != nil {
+		return
+	}
+	respJSON, _ := json.Marshal(e.redactor.response(resp))
+	primaryProvider, primaryModel := gateway.RequestTargetFromContext(ctx)
+	groupID := uuid.Must(uuid.NewV7()).String()
+	requestID := gateway.RequestIDFromContext(ctx)
+	orgID := captureOrg(ctx)
+	primary := gateway.EvalCapture{
+		ID:         uuid.Must(uuid.NewV7()).String(),
+		GroupID:    groupID,
+		RequestID:  requestID,
+		OrgID:      orgID,
+		Label:      LabelPrimary,
+		ProviderID: primaryProvider,
+		Model:      primaryModel,
+		Request:    reqJSON,
+		Response:   respJSON,
+		LatencyMs:  int(latency.Milliseconds()),
+		CreatedAt:  time.Now(),
+	}
+
+	// Copy the request: the caller's value may be reused once the handler returns.
+	shadowReq := *req
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shadowTimeout)
+		defer cancel()
+
+		captures := []gateway.EvalCapture{primary}
+		captures = append(captures, e.runShadows(ctx, &shadowReq, primaryProvider, primaryModel)...)
+		for i := 1; i < len(captures); i++ {
+			captures[i].GroupID = groupID
+			captures[i].RequestID = requestID
+			captures[i].OrgID = orgID
+			captures[i].Request = reqJSON
+		}
+		if err := e.store.SaveEvalCaptures(ctx, captures); err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "shadow eval: save captures failed",
+				slog.String("group_id", groupID),
+				slog.String("error", err.Error()),
+			)
+		}
+	}()
+}
+
+// runShadows calls every shadow target concurrently, skipping the one that
+// served the primary response.
+func (e *ShadowEvaluator) runShadows(ctx context.Context, req *gateway.ChatRequest, primaryProvider, primaryModel string) []gateway.EvalCapture {
+	captures := make([]gateway.EvalCapture, 0, len(e.targets))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, target := range e.targets {
+		if target.ProviderID == primaryProvider && target.Model == primaryModel {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := e.callShadow(ctx, *req, target)
+			mu.Lock()
+			captures = append(captures, c)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return captures
+}
+
+// callShadow sends req (a copy) to one target and records the outcome.
+func (e *ShadowEvaluator) callShadow(ctx context.Context, req gateway.ChatRequest, target gateway.RouteTarget) gateway.EvalCapture {
+	c := gateway.EvalCapture{
+		ID:         uuid.Must(uuid.NewV7()).String(),
+		Label:      LabelShadow,
+		ProviderID: target.ProviderID,
+		Model:      target.Model,
+		CreatedAt:  time.Now(),
+	}
+	p, err := e.providers.Get(target.ProviderID)
+	if err != nil {
+		c.Error = err.Error()
+		return c
+	}
+	req = *stripUnsupportedParams(ctx, &req, e.providers, target.ProviderID, p)
+	req.Model = target.Model
+	start := time.Now()
+	resp, err := p.ChatCompletion(ctx, &req)
+	c.LatencyMs = int(time.Since(start).Milliseconds())
+	if err != nil {
+		c.Error = err.Error()
+		return c
+	}
+	c.Response, _ = json.Marshal(e.redactor.response(resp))
+	return c
+}
+
+// Wait blocks until in-flight shadow calls have been stored. Call on shutdown.
+func (e *ShadowEvaluator) Wait() {
+	e.wg.Wait()
+}
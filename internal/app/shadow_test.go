@@ -0,0 +1,110 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
+	"github.com/eugener/gandalf/internal/testutil"
+)
+
+func shadowTestRegistry() *provider.Registry {
+	reg := provider.NewRegistry()
+	reg.Register("anthropic", &testutil.FakeProvider{
+		ProviderName: "anthropic",
+		ChatFn: func(_ context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			return &gateway.ChatResponse{ID: "shadow-resp", Model: req.Model}, nil
+		},
+	})
+	reg.Register("broken", &testutil.FakeProvider{
+		ProviderName: "broken",
+		ChatFn: func(context.Context, *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			return nil, errors.New("upstream 500")
+		},
+	})
+	return reg
+}
+
+func TestShadowEvaluator_CapturesPrimaryAndShadows(t *testing.T) {
+	t.Parallel()
+	store := testutil.NewFakeStore()
+	e := NewShadowEvaluator(shadowTestRegistry(), store, 1, []gateway.RouteTarget{
+		{ProviderID: "openai", Model: "gpt-4o"}, // the primary itself: skipped
+		{ProviderID: "anthropic", Model: "claude-sonnet-4-6"},
+		{ProviderID: "broken", Model: "x"},
+	}, nil, nil)
+
+	ctx := gateway.ContextWithRequestID(context.Background(), "req-1")
+	gateway.SetRequestTarget(ctx, "openai", "gpt-4o")
+	req := &gateway.ChatRequest{Model: "gpt-4o", Messages: []gateway.Message{{Role: "user", Content: json.RawMessage(`"hi"`)}}}
+	e.Observe(ctx, req, &gateway.ChatResponse{ID: "primary-resp"}, 20*time.Millisecond)
+	e.Wait()
+
+	captures := store.EvalCaptures()
+	if len(captures) != 3 {
+		t.Fatalf("captures = %d, want 3 (primary + 2 shadows)", len(captures))
+	}
+	byProvider := map[string]gateway.EvalCapture{}
+	for _, c := range captures {
+		if c.GroupID != captures[0].GroupID || c.RequestID != "req-1" {
+			t.Errorf("%s: group/request = %q/%q, want shared group and req-1", c.ProviderID, c.GroupID, c.RequestID)
+		}
+		if string(c.Request) == "" {
+			t.Errorf("%s: request not captured", c.ProviderID)
+		}
+		byProvider[c.ProviderID] = c
+	}
+
+	p := byProvider["openai"]
+	var primaryResp gateway.ChatResponse
+	_ = json.Unmarshal(p.Response, &primaryResp)
+	if p.Label != LabelPrimary || p.LatencyMs != 20 || primaryResp.ID != "primary-resp" {
+		t.Errorf("primary capture = %+v (response %s)", p, p.Response)
+	}
+	if s := byProvider["anthropic"]; s.Label != LabelShadow || s.Model != "claude-sonnet-4-6" || s.Error != "" {
+		t.Errorf("shadow capture = %+v", s)
+	}
+	if s := byProvider["broken"]; s.Error != "upstream 500" || s.Response != nil {
+		t.Errorf("failed shadow capture = %+v", s)
+	}
+	if req.Model != "gpt-4o" {
+		t.Errorf("caller request model changed to %q", req.Model)
+	}
+}
+
+func TestShadowEvaluator_Sampling(t *testing.T) {
+	t.Parallel()
+	targets := []gateway.RouteTarget{{ProviderID: "anthropic", Model: "claude-sonnet-4-6"}}
+	req := &gateway.ChatRequest{Model: "gpt-4o"}
+
+	// Above the sample rate: not captured.
+	store := testutil.NewFakeStore()
+	e := NewShadowEvaluator(shadowTestRegistry(), store, 0.1, targets, nil, nil)
+	e.random = func() float64 { return 0.5 }
+	e.Observe(context.Background(), req, &gateway.ChatResponse{}, 0)
+	e.Wait()
+	if n := len(store.EvalCaptures()); n != 0 {
+		t.Errorf("unsampled request captured %d rows", n)
+	}
+
+	// Model not in the sampled set: not captured.
+	e = NewShadowEvaluator(shadowTestRegistry(), store, 1, targets, []string{"gpt-4o-mini"}, nil)
+	e.Observe(context.Background(), req, &gateway.ChatResponse{}, 0)
+	e.Wait()
+	if n := len(store.EvalCaptures()); n != 0 {
+		t.Errorf("unsampled model captured %d rows", n)
+	}
+
+	// Below the rate: captured.
+	e = NewShadowEvaluator(shadowTestRegistry(), store, 0.1, targets, []string{"gpt-4o"}, nil)
+	e.random = func() float64 { return 0.05 }
+	e.Observe(context.Background(), req, &gateway.ChatResponse{}, 0)
+	e.Wait()
+	if n := len(store.EvalCaptures()); n != 2 {
+		t.Errorf("sampled request captured %d rows, want 2", n)
+	}
+}
@@ -0,0 +1,221 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+// ApplyStopSequences cuts each choice's text content at the earliest
+// occurrence of any sequence in stop (the request's OpenAI "stop" value) and
+// sets finish_reason to "stop". Providers that honor stop natively never
+// return the sequence, so this only changes output from those that don't,
+// and it gives aggregated streams the same result as non-streaming calls.
+func ApplyStopSequences(resp *gateway.ChatResponse, stop json.RawMessage) {
+	if resp == nil || len(stop) == 0 {
+		return
+	}
+	seqs := stopSequences(stop)
+	if len(seqs) == 0 {
+		return
+	}
+	for i := range resp.Choices {
+		c := &resp.Choices[i]
+		var text string
+		if len(c.Message.Content) == 0 || c.Message.Content[0] != '"' ||
+			json.Unmarshal(c.Message.Content, &text) != nil {
+			continue // null or multi-part content
+		}
+		cut := firstStop(text, seqs)
+		if cut < 0 {
+			continue
+		}
+		c.Message.Content, _ = json.Marshal(text[:cut])
+		c.FinishReason = "stop"
+	}
+}
+
+// stopSequences decodes a stop value, which is a string or an array of
+// strings. Empty sequences are dropped.
+func stopSequences(raw json.RawMessage) []string {
+	var one string
+	if json.Unmarshal(raw, &one) == nil {
+		if one == "" {
+			return nil
+		}
+		return []string{one}
+	}
+	var many []string
+	if json.Unmarshal(raw, &many) != nil {
+		return nil
+	}
+	out := many[:0]
+	for _, s := range many {
+		if s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// trimStream cuts a live stream at the earliest request stop sequence, for
+// providers that don't honor stop natively. Text that could be the start of
+// a sequence is held back until the next chunk decides it; once a choice
+// hits a sequence its content is cut there with finish_reason "stop" and its
+// later deltas are dropped. Usage, errors, and Done pass through.
+func trimStream(ctx context.Context, in <-chan gateway.StreamChunk, seqs []string) <-chan gateway.StreamChunk {
+	out := make(chan gateway.StreamChunk, cap(in))
+	go func() {
+		defer close(out)
+		t := stopTrimmer{seqs: seqs, held: map[int]string{}, stopped: map[int]bool{}}
+		for chunk := range in {
+			if len(chunk.Data) > 0 {
+				data, keep := t.chunk(chunk.Data)
+				if !keep {
+					continue
+				}
+				chunk.Data = data
+			}
+			if chunk.Done {
+				if data := t.flush(); data != nil && !send(ctx, out, gateway.StreamChunk{Data: data}) {
+					break
+				}
+			}
+			if !send(ctx, out, chunk) {
+				break
+			}
+		}
+		// Drain so a provider blocked on send can finish.
+		for range in {
+		}
+	}()
+	return out
+}
+
+// send delivers chunk on out, reporting false if ctx ends first.
+func send(ctx context.Context, out chan<- gateway.StreamChunk, chunk gateway.StreamChunk) bool {
+	select {
+	case out <- chunk:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// stopTrimmer is trimStream's per-stream state, keyed by choice index.
+type stopTrimmer struct {
+	seqs    []string
+	held    map[int]string // text withheld as a possible sequence prefix
+	stopped map[int]bool   // choices already cut at a sequence
+	last    map[string]json.RawMessage
+}
+
+// chunk trims one OpenAI-format chunk. It returns the chunk unchanged when
+// nothing in it needs trimming, and keep false when nothing is left of it.
+func (t *stopTrimmer) chunk(data []byte) ([]byte, bool) {
+	var env map[string]json.RawMessage
+	var choices []map[string]json.RawMessage
+	if json.Unmarshal(data, &env) != nil || json.Unmarshal(env["choices"], &choices) != nil {
+		return data, true
+	}
+	t.last = env
+	changed := false
+	kept := choices[:0]
+	for _, c := range choices {
+		var idx int
+		_ = json.Unmarshal(c["index"], &idx)
+		if t.stopped[idx] {
+			changed = true
+			continue
+		}
+		var delta map[string]json.RawMessage
+		_ = json.Unmarshal(c["delta"], &delta)
+		var content string
+		if raw := delta["content"]; len(raw) > 0 && raw[0] == '"' {
+			_ = json.Unmarshal(raw, &content)
+		} else if t.held[idx] == "" {
+			kept = append(kept, c)
+			continue
+		}
+		text := t.held[idx] + content
+		finished := len(c["finish_reason"]) > 0 && string(c["finish_reason"]) != "null"
+		emit, held := text, ""
+		if cut := firstStop(text, t.seqs); cut >= 0 {
+			emit = text[:cut]
+			c["finish_reason"] = json.RawMessage(`"stop"`)
+			t.stopped[idx] = true
+		} else if !finished {
+			n := heldSuffix(text, t.seqs)
+			emit, held = text[:len(text)-n], text[len(text)-n:]
+		}
+		t.held[idx] = held
+		if emit != content || t.stopped[idx] {
+			changed = true
+			if delta == nil {
+				delta = map[string]json.RawMessage{}
+			}
+			delta["content"], _ = json.Marshal(emit)
+			c["delta"], _ = json.Marshal(delta)
+		}
+		kept = append(kept, c)
+	}
+	if !changed {
+		return data, true
+	}
+	if len(kept) == 0 && len(env["usage"]) == 0 {
+		return nil, false
+	}
+	env["choices"], _ = json.Marshal(kept)
+	out, _ := json.Marshal(env)
+	return out, true
+}
+
+// flush returns a chunk carrying text still held back when the stream ends
+// without a finish_reason, or nil if there is none.
+func (t *stopTrimmer) flush() []byte {
+	var choices []map[string]any
+	for idx, text := range t.held {
+		if text != "" {
+			choices = append(choices, map[string]any{"index": idx, "delta": map[string]string{"content": text}, "finish_reason": nil})
+		}
+	}
+	if len(choices) == 0 {
+		return nil
+	}
+	env := map[string]any{"object": "chat.completion.chunk", "choices": choices}
+	for _, k := range []string{"id", "created", "model"} {
+		if v, ok := t.last[k]; ok {
+			env[k] = v
+		}
+	}
+	out, _ := json.Marshal(env)
+	return out
+}
+
+// firstStop returns the index of the earliest sequence in text, or -1.
+func firstStop(text string, seqs []string) int {
+	cut := -1
+	for _, seq := range seqs {
+		if j := strings.Index(text, seq); j >= 0 && (cut < 0 || j < cut) {
+			cut = j
+		}
+	}
+	return cut
+}
+
+// heldSuffix returns the length of the longest suffix of text that is a
+// proper prefix of some sequence, i.e. text that must wait for more chunks.
+func heldSuffix(text string, seqs []string) int {
+	longest := 0
+	for _, seq := range seqs {
+		for n := min(len(seq)-1, len(text)); n > longest; n-- {
+			if strings.HasSuffix(text, seq[:n]) {
+				longest = n
+				break
+			}
+		}
+	}
+	return longest
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+func TestApplyStopSequences(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name, stop, content string
+		wantContent         string
+		wantFinish          string
+	}{
+		{"string stop", `"END"`, `"hello END world"`, `"hello "`, "stop"},
+		{"earliest of many", `["zz","lo"]`, `"hello zz"`, `"hel"`, "stop"},
+		{"not present", `["END"]`, `"hello"`, `"hello"`, "length"},
+		{"empty sequence ignored", `[""]`, `"hello"`, `"hello"`, "length"},
+		{"null content", `"END"`, `null`, `null`, "length"},
+		{"no stop", ``, `"hello END"`, `"hello END"`, "length"},
+	}
+	for _, tt := range tests {
+		resp := &gateway.ChatResponse{Choices: []gateway.Choice{{
+			Message:      gateway.Message{Role: "assistant", Content: json.RawMessage(tt.content)},
+			FinishReason: "length",
+		}}}
+		ApplyStopSequences(resp, json.RawMessage(tt.stop))
+		c := resp.Choices[0]
+		if string(c.Message.Content) != tt.wantContent || c.FinishReason != tt.wantFinish {
+			t.Errorf("%s: got %s/%s, want %s/%s", tt.name, c.Message.Content, c.FinishReason, tt.wantContent, tt.wantFinish)
+		}
+	}
+}
+
+func TestTrimStream(t *testing.T) {
+	t.Parallel()
+
+	delta := func(content, finish string) string {
+		f := "null"
+		if finish != "" {
+			f = `"` + finish + `"`
+		}
+		return `{"id":"c1","choices":[{"index":0,"delta":{"content":"` + content + `"},"finish_reason":` + f + `}]}`
+	}
+	usage := `{"id":"c1","choices":[],"usage":{"prompt_tokens":1,"completion_tokens":2,"total_tokens":3}}`
+	tests := []struct {
+		name        string
+		chunks      []string
+		wantContent string
+		wantFinish  string
+		wantUsage   bool
+	}{
+		{"sequence split across chunks", []string{delta("Hello E", ""), delta("ND world", ""), delta("", "length"), usage}, "Hello ", "stop", true},
+		{"held prefix released", []string{delta("Hello E", ""), delta("xtra", ""), delta("", "length")}, "Hello Extra", "length", false},
+		{"held prefix flushed at end", []string{delta("Hello E", "")}, "Hello E", "", false},
+		{"no sequence", []string{delta("Hello", ""), delta(" world", "stop")}, "Hello world", "stop", false},
+	}
+	for _, tt := range tests {
+		in := make(chan gateway.StreamChunk, len(tt.chunks)+1)
+		for _, c := range tt.chunks {
+			in <- gateway.StreamChunk{Data: []byte(c)}
+		}
+		in <- gateway.StreamChunk{Done: true}
+		close(in)
+
+		var content, finish string
+		var gotUsage, done bool
+		for chunk := range trimStream(context.Background(), in, []string{"END"}) {
+			if chunk.Done {
+				done = true
+				continue
+			}
+			var c struct {
+				Choices []struct {
+					Delta struct {
+						Content string `json:"content"`
+					} `json:"delta"`
+					FinishReason *string `json:"finish_reason"`
+				} `json:"choices"`
+				Usage *gateway.Usage `json:"usage"`
+			}
+			if err := json.Unmarshal(chunk.Data, &c); err != nil {
+				t.Fatalf("%s: decode %s: %v", tt.name, chunk.Data, err)
+			}
+			gotUsage = gotUsage || c.Usage != nil
+			for _, ch := range c.Choices {
+				content += ch.Delta.Content
+				if ch.FinishReason != nil {
+					finish = *ch.FinishReason
+				}
+			}
+		}
+		if content != tt.wantContent || finish != tt.wantFinish || gotUsage != tt.wantUsage || !done {
+			t.Errorf("%s: got %q/%q usage=%v done=%v, want %q/%q usage=%v done=true",
+				tt.name, content, finish, gotUsage, done, tt.wantContent, tt.wantFinish, tt.wantUsage)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"crypto/subtle"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"strings"
 	"sync"
@@ -27,7 +28,8 @@ const (
 type APIKeyAuth struct {
 	store       storage.APIKeyStore
 	cache       *otter.Cache[string, *gateway.APIKey]
-	keyIDToHash sync.Map // keyID -> hash for cache invalidation by key ID
+	pools       *otter.Cache[string, []*gateway.APIKey] // org ID + "/" + pool -> member keys
+	keyIDToHash sync.Map                                // keyID -> hash for cache invalidation by key ID
 }
 
 // NewAPIKeyAuth returns a new APIKeyAuth backed by store.
@@ -39,7 +41,14 @@ func NewAPIKeyAuth(store storage.APIKeyStore) (*APIKeyAuth, error) {
 	if err != nil {
 		return nil, fmt.Errorf("create auth cache: %w", err)
 	}
-	return &APIKeyAuth{store: store, cache: c}, nil
+	pools, err := otter.New(&otter.Options[string, []*gateway.APIKey]{
+		MaximumSize:      cacheMaxLen,
+		ExpiryCalculator: otter.ExpiryWriting[string, []*gateway.APIKey](cacheTTL),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create key pool cache: %w", err)
+	}
+	return &APIKeyAuth{store: store, cache: c, pools: pools}, nil
 }
 
 // Authenticate extracts a Bearer token from the Authorization header,
@@ -66,7 +75,7 @@ func (a *APIKeyAuth) Authenticate(ctx context.Context, r *http.Request) (*gatewa
 			a.cache.Invalidate(hash)
 			return nil, gateway.ErrKeyExpired
 		}
-		return buildIdentity(key), nil
+		return a.identity(ctx, key), nil
 	}
 
 	key, err := a.store.GetKeyByHash(ctx, hash)
@@ -101,15 +110,57 @@ func (a *APIKeyAuth) Authenticate(ctx context.Context, r *http.Request) (*gatewa
 		a.store.TouchKeyUsed(ctx, key.ID) //nolint:errcheck
 	}()
 
-	return buildIdentity(key), nil
+	return a.identity(ctx, key), nil
+}
+
+// identity builds key's Identity, with the other usable keys of its pool
+// as PoolMembers. A failed pool lookup leaves the key unpooled.
+func (a *APIKeyAuth) identity(ctx context.Context, key *gateway.APIKey) *gateway.Identity {
+	id := buildIdentity(key)
+	if key.Pool == "" {
+		return id
+	}
+	members, err := a.poolKeys(ctx, key.OrgID, key.Pool)
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "key pool lookup failed",
+			slog.String("key_id", key.ID),
+			slog.String("pool", key.Pool),
+			slog.String("error", err.Error()),
+		)
+		return id
+	}
+	now := time.Now()
+	for _, m := range members {
+		if m.ID == key.ID || m.Blocked || (m.ExpiresAt != nil && m.ExpiresAt.Before(now)) {
+			continue
+		}
+		id.PoolMembers = append(id.PoolMembers, buildIdentity(m))
+	}
+	return id
+}
+
+// poolKeys returns the keys in an org's pool, cached like single keys.
+func (a *APIKeyAuth) poolKeys(ctx context.Context, orgID, pool string) ([]*gateway.APIKey, error) {
+	cacheKey := orgID + "/" + pool
+	if keys, ok := a.pools.GetIfPresent(cacheKey); ok {
+		return keys, nil
+	}
+	keys, err := a.store.ListPoolKeys(ctx, orgID, pool)
+	if err != nil {
+		return nil, err
+	}
+	a.pools.Set(cacheKey, keys)
+	return keys, nil
 }
 
 // InvalidateByKeyID removes a cached API key by its key ID.
 // Used when admin operations (block, update, delete) modify a key.
+// Cached pools are dropped too, since the key may have joined or left one.
 func (a *APIKeyAuth) InvalidateByKeyID(keyID string) {
 	if hash, ok := a.keyIDToHash.LoadAndDelete(keyID); ok {
 		a.cache.Invalidate(hash.(string))
 	}
+	a.pools.InvalidateAll()
 }
 
 // buildIdentity constructs an Identity from a validated API key.
@@ -120,14 +171,17 @@ func buildIdentity(key *gateway.APIKey) *gateway.Identity {
 	}
 	perms := gateway.RolePermissions[role]
 	id := &gateway.Identity{
-		Subject:    key.KeyPrefix,
-		KeyID:      key.ID,
-		OrgID:      key.OrgID,
-		TeamID:     key.TeamID,
-		UserID:     key.UserID,
-		Role:       role,
-		Perms:      perms,
-		AuthMethod: "apikey",
+		Subject:       key.KeyPrefix,
+		KeyID:         key.ID,
+		OrgID:         key.OrgID,
+		TeamID:        key.TeamID,
+		UserID:        key.UserID,
+		Role:          role,
+		DefaultModel:  key.DefaultModel,
+		RequestPeriod: key.RequestPeriod,
+		MaxPriority:   key.MaxPriority,
+		Perms:         perms,
+		AuthMethod:    "apikey",
 	}
 	if key.RPMLimit != nil {
 		id.RPMLimit = *key.RPMLimit
@@ -138,8 +192,17 @@ func buildIdentity(key *gateway.APIKey) *gateway.Identity {
 	if key.MaxBudget != nil {
 		id.MaxBudget = *key.MaxBudget
 	}
+	if key.MaxStreams != nil {
+		id.MaxStreams = *key.MaxStreams
+	}
+	if key.MaxRequests != nil {
+		id.MaxRequests = *key.MaxRequests
+	}
 	if len(key.AllowedModels) > 0 {
 		id.AllowedModels = key.AllowedModels
 	}
+	if len(key.PreferredProviders) > 0 {
+		id.PreferredProviders = key.PreferredProviders
+	}
 	return id
 }
@@ -4,6 +4,8 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -54,6 +56,21 @@ func (s *fakeKeyStore) ListKeys(context.Context, string, int, int) ([]*gateway.A
 	return nil, nil
 }
 func (s *fakeKeyStore) CountKeys(context.Context, string) (int, error) { return 0, nil }
+func (s *fakeKeyStore) CountKeysPrimary(context.Context, string) (int, error) {
+	return 0, nil
+}
+func (s *fakeKeyStore) ListPoolKeys(_ context.Context, orgID, pool string) ([]*gateway.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []*gateway.APIKey
+	for _, k := range s.keys {
+		if k.OrgID == orgID && k.Pool == pool {
+			out = append(out, k)
+		}
+	}
+	slices.SortFunc(out, func(a, b *gateway.APIKey) int { return strings.Compare(a.ID, b.ID) })
+	return out, nil
+}
 func (s *fakeKeyStore) UpdateKey(context.Context, *gateway.APIKey) error { return nil }
 func (s *fakeKeyStore) DeleteKey(context.Context, string) error          { return nil }
 
@@ -319,6 +336,41 @@ func TestAuthenticate_TouchKeyUsed(t *testing.T) {
 	}
 }
 
+func TestAuthenticate_PoolMembers(t *testing.T) {
+	t.Parallel()
+	auth, store := newTestAuth(t)
+
+	past := time.Now().Add(-time.Hour)
+	store.addKey(testKey, &gateway.APIKey{ID: "key-a", KeyPrefix: "gnd_test_key", OrgID: "org-1", Pool: "batch"})
+	store.addKey("gnd_b", &gateway.APIKey{ID: "key-b", OrgID: "org-1", Pool: "batch"})
+	store.addKey("gnd_c", &gateway.APIKey{ID: "key-c", OrgID: "org-1", Pool: "batch", Blocked: true})
+	store.addKey("gnd_d", &gateway.APIKey{ID: "key-d", OrgID: "org-1", Pool: "batch", ExpiresAt: &past})
+	store.addKey("gnd_e", &gateway.APIKey{ID: "key-e", OrgID: "org-2", Pool: "batch"})
+	store.addKey("gnd_f", &gateway.APIKey{ID: "key-f", OrgID: "org-1", Pool: "other"})
+
+	id, err := auth.Authenticate(context.Background(), makeRequest(testKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var members []string
+	for _, m := range id.PoolMembers {
+		members = append(members, m.KeyID)
+	}
+	if !slices.Equal(members, []string{"key-b"}) {
+		t.Errorf("PoolMembers = %v, want [key-b]", members)
+	}
+
+	// Unpooled keys have no members.
+	store.addKey("gnd_g", &gateway.APIKey{ID: "key-g", OrgID: "org-1"})
+	id, err = auth.Authenticate(context.Background(), makeRequest("gnd_g"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(id.PoolMembers) != 0 {
+		t.Errorf("unpooled key has %d pool members, want 0", len(id.PoolMembers))
+	}
+}
+
 func TestBuildIdentity(t *testing.T) {
 	t.Parallel()
 
@@ -211,8 +211,9 @@ func (b *Breaker) RecordSuccess() {
 	}
 }
 
-// RecordError records a failed request with the given error weight.
-func (b *Breaker) RecordError(weight float64) {
+// RecordError records a failed request with the given error weight and
+// reports whether it opened the breaker.
+func (b *Breaker) RecordError(weight float64) (tripped bool) {
 	now := time.Now()
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -225,13 +226,16 @@ func (b *Breaker) RecordError(weight float64) {
 		if samples >= b.minSamples && rate >= b.threshold {
 			b.state = StateOpen
 			b.openedAt = now
+			return true
 		}
 	case StateHalfOpen:
 		// Probe failed: reopen.
 		b.state = StateOpen
 		b.openedAt = now
 		b.probing = false
+		return true
 	}
+	return false
 }
 
 // LastUsed returns the time of last activity (for stale eviction).
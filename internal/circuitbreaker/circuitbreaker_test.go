@@ -91,8 +91,11 @@ func TestBreaker_OpensOnThreshold(t *testing.T) {
 	for range 7 {
 		b.RecordSuccess()
 	}
-	for range 3 {
-		b.RecordError(1.0)
+	if b.RecordError(1.0) || b.RecordError(1.0) {
+		t.Fatal("breaker tripped before the threshold")
+	}
+	if !b.RecordError(1.0) {
+		t.Error("RecordError should report the trip")
 	}
 
 	if b.State() != StateOpen {
@@ -2,9 +2,12 @@ package circuitbreaker
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net"
 	"os"
+
+	gateway "github.com/eugener/gandalf/internal"
 )
 
 // httpStatusError is an interface for errors carrying an HTTP status code.
@@ -61,3 +64,70 @@ func classifyStatus(code int) float64 {
 		return 0.0
 	}
 }
+
+// Stable error categories for log aggregation. Raw provider messages vary
+// wildly; these let dashboards group failures without parsing them.
+const (
+	CategoryTimeout     = "timeout"
+	CategoryRateLimited = "rate_limited"
+	CategoryAuth        = "auth"
+	CategoryServerError = "server_error"
+	CategoryMalformed   = "malformed"
+)
+
+// ErrorCategory maps a provider error to one of the Category* constants.
+// It follows the same precedence as ClassifyError: timeouts first, then
+// HTTP status, then everything else is treated as a server fault. Returns
+// "" for nil.
+func ErrorCategory(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return CategoryTimeout
+	}
+
+	var he httpStatusError
+	if errors.As(err, &he) {
+		return statusCategory(he.HTTPStatus())
+	}
+
+	switch {
+	case errors.Is(err, gateway.ErrRateLimited):
+		return CategoryRateLimited
+	case errors.Is(err, gateway.ErrUnauthorized), errors.Is(err, gateway.ErrForbidden):
+		return CategoryAuth
+	case errors.Is(err, gateway.ErrBadRequest):
+		return CategoryMalformed
+	}
+
+	// Undecodable upstream payloads (e.g. a 200 with a truncated body).
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return CategoryMalformed
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return CategoryTimeout
+	}
+	return CategoryServerError
+}
+
+// statusCategory returns the error category for an HTTP status code.
+func statusCategory(code int) string {
+	switch {
+	case code == 429:
+		return CategoryRateLimited
+	case code == 408 || code == 504:
+		return CategoryTimeout
+	case code == 401 || code == 403:
+		return CategoryAuth
+	case code >= 400 && code < 500:
+		return CategoryMalformed
+	default:
+		return CategoryServerError
+	}
+}
@@ -2,11 +2,15 @@ package circuitbreaker
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
 	"os"
 	"testing"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
 )
 
 // statusError implements httpStatusError for testing.
@@ -81,3 +85,47 @@ func TestClassifyStatus_EdgeCases(t *testing.T) {
 		}
 	}
 }
+
+func TestErrorCategory(t *testing.T) {
+	t.Parallel()
+
+	var syntaxErr *json.SyntaxError
+	badJSON := json.Unmarshal([]byte(`{"choices":`), &struct{}{})
+	if !errors.As(badJSON, &syntaxErr) {
+		t.Fatalf("expected *json.SyntaxError, got %T", badJSON)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"nil", nil, ""},
+		{"context_deadline", context.DeadlineExceeded, CategoryTimeout},
+		{"wrapped_deadline", fmt.Errorf("openai: %w", context.DeadlineExceeded), CategoryTimeout},
+		{"os_deadline", os.ErrDeadlineExceeded, CategoryTimeout},
+		{"gateway_timeout", &provider.APIError{Provider: "openai", StatusCode: 504, Body: "upstream timed out"}, CategoryTimeout},
+		{"request_timeout", &statusError{408}, CategoryTimeout},
+		{"openai_429", &provider.APIError{Provider: "openai", StatusCode: 429, Body: `{"error":{"message":"Rate limit reached for gpt-4o"}}`}, CategoryRateLimited},
+		{"gateway_rate_limited", gateway.ErrRateLimited, CategoryRateLimited},
+		{"anthropic_401", &provider.APIError{Provider: "anthropic", StatusCode: 401, Body: `{"type":"error","error":{"type":"authentication_error"}}`}, CategoryAuth},
+		{"gemini_403", &provider.APIError{Provider: "gemini", StatusCode: 403, Body: "PERMISSION_DENIED"}, CategoryAuth},
+		{"gateway_unauthorized", fmt.Errorf("token refresh: %w", gateway.ErrUnauthorized), CategoryAuth},
+		{"openai_500", &provider.APIError{Provider: "openai", StatusCode: 500, Body: "internal error"}, CategoryServerError},
+		{"anthropic_529", &provider.APIError{Provider: "anthropic", StatusCode: 529, Body: `{"type":"overloaded_error"}`}, CategoryServerError},
+		{"connection_refused", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, CategoryServerError},
+		{"generic", errors.New("unexpected EOF"), CategoryServerError},
+		{"openai_400", &provider.APIError{Provider: "openai", StatusCode: 400, Body: `{"error":{"message":"Invalid 'messages'"}}`}, CategoryMalformed},
+		{"ollama_404", &statusError{404}, CategoryMalformed},
+		{"gateway_bad_request", gateway.ErrBadRequest, CategoryMalformed},
+		{"bad_json", fmt.Errorf("decode response: %w", badJSON), CategoryMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := ErrorCategory(tt.err); got != tt.want {
+				t.Errorf("ErrorCategory(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package cloudauth
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -15,10 +16,12 @@ import (
 
 // AWSSigV4Transport is an http.RoundTripper that signs outbound requests
 // with AWS Signature Version 4. It buffers the request body to compute
-// the SHA-256 payload hash required by SigV4.
+// the SHA-256 payload hash required by SigV4. Expiring credentials (role
+// and SSO sessions) are refreshed ahead of expiry according to a
+// RefreshPolicy.
 type AWSSigV4Transport struct {
 	base    http.RoundTripper
-	creds   aws.CredentialsProvider
+	creds   *credentialCache[aws.Credentials]
 	signer  *v4.Signer
 	region  string
 	service string
@@ -26,10 +29,24 @@ type AWSSigV4Transport struct {
 
 // NewAWSSigV4Transport returns a transport that signs requests using AWS SigV4.
 // region and service identify the target (e.g. "us-east-1", "bedrock-runtime").
-func NewAWSSigV4Transport(base http.RoundTripper, creds aws.CredentialsProvider, region, service string) *AWSSigV4Transport {
+func NewAWSSigV4Transport(base http.RoundTripper, creds aws.CredentialsProvider, policy RefreshPolicy, region, service string) *AWSSigV4Transport {
 	return &AWSSigV4Transport{
-		base:    base,
-		creds:   creds,
+		base: base,
+		creds: newCredentialCache("aws_sigv4", policy, func(ctx context.Context) (aws.Credentials, time.Time, error) {
+			// The SDK's credential cache keeps credentials until they
+			// expire; drop them so a scheduled refresh gets new ones.
+			if c, ok := creds.(interface{ Invalidate() }); ok {
+				c.Invalidate()
+			}
+			cr, err := creds.Retrieve(ctx)
+			if err != nil {
+				return aws.Credentials{}, time.Time{}, err
+			}
+			if !cr.CanExpire {
+				return cr, time.Time{}, nil
+			}
+			return cr, cr.Expires, nil
+		}),
 		signer:  v4.NewSigner(),
 		region:  region,
 		service: service,
@@ -62,7 +79,7 @@ func (t *AWSSigV4Transport) RoundTrip(r *http.Request) (*http.Response, error) {
 		r2.ContentLength = 0
 	}
 
-	creds, err := t.creds.Retrieve(r.Context())
+	creds, err := t.creds.get(r.Context())
 	if err != nil {
 		return nil, fmt.Errorf("cloudauth: retrieve AWS credentials: %w", err)
 	}
@@ -1,25 +1,74 @@
 // Package cloudauth provides http.RoundTripper decorators that inject
 // authentication headers for cloud-hosted LLM providers (direct API keys,
-// GCP OAuth, Azure Entra).
+// GCP OAuth, Azure Entra), plus a registry for custom request signers.
 package cloudauth
 
-import "net/http"
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+)
 
 // APIKeyTransport is an http.RoundTripper that injects a static API key
 // header on every outbound request. HeaderName is the header to set
 // (e.g. "Authorization", "x-api-key"). Prefix is prepended to Key
 // (e.g. "Bearer " for Authorization headers).
+//
+// When Keys holds more than one key it replaces Key: rate limits are
+// key-scoped, so a 429 on one key retries the same request with the next
+// key before the error reaches provider failover. The transport remembers
+// the last key that was not rate limited so later requests start there.
 type APIKeyTransport struct {
 	Key        string
+	Keys       []string
 	HeaderName string
 	Prefix     string
 	Base       http.RoundTripper
+
+	next atomic.Uint32 // index into Keys to try first
 }
 
 // RoundTrip clones the request and sets the auth header.
 func (t *APIKeyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if len(t.Keys) < 2 {
+		key := t.Key
+		if len(t.Keys) == 1 {
+			key = t.Keys[0]
+		}
+		return t.send(r, key)
+	}
+
+	// A body that can't be replayed limits us to a single attempt.
+	replayable := r.Body == nil || r.Body == http.NoBody || r.GetBody != nil
+	n := uint32(len(t.Keys))
+	start := t.next.Load()
+	for i := uint32(0); ; i++ {
+		idx := (start + i) % n
+		req := r
+		if i > 0 && r.GetBody != nil {
+			body, err := r.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = r.WithContext(r.Context())
+			req.Body = body
+		}
+		resp, err := t.send(req, t.Keys[idx])
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+			return resp, err
+		}
+		t.next.CompareAndSwap(idx, (idx+1)%n)
+		if i == n-1 || !replayable {
+			return resp, nil
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+	}
+}
+
+func (t *APIKeyTransport) send(r *http.Request, key string) (*http.Response, error) {
 	r2 := r.Clone(r.Context())
-	r2.Header.Set(t.HeaderName, t.Prefix+t.Key)
+	r2.Header.Set(t.HeaderName, t.Prefix+key)
 	return t.base().RoundTrip(r2)
 }
 
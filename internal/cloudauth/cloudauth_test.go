@@ -2,10 +2,18 @@ package cloudauth
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"golang.org/x/oauth2"
@@ -122,7 +130,7 @@ func TestGCPOAuthTransport(t *testing.T) {
 
 	rec := &recordingTransport{}
 	ts := &fakeTokenSource{token: &oauth2.Token{AccessToken: "ya29.test-token"}}
-	transport := newGCPOAuthTransportFromSource(rec, ts)
+	transport := newGCPOAuthTransportFromSource(rec, ts, RefreshPolicy{})
 
 	req, _ := http.NewRequest(http.MethodPost, "https://us-central1-aiplatform.googleapis.com/v1/...", nil)
 	resp, err := transport.RoundTrip(req)
@@ -145,7 +153,7 @@ func TestGCPOAuthTransportTokenError(t *testing.T) {
 
 	rec := &recordingTransport{}
 	ts := &fakeTokenSource{err: errors.New("no credentials")}
-	transport := newGCPOAuthTransportFromSource(rec, ts)
+	transport := newGCPOAuthTransportFromSource(rec, ts, RefreshPolicy{})
 
 	req, _ := http.NewRequest(http.MethodPost, "https://example.com", nil)
 	_, err := transport.RoundTrip(req)
@@ -158,12 +166,100 @@ func TestGCPOAuthTransportNilBase(t *testing.T) {
 	t.Parallel()
 
 	ts := &fakeTokenSource{token: &oauth2.Token{AccessToken: "test"}}
-	transport := newGCPOAuthTransportFromSource(nil, ts)
+	transport := newGCPOAuthTransportFromSource(nil, ts, RefreshPolicy{})
 	if transport.getBase() != http.DefaultTransport {
 		t.Error("nil base should fall back to http.DefaultTransport")
 	}
 }
 
+// sequenceTokenSource returns a new token per call, each expiring after
+// lifetime, or err once set.
+type sequenceTokenSource struct {
+	mu       sync.Mutex
+	calls    int
+	lifetime time.Duration
+	err      error
+}
+
+func (s *sequenceTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.calls++
+	return &oauth2.Token{
+		AccessToken: fmt.Sprintf("tok-%d", s.calls),
+		Expiry:      time.Now().Add(s.lifetime),
+	}, nil
+}
+
+func bearer(t *testing.T, transport http.RoundTripper, rec *recordingTransport) string {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com", nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	resp.Body.Close()
+	return rec.lastReq.Header.Get("Authorization")
+}
+
+func TestGCPOAuthTransportRefreshesBeforeExpiry(t *testing.T) {
+	t.Parallel()
+
+	rec := &recordingTransport{}
+	policy := RefreshPolicy{Before: 5 * time.Minute, Jitter: time.Minute}
+
+	// A token well outside the refresh window is reused.
+	fresh := &sequenceTokenSource{lifetime: time.Hour}
+	transport := newGCPOAuthTransportFromSource(rec, fresh, policy)
+	for range 3 {
+		if got := bearer(t, transport, rec); got != "Bearer tok-1" {
+			t.Fatalf("Authorization = %q, want the cached token", got)
+		}
+	}
+
+	// A token inside the window is replaced before the next call goes out.
+	expiring := &sequenceTokenSource{lifetime: 2 * time.Minute}
+	transport = newGCPOAuthTransportFromSource(rec, expiring, policy)
+	if got := bearer(t, transport, rec); got != "Bearer tok-1" {
+		t.Fatalf("first Authorization = %q", got)
+	}
+	if got := bearer(t, transport, rec); got != "Bearer tok-2" {
+		t.Errorf("Authorization = %q, want the refreshed token", got)
+	}
+
+	// A failed refresh keeps using the unexpired token.
+	expiring.mu.Lock()
+	expiring.err = errors.New("metadata server down")
+	expiring.mu.Unlock()
+	if got := bearer(t, transport, rec); got != "Bearer tok-2" {
+		t.Errorf("Authorization = %q, want the current token after a failed refresh", got)
+	}
+}
+
+func TestRefreshPolicyJitter(t *testing.T) {
+	t.Parallel()
+
+	expires := time.Now().Add(time.Hour)
+	p := RefreshPolicy{Before: 5 * time.Minute, Jitter: time.Minute}
+	seen := map[time.Time]bool{}
+	for range 20 {
+		at := p.refreshAt(expires)
+		if at.After(expires.Add(-5*time.Minute)) || at.Before(expires.Add(-6*time.Minute)) {
+			t.Fatalf("refreshAt = %v before expiry, want 5-6m", expires.Sub(at))
+		}
+		seen[at] = true
+	}
+	if len(seen) < 2 {
+		t.Error("refresh times should be jittered")
+	}
+	if at := (RefreshPolicy{Jitter: -1}).refreshAt(expires); !at.Equal(expires.Add(-DefaultRefreshBefore)) {
+		t.Errorf("unjittered refreshAt = %v before expiry, want %v", expires.Sub(at), DefaultRefreshBefore)
+	}
+}
+
 // fakeAWSCredProvider returns fixed credentials or error.
 type fakeAWSCredProvider struct {
 	creds aws.Credentials
@@ -184,7 +280,7 @@ func TestAWSSigV4Transport(t *testing.T) {
 			SecretAccessKey: "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY",
 		},
 	}
-	transport := NewAWSSigV4Transport(rec, creds, "us-east-1", "bedrock-runtime")
+	transport := NewAWSSigV4Transport(rec, creds, RefreshPolicy{}, "us-east-1", "bedrock-runtime")
 
 	req, _ := http.NewRequest(http.MethodPost, "https://bedrock-runtime.us-east-1.amazonaws.com/model/anthropic.claude-3-5-sonnet/invoke",
 		strings.NewReader(`{"messages":[{"role":"user","content":"hi"}]}`))
@@ -211,12 +307,67 @@ func TestAWSSigV4Transport(t *testing.T) {
 	}
 }
 
+// rotatingAWSCreds mimics aws.CredentialsCache: it returns cached
+// credentials until invalidated.
+type rotatingAWSCreds struct {
+	mu          sync.Mutex
+	issued      int
+	cached      bool
+	invalidated int
+	lifetime    time.Duration
+}
+
+func (c *rotatingAWSCreds) Retrieve(context.Context) (aws.Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.cached {
+		c.issued++
+		c.cached = true
+	}
+	return aws.Credentials{
+		AccessKeyID:     fmt.Sprintf("AKIA%d", c.issued),
+		SecretAccessKey: "secret",
+		CanExpire:       true,
+		Expires:         time.Now().Add(c.lifetime),
+	}, nil
+}
+
+func (c *rotatingAWSCreds) Invalidate() {
+	c.mu.Lock()
+	c.cached = false
+	c.invalidated++
+	c.mu.Unlock()
+}
+
+func TestAWSSigV4TransportRefreshesBeforeExpiry(t *testing.T) {
+	t.Parallel()
+
+	rec := &recordingTransport{}
+	creds := &rotatingAWSCreds{lifetime: 2 * time.Minute} // inside the default window
+	transport := NewAWSSigV4Transport(rec, creds, RefreshPolicy{}, "us-east-1", "bedrock-runtime")
+
+	for i, want := range []string{"AKIA1/", "AKIA2/"} {
+		req, _ := http.NewRequest(http.MethodPost, "https://example.com", strings.NewReader("body"))
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip %d: %v", i, err)
+		}
+		resp.Body.Close()
+		if got := rec.lastReq.Header.Get("Authorization"); !strings.Contains(got, "Credential="+want) {
+			t.Errorf("request %d Authorization = %q, want credential %s", i, got, want)
+		}
+	}
+	if creds.invalidated != 2 {
+		t.Errorf("invalidated = %d, want the SDK cache dropped on each refresh", creds.invalidated)
+	}
+}
+
 func TestAWSSigV4TransportCredentialError(t *testing.T) {
 	t.Parallel()
 
 	rec := &recordingTransport{}
 	creds := &fakeAWSCredProvider{err: errors.New("no credentials")}
-	transport := NewAWSSigV4Transport(rec, creds, "us-east-1", "bedrock-runtime")
+	transport := NewAWSSigV4Transport(rec, creds, RefreshPolicy{}, "us-east-1", "bedrock-runtime")
 
 	req, _ := http.NewRequest(http.MethodPost, "https://example.com", strings.NewReader("body"))
 	_, err := transport.RoundTrip(req)
@@ -238,7 +389,7 @@ func TestAWSSigV4TransportEmptyBody(t *testing.T) {
 			SecretAccessKey: "SECRET",
 		},
 	}
-	transport := NewAWSSigV4Transport(rec, creds, "us-east-1", "bedrock-runtime")
+	transport := NewAWSSigV4Transport(rec, creds, RefreshPolicy{}, "us-east-1", "bedrock-runtime")
 
 	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
 	resp, err := transport.RoundTrip(req)
@@ -258,8 +409,203 @@ func TestAWSSigV4TransportNilBase(t *testing.T) {
 	creds := &fakeAWSCredProvider{
 		creds: aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"},
 	}
-	transport := NewAWSSigV4Transport(nil, creds, "us-east-1", "bedrock-runtime")
+	transport := NewAWSSigV4Transport(nil, creds, RefreshPolicy{}, "us-east-1", "bedrock-runtime")
 	if transport.getBase() != http.DefaultTransport {
 		t.Error("nil base should fall back to http.DefaultTransport")
 	}
 }
+
+// keyLimitedTransport returns 429 for keys in limited and 200 otherwise,
+// recording the auth header and body of every attempt.
+type keyLimitedTransport struct {
+	limited map[string]bool
+	keys    []string
+	bodies  []string
+}
+
+func (rt *keyLimitedTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	key := r.Header.Get("Authorization")
+	rt.keys = append(rt.keys, key)
+	var body []byte
+	if r.Body != nil {
+		body, _ = io.ReadAll(r.Body)
+	}
+	rt.bodies = append(rt.bodies, string(body))
+	if rt.limited[key] {
+		return &http.Response{StatusCode: http.StatusTooManyRequests, Body: io.NopCloser(strings.NewReader("rate limited"))}, nil
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func TestAPIKeyTransportRotatesOn429(t *testing.T) {
+	t.Parallel()
+
+	rec := &keyLimitedTransport{limited: map[string]bool{"Bearer k1": true}}
+	transport := &APIKeyTransport{
+		Keys:       []string{"k1", "k2", "k3"},
+		HeaderName: "Authorization",
+		Prefix:     "Bearer ",
+		Base:       rec,
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com", strings.NewReader(`{"model":"gpt-4o"}`))
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if want := []string{"Bearer k1", "Bearer k2"}; !slices.Equal(rec.keys, want) {
+		t.Errorf("keys tried = %v, want %v", rec.keys, want)
+	}
+	for i, b := range rec.bodies {
+		if b != `{"model":"gpt-4o"}` {
+			t.Errorf("attempt %d body = %q, want original body replayed", i, b)
+		}
+	}
+
+	// The limited key is skipped on the next request.
+	rec.keys = nil
+	req, _ = http.NewRequest(http.MethodPost, "https://example.com", strings.NewReader(`{}`))
+	resp, err = transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	resp.Body.Close()
+	if want := []string{"Bearer k2"}; !slices.Equal(rec.keys, want) {
+		t.Errorf("second request keys = %v, want %v", rec.keys, want)
+	}
+}
+
+func TestAPIKeyTransportAllKeysLimited(t *testing.T) {
+	t.Parallel()
+
+	rec := &keyLimitedTransport{limited: map[string]bool{"Bearer k1": true, "Bearer k2": true}}
+	transport := &APIKeyTransport{
+		Keys:       []string{"k1", "k2"},
+		HeaderName: "Authorization",
+		Prefix:     "Bearer ",
+		Base:       rec,
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com", strings.NewReader(`{}`))
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429 once every key is limited", resp.StatusCode)
+	}
+	if len(rec.keys) != 2 {
+		t.Errorf("attempts = %d, want 2 (each key once)", len(rec.keys))
+	}
+}
+
+func TestSigningTransport(t *testing.T) {
+	t.Parallel()
+
+	RegisterSigner("test_hmac", func(params map[string]string) (Signer, error) {
+		secret := params["secret"]
+		if secret == "" {
+			return nil, errors.New("secret is required")
+		}
+		return SignerFunc(func(r *http.Request) error {
+			body, err := r.GetBody()
+			if err != nil {
+				return err
+			}
+			data, err := io.ReadAll(body)
+			if err != nil {
+				return err
+			}
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write(data)
+			r.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+			return nil
+		}), nil
+	})
+	if !HasSigner("test_hmac") {
+		t.Fatal("HasSigner(test_hmac) = false after RegisterSigner")
+	}
+
+	rec := &recordingTransport{}
+	transport, err := NewSigningTransport("test_hmac", rec, map[string]string{"secret": "s3cret"})
+	if err != nil {
+		t.Fatalf("NewSigningTransport: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/v1/chat", strings.NewReader(`{"model":"m"}`))
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	resp.Body.Close()
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(`{"model":"m"}`))
+	if got, want := rec.lastReq.Header.Get("X-Signature"), hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("X-Signature = %q, want %q", got, want)
+	}
+	if req.Header.Get("X-Signature") != "" {
+		t.Error("original request should not be mutated")
+	}
+	if body, _ := io.ReadAll(rec.lastReq.Body); string(body) != `{"model":"m"}` {
+		t.Errorf("forwarded body = %q, want it intact", body)
+	}
+
+	if _, err := NewSigningTransport("test_hmac", rec, nil); err == nil {
+		t.Error("expected error when the factory rejects its params")
+	}
+	if _, err := NewSigningTransport("unregistered", rec, nil); err == nil {
+		t.Error("expected error for an unregistered signer")
+	}
+}
+
+func TestRegisterSignerPanics(t *testing.T) {
+	t.Parallel()
+
+	noop := func(map[string]string) (Signer, error) {
+		return SignerFunc(func(*http.Request) error { return nil }), nil
+	}
+	RegisterSigner("test_dup", noop)
+	tests := []struct {
+		name string
+		sig  string
+		f    SignerFactory
+	}{
+		{"duplicate", "test_dup", noop},
+		{"built-in", "aws_sigv4", noop},
+		{"nil factory", "test_nil", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterSigner(%q) did not panic", tt.sig)
+				}
+			}()
+			RegisterSigner(tt.sig, tt.f)
+		})
+	}
+}
+
+func TestSigningTransportError(t *testing.T) {
+	t.Parallel()
+
+	rec := &recordingTransport{}
+	transport := &SigningTransport{
+		Signer: SignerFunc(func(*http.Request) error { return errors.New("secret unavailable") }),
+		Base:   rec,
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	if _, err := transport.RoundTrip(req); err == nil {
+		t.Fatal("expected signing error")
+	}
+	if rec.lastReq != nil {
+		t.Error("unsigned request must not be forwarded")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -11,38 +12,46 @@ import (
 
 // GCPOAuthTransport is an http.RoundTripper that injects a GCP OAuth2
 // bearer token on every outbound request, using Application Default
-// Credentials (ADC). Tokens are cached and auto-refreshed.
+// Credentials (ADC). Tokens are cached and refreshed ahead of expiry
+// according to a RefreshPolicy.
 type GCPOAuthTransport struct {
-	base   http.RoundTripper
-	source oauth2.TokenSource
+	base  http.RoundTripper
+	token *credentialCache[*oauth2.Token]
 }
 
 // NewGCPOAuthTransport returns a transport that obtains GCP credentials
 // via ADC and injects an Authorization: Bearer header on each request.
 // scopes specifies the required OAuth2 scopes.
-func NewGCPOAuthTransport(ctx context.Context, base http.RoundTripper, scopes ...string) (*GCPOAuthTransport, error) {
+func NewGCPOAuthTransport(ctx context.Context, base http.RoundTripper, policy RefreshPolicy, scopes ...string) (*GCPOAuthTransport, error) {
 	creds, err := google.FindDefaultCredentials(ctx, scopes...)
 	if err != nil {
 		return nil, fmt.Errorf("cloudauth: find GCP credentials: %w", err)
 	}
-	return &GCPOAuthTransport{
-		base:   base,
-		source: oauth2.ReuseTokenSource(nil, creds.TokenSource),
-	}, nil
+	return newGCPOAuthTransportFromSource(base, creds.TokenSource, policy), nil
 }
 
 // newGCPOAuthTransportFromSource creates a GCPOAuthTransport with an
 // explicit token source (used for testing).
-func newGCPOAuthTransportFromSource(base http.RoundTripper, ts oauth2.TokenSource) *GCPOAuthTransport {
+func newGCPOAuthTransportFromSource(base http.RoundTripper, ts oauth2.TokenSource, policy RefreshPolicy) *GCPOAuthTransport {
+	// ADC sources cache their own token until it is about to expire. Widen
+	// that cache's expiry window to cover ours so a scheduled refresh
+	// fetches a new token instead of getting the cached one back.
+	ts = oauth2.ReuseTokenSourceWithExpiry(nil, ts, policy.maxWindow())
 	return &GCPOAuthTransport{
-		base:   base,
-		source: oauth2.ReuseTokenSource(nil, ts),
+		base: base,
+		token: newCredentialCache("gcp_oauth", policy, func(context.Context) (*oauth2.Token, time.Time, error) {
+			tok, err := ts.Token()
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			return tok, tok.Expiry, nil
+		}),
 	}
 }
 
 // RoundTrip obtains a token and injects it as a Bearer header.
 func (t *GCPOAuthTransport) RoundTrip(r *http.Request) (*http.Response, error) {
-	tok, err := t.source.Token()
+	tok, err := t.token.get(r.Context())
 	if err != nil {
 		return nil, fmt.Errorf("cloudauth: obtain GCP token: %w", err)
 	}
@@ -0,0 +1,108 @@
+package cloudauth
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Defaults for RefreshPolicy fields left at zero.
+const (
+	DefaultRefreshBefore = 5 * time.Minute
+	DefaultRefreshJitter = time.Minute
+)
+
+// RefreshPolicy controls when cached cloud credentials are replaced. A
+// credential is refreshed Before its expiry plus a random extra of up to
+// Jitter, drawn anew for each credential, so replicas sharing an identity
+// don't all refresh at the same moment. Refresh is lazy: the first request
+// past the refresh point fetches the new credential before it is sent.
+type RefreshPolicy struct {
+	Before time.Duration // 0 = DefaultRefreshBefore
+	Jitter time.Duration // 0 = DefaultRefreshJitter, negative = no jitter
+}
+
+func (p RefreshPolicy) withDefaults() RefreshPolicy {
+	if p.Before <= 0 {
+		p.Before = DefaultRefreshBefore
+	}
+	if p.Jitter == 0 {
+		p.Jitter = DefaultRefreshJitter
+	}
+	return p
+}
+
+// maxWindow is the earliest before expiry a refresh can be scheduled.
+func (p RefreshPolicy) maxWindow() time.Duration {
+	p = p.withDefaults()
+	return p.Before + max(0, p.Jitter)
+}
+
+// refreshAt picks when a credential expiring at expires is refreshed.
+func (p RefreshPolicy) refreshAt(expires time.Time) time.Time {
+	p = p.withDefaults()
+	window := p.Before
+	if p.Jitter > 0 {
+		window += rand.N(p.Jitter)
+	}
+	return expires.Add(-window)
+}
+
+// credentialCache holds one credential and fetches a replacement once the
+// policy's refresh point passes. If a refresh fails while the current
+// credential is still valid, the current one keeps being used and the
+// failure is logged; the next request retries.
+type credentialCache[T any] struct {
+	kind   string // for logs, e.g. "gcp_oauth"
+	fetch  func(context.Context) (value T, expires time.Time, err error)
+	policy RefreshPolicy
+
+	mu        sync.Mutex
+	have      bool
+	value     T
+	expires   time.Time // zero = never expires
+	refreshAt time.Time
+}
+
+func newCredentialCache[T any](kind string, policy RefreshPolicy, fetch func(context.Context) (T, time.Time, error)) *credentialCache[T] {
+	return &credentialCache[T]{kind: kind, fetch: fetch, policy: policy}
+}
+
+// get returns the cached credential, refreshing it first when due.
+func (c *credentialCache[T]) get(ctx context.Context) (T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if c.have && (c.expires.IsZero() || now.Before(c.refreshAt)) {
+		return c.value, nil
+	}
+
+	value, expires, err := c.fetch(ctx)
+	if err != nil {
+		if c.have && now.Before(c.expires) {
+			slog.LogAttrs(ctx, slog.LevelWarn, "cloud credential refresh failed, using current credential",
+				slog.String("auth", c.kind),
+				slog.Time("expires", c.expires),
+				slog.String("error", err.Error()),
+			)
+			return c.value, nil
+		}
+		var zero T
+		return zero, err
+	}
+
+	refreshed := c.have
+	c.have, c.value, c.expires = true, value, expires
+	if !expires.IsZero() {
+		c.refreshAt = c.policy.refreshAt(expires)
+	}
+	if refreshed {
+		slog.LogAttrs(ctx, slog.LevelInfo, "cloud credential refreshed",
+			slog.String("auth", c.kind),
+			slog.Time("expires", expires),
+		)
+	}
+	return value, nil
+}
@@ -0,0 +1,105 @@
+package cloudauth
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Signer authenticates one outbound request in place, e.g. by adding an
+// HMAC signature header. It is called with a clone of the original request,
+// so it may set headers freely. A signer that covers the body should read
+// it through r.GetBody rather than consume r.Body; GetBody is nil for
+// native passthrough requests, whose bodies are streamed.
+type Signer interface {
+	Sign(r *http.Request) error
+}
+
+// SignerFunc adapts an ordinary function to the Signer interface.
+type SignerFunc func(r *http.Request) error
+
+// Sign calls f(r).
+func (f SignerFunc) Sign(r *http.Request) error { return f(r) }
+
+// SignerFactory builds the Signer for one provider from the provider's
+// auth params in the config file.
+type SignerFactory func(params map[string]string) (Signer, error)
+
+// builtinAuthTypes are handled by gandalf itself and cannot be registered.
+var builtinAuthTypes = map[string]bool{"api_key": true, "gcp_oauth": true, "aws_sigv4": true}
+
+var (
+	signersMu sync.RWMutex
+	signers   = make(map[string]SignerFactory)
+)
+
+// RegisterSigner makes a custom signer available as a provider auth type
+// under name. cloudauth is internal, so only code inside this module can
+// call it: a custom build adds a file to cmd/gandalf (or a package under
+// internal/ that cmd/gandalf imports) whose init function registers the
+// signer. It panics if f is nil, name is a built-in auth type, or name is
+// already registered.
+func RegisterSigner(name string, f SignerFactory) {
+	signersMu.Lock()
+	defer signersMu.Unlock()
+	if f == nil {
+		panic("cloudauth: RegisterSigner factory is nil")
+	}
+	if builtinAuthTypes[name] {
+		panic("cloudauth: RegisterSigner called with built-in auth type " + name)
+	}
+	if _, dup := signers[name]; dup {
+		panic("cloudauth: RegisterSigner called twice for " + name)
+	}
+	signers[name] = f
+}
+
+// HasSigner reports whether a custom signer is registered under name.
+func HasSigner(name string) bool {
+	signersMu.RLock()
+	defer signersMu.RUnlock()
+	_, ok := signers[name]
+	return ok
+}
+
+// SigningTransport is an http.RoundTripper that lets a Signer authenticate
+// every outbound request before forwarding it to Base.
+type SigningTransport struct {
+	Signer Signer
+	Base   http.RoundTripper
+}
+
+// NewSigningTransport returns a transport using the signer registered under
+// name, built from params.
+func NewSigningTransport(name string, base http.RoundTripper, params map[string]string) (*SigningTransport, error) {
+	signersMu.RLock()
+	f, ok := signers[name]
+	signersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("cloudauth: no signer registered for %q", name)
+	}
+	s, err := f(params)
+	if err != nil {
+		return nil, fmt.Errorf("cloudauth: build signer %q: %w", name, err)
+	}
+	return &SigningTransport{Signer: s, Base: base}, nil
+}
+
+// RoundTrip clones the request, signs the clone, and forwards it.
+func (t *SigningTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r2 := r.Clone(r.Context())
+	if err := t.Signer.Sign(r2); err != nil {
+		if r.Body != nil {
+			r.Body.Close()
+		}
+		return nil, fmt.Errorf("cloudauth: sign request: %w", err)
+	}
+	return t.getBase().RoundTrip(r2)
+}
+
+func (t *SigningTransport) getBase() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
@@ -6,12 +6,15 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 
 	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/jsonschema"
 	"github.com/eugener/gandalf/internal/storage"
 )
 
@@ -49,12 +52,23 @@ func Bootstrap(ctx context.Context, cfg *Config, store storage.Store) error {
 			continue
 		}
 		targets, _ := json.Marshal(r.Targets)
+		schema, err := routeSchema(r)
+		if err != nil {
+			return fmt.Errorf("route %q: %w", r.ModelAlias, err)
+		}
 		route := &gateway.Route{
 			ID:         uuid.Must(uuid.NewV7()).String(),
 			ModelAlias: r.ModelAlias,
 			Targets:    targets,
 			Strategy:   r.Strategy,
 			CacheTTLs:  r.CacheTTLs,
+
+			DefaultTemperature:  r.DefaultTemperature,
+			EmbeddingDimensions: r.EmbeddingDimensions,
+			DeniedTools:         r.DeniedTools,
+			CacheStopOnly:       r.CacheStopOnly,
+			ResponseSchema:      schema,
+			SchemaPolicy:        r.SchemaPolicy,
 		}
 		if err := store.CreateRoute(ctx, route); err != nil {
 			return err
@@ -101,6 +115,50 @@ func Bootstrap(ctx context.Context, cfg *Config, store storage.Store) error {
 	return nil
 }
 
+// ValidateRoutes checks every stored route's targets against the providers
+// in cfg, since only enabled config providers are registered at startup. A
+// target on a provider that is missing or disabled would fail at request
+// time; each one is logged as a warning. With server.strict_routes set they
+// fail startup instead.
+func ValidateRoutes(ctx context.Context, cfg *Config, store storage.Store) error {
+	enabled := make(map[string]bool, len(cfg.Providers))
+	for _, p := range cfg.Providers {
+		enabled[p.Name] = p.IsEnabled()
+	}
+	routes, err := store.ListRoutes(ctx)
+	if err != nil {
+		return fmt.Errorf("list routes: %w", err)
+	}
+
+	var dangling []string
+	for _, r := range routes {
+		var targets []gateway.RouteTarget
+		if err := json.Unmarshal(r.Targets, &targets); err != nil {
+			return fmt.Errorf("route %q: invalid targets: %w", r.ModelAlias, err)
+		}
+		for _, t := range targets {
+			on, ok := enabled[t.ProviderID]
+			if on {
+				continue
+			}
+			reason := "not configured"
+			if ok {
+				reason = "disabled"
+			}
+			slog.LogAttrs(ctx, slog.LevelWarn, "route target provider unavailable",
+				slog.String("alias", r.ModelAlias),
+				slog.String("provider", t.ProviderID),
+				slog.String("reason", reason),
+			)
+			dangling = append(dangling, fmt.Sprintf("route %q: provider %q %s", r.ModelAlias, t.ProviderID, reason))
+		}
+	}
+	if cfg.Server.StrictRoutes && len(dangling) > 0 {
+		return fmt.Errorf("strict_routes: %s", strings.Join(dangling, "; "))
+	}
+	return nil
+}
+
 // GenerateAdminKey creates a random admin key and returns the plaintext.
 func GenerateAdminKey() string {
 	raw := make([]byte, 32)
@@ -109,3 +167,22 @@ func GenerateAdminKey() string {
 	}
 	return gateway.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(raw)
 }
+
+// routeSchema encodes a route's response schema as JSON, checking that it
+// compiles and that its policy is known. A route without a schema yields nil.
+func routeSchema(r RouteEntry) (json.RawMessage, error) {
+	if !gateway.IsSchemaPolicy(r.SchemaPolicy) {
+		return nil, fmt.Errorf("unknown schema_policy %q (want reject, retry, or annotate)", r.SchemaPolicy)
+	}
+	if r.ResponseSchema == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(r.ResponseSchema)
+	if err != nil {
+		return nil, fmt.Errorf("response_schema: %w", err)
+	}
+	if _, err := jsonschema.Compile(raw); err != nil {
+		return nil, fmt.Errorf("response_schema: %w", err)
+	}
+	return raw, nil
+}
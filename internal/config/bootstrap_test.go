@@ -1,7 +1,10 @@
 package config
 
 import (
+	"bytes"
 	"context"
+	"log/slog"
+	"strings"
 	"testing"
 
 	"github.com/eugener/gandalf/internal/storage/sqlite"
@@ -120,3 +123,80 @@ func TestBootstrapSkipsEmptyKeys(t *testing.T) {
 		t.Errorf("key count = %d, want 0 (empty key should be skipped)", len(keys))
 	}
 }
+
+func TestBootstrapRouteSchema(t *testing.T) {
+	t.Parallel()
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	route := RouteEntry{
+		ModelAlias:     "tickets",
+		Targets:        []TargetEntry{{Provider: "openai", Model: "gpt-4o", Priority: 1}},
+		ResponseSchema: map[string]any{"type": "object", "required": []any{"priority"}},
+		SchemaPolicy:   "annotate",
+	}
+	if err := Bootstrap(ctx, &Config{Routes: []RouteEntry{route}}, store); err != nil {
+		t.Fatal("bootstrap:", err)
+	}
+	got, err := store.GetRouteByAlias(ctx, "tickets")
+	if err != nil {
+		t.Fatal("get route:", err)
+	}
+	if got.SchemaPolicy != "annotate" || !strings.Contains(string(got.ResponseSchema), `"required"`) {
+		t.Errorf("route = %+v, want schema and annotate policy", got)
+	}
+
+	bad := route
+	bad.ModelAlias = "bad"
+	bad.ResponseSchema = map[string]any{"type": "objekt"}
+	err = Bootstrap(ctx, &Config{Routes: []RouteEntry{bad}}, store)
+	if err == nil || !strings.Contains(err.Error(), `route "bad"`) {
+		t.Errorf("err = %v, want invalid schema error for route \"bad\"", err)
+	}
+}
+
+// TestValidateRoutes swaps the default logger, so it must not run in parallel.
+func TestValidateRoutes(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	store := newTestStore(t)
+	ctx := context.Background()
+	off := false
+	cfg := &Config{
+		Providers: []ProviderEntry{
+			{Name: "openai", BaseURL: "https://api.openai.com/v1"},
+			{Name: "anthropic", BaseURL: "https://api.anthropic.com", Enabled: &off},
+		},
+		Routes: []RouteEntry{
+			{ModelAlias: "ok", Targets: []TargetEntry{{Provider: "openai", Model: "gpt-4o"}}},
+			{ModelAlias: "claude", Targets: []TargetEntry{{Provider: "anthropic", Model: "claude-sonnet-4"}}},
+			{ModelAlias: "typo", Targets: []TargetEntry{{Provider: "openai", Model: "gpt-4o"}, {Provider: "opnai", Model: "gpt-4o"}}},
+		},
+	}
+	if err := Bootstrap(ctx, cfg, store); err != nil {
+		t.Fatal("bootstrap:", err)
+	}
+
+	if err := ValidateRoutes(ctx, cfg, store); err != nil {
+		t.Fatalf("lenient: err = %v, want nil", err)
+	}
+	logs := buf.String()
+	for _, want := range []string{`"provider":"anthropic","reason":"disabled"`, `"provider":"opnai","reason":"not configured"`} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("logs missing %s:\n%s", want, logs)
+		}
+	}
+	if strings.Contains(logs, `"alias":"ok","provider"`) {
+		t.Errorf("route with a configured provider was reported:\n%s", logs)
+	}
+
+	cfg.Server.StrictRoutes = true
+	err := ValidateRoutes(ctx, cfg, store)
+	if err == nil || !strings.Contains(err.Error(), `route "typo": provider "opnai" not configured`) ||
+		!strings.Contains(err.Error(), `route "claude": provider "anthropic" disabled`) {
+		t.Errorf("strict: err = %v, want both dangling targets", err)
+	}
+}
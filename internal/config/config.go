@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"slices"
 	"time"
 
 	"go.yaml.in/yaml/v3"
+
+	gateway "github.com/eugener/gandalf/internal"
 )
 
 // Config is the top-level gateway configuration.
@@ -22,6 +25,78 @@ type Config struct {
 	Providers      []ProviderEntry      `yaml:"providers"`
 	Routes         []RouteEntry         `yaml:"routes"`
 	Keys           []KeyEntry           `yaml:"keys"`
+
+	// NormalizeModelNames lets unmatched model names fall back to their
+	// lowercased, version-stripped form ("GPT-4o-2024-08-06" -> "gpt-4o").
+	NormalizeModelNames bool `yaml:"normalize_model_names"`
+
+	// EmptyResponseRetries retries non-streaming chat completions that come
+	// back with no content, failing over to the next target. 0 = disabled.
+	EmptyResponseRetries int `yaml:"empty_response_retries"`
+
+	// TruncateEmbeddings shortens and renormalizes embeddings to the
+	// request's dimensions when the provider returned longer vectors.
+	TruncateEmbeddings bool `yaml:"truncate_embeddings"`
+
+	// ModelNotFoundThreshold diagnoses a route target after this many
+	// model-not-found errors from its provider, suggesting close matches
+	// from the provider's model list. 0 = disabled.
+	ModelNotFoundThreshold int `yaml:"model_not_found_threshold"`
+
+	// FinishReasons maps extra upstream finish reasons to OpenAI ones
+	// (stop, length, tool_calls, content_filter), overriding the built-in
+	// table. Unknown reasons otherwise become "stop".
+	FinishReasons map[string]string `yaml:"finish_reasons"`
+
+	// TokenBudgets caps cumulative tokens per key or org, optionally per model.
+	TokenBudgets []TokenBudgetEntry `yaml:"token_budgets"`
+
+	// Quota controls how the USD max_budget on keys renews.
+	Quota QuotaConfig `yaml:"quota"`
+
+	// ModelPolicy restricts models for every key, admins included.
+	ModelPolicy ModelPolicyConfig `yaml:"model_policy"`
+
+	// RequireUserOrgs lists orgs whose requests must carry the `user`
+	// field, so abuse can be traced to an end user.
+	RequireUserOrgs []string `yaml:"require_user_orgs"`
+
+	// OrgDeniedTools maps an org ID to tool names its requests may not
+	// declare, in addition to each route's denied_tools.
+	OrgDeniedTools map[string][]string `yaml:"org_denied_tools"`
+
+	// ShadowEval samples chat completions for side-by-side provider evaluation.
+	ShadowEval ShadowEvalConfig `yaml:"shadow_eval"`
+
+	// EvalCapture samples full request/response pairs into an eval dataset.
+	EvalCapture EvalCaptureConfig `yaml:"eval_capture"`
+
+	// Hedging races slow non-streaming chat completions against the route's
+	// next target.
+	Hedging HedgingConfig `yaml:"hedging"`
+
+	// OutputFilter scans completion text for disallowed content before it
+	// is returned.
+	OutputFilter OutputFilterConfig `yaml:"output_filter"`
+
+	// Pricing lists provider model prices (USD per 1M tokens), keyed by the
+	// model name sent upstream. Used by the balanced route strategy.
+	Pricing map[string]PriceEntry `yaml:"pricing"`
+
+	// BalancedRouting weighs cost against latency for routes with
+	// strategy: balanced.
+	BalancedRouting BalancedRoutingConfig `yaml:"balanced_routing"`
+
+	// ModelCapabilities overrides provider-reported capabilities, keyed by
+	// upstream (provider-side) model name as used in route targets.
+	ModelCapabilities map[string]CapabilityEntry `yaml:"model_capabilities"`
+
+	// UpstreamRateLimits deprioritizes providers whose own rate-limit
+	// headers show they are close to their limit.
+	UpstreamRateLimits UpstreamRateLimitConfig `yaml:"upstream_rate_limits"`
+
+	// AnomalyDetection flags unusual hourly spend per key and org.
+	AnomalyDetection AnomalyDetectionConfig `yaml:"anomaly_detection"`
 }
 
 // TelemetryConfig holds observability settings.
@@ -46,6 +121,102 @@ type TracingConfig struct {
 type RateLimitConfig struct {
 	DefaultRPM int64 `yaml:"default_rpm"` // default requests per minute (0 = unlimited)
 	DefaultTPM int64 `yaml:"default_tpm"` // default tokens per minute (0 = unlimited)
+
+	DefaultMaxStreams int64 `yaml:"default_max_streams"` // default concurrent streams per key (0 = unlimited)
+
+	// TokenEstimate selects how prompt tokens are estimated before a request
+	// is charged against TPM limits: "counter" (default, per-message
+	// heuristic), "bytes" (~4 bytes of message text per token), or "fixed"
+	// (FixedTokenEstimate per request, whatever its size).
+	TokenEstimate      string `yaml:"token_estimate"`
+	FixedTokenEstimate int64  `yaml:"fixed_token_estimate"` // tokens charged per request with token_estimate: fixed
+}
+
+// QuotaConfig holds USD budget period settings. An empty period keeps
+// max_budget as a lifetime cap.
+type QuotaConfig struct {
+	Period     string            `yaml:"period"`      // daily, weekly, monthly (UTC boundaries)
+	OrgPeriods map[string]string `yaml:"org_periods"` // per-org override of period
+}
+
+// ModelPolicyConfig is a gateway-wide guardrail on requested model names,
+// checked after each key's own allowlist.
+type ModelPolicyConfig struct {
+	Allow []string `yaml:"allow"` // only these models may be used (empty = no restriction)
+	Deny  []string `yaml:"deny"`  // these models are refused to every key
+}
+
+// ShadowEvalConfig fans a sampled fraction of non-streaming chat completions
+// out to extra targets and stores all responses in eval_captures. Clients
+// only receive the primary response.
+type ShadowEvalConfig struct {
+	SampleRate float64       `yaml:"sample_rate"` // fraction of requests to sample, 0..1 (0 = disabled)
+	Models     []string      `yaml:"models"`      // model aliases to sample (empty = all)
+	Targets    []TargetEntry `yaml:"targets"`     // shadow provider/model pairs
+}
+
+// EvalCaptureConfig stores a sampled fraction of non-streaming chat
+// completions, request and response, in eval_captures for building
+// evaluation datasets. Content is redacted with the built-in PII detectors,
+// and the output filter's in redact mode, before it is stored.
+type EvalCaptureConfig struct {
+	SampleRate float64            `yaml:"sample_rate"` // fraction of requests to capture, 0..1 (0 = none unless listed in models)
+	Models     map[string]float64 `yaml:"models"`      // per model alias rates, overriding sample_rate
+}
+
+// HedgingConfig sends a second copy of a non-streaming chat completion to
+// the route's next target when the first is still running after the
+// primary provider's Percentile latency (Delay until it has MinSamples
+// samples). The first response wins and the other call is canceled.
+type HedgingConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	Percentile int           `yaml:"percentile"`  // primary latency percentile to wait for (0 = always Delay)
+	MinSamples int           `yaml:"min_samples"` // samples needed before Percentile applies
+	Delay      time.Duration `yaml:"delay"`       // hedge delay until then
+	MaxRatio   float64       `yaml:"max_ratio"`   // max fraction of requests hedged, 0..1
+}
+
+// OutputFilterConfig redacts or blocks completion text matching built-in
+// PII detectors, blocked terms, or extra patterns. The filter is off when
+// none are configured. Streams pass through unscanned unless Streams is
+// "buffer", in which case they are collected, scanned, and replayed.
+type OutputFilterConfig struct {
+	Action      string   `yaml:"action"`      // redact (default) or block
+	Detectors   []string `yaml:"detectors"`   // email, phone, ssn, credit_card
+	Terms       []string `yaml:"terms"`       // blocked terms, case-insensitive
+	Patterns    []string `yaml:"patterns"`    // extra regular expressions
+	Replacement string   `yaml:"replacement"` // redaction text (default "[REDACTED]")
+	Streams     string   `yaml:"streams"`     // pass (default) or buffer
+}
+
+// BalancedRoutingConfig holds the score weights of the balanced strategy.
+// Each term is normalized to 0..1 across a route's targets, so the weights
+// set their relative importance.
+type BalancedRoutingConfig struct {
+	CostWeight    float64 `yaml:"cost_weight"`
+	LatencyWeight float64 `yaml:"latency_weight"`
+}
+
+// UpstreamRateLimitConfig enables adaptive throttling. Providers' x-ratelimit-*,
+// anthropic-ratelimit-*, and Retry-After response headers are tracked, and a
+// provider with less than LowHeadroom of a limit left is tried after a
+// route's other targets until the limit resets.
+type UpstreamRateLimitConfig struct {
+	Enabled     bool    `yaml:"enabled"`
+	LowHeadroom float64 `yaml:"low_headroom"` // remaining fraction counted as near the limit (0 = 0.1)
+}
+
+// AnomalyDetectionConfig enables the usage anomaly worker. An hour whose
+// spend is more than Sigma standard deviations above the key's or org's
+// hourly baseline over Window is flagged, served on
+// /admin/v1/usage/anomalies, and posted to WebhookURL when set.
+type AnomalyDetectionConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	Sigma       float64       `yaml:"sigma"`        // 0 = 3
+	Window      time.Duration `yaml:"window"`       // baseline length (0 = 168h)
+	MinBaseline int           `yaml:"min_baseline"` // hours of history needed before judging (0 = 24)
+	MinCostUSD  float64       `yaml:"min_cost_usd"` // never flag hours cheaper than this
+	WebhookURL  string        `yaml:"webhook_url"`  // POSTed {"anomalies": [...]} for new anomalies (empty = none)
 }
 
 // CacheConfig holds response cache settings.
@@ -70,16 +241,46 @@ type ServerConfig struct {
 	ReadTimeout     time.Duration `yaml:"read_timeout"`
 	WriteTimeout    time.Duration `yaml:"write_timeout"`
 	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	GRPCHealthAddr  string        `yaml:"grpc_health_addr"` // grpc.health.v1 listener (empty = disabled)
+	Threads         bool          `yaml:"threads"`          // enable /v1/threads conversation storage
+
+	LogSlowRequestsMs int     `yaml:"log_slow_requests_ms"` // warn on requests slower than this (0 = disabled)
+	LogSampleRate     float64 `yaml:"log_sample_rate"`      // fraction of successful requests access-logged, 0..1 (0 = all); errors always logged
+
+	ResponseMetadata   bool `yaml:"response_metadata"`   // add x_gandalf {provider, model, cached} to chat responses
+	BufferStreams      bool `yaml:"buffer_streams"`      // aggregate stream:true upstream responses into one JSON body
+	RequestFingerprint bool `yaml:"request_fingerprint"` // X-Gandalf-Request-Fingerprint header and log attribute on chat completions
+
+	StrictContentType      bool `yaml:"strict_content_type"`      // 415 for /v1 request bodies not sent as application/json
+	ReplaceDuplicateRoutes bool `yaml:"replace_duplicate_routes"` // creating a route for an existing alias overwrites it instead of 409
+	MaxRouteTargets        int  `yaml:"max_route_targets"`        // targets an admin-created route may list (0 = 10)
+	StrictRoutes           bool `yaml:"strict_routes"`            // fail startup when a route targets a missing or disabled provider (default: warn)
+	StreamDowngrade        bool `yaml:"stream_downgrade"`         // retry failed streams without streaming and replay the result as SSE
+
+	RepairToolArguments bool `yaml:"repair_tool_arguments"` // close truncated streamed tool-call arguments, or flag them invalid
+	StreamUsageEvent    bool `yaml:"stream_usage_event"`    // emit final usage as "event: usage" before [DONE]
+
+	MaxConcurrentRequests int `yaml:"max_concurrent_requests"` // queue client requests beyond this, by X-Gandalf-Priority (0 = unlimited)
+
+	ProviderBaseURLAllowlist []string `yaml:"provider_base_url_allowlist"` // hosts, IPs, or CIDRs admin-created providers may target despite being internal
+
+	BetaFeatures map[string][]string `yaml:"beta_features"` // provider type -> beta features clients may request via X-Anthropic-Beta / X-OpenAI-Beta
 }
 
 // DatabaseConfig holds SQLite settings.
 type DatabaseConfig struct {
 	DSN string `yaml:"dsn"` // file path or ":memory:"
+
+	// ReadReplicas lists read-only copies of the database (file paths) that
+	// serve usage, rollup, and key-listing reads. Writes stay on DSN.
+	ReadReplicas []string `yaml:"read_replicas"`
 }
 
 // AuthConfig holds authentication settings.
 type AuthConfig struct {
 	AdminKey string `yaml:"admin_key"` // bootstrap admin key (hashed on first use)
+
+	BackupSigningKey string `yaml:"backup_signing_key"` // HMAC key for /admin/v1/backup and /restore (empty = disabled)
 }
 
 // ProviderEntry is a provider definition in the config file.
@@ -88,6 +289,7 @@ type ProviderEntry struct {
 	Type      string     `yaml:"type"`
 	BaseURL   string     `yaml:"base_url"`
 	APIKey    string     `yaml:"api_key"`
+	APIKeys   []string   `yaml:"api_keys"` // extra keys, rotated in when one is rate limited (429)
 	Models    []string   `yaml:"models"`
 	Priority  int        `yaml:"priority"`
 	Weight    int        `yaml:"weight"`
@@ -98,12 +300,41 @@ type ProviderEntry struct {
 	Region    string     `yaml:"region"`  // cloud region (Vertex AI, Bedrock)
 	Project   string     `yaml:"project"` // GCP project ID for Vertex AI
 	Auth      *AuthEntry `yaml:"auth"`    // explicit auth; inferred from api_key when absent
+
+	ModelsCacheTTL      time.Duration `yaml:"models_cache_ttl"`      // ListModels cache lifetime (0 = no caching)
+	MaxResponseBytes    int64         `yaml:"max_response_bytes"`    // non-streaming response body cap (0 = 32MB default)
+	HTTPProxy           string        `yaml:"http_proxy"`            // egress proxy URL; "" = direct, "env" = HTTP(S)_PROXY
+	TLSPins             []string      `yaml:"tls_pins"`              // base64 SHA-256 SPKI pins; connection fails unless one matches
+	MaxConnLifetime     time.Duration `yaml:"max_conn_lifetime"`     // retire connections older than this (0 = until idle timeout)
+	ResetFlushThreshold int           `yaml:"reset_flush_threshold"` // consecutive connection resets that flush the pool (0 = 3, negative = never)
+
+	RequiredFields   []string `yaml:"required_fields"`    // chat request fields rejected with 400 when missing (e.g. max_tokens)
+	SamplingParams   []string `yaml:"sampling_params"`    // supported sampling params; others are stripped (nil = provider default)
+	DefaultMaxTokens *int     `yaml:"default_max_tokens"` // anthropic: max_tokens sent when omitted (nil = 4096, 0 = required)
+	InlineImages     *bool    `yaml:"inline_images"`      // anthropic/gemini: download image_url links and send base64 (nil = gemini only)
+
+	Transform *TransformEntry `yaml:"transform"` // request/response rewrite rules (nil = none)
+
+	StreamFinishGrace time.Duration `yaml:"stream_finish_grace"` // end a stream this long after its finish_reason if the upstream holds it open (0 = 2s, negative = wait for EOF)
+}
+
+// TransformEntry holds a provider's rewrite rules, one per line; see
+// provider.Transform for the rule language.
+type TransformEntry struct {
+	Request  []string `yaml:"request"`  // applied to outgoing JSON request bodies and headers
+	Response []string `yaml:"response"` // applied to successful non-streaming JSON responses
 }
 
 // AuthEntry configures provider authentication.
 type AuthEntry struct {
-	Type   string `yaml:"type"`    // "api_key", "gcp_oauth", "aws_sigv4"
-	APIKey string `yaml:"api_key"` // explicit key (overrides top-level api_key)
+	Type   string            `yaml:"type"`    // "api_key", "gcp_oauth", "aws_sigv4", or a signer registered with cloudauth.RegisterSigner
+	APIKey string            `yaml:"api_key"` // explicit key (overrides top-level api_key)
+	Params map[string]string `yaml:"params"`  // settings passed to a registered signer
+
+	// Cloud credential refresh for gcp_oauth and aws_sigv4: credentials are
+	// replaced refresh_before their expiry plus up to refresh_jitter.
+	RefreshBefore time.Duration `yaml:"refresh_before"` // 0 = 5m
+	RefreshJitter time.Duration `yaml:"refresh_jitter"` // 0 = 1m, negative = no jitter
 }
 
 // IsEnabled reports whether the provider is enabled (defaults to true when nil).
@@ -148,12 +379,32 @@ func (p ProviderEntry) ResolvedAPIKey() string {
 	return p.APIKey
 }
 
+// ResolvedAPIKeys returns ResolvedAPIKey followed by any additional APIKeys,
+// skipping empty and duplicate entries. The result is empty when no key is set.
+func (p ProviderEntry) ResolvedAPIKeys() []string {
+	var keys []string
+	for _, k := range append([]string{p.ResolvedAPIKey()}, p.APIKeys...) {
+		if k != "" && !slices.Contains(keys, k) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
 // RouteEntry is a route definition in the config file.
 type RouteEntry struct {
 	ModelAlias string        `yaml:"model_alias"`
 	Targets    []TargetEntry `yaml:"targets"`
 	Strategy   string        `yaml:"strategy"`
 	CacheTTLs  int           `yaml:"cache_ttl_s"`
+
+	DefaultTemperature  *float64 `yaml:"default_temperature"`  // applied when client omits temperature
+	EmbeddingDimensions int      `yaml:"embedding_dimensions"` // expected vector size; mismatches fail over (0 = no check)
+	DeniedTools         []string `yaml:"denied_tools"`         // tool names rejected with 403 (case-insensitive)
+	CacheStopOnly       bool     `yaml:"cache_stop_only"`      // cache only responses with finish_reason "stop"
+
+	ResponseSchema map[string]any `yaml:"response_schema"` // JSON Schema every response's content must satisfy
+	SchemaPolicy   string         `yaml:"schema_policy"`   // on violation: reject (default), retry, or annotate
 }
 
 // TargetEntry is a single route target.
@@ -173,6 +424,47 @@ type KeyEntry struct {
 	Role          string   `yaml:"role"`
 }
 
+// TokenBudgetEntry is a raw token budget. Exactly one of KeyID or OrgID
+// selects the scope; an empty Model applies the budget across all models.
+type TokenBudgetEntry struct {
+	KeyID     string `yaml:"key_id"`
+	OrgID     string `yaml:"org_id"`
+	Model     string `yaml:"model"`
+	MaxTokens int64  `yaml:"max_tokens"`
+}
+
+// CapabilityEntry overrides individual model capabilities. Omitted fields
+// keep the provider-reported value.
+type CapabilityEntry struct {
+	Chat       *bool `yaml:"chat"`
+	Embeddings *bool `yaml:"embeddings"`
+	Tools      *bool `yaml:"tools"`
+	Vision     *bool `yaml:"vision"`
+	Streaming  *bool `yaml:"streaming"`
+}
+
+// Override converts the entry to its domain representation.
+func (c CapabilityEntry) Override() gateway.CapabilityOverride {
+	return gateway.CapabilityOverride{
+		Chat:       c.Chat,
+		Embeddings: c.Embeddings,
+		Tools:      c.Tools,
+		Vision:     c.Vision,
+		Streaming:  c.Streaming,
+	}
+}
+
+// PriceEntry is a model's list price in USD per 1M tokens.
+type PriceEntry struct {
+	InputPer1M  float64 `yaml:"input_per_1m"`
+	OutputPer1M float64 `yaml:"output_per_1m"`
+}
+
+// Price converts the entry to its domain representation.
+func (p PriceEntry) Price() gateway.ModelPrice {
+	return gateway.ModelPrice{InputPer1M: p.InputPer1M, OutputPer1M: p.OutputPer1M}
+}
+
 var envPattern = regexp.MustCompile(`\$\{([^}]+)\}`)
 
 // expandEnv replaces ${VAR} patterns with environment variable values.
@@ -187,12 +479,17 @@ func expandEnv(data []byte) []byte {
 }
 
 // Load reads and parses a YAML config file, expanding environment variables.
+// An empty path skips the file and uses defaults. Either way, standard
+// providers are then added from GANDALF_<NAME>_API_KEY (see envProviders).
 func Load(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("read config: %w", err)
+	var data []byte
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("read config: %w", err)
+		}
+		data = expandEnv(data)
 	}
-	data = expandEnv(data)
 
 	cfg := &Config{
 		Server: ServerConfig{
@@ -213,10 +510,25 @@ func Load(path string) (*Config, error) {
 			MaxSize:    10_000,
 			DefaultTTL: 5 * time.Minute,
 		},
+		BalancedRouting: BalancedRoutingConfig{
+			CostWeight:    0.5,
+			LatencyWeight: 0.5,
+		},
+		Hedging: HedgingConfig{
+			Percentile: 95,
+			MinSamples: 20,
+			Delay:      time.Second,
+			MaxRatio:   0.1,
+		},
+		OutputFilter: OutputFilterConfig{
+			Action:  "redact",
+			Streams: "pass",
+		},
 	}
 
 	if err := yaml.Unmarshal(data, cfg); err != nil {
 		return nil, fmt.Errorf("parse config: %w", err)
 	}
+	applyEnvProviders(cfg)
 	return cfg, nil
 }
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 )
 
@@ -249,3 +250,99 @@ func TestProviderEntryResolvedAPIKey(t *testing.T) {
 		})
 	}
 }
+
+func TestProviderEntryResolvedAPIKeys(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		entry ProviderEntry
+		want  []string
+	}{
+		{"none", ProviderEntry{}, nil},
+		{"single", ProviderEntry{APIKey: "a"}, []string{"a"}},
+		{"primary first", ProviderEntry{APIKey: "a", APIKeys: []string{"b", "c"}}, []string{"a", "b", "c"}},
+		{"auth key primary", ProviderEntry{APIKey: "a", Auth: &AuthEntry{APIKey: "x"}, APIKeys: []string{"b"}}, []string{"x", "b"}},
+		{"dedup and skip empty", ProviderEntry{APIKey: "a", APIKeys: []string{"", "a", "b"}}, []string{"a", "b"}},
+		{"extra keys only", ProviderEntry{APIKeys: []string{"b"}}, []string{"b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.entry.ResolvedAPIKeys(); !slices.Equal(got, tt.want) {
+				t.Errorf("ResolvedAPIKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadEnvProviders(t *testing.T) {
+	t.Setenv("GANDALF_OPENAI_API_KEY", "sk-env")
+	t.Setenv("GANDALF_ANTHROPIC_API_KEY", "sk-ant-env")
+	t.Setenv("GANDALF_GEMINI_API_KEY", "")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Addr != ":8080" {
+		t.Errorf("addr = %q, want default :8080", cfg.Server.Addr)
+	}
+
+	names := make([]string, 0, len(cfg.Providers))
+	for _, p := range cfg.Providers {
+		names = append(names, p.Name)
+	}
+	if !slices.Equal(names, []string{"openai", "anthropic"}) {
+		t.Fatalf("providers = %v, want [openai anthropic]", names)
+	}
+	if got := cfg.Providers[0].ResolvedAPIKey(); got != "sk-env" {
+		t.Errorf("openai api key = %q, want sk-env", got)
+	}
+	if cfg.Providers[1].BaseURL != "https://api.anthropic.com/v1" {
+		t.Errorf("anthropic base_url = %q", cfg.Providers[1].BaseURL)
+	}
+
+	var aliases []string
+	for _, r := range cfg.Routes {
+		aliases = append(aliases, r.ModelAlias)
+	}
+	if !slices.Contains(aliases, "gpt-4o") || !slices.Contains(aliases, "claude-sonnet-4-6") {
+		t.Errorf("routes = %v, want routes for default models", aliases)
+	}
+}
+
+func TestLoadEnvProvidersExplicitOverride(t *testing.T) {
+	t.Setenv("GANDALF_OPENAI_API_KEY", "sk-env")
+	t.Setenv("GANDALF_ANTHROPIC_API_KEY", "")
+	t.Setenv("GANDALF_GEMINI_API_KEY", "")
+
+	yaml := `
+providers:
+  - name: my-openai
+    type: openai
+    base_url: https://proxy.example.com/v1
+    api_key: sk-file
+routes:
+  - model_alias: gpt-4o
+    targets:
+      - provider: my-openai
+        model: gpt-4o
+`
+	path := filepath.Join(t.TempDir(), "test.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Providers) != 1 || cfg.Providers[0].Name != "my-openai" {
+		t.Errorf("providers = %+v, want only my-openai", cfg.Providers)
+	}
+	if len(cfg.Routes) != 1 || cfg.Routes[0].Targets[0].Provider != "my-openai" {
+		t.Errorf("routes = %+v, want only the file route", cfg.Routes)
+	}
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"slices"
+)
+
+// envProvider is a standard provider that can be configured from the
+// environment alone.
+type envProvider struct {
+	name     string
+	keyEnv   string // API key variable; the provider is added only when set
+	baseURL  string
+	models   []string
+	priority int
+}
+
+// envProviders lists providers auto-created from GANDALF_<NAME>_API_KEY for
+// deployments that run without a config file.
+var envProviders = []envProvider{
+	{"openai", "GANDALF_OPENAI_API_KEY", "https://api.openai.com/v1", []string{"gpt-4o", "gpt-4o-mini", "gpt-4.1"}, 1},
+	{"anthropic", "GANDALF_ANTHROPIC_API_KEY", "https://api.anthropic.com/v1", []string{"claude-sonnet-4-6", "claude-haiku-4-5"}, 2},
+	{"gemini", "GANDALF_GEMINI_API_KEY", "https://generativelanguage.googleapis.com/v1beta", []string{"gemini-2.0-flash", "gemini-2.0-pro"}, 3},
+}
+
+// applyEnvProviders adds a default provider, plus a priority route per model,
+// for each envProviders entry whose key variable is set. Providers already
+// configured with the same name or type are left alone, as are existing
+// routes for the same alias.
+func applyEnvProviders(cfg *Config) {
+	for _, ep := range envProviders {
+		key := os.Getenv(ep.keyEnv)
+		if key == "" {
+			continue
+		}
+		if slices.ContainsFunc(cfg.Providers, func(p ProviderEntry) bool {
+			return p.Name == ep.name || p.ResolvedType() == ep.name
+		}) {
+			continue
+		}
+		cfg.Providers = append(cfg.Providers, ProviderEntry{
+			Name:      ep.name,
+			Type:      ep.name,
+			BaseURL:   ep.baseURL,
+			APIKey:    key,
+			Models:    ep.models,
+			Priority:  ep.priority,
+			Weight:    1,
+			TimeoutMs: 30000,
+		})
+		for _, m := range ep.models {
+			if slices.ContainsFunc(cfg.Routes, func(r RouteEntry) bool { return r.ModelAlias == m }) {
+				continue
+			}
+			cfg.Routes = append(cfg.Routes, RouteEntry{
+				ModelAlias: m,
+				Targets:    []TargetEntry{{Provider: ep.name, Model: m, Priority: 1}},
+				Strategy:   "priority",
+			})
+		}
+		slog.Info("provider configured from environment", "name", ep.name, "env", ep.keyEnv)
+	}
+}
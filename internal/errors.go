@@ -4,15 +4,20 @@ import "errors"
 
 // Sentinel errors for the gateway domain.
 var (
-	ErrUnauthorized    = errors.New("unauthorized")
-	ErrForbidden       = errors.New("forbidden")
-	ErrNotFound        = errors.New("not found")
-	ErrConflict        = errors.New("conflict")
-	ErrRateLimited     = errors.New("rate limited")
-	ErrQuotaExceeded   = errors.New("quota exceeded")
-	ErrModelNotAllowed = errors.New("model not allowed")
-	ErrProviderError   = errors.New("provider error")
-	ErrBadRequest      = errors.New("bad request")
-	ErrKeyExpired      = errors.New("api key expired")
-	ErrKeyBlocked      = errors.New("api key blocked")
+	ErrUnauthorized      = errors.New("unauthorized")
+	ErrForbidden         = errors.New("forbidden")
+	ErrNotFound          = errors.New("not found")
+	ErrConflict          = errors.New("conflict")
+	ErrRateLimited       = errors.New("rate limited")
+	ErrQuotaExceeded     = errors.New("quota exceeded")
+	ErrModelNotAllowed   = errors.New("model not allowed")
+	ErrProviderError     = errors.New("provider error")
+	ErrNoProvider        = errors.New("no available provider for model")
+	ErrDimensionMismatch = errors.New("embedding dimensions mismatch")
+	ErrSchemaViolation   = errors.New("response does not match route schema")
+	ErrBadRequest        = errors.New("bad request")
+	ErrMissingField      = errors.New("missing required field")
+	ErrNoCapableTarget   = errors.New("no route target supports required capability")
+	ErrKeyExpired        = errors.New("api key expired")
+	ErrKeyBlocked        = errors.New("api key blocked")
 )
@@ -75,6 +75,54 @@ type ChatResponse struct {
 	Choices           []Choice `json:"choices"`
 	Usage             *Usage   `json:"usage,omitempty"`
 	SystemFingerprint string   `json:"system_fingerprint,omitempty"`
+
+	// Gandalf is gateway metadata, set only when response metadata is enabled.
+	Gandalf *ResponseMeta `json:"x_gandalf,omitempty"`
+	// Debug is the request debug trace, set only for permitted callers that
+	// send X-Gandalf-Debug: true.
+	Debug *DebugTrace `json:"x_gandalf_debug,omitempty"`
+}
+
+// ResponseMeta describes how gandalf served a response. It is added under the
+// namespaced "x_gandalf" field so strict OpenAI clients can ignore it.
+type ResponseMeta struct {
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"` // provider model, after alias resolution
+	Cached   bool   `json:"cached"`
+}
+
+// DebugTrace records how gandalf handled one request. Upstream errors are
+// reduced to a category and status code, so no provider message, URL, or
+// credential is exposed.
+type DebugTrace struct {
+	Route           []DebugTarget  `json:"route"` // resolved targets, in attempt order
+	Attempts        []DebugAttempt `json:"attempts"`
+	Cache           string         `json:"cache"` // "hit", "miss", or "off"
+	EstimatedTokens int64          `json:"estimated_prompt_tokens"`
+	TotalMs         int64          `json:"total_ms"`
+
+	start time.Time
+}
+
+// Finish sets TotalMs to the time since the trace was enabled.
+func (dt *DebugTrace) Finish() {
+	dt.TotalMs = time.Since(dt.start).Milliseconds()
+}
+
+// DebugTarget is one resolved route target.
+type DebugTarget struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	Priority int    `json:"priority"`
+}
+
+// DebugAttempt is one provider call (or skip) during failover.
+type DebugAttempt struct {
+	Provider  string `json:"provider"`
+	Model     string `json:"model"`
+	Outcome   string `json:"outcome"`          // "ok", "circuit_open", "unavailable", or an error category
+	Status    int    `json:"status,omitempty"` // upstream HTTP status, when known
+	LatencyMs int64  `json:"latency_ms"`
 }
 
 // Choice represents a single completion choice.
@@ -104,6 +152,7 @@ type EmbeddingRequest struct {
 	Model          string          `json:"model"`
 	Input          json.RawMessage `json:"input"`
 	EncodingFormat string          `json:"encoding_format,omitempty"`
+	Dimensions     *int            `json:"dimensions,omitempty"` // output vector size (OpenAI v3 models)
 	User           string          `json:"user,omitempty"`
 }
 
@@ -141,38 +190,70 @@ type Team struct {
 
 // APIKey represents an API key for authentication.
 type APIKey struct {
-	ID            string     `json:"id"`
-	KeyHash       string     `json:"-"`          // SHA-256 hex, never exposed
-	KeyPrefix     string     `json:"key_prefix"` // first 8 chars for display
-	UserID        string     `json:"user_id,omitempty"`
-	TeamID        string     `json:"team_id,omitempty"`
-	OrgID         string     `json:"org_id"`
-	Role          string     `json:"role"`                     // "admin", "member", "viewer", "service_account"
-	AllowedModels []string   `json:"allowed_models,omitempty"` // nil = inherit from team
-	RPMLimit      *int64     `json:"rpm_limit,omitempty"`
-	TPMLimit      *int64     `json:"tpm_limit,omitempty"`
-	MaxBudget     *float64   `json:"max_budget,omitempty"`
-	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
-	Blocked       bool       `json:"blocked"`
-	LastUsedAt    *time.Time `json:"last_used_at,omitempty"`
-	CreatedAt     time.Time  `json:"created_at"`
+	ID                 string     `json:"id"`
+	KeyHash            string     `json:"-"`          // SHA-256 hex, never exposed
+	KeyPrefix          string     `json:"key_prefix"` // first 8 chars for display
+	UserID             string     `json:"user_id,omitempty"`
+	TeamID             string     `json:"team_id,omitempty"`
+	OrgID              string     `json:"org_id"`
+	Role               string     `json:"role"`                     // "admin", "member", "viewer", "service_account"
+	AllowedModels      []string   `json:"allowed_models,omitempty"` // nil = inherit from team
+	RPMLimit           *int64     `json:"rpm_limit,omitempty"`
+	TPMLimit           *int64     `json:"tpm_limit,omitempty"`
+	MaxBudget          *float64   `json:"max_budget,omitempty"`
+	MaxStreams         *int64     `json:"max_streams,omitempty"`         // concurrent streams; nil = server default
+	DefaultModel       string     `json:"default_model,omitempty"`       // used when a request omits model
+	MaxRequests        *int64     `json:"max_requests,omitempty"`        // requests per RequestPeriod; nil = unlimited
+	RequestPeriod      string     `json:"request_period,omitempty"`      // daily, weekly, monthly; "" = never resets
+	Pool               string     `json:"pool,omitempty"`                // key pool within the org; "" = none
+	PreferredProviders []string   `json:"preferred_providers,omitempty"` // tried first, in order, ahead of route order; nil = route order
+	MaxPriority        string     `json:"max_priority,omitempty"`        // highest X-Gandalf-Priority honored: low, normal, high; "" = normal
+	ExpiresAt          *time.Time `json:"expires_at,omitempty"`
+	Blocked            bool       `json:"blocked"`
+	LastUsedAt         *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+}
+
+// BackupKey is an API key as exported in a backup. Unlike APIKey it
+// serializes the key hash so restored keys keep working.
+type BackupKey struct {
+	APIKey
+	KeyHash string `json:"key_hash"`
+}
+
+// Backup is a full export of gateway configuration. Keys carry hashes,
+// never plaintext.
+type Backup struct {
+	Providers []*ProviderConfig `json:"providers"`
+	Routes    []*Route          `json:"routes"`
+	Orgs      []*Organization   `json:"orgs"`
+	Teams     []*Team           `json:"teams"`
+	Keys      []*BackupKey      `json:"keys"`
 }
 
 // Identity is the authenticated caller context attached to request context.
 // Populated by either JWT or API key auth.
 type Identity struct {
-	Subject       string     `json:"subject"` // JWT sub or key prefix
-	KeyID         string     `json:"key_id"`  // API key ID for per-key bucketing
-	UserID        string     `json:"user_id"`
-	TeamID        string     `json:"team_id"`
-	OrgID         string     `json:"org_id"`
-	Role          string     `json:"role"`        // "admin", "member", "viewer", "service_account"
-	Perms         Permission `json:"-"`           // resolved bitmask
-	AuthMethod    string     `json:"auth_method"` // "jwt" or "apikey"
-	RPMLimit      int64      `json:"-"`           // effective RPM limit (0 = unlimited)
-	TPMLimit      int64      `json:"-"`           // effective TPM limit (0 = unlimited)
-	MaxBudget     float64    `json:"-"`           // max spend USD (0 = unlimited)
-	AllowedModels []string   `json:"-"`           // nil = all models allowed
+	Subject            string      `json:"subject"` // JWT sub or key prefix
+	KeyID              string      `json:"key_id"`  // API key ID for per-key bucketing
+	UserID             string      `json:"user_id"`
+	TeamID             string      `json:"team_id"`
+	OrgID              string      `json:"org_id"`
+	Role               string      `json:"role"`        // "admin", "member", "viewer", "service_account"
+	Perms              Permission  `json:"-"`           // resolved bitmask
+	AuthMethod         string      `json:"auth_method"` // "jwt" or "apikey"
+	RPMLimit           int64       `json:"-"`           // effective RPM limit (0 = unlimited)
+	TPMLimit           int64       `json:"-"`           // effective TPM limit (0 = unlimited)
+	MaxBudget          float64     `json:"-"`           // max spend USD (0 = unlimited)
+	MaxStreams         int64       `json:"-"`           // concurrent stream limit (0 = server default)
+	DefaultModel       string      `json:"-"`           // model for requests that omit one ("" = none)
+	MaxRequests        int64       `json:"-"`           // requests per RequestPeriod (0 = unlimited)
+	RequestPeriod      string      `json:"-"`           // request quota period ("" = never resets)
+	AllowedModels      []string    `json:"-"`           // nil = all models allowed
+	PoolMembers        []*Identity `json:"-"`           // other keys in this key's pool, tried when it is RPM-limited
+	PoolKey            *Identity   `json:"-"`           // pool member charged for this request (nil = this key)
+	PreferredProviders []string    `json:"-"`           // providers tried ahead of route order (nil = route order)
+	MaxPriority        string      `json:"-"`           // highest honored X-Gandalf-Priority ("" = normal)
 }
 
 // --- RBAC ---
@@ -189,8 +270,19 @@ const (
 	PermManageProviders                        // configure upstream providers
 	PermManageRoutes                           // configure model routing
 	PermManageOrgs                             // manage orgs and teams
+	PermManageAllOrgs                          // create and manage every org, not just the caller's
 )
 
+// Billed returns the identity a request's rate limits, quotas, and usage
+// are charged to: the pool member it fell back to, else id itself. Access
+// checks and ownership always use id.
+func (id *Identity) Billed() *Identity {
+	if id == nil || id.PoolKey == nil {
+		return id
+	}
+	return id.PoolKey
+}
+
 // Can reports whether the identity has the given permission.
 func (id *Identity) Can(p Permission) bool { return id.Perms&p == p }
 
@@ -212,6 +304,7 @@ func ValidRole(role string) bool {
 
 // RolePermissions maps role names to their permission bitmasks.
 var RolePermissions = map[string]Permission{
+	"superadmin":      PermUseModels | PermManageOwnKeys | PermViewOwnUsage | PermViewAllUsage | PermManageAllKeys | PermManageProviders | PermManageRoutes | PermManageOrgs | PermManageAllOrgs,
 	"admin":           PermUseModels | PermManageOwnKeys | PermViewOwnUsage | PermViewAllUsage | PermManageAllKeys | PermManageProviders | PermManageRoutes | PermManageOrgs,
 	"member":          PermUseModels | PermManageOwnKeys | PermViewOwnUsage,
 	"viewer":          PermViewOwnUsage | PermViewAllUsage,
@@ -235,6 +328,12 @@ type ProviderConfig struct {
 	TimeoutMs int      `json:"timeout_ms"`
 }
 
+// ModelPrice is the USD list price of a provider model per 1M tokens.
+type ModelPrice struct {
+	InputPer1M  float64 `json:"input_per_1m"`
+	OutputPer1M float64 `json:"output_per_1m"`
+}
+
 // Route maps a model alias to provider targets.
 type Route struct {
 	ID         string          `json:"id"`
@@ -242,6 +341,42 @@ type Route struct {
 	Targets    json.RawMessage `json:"targets"` // []RouteTarget as JSON
 	Strategy   string          `json:"strategy"`
 	CacheTTLs  int             `json:"cache_ttl_s"`
+	// DefaultTemperature is applied when the client omits temperature.
+	// nil = leave the provider default in place.
+	DefaultTemperature *float64 `json:"default_temperature,omitempty"`
+	// EmbeddingDimensions is the expected embedding vector size. When set,
+	// responses of any other size fail over to the next target. 0 = no check.
+	EmbeddingDimensions int `json:"embedding_dimensions,omitempty"`
+	// DeniedTools lists tool (function) names that chat requests on this
+	// route may not declare. nil = all tools allowed.
+	DeniedTools []string `json:"denied_tools,omitempty"`
+	// CacheStopOnly stores only responses whose choices all finished with
+	// "stop", so truncated (length) or filtered answers are never replayed.
+	CacheStopOnly bool `json:"cache_stop_only,omitempty"`
+	// ResponseSchema is a JSON Schema every chat response's content must
+	// satisfy, whether or not the client asked for structured output.
+	// nil = no check.
+	ResponseSchema json.RawMessage `json:"response_schema,omitempty"`
+	// SchemaPolicy is what happens when a response breaks ResponseSchema:
+	// SchemaReject (default), SchemaRetry, or SchemaAnnotate.
+	SchemaPolicy string `json:"schema_policy,omitempty"`
+}
+
+// Route schema policies (Route.SchemaPolicy).
+const (
+	SchemaReject   = "reject"   // fail the request with ErrSchemaViolation
+	SchemaRetry    = "retry"    // ask the next target (or the last one again), then reject
+	SchemaAnnotate = "annotate" // return the response, flagged via SetSchemaViolation
+)
+
+// IsSchemaPolicy reports whether p is a valid Route.SchemaPolicy. Empty
+// means SchemaReject.
+func IsSchemaPolicy(p string) bool {
+	switch p {
+	case "", SchemaReject, SchemaRetry, SchemaAnnotate:
+		return true
+	}
+	return false
 }
 
 // RouteTarget is a single target within a route.
@@ -252,6 +387,41 @@ type RouteTarget struct {
 	Weight     int    `json:"weight"`
 }
 
+// MigrateTargets moves every target in a route's targets JSON from provider
+// from to provider to, keeping model, priority, and weight, and reports
+// whether any target matched. With keepFailover, each moved target also
+// stays on from, ranked after all other targets so it only takes traffic
+// when the rest fail.
+func MigrateTargets(targets json.RawMessage, from, to string, keepFailover bool) (json.RawMessage, bool, error) {
+	var ts []RouteTarget
+	if err := json.Unmarshal(targets, &ts); err != nil {
+		return nil, false, err
+	}
+	last := 0
+	for _, t := range ts {
+		last = max(last, t.Priority)
+	}
+	moved := 0
+	var failover []RouteTarget
+	for i, t := range ts {
+		if t.ProviderID != from {
+			continue
+		}
+		moved++
+		ts[i].ProviderID = to
+		if keepFailover {
+			last++
+			t.Priority = last
+			failover = append(failover, t)
+		}
+	}
+	if moved == 0 {
+		return targets, false, nil
+	}
+	out, err := json.Marshal(append(ts, failover...))
+	return out, err == nil, err
+}
+
 // UsageRecord represents a single API usage event.
 type UsageRecord struct {
 	ID               string    `json:"id"`
@@ -269,11 +439,59 @@ type UsageRecord struct {
 	CostUSD          float64   `json:"cost_usd,omitempty"`
 	Cached           bool      `json:"cached"`
 	LatencyMs        int       `json:"latency_ms"`
+	TTFBMs           int       `json:"ttfb_ms,omitempty"` // streams: time until the first content chunk was sent (0 = not streamed)
 	StatusCode       int       `json:"status_code"`
+	Canceled         bool      `json:"canceled,omitempty"` // the client disconnected mid-stream; tokens cover what was delivered
 	RequestID        string    `json:"request_id"`
+	EndUser          string    `json:"end_user,omitempty"` // client-supplied "user" request field
+	Tags             []string  `json:"tags,omitempty"`     // client-supplied request tags
 	CreatedAt        time.Time `json:"created_at"`
 }
 
+// Thread is a server-side conversation. Its stored messages are prepended to
+// each new turn so clients only send what's new.
+type Thread struct {
+	ID        string    `json:"id"`
+	KeyID     string    `json:"key_id"`
+	OrgID     string    `json:"org_id"`
+	Messages  []Message `json:"messages"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// EvalCapture is one labeled request/response pair kept for evaluation.
+// Shadow evaluation stores the primary and every shadow response under a
+// shared GroupID for offline comparison; a sampled capture is its own group.
+type EvalCapture struct {
+	ID         string          `json:"id"`
+	GroupID    string          `json:"group_id"`
+	RequestID  string          `json:"request_id,omitempty"`
+	OrgID      string          `json:"org_id,omitempty"` // the caller's org
+	Label      string          `json:"label"`            // "primary", "shadow", or "sample"
+	ProviderID string          `json:"provider_id"`
+	Model      string          `json:"model"`
+	Request    json.RawMessage `json:"request"`
+	Response   json.RawMessage `json:"response,omitempty"` // nil when Error is set
+	Error      string          `json:"error,omitempty"`
+	LatencyMs  int             `json:"latency_ms"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditEntry records one configuration change made through the admin API.
+// Diff maps each changed field to its old and new values, as
+// {"field": {"old": ..., "new": ...}}; creates have no old values and
+// deletes no new ones.
+type AuditEntry struct {
+	ID           string          `json:"id"`
+	ActorKeyID   string          `json:"actor_key_id"`     // key ID of the caller; empty for JWT callers without one
+	ActorSubject string          `json:"actor_subject"`    // JWT sub or key prefix
+	OrgID        string          `json:"org_id,omitempty"` // the actor's org
+	Action       string          `json:"action"`           // "create", "update", "delete", "migrate", "restore"
+	TargetType   string          `json:"target_type"`      // "provider", "route", "key", "config"
+	TargetID     string          `json:"target_id,omitempty"`
+	Diff         json.RawMessage `json:"diff,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
 // UsageRollup represents a pre-aggregated usage summary for a time bucket.
 type UsageRollup struct {
 	OrgID            string  `json:"org_id"`
@@ -287,6 +505,21 @@ type UsageRollup struct {
 	TotalTokens      int     `json:"total_tokens"`
 	CostUSD          float64 `json:"cost_usd"`
 	CachedCount      int     `json:"cached_count"`
+	StreamCount      int     `json:"stream_count"` // records with a TTFB (streamed requests)
+	TTFBMsSum        int64   `json:"ttfb_ms_sum"`  // sum of TTFBMs; mean TTFB = ttfb_ms_sum / stream_count
+}
+
+// UsageAnomaly flags an hour whose spend was far above its baseline, for a
+// key or, with KeyID empty, a whole org.
+type UsageAnomaly struct {
+	OrgID      string    `json:"org_id"`
+	KeyID      string    `json:"key_id,omitempty"` // empty = org-wide spend
+	Bucket     string    `json:"bucket"`           // ISO 8601 start of the anomalous hour
+	CostUSD    float64   `json:"cost_usd"`
+	MeanUSD    float64   `json:"mean_usd"`   // baseline hourly spend
+	StdDevUSD  float64   `json:"stddev_usd"` // baseline standard deviation
+	ZScore     float64   `json:"z_score"`    // (cost_usd - mean_usd) / stddev_usd
+	DetectedAt time.Time `json:"detected_at"`
 }
 
 // UsageFilter selects usage records for querying.
@@ -300,6 +533,28 @@ type UsageFilter struct {
 	Limit  int
 }
 
+// AuditFilter selects audit entries for querying.
+type AuditFilter struct {
+	OrgID      string // the actor's org; "" = all orgs
+	ActorKeyID string
+	TargetType string
+	TargetID   string
+	Since      string // RFC3339
+	Until      string // RFC3339
+	Offset     int
+	Limit      int
+}
+
+// EvalCaptureFilter selects eval captures for export.
+type EvalCaptureFilter struct {
+	OrgID string
+	Label string
+	Model string // provider model that produced the response
+	Since string // RFC3339
+	Until string // RFC3339
+	Limit int
+}
+
 // RollupFilter selects rollups for querying.
 type RollupFilter struct {
 	OrgID  string
@@ -320,8 +575,17 @@ const ctxKeyMeta contextKey = 0
 // The Identity field is set later by the authenticate middleware via mutation
 // of the same pointer, avoiding a second context.WithValue + Request.WithContext.
 type requestMeta struct {
-	RequestID string
-	Identity  *Identity
+	RequestID   string
+	Identity    *Identity
+	Provider    string      // serving provider, set once routing succeeds
+	Model       string      // provider-side model of the serving target
+	Fingerprint string      // semantic request fingerprint (chat completions)
+	Debug       *DebugTrace // non-nil when the caller asked for a debug trace
+	Require     []string    // capabilities the serving target must have
+
+	SchemaViolation string // why the response broke its route schema (annotate policy)
+
+	Betas map[string][]string // beta features requested per provider type
 }
 
 // metaFromContext returns the requestMeta stored in ctx, or nil.
@@ -362,6 +626,120 @@ func ContextWithRequestID(ctx context.Context, id string) context.Context {
 	return context.WithValue(ctx, ctxKeyMeta, &requestMeta{RequestID: id})
 }
 
+// SetRequestTarget records which provider and model served the request on the
+// existing requestMeta so request-level logging can report them. No-op when
+// ctx carries no metadata.
+func SetRequestTarget(ctx context.Context, provider, model string) {
+	if m := metaFromContext(ctx); m != nil {
+		m.Provider = provider
+		m.Model = model
+	}
+}
+
+// RequestTargetFromContext returns the provider and model recorded by
+// SetRequestTarget, or empty strings if none was recorded.
+func RequestTargetFromContext(ctx context.Context) (provider, model string) {
+	if m := metaFromContext(ctx); m != nil {
+		return m.Provider, m.Model
+	}
+	return "", ""
+}
+
+// SetRequestFingerprint records the request fingerprint on the existing
+// requestMeta so request-level logging can report it. No-op when ctx
+// carries no metadata.
+func SetRequestFingerprint(ctx context.Context, fingerprint string) {
+	if m := metaFromContext(ctx); m != nil {
+		m.Fingerprint = fingerprint
+	}
+}
+
+// RequestFingerprintFromContext returns the fingerprint recorded by
+// SetRequestFingerprint, or "" if none was recorded.
+func RequestFingerprintFromContext(ctx context.Context) string {
+	if m := metaFromContext(ctx); m != nil {
+		return m.Fingerprint
+	}
+	return ""
+}
+
+// EnableDebugTrace attaches an empty debug trace to the request metadata and
+// returns it. Returns nil when ctx carries no metadata.
+func EnableDebugTrace(ctx context.Context) *DebugTrace {
+	m := metaFromContext(ctx)
+	if m == nil {
+		return nil
+	}
+	m.Debug = &DebugTrace{Cache: "off", start: time.Now()}
+	return m.Debug
+}
+
+// DebugTraceFromContext returns the debug trace enabled for this request, or
+// nil when none was requested.
+func DebugTraceFromContext(ctx context.Context) *DebugTrace {
+	if m := metaFromContext(ctx); m != nil {
+		return m.Debug
+	}
+	return nil
+}
+
+// SetRequiredCapabilities records capabilities (see Capabilities.Supports)
+// the serving target must have, on top of those implied by the request
+// content. No-op when ctx carries no metadata.
+func SetRequiredCapabilities(ctx context.Context, names []string) {
+	if m := metaFromContext(ctx); m != nil {
+		m.Require = names
+	}
+}
+
+// RequiredCapabilitiesFromContext returns the capabilities recorded by
+// SetRequiredCapabilities.
+func RequiredCapabilitiesFromContext(ctx context.Context) []string {
+	if m := metaFromContext(ctx); m != nil {
+		return m.Require
+	}
+	return nil
+}
+
+// SetSchemaViolation records that the served response broke its route's
+// response schema, for the server to report. No-op when ctx carries no
+// metadata.
+func SetSchemaViolation(ctx context.Context, reason string) {
+	if m := metaFromContext(ctx); m != nil {
+		m.SchemaViolation = reason
+	}
+}
+
+// SchemaViolationFromContext returns the reason recorded by
+// SetSchemaViolation, or "" if the response conformed.
+func SchemaViolationFromContext(ctx context.Context) string {
+	if m := metaFromContext(ctx); m != nil {
+		return m.SchemaViolation
+	}
+	return ""
+}
+
+// SetBetaFeatures records the beta features (e.g. anthropic-beta values)
+// the client asked providers of providerType to enable. Adapters of other
+// types never see them. No-op when ctx carries no metadata.
+func SetBetaFeatures(ctx context.Context, providerType string, features []string) {
+	if m := metaFromContext(ctx); m != nil {
+		if m.Betas == nil {
+			m.Betas = make(map[string][]string, 1)
+		}
+		m.Betas[providerType] = features
+	}
+}
+
+// BetaFeaturesFromContext returns the beta features recorded for
+// providerType by SetBetaFeatures.
+func BetaFeaturesFromContext(ctx context.Context, providerType string) []string {
+	if m := metaFromContext(ctx); m != nil {
+		return m.Betas[providerType]
+	}
+	return nil
+}
+
 // --- Native passthrough ---
 
 // NativeProxy is an optional interface that providers can implement to support
@@ -371,10 +749,107 @@ type NativeProxy interface {
 	// ProxyRequest forwards a raw HTTP request to the provider's API.
 	// path is the provider-relative path (e.g. "/messages").
 	// The implementation handles auth headers, URL construction, and
-	// response streaming (flush-on-read for SSE/NDJSON).
+	// response streaming (flush-on-read for SSE/NDJSON). An error returned
+	// before anything is written to w is reported to the client by the
+	// gateway, in the native API's error format.
 	ProxyRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, path string) error
 }
 
+// --- Model capabilities ---
+
+// Capabilities reports which operations a model supports.
+type Capabilities struct {
+	Chat       bool `json:"chat"`
+	Embeddings bool `json:"embeddings"`
+	Tools      bool `json:"tools"`
+	Vision     bool `json:"vision"`
+	Streaming  bool `json:"streaming"`
+}
+
+// Supports reports whether c includes the named capability: "chat",
+// "embeddings", "tools", "vision", or "streaming". Unknown names report
+// false; see IsCapability.
+func (c Capabilities) Supports(name string) bool {
+	switch name {
+	case "chat":
+		return c.Chat
+	case "embeddings":
+		return c.Embeddings
+	case "tools":
+		return c.Tools
+	case "vision":
+		return c.Vision
+	case "streaming":
+		return c.Streaming
+	}
+	return false
+}
+
+// IsCapability reports whether name is a capability Supports understands.
+func IsCapability(name string) bool {
+	return Capabilities{Chat: true, Embeddings: true, Tools: true, Vision: true, Streaming: true}.Supports(name)
+}
+
+// CapabilityReporter is an optional interface that providers can implement to
+// report per-model capabilities. Checked via type assertion; providers that
+// don't implement it rely on config overrides.
+type CapabilityReporter interface {
+	// Capabilities returns the capabilities of the given provider-side model.
+	Capabilities(model string) Capabilities
+}
+
+// RequiredFieldsReporter is an optional interface for providers whose API
+// rejects chat requests that omit certain fields. ProxyService checks the
+// fields before the upstream call and fails with ErrMissingField instead of
+// forwarding a request the provider would reject.
+type RequiredFieldsReporter interface {
+	// RequiredChatFields returns ChatRequest JSON field names (e.g.
+	// "max_tokens") that must be set. Called per request; return a shared
+	// slice, not a fresh one.
+	RequiredChatFields() []string
+}
+
+// SamplingParamsReporter is an optional interface for providers that
+// reject or misbehave on some sampling parameters. ProxyService strips the
+// unsupported ones from a request before the upstream call instead of
+// forwarding them to fail.
+type SamplingParamsReporter interface {
+	// SupportedSamplingParams returns the ChatRequest JSON field names of
+	// the sampling parameters the provider accepts (e.g. "temperature").
+	// Called per request; return a shared slice, not a fresh one.
+	SupportedSamplingParams() []string
+}
+
+// CapabilityOverride selectively replaces reported capabilities.
+// Nil fields leave the reported value unchanged.
+type CapabilityOverride struct {
+	Chat       *bool
+	Embeddings *bool
+	Tools      *bool
+	Vision     *bool
+	Streaming  *bool
+}
+
+// Apply returns c with every non-nil override field applied.
+func (o CapabilityOverride) Apply(c Capabilities) Capabilities {
+	if o.Chat != nil {
+		c.Chat = *o.Chat
+	}
+	if o.Embeddings != nil {
+		c.Embeddings = *o.Embeddings
+	}
+	if o.Tools != nil {
+		c.Tools = *o.Tools
+	}
+	if o.Vision != nil {
+		c.Vision = *o.Vision
+	}
+	if o.Streaming != nil {
+		c.Streaming = *o.Streaming
+	}
+	return c
+}
+
 // --- Shared constants and helpers ---
 
 // APIKeyPrefix is the prefix for all Gandalf API keys.
@@ -207,6 +207,23 @@ func TestContextWithIdentity_IdentityFromContext(t *testing.T) {
 	})
 }
 
+func TestIdentity_Billed(t *testing.T) {
+	t.Parallel()
+
+	var none *Identity
+	if none.Billed() != nil {
+		t.Error("nil identity: want nil")
+	}
+	id := &Identity{KeyID: "key-a"}
+	if id.Billed() != id {
+		t.Error("unpooled: want the identity itself")
+	}
+	id.PoolKey = &Identity{KeyID: "key-b"}
+	if got := id.Billed().KeyID; got != "key-b" {
+		t.Errorf("pooled: billed key = %q, want key-b", got)
+	}
+}
+
 func TestIsModelAllowed(t *testing.T) {
 	t.Parallel()
 
@@ -266,3 +283,53 @@ func TestMetaFromContext(t *testing.T) {
 		}
 	})
 }
+
+func TestSetRequestTarget(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no-op without meta", func(t *testing.T) {
+		t.Parallel()
+		ctx := context.Background()
+		SetRequestTarget(ctx, "openai", "gpt-4o")
+		if p, m := RequestTargetFromContext(ctx); p != "" || m != "" {
+			t.Errorf("got %q/%q, want empty", p, m)
+		}
+	})
+
+	t.Run("visible through derived ctx", func(t *testing.T) {
+		t.Parallel()
+		ctx := ContextWithRequestID(context.Background(), "r3")
+		child, cancel := context.WithCancel(ctx)
+		defer cancel()
+		SetRequestTarget(child, "anthropic", "claude-sonnet-4-6")
+		if p, m := RequestTargetFromContext(ctx); p != "anthropic" || m != "claude-sonnet-4-6" {
+			t.Errorf("got %q/%q, want anthropic/claude-sonnet-4-6", p, m)
+		}
+	})
+}
+
+func TestCapabilityOverride_Apply(t *testing.T) {
+	t.Parallel()
+
+	yes, no := true, false
+	base := Capabilities{Chat: true, Tools: true, Streaming: true}
+
+	tests := []struct {
+		name     string
+		override CapabilityOverride
+		want     Capabilities
+	}{
+		{"empty override keeps base", CapabilityOverride{}, base},
+		{"enable vision", CapabilityOverride{Vision: &yes}, Capabilities{Chat: true, Tools: true, Vision: true, Streaming: true}},
+		{"disable tools", CapabilityOverride{Tools: &no}, Capabilities{Chat: true, Streaming: true}},
+		{"all fields", CapabilityOverride{Chat: &no, Embeddings: &yes, Tools: &no, Vision: &no, Streaming: &no}, Capabilities{Embeddings: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.override.Apply(base); got != tt.want {
+				t.Errorf("Apply = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
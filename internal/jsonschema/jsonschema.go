@@ -0,0 +1,431 @@
+// Package jsonschema validates JSON documents against a practical subset of
+// JSON Schema: type, enum, const, object properties, arrays, string length
+// and pattern, numeric bounds, and anyOf/allOf/oneOf. Keywords outside the
+// subset fail compilation rather than being silently ignored, so a schema
+// never looks stricter than it is. Annotation keywords (title, description,
+// format, ...) are accepted and ignored.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a compiled schema. Use Compile to build one.
+type Schema struct {
+	reject bool // the boolean schema false
+
+	types    []string
+	enum     []any
+	constVal any
+	hasConst bool
+
+	properties map[string]*Schema
+	required   []string
+	additional *Schema // nil = any additional property allowed
+
+	items              *Schema
+	minItems, maxItems int // -1 = unset
+
+	minLength, maxLength int // -1 = unset
+	pattern              *regexp.Regexp
+
+	minimum, maximum, exclusiveMin, exclusiveMax *float64
+
+	anyOf, allOf, oneOf []*Schema
+}
+
+// annotations are keywords that carry no validation meaning.
+var annotations = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true,
+	"default": true, "examples": true, "format": true, "deprecated": true,
+	"readOnly": true, "writeOnly": true,
+}
+
+var jsonTypes = []string{"null", "boolean", "object", "array", "number", "integer", "string"}
+
+// Compile parses a schema document.
+func Compile(raw []byte) (*Schema, error) {
+	doc, err := decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("jsonschema: %w", err)
+	}
+	return compile(doc, "$")
+}
+
+func compile(node any, path string) (*Schema, error) {
+	if b, ok := node.(bool); ok {
+		return &Schema{reject: !b, minItems: -1, maxItems: -1, minLength: -1, maxLength: -1}, nil
+	}
+	obj, ok := node.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("jsonschema: %s: schema must be an object or boolean", path)
+	}
+	s := &Schema{minItems: -1, maxItems: -1, minLength: -1, maxLength: -1}
+	for _, kw := range sortedKeys(obj) {
+		v := obj[kw]
+		at := path + "." + kw
+		var err error
+		switch kw {
+		case "type":
+			s.types, err = compileTypes(v)
+		case "enum":
+			arr, ok := v.([]any)
+			if !ok {
+				err = errors.New("must be an array")
+			}
+			s.enum = arr
+		case "const":
+			s.constVal, s.hasConst = v, true
+		case "properties":
+			props, ok := v.(map[string]any)
+			if !ok {
+				err = errors.New("must be an object")
+				break
+			}
+			s.properties = make(map[string]*Schema, len(props))
+			for name, sub := range props {
+				if s.properties[name], err = compile(sub, at+"."+name); err != nil {
+					return nil, err
+				}
+			}
+		case "required":
+			s.required, err = stringList(v)
+		case "additionalProperties":
+			s.additional, err = compile(v, at)
+		case "items":
+			s.items, err = compile(v, at)
+		case "minItems":
+			s.minItems, err = count(v)
+		case "maxItems":
+			s.maxItems, err = count(v)
+		case "minLength":
+			s.minLength, err = count(v)
+		case "maxLength":
+			s.maxLength, err = count(v)
+		case "pattern":
+			p, ok := v.(string)
+			if !ok {
+				err = errors.New("must be a string")
+				break
+			}
+			s.pattern, err = regexp.Compile(p)
+		case "minimum":
+			s.minimum, err = bound(v)
+		case "maximum":
+			s.maximum, err = bound(v)
+		case "exclusiveMinimum":
+			s.exclusiveMin, err = bound(v)
+		case "exclusiveMaximum":
+			s.exclusiveMax, err = bound(v)
+		case "anyOf":
+			s.anyOf, err = compileList(v, at)
+		case "allOf":
+			s.allOf, err = compileList(v, at)
+		case "oneOf":
+			s.oneOf, err = compileList(v, at)
+		default:
+			if !annotations[kw] {
+				return nil, fmt.Errorf("jsonschema: %s: unsupported keyword %q", path, kw)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("jsonschema: %s: %w", at, err)
+		}
+	}
+	return s, nil
+}
+
+func compileTypes(v any) ([]string, error) {
+	var types []string
+	switch t := v.(type) {
+	case string:
+		types = []string{t}
+	case []any:
+		var err error
+		if types, err = stringList(t); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("must be a string or array of strings")
+	}
+	for _, t := range types {
+		if !slices.Contains(jsonTypes, t) {
+			return nil, fmt.Errorf("unknown type %q", t)
+		}
+	}
+	return types, nil
+}
+
+func compileList(v any, path string) ([]*Schema, error) {
+	arr, ok := v.([]any)
+	if !ok || len(arr) == 0 {
+		return nil, errors.New("must be a non-empty array")
+	}
+	out := make([]*Schema, len(arr))
+	for i, sub := range arr {
+		var err error
+		if out[i], err = compile(sub, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func stringList(v any) ([]string, error) {
+	arr, ok := v.([]any)
+	if !ok {
+		return nil, errors.New("must be an array of strings")
+	}
+	out := make([]string, len(arr))
+	for i, e := range arr {
+		if out[i], ok = e.(string); !ok {
+			return nil, errors.New("must be an array of strings")
+		}
+	}
+	return out, nil
+}
+
+func count(v any) (int, error) {
+	f, ok := number(v)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return 0, errors.New("must be a non-negative integer")
+	}
+	return int(f), nil
+}
+
+func bound(v any) (*float64, error) {
+	f, ok := number(v)
+	if !ok {
+		return nil, errors.New("must be a number")
+	}
+	return &f, nil
+}
+
+// ValidationError reports the first place a document breaks its schema.
+type ValidationError struct {
+	Path    string // e.g. $.items[2].name
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidateJSON decodes data and validates it. Malformed JSON is reported as
+// a ValidationError at the root.
+func (s *Schema) ValidateJSON(data []byte) error {
+	doc, err := decode(data)
+	if err != nil {
+		return &ValidationError{Path: "$", Message: "not valid JSON"}
+	}
+	return s.validate(doc, "$")
+}
+
+func (s *Schema) validate(v any, path string) error {
+	fail := func(format string, args ...any) error {
+		return &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)}
+	}
+	if s.reject {
+		return fail("not allowed")
+	}
+	if len(s.types) > 0 && !slices.ContainsFunc(s.types, func(t string) bool { return hasType(v, t) }) {
+		return fail("got %s, want %s", typeOf(v), joinTypes(s.types))
+	}
+	if s.enum != nil && !slices.ContainsFunc(s.enum, func(e any) bool { return equal(e, v) }) {
+		return fail("value is not one of the allowed values")
+	}
+	if s.hasConst && !equal(s.constVal, v) {
+		return fail("value does not match const")
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		for _, name := range s.required {
+			if _, ok := val[name]; !ok {
+				return fail("missing required property %q", name)
+			}
+		}
+		for _, name := range sortedKeys(val) {
+			at := path + "." + name
+			if sub, ok := s.properties[name]; ok {
+				if err := sub.validate(val[name], at); err != nil {
+					return err
+				}
+			} else if s.additional != nil {
+				if s.additional.reject {
+					return &ValidationError{Path: at, Message: "additional property not allowed"}
+				}
+				if err := s.additional.validate(val[name], at); err != nil {
+					return err
+				}
+			}
+		}
+	case []any:
+		if s.minItems >= 0 && len(val) < s.minItems {
+			return fail("got %d items, want at least %d", len(val), s.minItems)
+		}
+		if s.maxItems >= 0 && len(val) > s.maxItems {
+			return fail("got %d items, want at most %d", len(val), s.maxItems)
+		}
+		if s.items != nil {
+			for i, e := range val {
+				if err := s.items.validate(e, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(val)
+		if s.minLength >= 0 && n < s.minLength {
+			return fail("got %d characters, want at least %d", n, s.minLength)
+		}
+		if s.maxLength >= 0 && n > s.maxLength {
+			return fail("got %d characters, want at most %d", n, s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(val) {
+			return fail("does not match pattern %q", s.pattern.String())
+		}
+	case json.Number:
+		f, _ := val.Float64()
+		switch {
+		case s.minimum != nil && f < *s.minimum:
+			return fail("%s is less than minimum %s", val, formatFloat(*s.minimum))
+		case s.maximum != nil && f > *s.maximum:
+			return fail("%s is greater than maximum %s", val, formatFloat(*s.maximum))
+		case s.exclusiveMin != nil && f <= *s.exclusiveMin:
+			return fail("%s is not greater than %s", val, formatFloat(*s.exclusiveMin))
+		case s.exclusiveMax != nil && f >= *s.exclusiveMax:
+			return fail("%s is not less than %s", val, formatFloat(*s.exclusiveMax))
+		}
+	}
+
+	for _, sub := range s.allOf {
+		if err := sub.validate(v, path); err != nil {
+			return err
+		}
+	}
+	if s.anyOf != nil && !slices.ContainsFunc(s.anyOf, func(sub *Schema) bool { return sub.validate(v, path) == nil }) {
+		return fail("does not match any schema in anyOf")
+	}
+	if s.oneOf != nil {
+		matched := 0
+		for _, sub := range s.oneOf {
+			if sub.validate(v, path) == nil {
+				matched++
+			}
+		}
+		if matched != 1 {
+			return fail("matches %d schemas in oneOf, want exactly 1", matched)
+		}
+	}
+	return nil
+}
+
+func decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("trailing data after JSON value")
+	}
+	return v, nil
+}
+
+func hasType(v any, t string) bool {
+	switch t {
+	case "integer":
+		f, ok := number(v)
+		return ok && f == math.Trunc(f)
+	case "number":
+		_, ok := v.(json.Number)
+		return ok
+	}
+	return typeOf(v) == t
+}
+
+func typeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func joinTypes(types []string) string {
+	if len(types) == 1 {
+		return types[0]
+	}
+	return "one of " + strings.Join(types, ", ")
+}
+
+func number(v any) (float64, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+// equal compares decoded JSON values, treating numbers by value so 1 and
+// 1.0 are equal.
+func equal(a, b any) bool {
+	switch av := a.(type) {
+	case json.Number:
+		af, aok := number(av)
+		bf, bok := number(b)
+		return aok && bok && af == bf
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, e := range av {
+			if o, ok := bv[k]; !ok || !equal(e, o) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		bv, ok := b.([]any)
+		return ok && slices.EqualFunc(av, bv, equal)
+	}
+	return a == b
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// sortedKeys returns m's keys in order, so the first error reported for a
+// document is deterministic.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
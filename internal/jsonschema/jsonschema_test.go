@@ -0,0 +1,118 @@
+package jsonschema
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const ticketSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"title": "Ticket",
+	"type": "object",
+	"required": ["priority", "summary"],
+	"additionalProperties": false,
+	"properties": {
+		"priority": {"enum": ["low", "high"]},
+		"summary": {"type": "string", "minLength": 3, "maxLength": 40},
+		"tags": {"type": "array", "items": {"type": "string", "pattern": "^[a-z]+$"}, "maxItems": 2},
+		"estimate": {"type": ["integer", "null"], "minimum": 1, "exclusiveMaximum": 10},
+		"owner": {"anyOf": [{"type": "string"}, {"type": "object", "required": ["id"]}]}
+	}
+}`
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	s, err := Compile([]byte(ticketSchema))
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	tests := []struct {
+		name, doc, wantPath string // wantPath "" = valid
+	}{
+		{"minimal", `{"priority":"low","summary":"fix it"}`, ""},
+		{"full", `{"priority":"high","summary":"fix it","tags":["ui"],"estimate":3.0,"owner":{"id":7}}`, ""},
+		{"null estimate", `{"priority":"low","summary":"fix it","estimate":null}`, ""},
+		{"not an object", `["low"]`, "$"},
+		{"not JSON", `priority: low`, "$"},
+		{"missing required", `{"priority":"low"}`, "$"},
+		{"enum", `{"priority":"urgent","summary":"fix it"}`, "$.priority"},
+		{"too short", `{"priority":"low","summary":"no"}`, "$.summary"},
+		{"extra property", `{"priority":"low","summary":"fix it","color":"red"}`, "$.color"},
+		{"pattern", `{"priority":"low","summary":"fix it","tags":["UI"]}`, "$.tags[0]"},
+		{"max items", `{"priority":"low","summary":"fix it","tags":["a","b","c"]}`, "$.tags"},
+		{"not integer", `{"priority":"low","summary":"fix it","estimate":2.5}`, "$.estimate"},
+		{"below minimum", `{"priority":"low","summary":"fix it","estimate":0}`, "$.estimate"},
+		{"exclusive maximum", `{"priority":"low","summary":"fix it","estimate":10}`, "$.estimate"},
+		{"anyOf", `{"priority":"low","summary":"fix it","owner":{}}`, "$.owner"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.ValidateJSON([]byte(tt.doc))
+			if tt.wantPath == "" {
+				if err != nil {
+					t.Errorf("ValidateJSON: %v", err)
+				}
+				return
+			}
+			var ve *ValidationError
+			if !errors.As(err, &ve) {
+				t.Fatalf("err = %v, want a ValidationError", err)
+			}
+			if ve.Path != tt.wantPath {
+				t.Errorf("path = %q, want %q (%v)", ve.Path, tt.wantPath, err)
+			}
+		})
+	}
+}
+
+func TestValidateOneOfAndConst(t *testing.T) {
+	t.Parallel()
+	s, err := Compile([]byte(`{"oneOf":[{"const":1},{"type":"number","minimum":0}]}`))
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	if err := s.ValidateJSON([]byte(`2`)); err != nil {
+		t.Errorf("2: %v", err)
+	}
+	if err := s.ValidateJSON([]byte(`1.0`)); err == nil {
+		t.Error("1.0 matches both branches; want a oneOf error")
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name, schema, want string
+	}{
+		{"not JSON", `{`, "unexpected EOF"},
+		{"not a schema", `"string"`, "must be an object or boolean"},
+		{"unknown type", `{"type":"float"}`, `unknown type "float"`},
+		{"unsupported keyword", `{"properties":{"a":{"$ref":"#/$defs/a"}}}`, `$.properties.a: unsupported keyword "$ref"`},
+		{"bad pattern", `{"pattern":"("}`, "$.pattern"},
+		{"negative count", `{"minItems":-1}`, "non-negative integer"},
+		{"empty anyOf", `{"anyOf":[]}`, "non-empty array"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile([]byte(tt.schema))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBooleanSchema(t *testing.T) {
+	t.Parallel()
+	s, err := Compile([]byte(`{"properties":{"a":true,"b":false}}`))
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	if err := s.ValidateJSON([]byte(`{"a":[1,{}]}`)); err != nil {
+		t.Errorf("true schema rejected: %v", err)
+	}
+	if err := s.ValidateJSON([]byte(`{"b":1}`)); err == nil {
+		t.Error("false schema accepted a value")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	gateway "github.com/eugener/gandalf/internal"
 	"github.com/eugener/gandalf/internal/provider"
@@ -22,8 +23,17 @@ const (
 )
 
 var (
-	_ gateway.Provider    = (*Client)(nil)
-	_ gateway.NativeProxy = (*Client)(nil)
+	_ gateway.Provider           = (*Client)(nil)
+	_ gateway.NativeProxy        = (*Client)(nil)
+	_ gateway.CapabilityReporter = (*Client)(nil)
+
+	_ gateway.RequiredFieldsReporter = (*Client)(nil)
+)
+
+// Chat request fields the Messages API rejects requests without.
+var (
+	requiredFields          = []string{"messages"}
+	requiredFieldsMaxTokens = []string{"messages", "max_tokens"}
 )
 
 // Client is an Anthropic provider adapter that implements gateway.Provider.
@@ -34,6 +44,12 @@ type Client struct {
 	hosting string // "", "vertex", "bedrock"
 	region  string // cloud region (Vertex, Bedrock)
 	project string // GCP project for Vertex
+
+	defaultMaxTokens int // sent when the client omits max_tokens; 0 = required
+
+	images *provider.ImageFetcher // nil = remote image URLs sent as url sources
+
+	finishGrace time.Duration // see SetFinishGrace
 }
 
 // New creates an Anthropic Client for direct API access.
@@ -48,10 +64,40 @@ func New(name, baseURL string, client *http.Client) *Client {
 		client = &http.Client{}
 	}
 	return &Client{
-		name:    name,
-		baseURL: strings.TrimRight(baseURL, "/"),
-		http:    client,
+		name:             name,
+		baseURL:          strings.TrimRight(baseURL, "/"),
+		http:             client,
+		defaultMaxTokens: defaultMaxTokens,
+	}
+}
+
+// SetFinishGrace sets the quiet period after a stream's final finish
+// reason; see sseutil.NewFinishWatch.
+func (c *Client) SetFinishGrace(d time.Duration) {
+	c.finishGrace = d
+}
+
+// SetDefaultMaxTokens sets the max_tokens sent when a request omits it
+// (4096 by default). n <= 0 disables the default, so requests without
+// max_tokens are rejected at the gateway.
+func (c *Client) SetDefaultMaxTokens(n int) {
+	c.defaultMaxTokens = max(n, 0)
+}
+
+// SetImageFetcher makes the client download http(s) image_url parts and
+// send them as base64 image blocks, for deployments (e.g. Bedrock) that
+// don't accept url image sources. nil sends the URL for Anthropic to fetch.
+func (c *Client) SetImageFetcher(f *provider.ImageFetcher) {
+	c.images = f
+}
+
+// RequiredChatFields reports the fields Anthropic requires. max_tokens is
+// only required when no default is configured.
+func (c *Client) RequiredChatFields() []string {
+	if c.defaultMaxTokens == 0 {
+		return requiredFieldsMaxTokens
 	}
+	return requiredFields
 }
 
 // NewWithHosting creates an Anthropic Client for a specific hosting platform.
@@ -73,11 +119,16 @@ func (c *Client) Type() string { return providerName }
 
 // ChatCompletion sends a non-streaming chat completion request to the Anthropic API.
 func (c *Client) ChatCompletion(ctx context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
-	aReq, err := translateRequest(req)
+	req, err := provider.InlineImages(ctx, c.images, req)
+	if err != nil {
+		return nil, err
+	}
+	aReq, err := translateRequest(req, c.defaultMaxTokens)
 	if err != nil {
 		return nil, fmt.Errorf("anthropic: translate request: %w", err)
 	}
 	aReq.Stream = false
+	aReq.betas = gateway.BetaFeaturesFromContext(ctx, providerName)
 
 	body, err := c.marshalForHosting(aReq)
 	if err != nil {
@@ -100,7 +151,7 @@ func (c *Client) ChatCompletion(ctx context.Context, req *gateway.ChatRequest) (
 		return nil, provider.ParseAPIError(providerName, resp)
 	}
 
-	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20)) // 1MB limit
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("anthropic: read response: %w", err)
 	}
@@ -110,11 +161,16 @@ func (c *Client) ChatCompletion(ctx context.Context, req *gateway.ChatRequest) (
 
 // ChatCompletionStream sends a streaming chat completion request to the Anthropic API.
 func (c *Client) ChatCompletionStream(ctx context.Context, req *gateway.ChatRequest) (<-chan gateway.StreamChunk, error) {
-	aReq, err := translateRequest(req)
+	req, err := provider.InlineImages(ctx, c.images, req)
+	if err != nil {
+		return nil, err
+	}
+	aReq, err := translateRequest(req, c.defaultMaxTokens)
 	if err != nil {
 		return nil, fmt.Errorf("anthropic: translate request: %w", err)
 	}
 	aReq.Stream = true
+	aReq.betas = gateway.BetaFeaturesFromContext(ctx, providerName)
 
 	body, err := c.marshalForHosting(aReq)
 	if err != nil {
@@ -138,9 +194,9 @@ func (c *Client) ChatCompletionStream(ctx context.Context, req *gateway.ChatRequ
 
 	ch := make(chan gateway.StreamChunk, 8)
 	if c.hosting == "bedrock" {
-		go readBedrockStream(ctx, resp.Body, ch)
+		go readBedrockStream(ctx, resp.Body, ch, c.finishGrace)
 	} else {
-		go readStream(ctx, resp.Body, ch)
+		go readStream(ctx, resp.Body, ch, c.finishGrace)
 	}
 	return ch, nil
 }
@@ -180,6 +236,12 @@ func (c *Client) HealthCheck(ctx context.Context) error {
 	return nil
 }
 
+// Capabilities reports model capabilities. All Claude models support chat
+// with tools, vision, and streaming; Anthropic has no embeddings API.
+func (c *Client) Capabilities(_ string) gateway.Capabilities {
+	return gateway.Capabilities{Chat: true, Tools: true, Vision: true, Streaming: true}
+}
+
 // ProxyRequest forwards a raw HTTP request to the Anthropic API.
 // It implements the gateway.NativeProxy interface.
 // Bedrock uses a binary event stream protocol incompatible with SSE native proxy.
@@ -204,7 +266,9 @@ func (c *Client) isHosted() bool {
 }
 
 // setHeaders applies Anthropic-specific headers to an outbound request.
-// Auth is handled by the transport chain.
+// Auth is handled by the transport chain. Beta features the client asked
+// for (see gateway.SetBetaFeatures) go in anthropic-beta, except on Bedrock,
+// which takes them in the body.
 func (c *Client) setHeaders(r *http.Request) {
 	r.Header.Set("content-type", "application/json")
 	// Direct mode: set anthropic-version header.
@@ -212,6 +276,11 @@ func (c *Client) setHeaders(r *http.Request) {
 	if !c.isHosted() {
 		r.Header.Set("anthropic-version", anthropicVersion)
 	}
+	if c.hosting != "bedrock" {
+		if betas := gateway.BetaFeaturesFromContext(r.Context(), providerName); len(betas) > 0 {
+			r.Header.Set("anthropic-beta", strings.Join(betas, ","))
+		}
+	}
 }
 
 // messagesURL returns the messages endpoint URL. For Vertex hosting, it uses
@@ -263,6 +332,7 @@ func (c *Client) marshalForHosting(aReq *anthropicRequest) ([]byte, error) {
 		Stream           bool            `json:"stream,omitempty"`
 		Tools            json.RawMessage `json:"tools,omitempty"`
 		StopSeqs         json.RawMessage `json:"stop_sequences,omitempty"`
+		AnthropicBeta    []string        `json:"anthropic_beta,omitempty"`
 	}
 
 	ver := anthropicVersion
@@ -281,5 +351,8 @@ func (c *Client) marshalForHosting(aReq *anthropicRequest) ([]byte, error) {
 		Tools:            aReq.Tools,
 		StopSeqs:         aReq.StopSeqs,
 	}
+	if c.hosting == "bedrock" {
+		hReq.AnthropicBeta = aReq.betas
+	}
 	return json.Marshal(hReq)
 }
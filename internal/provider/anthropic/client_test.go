@@ -7,8 +7,10 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	gateway "github.com/eugener/gandalf/internal"
 	"github.com/eugener/gandalf/internal/cloudauth"
@@ -37,7 +39,7 @@ func TestTranslateRequest(t *testing.T) {
 		MaxTokens: &maxTok,
 	}
 
-	aReq, err := translateRequest(req)
+	aReq, err := translateRequest(req, defaultMaxTokens)
 	if err != nil {
 		t.Fatalf("translateRequest: %v", err)
 	}
@@ -58,6 +60,100 @@ func TestTranslateRequest(t *testing.T) {
 	}
 }
 
+func TestTranslateRequest_MultipleSystemMessages(t *testing.T) {
+	t.Parallel()
+
+	req := &gateway.ChatRequest{
+		Model: "claude-sonnet-4-6",
+		Messages: []gateway.Message{
+			{Role: "user", Content: json.RawMessage(`"Hello"`)},
+			{Role: "system", Content: json.RawMessage(`"Be brief."`)},
+			{Role: "assistant", Content: json.RawMessage(`"Hi"`)},
+			{Role: "system", Content: json.RawMessage(`[{"type":"text","text":"Answer in French.","cache_control":{"type":"ephemeral"}}]`)},
+			{Role: "user", Content: json.RawMessage(`"Weather?"`)},
+		},
+	}
+
+	aReq, err := translateRequest(req, defaultMaxTokens)
+	if err != nil {
+		t.Fatalf("translateRequest: %v", err)
+	}
+	want := `[{"type":"text","text":"Be brief."},{"type":"text","text":"Answer in French.","cache_control":{"type":"ephemeral"}}]`
+	if got := string(aReq.System); got != want {
+		t.Errorf("system = %s, want both system messages merged in order as blocks", got)
+	}
+	if len(aReq.Messages) != 3 {
+		t.Fatalf("got %d messages, want 3 (system extracted)", len(aReq.Messages))
+	}
+	for i, want := range []string{"user", "assistant", "user"} {
+		if aReq.Messages[i].Role != want {
+			t.Errorf("messages[%d].role = %q, want %q", i, aReq.Messages[i].Role, want)
+		}
+	}
+}
+
+func TestTranslateRequest_ImageParts(t *testing.T) {
+	t.Parallel()
+
+	content := `[{"type":"text","text":"What is this?"},` +
+		`{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBORw0KGgo="}},` +
+		`{"type":"image_url","image_url":{"url":"https://example.com/cat.jpg","detail":"low"}}]`
+	req := &gateway.ChatRequest{
+		Model:    "claude-sonnet-4-6",
+		Messages: []gateway.Message{{Role: "user", Content: json.RawMessage(content)}},
+	}
+
+	aReq, err := translateRequest(req, defaultMaxTokens)
+	if err != nil {
+		t.Fatalf("translateRequest: %v", err)
+	}
+	want := `[{"type":"text","text":"What is this?"},` +
+		`{"type":"image","source":{"type":"base64","media_type":"image/png","data":"iVBORw0KGgo="}},` +
+		`{"type":"image","source":{"type":"url","url":"https://example.com/cat.jpg"}}]`
+	if got := string(aReq.Messages[0].Content); got != want {
+		t.Errorf("content =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestTranslateRequest_SingleSystemBlocksKept(t *testing.T) {
+	t.Parallel()
+
+	blocks := `[{"type":"text","text":"Long context","cache_control":{"type":"ephemeral"}}]`
+	req := &gateway.ChatRequest{
+		Model: "claude-sonnet-4-6",
+		Messages: []gateway.Message{
+			{Role: "user", Content: json.RawMessage(`"Hello"`)},
+			{Role: "system", Content: json.RawMessage(blocks)},
+		},
+	}
+
+	aReq, err := translateRequest(req, defaultMaxTokens)
+	if err != nil {
+		t.Fatalf("translateRequest: %v", err)
+	}
+	if string(aReq.System) != blocks {
+		t.Errorf("system = %s, want content blocks passed through", aReq.System)
+	}
+}
+
+func TestRequiredChatFields(t *testing.T) {
+	t.Parallel()
+
+	c := New("anthropic", "", nil)
+	if got := c.RequiredChatFields(); slices.Contains(got, "max_tokens") {
+		t.Errorf("with default max_tokens: required = %v, want max_tokens filled in", got)
+	}
+	aReq, err := translateRequest(&gateway.ChatRequest{Model: "claude-sonnet-4-6"}, c.defaultMaxTokens)
+	if err != nil || aReq.MaxTokens != 4096 {
+		t.Errorf("max_tokens = %d, %v; want default 4096", aReq.MaxTokens, err)
+	}
+
+	c.SetDefaultMaxTokens(0)
+	if got := c.RequiredChatFields(); !slices.Contains(got, "max_tokens") || !slices.Contains(got, "messages") {
+		t.Errorf("without default: required = %v, want messages and max_tokens", got)
+	}
+}
+
 func TestTranslateResponse(t *testing.T) {
 	t.Parallel()
 
@@ -129,6 +225,41 @@ func TestChatCompletion(t *testing.T) {
 	}
 }
 
+func TestChatCompletionBetaHeader(t *testing.T) {
+	t.Parallel()
+
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("anthropic-beta"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"msg_01","type":"message","role":"assistant","content":[{"type":"text","text":"Hi!"}],"stop_reason":"end_turn"}`)
+	}))
+	defer srv.Close()
+
+	client := testClient("anthropic", "test-key", srv.URL+"/v1")
+	req := &gateway.ChatRequest{
+		Model:    "claude-sonnet-4-6",
+		Messages: []gateway.Message{{Role: "user", Content: json.RawMessage(`"hi"`)}},
+	}
+
+	ctx := gateway.ContextWithRequestID(context.Background(), "req-1")
+	gateway.SetBetaFeatures(ctx, "anthropic", []string{"prompt-caching-2024-07-31", "output-128k-2025-02-19"})
+	if _, err := client.ChatCompletion(ctx, req); err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	// Betas requested for another provider type are not forwarded.
+	other := gateway.ContextWithRequestID(context.Background(), "req-2")
+	gateway.SetBetaFeatures(other, "openai", []string{"assistants=v2"})
+	if _, err := client.ChatCompletion(other, req); err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+
+	want := []string{"prompt-caching-2024-07-31,output-128k-2025-02-19", ""}
+	if !slices.Equal(got, want) {
+		t.Errorf("anthropic-beta = %q, want %q", got, want)
+	}
+}
+
 func TestChatCompletionStream(t *testing.T) {
 	t.Parallel()
 
@@ -186,21 +317,90 @@ func TestChatCompletionStream(t *testing.T) {
 	}
 }
 
-func TestMapStopReason(t *testing.T) {
+func TestChatCompletionStream_NoMessageStop(t *testing.T) {
+	t.Parallel()
+
+	// The upstream sends its stop_reason but never message_stop, and keeps
+	// the connection open.
+	sseBody := "event: message_start\n" +
+		`data: {"type":"message_start","message":{"id":"msg_01","model":"claude-sonnet-4-6","usage":{"input_tokens":10}}}` + "\n\n" +
+		"event: content_block_delta\n" +
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}` + "\n\n" +
+		"event: message_delta\n" +
+		`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":5}}` + "\n\n"
+
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, sseBody)
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := testClient("anthropic", "test-key", srv.URL+"/v1")
+	client.SetFinishGrace(50 * time.Millisecond)
+	ch, err := client.ChatCompletionStream(context.Background(), &gateway.ChatRequest{
+		Model:    "claude-sonnet-4-6",
+		Messages: []gateway.Message{{Role: "user", Content: json.RawMessage(`"hi"`)}},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletionStream: %v", err)
+	}
+
+	var chunks []gateway.StreamChunk
+	timeout := time.After(2 * time.Second)
+	for done := false; !done; {
+		select {
+		case c, ok := <-ch:
+			if !ok {
+				done = true
+				break
+			}
+			if c.Err != nil {
+				t.Fatalf("unexpected error: %v", c.Err)
+			}
+			chunks = append(chunks, c)
+		case <-timeout:
+			t.Fatal("stream not terminated after stop_reason")
+		}
+	}
+
+	if len(chunks) < 3 || !chunks[len(chunks)-1].Done {
+		t.Fatalf("stream should end with finish, usage, and Done chunks; got %d chunks", len(chunks))
+	}
+	if u := chunks[len(chunks)-2].Usage; u == nil || u.TotalTokens != 15 {
+		t.Errorf("usage = %+v, want total_tokens 15", u)
+	}
+}
+
+func TestTranslateResponseFinishReason(t *testing.T) {
 	t.Parallel()
 
 	tests := []struct {
 		in, want string
 	}{
 		{"end_turn", "stop"},
+		{"stop_sequence", "stop"},
+		{"pause_turn", "stop"},
 		{"max_tokens", "length"},
+		{"model_context_window_exceeded", "length"},
 		{"tool_use", "tool_calls"},
-		{"stop_sequence", "stop"},
-		{"unknown", "unknown"},
+		{"refusal", "content_filter"},
+		{"something_new", "stop"},
 	}
 	for _, tt := range tests {
-		if got := mapStopReason(tt.in); got != tt.want {
-			t.Errorf("mapStopReason(%q) = %q, want %q", tt.in, got, tt.want)
+		data := `{"id":"msg_1","model":"claude","content":[{"type":"text","text":"hi"}],"stop_reason":"` + tt.in + `"}`
+		resp, err := translateResponse([]byte(data))
+		if err != nil {
+			t.Fatalf("%s: translateResponse: %v", tt.in, err)
+		}
+		if got := resp.Choices[0].FinishReason; got != tt.want {
+			t.Errorf("stop_reason %q: finish_reason = %q, want %q", tt.in, got, tt.want)
 		}
 	}
 }
@@ -465,6 +665,29 @@ func TestBedrockMarshalForHosting(t *testing.T) {
 	}
 }
 
+func TestBedrockBetaFeaturesInBody(t *testing.T) {
+	t.Parallel()
+
+	c := NewWithHosting("bedrock-claude", "https://example.com",
+		&http.Client{}, "bedrock", "us-east-1", "")
+	aReq := &anthropicRequest{MaxTokens: 10, betas: []string{"token-efficient-tools-2025-02-19"}}
+	body, err := c.marshalForHosting(aReq)
+	if err != nil {
+		t.Fatalf("marshalForHosting: %v", err)
+	}
+	if !strings.Contains(string(body), `"anthropic_beta":["token-efficient-tools-2025-02-19"]`) {
+		t.Errorf("body = %s, want anthropic_beta", body)
+	}
+
+	ctx := gateway.ContextWithRequestID(context.Background(), "req-1")
+	gateway.SetBetaFeatures(ctx, "anthropic", aReq.betas)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "https://example.com", nil)
+	c.setHeaders(req)
+	if got := req.Header.Get("anthropic-beta"); got != "" {
+		t.Errorf("Bedrock mode set anthropic-beta header %q", got)
+	}
+}
+
 func TestBedrockSetHeadersSkipsVersion(t *testing.T) {
 	t.Parallel()
 
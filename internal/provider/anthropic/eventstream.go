@@ -6,27 +6,37 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
 	"github.com/tidwall/gjson"
 
 	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider/sseutil"
 )
 
 // readBedrockStream reads AWS binary event stream frames from a Bedrock
 // invoke-with-response-stream response body and emits OpenAI-format
 // StreamChunks. Each frame's payload contains {"bytes":"<base64>"} where
-// the decoded bytes are standard Anthropic event JSON.
-func readBedrockStream(ctx context.Context, body io.ReadCloser, ch chan<- gateway.StreamChunk) {
+// the decoded bytes are standard Anthropic event JSON. Like readStream, it
+// ends the stream finishGrace after a stop_reason if message_stop never comes.
+func readBedrockStream(ctx context.Context, body io.ReadCloser, ch chan<- gateway.StreamChunk, finishGrace time.Duration) {
 	defer close(ch)
 	defer body.Close()
 
+	watch := sseutil.NewFinishWatch(body, finishGrace)
+	defer watch.Stop()
+
 	var state streamState
 	decoder := eventstream.NewDecoder()
 
 	for {
 		msg, err := decoder.Decode(body, nil)
 		if err != nil {
+			if watch.Fired() {
+				emit(ctx, ch, state.onMessageStop())
+				return
+			}
 			if errors.Is(err, io.EOF) {
 				return
 			}
@@ -66,13 +76,9 @@ func readBedrockStream(ctx context.Context, body io.ReadCloser, ch chan<- gatewa
 		}
 
 		chunks := state.handleEvent(eventType, string(decoded))
-		for _, c := range chunks {
-			select {
-			case ch <- c:
-			case <-ctx.Done():
-				ch <- gateway.StreamChunk{Err: ctx.Err()}
-				return
-			}
+		watch.Event(state.stopReason != "")
+		if !emit(ctx, ch, chunks) || isDone(chunks) {
+			return
 		}
 	}
 }
@@ -68,7 +68,7 @@ func TestReadBedrockStream(t *testing.T) {
 		`{"type":"message_stop"}`))
 
 	ch := make(chan gateway.StreamChunk, 16)
-	go readBedrockStream(t.Context(), io.NopCloser(&stream), ch)
+	go readBedrockStream(t.Context(), io.NopCloser(&stream), ch, 0)
 
 	var chunks []gateway.StreamChunk
 	for c := range ch {
@@ -106,7 +106,7 @@ func TestReadBedrockStreamException(t *testing.T) {
 	stream.Write(encodeException(t, "throttlingException", "rate limit exceeded"))
 
 	ch := make(chan gateway.StreamChunk, 4)
-	go readBedrockStream(t.Context(), io.NopCloser(&stream), ch)
+	go readBedrockStream(t.Context(), io.NopCloser(&stream), ch, 0)
 
 	var gotErr bool
 	for c := range ch {
@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/tidwall/gjson"
 
 	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
 	"github.com/eugener/gandalf/internal/provider/sseutil"
 )
 
@@ -21,10 +23,15 @@ type streamState struct {
 }
 
 // readStream reads Anthropic SSE events and emits OpenAI-format StreamChunks.
-func readStream(ctx context.Context, body io.ReadCloser, ch chan<- gateway.StreamChunk) {
+// The stream ends at message_stop, or finishGrace after a message_delta
+// carrying a stop_reason if the upstream never sends one.
+func readStream(ctx context.Context, body io.ReadCloser, ch chan<- gateway.StreamChunk, finishGrace time.Duration) {
 	defer close(ch)
 	defer body.Close()
 
+	watch := sseutil.NewFinishWatch(body, finishGrace)
+	defer watch.Stop()
+
 	var state streamState
 	scanner := sseutil.NewScanner(body)
 
@@ -44,21 +51,40 @@ func readStream(ctx context.Context, body io.ReadCloser, ch chan<- gateway.Strea
 		}
 
 		chunks := state.handleEvent(currentEvent, data)
-		for _, c := range chunks {
-			select {
-			case ch <- c:
-			case <-ctx.Done():
-				ch <- gateway.StreamChunk{Err: ctx.Err()}
-				return
-			}
+		watch.Event(state.stopReason != "")
+		if !emit(ctx, ch, chunks) || isDone(chunks) {
+			return
 		}
 		currentEvent = ""
 	}
+	if watch.Fired() {
+		emit(ctx, ch, state.onMessageStop())
+		return
+	}
 	if err := scanner.Err(); err != nil {
 		ch <- gateway.StreamChunk{Err: fmt.Errorf("anthropic: read stream: %w", err)}
 	}
 }
 
+// emit sends chunks on ch in order. It reports false, after sending the
+// context error, if ctx is cancelled first.
+func emit(ctx context.Context, ch chan<- gateway.StreamChunk, chunks []gateway.StreamChunk) bool {
+	for _, c := range chunks {
+		select {
+		case ch <- c:
+		case <-ctx.Done():
+			ch <- gateway.StreamChunk{Err: ctx.Err()}
+			return false
+		}
+	}
+	return true
+}
+
+// isDone reports whether chunks end the stream.
+func isDone(chunks []gateway.StreamChunk) bool {
+	return len(chunks) > 0 && chunks[len(chunks)-1].Done
+}
+
 // handleEvent processes a single Anthropic SSE event and returns zero or more
 // OpenAI-format StreamChunks.
 func (s *streamState) handleEvent(event, data string) []gateway.StreamChunk {
@@ -118,7 +144,7 @@ func (s *streamState) onMessageDelta(data string) []gateway.StreamChunk {
 
 func (s *streamState) onMessageStop() []gateway.StreamChunk {
 	// Emit finish chunk with stop reason.
-	finishReason := mapStopReason(s.stopReason)
+	finishReason := provider.NormalizeFinishReason(s.stopReason)
 	finishChunk := sseutil.BuildFinishChunk(s.id, s.model, finishReason)
 
 	// Emit usage chunk.
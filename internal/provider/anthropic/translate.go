@@ -9,6 +9,7 @@ import (
 	"github.com/tidwall/gjson"
 
 	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
 )
 
 // anthropicRequest is the Anthropic Messages API request body.
@@ -22,6 +23,8 @@ type anthropicRequest struct {
 	Stream      bool              `json:"stream,omitempty"`
 	Tools       json.RawMessage   `json:"tools,omitempty"`
 	StopSeqs    json.RawMessage   `json:"stop_sequences,omitempty"`
+
+	betas []string // anthropic_beta in the body on Bedrock; a header elsewhere
 }
 
 type anthropicMsg struct {
@@ -29,11 +32,16 @@ type anthropicMsg struct {
 	Content json.RawMessage `json:"content"`
 }
 
-// translateRequest converts an OpenAI-format ChatRequest to an Anthropic Messages API request.
-func translateRequest(req *gateway.ChatRequest) (*anthropicRequest, error) {
+// defaultMaxTokens is the max_tokens sent when the client omits it, since
+// Anthropic requires the field.
+const defaultMaxTokens = 4096
+
+// translateRequest converts an OpenAI-format ChatRequest to an Anthropic
+// Messages API request. maxTokens is used when the request sets none.
+func translateRequest(req *gateway.ChatRequest, maxTokens int) (*anthropicRequest, error) {
 	out := &anthropicRequest{
 		Model:       req.Model,
-		MaxTokens:   4096, // Anthropic requires max_tokens
+		MaxTokens:   maxTokens,
 		Temperature: req.Temperature,
 		TopP:        req.TopP,
 		Stream:      req.Stream,
@@ -44,14 +52,24 @@ func translateRequest(req *gateway.ChatRequest) (*anthropicRequest, error) {
 		out.MaxTokens = *req.MaxTokens
 	}
 
+	// Anthropic takes the system prompt as a top-level field. A single system
+	// message is passed through as-is; several, in any position, are merged
+	// into one content-block array. Either way blocks such as cache_control
+	// survive.
+	if _, n := provider.SystemText(req.Messages); n > 1 {
+		out.System = systemBlocks(req.Messages)
+	}
+
 	for _, m := range req.Messages {
 		switch m.Role {
 		case "system":
-			out.System = m.Content
+			if out.System == nil {
+				out.System = m.Content
+			}
 		case "user", "assistant":
 			out.Messages = append(out.Messages, anthropicMsg{
 				Role:    m.Role,
-				Content: m.Content,
+				Content: translateContent(m.Content),
 			})
 		case "tool":
 			// Tool results map to user role in Anthropic's format.
@@ -67,6 +85,72 @@ func translateRequest(req *gateway.ChatRequest) (*anthropicRequest, error) {
 	return out, nil
 }
 
+// anthropicImageSource is the source of an Anthropic image block: inline
+// base64 data, or a URL Anthropic fetches itself.
+type anthropicImageSource struct {
+	Type      string `json:"type"` // "base64" or "url"
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicImageBlock struct {
+	Type   string               `json:"type"`
+	Source anthropicImageSource `json:"source"`
+}
+
+type anthropicTextBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// systemBlocks concatenates the content of every system message in msgs
+// into one Anthropic content-block array. String content becomes a text
+// block; content arrays are copied block by block, unchanged.
+func systemBlocks(msgs []gateway.Message) json.RawMessage {
+	var blocks []json.RawMessage
+	for _, m := range msgs {
+		if m.Role != "system" {
+			continue
+		}
+		if raws, _, ok := provider.ContentParts(m.Content); ok {
+			blocks = append(blocks, raws...)
+			continue
+		}
+		text, _ := json.Marshal(anthropicTextBlock{Type: "text", Text: provider.ContentText(m.Content)})
+		blocks = append(blocks, text)
+	}
+	out, _ := json.Marshal(blocks)
+	return out
+}
+
+// translateContent converts OpenAI image_url parts in an array content to
+// Anthropic image blocks. String content and every other part (text, or
+// blocks already in Anthropic form) pass through unchanged.
+func translateContent(raw json.RawMessage) json.RawMessage {
+	raws, parts, ok := provider.ContentParts(raw)
+	if !ok {
+		return raw
+	}
+	changed := false
+	for i, p := range parts {
+		if p.Type != "image_url" || p.ImageURL == nil {
+			continue
+		}
+		src := anthropicImageSource{Type: "url", URL: p.ImageURL.URL}
+		if mediaType, data, ok := provider.ParseDataURL(p.ImageURL.URL); ok {
+			src = anthropicImageSource{Type: "base64", MediaType: mediaType, Data: data}
+		}
+		raws[i], _ = json.Marshal(anthropicImageBlock{Type: "image", Source: src})
+		changed = true
+	}
+	if !changed {
+		return raw
+	}
+	out, _ := json.Marshal(raws)
+	return out
+}
+
 // translateResponse converts an Anthropic Messages API JSON response to an
 // OpenAI-format ChatResponse.
 func translateResponse(data []byte) (*gateway.ChatResponse, error) {
@@ -74,7 +158,7 @@ func translateResponse(data []byte) (*gateway.ChatResponse, error) {
 
 	id := result.Get("id").String()
 	model := result.Get("model").String()
-	stopReason := mapStopReason(result.Get("stop_reason").String())
+	stopReason := provider.NormalizeFinishReason(result.Get("stop_reason").String())
 
 	// Build message content from content blocks.
 	var contentText strings.Builder
@@ -127,19 +211,3 @@ func translateResponse(data []byte) (*gateway.ChatResponse, error) {
 		Usage:   usage,
 	}, nil
 }
-
-// mapStopReason converts Anthropic stop reasons to OpenAI finish reasons.
-func mapStopReason(reason string) string {
-	switch reason {
-	case "end_turn":
-		return "stop"
-	case "max_tokens":
-		return "length"
-	case "tool_use":
-		return "tool_calls"
-	case "stop_sequence":
-		return "stop"
-	default:
-		return reason
-	}
-}
@@ -0,0 +1,59 @@
+package provider
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DecompressTransport decodes gzip response bodies the underlying
+// http.Transport left encoded. The transport only decompresses when it
+// added Accept-Encoding itself, so an upstream (or a proxy in front of it)
+// that gzips unasked would otherwise hand the SSE and JSON readers
+// compressed bytes. Requests that set Accept-Encoding themselves, like
+// native passthrough, get the response as sent.
+type DecompressTransport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip forwards the request and decodes a gzip response body.
+func (t *DecompressTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := t.Base.RoundTrip(r)
+	if err != nil || r.Header.Get("Accept-Encoding") != "" {
+		return resp, err
+	}
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") || resp.Body == http.NoBody {
+		return resp, nil
+	}
+	resp.Body = &gzipBody{body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// gzipBody opens the gzip reader on first Read, so a stream's headers
+// reach the caller before its first compressed bytes arrive.
+type gzipBody struct {
+	body io.ReadCloser
+	zr   *gzip.Reader
+	err  error
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.zr == nil {
+		if b.zr, b.err = gzip.NewReader(b.body); b.err != nil {
+			return 0, b.err
+		}
+	}
+	return b.zr.Read(p)
+}
+
+func (b *gzipBody) Close() error {
+	return b.body.Close()
+}
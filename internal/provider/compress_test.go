@@ -0,0 +1,74 @@
+package provider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func gzipBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressTransport(t *testing.T) {
+	t.Parallel()
+	const sse = "data: {\"id\":\"1\"}\n\ndata: [DONE]\n\n"
+	body := gzipBytes(t, sse)
+
+	// The upstream gzips whether or not it was asked to.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		want           []byte
+		wantEncoding   string
+	}{
+		{"unsolicited gzip decoded", "", []byte(sse), ""},
+		{"caller-negotiated gzip passed through", "gzip", body, "gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// DisableCompression stands in for an upstream that ignores
+			// the Accept-Encoding the transport would otherwise add.
+			client := &http.Client{Transport: &DecompressTransport{Base: &http.Transport{DisableCompression: true}}}
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			got, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("read body: %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+			if enc := resp.Header.Get("Content-Encoding"); enc != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", enc, tt.wantEncoding)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+
+	"github.com/rs/dnscache"
+)
+
+// ErrInternalAddr is returned when a guarded dial resolves to a loopback,
+// private, link-local, or unspecified address that is not allowlisted.
+var ErrInternalAddr = errors.New("dial to internal address refused")
+
+// IsInternalAddr reports whether a is loopback, private, link-local
+// (including cloud metadata at 169.254.169.254), or unspecified.
+func IsInternalAddr(a netip.Addr) bool {
+	a = a.Unmap()
+	return a.IsLoopback() || a.IsPrivate() || a.IsLinkLocalUnicast() ||
+		a.IsLinkLocalMulticast() || a.IsInterfaceLocalMulticast() || a.IsUnspecified()
+}
+
+// AddrAllowlist exempts hosts and addresses from the internal-address check.
+type AddrAllowlist struct {
+	hosts    []string
+	prefixes []netip.Prefix
+}
+
+// ParseAddrAllowlist parses entries that are hostnames, IPs, or CIDRs.
+func ParseAddrAllowlist(entries []string) AddrAllowlist {
+	var l AddrAllowlist
+	for _, entry := range entries {
+		if p, err := netip.ParsePrefix(entry); err == nil {
+			l.prefixes = append(l.prefixes, p)
+		} else if a, err := netip.ParseAddr(entry); err == nil {
+			l.prefixes = append(l.prefixes, netip.PrefixFrom(a, a.BitLen()))
+		} else if entry != "" {
+			l.hosts = append(l.hosts, strings.ToLower(entry))
+		}
+	}
+	return l
+}
+
+// HasHost reports whether host is allowlisted by name (case-insensitive).
+func (l AddrAllowlist) HasHost(host string) bool {
+	for _, h := range l.hosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether a is public or falls in an allowlisted IP or CIDR.
+func (l AddrAllowlist) Allows(a netip.Addr) bool {
+	a = a.Unmap()
+	if !IsInternalAddr(a) {
+		return true
+	}
+	for _, p := range l.prefixes {
+		if p.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// control is a net.Dialer Control hook refusing addresses l doesn't allow.
+// It runs after DNS resolution, on the address actually being connected.
+func (l AddrAllowlist) control(_, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !l.Allows(ap.Addr()) {
+		return fmt.Errorf("%w: %s", ErrInternalAddr, ap.Addr())
+	}
+	return nil
+}
+
+// DenyInternalDials makes t refuse connections to internal addresses not on
+// allow. The check runs at connect time, after DNS resolution, so a host
+// that passed a config-time check and later resolves to an internal address
+// (DNS rebinding) is still refused, as is a redirect to one. Hosts on allow
+// by name are dialed unchecked. With a proxy, the proxy is what gets
+// dialed, so an internal egress proxy must be allowlisted. resolver, when
+// non-nil, is the DNS cache NewTransport was given.
+func DenyInternalDials(t *http.Transport, resolver *dnscache.Resolver, allow AddrAllowlist) {
+	open := t.DialContext
+	if open == nil {
+		open = (&net.Dialer{}).DialContext
+	}
+	guarded := dialer(resolver, &net.Dialer{Control: allow.control})
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(addr); err == nil && allow.HasHost(host) {
+			return open(ctx, network, addr)
+		}
+		return guarded(ctx, network, addr)
+	}
+}
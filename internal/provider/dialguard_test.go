@@ -0,0 +1,58 @@
+package provider
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/rs/dnscache"
+)
+
+func TestDenyInternalDials(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	byName := "http://localhost:" + u.Port()
+
+	tests := []struct {
+		name     string
+		allow    []string
+		resolver *dnscache.Resolver
+		target   string
+		wantErr  bool
+	}{
+		{"loopback refused", nil, nil, srv.URL, true},
+		{"resolved name refused", nil, nil, byName, true},
+		{"resolved name refused via cache", nil, &dnscache.Resolver{}, byName, true},
+		{"other host allowlisted", []string{"example.com"}, nil, byName, true},
+		{"CIDR allowlisted", []string{"127.0.0.0/8", "::1"}, nil, byName, false},
+		{"IP allowlisted", []string{"127.0.0.1"}, nil, srv.URL, false},
+		{"host allowlisted", []string{"LOCALHOST"}, &dnscache.Resolver{}, byName, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tr := NewTransport(tt.resolver, false)
+			DenyInternalDials(tr, tt.resolver, ParseAddrAllowlist(tt.allow))
+			defer tr.CloseIdleConnections()
+
+			resp, err := (&http.Client{Transport: tr}).Get(tt.target)
+			if resp != nil {
+				resp.Body.Close()
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrInternalAddr) {
+					t.Errorf("err = %v, want ErrInternalAddr", err)
+				}
+			} else if err != nil {
+				t.Errorf("err = %v, want success", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package provider
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+// OpenAI finish reasons: the only values clients are sent.
+const (
+	FinishStop          = "stop"
+	FinishLength        = "length"
+	FinishToolCalls     = "tool_calls"
+	FinishContentFilter = "content_filter"
+)
+
+// finishReasons maps upstream finish reasons that are not already in the
+// OpenAI set. Keys are case-sensitive, as sent by each provider.
+var finishReasons = map[string]string{
+	// OpenAI (legacy function calling).
+	"function_call": FinishToolCalls,
+
+	// Anthropic (direct, Vertex, Bedrock).
+	"end_turn":                      FinishStop,
+	"stop_sequence":                 FinishStop,
+	"pause_turn":                    FinishStop,
+	"max_tokens":                    FinishLength,
+	"model_context_window_exceeded": FinishLength,
+	"tool_use":                      FinishToolCalls,
+	"refusal":                       FinishContentFilter,
+	"guardrail_intervened":          FinishContentFilter,
+
+	// Gemini.
+	"STOP":                      FinishStop,
+	"FINISH_REASON_UNSPECIFIED": FinishStop,
+	"OTHER":                     FinishStop,
+	"LANGUAGE":                  FinishStop,
+	"MALFORMED_FUNCTION_CALL":   FinishStop,
+	"MAX_TOKENS":                FinishLength,
+	"SAFETY":                    FinishContentFilter,
+	"RECITATION":                FinishContentFilter,
+	"BLOCKLIST":                 FinishContentFilter,
+	"PROHIBITED_CONTENT":        FinishContentFilter,
+	"SPII":                      FinishContentFilter,
+	"IMAGE_SAFETY":              FinishContentFilter,
+
+	// Ollama and other OpenAI-compatible servers.
+	"eos":        FinishStop,
+	"eos_token":  FinishStop,
+	"end":        FinishStop,
+	"max_length": FinishLength,
+}
+
+// finishOverrides holds operator mappings from SetFinishReasons.
+var finishOverrides atomic.Pointer[map[string]string]
+
+// SetFinishReasons adds operator mappings that take precedence over the
+// built-in table, e.g. for a self-hosted server's own vocabulary. Every
+// value must be an OpenAI finish reason. Call it once at startup.
+func SetFinishReasons(m map[string]string) error {
+	for from, to := range m {
+		if !canonicalFinish(to) {
+			return fmt.Errorf("finish reason %q: %q is not one of stop, length, tool_calls, content_filter", from, to)
+		}
+	}
+	if len(m) == 0 {
+		finishOverrides.Store(nil)
+		return nil
+	}
+	finishOverrides.Store(&m)
+	return nil
+}
+
+// NormalizeFinishReason maps a provider finish reason to the OpenAI set.
+// Empty stays empty (the response is not finished); reasons that are
+// neither OpenAI values nor known mappings become "stop".
+func NormalizeFinishReason(reason string) string {
+	if reason == "" {
+		return ""
+	}
+	if m := finishOverrides.Load(); m != nil {
+		if to, ok := (*m)[reason]; ok {
+			return to
+		}
+	}
+	if canonicalFinish(reason) {
+		return reason
+	}
+	if to, ok := finishReasons[reason]; ok {
+		return to
+	}
+	return FinishStop
+}
+
+// NormalizeChoices applies NormalizeFinishReason to every choice in resp.
+// Used by adapters that pass OpenAI-format responses through.
+func NormalizeChoices(resp *gateway.ChatResponse) {
+	for i := range resp.Choices {
+		resp.Choices[i].FinishReason = NormalizeFinishReason(resp.Choices[i].FinishReason)
+	}
+}
+
+func canonicalFinish(reason string) bool {
+	switch reason {
+	case FinishStop, FinishLength, FinishToolCalls, FinishContentFilter:
+		return true
+	}
+	return false
+}
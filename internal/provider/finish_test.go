@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"testing"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+func TestNormalizeFinishReason(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		provider, in, want string
+	}{
+		{"openai", "stop", "stop"},
+		{"openai", "length", "length"},
+		{"openai", "tool_calls", "tool_calls"},
+		{"openai", "content_filter", "content_filter"},
+		{"openai", "function_call", "tool_calls"},
+		{"anthropic", "end_turn", "stop"},
+		{"anthropic", "stop_sequence", "stop"},
+		{"anthropic", "max_tokens", "length"},
+		{"anthropic", "tool_use", "tool_calls"},
+		{"anthropic", "refusal", "content_filter"},
+		{"bedrock", "guardrail_intervened", "content_filter"},
+		{"gemini", "STOP", "stop"},
+		{"gemini", "MAX_TOKENS", "length"},
+		{"gemini", "SAFETY", "content_filter"},
+		{"gemini", "RECITATION", "content_filter"},
+		{"gemini", "MALFORMED_FUNCTION_CALL", "stop"},
+		{"ollama", "eos", "stop"},
+		{"ollama", "max_length", "length"},
+		{"any", "", ""},
+		{"any", "brand_new_reason", "stop"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeFinishReason(tt.in); got != tt.want {
+			t.Errorf("%s: NormalizeFinishReason(%q) = %q, want %q", tt.provider, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeChoices(t *testing.T) {
+	t.Parallel()
+	resp := &gateway.ChatResponse{Choices: []gateway.Choice{
+		{Index: 0, FinishReason: "function_call"},
+		{Index: 1, FinishReason: "stop"},
+		{Index: 2},
+	}}
+	NormalizeChoices(resp)
+	for i, want := range []string{"tool_calls", "stop", ""} {
+		if got := resp.Choices[i].FinishReason; got != want {
+			t.Errorf("choice %d: finish_reason = %q, want %q", i, got, want)
+		}
+	}
+}
+
+// TestSetFinishReasons changes package state, so it must not run in parallel.
+func TestSetFinishReasons(t *testing.T) {
+	t.Cleanup(func() { SetFinishReasons(nil) })
+
+	if err := SetFinishReasons(map[string]string{"done": "finished"}); err == nil {
+		t.Error("expected error for a non-OpenAI target")
+	}
+	if err := SetFinishReasons(map[string]string{"done": "stop", "budget": "length", "eos": "length"}); err != nil {
+		t.Fatalf("SetFinishReasons: %v", err)
+	}
+	for in, want := range map[string]string{"done": "stop", "budget": "length", "eos": "length", "end_turn": "stop"} {
+		if got := NormalizeFinishReason(in); got != want {
+			t.Errorf("NormalizeFinishReason(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	if err := SetFinishReasons(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := NormalizeFinishReason("eos"); got != "stop" {
+		t.Errorf("after reset: NormalizeFinishReason(eos) = %q, want stop", got)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/tidwall/gjson"
 
@@ -22,8 +23,9 @@ const (
 )
 
 var (
-	_ gateway.Provider    = (*Client)(nil)
-	_ gateway.NativeProxy = (*Client)(nil)
+	_ gateway.Provider           = (*Client)(nil)
+	_ gateway.NativeProxy        = (*Client)(nil)
+	_ gateway.CapabilityReporter = (*Client)(nil)
 )
 
 // Client is a Gemini provider adapter that implements gateway.Provider.
@@ -34,8 +36,16 @@ type Client struct {
 	hosting string // "", "vertex"
 	region  string // GCP region for Vertex
 	project string // GCP project for Vertex
+
+	images *provider.ImageFetcher // nil = remote image URLs sent as fileData
+
+	finishGrace time.Duration // see SetFinishGrace
 }
 
+// defaultImageFetcher is shared by clients that keep the default of
+// downloading image_url links; Gemini only fetches its own file URIs.
+var defaultImageFetcher = provider.NewImageFetcher(0)
+
 // New creates a Gemini Client for direct API access.
 // name is the instance identifier; baseURL configures the upstream.
 // If baseURL is empty, it defaults to the Gemini API endpoint.
@@ -51,9 +61,23 @@ func New(name, baseURL string, client *http.Client) *Client {
 		name:    name,
 		baseURL: strings.TrimRight(baseURL, "/"),
 		http:    client,
+		images:  defaultImageFetcher,
 	}
 }
 
+// SetFinishGrace sets the quiet period after a stream's final finish
+// reason; see sseutil.NewFinishWatch.
+func (c *Client) SetFinishGrace(d time.Duration) {
+	c.finishGrace = d
+}
+
+// SetImageFetcher sets how http(s) image_url parts are handled. By default
+// they are downloaded and sent as inlineData; nil sends them as fileData
+// URIs instead, which only works for URIs Gemini can read (File API, GCS).
+func (c *Client) SetImageFetcher(f *provider.ImageFetcher) {
+	c.images = f
+}
+
 // NewWithHosting creates a Gemini Client for a specific hosting platform.
 // For hosting="vertex", region and project specify the GCP location.
 func NewWithHosting(name, baseURL string, client *http.Client, hosting, region, project string) *Client {
@@ -72,6 +96,10 @@ func (c *Client) Type() string { return providerName }
 
 // ChatCompletion sends a non-streaming chat completion request to the Gemini API.
 func (c *Client) ChatCompletion(ctx context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+	req, err := provider.InlineImages(ctx, c.images, req)
+	if err != nil {
+		return nil, err
+	}
 	gReq := translateRequest(req)
 
 	body, err := json.Marshal(gReq)
@@ -96,7 +124,7 @@ func (c *Client) ChatCompletion(ctx context.Context, req *gateway.ChatRequest) (
 		return nil, provider.ParseAPIError(providerName, resp)
 	}
 
-	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("gemini: read response: %w", err)
 	}
@@ -106,6 +134,10 @@ func (c *Client) ChatCompletion(ctx context.Context, req *gateway.ChatRequest) (
 
 // ChatCompletionStream sends a streaming chat completion request to the Gemini API.
 func (c *Client) ChatCompletionStream(ctx context.Context, req *gateway.ChatRequest) (<-chan gateway.StreamChunk, error) {
+	req, err := provider.InlineImages(ctx, c.images, req)
+	if err != nil {
+		return nil, err
+	}
 	gReq := translateRequest(req)
 
 	body, err := json.Marshal(gReq)
@@ -130,7 +162,7 @@ func (c *Client) ChatCompletionStream(ctx context.Context, req *gateway.ChatRequ
 	}
 
 	ch := make(chan gateway.StreamChunk, 8)
-	go readStream(ctx, resp.Body, ch, req.Model)
+	go readStream(ctx, resp.Body, ch, req.Model, c.finishGrace)
 	return ch, nil
 }
 
@@ -179,7 +211,7 @@ func (c *Client) Embeddings(ctx context.Context, req *gateway.EmbeddingRequest)
 		return nil, provider.ParseAPIError(providerName, resp)
 	}
 
-	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("gemini: read response: %w", err)
 	}
@@ -222,7 +254,7 @@ func (c *Client) ListModels(ctx context.Context) ([]string, error) {
 		return nil, provider.ParseAPIError(providerName, resp)
 	}
 
-	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("gemini: read response: %w", err)
 	}
@@ -257,6 +289,15 @@ func (c *Client) HealthCheck(ctx context.Context) error {
 	return err
 }
 
+// Capabilities reports model capabilities. Embedding models support only
+// embeddings; all other models support chat with tools, vision, and streaming.
+func (c *Client) Capabilities(model string) gateway.Capabilities {
+	if strings.Contains(model, "embedding") {
+		return gateway.Capabilities{Embeddings: true}
+	}
+	return gateway.Capabilities{Chat: true, Tools: true, Vision: true, Streaming: true}
+}
+
 // ProxyRequest forwards a raw HTTP request to the Gemini API.
 // It implements the gateway.NativeProxy interface.
 func (c *Client) ProxyRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, path string) error {
@@ -3,6 +3,7 @@ package gemini
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 
 	gateway "github.com/eugener/gandalf/internal"
 	"github.com/eugener/gandalf/internal/cloudauth"
+	"github.com/eugener/gandalf/internal/provider"
 )
 
 // testClient creates a Client with an APIKeyTransport for test assertions.
@@ -315,21 +317,33 @@ func TestHealthCheck(t *testing.T) {
 	}
 }
 
-func TestMapStopReason(t *testing.T) {
+func TestTranslateResponseFinishReason(t *testing.T) {
 	t.Parallel()
 
+	text := `{"text":"hi"}`
+	call := `{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}`
 	tests := []struct {
-		in, want string
+		reason, part, want string
 	}{
-		{"STOP", "stop"},
-		{"MAX_TOKENS", "length"},
-		{"SAFETY", "content_filter"},
-		{"RECITATION", "content_filter"},
-		{"UNKNOWN", "UNKNOWN"},
+		{"STOP", text, "stop"},
+		{"MAX_TOKENS", text, "length"},
+		{"SAFETY", text, "content_filter"},
+		{"RECITATION", text, "content_filter"},
+		{"BLOCKLIST", text, "content_filter"},
+		{"PROHIBITED_CONTENT", text, "content_filter"},
+		{"SPII", text, "content_filter"},
+		{"OTHER", text, "stop"},
+		{"UNKNOWN", text, "stop"},
+		{"STOP", call, "tool_calls"},
 	}
 	for _, tt := range tests {
-		if got := mapStopReason(tt.in); got != tt.want {
-			t.Errorf("mapStopReason(%q) = %q, want %q", tt.in, got, tt.want)
+		data := `{"candidates":[{"content":{"parts":[` + tt.part + `]},"finishReason":"` + tt.reason + `"}]}`
+		resp, err := translateResponse([]byte(data), "gemini-2.0-flash")
+		if err != nil {
+			t.Fatalf("%s: translateResponse: %v", tt.reason, err)
+		}
+		if got := resp.Choices[0].FinishReason; got != tt.want {
+			t.Errorf("finishReason %q with %s: finish_reason = %q, want %q", tt.reason, tt.part, got, tt.want)
 		}
 	}
 }
@@ -403,24 +417,50 @@ func TestProxyRequest(t *testing.T) {
 	}
 }
 
-func TestExtractText_Array(t *testing.T) {
+func TestTranslateRequest_MultipleSystemMessages(t *testing.T) {
 	t.Parallel()
 
-	input := json.RawMessage(`[{"type":"text","text":"hello"},{"type":"text","text":" world"}]`)
-	got := extractText(input)
-	if got != "hello world" {
-		t.Errorf("extractText array = %q, want 'hello world'", got)
+	req := &gateway.ChatRequest{
+		Model: "gemini-2.0-flash",
+		Messages: []gateway.Message{
+			{Role: "user", Content: json.RawMessage(`"Hello"`)},
+			{Role: "system", Content: json.RawMessage(`"Be brief."`)},
+			{Role: "assistant", Content: json.RawMessage(`"Hi"`)},
+			{Role: "system", Content: json.RawMessage(`[{"type":"text","text":"Answer in French."}]`)},
+		},
+	}
+
+	gReq := translateRequest(req)
+	si := gReq.SystemInstruction
+	if si == nil || len(si.Parts) != 1 || si.Parts[0].Text != "Be brief.\n\nAnswer in French." {
+		t.Fatalf("systemInstruction = %+v, want both system messages merged in order", si)
+	}
+	if len(gReq.Contents) != 2 || gReq.Contents[0].Role != "user" || gReq.Contents[1].Role != "model" {
+		t.Errorf("contents = %+v, want [user model]", gReq.Contents)
 	}
 }
 
-func TestExtractText_Fallback(t *testing.T) {
+func TestTranslateRequest_ImageParts(t *testing.T) {
 	t.Parallel()
 
-	// Non-string, non-array input falls back to raw string.
-	input := json.RawMessage(`42`)
-	got := extractText(input)
-	if got != "42" {
-		t.Errorf("extractText fallback = %q, want '42'", got)
+	content := `[{"type":"text","text":"What is this?"},` +
+		`{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBORw0KGgo="}},` +
+		`{"type":"image_url","image_url":{"url":"gs://bucket/cat.jpg"}}]`
+	req := &gateway.ChatRequest{
+		Model:    "gemini-2.0-flash",
+		Messages: []gateway.Message{{Role: "user", Content: json.RawMessage(content)}},
+	}
+
+	gReq := translateRequest(req)
+	if len(gReq.Contents) != 1 {
+		t.Fatalf("got %d contents, want 1", len(gReq.Contents))
+	}
+	got, _ := json.Marshal(gReq.Contents[0].Parts)
+	want := `[{"text":"What is this?"},` +
+		`{"inlineData":{"mimeType":"image/png","data":"iVBORw0KGgo="}},` +
+		`{"fileData":{"mimeType":"image/jpeg","fileUri":"gs://bucket/cat.jpg"}}]`
+	if string(got) != want {
+		t.Errorf("parts =\n%s\nwant\n%s", got, want)
 	}
 }
 
@@ -493,3 +533,73 @@ func TestVertexListModels(t *testing.T) {
 		t.Errorf("models[0] = %q, want gemini-2.0-flash", models[0])
 	}
 }
+
+// largeEmbeddingBody returns a Gemini embedContent response just over 1 MB,
+// the old hard read limit, along with its vector length.
+func largeEmbeddingBody() (string, int) {
+	var b strings.Builder
+	b.WriteString(`{"embedding":{"values":[`)
+	n := 0
+	for b.Len() < 1<<20+1024 {
+		if n > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString("0.123456789")
+		n++
+	}
+	b.WriteString(`]}}`)
+	return b.String(), n
+}
+
+func TestEmbeddingsOverOneMegabyte(t *testing.T) {
+	t.Parallel()
+
+	body, n := largeEmbeddingBody()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	client := New("gemini", srv.URL+"/v1beta", &http.Client{
+		Transport: &provider.LimitTransport{Base: http.DefaultTransport},
+	})
+	resp, err := client.Embeddings(context.Background(), &gateway.EmbeddingRequest{
+		Model: "text-embedding-004",
+		Input: json.RawMessage(`"hello world"`),
+	})
+	if err != nil {
+		t.Fatalf("Embeddings: %v", err)
+	}
+	var items []struct {
+		Embedding []float64 `json:"embedding"`
+	}
+	if err := json.Unmarshal(resp.Data, &items); err != nil {
+		t.Fatalf("decode data: %v", err)
+	}
+	if len(items) != 1 || len(items[0].Embedding) != n {
+		t.Errorf("embedding length = %d, want %d", len(items[0].Embedding), n)
+	}
+}
+
+func TestEmbeddingsResponseTooLarge(t *testing.T) {
+	t.Parallel()
+
+	body, _ := largeEmbeddingBody()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	client := New("gemini", srv.URL+"/v1beta", &http.Client{
+		Transport: &provider.LimitTransport{Base: http.DefaultTransport, Limit: 1 << 20},
+	})
+	_, err := client.Embeddings(context.Background(), &gateway.EmbeddingRequest{
+		Model: "text-embedding-004",
+		Input: json.RawMessage(`"hello world"`),
+	})
+	if !errors.Is(err, provider.ErrResponseTooLarge) {
+		t.Errorf("err = %v, want ErrResponseTooLarge", err)
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/tidwall/gjson"
 
 	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
 	"github.com/eugener/gandalf/internal/provider/sseutil"
 )
 
@@ -15,10 +17,14 @@ import (
 // Gemini streaming has no "event:" field and no "[DONE]" sentinel -- it is
 // EOF-terminated. Each "data:" line contains a full JSON response chunk.
 // Usage is cumulative; we track the last seen values and emit them at the end.
-func readStream(ctx context.Context, body io.ReadCloser, ch chan<- gateway.StreamChunk, model string) {
+// A connection held open after the finishReason chunk ends after finishGrace.
+func readStream(ctx context.Context, body io.ReadCloser, ch chan<- gateway.StreamChunk, model string, finishGrace time.Duration) {
 	defer close(ch)
 	defer body.Close()
 
+	watch := sseutil.NewFinishWatch(body, finishGrace)
+	defer watch.Stop()
+
 	scanner := sseutil.NewScanner(body)
 	id := "gemini-" + model
 
@@ -34,7 +40,8 @@ func readStream(ctx context.Context, body io.ReadCloser, ch chan<- gateway.Strea
 
 		// Extract text content delta.
 		text := r.Get("candidates.0.content.parts.0.text").String()
-		finishReason := mapStopReason(r.Get("candidates.0.finishReason").String())
+		finishReason := provider.NormalizeFinishReason(r.Get("candidates.0.finishReason").String())
+		watch.Event(finishReason != "")
 
 		// Track cumulative usage.
 		if u := r.Get("usageMetadata"); u.Exists() {
@@ -64,7 +71,7 @@ func readStream(ctx context.Context, body io.ReadCloser, ch chan<- gateway.Strea
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
+	if err := scanner.Err(); err != nil && !watch.Fired() {
 		ch <- gateway.StreamChunk{Err: fmt.Errorf("gemini: read stream: %w", err)}
 		return
 	}
@@ -8,6 +8,7 @@ import (
 	"github.com/tidwall/gjson"
 
 	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
 )
 
 // geminiRequest is the Gemini generateContent request body.
@@ -25,10 +26,22 @@ type geminiContent struct {
 
 type geminiPart struct {
 	Text             string          `json:"text,omitempty"`
+	InlineData       *geminiBlob     `json:"inlineData,omitempty"`
+	FileData         *geminiFileData `json:"fileData,omitempty"`
 	FunctionCall     json.RawMessage `json:"functionCall,omitempty"`
 	FunctionResponse json.RawMessage `json:"functionResponse,omitempty"`
 }
 
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"` // base64
+}
+
+type geminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
 type geminiTool struct {
 	FunctionDeclarations json.RawMessage `json:"functionDeclarations,omitempty"`
 }
@@ -73,22 +86,25 @@ func translateRequest(req *gateway.ChatRequest) *geminiRequest {
 		}
 	}
 
+	// System messages, wherever they appear, become one systemInstruction.
+	if text, n := provider.SystemText(req.Messages); n > 0 {
+		out.SystemInstruction = &geminiContent{
+			Parts: []geminiPart{{Text: text}},
+		}
+	}
+
 	// Messages.
 	for _, m := range req.Messages {
 		switch m.Role {
 		case "system":
-			text := extractText(m.Content)
-			out.SystemInstruction = &geminiContent{
-				Parts: []geminiPart{{Text: text}},
-			}
+			// Merged below; Gemini takes one systemInstruction.
 		case "user":
-			text := extractText(m.Content)
 			out.Contents = append(out.Contents, geminiContent{
 				Role:  "user",
-				Parts: []geminiPart{{Text: text}},
+				Parts: userParts(m.Content),
 			})
 		case "assistant":
-			text := extractText(m.Content)
+			text := provider.ContentText(m.Content)
 			out.Contents = append(out.Contents, geminiContent{
 				Role:  "model",
 				Parts: []geminiPart{{Text: text}},
@@ -109,12 +125,40 @@ func translateRequest(req *gateway.ChatRequest) *geminiRequest {
 	return out
 }
 
+// userParts converts an OpenAI user message content to Gemini parts. Text
+// parts map to text; image_url parts map to inlineData for data URLs and
+// fileData for links. String content is a single text part.
+func userParts(raw json.RawMessage) []geminiPart {
+	_, parts, ok := provider.ContentParts(raw)
+	if !ok {
+		return []geminiPart{{Text: provider.ContentText(raw)}}
+	}
+	out := make([]geminiPart, 0, len(parts))
+	for _, p := range parts {
+		switch {
+		case p.Type == "text":
+			out = append(out, geminiPart{Text: p.Text})
+		case p.Type == "image_url" && p.ImageURL != nil:
+			u := p.ImageURL.URL
+			if mediaType, data, ok := provider.ParseDataURL(u); ok {
+				out = append(out, geminiPart{InlineData: &geminiBlob{MimeType: mediaType, Data: data}})
+			} else {
+				out = append(out, geminiPart{FileData: &geminiFileData{MimeType: provider.ImageMediaType(u), FileURI: u}})
+			}
+		}
+	}
+	if len(out) == 0 {
+		out = append(out, geminiPart{})
+	}
+	return out
+}
+
 // translateResponse converts a Gemini generateContent JSON response to an
 // OpenAI-format ChatResponse.
 func translateResponse(data []byte, requestModel string) (*gateway.ChatResponse, error) {
 	r := gjson.ParseBytes(data)
 
-	stopReason := mapStopReason(r.Get("candidates.0.finishReason").String())
+	stopReason := provider.NormalizeFinishReason(r.Get("candidates.0.finishReason").String())
 
 	// Extract content from first candidate.
 	var contentText strings.Builder
@@ -145,8 +189,9 @@ func translateResponse(data []byte, requestModel string) (*gateway.ChatResponse,
 	if len(toolCalls) > 0 {
 		tc, _ := json.Marshal(toolCalls)
 		msg.ToolCalls = tc
-		if stopReason == "" {
-			stopReason = "tool_calls"
+		// Gemini reports STOP for function calls; OpenAI clients expect tool_calls.
+		if stopReason == "" || stopReason == provider.FinishStop {
+			stopReason = provider.FinishToolCalls
 		}
 	}
 
@@ -167,47 +212,3 @@ func translateResponse(data []byte, requestModel string) (*gateway.ChatResponse,
 		Usage:   usage,
 	}, nil
 }
-
-// mapStopReason converts Gemini finish reasons to OpenAI finish reasons.
-func mapStopReason(reason string) string {
-	switch reason {
-	case "STOP":
-		return "stop"
-	case "MAX_TOKENS":
-		return "length"
-	case "SAFETY":
-		return "content_filter"
-	case "RECITATION":
-		return "content_filter"
-	default:
-		return reason
-	}
-}
-
-// extractText extracts a text string from a JSON content field which may be
-// a raw string or a structured content array.
-func extractText(raw json.RawMessage) string {
-	if len(raw) == 0 {
-		return ""
-	}
-	// Try as quoted string first.
-	var s string
-	if json.Unmarshal(raw, &s) == nil {
-		return s
-	}
-	// Try as array of content parts (OpenAI multimodal format).
-	var parts []struct {
-		Type string `json:"type"`
-		Text string `json:"text"`
-	}
-	if json.Unmarshal(raw, &parts) == nil {
-		var b strings.Builder
-		for _, p := range parts {
-			if p.Type == "text" {
-				b.WriteString(p.Text)
-			}
-		}
-		return b.String()
-	}
-	return string(raw)
-}
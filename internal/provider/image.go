@@ -0,0 +1,211 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+// DefaultMaxImageBytes caps a downloaded image; larger ones fail the request.
+const DefaultMaxImageBytes = 20 << 20
+
+// ContentPart is one element of an OpenAI multimodal message content array.
+type ContentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL is the image_url object of an OpenAI image content part: an
+// http(s) link or a base64 data URL.
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ContentParts splits an array message content into its raw parts and the
+// decoded type/text/image_url of each. ok is false for string content.
+func ContentParts(raw json.RawMessage) (raws []json.RawMessage, parts []ContentPart, ok bool) {
+	if len(raw) == 0 || raw[0] != '[' {
+		return nil, nil, false
+	}
+	if json.Unmarshal(raw, &raws) != nil {
+		return nil, nil, false
+	}
+	parts = make([]ContentPart, len(raws))
+	for i, r := range raws {
+		_ = json.Unmarshal(r, &parts[i]) // unknown shapes keep a zero part
+	}
+	return raws, parts, true
+}
+
+// ParseDataURL splits a base64 data URL ("data:image/png;base64,...") into
+// its media type and base64 payload.
+func ParseDataURL(u string) (mediaType, data string, ok bool) {
+	rest, found := strings.CutPrefix(u, "data:")
+	if !found {
+		return "", "", false
+	}
+	meta, data, found := strings.Cut(rest, ",")
+	if !found {
+		return "", "", false
+	}
+	mediaType, found = strings.CutSuffix(meta, ";base64")
+	if !found {
+		return "", "", false
+	}
+	return mediaType, data, true
+}
+
+// ImageMediaType guesses an image's media type from its URL path extension,
+// for providers that require one alongside a remote URI. "" if unknown.
+func ImageMediaType(u string) string {
+	if i := strings.IndexAny(u, "?#"); i >= 0 {
+		u = u[:i]
+	}
+	t := mime.TypeByExtension(path.Ext(u))
+	if !strings.HasPrefix(t, "image/") {
+		return ""
+	}
+	return t
+}
+
+// ImageFetcher downloads remote image_url links so adapters whose API only
+// accepts inline images can send them as base64. Its dialer refuses
+// loopback, private, and link-local addresses, so clients can't use the
+// gateway to reach its own network. It connects directly, never through an
+// egress proxy, so the check sees the real peer.
+type ImageFetcher struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+// NewImageFetcher returns a fetcher that rejects images over maxBytes
+// (DefaultMaxImageBytes when <= 0).
+func NewImageFetcher(maxBytes int64) *ImageFetcher {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxImageBytes
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: denyInternal}
+	return &ImageFetcher{
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: 10 * time.Second,
+			},
+		},
+		maxBytes: maxBytes,
+	}
+}
+
+// errInternalImageHost is returned when an image URL resolves to a
+// non-public address.
+var errInternalImageHost = errors.New("image host resolves to an internal address")
+
+// denyInternal is a net.Dialer Control hook that runs after DNS resolution,
+// so rebinding a public name to an internal address is caught too.
+func denyInternal(_, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if IsInternalAddr(ap.Addr()) {
+		return errInternalImageHost
+	}
+	return nil
+}
+
+// Fetch downloads u and returns its media type and base64 content.
+func (f *ImageFetcher) Fetch(ctx context.Context, u string) (mediaType, data string, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes+1))
+	if err != nil {
+		return "", "", err
+	}
+	if int64(len(body)) > f.maxBytes {
+		return "", "", fmt.Errorf("image exceeds %d bytes", f.maxBytes)
+	}
+	mediaType, _, _ = mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "image/") {
+		mediaType = http.DetectContentType(body)
+	}
+	if !strings.HasPrefix(mediaType, "image/") {
+		return "", "", fmt.Errorf("not an image (%s)", mediaType)
+	}
+	return mediaType, base64.StdEncoding.EncodeToString(body), nil
+}
+
+// InlineImages returns req with every http(s) image_url part replaced by a
+// base64 data URL downloaded through f. req itself is returned (no copy)
+// when f is nil or there is nothing to download; otherwise the copy shares
+// all but the rewritten messages. Download failures wrap
+// gateway.ErrBadRequest, since the URL came from the client.
+func InlineImages(ctx context.Context, f *ImageFetcher, req *gateway.ChatRequest) (*gateway.ChatRequest, error) {
+	if f == nil {
+		return req, nil
+	}
+	var out []gateway.Message
+	for i, m := range req.Messages {
+		raws, parts, ok := ContentParts(m.Content)
+		if !ok {
+			continue
+		}
+		changed := false
+		for j, p := range parts {
+			if p.Type != "image_url" || p.ImageURL == nil || !isRemoteURL(p.ImageURL.URL) {
+				continue
+			}
+			mediaType, data, err := f.Fetch(ctx, p.ImageURL.URL)
+			if err != nil {
+				return nil, fmt.Errorf("%w: fetch image_url: %v", gateway.ErrBadRequest, err)
+			}
+			p.ImageURL.URL = "data:" + mediaType + ";base64," + data
+			if raws[j], err = json.Marshal(p); err != nil {
+				return nil, err
+			}
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+		if out == nil {
+			out = append([]gateway.Message(nil), req.Messages...)
+		}
+		out[i].Content, _ = json.Marshal(raws)
+	}
+	if out == nil {
+		return req, nil
+	}
+	cp := *req
+	cp.Messages = out
+	return &cp, nil
+}
+
+func isRemoteURL(u string) bool {
+	return strings.HasPrefix(u, "https://") || strings.HasPrefix(u, "http://")
+}
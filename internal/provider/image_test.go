@@ -0,0 +1,99 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+func TestParseDataURL(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		in              string
+		mediaType, data string
+		ok              bool
+	}{
+		{"data:image/png;base64,iVBORw0KGgo=", "image/png", "iVBORw0KGgo=", true},
+		{"data:image/png,rawbytes", "", "", false}, // not base64
+		{"https://example.com/cat.png", "", "", false},
+		{"data:image/png;base64", "", "", false},
+	}
+	for _, tt := range tests {
+		mediaType, data, ok := ParseDataURL(tt.in)
+		if mediaType != tt.mediaType || data != tt.data || ok != tt.ok {
+			t.Errorf("ParseDataURL(%q) = %q, %q, %v; want %q, %q, %v", tt.in, mediaType, data, ok, tt.mediaType, tt.data, tt.ok)
+		}
+	}
+}
+
+func TestInlineImages(t *testing.T) {
+	t.Parallel()
+	png := []byte("\x89PNG\r\n\x1a\n")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/cat.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(png)
+	}))
+	defer srv.Close()
+	f := &ImageFetcher{client: srv.Client(), maxBytes: DefaultMaxImageBytes}
+
+	orig := json.RawMessage(`[{"type":"text","text":"hi"},{"type":"image_url","image_url":{"url":"` + srv.URL + `/cat.png"}}]`)
+	req := &gateway.ChatRequest{Messages: []gateway.Message{
+		{Role: "system", Content: json.RawMessage(`"sys"`)},
+		{Role: "user", Content: orig},
+	}}
+
+	got, err := InlineImages(context.Background(), f, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == req {
+		t.Fatal("expected a copy when an image was inlined")
+	}
+	want := `[{"type":"text","text":"hi"},{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBORw0KGgo="}}]`
+	if string(got.Messages[1].Content) != want {
+		t.Errorf("content = %s, want %s", got.Messages[1].Content, want)
+	}
+	if string(req.Messages[1].Content) != string(orig) {
+		t.Error("original request was modified")
+	}
+
+	// No fetcher, or nothing remote: the request is returned as is.
+	if r, _ := InlineImages(context.Background(), nil, req); r != req {
+		t.Error("nil fetcher should return req unchanged")
+	}
+	if r, _ := InlineImages(context.Background(), f, got); r != got {
+		t.Error("request without remote images should be returned unchanged")
+	}
+
+	// Download failures are client errors.
+	bad := &gateway.ChatRequest{Messages: []gateway.Message{
+		{Role: "user", Content: json.RawMessage(`[{"type":"image_url","image_url":{"url":"` + srv.URL + `/missing.png"}}]`)},
+	}}
+	if _, err := InlineImages(context.Background(), f, bad); !errors.Is(err, gateway.ErrBadRequest) {
+		t.Errorf("err = %v, want ErrBadRequest", err)
+	}
+}
+
+func TestImageFetcher_DeniesInternal(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	}))
+	defer srv.Close()
+
+	// The default dialer refuses the loopback test server.
+	_, _, err := NewImageFetcher(0).Fetch(context.Background(), srv.URL+"/cat.png")
+	if !errors.Is(err, errInternalImageHost) {
+		t.Errorf("err = %v, want errInternalImageHost", err)
+	}
+}
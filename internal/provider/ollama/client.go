@@ -10,6 +10,7 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/tidwall/gjson"
 
@@ -24,10 +25,15 @@ const (
 )
 
 var (
-	_ gateway.Provider    = (*Client)(nil)
-	_ gateway.NativeProxy = (*Client)(nil)
+	_ gateway.Provider               = (*Client)(nil)
+	_ gateway.NativeProxy            = (*Client)(nil)
+	_ gateway.SamplingParamsReporter = (*Client)(nil)
 )
 
+// samplingParams are the sampling parameters Ollama's OpenAI-compatible
+// endpoint handles reliably; the penalties are dropped rather than sent.
+var samplingParams = []string{"temperature", "top_p", "seed"}
+
 // Client is an Ollama provider adapter that implements gateway.Provider
 // and gateway.NativeProxy. It delegates translated (OpenAI-format) requests
 // to Ollama's OpenAI-compatible endpoint and raw native requests via ProxyRequest.
@@ -35,6 +41,8 @@ type Client struct {
 	name    string
 	baseURL string
 	http    *http.Client
+
+	finishGrace time.Duration // see SetFinishGrace
 }
 
 // New creates an Ollama Client.
@@ -55,12 +63,21 @@ func New(name, baseURL string, client *http.Client) *Client {
 	}
 }
 
+// SetFinishGrace sets the quiet period after a stream's final finish
+// reason; see sseutil.NewFinishWatch.
+func (c *Client) SetFinishGrace(d time.Duration) {
+	c.finishGrace = d
+}
+
 // Name returns the instance identifier.
 func (c *Client) Name() string { return c.name }
 
 // Type returns the wire format identifier.
 func (c *Client) Type() string { return providerName }
 
+// SupportedSamplingParams reports the sampling parameters Ollama accepts.
+func (c *Client) SupportedSamplingParams() []string { return samplingParams }
+
 // openaiURL returns the OpenAI-compatible API base URL for Ollama.
 func (c *Client) openaiURL() string { return c.baseURL + "/v1" }
 
@@ -92,6 +109,7 @@ func (c *Client) ChatCompletion(ctx context.Context, req *gateway.ChatRequest) (
 	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
 		return nil, fmt.Errorf("ollama: decode response: %w", err)
 	}
+	provider.NormalizeChoices(&out)
 	return &out, nil
 }
 
@@ -122,7 +140,7 @@ func (c *Client) ChatCompletionStream(ctx context.Context, req *gateway.ChatRequ
 	}
 
 	ch := make(chan gateway.StreamChunk, 8)
-	go sseutil.ReadSSEStream(ctx, providerName, resp, ch)
+	go sseutil.ReadSSEStream(ctx, providerName, resp, ch, c.finishGrace)
 	return ch, nil
 }
 
@@ -174,7 +192,7 @@ func (c *Client) ListModels(ctx context.Context) ([]string, error) {
 		return nil, provider.ParseAPIError(providerName, resp)
 	}
 
-	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("ollama: read response: %w", err)
 	}
@@ -60,6 +60,29 @@ func TestChatCompletion(t *testing.T) {
 	}
 }
 
+func TestChatCompletionFinishReason(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"chatcmpl-ollama","object":"chat.completion","model":"llama3",`+
+			`"choices":[{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"max_length"}]}`)
+	}))
+	defer ts.Close()
+
+	c := New("ollama", ts.URL, nil)
+	resp, err := c.ChatCompletion(context.Background(), &gateway.ChatRequest{
+		Model:    "llama3",
+		Messages: []gateway.Message{{Role: "user", Content: json.RawMessage(`"hi"`)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Choices[0].FinishReason; got != "length" {
+		t.Errorf("finish_reason = %q, want length", got)
+	}
+}
+
 func TestChatCompletionStream(t *testing.T) {
 	t.Parallel()
 
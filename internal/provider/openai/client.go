@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	gateway "github.com/eugener/gandalf/internal"
 	"github.com/eugener/gandalf/internal/provider"
@@ -20,8 +21,9 @@ const (
 )
 
 var (
-	_ gateway.Provider    = (*Client)(nil)
-	_ gateway.NativeProxy = (*Client)(nil)
+	_ gateway.Provider           = (*Client)(nil)
+	_ gateway.NativeProxy        = (*Client)(nil)
+	_ gateway.CapabilityReporter = (*Client)(nil)
 )
 
 // Client is an OpenAI provider adapter that implements gateway.Provider.
@@ -30,6 +32,8 @@ type Client struct {
 	baseURL string
 	http    *http.Client
 	hosting string // "", "azure"
+
+	finishGrace time.Duration // see SetFinishGrace
 }
 
 // New creates an OpenAI Client for direct API access.
@@ -50,6 +54,12 @@ func New(name, baseURL string, client *http.Client) *Client {
 	}
 }
 
+// SetFinishGrace sets the quiet period after a stream's final finish
+// reason; see sseutil.NewFinishWatch.
+func (c *Client) SetFinishGrace(d time.Duration) {
+	c.finishGrace = d
+}
+
 // NewWithHosting creates an OpenAI Client for a specific hosting platform.
 // For hosting="azure", ListModels returns the deployment model from the base URL.
 func NewWithHosting(name, baseURL string, client *http.Client, hosting string) *Client {
@@ -91,6 +101,7 @@ func (c *Client) ChatCompletion(ctx context.Context, req *gateway.ChatRequest) (
 	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
 		return nil, fmt.Errorf("openai: decode response: %w", err)
 	}
+	provider.NormalizeChoices(&out)
 	return &out, nil
 }
 
@@ -127,7 +138,7 @@ func (c *Client) ChatCompletionStream(ctx context.Context, req *gateway.ChatRequ
 	}
 
 	ch := make(chan gateway.StreamChunk, 8)
-	go sseutil.ReadSSEStream(ctx, providerName, resp, ch)
+	go sseutil.ReadSSEStream(ctx, providerName, resp, ch, c.finishGrace)
 	return ch, nil
 }
 
@@ -229,14 +240,27 @@ func (c *Client) HealthCheck(ctx context.Context) error {
 	return err
 }
 
+// Capabilities reports model capabilities. Embedding models support only
+// embeddings; all other models support chat with tools, vision, and streaming.
+func (c *Client) Capabilities(model string) gateway.Capabilities {
+	if strings.HasPrefix(model, "text-embedding") {
+		return gateway.Capabilities{Embeddings: true}
+	}
+	return gateway.Capabilities{Chat: true, Tools: true, Vision: true, Streaming: true}
+}
+
 // ProxyRequest forwards a raw HTTP request to the OpenAI API.
 // It implements the gateway.NativeProxy interface.
 func (c *Client) ProxyRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, path string) error {
 	return provider.ForwardRequest(ctx, c.http, c.baseURL, nil, w, r, path)
 }
 
-// setHeaders applies content-type to an outbound request.
+// setHeaders applies content-type and any beta features the client asked
+// for (see gateway.SetBetaFeatures) to an outbound request.
 // Auth is handled by the transport chain.
 func (c *Client) setHeaders(r *http.Request) {
 	r.Header.Set("Content-Type", "application/json")
+	if betas := gateway.BetaFeaturesFromContext(r.Context(), providerName); len(betas) > 0 {
+		r.Header.Set("OpenAI-Beta", strings.Join(betas, ","))
+	}
 }
@@ -1,6 +1,7 @@
 package openai
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -10,6 +11,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/tidwall/gjson"
+
 	gateway "github.com/eugener/gandalf/internal"
 	"github.com/eugener/gandalf/internal/cloudauth"
 )
@@ -84,6 +87,56 @@ func TestChatCompletionStream(t *testing.T) {
 	}
 }
 
+func TestChatCompletionStreamGzip(t *testing.T) {
+	t.Parallel()
+
+	// Gzip-compressed SSE, flushed per event like a real upstream.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			t.Errorf("Accept-Encoding = %q, want gzip offered by the transport", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		for _, content := range []string{"Hello", " world"} {
+			fmt.Fprintf(zw, "data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"delta\":{\"content\":%q},\"index\":0}]}\n\n", content)
+			zw.Flush()
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(zw, "data: [DONE]\n\n")
+		zw.Close()
+	}))
+	defer srv.Close()
+
+	client := testClient("openai", "test-key", srv.URL+"/v1")
+	ch, err := client.ChatCompletionStream(context.Background(), &gateway.ChatRequest{
+		Model:    "gpt-4o",
+		Messages: []gateway.Message{{Role: "user", Content: json.RawMessage(`"hi"`)}},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletionStream: %v", err)
+	}
+
+	var text strings.Builder
+	var done bool
+	for c := range ch {
+		if c.Err != nil {
+			t.Fatalf("chunk error: %v", c.Err)
+		}
+		if c.Done {
+			done = true
+			continue
+		}
+		text.WriteString(gjson.GetBytes(c.Data, "choices.0.delta.content").String())
+	}
+	if !done {
+		t.Error("stream should end with Done")
+	}
+	if text.String() != "Hello world" {
+		t.Errorf("content = %q, want %q", text.String(), "Hello world")
+	}
+}
+
 func TestChatCompletionStreamContextCancel(t *testing.T) {
 	t.Parallel()
 
@@ -173,7 +226,8 @@ func TestChatCompletion(t *testing.T) {
 				Message:      gateway.Message{Role: "assistant", Content: json.RawMessage(`"Hello!"`)},
 				FinishReason: "stop",
 			}},
-			Usage: &gateway.Usage{PromptTokens: 5, CompletionTokens: 3, TotalTokens: 8},
+			Usage:             &gateway.Usage{PromptTokens: 5, CompletionTokens: 3, TotalTokens: 8},
+			SystemFingerprint: "fp_44709d6fcb",
 		})
 	}))
 	defer srv.Close()
@@ -192,6 +246,61 @@ func TestChatCompletion(t *testing.T) {
 	if resp.Usage == nil || resp.Usage.TotalTokens != 8 {
 		t.Errorf("usage = %v", resp.Usage)
 	}
+	if resp.SystemFingerprint != "fp_44709d6fcb" {
+		t.Errorf("system_fingerprint = %q, want fp_44709d6fcb", resp.SystemFingerprint)
+	}
+}
+
+func TestChatCompletionBetaHeader(t *testing.T) {
+	t.Parallel()
+
+	var openaiBeta, anthropicBeta string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		openaiBeta, anthropicBeta = r.Header.Get("OpenAI-Beta"), r.Header.Get("anthropic-beta")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(gateway.ChatResponse{ID: "chatcmpl-1"})
+	}))
+	defer srv.Close()
+
+	client := testClient("openai", "test-key", srv.URL+"/v1")
+	req := &gateway.ChatRequest{Model: "gpt-4o", Messages: []gateway.Message{{Role: "user", Content: json.RawMessage(`"hi"`)}}}
+
+	ctx := gateway.ContextWithRequestID(context.Background(), "req-1")
+	gateway.SetBetaFeatures(ctx, "anthropic", []string{"prompt-caching-2024-07-31"})
+	if _, err := client.ChatCompletion(ctx, req); err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	if openaiBeta != "" || anthropicBeta != "" {
+		t.Errorf("anthropic betas leaked upstream: OpenAI-Beta = %q, anthropic-beta = %q", openaiBeta, anthropicBeta)
+	}
+
+	gateway.SetBetaFeatures(ctx, "openai", []string{"assistants=v2"})
+	if _, err := client.ChatCompletion(ctx, req); err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	if openaiBeta != "assistants=v2" {
+		t.Errorf("OpenAI-Beta = %q, want assistants=v2", openaiBeta)
+	}
+}
+
+func TestChatCompletionLegacyFunctionCall(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o",`+
+			`"choices":[{"index":0,"message":{"role":"assistant","content":null},"finish_reason":"function_call"}]}`)
+	}))
+	defer ts.Close()
+
+	c := testClient("openai", "sk-test", ts.URL)
+	resp, err := c.ChatCompletion(context.Background(), &gateway.ChatRequest{Model: "gpt-4o"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Choices[0].FinishReason; got != "tool_calls" {
+		t.Errorf("finish_reason = %q, want tool_calls", got)
+	}
 }
 
 func TestChatCompletionHTTPError(t *testing.T) {
@@ -312,6 +421,30 @@ func TestEmbeddings(t *testing.T) {
 	}
 }
 
+func TestEmbeddingsDimensions(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got := gjson.GetBytes(body, "dimensions").Int(); got != 256 {
+			t.Errorf("dimensions = %d, want 256; body = %s", got, body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1,0.2]}],"model":"text-embedding-3-small"}`)
+	}))
+	defer srv.Close()
+
+	dims := 256
+	client := testClient("openai", "test-key", srv.URL+"/v1")
+	if _, err := client.Embeddings(context.Background(), &gateway.EmbeddingRequest{
+		Model:      "text-embedding-3-small",
+		Input:      json.RawMessage(`"hello world"`),
+		Dimensions: &dims,
+	}); err != nil {
+		t.Fatalf("Embeddings: %v", err)
+	}
+}
+
 func TestAzureListModelsReturnsNil(t *testing.T) {
 	t.Parallel()
 
@@ -395,3 +528,97 @@ func TestEmbeddingsHTTPError(t *testing.T) {
 		t.Errorf("error = %q, want 429", err)
 	}
 }
+
+func TestCapabilities(t *testing.T) {
+	t.Parallel()
+	c := New("openai", "", nil)
+
+	tests := []struct {
+		model string
+		want  gateway.Capabilities
+	}{
+		{"gpt-4o", gateway.Capabilities{Chat: true, Tools: true, Vision: true, Streaming: true}},
+		{"text-embedding-3-small", gateway.Capabilities{Embeddings: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			t.Parallel()
+			if got := c.Capabilities(tt.model); got != tt.want {
+				t.Errorf("Capabilities(%q) = %+v, want %+v", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChatCompletion_KeyRotationOn429(t *testing.T) {
+	t.Parallel()
+
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		keys = append(keys, auth)
+		var req gateway.ChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Model != "gpt-4o" {
+			t.Errorf("attempt with %s: body not replayed (model=%q, err=%v)", auth, req.Model, err)
+		}
+		if auth == "Bearer key-limited" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error":{"message":"Rate limit reached"}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`)
+	}))
+	defer srv.Close()
+
+	transport := &cloudauth.APIKeyTransport{
+		Keys:       []string{"key-limited", "key-ok"},
+		HeaderName: "Authorization",
+		Prefix:     "Bearer ",
+	}
+	client := New("openai", srv.URL+"/v1", &http.Client{Transport: transport})
+	resp, err := client.ChatCompletion(context.Background(), &gateway.ChatRequest{
+		Model:    "gpt-4o",
+		Messages: []gateway.Message{{Role: "user", Content: json.RawMessage(`"hi"`)}},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	if resp.ID != "chatcmpl-1" {
+		t.Errorf("id = %q, want chatcmpl-1", resp.ID)
+	}
+	if len(keys) != 2 || keys[0] != "Bearer key-limited" || keys[1] != "Bearer key-ok" {
+		t.Errorf("keys tried = %v, want [Bearer key-limited Bearer key-ok]", keys)
+	}
+}
+
+func TestChatCompletion_KeepsSystemMessageOrder(t *testing.T) {
+	t.Parallel()
+
+	var got gateway.ChatRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"c1","object":"chat.completion","choices":[]}`)
+	}))
+	defer srv.Close()
+
+	client := testClient("openai", "test-key", srv.URL+"/v1")
+	_, err := client.ChatCompletion(context.Background(), &gateway.ChatRequest{
+		Model: "gpt-4o",
+		Messages: []gateway.Message{
+			{Role: "user", Content: json.RawMessage(`"hi"`)},
+			{Role: "system", Content: json.RawMessage(`"Be brief."`)},
+			{Role: "system", Content: json.RawMessage(`"Answer in French."`)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	// OpenAI accepts system messages anywhere; their position is meaningful.
+	if len(got.Messages) != 3 || got.Messages[0].Role != "user" || got.Messages[1].Role != "system" || got.Messages[2].Role != "system" {
+		t.Fatalf("upstream messages = %+v, want [user system system]", got.Messages)
+	}
+}
@@ -0,0 +1,157 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultResetFlushThreshold is how many consecutive connection resets
+// flush a provider's connection pool when no threshold is configured.
+const DefaultResetFlushThreshold = 3
+
+// idleCloser is the part of *http.Transport PoolTransport manages.
+type idleCloser interface {
+	http.RoundTripper
+	CloseIdleConnections()
+}
+
+// PoolTransport keeps a long-lived provider connection pool healthy.
+// Connections older than MaxConnLifetime are retired, and after
+// ResetThreshold consecutive connection resets the idle pool is flushed so
+// the next requests dial fresh connections instead of reusing ones the
+// provider (or a load balancer in front of it) has already dropped.
+//
+// NewPoolTransport wraps the base DialContext to stamp each connection with
+// its dial time. When a request is handed a connection past MaxConnLifetime,
+// the request is sent with Connection: close, so the connection takes no
+// further requests: HTTP/1.1 closes it after the response, HTTP/2 once its
+// open streams finish. Busy connections are retired too, on the next request
+// they get. A connection that is never picked again closes at the idle
+// timeout.
+type PoolTransport struct {
+	Base            idleCloser
+	Provider        string        // for logs
+	MaxConnLifetime time.Duration // 0 = connections live until idle timeout
+	ResetThreshold  int           // 0 = DefaultResetFlushThreshold, negative = never flush on resets
+
+	mu     sync.Mutex
+	resets int
+}
+
+// NewPoolTransport wraps base, stamping the connections it dials with their
+// age. See PoolTransport for the fields.
+func NewPoolTransport(base *http.Transport, providerName string, maxConnLifetime time.Duration, resetThreshold int) *PoolTransport {
+	if maxConnLifetime > 0 {
+		dial := base.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{}).DialContext
+		}
+		base.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dial(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &agedConn{Conn: conn, dialed: time.Now()}, nil
+		}
+	}
+	return &PoolTransport{
+		Base:            base,
+		Provider:        providerName,
+		MaxConnLifetime: maxConnLifetime,
+		ResetThreshold:  resetThreshold,
+	}
+}
+
+// agedConn is a connection stamped with when it was dialed.
+type agedConn struct {
+	net.Conn
+	dialed time.Time
+}
+
+// connAge returns how long ago conn was dialed, unwrapping TLS. ok is false
+// for connections NewPoolTransport didn't dial.
+func connAge(conn net.Conn) (age time.Duration, ok bool) {
+	if tc, isTLS := conn.(interface{ NetConn() net.Conn }); isTLS {
+		conn = tc.NetConn()
+	}
+	ac, ok := conn.(*agedConn)
+	if !ok {
+		return 0, false
+	}
+	return time.Since(ac.dialed), true
+}
+
+// RoundTrip forwards the request, retiring expired connections and
+// flushing the pool on repeated resets.
+func (t *PoolTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if t.MaxConnLifetime > 0 {
+		r = t.retireExpired(r)
+	}
+	resp, err := t.Base.RoundTrip(r)
+	t.observe(r, err)
+	return resp, err
+}
+
+// CloseIdleConnections closes the base transport's idle connections.
+func (t *PoolTransport) CloseIdleConnections() {
+	t.Base.CloseIdleConnections()
+}
+
+// retireExpired returns a copy of r that, once the transport picks a
+// connection past MaxConnLifetime, asks for that connection to be closed
+// after this request. The header is set rather than only r.Close because
+// HTTP/2 copies r.Close before the connection is chosen but shares the
+// header map; it never sends the header itself.
+func (t *PoolTransport) retireExpired(r *http.Request) *http.Request {
+	var out *http.Request
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if age, ok := connAge(info.Conn); ok && age >= t.MaxConnLifetime {
+				out.Close = true
+				out.Header.Set("Connection", "close")
+			}
+		},
+	}
+	out = r.Clone(httptrace.WithClientTrace(r.Context(), trace))
+	return out
+}
+
+// observe counts consecutive connection resets and flushes the pool when
+// they reach the threshold. Any other outcome resets the count.
+func (t *PoolTransport) observe(r *http.Request, err error) {
+	threshold := t.ResetThreshold
+	if threshold < 0 {
+		return
+	}
+	if threshold == 0 {
+		threshold = DefaultResetFlushThreshold
+	}
+
+	t.mu.Lock()
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.resets = 0
+		t.mu.Unlock()
+		return
+	}
+	t.resets++
+	flush := t.resets >= threshold
+	if flush {
+		t.resets = 0
+	}
+	t.mu.Unlock()
+
+	if flush {
+		slog.LogAttrs(r.Context(), slog.LevelWarn, "flushing provider connection pool after repeated resets",
+			slog.String("provider", t.Provider),
+			slog.Int("resets", threshold),
+		)
+		t.Base.CloseIdleConnections()
+	}
+}
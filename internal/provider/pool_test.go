@@ -0,0 +1,211 @@
+package provider
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// resetTransport fails with a connection reset while reset is set and
+// counts pool flushes.
+type resetTransport struct {
+	reset   atomic.Bool
+	flushes atomic.Int32
+}
+
+func (t *resetTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if t.reset.Load() {
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: r}, nil
+}
+
+func (t *resetTransport) CloseIdleConnections() { t.flushes.Add(1) }
+
+func poolRoundTrip(pt *PoolTransport) error {
+	req := httptest.NewRequest(http.MethodPost, "https://api.example.com/v1/chat/completions", nil)
+	resp, err := pt.RoundTrip(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return err
+}
+
+func TestPoolTransport_FlushesOnRepeatedResets(t *testing.T) {
+	t.Parallel()
+
+	base := &resetTransport{}
+	pt := &PoolTransport{Base: base, Provider: "openai", ResetThreshold: 3}
+
+	base.reset.Store(true)
+	for i := range 2 {
+		if err := poolRoundTrip(pt); err == nil {
+			t.Fatalf("request %d: expected reset error", i)
+		}
+	}
+	if n := base.flushes.Load(); n != 0 {
+		t.Fatalf("flushes after 2 resets = %d, want 0", n)
+	}
+
+	// A success in between restarts the count.
+	base.reset.Store(false)
+	if err := poolRoundTrip(pt); err != nil {
+		t.Fatal(err)
+	}
+	base.reset.Store(true)
+	for range 2 {
+		poolRoundTrip(pt)
+	}
+	if n := base.flushes.Load(); n != 0 {
+		t.Fatalf("flushes after interrupted resets = %d, want 0", n)
+	}
+
+	poolRoundTrip(pt) // third consecutive reset
+	if n := base.flushes.Load(); n != 1 {
+		t.Fatalf("flushes after 3 consecutive resets = %d, want 1", n)
+	}
+	for range 3 {
+		poolRoundTrip(pt)
+	}
+	if n := base.flushes.Load(); n != 2 {
+		t.Errorf("flushes after 6 consecutive resets = %d, want 2", n)
+	}
+}
+
+func TestPoolTransport_IgnoresOtherErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		threshold int
+		err       error
+		wantFlush int32
+	}{
+		{"default threshold", 0, syscall.ECONNRESET, 1},
+		{"disabled", -1, syscall.ECONNRESET, 0},
+		{"other error", 1, fmt.Errorf("dial: %w", syscall.ECONNREFUSED), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			base := &resetTransport{}
+			pt := &PoolTransport{Base: errTransport{base, tt.err}, ResetThreshold: tt.threshold}
+			for range DefaultResetFlushThreshold {
+				poolRoundTrip(pt)
+			}
+			if n := base.flushes.Load(); n != tt.wantFlush {
+				t.Errorf("flushes = %d, want %d", n, tt.wantFlush)
+			}
+		})
+	}
+}
+
+// errTransport always fails with err.
+type errTransport struct {
+	*resetTransport
+	err error
+}
+
+func (t errTransport) RoundTrip(*http.Request) (*http.Response, error) { return nil, t.err }
+
+// TestPoolTransport_RealConnections checks against a real *http.Transport
+// that a connection past its lifetime serves one last request and the next
+// one dials a new connection.
+func TestPoolTransport_RealConnections(t *testing.T) {
+	t.Parallel()
+
+	var dials atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			dials.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	pt := NewPoolTransport(NewTransport(nil, false), "ollama", 50*time.Millisecond, 0)
+	defer pt.CloseIdleConnections()
+	client := &http.Client{Transport: pt}
+	get := func() {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	get()
+	get()
+	if n := dials.Load(); n != 1 {
+		t.Fatalf("connections within lifetime = %d, want 1 (reused)", n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	get()
+	get()
+	if n := dials.Load(); n != 2 {
+		t.Errorf("connections after lifetime = %d, want 2 (retired)", n)
+	}
+}
+
+// TestPoolTransport_RetiresBusyHTTP2 checks that an HTTP/2 connection that
+// is never idle, because a stream stays open on it, is still retired.
+func TestPoolTransport_RetiresBusyHTTP2(t *testing.T) {
+	t.Parallel()
+
+	var dials atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/hold" {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			<-release
+		}
+	}))
+	srv.EnableHTTP2 = true
+	srv.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			dials.Add(1)
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+	defer close(release)
+
+	base := NewTransport(nil, true)
+	base.TLSClientConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+	pt := NewPoolTransport(base, "openai", 50*time.Millisecond, 0)
+	defer pt.CloseIdleConnections()
+	client := &http.Client{Transport: pt}
+	get := func(path string) *http.Response {
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.ProtoMajor != 2 {
+			t.Fatalf("proto = %s, want HTTP/2", resp.Proto)
+		}
+		return resp
+	}
+
+	held := get("/hold")
+	defer held.Body.Close()
+	get("/").Body.Close()
+	if n := dials.Load(); n != 1 {
+		t.Fatalf("connections within lifetime = %d, want 1 (multiplexed)", n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	get("/").Body.Close()
+	get("/").Body.Close()
+	if n := dials.Load(); n != 2 {
+		t.Errorf("connections after lifetime = %d, want 2 (busy connection retired)", n)
+	}
+}
@@ -2,9 +2,11 @@
 package provider
 
 import (
+	"context"
 	"fmt"
 	"slices"
 	"sync"
+	"time"
 
 	gateway "github.com/eugener/gandalf/internal"
 )
@@ -14,19 +16,132 @@ import (
 type Registry struct {
 	mu        sync.RWMutex
 	providers map[string]gateway.Provider
+	required  map[string][]string // configured required chat fields, per provider
+	sampling  map[string][]string // configured supported sampling params, per provider
+
+	// Per-provider ListModels cache. Guarded by modelsMu, separate from mu
+	// so provider lookups on the request path never wait on it.
+	modelsMu  sync.Mutex
+	modelsTTL map[string]time.Duration
+	models    map[string]modelsEntry
+}
+
+// modelsEntry is a cached ListModels result.
+type modelsEntry struct {
+	models  []string
+	expires time.Time
 }
 
 // NewRegistry returns an empty, ready-to-use Registry.
 func NewRegistry() *Registry {
-	return &Registry{providers: make(map[string]gateway.Provider)}
+	return &Registry{
+		providers: make(map[string]gateway.Provider),
+		required:  make(map[string][]string),
+		sampling:  make(map[string][]string),
+		modelsTTL: make(map[string]time.Duration),
+		models:    make(map[string]modelsEntry),
+	}
 }
 
 // Register adds a provider under the given name.
-// It overwrites any previously registered provider with the same name.
+// It overwrites any previously registered provider with the same name
+// and drops its cached model list.
 func (r *Registry) Register(name string, p gateway.Provider) {
 	r.mu.Lock()
 	r.providers[name] = p
 	r.mu.Unlock()
+	r.modelsMu.Lock()
+	delete(r.models, name)
+	r.modelsMu.Unlock()
+}
+
+// SetRequiredFields declares chat request fields the named provider
+// requires, on top of any it reports via gateway.RequiredFieldsReporter.
+// An empty list clears them.
+func (r *Registry) SetRequiredFields(name string, fields []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(fields) == 0 {
+		delete(r.required, name)
+		return
+	}
+	r.required[name] = fields
+}
+
+// RequiredFields returns the chat request fields configured for the named
+// provider with SetRequiredFields.
+func (r *Registry) RequiredFields(name string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.required[name]
+}
+
+// SetSamplingParams declares the sampling parameters the named provider
+// supports, replacing any it reports via gateway.SamplingParamsReporter.
+// A nil list clears the declaration; an empty one supports none.
+func (r *Registry) SetSamplingParams(name string, params []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if params == nil {
+		delete(r.sampling, name)
+		return
+	}
+	r.sampling[name] = params
+}
+
+// SamplingParams returns the sampling parameters configured for the named
+// provider with SetSamplingParams, or nil when none are configured.
+func (r *Registry) SamplingParams(name string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.sampling[name]
+}
+
+// SetModelsTTL sets how long a provider's ListModels result is cached.
+// A ttl <= 0 disables caching for that provider (the default).
+func (r *Registry) SetModelsTTL(name string, ttl time.Duration) {
+	r.modelsMu.Lock()
+	defer r.modelsMu.Unlock()
+	if ttl <= 0 {
+		delete(r.modelsTTL, name)
+		delete(r.models, name)
+		return
+	}
+	r.modelsTTL[name] = ttl
+}
+
+// ListModels returns the named provider's model list, served from cache
+// while within the provider's TTL. Errors are never cached.
+func (r *Registry) ListModels(ctx context.Context, name string) ([]string, error) {
+	p, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	r.modelsMu.Lock()
+	ttl := r.modelsTTL[name]
+	if e, ok := r.models[name]; ok && time.Now().Before(e.expires) {
+		r.modelsMu.Unlock()
+		return e.models, nil
+	}
+	r.modelsMu.Unlock()
+
+	models, err := p.ListModels(ctx)
+	if err != nil || ttl <= 0 {
+		return models, err
+	}
+	r.modelsMu.Lock()
+	r.models[name] = modelsEntry{models: models, expires: time.Now().Add(ttl)}
+	r.modelsMu.Unlock()
+	return models, nil
+}
+
+// InvalidateModels drops all cached model lists, e.g. after providers
+// are changed through the admin API.
+func (r *Registry) InvalidateModels() {
+	r.modelsMu.Lock()
+	clear(r.models)
+	r.modelsMu.Unlock()
 }
 
 // Get returns the provider registered under name, or an error if not found.
@@ -5,7 +5,9 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	gateway "github.com/eugener/gandalf/internal"
 )
@@ -108,6 +110,98 @@ func TestRegistryOverwrite(t *testing.T) {
 	}
 }
 
+// countingProvider counts ListModels calls.
+type countingProvider struct {
+	fakeProvider
+	calls atomic.Int32
+}
+
+func (c *countingProvider) ListModels(_ context.Context) ([]string, error) {
+	c.calls.Add(1)
+	return []string{"gpt-4o"}, nil
+}
+
+func TestRegistryListModelsCache(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	reg := NewRegistry()
+	p := &countingProvider{fakeProvider: fakeProvider{name: "p1", typ: "openai"}}
+	reg.Register("p1", p)
+	reg.SetModelsTTL("p1", time.Minute)
+
+	for range 3 {
+		models, err := reg.ListModels(ctx, "p1")
+		if err != nil {
+			t.Fatalf("ListModels: %v", err)
+		}
+		if len(models) != 1 || models[0] != "gpt-4o" {
+			t.Fatalf("models = %v, want [gpt-4o]", models)
+		}
+	}
+	if n := p.calls.Load(); n != 1 {
+		t.Errorf("provider called %d times within TTL, want 1", n)
+	}
+
+	// Invalidation (config reload) forces a refetch.
+	reg.InvalidateModels()
+	if _, err := reg.ListModels(ctx, "p1"); err != nil {
+		t.Fatalf("ListModels: %v", err)
+	}
+	if n := p.calls.Load(); n != 2 {
+		t.Errorf("provider called %d times after invalidate, want 2", n)
+	}
+
+	// Re-registering the provider also drops its cached list.
+	reg.Register("p1", p)
+	if _, err := reg.ListModels(ctx, "p1"); err != nil {
+		t.Fatalf("ListModels: %v", err)
+	}
+	if n := p.calls.Load(); n != 3 {
+		t.Errorf("provider called %d times after re-register, want 3", n)
+	}
+}
+
+func TestRegistryListModelsExpiry(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		sleep time.Duration
+		want  int32
+	}{
+		{"no ttl, uncached", 0, 0, 2},
+		{"expired", 10 * time.Millisecond, 20 * time.Millisecond, 2},
+		{"within ttl", time.Minute, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			reg := NewRegistry()
+			p := &countingProvider{fakeProvider: fakeProvider{name: "p1", typ: "openai"}}
+			reg.Register("p1", p)
+			reg.SetModelsTTL("p1", tt.ttl)
+
+			reg.ListModels(ctx, "p1") //nolint:errcheck // call count is what matters
+			time.Sleep(tt.sleep)
+			reg.ListModels(ctx, "p1") //nolint:errcheck // call count is what matters
+
+			if n := p.calls.Load(); n != tt.want {
+				t.Errorf("provider calls = %d, want %d", n, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryListModelsUnknown(t *testing.T) {
+	t.Parallel()
+	if _, err := NewRegistry().ListModels(context.Background(), "missing"); err == nil {
+		t.Fatal("expected error for unregistered provider")
+	}
+}
+
 func TestAPIError(t *testing.T) {
 	t.Parallel()
 
@@ -1,16 +1,19 @@
 // Package provider implements the provider registry for LLM provider adapters.
 //
-// This file provides shared helpers: NewTransport for HTTP client setup and
-// ForwardRequest for native HTTP passthrough.
+// This file provides shared helpers: NewTransport, ProxyFunc, and
+// LimitTransport for HTTP client setup and ForwardRequest for native HTTP
+// passthrough.
 package provider
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -19,7 +22,8 @@ import (
 
 // NewTransport returns a tuned *http.Transport with connection pooling and
 // optional DNS caching. Set forceHTTP2 to true for remote HTTPS APIs, false
-// for local HTTP/1.1 servers (e.g. Ollama).
+// for local HTTP/1.1 servers (e.g. Ollama). Connections are direct; see
+// ProxyFunc to route them through a proxy.
 func NewTransport(resolver *dnscache.Resolver, forceHTTP2 bool) *http.Transport {
 	t := &http.Transport{
 		MaxIdleConnsPerHost: 100,
@@ -29,22 +33,120 @@ func NewTransport(resolver *dnscache.Resolver, forceHTTP2 bool) *http.Transport
 		TLSHandshakeTimeout: 5 * time.Second,
 	}
 	if resolver != nil {
-		t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
-			host, port, err := net.SplitHostPort(addr)
-			if err != nil {
-				return nil, err
-			}
-			ips, err := resolver.LookupHost(ctx, host)
-			if err != nil {
-				return nil, err
-			}
-			var d net.Dialer
-			return d.DialContext(ctx, network, net.JoinHostPort(ips[0], port))
-		}
+		t.DialContext = dialer(resolver, &net.Dialer{})
 	}
 	return t
 }
 
+// dialer returns d.DialContext, resolving hosts through resolver first when
+// it is non-nil.
+func dialer(resolver *dnscache.Resolver, d *net.Dialer) func(context.Context, string, string) (net.Conn, error) {
+	if resolver == nil {
+		return d.DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := resolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		return d.DialContext(ctx, network, net.JoinHostPort(ips[0], port))
+	}
+}
+
+// EnvProxy is the http_proxy value that proxies a provider's requests as
+// the environment says (HTTP_PROXY, HTTPS_PROXY, NO_PROXY).
+const EnvProxy = "env"
+
+// ProxyFunc returns the http.Transport.Proxy function for a provider's
+// http_proxy setting: empty connects directly, EnvProxy follows the
+// environment, anything else must be an http, https, or socks5 proxy URL.
+func ProxyFunc(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	switch proxy {
+	case "":
+		return nil, nil
+	case EnvProxy:
+		return http.ProxyFromEnvironment, nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy URL %q: scheme must be http, https, or socks5", proxy)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", proxy)
+	}
+	return http.ProxyURL(u), nil
+}
+
+// DefaultMaxResponseBytes caps a non-streaming provider response body when the
+// provider config doesn't set max_response_bytes. Large enough for big
+// embedding batches and long completions; matches the native passthrough cap.
+const DefaultMaxResponseBytes = 32 << 20
+
+// ErrResponseTooLarge is returned while reading a provider response body
+// that exceeds LimitTransport.Limit.
+var ErrResponseTooLarge = errors.New("provider response too large")
+
+// LimitTransport caps non-streaming response bodies at Limit bytes. Reading
+// past the cap fails with ErrResponseTooLarge instead of silently
+// truncating, which would otherwise surface as a confusing JSON decode
+// error. SSE and NDJSON streams are long-lived and not capped.
+type LimitTransport struct {
+	Base  http.RoundTripper
+	Limit int64 // <= 0 = DefaultMaxResponseBytes
+}
+
+// RoundTrip forwards the request and wraps the response body.
+func (t *LimitTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := t.Base.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	ct := resp.Header.Get("Content-Type")
+	if strings.HasPrefix(ct, "text/event-stream") || strings.HasPrefix(ct, "application/x-ndjson") {
+		return resp, nil
+	}
+	limit := t.Limit
+	if limit <= 0 {
+		limit = DefaultMaxResponseBytes
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: limit, limit: limit}
+	return resp, nil
+}
+
+// limitedBody reads at most limit bytes, then reports ErrResponseTooLarge
+// if the underlying body has more.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	limit     int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		var probe [1]byte
+		n, err := b.ReadCloser.Read(probe[:])
+		if n > 0 {
+			return 0, fmt.Errorf("%w: exceeds %d bytes", ErrResponseTooLarge, b.limit)
+		}
+		return 0, err
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
 // hopByHop headers that must not be forwarded between client and upstream.
 var hopByHopHeaders = map[string]struct{}{
 	"Connection":          {},
@@ -61,6 +163,8 @@ var hopByHopHeaders = map[string]struct{}{
 // It builds the target URL from baseURL + path (+ original query string),
 // copies non-hop-by-hop headers, calls setAuth to inject provider-specific
 // credentials, and streams the response back with flush-on-read for SSE/NDJSON.
+// When the upstream cannot be reached nothing is written to w, so the caller
+// can answer in the error format of the API being proxied.
 func ForwardRequest(ctx context.Context, client *http.Client, baseURL string,
 	setAuth func(http.Header), w http.ResponseWriter, r *http.Request, path string) error {
 
@@ -96,7 +200,6 @@ func ForwardRequest(ctx context.Context, client *http.Client, baseURL string,
 
 	resp, err := client.Do(outReq)
 	if err != nil {
-		http.Error(w, "upstream request failed", http.StatusBadGateway)
 		return fmt.Errorf("native proxy: do request: %w", err)
 	}
 	defer resp.Body.Close()
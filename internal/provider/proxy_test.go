@@ -2,6 +2,7 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -32,6 +33,9 @@ func TestNewTransportNilResolver(t *testing.T) {
 	if tr.DialContext != nil {
 		t.Error("DialContext should be nil when resolver is nil")
 	}
+	if tr.DisableCompression {
+		t.Error("DisableCompression should be false so gzip responses are decoded")
+	}
 }
 
 func TestNewTransportWithResolver(t *testing.T) {
@@ -59,6 +63,42 @@ func TestNewTransportForceHTTP2(t *testing.T) {
 	}
 }
 
+func TestProxyFunc(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest(http.MethodPost, "https://api.openai.com/v1/chat/completions", nil)
+
+	// Explicit proxy URL.
+	proxy, err := ProxyFunc("http://egress.internal:3128")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := NewTransport(nil, true)
+	tr.Proxy = proxy
+	got, err := tr.Proxy(req)
+	if err != nil || got == nil || got.String() != "http://egress.internal:3128" {
+		t.Errorf("Proxy(req) = %v, %v; want http://egress.internal:3128", got, err)
+	}
+
+	// Empty connects directly, as NewTransport does by default; the
+	// environment is only consulted with "env".
+	if proxy, err := ProxyFunc(""); err != nil || proxy != nil {
+		t.Errorf("ProxyFunc(\"\") = %p, %v; want nil, nil", proxy, err)
+	}
+	if NewTransport(nil, false).Proxy != nil {
+		t.Error("NewTransport should connect directly by default")
+	}
+	if proxy, err := ProxyFunc(EnvProxy); err != nil || proxy == nil {
+		t.Errorf("ProxyFunc(env) = %p, %v; want environment proxy", proxy, err)
+	}
+
+	for _, bad := range []string{"egress.internal:3128", "ftp://egress.internal", "http://"} {
+		if _, err := ProxyFunc(bad); err == nil {
+			t.Errorf("ProxyFunc(%q) = nil error, want error", bad)
+		}
+	}
+}
+
 func TestForwardRequest(t *testing.T) {
 	t.Parallel()
 
@@ -243,3 +283,75 @@ func TestForwardRequestStripsHopByHop(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestLimitTransport(t *testing.T) {
+	t.Parallel()
+
+	const limit = 1 << 20
+	tests := []struct {
+		name        string
+		contentType string
+		size        int
+		wantErr     bool
+	}{
+		{"under limit", "application/json", limit - 1, false},
+		{"at limit", "application/json", limit, false},
+		{"just over limit", "application/json", limit + 1, true},
+		{"sse not capped", "text/event-stream", limit + 1, false},
+		{"ndjson not capped", "application/x-ndjson", limit + 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(strings.Repeat("x", tt.size)))
+			}))
+			defer srv.Close()
+
+			client := &http.Client{Transport: &LimitTransport{Base: http.DefaultTransport, Limit: limit}}
+			resp, err := client.Get(srv.URL)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if tt.wantErr {
+				if !errors.Is(err, ErrResponseTooLarge) {
+					t.Errorf("err = %v, want ErrResponseTooLarge", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadAll: %v", err)
+			}
+			if len(body) != tt.size {
+				t.Errorf("body length = %d, want %d", len(body), tt.size)
+			}
+		})
+	}
+}
+
+func TestLimitTransportDefault(t *testing.T) {
+	t.Parallel()
+
+	size := 1<<20 + 1 // the old adapter read limit
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte(strings.Repeat("x", size)))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &LimitTransport{Base: http.DefaultTransport}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if len(body) != size {
+		t.Errorf("body length = %d, want %d", len(body), size)
+	}
+}
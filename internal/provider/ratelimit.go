@@ -0,0 +1,158 @@
+package provider
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultLowHeadroom is the fraction of an upstream rate limit left below
+// which a provider counts as constrained when no threshold is configured.
+const DefaultLowHeadroom = 0.1
+
+// upstreamLimitTTL bounds how long a low reading is trusted when the
+// provider did not say when its limit resets.
+const upstreamLimitTTL = time.Minute
+
+// limitHeaders lists the (limit, remaining, reset) header triples providers
+// report. OpenAI-compatible APIs reset in durations ("6m0s"), Anthropic in
+// RFC 3339 timestamps.
+var limitHeaders = [][3]string{
+	{"X-Ratelimit-Limit-Requests", "X-Ratelimit-Remaining-Requests", "X-Ratelimit-Reset-Requests"},
+	{"X-Ratelimit-Limit-Tokens", "X-Ratelimit-Remaining-Tokens", "X-Ratelimit-Reset-Tokens"},
+	{"Anthropic-Ratelimit-Requests-Limit", "Anthropic-Ratelimit-Requests-Remaining", "Anthropic-Ratelimit-Requests-Reset"},
+	{"Anthropic-Ratelimit-Tokens-Limit", "Anthropic-Ratelimit-Tokens-Remaining", "Anthropic-Ratelimit-Tokens-Reset"},
+	{"Anthropic-Ratelimit-Input-Tokens-Limit", "Anthropic-Ratelimit-Input-Tokens-Remaining", "Anthropic-Ratelimit-Input-Tokens-Reset"},
+	{"Anthropic-Ratelimit-Output-Tokens-Limit", "Anthropic-Ratelimit-Output-Tokens-Remaining", "Anthropic-Ratelimit-Output-Tokens-Reset"},
+}
+
+// UpstreamLimits tracks the rate-limit budget providers report in response
+// headers, so routing can steer traffic away from a provider before it
+// starts answering 429. A provider is constrained while its scarcest
+// reported limit is below the headroom threshold and has not reset, or
+// while a Retry-After from a 429 or 503 is pending. Safe for concurrent use.
+type UpstreamLimits struct {
+	threshold float64
+
+	mu    sync.Mutex
+	state map[string]upstreamLimit
+}
+
+type upstreamLimit struct {
+	headroom float64   // remaining/limit of the scarcest reported limit
+	until    time.Time // when that reading stops applying
+	retryAt  time.Time // zero = no pending Retry-After
+}
+
+// NewUpstreamLimits returns an empty tracker. lowHeadroom <= 0 uses
+// DefaultLowHeadroom.
+func NewUpstreamLimits(lowHeadroom float64) *UpstreamLimits {
+	if lowHeadroom <= 0 {
+		lowHeadroom = DefaultLowHeadroom
+	}
+	return &UpstreamLimits{threshold: lowHeadroom, state: make(map[string]upstreamLimit)}
+}
+
+// Observe records the rate-limit headers of one response from providerName.
+// A success clears any pending Retry-After.
+func (l *UpstreamLimits) Observe(providerName string, resp *http.Response) {
+	now := time.Now()
+	headroom, until, ok := parseHeadroom(resp.Header, now)
+	var retryAt time.Time
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		retryAt, _ = parseRetryAfter(resp.Header.Get("Retry-After"), now)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st := l.state[providerName]
+	if ok {
+		st.headroom, st.until = headroom, until
+	}
+	switch {
+	case !retryAt.IsZero():
+		st.retryAt = retryAt
+	case resp.StatusCode < 400:
+		st.retryAt = time.Time{}
+	}
+	l.state[providerName] = st
+}
+
+// Constrained reports whether providerName is near or past its upstream
+// rate limit.
+func (l *UpstreamLimits) Constrained(providerName string) bool {
+	l.mu.Lock()
+	st, ok := l.state[providerName]
+	l.mu.Unlock()
+	if !ok {
+		return false
+	}
+	now := time.Now()
+	return now.Before(st.retryAt) || (st.headroom < l.threshold && now.Before(st.until))
+}
+
+// parseHeadroom returns the remaining fraction of the scarcest limit in h
+// and when it resets. ok is false when h reports no limits.
+func parseHeadroom(h http.Header, now time.Time) (headroom float64, until time.Time, ok bool) {
+	for _, names := range limitHeaders {
+		limit, err1 := strconv.ParseFloat(h.Get(names[0]), 64)
+		remaining, err2 := strconv.ParseFloat(h.Get(names[1]), 64)
+		if err1 != nil || err2 != nil || limit <= 0 {
+			continue
+		}
+		frac := max(remaining, 0) / limit
+		if ok && frac >= headroom {
+			continue
+		}
+		headroom, ok = frac, true
+		if until, err1 = parseReset(h.Get(names[2]), now); err1 != nil {
+			until = now.Add(upstreamLimitTTL)
+		}
+	}
+	return headroom, until, ok
+}
+
+// parseReset reads a reset header: a duration ("1s", "6m0s"), seconds, or
+// an RFC 3339 timestamp.
+func parseReset(v string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(d), nil
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		return now.Add(time.Duration(secs * float64(time.Second))), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// parseRetryAfter reads Retry-After as delay seconds or an HTTP date.
+func parseRetryAfter(v string, now time.Time) (time.Time, bool) {
+	if v == "" {
+		return time.Time{}, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return now.Add(time.Duration(secs) * time.Second), true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// UpstreamLimitTransport records the rate-limit headers of every response
+// from Provider in Limits. Place it outside any key-rotating transport so
+// it sees the response that is finally returned.
+type UpstreamLimitTransport struct {
+	Base     http.RoundTripper
+	Provider string
+	Limits   *UpstreamLimits
+}
+
+// RoundTrip forwards the request and observes the response headers.
+func (t *UpstreamLimitTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := t.Base.RoundTrip(r)
+	if err == nil {
+		t.Limits.Observe(t.Provider, resp)
+	}
+	return resp, err
+}
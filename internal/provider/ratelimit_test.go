@@ -0,0 +1,101 @@
+package provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func limitResponse(status int, headers map[string]string) *http.Response {
+	resp := &http.Response{StatusCode: status, Header: http.Header{}, Body: http.NoBody}
+	for k, v := range headers {
+		resp.Header.Set(k, v)
+	}
+	return resp
+}
+
+func TestUpstreamLimits(t *testing.T) {
+	t.Parallel()
+	reset := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name    string
+		status  int
+		headers map[string]string
+		want    bool
+	}{
+		{"no headers", http.StatusOK, nil, false},
+		{"openai plenty left", http.StatusOK, map[string]string{
+			"x-ratelimit-limit-requests": "500", "x-ratelimit-remaining-requests": "499", "x-ratelimit-reset-requests": "120ms",
+			"x-ratelimit-limit-tokens": "30000", "x-ratelimit-remaining-tokens": "25000", "x-ratelimit-reset-tokens": "10s",
+		}, false},
+		{"openai tokens nearly spent", http.StatusOK, map[string]string{
+			"x-ratelimit-limit-requests": "500", "x-ratelimit-remaining-requests": "499", "x-ratelimit-reset-requests": "120ms",
+			"x-ratelimit-limit-tokens": "30000", "x-ratelimit-remaining-tokens": "1200", "x-ratelimit-reset-tokens": "6m0s",
+		}, true},
+		{"openai low but already reset", http.StatusOK, map[string]string{
+			"x-ratelimit-limit-requests": "500", "x-ratelimit-remaining-requests": "1", "x-ratelimit-reset-requests": "0s",
+		}, false},
+		{"anthropic nearly spent", http.StatusOK, map[string]string{
+			"anthropic-ratelimit-requests-limit": "50", "anthropic-ratelimit-requests-remaining": "2", "anthropic-ratelimit-requests-reset": reset,
+		}, true},
+		{"low without reset", http.StatusOK, map[string]string{
+			"x-ratelimit-limit-requests": "100", "x-ratelimit-remaining-requests": "0",
+		}, true},
+		{"retry-after on 429", http.StatusTooManyRequests, map[string]string{"Retry-After": "30"}, true},
+		{"retry-after on 200 ignored", http.StatusOK, map[string]string{"Retry-After": "30"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			l := NewUpstreamLimits(0)
+			l.Observe("p", limitResponse(tt.status, tt.headers))
+			if got := l.Constrained("p"); got != tt.want {
+				t.Errorf("Constrained = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpstreamLimits_RecoversAfterSuccess(t *testing.T) {
+	t.Parallel()
+	l := NewUpstreamLimits(0.2)
+	l.Observe("p", limitResponse(http.StatusTooManyRequests, map[string]string{"Retry-After": "60"}))
+	if !l.Constrained("p") || l.Constrained("other") {
+		t.Fatal("429 with Retry-After should constrain only that provider")
+	}
+	l.Observe("p", limitResponse(http.StatusOK, map[string]string{
+		"x-ratelimit-limit-requests": "100", "x-ratelimit-remaining-requests": "50",
+	}))
+	if l.Constrained("p") {
+		t.Error("a successful response with headroom should lift the constraint")
+	}
+	l.Observe("p", limitResponse(http.StatusOK, map[string]string{
+		"x-ratelimit-limit-requests": "100", "x-ratelimit-remaining-requests": "15",
+	}))
+	if !l.Constrained("p") {
+		t.Error("15% left is below the configured 20% headroom")
+	}
+}
+
+func TestUpstreamLimitTransport(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("x-ratelimit-limit-tokens", "1000")
+		w.Header().Set("x-ratelimit-remaining-tokens", "10")
+		w.Header().Set("x-ratelimit-reset-tokens", "1m")
+	}))
+	defer srv.Close()
+
+	l := NewUpstreamLimits(0)
+	client := &http.Client{Transport: &UpstreamLimitTransport{Base: http.DefaultTransport, Provider: "openai", Limits: l}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !l.Constrained("openai") {
+		t.Error("transport did not record the provider's low token budget")
+	}
+}
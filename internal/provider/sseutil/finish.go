@@ -0,0 +1,63 @@
+package sseutil
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultFinishGrace is how long a stream may stay quiet after a chunk with
+// a terminal finish reason before the reader ends it itself. It leaves room
+// for the trailing usage chunk and [DONE] sentinel well-behaved upstreams send.
+const DefaultFinishGrace = 2 * time.Second
+
+// FinishWatch ends streams whose upstream finishes a response but never
+// sends [DONE] or closes the connection. After the first event carrying a
+// terminal finish reason, body is closed once no further event arrives
+// within the grace period, which unblocks the reader; Fired then tells it
+// to end the stream normally rather than report a read error.
+type FinishWatch struct {
+	body  io.Closer
+	grace time.Duration
+	timer *time.Timer
+	fired atomic.Bool
+}
+
+// NewFinishWatch returns a watch over body. A zero grace uses
+// DefaultFinishGrace; a negative grace disables the watch, so the stream
+// only ends on [DONE] or EOF.
+func NewFinishWatch(body io.Closer, grace time.Duration) *FinishWatch {
+	if grace == 0 {
+		grace = DefaultFinishGrace
+	}
+	return &FinishWatch{body: body, grace: grace}
+}
+
+// Event records an upstream event. The timer starts at the first terminal
+// event and restarts on every event after it.
+func (w *FinishWatch) Event(terminal bool) {
+	if w.grace < 0 {
+		return
+	}
+	switch {
+	case w.timer != nil:
+		w.timer.Reset(w.grace)
+	case terminal:
+		w.timer = time.AfterFunc(w.grace, func() {
+			w.fired.Store(true)
+			w.body.Close()
+		})
+	}
+}
+
+// Fired reports whether the watch closed the body.
+func (w *FinishWatch) Fired() bool {
+	return w.fired.Load()
+}
+
+// Stop releases the timer. Call it once the reader is done.
+func (w *FinishWatch) Stop() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
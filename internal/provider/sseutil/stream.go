@@ -5,20 +5,28 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/tidwall/gjson"
 
 	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/provider"
 )
 
 // ReadSSEStream reads SSE lines from resp and sends them as StreamChunks on ch.
 // It handles the standard SSE "[DONE]" sentinel and extracts usage from the
 // final chunk. Used by openai and ollama adapters that share this SSE format.
-// The channel is closed when done.
-func ReadSSEStream(ctx context.Context, providerName string, resp *http.Response, ch chan<- gateway.StreamChunk) {
+// Finish reasons are normalized to the OpenAI set (see
+// provider.NormalizeFinishReason). Upstreams that go quiet for finishGrace
+// after a chunk with a finish_reason are treated as done (see
+// NewFinishWatch). The channel is closed when done.
+func ReadSSEStream(ctx context.Context, providerName string, resp *http.Response, ch chan<- gateway.StreamChunk, finishGrace time.Duration) {
 	defer close(ch)
 	defer resp.Body.Close()
 
+	watch := NewFinishWatch(resp.Body, finishGrace)
+	defer watch.Stop()
+
 	scanner := NewScanner(resp.Body)
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -32,6 +40,9 @@ func ReadSSEStream(ctx context.Context, providerName string, resp *http.Response
 		}
 
 		chunk := gateway.StreamChunk{Data: []byte(data)}
+		var finished bool
+		chunk.Data, finished = normalizeFinishReasons(chunk.Data)
+		watch.Event(finished)
 		// Extract usage from final chunk if present.
 		if u := gjson.GetBytes(chunk.Data, "usage"); u.Exists() && u.Type == gjson.JSON {
 			var usage gateway.Usage
@@ -47,7 +58,35 @@ func ReadSSEStream(ctx context.Context, providerName string, resp *http.Response
 			return
 		}
 	}
+	if watch.Fired() {
+		ch <- gateway.StreamChunk{Done: true}
+		return
+	}
 	if err := scanner.Err(); err != nil {
 		ch <- gateway.StreamChunk{Err: fmt.Errorf("%s: read stream: %w", providerName, err)}
 	}
 }
+
+// normalizeFinishReasons rewrites non-OpenAI finish reasons in an
+// OpenAI-format chunk in place and reports whether any choice carries a
+// finish_reason. Chunks without one are returned untouched.
+func normalizeFinishReasons(data []byte) ([]byte, bool) {
+	res := gjson.GetBytes(data, "choices.#.finish_reason")
+	reasons := res.Array()
+	finished := false
+	// Replace from the last choice back so earlier offsets stay valid.
+	for i := len(reasons) - 1; i >= 0; i-- {
+		r := reasons[i]
+		if r.String() == "" {
+			continue
+		}
+		finished = true
+		norm := provider.NormalizeFinishReason(r.String())
+		if norm == r.String() || i >= len(res.Indexes) || res.Indexes[i] == 0 {
+			continue
+		}
+		start, end := res.Indexes[i], res.Indexes[i]+len(r.Raw)
+		data = append(data[:start:start], append([]byte(`"`+norm+`"`), data[end:]...)...)
+	}
+	return data, finished
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	gateway "github.com/eugener/gandalf/internal"
 )
@@ -19,7 +21,7 @@ func TestReadSSEStream(t *testing.T) {
 
 	resp := &http.Response{Body: io.NopCloser(strings.NewReader(body))}
 	ch := make(chan gateway.StreamChunk, 8)
-	go ReadSSEStream(context.Background(), "test", resp, ch)
+	go ReadSSEStream(context.Background(), "test", resp, ch, 0)
 
 	var chunks []gateway.StreamChunk
 	for c := range ch {
@@ -37,6 +39,33 @@ func TestReadSSEStream(t *testing.T) {
 	}
 }
 
+func TestReadSSEStreamNormalizesFinishReason(t *testing.T) {
+	t.Parallel()
+
+	body := "data: {\"id\":\"1\",\"choices\":[{\"delta\":{\"content\":\"hi\"},\"finish_reason\":null}]}\n\n" +
+		"data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"eos\"},{\"index\":1,\"delta\":{},\"finish_reason\":\"function_call\"}]}\n\n" +
+		"data: [DONE]\n\n"
+
+	resp := &http.Response{Body: io.NopCloser(strings.NewReader(body))}
+	ch := make(chan gateway.StreamChunk, 8)
+	go ReadSSEStream(context.Background(), "test", resp, ch, 0)
+
+	var chunks []gateway.StreamChunk
+	for c := range ch {
+		chunks = append(chunks, c)
+	}
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3", len(chunks))
+	}
+	if got := string(chunks[0].Data); !strings.Contains(got, `"finish_reason":null`) {
+		t.Errorf("unfinished chunk should be untouched, got %s", got)
+	}
+	want := `{"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"stop"},{"index":1,"delta":{},"finish_reason":"tool_calls"}]}`
+	if got := string(chunks[1].Data); got != want {
+		t.Errorf("finish chunk = %s, want %s", got, want)
+	}
+}
+
 func TestReadSSEStreamUsage(t *testing.T) {
 	t.Parallel()
 
@@ -45,7 +74,7 @@ func TestReadSSEStreamUsage(t *testing.T) {
 
 	resp := &http.Response{Body: io.NopCloser(strings.NewReader(body))}
 	ch := make(chan gateway.StreamChunk, 8)
-	go ReadSSEStream(context.Background(), "test", resp, ch)
+	go ReadSSEStream(context.Background(), "test", resp, ch, 0)
 
 	var chunks []gateway.StreamChunk
 	for c := range ch {
@@ -72,7 +101,7 @@ func TestReadSSEStreamContextCancel(t *testing.T) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	ch := make(chan gateway.StreamChunk, 8)
-	go ReadSSEStream(ctx, "test", resp, ch)
+	go ReadSSEStream(ctx, "test", resp, ch, 0)
 
 	// Write one chunk.
 	pw.Write([]byte("data: {\"id\":\"1\",\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\n"))
@@ -99,7 +128,7 @@ func TestReadSSEStreamScannerError(t *testing.T) {
 	// errReader always returns an error.
 	resp := &http.Response{Body: io.NopCloser(&errReader{})}
 	ch := make(chan gateway.StreamChunk, 8)
-	go ReadSSEStream(context.Background(), "test", resp, ch)
+	go ReadSSEStream(context.Background(), "test", resp, ch, 0)
 
 	var gotErr bool
 	for c := range ch {
@@ -112,6 +141,90 @@ func TestReadSSEStreamScannerError(t *testing.T) {
 	}
 }
 
+// holdOpenServer writes body, flushes, and then keeps the connection open
+// until the client goes away or the test ends.
+func holdOpenServer(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, body)
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(func() {
+		close(release)
+		srv.Close()
+	})
+	return srv
+}
+
+func TestReadSSEStreamFinishGrace(t *testing.T) {
+	t.Parallel()
+
+	body := "data: {\"id\":\"1\",\"choices\":[{\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n" +
+		`data: {"id":"1","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}` + "\n\n"
+	srv := holdOpenServer(t, body)
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan gateway.StreamChunk, 8)
+	go ReadSSEStream(context.Background(), "test", resp, ch, 50*time.Millisecond)
+
+	var chunks []gateway.StreamChunk
+	timeout := time.After(2 * time.Second)
+	for done := false; !done; {
+		select {
+		case c, ok := <-ch:
+			if !ok {
+				done = true
+				break
+			}
+			if c.Err != nil {
+				t.Fatalf("unexpected error: %v", c.Err)
+			}
+			chunks = append(chunks, c)
+		case <-timeout:
+			t.Fatal("stream not terminated after finish_reason")
+		}
+	}
+
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3", len(chunks))
+	}
+	if chunks[1].Usage == nil {
+		t.Error("trailing usage chunk should be kept")
+	}
+	if !chunks[2].Done {
+		t.Error("last chunk should be Done")
+	}
+}
+
+func TestReadSSEStreamFinishGraceDisabled(t *testing.T) {
+	t.Parallel()
+
+	srv := holdOpenServer(t, "data: {\"id\":\"1\",\"choices\":[{\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n")
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan gateway.StreamChunk, 8)
+	go ReadSSEStream(context.Background(), "test", resp, ch, -1)
+
+	<-ch // finish chunk
+	select {
+	case c := <-ch:
+		t.Fatalf("stream ended early with %+v", c)
+	case <-time.After(100 * time.Millisecond):
+	}
+	resp.Body.Close()
+}
+
 type errReader struct{}
 
 func (e *errReader) Read([]byte) (int, error) {
@@ -0,0 +1,60 @@
+package provider
+
+import (
+	"encoding/json"
+	"strings"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+// systemSeparator joins the text of merged system messages.
+const systemSeparator = "\n\n"
+
+// ContentText returns the text of an OpenAI message content: a JSON string,
+// or the concatenated text parts of a multimodal content array. Anything
+// else is returned raw.
+func ContentText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	// Try as quoted string first.
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	// Try as array of content parts (OpenAI multimodal format).
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(raw, &parts) == nil {
+		var b strings.Builder
+		for _, p := range parts {
+			if p.Type == "text" {
+				b.WriteString(p.Text)
+			}
+		}
+		return b.String()
+	}
+	return string(raw)
+}
+
+// SystemText returns the text of every system-role message in msgs, in
+// order and wherever it appears, joined by blank lines, along with the
+// number of system messages found. Adapters whose API carries the system
+// prompt outside the message list use it to build that field.
+func SystemText(msgs []gateway.Message) (string, int) {
+	var b strings.Builder
+	n := 0
+	for _, m := range msgs {
+		if m.Role != "system" {
+			continue
+		}
+		if n > 0 {
+			b.WriteString(systemSeparator)
+		}
+		b.WriteString(ContentText(m.Content))
+		n++
+	}
+	return b.String(), n
+}
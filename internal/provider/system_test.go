@@ -0,0 +1,23 @@
+package provider
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestContentText(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		in, want string
+	}{
+		{`"plain"`, "plain"},
+		{`[{"type":"text","text":"hello"},{"type":"image_url"},{"type":"text","text":" world"}]`, "hello world"},
+		{`42`, "42"}, // non-string, non-array falls back to raw
+		{``, ""},
+	}
+	for _, tt := range tests {
+		if got := ContentText(json.RawMessage(tt.in)); got != tt.want {
+			t.Errorf("ContentText(%s) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
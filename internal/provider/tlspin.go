@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrCertificatePin is returned when no certificate presented by a provider
+// matches its configured pins.
+var ErrCertificatePin = errors.New("provider certificate does not match any pinned key")
+
+// PinCertificates restricts t to servers presenting a certificate whose
+// public key matches one of pins. Each pin is the base64 SHA-256 of the
+// certificate's SubjectPublicKeyInfo, optionally prefixed with "sha256/"
+// (the HPKP / curl --pinnedpubkey form). Pinning a key rather than the whole
+// certificate survives renewals that keep the key. Normal chain verification
+// still applies, and pins are checked against the verified chain only; a
+// pin on an intermediate or root matches too.
+func PinCertificates(t *http.Transport, pins []string) error {
+	if len(pins) == 0 {
+		return nil
+	}
+	want := make(map[[sha256.Size]byte]bool, len(pins))
+	for _, pin := range pins {
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, "sha256/"))
+		if err != nil || len(raw) != sha256.Size {
+			return fmt.Errorf("invalid pin %q: want base64 SHA-256 of the SPKI", pin)
+		}
+		want[[sha256.Size]byte(raw)] = true
+	}
+
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	// Only certificates in a verified chain count: the peer may send extra,
+	// unrelated certificates, and a pinned one among them proves nothing.
+	t.TLSClientConfig.VerifyPeerCertificate = func(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+		for _, chain := range verifiedChains {
+			for _, cert := range chain {
+				if want[sha256.Sum256(cert.RawSubjectPublicKeyInfo)] {
+					return nil
+				}
+			}
+		}
+		return ErrCertificatePin
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package provider
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPinCertificates(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	sum := sha256.Sum256(srv.Certificate().RawSubjectPublicKeyInfo)
+	matching := "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+	other := sha256.Sum256([]byte("some other key"))
+	nonMatching := base64.StdEncoding.EncodeToString(other[:])
+
+	get := func(pins ...string) error {
+		tr := NewTransport(nil, false)
+		// Trust the test server's self-signed cert so only the pin decides.
+		tr.TLSClientConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+		if err := PinCertificates(tr, pins); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := get(nonMatching, matching); err != nil {
+		t.Errorf("matching pin: %v, want success", err)
+	}
+	if err := get(nonMatching); !errors.Is(err, ErrCertificatePin) {
+		t.Errorf("non-matching pin: err = %v, want ErrCertificatePin", err)
+	}
+
+	if err := PinCertificates(NewTransport(nil, false), []string{"not-base64!"}); err == nil {
+		t.Error("invalid pin should fail")
+	}
+}
+
+// TestPinCertificates_UnchainedCertIgnored verifies that a pinned
+// certificate the server appends to its chain, but which the chain does
+// not verify through, does not satisfy the pin.
+func TestPinCertificates_UnchainedCertIgnored(t *testing.T) {
+	t.Parallel()
+
+	ca, caKey := newTestCert(t, "test ca", nil, nil)
+	leaf, leafKey := newTestCert(t, "127.0.0.1", ca, caKey)
+	pinned, _ := newTestCert(t, "pinned", nil, nil)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{{
+		Certificate: [][]byte{leaf.Raw, pinned.Raw},
+		PrivateKey:  leafKey,
+	}}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	pin := func(c *x509.Certificate) string {
+		sum := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+		return base64.StdEncoding.EncodeToString(sum[:])
+	}
+	get := func(p string) error {
+		roots := x509.NewCertPool()
+		roots.AddCert(ca)
+		tr := NewTransport(nil, false)
+		tr.TLSClientConfig = &tls.Config{RootCAs: roots}
+		if err := PinCertificates(tr, []string{p}); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := get(pin(pinned)); !errors.Is(err, ErrCertificatePin) {
+		t.Errorf("pin on unchained cert: err = %v, want ErrCertificatePin", err)
+	}
+	if err := get(pin(ca)); err != nil {
+		t.Errorf("pin on chain root: %v, want success", err)
+	}
+}
+
+// newTestCert creates a certificate for name, signed by parent (self-signed
+// CA when parent is nil).
+func newTestCert(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	} else {
+		tmpl.IPAddresses = []net.IP{net.ParseIP(name)}
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
@@ -0,0 +1,351 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Transform is a compiled list of rewrite rules for a provider's JSON
+// request or response bodies and headers. Rules run in order, one per line:
+//
+//	set <path> = <json>          set a field, creating parent objects
+//	default <path> = <json>      set a field only when it is absent
+//	rename <path> -> <path>      move a field; no-op when absent
+//	delete <path>                remove a field; no-op when absent
+//	header set <name> = <json string>
+//	header delete <name>
+//
+// Paths are dot-separated object keys; a numeric segment indexes an array,
+// e.g. messages.0.content. The language is deliberately constrained: no
+// conditions, loops, or access to anything but the body and headers.
+type Transform struct {
+	rules []transformRule
+}
+
+type transformRule struct {
+	op    string   // set, default, rename, delete, header set, header delete
+	path  []string // body path, or [header name] for header ops
+	to    []string // rename target
+	value any      // set/default value; header value string
+}
+
+// ParseTransform compiles rules. It fails on an unknown operation, an
+// empty path, or a value that is not valid JSON.
+func ParseTransform(rules []string) (*Transform, error) {
+	t := &Transform{}
+	for i, line := range rules {
+		rule, err := parseTransformRule(strings.TrimSpace(line))
+		if err != nil {
+			return nil, fmt.Errorf("transform rule %d %q: %w", i+1, line, err)
+		}
+		t.rules = append(t.rules, rule)
+	}
+	return t, nil
+}
+
+func parseTransformRule(line string) (transformRule, error) {
+	op, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+	switch op {
+	case "set", "default":
+		path, raw, ok := strings.Cut(rest, "=")
+		if !ok {
+			return transformRule{}, errors.New(`want "<path> = <json>"`)
+		}
+		value, err := parseTransformValue(raw)
+		if err != nil {
+			return transformRule{}, err
+		}
+		p, err := parseTransformPath(path)
+		return transformRule{op: op, path: p, value: value}, err
+	case "rename":
+		from, to, ok := strings.Cut(rest, "->")
+		if !ok {
+			return transformRule{}, errors.New(`want "<path> -> <path>"`)
+		}
+		fp, err := parseTransformPath(from)
+		if err != nil {
+			return transformRule{}, err
+		}
+		tp, err := parseTransformPath(to)
+		return transformRule{op: op, path: fp, to: tp}, err
+	case "delete":
+		p, err := parseTransformPath(rest)
+		return transformRule{op: op, path: p}, err
+	case "header":
+		sub, arg, _ := strings.Cut(rest, " ")
+		switch sub {
+		case "set":
+			name, raw, ok := strings.Cut(arg, "=")
+			name = strings.TrimSpace(name)
+			if !ok || name == "" {
+				return transformRule{}, errors.New(`want "header set <name> = <json string>"`)
+			}
+			value, err := parseTransformValue(raw)
+			if err != nil {
+				return transformRule{}, err
+			}
+			s, ok := value.(string)
+			if !ok {
+				return transformRule{}, errors.New("header value must be a JSON string")
+			}
+			return transformRule{op: "header set", path: []string{name}, value: s}, nil
+		case "delete":
+			name := strings.TrimSpace(arg)
+			if name == "" {
+				return transformRule{}, errors.New("missing header name")
+			}
+			return transformRule{op: "header delete", path: []string{name}}, nil
+		}
+		return transformRule{}, fmt.Errorf("unknown header operation %q (want set or delete)", sub)
+	}
+	return transformRule{}, fmt.Errorf("unknown operation %q (want set, default, rename, delete, or header)", op)
+}
+
+func parseTransformPath(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, errors.New("empty path")
+	}
+	path := strings.Split(s, ".")
+	for _, seg := range path {
+		if seg == "" {
+			return nil, fmt.Errorf("invalid path %q", s)
+		}
+	}
+	return path, nil
+}
+
+func parseTransformValue(raw string) (any, error) {
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid JSON value: %w", err)
+	}
+	if dec.More() {
+		return nil, errors.New("invalid JSON value: trailing data")
+	}
+	return v, nil
+}
+
+// hasBodyRules reports whether any rule touches the body, so header-only
+// transforms skip decoding it.
+func (t *Transform) hasBodyRules() bool {
+	for _, r := range t.rules {
+		if !strings.HasPrefix(r.op, "header ") {
+			return true
+		}
+	}
+	return false
+}
+
+// applyHeaders runs the header rules on h.
+func (t *Transform) applyHeaders(h http.Header) {
+	for _, r := range t.rules {
+		switch r.op {
+		case "header set":
+			h.Set(r.path[0], r.value.(string))
+		case "header delete":
+			h.Del(r.path[0])
+		}
+	}
+}
+
+// applyBody runs the body rules on a JSON object and returns the new
+// encoding. Numbers keep their original text.
+func (t *Transform) applyBody(body []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("body is not a JSON object: %w", err)
+	}
+	var root any = doc
+	for _, r := range t.rules {
+		var err error
+		switch r.op {
+		case "set":
+			err = setPath(root, r.path, r.value, true)
+		case "default":
+			err = setPath(root, r.path, r.value, false)
+		case "rename":
+			v, ok := deletePath(root, r.path)
+			if ok {
+				err = setPath(root, r.to, v, true)
+			}
+		case "delete":
+			deletePath(root, r.path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", r.op, strings.Join(r.path, "."), err)
+		}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(root); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// setPath stores v at path, creating missing parent objects. With
+// overwrite false an existing value is kept.
+func setPath(node any, path []string, v any, overwrite bool) error {
+	for i, seg := range path {
+		last := i == len(path)-1
+		switch n := node.(type) {
+		case map[string]any:
+			if last {
+				if _, exists := n[seg]; exists && !overwrite {
+					return nil
+				}
+				n[seg] = v
+				return nil
+			}
+			next, ok := n[seg]
+			if !ok || next == nil {
+				next = map[string]any{}
+				n[seg] = next
+			}
+			node = next
+		case []any:
+			idx, err := strconv.Atoi(seg)
+			if err != nil || idx < 0 || idx >= len(n) {
+				return fmt.Errorf("no array element %q", seg)
+			}
+			if last {
+				if overwrite {
+					n[idx] = v
+				}
+				return nil
+			}
+			node = n[idx]
+		default:
+			return fmt.Errorf("%q is not an object or array", strings.Join(path[:i], "."))
+		}
+	}
+	return nil
+}
+
+// deletePath removes the value at path and returns it. Missing paths and
+// array elements (which cannot be removed without shifting) report false.
+func deletePath(node any, path []string) (any, bool) {
+	for i, seg := range path {
+		switch n := node.(type) {
+		case map[string]any:
+			v, ok := n[seg]
+			if !ok {
+				return nil, false
+			}
+			if i == len(path)-1 {
+				delete(n, seg)
+				return v, true
+			}
+			node = v
+		case []any:
+			idx, err := strconv.Atoi(seg)
+			if err != nil || idx < 0 || idx >= len(n) || i == len(path)-1 {
+				return nil, false
+			}
+			node = n[idx]
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// TransformTransport applies Transform rules to a provider's outgoing JSON
+// requests and successful non-streaming JSON responses. Wrap it outside any
+// signing transport so signatures cover the rewritten body. A rule that
+// cannot be applied (a body that is not a JSON object, a path through a
+// scalar) fails closed: the original body passes through unchanged and a
+// warning is logged.
+type TransformTransport struct {
+	Base     http.RoundTripper
+	Provider string     // for logs
+	Request  *Transform // nil = requests pass through
+	Response *Transform // nil = responses pass through
+}
+
+// RoundTrip rewrites the request, forwards it, and rewrites the response.
+func (t *TransformTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if t.Request != nil {
+		var err error
+		if r, err = t.transformRequest(r); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := t.Base.RoundTrip(r)
+	if err != nil || t.Response == nil {
+		return resp, err
+	}
+	return t.transformResponse(r, resp)
+}
+
+func (t *TransformTransport) transformRequest(r *http.Request) (*http.Request, error) {
+	out := r.Clone(r.Context())
+	t.Request.applyHeaders(out.Header)
+	if r.Body == nil || r.Body == http.NoBody || !t.Request.hasBodyRules() || !isJSON(r.Header) {
+		return out, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if rewritten, err := t.Request.applyBody(body); err != nil {
+		t.logFailure(r, "request", err)
+	} else {
+		body = rewritten
+	}
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	out.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	out.ContentLength = int64(len(body))
+	out.Header.Del("Content-Length")
+	return out, nil
+}
+
+func (t *TransformTransport) transformResponse(r *http.Request, resp *http.Response) (*http.Response, error) {
+	t.Response.applyHeaders(resp.Header)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || !t.Response.hasBodyRules() || !isJSON(resp.Header) {
+		return resp, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if rewritten, err := t.Response.applyBody(body); err != nil {
+		t.logFailure(r, "response", err)
+	} else {
+		body = rewritten
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+func (t *TransformTransport) logFailure(r *http.Request, direction string, err error) {
+	slog.LogAttrs(r.Context(), slog.LevelWarn, "provider transform failed, passing through",
+		slog.String("provider", t.Provider),
+		slog.String("direction", direction),
+		slog.String("error", err.Error()),
+	)
+}
+
+// isJSON reports whether h declares a JSON body. SSE and NDJSON streams do
+// not match.
+func isJSON(h http.Header) bool {
+	return strings.HasPrefix(h.Get("Content-Type"), "application/json")
+}
@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func mustTransform(t *testing.T, rules ...string) *Transform {
+	t.Helper()
+	tr, err := ParseTransform(rules)
+	if err != nil {
+		t.Fatalf("ParseTransform: %v", err)
+	}
+	return tr
+}
+
+func TestTransformTransport_RenamesField(t *testing.T) {
+	t.Parallel()
+
+	var gotBody, gotHeader string
+	var gotLength int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotBody, gotHeader, gotLength = string(b), r.Header.Get("X-Tenant"), r.ContentLength
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"x","usage":{"input_tokens":3}}`))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &TransformTransport{
+		Base:     http.DefaultTransport,
+		Provider: "custom",
+		Request: mustTransform(t,
+			"rename max_tokens -> max_completion_tokens",
+			"default temperature = 1",
+			"delete user",
+			`header set X-Tenant = "acme"`,
+		),
+		Response: mustTransform(t, "rename usage.input_tokens -> usage.prompt_tokens"),
+	}}
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"model":"m","max_tokens":64,"user":"u-1","note":"<b>"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if want := `{"max_completion_tokens":64,"model":"m","note":"<b>","temperature":1}`; gotBody != want {
+		t.Errorf("upstream body = %s, want %s", gotBody, want)
+	}
+	if gotLength != int64(len(gotBody)) {
+		t.Errorf("Content-Length = %d, want %d", gotLength, len(gotBody))
+	}
+	if gotHeader != "acme" {
+		t.Errorf("X-Tenant = %q, want acme", gotHeader)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	if want := `{"id":"x","usage":{"prompt_tokens":3}}`; string(b) != want {
+		t.Errorf("response = %s, want %s", b, want)
+	}
+}
+
+func TestTransformTransport_FailsClosed(t *testing.T) {
+	t.Parallel()
+
+	var gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"a\":1}\n\n"))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &TransformTransport{
+		Base:     http.DefaultTransport,
+		Request:  mustTransform(t, "set model.name = \"x\""), // model is a string
+		Response: mustTransform(t, "delete a"),
+	}}
+	const body = `{"model":"m"}`
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if gotBody != body {
+		t.Errorf("upstream body = %s, want the original %s", gotBody, body)
+	}
+	if b, _ := io.ReadAll(resp.Body); string(b) != "data: {\"a\":1}\n\n" {
+		t.Errorf("stream = %q, want it untouched", b)
+	}
+}
+
+func TestTransform_Apply(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		rules []string
+		in    string
+		want  string
+	}{
+		{"set nested creates parents", []string{`set metadata.source = "gw"`}, `{}`, `{"metadata":{"source":"gw"}}`},
+		{"default keeps existing", []string{"default top_p = 0.5"}, `{"top_p":0.9}`, `{"top_p":0.9}`},
+		{"array index", []string{`set messages.0.role = "developer"`}, `{"messages":[{"role":"system"}]}`, `{"messages":[{"role":"developer"}]}`},
+		{"rename absent is no-op", []string{"rename a -> b"}, `{"c":1}`, `{"c":1}`},
+		{"large numbers keep precision", []string{"delete x"}, `{"seed":12345678901234567890,"x":1}`, `{"seed":12345678901234567890}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mustTransform(t, tt.rules...).applyBody([]byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTransform_Invalid(t *testing.T) {
+	t.Parallel()
+	for _, rule := range []string{
+		"upsert a = 1",
+		"set a",
+		"set a = {",
+		"set a..b = 1",
+		"rename a b",
+		"delete",
+		"header set X-A = 1",
+		"header add X-A = \"v\"",
+	} {
+		if _, err := ParseTransform([]string{rule}); err == nil {
+			t.Errorf("ParseTransform(%q): expected error", rule)
+		}
+	}
+}
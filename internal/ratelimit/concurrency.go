@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"container/heap"
+	"context"
+	"strings"
+	"sync"
+)
+
+// Priority orders requests waiting for a concurrency slot. Higher values
+// are served first; equal priorities are served in arrival order.
+type Priority int
+
+// Priority classes.
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+)
+
+// ParsePriority maps "low", "normal", or "high" (case-insensitive) to a
+// Priority. Empty means normal.
+func ParsePriority(s string) (Priority, bool) {
+	switch strings.ToLower(s) {
+	case "low":
+		return PriorityLow, true
+	case "", "normal":
+		return PriorityNormal, true
+	case "high":
+		return PriorityHigh, true
+	}
+	return PriorityNormal, false
+}
+
+// ConcurrencyLimiter caps the number of in-flight requests. When all slots
+// are taken, callers queue and are admitted highest priority first.
+type ConcurrencyLimiter struct {
+	mu      sync.Mutex
+	slots   int
+	inUse   int
+	seq     uint64
+	waiters waitQueue
+}
+
+// NewConcurrencyLimiter creates a limiter with the given number of slots.
+func NewConcurrencyLimiter(slots int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{slots: max(slots, 1)}
+}
+
+// Acquire blocks until a slot is available or ctx is done. A nil error
+// means the caller holds a slot and must call Release.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, p Priority) error {
+	l.mu.Lock()
+	if l.inUse < l.slots && len(l.waiters) == 0 {
+		l.inUse++
+		l.mu.Unlock()
+		return nil
+	}
+	w := &waiter{priority: p, seq: l.seq, ready: make(chan struct{})}
+	l.seq++
+	heap.Push(&l.waiters, w)
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		if w.index >= 0 {
+			heap.Remove(&l.waiters, w.index)
+			l.mu.Unlock()
+			return ctx.Err()
+		}
+		l.mu.Unlock()
+		// Granted a slot while giving up; pass it on.
+		l.Release()
+		return ctx.Err()
+	}
+}
+
+// Release returns a slot, handing it directly to the highest-priority waiter.
+func (l *ConcurrencyLimiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.waiters) > 0 {
+		w := heap.Pop(&l.waiters).(*waiter)
+		close(w.ready)
+		return
+	}
+	if l.inUse > 0 {
+		l.inUse--
+	}
+}
+
+// Waiting returns the number of queued callers.
+func (l *ConcurrencyLimiter) Waiting() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.waiters)
+}
+
+type waiter struct {
+	priority Priority
+	seq      uint64
+	ready    chan struct{}
+	index    int // heap index; -1 once granted or removed
+}
+
+// waitQueue is a max-heap on priority, then min-heap on arrival sequence.
+type waitQueue []*waiter
+
+func (q waitQueue) Len() int { return len(q) }
+
+func (q waitQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q waitQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *waitQueue) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *waitQueue) Pop() any {
+	old := *q
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	w.index = -1
+	*q = old[:n-1]
+	return w
+}
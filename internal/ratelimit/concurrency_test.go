@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitQueued blocks until l has n queued callers.
+func waitQueued(t *testing.T, l *ConcurrencyLimiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for l.Waiting() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("waiting = %d, want %d", l.Waiting(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConcurrencyLimiter_HighPriorityJumpsQueue(t *testing.T) {
+	t.Parallel()
+	l := NewConcurrencyLimiter(1)
+	ctx := context.Background()
+	if err := l.Acquire(ctx, PriorityNormal); err != nil {
+		t.Fatal(err)
+	}
+
+	order := make(chan string, 3)
+	enqueue := func(name string, p Priority) {
+		go func() {
+			if err := l.Acquire(ctx, p); err != nil {
+				t.Errorf("%s: %v", name, err)
+				return
+			}
+			order <- name
+			l.Release()
+		}()
+	}
+	enqueue("low-1", PriorityLow)
+	waitQueued(t, l, 1)
+	enqueue("low-2", PriorityLow)
+	waitQueued(t, l, 2)
+	enqueue("high", PriorityHigh)
+	waitQueued(t, l, 3)
+
+	l.Release()
+	want := []string{"high", "low-1", "low-2"}
+	for i, w := range want {
+		select {
+		case got := <-order:
+			if got != w {
+				t.Errorf("admit[%d] = %s, want %s", i, got, w)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("admit[%d]: timed out", i)
+		}
+	}
+}
+
+func TestConcurrencyLimiter_CancelWhileQueued(t *testing.T) {
+	t.Parallel()
+	l := NewConcurrencyLimiter(1)
+	if err := l.Acquire(context.Background(), PriorityNormal); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.Acquire(ctx, PriorityHigh); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+	if n := l.Waiting(); n != 0 {
+		t.Errorf("waiting = %d after cancel, want 0", n)
+	}
+
+	// The slot is still usable once released.
+	l.Release()
+	if err := l.Acquire(context.Background(), PriorityLow); err != nil {
+		t.Errorf("acquire after release: %v", err)
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		in   string
+		want Priority
+		ok   bool
+	}{
+		{"", PriorityNormal, true},
+		{"low", PriorityLow, true},
+		{"Normal", PriorityNormal, true},
+		{"HIGH", PriorityHigh, true},
+		{"urgent", PriorityNormal, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParsePriority(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParsePriority(%q) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
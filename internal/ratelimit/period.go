@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+)
+
+// BudgetPeriod is the interval after which USD quota consumption resets.
+// The zero value means budgets are lifetime caps that never reset.
+type BudgetPeriod string
+
+const (
+	PeriodNone    BudgetPeriod = ""
+	PeriodDaily   BudgetPeriod = "daily"
+	PeriodWeekly  BudgetPeriod = "weekly" // weeks start Monday
+	PeriodMonthly BudgetPeriod = "monthly"
+)
+
+// ParseBudgetPeriod validates a configured period name.
+func ParseBudgetPeriod(s string) (BudgetPeriod, error) {
+	switch p := BudgetPeriod(s); p {
+	case PeriodNone, PeriodDaily, PeriodWeekly, PeriodMonthly:
+		return p, nil
+	}
+	return PeriodNone, fmt.Errorf("unknown budget period %q (want daily, weekly, or monthly)", s)
+}
+
+// Start returns the UTC start of the period containing t. For PeriodNone it
+// returns the zero time, i.e. all usage counts.
+func (p BudgetPeriod) Start(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch p {
+	case PeriodDaily:
+		return day
+	case PeriodWeekly:
+		// time.Weekday is Sunday=0; shift so Monday is day 0.
+		return day.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+	case PeriodMonthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Time{}
+	}
+}
+
+// End returns the UTC start of the period after the one containing t, when
+// consumption next resets. For PeriodNone it returns the zero time.
+func (p BudgetPeriod) End(t time.Time) time.Time {
+	start := p.Start(t)
+	switch p {
+	case PeriodDaily:
+		return start.AddDate(0, 0, 1)
+	case PeriodWeekly:
+		return start.AddDate(0, 0, 7)
+	case PeriodMonthly:
+		return start.AddDate(0, 1, 0)
+	default:
+		return time.Time{}
+	}
+}
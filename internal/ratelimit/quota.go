@@ -3,17 +3,22 @@ package ratelimit
 import (
 	"context"
 	"sync"
+	"time"
 )
 
 // QuotaStore provides aggregated usage cost for quota sync.
 type QuotaStore interface {
-	SumUsageCost(ctx context.Context, keyID string) (float64, error)
+	// SumUsageCost totals cost for keyID recorded at or after since
+	// (zero = all time).
+	SumUsageCost(ctx context.Context, keyID string, since time.Time) (float64, error)
 }
 
-// budgetEntry tracks cumulative spend for a single key.
+// budgetEntry tracks spend for a single key within the current budget
+// period. since is the period start (zero = lifetime budget).
 type budgetEntry struct {
 	limit    float64
 	consumed float64
+	since    time.Time
 }
 
 // QuotaTracker enforces cumulative spend budgets per API key.
@@ -68,9 +73,47 @@ func (q *QuotaTracker) Consume(keyID string, costUSD float64) {
 	e.consumed += costUSD
 }
 
-// Sync reloads a key's consumed amount from the store.
+// Consumed returns the key's spend in its current budget period, or 0 if
+// the key isn't tracked.
+func (q *QuotaTracker) Consumed(keyID string) float64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if e, ok := q.budgets[keyID]; ok {
+		return e.consumed
+	}
+	return 0
+}
+
+// PeriodStart returns the start of the key's current budget period, or the
+// zero time if the key has no period or isn't tracked.
+func (q *QuotaTracker) PeriodStart(keyID string) time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if e, ok := q.budgets[keyID]; ok {
+		return e.since
+	}
+	return time.Time{}
+}
+
+// ResetPeriod starts a new budget period for the key: consumption drops to
+// zero and later syncs only count usage from since onward. The limit is kept.
+func (q *QuotaTracker) ResetPeriod(keyID string, since time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.budgets[keyID]
+	if !ok {
+		e = &budgetEntry{}
+		q.budgets[keyID] = e
+	}
+	e.consumed = 0
+	e.since = since
+}
+
+// Sync reloads a key's consumed amount for its current period from the store.
+// A result computed for a period that was reset mid-query is discarded.
 func (q *QuotaTracker) Sync(ctx context.Context, store QuotaStore, keyID string) error {
-	total, err := store.SumUsageCost(ctx, keyID)
+	since := q.PeriodStart(keyID)
+	total, err := store.SumUsageCost(ctx, keyID, since)
 	if err != nil {
 		return err
 	}
@@ -81,6 +124,9 @@ func (q *QuotaTracker) Sync(ctx context.Context, store QuotaStore, keyID string)
 		e = &budgetEntry{}
 		q.budgets[keyID] = e
 	}
+	if !e.since.Equal(since) {
+		return nil
+	}
 	e.consumed = total
 	return nil
 }
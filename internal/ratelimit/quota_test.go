@@ -3,13 +3,14 @@ package ratelimit
 import (
 	"context"
 	"testing"
+	"time"
 )
 
 type fakeQuotaStore struct {
 	costs map[string]float64
 }
 
-func (s *fakeQuotaStore) SumUsageCost(_ context.Context, keyID string) (float64, error) {
+func (s *fakeQuotaStore) SumUsageCost(_ context.Context, keyID string, _ time.Time) (float64, error) {
 	return s.costs[keyID], nil
 }
 
@@ -49,6 +50,12 @@ func TestQuotaTracker_Consume(t *testing.T) {
 	if q.Check("key1", 10.0) {
 		t.Error("key at 11/10 should be over budget")
 	}
+	if got := q.Consumed("key1"); got != 11.0 {
+		t.Errorf("Consumed = %v, want 11", got)
+	}
+	if got := q.Consumed("other"); got != 0 {
+		t.Errorf("Consumed(untracked) = %v, want 0", got)
+	}
 }
 
 func TestQuotaTracker_UnlimitedBudget(t *testing.T) {
@@ -161,3 +168,57 @@ func TestQuotaTracker_PreloadIdempotent(t *testing.T) {
 		t.Error("existing key at 5/10 should be within budget")
 	}
 }
+
+func TestBudgetPeriodStart(t *testing.T) {
+	t.Parallel()
+
+	// Wednesday 2026-10-14 15:30 UTC.
+	at := time.Date(2026, 10, 14, 15, 30, 0, 0, time.UTC)
+	tests := []struct {
+		period  BudgetPeriod
+		want    time.Time
+		wantEnd time.Time
+	}{
+		{PeriodNone, time.Time{}, time.Time{}},
+		{PeriodDaily, time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)},
+		{PeriodWeekly, time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+		{PeriodMonthly, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := tt.period.Start(at); !got.Equal(tt.want) {
+			t.Errorf("%q.Start = %v, want %v", tt.period, got, tt.want)
+		}
+		if got := tt.period.End(at); !got.Equal(tt.wantEnd) {
+			t.Errorf("%q.End = %v, want %v", tt.period, got, tt.wantEnd)
+		}
+	}
+
+	// Sunday belongs to the week that started the previous Monday.
+	sunday := time.Date(2026, 10, 18, 23, 0, 0, 0, time.UTC)
+	if got := PeriodWeekly.Start(sunday); !got.Equal(time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("weekly start for Sunday = %v, want 2026-10-12", got)
+	}
+
+	if _, err := ParseBudgetPeriod("yearly"); err == nil {
+		t.Error("ParseBudgetPeriod(yearly) should fail")
+	}
+}
+
+func TestQuotaTracker_ResetPeriod(t *testing.T) {
+	t.Parallel()
+	q := NewQuotaTracker()
+	q.Preload("k1", 10)
+	q.Consume("k1", 12)
+	if q.Check("k1", 10) {
+		t.Fatal("should be over budget before reset")
+	}
+
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	q.ResetPeriod("k1", start)
+	if !q.Check("k1", 10) {
+		t.Error("should be within budget after reset")
+	}
+	if got := q.PeriodStart("k1"); !got.Equal(start) {
+		t.Errorf("PeriodStart = %v, want %v", got, start)
+	}
+}
@@ -19,6 +19,7 @@ type Result struct {
 	Limit             int64
 	Remaining         int64
 	RetryAfterSeconds float64
+	ResetSeconds      float64 // until the bucket is full again
 }
 
 // Bucket is a token bucket with lazy refill (no background goroutine).
@@ -67,6 +68,11 @@ func (b *Bucket) retryAfter(n float64) float64 {
 	return deficit / b.rate
 }
 
+// resetAfter returns seconds until the bucket is full.
+func (b *Bucket) resetAfter() float64 {
+	return (b.max - b.tokens) / b.rate
+}
+
 // remaining returns current token count.
 func (b *Bucket) remaining() int64 {
 	return int64(b.tokens)
@@ -113,8 +119,9 @@ func (l *Limiter) AllowRPM() Result {
 	if ok {
 		return Result{
 			Allowed:   true,
-			Limit:     l.limits.RPM,
-			Remaining: remaining,
+			Limit:        l.limits.RPM,
+			Remaining:    remaining,
+			ResetSeconds: l.rpm.resetAfter(),
 		}
 	}
 	return Result{
@@ -122,6 +129,7 @@ func (l *Limiter) AllowRPM() Result {
 		Limit:             l.limits.RPM,
 		Remaining:         0,
 		RetryAfterSeconds: l.rpm.retryAfter(1),
+		ResetSeconds:      l.rpm.resetAfter(),
 	}
 }
 
@@ -140,8 +148,9 @@ func (l *Limiter) ConsumeTPM(estimated int64) Result {
 	if ok {
 		return Result{
 			Allowed:   true,
-			Limit:     l.limits.TPM,
-			Remaining: remaining,
+			Limit:        l.limits.TPM,
+			Remaining:    remaining,
+			ResetSeconds: l.tpm.resetAfter(),
 		}
 	}
 	return Result{
@@ -149,6 +158,7 @@ func (l *Limiter) ConsumeTPM(estimated int64) Result {
 		Limit:             l.limits.TPM,
 		Remaining:         0,
 		RetryAfterSeconds: l.tpm.retryAfter(float64(estimated)),
+		ResetSeconds:      l.tpm.resetAfter(),
 	}
 }
 
@@ -172,9 +182,45 @@ func (l *Limiter) RPMResult() Result {
 	l.rpm.refill(time.Now())
 	return Result{
 		Allowed:   true,
-		Limit:     l.limits.RPM,
-		Remaining: l.rpm.remaining(),
+		Limit:        l.limits.RPM,
+		Remaining:    l.rpm.remaining(),
+		ResetSeconds: l.rpm.resetAfter(),
+	}
+}
+
+// Snapshot is a point-in-time view of a key's buckets. A nil result means
+// that dimension is unlimited.
+type Snapshot struct {
+	RPM *Result
+	TPM *Result
+}
+
+// snapshot refills both buckets and reports them without consuming or
+// marking the limiter as used, so introspection never delays eviction.
+func (l *Limiter) snapshot() Snapshot {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	var s Snapshot
+	if l.rpm != nil {
+		l.rpm.refill(now)
+		s.RPM = &Result{
+			Allowed:      l.rpm.tokens >= 1,
+			Limit:        l.limits.RPM,
+			Remaining:    l.rpm.remaining(),
+			ResetSeconds: l.rpm.resetAfter(),
+		}
 	}
+	if l.tpm != nil {
+		l.tpm.refill(now)
+		s.TPM = &Result{
+			Allowed:      l.tpm.tokens >= 1,
+			Limit:        l.limits.TPM,
+			Remaining:    l.tpm.remaining(),
+			ResetSeconds: l.tpm.resetAfter(),
+		}
+	}
+	return s
 }
 
 // Registry manages per-key Limiters.
@@ -211,6 +257,19 @@ func (r *Registry) GetOrCreate(keyID string, limits Limits) *Limiter {
 	return l
 }
 
+// Snapshot returns the current state of keyID's limiter. ok is false when
+// the key has no limiter, i.e. it has not made a request since startup or
+// its limiter was evicted; its buckets are then full.
+func (r *Registry) Snapshot(keyID string) (Snapshot, bool) {
+	r.mu.RLock()
+	l, ok := r.limiters[keyID]
+	r.mu.RUnlock()
+	if !ok {
+		return Snapshot{}, false
+	}
+	return l.snapshot(), true
+}
+
 // EvictStale removes limiters not used since cutoff.
 // Phase 1: RLock to snapshot stale keys. Phase 2: Lock to delete them.
 // This reduces write-lock hold time from O(N) limiter locks to O(stale) deletes.
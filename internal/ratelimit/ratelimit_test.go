@@ -178,6 +178,41 @@ func TestRegistry_EvictStale(t *testing.T) {
 	}
 }
 
+func TestRegistry_Snapshot(t *testing.T) {
+	t.Parallel()
+	r := NewRegistry()
+
+	if _, ok := r.Snapshot("key1"); ok {
+		t.Fatal("unknown key should have no snapshot")
+	}
+
+	l := r.GetOrCreate("key1", Limits{RPM: 10})
+	l.AllowRPM()
+	l.AllowRPM()
+	l.mu.Lock()
+	lastUsed := l.lastUsed
+	l.mu.Unlock()
+
+	s, ok := r.Snapshot("key1")
+	if !ok {
+		t.Fatal("expected snapshot")
+	}
+	if s.RPM == nil || s.RPM.Limit != 10 || s.RPM.Remaining != 8 || s.RPM.ResetSeconds <= 0 {
+		t.Errorf("RPM = %+v, want limit 10, remaining 8, positive reset", s.RPM)
+	}
+	if s.TPM != nil {
+		t.Errorf("TPM = %+v, want nil (unlimited)", s.TPM)
+	}
+	if again, _ := r.Snapshot("key1"); again.RPM.Remaining != 8 {
+		t.Errorf("snapshot consumed tokens: remaining = %d", again.RPM.Remaining)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.lastUsed.Equal(lastUsed) {
+		t.Error("snapshot should not mark the limiter as used")
+	}
+}
+
 func BenchmarkAllowRPM(b *testing.B) {
 	l := newLimiter(Limits{RPM: 1_000_000}) // high limit so it never denies
 	for b.Loop() {
@@ -202,6 +237,30 @@ func TestLimiter_RPMResult(t *testing.T) {
 	}
 }
 
+func TestLimiter_ResetSeconds(t *testing.T) {
+	t.Parallel()
+	l := newLimiter(Limits{RPM: 10, TPM: 600})
+
+	// Refill rates: RPM 10/60 per second, TPM 10 per second.
+	if r := l.AllowRPM(); r.ResetSeconds < 5.9 || r.ResetSeconds > 6 {
+		t.Errorf("RPM reset after 1 of 10 = %v, want ~6s", r.ResetSeconds)
+	}
+	if r := l.ConsumeTPM(300); r.ResetSeconds < 29.9 || r.ResetSeconds > 30 {
+		t.Errorf("TPM reset after 300 of 600 = %v, want ~30s", r.ResetSeconds)
+	}
+	denied := l.ConsumeTPM(1000)
+	if denied.Allowed || denied.ResetSeconds < 29.9 || denied.ResetSeconds > 30 {
+		t.Errorf("denied TPM result = %+v, want reset ~30s", denied)
+	}
+	if r := l.RPMResult(); r.ResetSeconds <= 0 || r.ResetSeconds > 6 {
+		t.Errorf("RPMResult reset = %v, want (0, 6]", r.ResetSeconds)
+	}
+
+	if r := newLimiter(Limits{RPM: 10}).RPMResult(); r.ResetSeconds != 0 {
+		t.Errorf("full bucket reset = %v, want 0", r.ResetSeconds)
+	}
+}
+
 func TestLimiter_RPMResult_Unlimited(t *testing.T) {
 	t.Parallel()
 	l := newLimiter(Limits{RPM: 0, TPM: 0})
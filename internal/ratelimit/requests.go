@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// RequestCountStore provides recorded request counts for seeding
+// RequestQuotaTracker.
+type RequestCountStore interface {
+	// CountRequests counts usage records for keyID created at or after
+	// since (zero = all time).
+	CountRequests(ctx context.Context, keyID string, since time.Time) (int64, error)
+}
+
+// requestCount is a key's request count within one period. since is the
+// period start (zero = lifetime quota).
+type requestCount struct {
+	count int64
+	since time.Time
+}
+
+// RequestQuotaTracker enforces per-key request-count quotas, e.g. 100k
+// requests a month. A request is counted by Record when its usage record is
+// written, so the live count is the number of usage records, the same
+// thing the store counts. Counts start over at each period boundary. The
+// first request a key makes in a period seeds its count from the store, so
+// a restart does not hand out a fresh quota.
+type RequestQuotaTracker struct {
+	store RequestCountStore // nil = counts start at zero
+	now   func() time.Time
+
+	mu     sync.Mutex
+	counts map[string]*requestCount
+}
+
+// NewRequestQuotaTracker creates a RequestQuotaTracker. store may be nil.
+func NewRequestQuotaTracker(store RequestCountStore) *RequestQuotaTracker {
+	return &RequestQuotaTracker{
+		store:  store,
+		now:    time.Now,
+		counts: make(map[string]*requestCount),
+	}
+}
+
+// Check reports whether keyID has made fewer than limit requests in its
+// current period. It does not count the request; Record does.
+func (t *RequestQuotaTracker) Check(ctx context.Context, keyID string, limit int64, period BudgetPeriod) bool {
+	start := period.Start(t.now())
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.current(ctx, keyID, start).count < limit
+}
+
+// Record counts one request for keyID in its current period. Call it where
+// the request's usage record is written.
+func (t *RequestQuotaTracker) Record(ctx context.Context, keyID string, period BudgetPeriod) {
+	start := period.Start(t.now())
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.current(ctx, keyID, start).count++
+}
+
+// Used returns the requests keyID has made in its current period.
+func (t *RequestQuotaTracker) Used(ctx context.Context, keyID string, period BudgetPeriod) int64 {
+	start := period.Start(t.now())
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.current(ctx, keyID, start).count
+}
+
+// current returns keyID's count for the period starting at start, seeding
+// it from the store when the period is new. Called with t.mu held; the
+// lock is released while the store is queried.
+func (t *RequestQuotaTracker) current(ctx context.Context, keyID string, start time.Time) *requestCount {
+	if e, ok := t.counts[keyID]; ok && e.since.Equal(start) {
+		return e
+	}
+	var seeded int64
+	if t.store != nil {
+		t.mu.Unlock()
+		n, err := t.store.CountRequests(ctx, keyID, start)
+		t.mu.Lock()
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "request quota seed failed",
+				slog.String("key_id", keyID),
+				slog.String("error", err.Error()),
+			)
+		}
+		seeded = n
+		// Another request may have seeded the period meanwhile.
+		if e, ok := t.counts[keyID]; ok && e.since.Equal(start) {
+			return e
+		}
+	}
+	e := &requestCount{count: seeded, since: start}
+	t.counts[keyID] = e
+	return e
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeRequestCountStore struct {
+	counts map[string]int64
+	since  []time.Time
+}
+
+func (s *fakeRequestCountStore) CountRequests(_ context.Context, keyID string, since time.Time) (int64, error) {
+	s.since = append(s.since, since)
+	return s.counts[keyID], nil
+}
+
+func TestRequestQuotaTracker_ExhaustAndReset(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tr := NewRequestQuotaTracker(nil)
+	now := time.Date(2025, 3, 31, 23, 0, 0, 0, time.UTC)
+	tr.now = func() time.Time { return now }
+
+	for i := range 3 {
+		if !tr.Check(ctx, "k1", 3, PeriodMonthly) {
+			t.Fatalf("request %d rejected, want allowed", i+1)
+		}
+		tr.Record(ctx, "k1", PeriodMonthly)
+	}
+	if tr.Check(ctx, "k1", 3, PeriodMonthly) {
+		t.Error("fourth request allowed, want quota exhausted")
+	}
+	if got := tr.Used(ctx, "k1", PeriodMonthly); got != 3 {
+		t.Errorf("Used = %d, want 3 (checks are not counted)", got)
+	}
+	if !tr.Check(ctx, "k2", 3, PeriodMonthly) {
+		t.Error("other key should have its own quota")
+	}
+
+	now = now.Add(2 * time.Hour) // April
+	if !tr.Check(ctx, "k1", 3, PeriodMonthly) {
+		t.Error("request in a new period rejected, want allowed")
+	}
+	tr.Record(ctx, "k1", PeriodMonthly)
+	if got := tr.Used(ctx, "k1", PeriodMonthly); got != 1 {
+		t.Errorf("Used after reset = %d, want 1", got)
+	}
+}
+
+func TestRequestQuotaTracker_SeedsFromStore(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store := &fakeRequestCountStore{counts: map[string]int64{"k1": 9}}
+	tr := NewRequestQuotaTracker(store)
+	now := time.Date(2025, 3, 12, 8, 0, 0, 0, time.UTC) // a Wednesday
+	tr.now = func() time.Time { return now }
+
+	if !tr.Check(ctx, "k1", 10, PeriodWeekly) {
+		t.Fatal("10th request rejected, want allowed")
+	}
+	tr.Record(ctx, "k1", PeriodWeekly)
+	if tr.Check(ctx, "k1", 10, PeriodWeekly) {
+		t.Error("11th request allowed, want quota exhausted")
+	}
+	want := []time.Time{time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)}
+	if len(store.since) != 1 || !store.since[0].Equal(want[0]) {
+		t.Errorf("store queried since %v, want once since %v", store.since, want)
+	}
+}
@@ -0,0 +1,50 @@
+package ratelimit
+
+import "sync"
+
+// StreamLimiter caps concurrent streams per API key. Unlike
+// ConcurrencyLimiter it never queues: a stream over the limit is refused
+// at once, since a waiting stream would hold its connection just as long.
+type StreamLimiter struct {
+	mu   sync.Mutex
+	open map[string]int64 // key ID -> open streams
+}
+
+// NewStreamLimiter creates an empty StreamLimiter.
+func NewStreamLimiter() *StreamLimiter {
+	return &StreamLimiter{open: make(map[string]int64)}
+}
+
+// TryAcquire takes a stream slot for keyID if fewer than limit are open and
+// reports whether it did. A limit <= 0 always succeeds without tracking,
+// so Release must only follow a successful acquire with a positive limit.
+func (l *StreamLimiter) TryAcquire(keyID string, limit int64) bool {
+	if limit <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.open[keyID] >= limit {
+		return false
+	}
+	l.open[keyID]++
+	return true
+}
+
+// Release frees a slot taken by TryAcquire.
+func (l *StreamLimiter) Release(keyID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n := l.open[keyID]; n > 1 {
+		l.open[keyID] = n - 1
+	} else {
+		delete(l.open, keyID)
+	}
+}
+
+// Open returns the number of streams open for keyID.
+func (l *StreamLimiter) Open(keyID string) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.open[keyID]
+}
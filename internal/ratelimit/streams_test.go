@@ -0,0 +1,32 @@
+package ratelimit
+
+import "testing"
+
+func TestStreamLimiter(t *testing.T) {
+	t.Parallel()
+	l := NewStreamLimiter()
+
+	for i := range 2 {
+		if !l.TryAcquire("k1", 2) {
+			t.Fatalf("acquire %d refused under the limit", i+1)
+		}
+	}
+	if l.TryAcquire("k1", 2) {
+		t.Fatal("acquire over the limit succeeded")
+	}
+	if !l.TryAcquire("k2", 2) {
+		t.Error("limit leaked across keys")
+	}
+
+	l.Release("k1")
+	if got := l.Open("k1"); got != 1 {
+		t.Errorf("open = %d after release, want 1", got)
+	}
+	if !l.TryAcquire("k1", 2) {
+		t.Error("acquire refused after a release")
+	}
+
+	if !l.TryAcquire("k3", 0) || l.Open("k3") != 0 {
+		t.Error("limit 0 should admit without tracking")
+	}
+}
@@ -0,0 +1,103 @@
+package ratelimit
+
+import "sync"
+
+// BudgetScope identifies what a token budget is attached to.
+type BudgetScope uint8
+
+const (
+	ScopeKey BudgetScope = iota // per API key ID
+	ScopeOrg                    // per org ID
+)
+
+// tokenBudgetKey is a comparable map key, avoiding string concatenation
+// (and its allocation) on every Check/Consume.
+type tokenBudgetKey struct {
+	scope BudgetScope
+	id    string
+	model string // "" = all models
+}
+
+// tokenBudgetEntry tracks cumulative token consumption against a limit.
+type tokenBudgetEntry struct {
+	limit    int64
+	consumed int64
+}
+
+// TokenBudgetTracker enforces cumulative token budgets per key or org,
+// optionally restricted to a single model. Unlike QuotaTracker it counts
+// raw tokens rather than USD, and only explicitly configured budgets are
+// tracked. Consumption is held in memory.
+type TokenBudgetTracker struct {
+	mu      sync.Mutex
+	budgets map[tokenBudgetKey]*tokenBudgetEntry
+}
+
+// NewTokenBudgetTracker creates a new TokenBudgetTracker.
+func NewTokenBudgetTracker() *TokenBudgetTracker {
+	return &TokenBudgetTracker{
+		budgets: make(map[tokenBudgetKey]*tokenBudgetEntry),
+	}
+}
+
+// SetLimit configures a token budget. An empty model applies the budget to
+// all models combined. Existing consumption is preserved. A limit <= 0
+// removes the budget.
+func (t *TokenBudgetTracker) SetLimit(scope BudgetScope, id, model string, limit int64) {
+	k := tokenBudgetKey{scope: scope, id: id, model: model}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if limit <= 0 {
+		delete(t.budgets, k)
+		return
+	}
+	if e, ok := t.budgets[k]; ok {
+		e.limit = limit
+		return
+	}
+	t.budgets[k] = &tokenBudgetEntry{limit: limit}
+}
+
+// Check returns true if every budget applicable to the key, org, and model
+// still has tokens remaining. Returns true when no budgets apply.
+func (t *TokenBudgetTracker) Check(keyID, orgID, model string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.budgets) == 0 {
+		return true
+	}
+	for _, k := range candidateKeys(keyID, orgID, model) {
+		if e, ok := t.budgets[k]; ok && e.consumed >= e.limit {
+			return false
+		}
+	}
+	return true
+}
+
+// Consume adds tokens to every budget applicable to the key, org, and model.
+func (t *TokenBudgetTracker) Consume(keyID, orgID, model string, tokens int64) {
+	if tokens <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.budgets) == 0 {
+		return
+	}
+	for _, k := range candidateKeys(keyID, orgID, model) {
+		if e, ok := t.budgets[k]; ok {
+			e.consumed += tokens
+		}
+	}
+}
+
+// candidateKeys returns the budget keys that can apply to a request.
+// Returned by value so the array stays on the stack.
+func candidateKeys(keyID, orgID, model string) [4]tokenBudgetKey {
+	return [4]tokenBudgetKey{
+		{scope: ScopeKey, id: keyID},
+		{scope: ScopeKey, id: keyID, model: model},
+		{scope: ScopeOrg, id: orgID},
+		{scope: ScopeOrg, id: orgID, model: model},
+	}
+}
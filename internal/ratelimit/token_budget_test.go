@@ -0,0 +1,87 @@
+package ratelimit
+
+import "testing"
+
+func TestTokenBudget_NoBudgets(t *testing.T) {
+	t.Parallel()
+	tb := NewTokenBudgetTracker()
+
+	tb.Consume("key1", "org1", "gpt-4o", 1_000_000)
+	if !tb.Check("key1", "org1", "gpt-4o") {
+		t.Error("no configured budgets should always allow")
+	}
+}
+
+func TestTokenBudget_Exhaustion(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		scope BudgetScope
+		id    string
+		model string
+	}{
+		{"key all models", ScopeKey, "key1", ""},
+		{"key per model", ScopeKey, "key1", "gpt-4o"},
+		{"org all models", ScopeOrg, "org1", ""},
+		{"org per model", ScopeOrg, "org1", "gpt-4o"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tb := NewTokenBudgetTracker()
+			tb.SetLimit(tt.scope, tt.id, tt.model, 100)
+
+			tb.Consume("key1", "org1", "gpt-4o", 60)
+			if !tb.Check("key1", "org1", "gpt-4o") {
+				t.Fatal("60/100 should be within budget")
+			}
+			tb.Consume("key1", "org1", "gpt-4o", 40)
+			if tb.Check("key1", "org1", "gpt-4o") {
+				t.Error("100/100 should be exhausted")
+			}
+		})
+	}
+}
+
+func TestTokenBudget_PerModelIsolation(t *testing.T) {
+	t.Parallel()
+	tb := NewTokenBudgetTracker()
+	tb.SetLimit(ScopeKey, "key1", "gpt-4o", 100)
+
+	// Tokens on another model don't count against the gpt-4o budget.
+	tb.Consume("key1", "org1", "gpt-4o-mini", 500)
+	if !tb.Check("key1", "org1", "gpt-4o") {
+		t.Error("gpt-4o budget should be untouched by gpt-4o-mini usage")
+	}
+	if !tb.Check("key1", "org1", "gpt-4o-mini") {
+		t.Error("gpt-4o-mini has no budget and should be allowed")
+	}
+
+	// Other keys are unaffected.
+	tb.Consume("key1", "org1", "gpt-4o", 100)
+	if tb.Check("key1", "org1", "gpt-4o") {
+		t.Error("key1 gpt-4o should be exhausted")
+	}
+	if !tb.Check("key2", "org1", "gpt-4o") {
+		t.Error("key2 should not share key1's budget")
+	}
+}
+
+func TestTokenBudget_SetLimitPreservesConsumption(t *testing.T) {
+	t.Parallel()
+	tb := NewTokenBudgetTracker()
+	tb.SetLimit(ScopeOrg, "org1", "", 100)
+	tb.Consume("key1", "org1", "gpt-4o", 150)
+
+	tb.SetLimit(ScopeOrg, "org1", "", 200)
+	if !tb.Check("key1", "org1", "gpt-4o") {
+		t.Error("raising the limit to 200 should allow 150 consumed")
+	}
+
+	tb.SetLimit(ScopeOrg, "org1", "", 0)
+	tb.Consume("key1", "org1", "gpt-4o", 1000)
+	if !tb.Check("key1", "org1", "gpt-4o") {
+		t.Error("removed budget should allow")
+	}
+}
@@ -1,10 +1,13 @@
 package server
 
 import (
+	"cmp"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
@@ -13,6 +16,9 @@ import (
 
 	gateway "github.com/eugener/gandalf/internal"
 	"github.com/eugener/gandalf/internal/app"
+	"github.com/eugener/gandalf/internal/jsonschema"
+	"github.com/eugener/gandalf/internal/ratelimit"
+	"github.com/eugener/gandalf/internal/storage"
 )
 
 // maxAdminBody is the maximum allowed admin request body size (1 MB).
@@ -150,6 +156,10 @@ func (s *server) handleCreateProvider(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, errorResponse("name is required"))
 		return
 	}
+	if err := s.checkBaseURL(r.Context(), p.BaseURL); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse(err.Error()))
+		return
+	}
 	if p.ID == "" {
 		p.ID = p.Name
 	}
@@ -157,6 +167,8 @@ func (s *server) handleCreateProvider(w http.ResponseWriter, r *http.Request) {
 		writeAdminError(w, r, err)
 		return
 	}
+	s.invalidateProviderModels()
+	s.audit(r, "create", auditProvider, p.ID, nil, p)
 	w.Header().Set("Location", "/admin/v1/providers/"+p.ID)
 	writeJSON(w, http.StatusCreated, p)
 }
@@ -179,35 +191,141 @@ func (s *server) handleUpdateProvider(w http.ResponseWriter, r *http.Request) {
 	}
 	p.APIKeyEnc = "" // defense-in-depth: strip even though json:"-"
 	p.ID = id
+	if err := s.checkBaseURL(r.Context(), p.BaseURL); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse(err.Error()))
+		return
+	}
+	var before *gateway.ProviderConfig
+	if s.deps.Audit != nil {
+		before, _ = s.deps.Store.GetProvider(r.Context(), id)
+	}
 	if err := s.deps.Store.UpdateProvider(r.Context(), &p); err != nil {
 		writeAdminError(w, r, err)
 		return
 	}
+	s.invalidateProviderModels()
+	s.audit(r, "update", auditProvider, id, before, p)
 	writeJSON(w, http.StatusOK, p)
 }
 
 func (s *server) handleDeleteProvider(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	var before *gateway.ProviderConfig
+	if s.deps.Audit != nil {
+		before, _ = s.deps.Store.GetProvider(r.Context(), id)
+	}
 	if err := s.deps.Store.DeleteProvider(r.Context(), id); err != nil {
 		writeAdminError(w, r, err)
 		return
 	}
+	s.invalidateProviderModels()
+	s.audit(r, "delete", auditProvider, id, before, nil)
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// invalidateProviderModels drops cached provider model lists after a
+// provider is added, changed, or removed, so /v1/models and model
+// diagnostics do not serve a stale list until the TTL runs out.
+func (s *server) invalidateProviderModels() {
+	if s.deps.Providers != nil {
+		s.deps.Providers.InvalidateModels()
+	}
+}
+
+// handleMigrateProvider repoints every route target on provider {id} to the
+// provider named by ?to=, in one transaction. With ?keep_failover=true the
+// old provider stays on each route as a last-resort fallback. Responds with
+// the routes that changed.
+func (s *server) handleMigrateProvider(w http.ResponseWriter, r *http.Request) {
+	from := chi.URLParam(r, "id")
+	to := r.URL.Query().Get("to")
+	if to == "" || to == from {
+		writeJSON(w, http.StatusBadRequest, errorResponse("to must name a different provider"))
+		return
+	}
+	keep := false
+	if v := r.URL.Query().Get("keep_failover"); v != "" {
+		var err error
+		if keep, err = strconv.ParseBool(v); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse("keep_failover must be a boolean"))
+			return
+		}
+	}
+	if _, err := s.deps.Store.GetProvider(r.Context(), to); err != nil {
+		if errors.Is(err, gateway.ErrNotFound) {
+			writeJSON(w, http.StatusBadRequest, errorResponse("unknown provider "+strconv.Quote(to)))
+			return
+		}
+		writeAdminError(w, r, err)
+		return
+	}
+
+	routes, err := s.deps.Store.(storage.RouteMigrator).MigrateProviderRoutes(r.Context(), from, to, keep)
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	slog.LogAttrs(r.Context(), slog.LevelInfo, "provider routes migrated",
+		slog.String("from", from),
+		slog.String("to", to),
+		slog.Bool("keep_failover", keep),
+		slog.Int("routes", len(routes)),
+	)
+	ids := make([]string, len(routes))
+	for i, rt := range routes {
+		ids[i] = rt.ID
+	}
+	s.audit(r, "migrate", auditProvider, from, nil, map[string]any{
+		"to": to, "keep_failover": keep, "routes": ids,
+	})
+	if routes == nil {
+		routes = []*gateway.Route{}
+	}
+	writeJSON(w, http.StatusOK, listResponse{
+		Data:       routes,
+		Pagination: pagination{Offset: 0, Limit: len(routes), Total: len(routes)},
+	})
+}
+
 // --- Keys ---
 
 // keyCreateRequest is the payload for creating a new API key.
 type keyCreateRequest struct {
-	OrgID         string   `json:"org_id"`
-	UserID        string   `json:"user_id,omitempty"`
-	TeamID        string   `json:"team_id,omitempty"`
-	Role          string   `json:"role,omitempty"`
-	AllowedModels []string `json:"allowed_models,omitempty"`
-	RPMLimit      *int64   `json:"rpm_limit,omitempty"`
-	TPMLimit      *int64   `json:"tpm_limit,omitempty"`
-	MaxBudget     *float64 `json:"max_budget,omitempty"`
-	ExpiresAt     *string  `json:"expires_at,omitempty"` // RFC3339
+	OrgID              string   `json:"org_id"`
+	UserID             string   `json:"user_id,omitempty"`
+	TeamID             string   `json:"team_id,omitempty"`
+	Role               string   `json:"role,omitempty"`
+	AllowedModels      []string `json:"allowed_models,omitempty"`
+	RPMLimit           *int64   `json:"rpm_limit,omitempty"`
+	TPMLimit           *int64   `json:"tpm_limit,omitempty"`
+	MaxBudget          *float64 `json:"max_budget,omitempty"`
+	MaxStreams         *int64   `json:"max_streams,omitempty"`         // concurrent streams (0 = server default)
+	DefaultModel       string   `json:"default_model,omitempty"`       // used when a request omits model
+	MaxRequests        *int64   `json:"max_requests,omitempty"`        // requests per request_period (0 = unlimited)
+	RequestPeriod      string   `json:"request_period,omitempty"`      // daily, weekly, monthly ("" = never resets)
+	Pool               string   `json:"pool,omitempty"`                // keys sharing a pool cover each other's RPM
+	ExpiresAt          *string  `json:"expires_at,omitempty"`          // RFC3339
+	PreferredProviders []string `json:"preferred_providers,omitempty"` // tried ahead of route order
+	MaxPriority        string   `json:"max_priority,omitempty"`        // highest X-Gandalf-Priority honored: low, normal, high
+}
+
+// keyUpdateRequest is the partial-update payload for an API key.
+// Omitted fields keep their existing value.
+type keyUpdateRequest struct {
+	Role               *string  `json:"role,omitempty"`
+	AllowedModels      []string `json:"allowed_models,omitempty"`
+	RPMLimit           *int64   `json:"rpm_limit,omitempty"`
+	TPMLimit           *int64   `json:"tpm_limit,omitempty"`
+	MaxBudget          *float64 `json:"max_budget,omitempty"`
+	MaxStreams         *int64   `json:"max_streams,omitempty"`    // concurrent streams (0 = server default)
+	DefaultModel       *string  `json:"default_model,omitempty"`  // "" clears it
+	MaxRequests        *int64   `json:"max_requests,omitempty"`   // requests per request_period (0 = unlimited)
+	RequestPeriod      *string  `json:"request_period,omitempty"` // "" = never resets
+	Pool               *string  `json:"pool,omitempty"`           // "" leaves the pool
+	ExpiresAt          *string  `json:"expires_at,omitempty"`     // RFC3339
+	Blocked            *bool    `json:"blocked,omitempty"`
+	PreferredProviders []string `json:"preferred_providers,omitempty"` // [] clears them
+	MaxPriority        *string  `json:"max_priority,omitempty"`        // "" = normal
 }
 
 // keyCreateResponse includes the plaintext key (shown only once).
@@ -249,6 +367,10 @@ func (s *server) handleCreateKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	identity := gateway.IdentityFromContext(r.Context())
+	if !canGrantRole(identity, req.Role) {
+		writeJSON(w, http.StatusForbidden, errorResponse("cannot grant a role with permissions you lack"))
+		return
+	}
 	if req.OrgID == "" {
 		req.OrgID = identity.OrgID
 	}
@@ -256,6 +378,17 @@ func (s *server) handleCreateKey(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusForbidden, errorResponse("cannot create keys outside your organization"))
 		return
 	}
+	if _, err := ratelimit.ParseBudgetPeriod(req.RequestPeriod); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse("invalid request_period"))
+		return
+	}
+	if !s.validPreferredProviders(w, r, req.PreferredProviders) {
+		return
+	}
+	if _, ok := ratelimit.ParsePriority(req.MaxPriority); !ok {
+		writeJSON(w, http.StatusBadRequest, errorResponse("invalid max_priority"))
+		return
+	}
 
 	expiresAt, ok := parseExpiresAt(w, req.ExpiresAt)
 	if !ok {
@@ -263,21 +396,29 @@ func (s *server) handleCreateKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	plaintext, key, err := s.deps.Keys.CreateKey(r.Context(), app.CreateKeyOpts{
-		OrgID:         req.OrgID,
-		UserID:        req.UserID,
-		TeamID:        req.TeamID,
-		Role:          req.Role,
-		AllowedModels: req.AllowedModels,
-		RPMLimit:      req.RPMLimit,
-		TPMLimit:      req.TPMLimit,
-		MaxBudget:     req.MaxBudget,
-		ExpiresAt:     expiresAt,
+		OrgID:              req.OrgID,
+		UserID:             req.UserID,
+		TeamID:             req.TeamID,
+		Role:               req.Role,
+		AllowedModels:      req.AllowedModels,
+		RPMLimit:           req.RPMLimit,
+		TPMLimit:           req.TPMLimit,
+		MaxBudget:          req.MaxBudget,
+		MaxStreams:         req.MaxStreams,
+		DefaultModel:       req.DefaultModel,
+		MaxRequests:        req.MaxRequests,
+		RequestPeriod:      req.RequestPeriod,
+		Pool:               req.Pool,
+		ExpiresAt:          expiresAt,
+		PreferredProviders: req.PreferredProviders,
+		MaxPriority:        req.MaxPriority,
 	})
 	if err != nil {
 		writeAdminError(w, r, err)
 		return
 	}
 
+	s.audit(r, "create", auditKey, key.ID, nil, key)
 	w.Header().Set("Location", "/admin/v1/keys/"+key.ID)
 	writeJSON(w, http.StatusCreated, keyCreateResponse{
 		APIKey:       key,
@@ -300,6 +441,114 @@ func (s *server) handleGetKey(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, key)
 }
 
+// keyLimitsResponse is the payload for GET /admin/v1/keys/{id}/limits. A nil
+// section means that limit is unlimited or not enforced.
+type keyLimitsResponse struct {
+	KeyID       string        `json:"key_id"`
+	Active      bool          `json:"active"` // key has a live limiter; false = buckets are full
+	RPM         *bucketState  `json:"rpm,omitempty"`
+	TPM         *bucketState  `json:"tpm,omitempty"`
+	Quota       *quotaState   `json:"quota,omitempty"`
+	Requests    *requestState `json:"requests,omitempty"`
+	OpenStreams *int64        `json:"open_streams,omitempty"`
+}
+
+// bucketState is one rate-limit bucket as seen by the limiter right now.
+type bucketState struct {
+	Limit        int64   `json:"limit"`
+	Remaining    int64   `json:"remaining"`
+	ResetSeconds float64 `json:"reset_seconds"` // until the bucket is full again
+}
+
+// quotaState is a key's spend against its budget for the current period.
+type quotaState struct {
+	MaxBudget float64 `json:"max_budget"`
+	Spent     float64 `json:"spent"`
+	Remaining float64 `json:"remaining"`
+}
+
+// requestState is a key's request count against its request-count quota.
+type requestState struct {
+	Limit     int64      `json:"limit"`
+	Used      int64      `json:"used"`
+	Remaining int64      `json:"remaining"`
+	Period    string     `json:"period,omitempty"`
+	ResetsAt  *time.Time `json:"resets_at,omitempty"` // nil = never resets
+}
+
+func (s *server) handleKeyLimits(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	key, err := s.deps.Store.GetKey(r.Context(), id)
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	identity := gateway.IdentityFromContext(r.Context())
+	if key.OrgID != identity.OrgID {
+		writeJSON(w, http.StatusNotFound, errorResponse("not found"))
+		return
+	}
+
+	resp := keyLimitsResponse{KeyID: key.ID}
+	if s.deps.RateLimiter != nil {
+		if snap, ok := s.deps.RateLimiter.Snapshot(key.ID); ok {
+			resp.Active = true
+			resp.RPM = newBucketState(snap.RPM)
+			resp.TPM = newBucketState(snap.TPM)
+		} else {
+			// No limiter yet: report full buckets at the limits the
+			// rate-limit middleware would apply.
+			if limit := keyLimit(key.RPMLimit, s.deps.DefaultRPM); limit > 0 {
+				resp.RPM = &bucketState{Limit: limit, Remaining: limit}
+			}
+			if limit := keyLimit(key.TPMLimit, s.deps.DefaultTPM); limit > 0 {
+				resp.TPM = &bucketState{Limit: limit, Remaining: limit}
+			}
+		}
+	}
+	if s.deps.Quota != nil && key.MaxBudget != nil && *key.MaxBudget > 0 {
+		spent := s.deps.Quota.Consumed(key.ID)
+		resp.Quota = &quotaState{
+			MaxBudget: *key.MaxBudget,
+			Spent:     spent,
+			Remaining: max(0, *key.MaxBudget-spent),
+		}
+	}
+	if s.deps.RequestQuota != nil && key.MaxRequests != nil && *key.MaxRequests > 0 {
+		period := ratelimit.BudgetPeriod(key.RequestPeriod)
+		used := s.deps.RequestQuota.Used(r.Context(), key.ID, period)
+		resp.Requests = &requestState{
+			Limit:     *key.MaxRequests,
+			Used:      used,
+			Remaining: max(0, *key.MaxRequests-used),
+			Period:    key.RequestPeriod,
+		}
+		if end := period.End(time.Now()); !end.IsZero() {
+			resp.Requests.ResetsAt = &end
+		}
+	}
+	if s.deps.Streams != nil {
+		open := s.deps.Streams.Open(key.ID)
+		resp.OpenStreams = &open
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func newBucketState(res *ratelimit.Result) *bucketState {
+	if res == nil {
+		return nil
+	}
+	return &bucketState{Limit: res.Limit, Remaining: res.Remaining, ResetSeconds: res.ResetSeconds}
+}
+
+// keyLimit returns the key's own limit, else the server default.
+func keyLimit(own *int64, def int64) int64 {
+	if own != nil && *own > 0 {
+		return *own
+	}
+	return def
+}
+
 func (s *server) handleUpdateKey(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	existing, err := s.deps.Store.GetKey(r.Context(), id)
@@ -314,18 +563,11 @@ func (s *server) handleUpdateKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Decode update payload on top of existing.
-	var update struct {
-		Role          *string  `json:"role,omitempty"`
-		AllowedModels []string `json:"allowed_models,omitempty"`
-		RPMLimit      *int64   `json:"rpm_limit,omitempty"`
-		TPMLimit      *int64   `json:"tpm_limit,omitempty"`
-		MaxBudget     *float64 `json:"max_budget,omitempty"`
-		ExpiresAt     *string  `json:"expires_at,omitempty"`
-		Blocked       *bool    `json:"blocked,omitempty"`
-	}
+	var update keyUpdateRequest
 	if !decodeJSON(w, r, &update) {
 		return
 	}
+	before := *existing
 
 	// Reject unknown roles early to prevent storing invalid data in DB.
 	if update.Role != nil {
@@ -333,6 +575,10 @@ func (s *server) handleUpdateKey(w http.ResponseWriter, r *http.Request) {
 			writeJSON(w, http.StatusBadRequest, errorResponse("invalid role"))
 			return
 		}
+		if !canGrantRole(identity, *update.Role) {
+			writeJSON(w, http.StatusForbidden, errorResponse("cannot grant a role with permissions you lack"))
+			return
+		}
 		existing.Role = *update.Role
 	}
 	if update.AllowedModels != nil {
@@ -347,6 +593,38 @@ func (s *server) handleUpdateKey(w http.ResponseWriter, r *http.Request) {
 	if update.MaxBudget != nil {
 		existing.MaxBudget = update.MaxBudget
 	}
+	if update.MaxStreams != nil {
+		existing.MaxStreams = update.MaxStreams
+	}
+	if update.DefaultModel != nil {
+		existing.DefaultModel = *update.DefaultModel
+	}
+	if update.MaxRequests != nil {
+		existing.MaxRequests = update.MaxRequests
+	}
+	if update.RequestPeriod != nil {
+		if _, err := ratelimit.ParseBudgetPeriod(*update.RequestPeriod); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse("invalid request_period"))
+			return
+		}
+		existing.RequestPeriod = *update.RequestPeriod
+	}
+	if update.Pool != nil {
+		existing.Pool = *update.Pool
+	}
+	if update.PreferredProviders != nil {
+		if !s.validPreferredProviders(w, r, update.PreferredProviders) {
+			return
+		}
+		existing.PreferredProviders = update.PreferredProviders
+	}
+	if update.MaxPriority != nil {
+		if _, ok := ratelimit.ParsePriority(*update.MaxPriority); !ok {
+			writeJSON(w, http.StatusBadRequest, errorResponse("invalid max_priority"))
+			return
+		}
+		existing.MaxPriority = *update.MaxPriority
+	}
 	if update.ExpiresAt != nil {
 		expiresAt, ok := parseExpiresAt(w, update.ExpiresAt)
 		if !ok {
@@ -362,6 +640,7 @@ func (s *server) handleUpdateKey(w http.ResponseWriter, r *http.Request) {
 		writeAdminError(w, r, err)
 		return
 	}
+	s.audit(r, "update", auditKey, id, before, existing)
 	if s.deps.KeyInvalidator != nil {
 		s.deps.KeyInvalidator.InvalidateByKeyID(id)
 	}
@@ -384,14 +663,343 @@ func (s *server) handleDeleteKey(w http.ResponseWriter, r *http.Request) {
 		writeAdminError(w, r, err)
 		return
 	}
+	s.audit(r, "delete", auditKey, id, key, nil)
 	if s.deps.KeyInvalidator != nil {
 		s.deps.KeyInvalidator.InvalidateByKeyID(id)
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// --- Organizations ---
+
+// orgUpdateRequest is the partial-update payload for an organization.
+// Omitted fields keep their existing value.
+type orgUpdateRequest struct {
+	Name          *string  `json:"name,omitempty"`
+	AllowedModels []string `json:"allowed_models,omitempty"`
+	RPMLimit      *int64   `json:"rpm_limit,omitempty"`
+	TPMLimit      *int64   `json:"tpm_limit,omitempty"`
+	MaxBudget     *float64 `json:"max_budget,omitempty"`
+}
+
+// canGrantRole reports whether identity may assign role to a key: a role
+// can't carry permissions the granter lacks, so an org admin can't mint a
+// superadmin key. An empty role gets the store's default, member.
+func canGrantRole(identity *gateway.Identity, role string) bool {
+	if role == "" {
+		role = "member"
+	}
+	return identity.Can(gateway.RolePermissions[role])
+}
+
+// orgVisible reports whether identity may manage org id: its own org, or
+// any org with manage_all_orgs.
+func orgVisible(identity *gateway.Identity, id string) bool {
+	return id == identity.OrgID || identity.Can(gateway.PermManageAllOrgs)
+}
+
+// handleListOrgs lists every org for manage_all_orgs, else only the
+// caller's own.
+func (s *server) handleListOrgs(w http.ResponseWriter, r *http.Request) {
+	offset, limit := parsePagination(r)
+	identity := gateway.IdentityFromContext(r.Context())
+	if !identity.Can(gateway.PermManageAllOrgs) {
+		org, err := s.deps.Store.GetOrg(r.Context(), identity.OrgID)
+		if err != nil && !errors.Is(err, gateway.ErrNotFound) {
+			writeJSON(w, http.StatusInternalServerError, errorResponse("failed to list organizations"))
+			return
+		}
+		orgs, total := []*gateway.Organization{}, 0
+		if org != nil {
+			total = 1
+			if offset == 0 {
+				orgs = append(orgs, org)
+			}
+		}
+		writeJSON(w, http.StatusOK, listResponse{
+			Data:       orgs,
+			Pagination: pagination{Offset: offset, Limit: limit, Total: total},
+		})
+		return
+	}
+	orgs, err := s.deps.Store.ListOrgs(r.Context(), offset, limit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse("failed to list organizations"))
+		return
+	}
+	total, _ := s.deps.Store.CountOrgs(r.Context())
+	if orgs == nil {
+		orgs = []*gateway.Organization{}
+	}
+	writeJSON(w, http.StatusOK, listResponse{
+		Data:       orgs,
+		Pagination: pagination{Offset: offset, Limit: limit, Total: total},
+	})
+}
+
+// handleCreateOrg creates an organization; it requires manage_all_orgs.
+func (s *server) handleCreateOrg(w http.ResponseWriter, r *http.Request) {
+	if !gateway.IdentityFromContext(r.Context()).Can(gateway.PermManageAllOrgs) {
+		writeJSON(w, http.StatusForbidden, errorResponse("cannot create organizations"))
+		return
+	}
+	var org gateway.Organization
+	if !decodeJSON(w, r, &org) {
+		return
+	}
+	if org.Name == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse("name is required"))
+		return
+	}
+	if org.ID == "" {
+		org.ID = uuid.Must(uuid.NewV7()).String()
+	}
+	org.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	if err := s.deps.Store.CreateOrg(r.Context(), &org); err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	s.audit(r, "create", auditOrg, org.ID, nil, org)
+	w.Header().Set("Location", "/admin/v1/orgs/"+org.ID)
+	writeJSON(w, http.StatusCreated, org)
+}
+
+func (s *server) handleGetOrg(w http.ResponseWriter, r *http.Request) {
+	org, err := s.getOrg(r, chi.URLParam(r, "id"))
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, org)
+}
+
+func (s *server) handleUpdateOrg(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	existing, err := s.getOrg(r, id)
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+
+	var update orgUpdateRequest
+	if !decodeJSON(w, r, &update) {
+		return
+	}
+	before := *existing
+
+	if update.Name != nil {
+		if *update.Name == "" {
+			writeJSON(w, http.StatusBadRequest, errorResponse("name is required"))
+			return
+		}
+		existing.Name = *update.Name
+	}
+	if update.AllowedModels != nil {
+		existing.AllowedModels = update.AllowedModels
+	}
+	if update.RPMLimit != nil {
+		existing.RPMLimit = update.RPMLimit
+	}
+	if update.TPMLimit != nil {
+		existing.TPMLimit = update.TPMLimit
+	}
+	if update.MaxBudget != nil {
+		existing.MaxBudget = update.MaxBudget
+	}
+
+	if err := s.deps.Store.UpdateOrg(r.Context(), existing); err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	s.audit(r, "update", auditOrg, id, before, existing)
+	writeJSON(w, http.StatusOK, existing)
+}
+
+// getOrg loads org id, reporting an org the caller may not manage as not
+// found so IDs in other orgs aren't revealed.
+func (s *server) getOrg(r *http.Request, id string) (*gateway.Organization, error) {
+	if !orgVisible(gateway.IdentityFromContext(r.Context()), id) {
+		return nil, gateway.ErrNotFound
+	}
+	return s.deps.Store.GetOrg(r.Context(), id)
+}
+
+// handleDeleteOrg deletes an organization and, by cascade, its teams. An
+// org that still has API keys is refused with 409: deleting it would
+// silently revoke them.
+func (s *server) handleDeleteOrg(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	org, err := s.getOrg(r, id)
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	keys, err := s.deps.Store.CountKeysPrimary(r.Context(), id)
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	if keys > 0 {
+		writeJSON(w, http.StatusConflict, errorResponse("organization has API keys; delete them first"))
+		return
+	}
+	if err := s.deps.Store.DeleteOrg(r.Context(), id); err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	s.audit(r, "delete", auditOrg, id, org, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// --- Teams ---
+
+// teamUpdateRequest is the partial-update payload for a team.
+// Omitted fields keep their existing value.
+type teamUpdateRequest struct {
+	Name          *string  `json:"name,omitempty"`
+	AllowedModels []string `json:"allowed_models,omitempty"`
+	RPMLimit      *int64   `json:"rpm_limit,omitempty"`
+	TPMLimit      *int64   `json:"tpm_limit,omitempty"`
+	MaxBudget     *float64 `json:"max_budget,omitempty"`
+}
+
+// getOrgTeam loads team id and checks it belongs to the caller's org.
+// Teams in other orgs are reported as not found. Writes the error response
+// and returns nil on failure.
+func (s *server) getOrgTeam(w http.ResponseWriter, r *http.Request, id string) *gateway.Team {
+	team, err := s.deps.Store.GetTeam(r.Context(), id)
+	if err != nil {
+		writeAdminError(w, r, err)
+		return nil
+	}
+	identity := gateway.IdentityFromContext(r.Context())
+	if team.OrgID != identity.OrgID {
+		writeJSON(w, http.StatusNotFound, errorResponse("not found"))
+		return nil
+	}
+	return team
+}
+
+func (s *server) handleListTeams(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := resolveOrgID(w, r)
+	if !ok {
+		return
+	}
+	offset, limit := parsePagination(r)
+
+	teams, err := s.deps.Store.ListTeams(r.Context(), orgID, offset, limit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse("failed to list teams"))
+		return
+	}
+	total, _ := s.deps.Store.CountTeams(r.Context(), orgID)
+	if teams == nil {
+		teams = []*gateway.Team{}
+	}
+	writeJSON(w, http.StatusOK, listResponse{
+		Data:       teams,
+		Pagination: pagination{Offset: offset, Limit: limit, Total: total},
+	})
+}
+
+func (s *server) handleCreateTeam(w http.ResponseWriter, r *http.Request) {
+	var team gateway.Team
+	if !decodeJSON(w, r, &team) {
+		return
+	}
+	if team.Name == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse("name is required"))
+		return
+	}
+	identity := gateway.IdentityFromContext(r.Context())
+	if team.OrgID == "" {
+		team.OrgID = identity.OrgID
+	}
+	if team.OrgID != identity.OrgID {
+		writeJSON(w, http.StatusForbidden, errorResponse("cannot create teams outside your organization"))
+		return
+	}
+	if team.ID == "" {
+		team.ID = uuid.Must(uuid.NewV7()).String()
+	}
+	if err := s.deps.Store.CreateTeam(r.Context(), &team); err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	s.audit(r, "create", auditTeam, team.ID, nil, team)
+	w.Header().Set("Location", "/admin/v1/teams/"+team.ID)
+	writeJSON(w, http.StatusCreated, team)
+}
+
+func (s *server) handleGetTeam(w http.ResponseWriter, r *http.Request) {
+	team := s.getOrgTeam(w, r, chi.URLParam(r, "id"))
+	if team == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, team)
+}
+
+func (s *server) handleUpdateTeam(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	existing := s.getOrgTeam(w, r, id)
+	if existing == nil {
+		return
+	}
+
+	var update teamUpdateRequest
+	if !decodeJSON(w, r, &update) {
+		return
+	}
+	before := *existing
+
+	if update.Name != nil {
+		if *update.Name == "" {
+			writeJSON(w, http.StatusBadRequest, errorResponse("name is required"))
+			return
+		}
+		existing.Name = *update.Name
+	}
+	if update.AllowedModels != nil {
+		existing.AllowedModels = update.AllowedModels
+	}
+	if update.RPMLimit != nil {
+		existing.RPMLimit = update.RPMLimit
+	}
+	if update.TPMLimit != nil {
+		existing.TPMLimit = update.TPMLimit
+	}
+	if update.MaxBudget != nil {
+		existing.MaxBudget = update.MaxBudget
+	}
+
+	if err := s.deps.Store.UpdateTeam(r.Context(), existing); err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	s.audit(r, "update", auditTeam, id, before, existing)
+	writeJSON(w, http.StatusOK, existing)
+}
+
+func (s *server) handleDeleteTeam(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	team := s.getOrgTeam(w, r, id)
+	if team == nil {
+		return
+	}
+	if err := s.deps.Store.DeleteTeam(r.Context(), id); err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	s.audit(r, "delete", auditTeam, id, team, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // --- Routes ---
 
+// DefaultMaxRouteTargets is the route target cap when Deps.MaxRouteTargets
+// is unset.
+const DefaultMaxRouteTargets = 10
+
 func (s *server) handleListRoutes(w http.ResponseWriter, r *http.Request) {
 	routes, err := s.deps.Store.ListRoutes(r.Context())
 	if err != nil {
@@ -423,14 +1031,46 @@ func (s *server) handleCreateRoute(w http.ResponseWriter, r *http.Request) {
 	if route.Strategy == "" {
 		route.Strategy = "priority"
 	}
-	if err := s.deps.Store.CreateRoute(r.Context(), &route); err != nil {
+	if !checkRouteSchema(w, &route) || !s.checkRouteTargets(w, r, &route) {
+		return
+	}
+	err := s.deps.Store.CreateRoute(r.Context(), &route)
+	if errors.Is(err, gateway.ErrConflict) && s.deps.ReplaceDuplicateRoutes {
+		s.replaceRouteByAlias(w, r, &route)
+		return
+	}
+	if err != nil {
 		writeAdminError(w, r, err)
 		return
 	}
+	s.audit(r, "create", auditRoute, route.ID, nil, route)
 	w.Header().Set("Location", "/admin/v1/routes/"+route.ID)
 	writeJSON(w, http.StatusCreated, route)
 }
 
+// replaceRouteByAlias overwrites the existing route with route's alias,
+// keeping the existing ID, and responds 200. When no route has the alias,
+// the conflict was on the requested ID and is reported as 409.
+func (s *server) replaceRouteByAlias(w http.ResponseWriter, r *http.Request, route *gateway.Route) {
+	existing, err := s.deps.Store.GetRouteByAlias(r.Context(), route.ModelAlias)
+	if errors.Is(err, gateway.ErrNotFound) {
+		writeAdminError(w, r, gateway.ErrConflict)
+		return
+	}
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	route.ID = existing.ID
+	if err := s.deps.Store.UpdateRoute(r.Context(), route); err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	s.audit(r, "update", auditRoute, route.ID, existing, route)
+	w.Header().Set("Location", "/admin/v1/routes/"+route.ID)
+	writeJSON(w, http.StatusOK, route)
+}
+
 func (s *server) handleGetRoute(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	route, err := s.deps.Store.GetRoute(r.Context(), id)
@@ -448,22 +1088,180 @@ func (s *server) handleUpdateRoute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	route.ID = id
+	if !checkRouteSchema(w, &route) || !s.checkRouteTargets(w, r, &route) {
+		return
+	}
+	var before *gateway.Route
+	if s.deps.Audit != nil {
+		before, _ = s.deps.Store.GetRoute(r.Context(), id)
+	}
 	if err := s.deps.Store.UpdateRoute(r.Context(), &route); err != nil {
 		writeAdminError(w, r, err)
 		return
 	}
+	s.audit(r, "update", auditRoute, id, before, route)
 	writeJSON(w, http.StatusOK, route)
 }
 
+// checkRouteSchema writes a 400 and returns false when a route's response
+// schema does not compile or its schema policy is unknown.
+func checkRouteSchema(w http.ResponseWriter, route *gateway.Route) bool {
+	if !gateway.IsSchemaPolicy(route.SchemaPolicy) {
+		writeJSON(w, http.StatusBadRequest, errorResponse("schema_policy must be reject, retry, or annotate"))
+		return false
+	}
+	if len(route.ResponseSchema) == 0 || string(route.ResponseSchema) == "null" {
+		return true
+	}
+	if _, err := jsonschema.Compile(route.ResponseSchema); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse("invalid response_schema: "+err.Error()))
+		return false
+	}
+	return true
+}
+
+// checkRouteTargets writes a 400 and returns false when a route lists more
+// than the allowed number of targets, or a target names no known provider,
+// lacks a model, or has a negative priority or weight. A provider is known
+// when it is registered or stored.
+func (s *server) checkRouteTargets(w http.ResponseWriter, r *http.Request, route *gateway.Route) bool {
+	if len(route.Targets) == 0 || string(route.Targets) == "null" {
+		return true
+	}
+	var targets []gateway.RouteTarget
+	if err := json.Unmarshal(route.Targets, &targets); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse("targets must be an array of route targets"))
+		return false
+	}
+	limit := cmp.Or(s.deps.MaxRouteTargets, DefaultMaxRouteTargets)
+	if len(targets) > limit {
+		writeJSON(w, http.StatusBadRequest, errorResponse(fmt.Sprintf("route has %d targets, at most %d allowed", len(targets), limit)))
+		return false
+	}
+	for i, t := range targets {
+		var msg string
+		switch {
+		case t.ProviderID == "":
+			msg = "provider_id is required"
+		case t.Model == "":
+			msg = "model is required"
+		case t.Priority < 0:
+			msg = "priority must not be negative"
+		case t.Weight < 0:
+			msg = "weight must not be negative"
+		case !s.knownProvider(r, t.ProviderID):
+			msg = "unknown provider " + strconv.Quote(t.ProviderID)
+		}
+		if msg != "" {
+			writeJSON(w, http.StatusBadRequest, errorResponse(fmt.Sprintf("targets[%d]: %s", i, msg)))
+			return false
+		}
+	}
+	return true
+}
+
+// validPreferredProviders checks a key's preferred_providers: each must be
+// a known provider, listed once. Writes a 400 and returns false otherwise.
+func (s *server) validPreferredProviders(w http.ResponseWriter, r *http.Request, ids []string) bool {
+	for i, id := range ids {
+		var msg string
+		switch {
+		case slices.Contains(ids[:i], id):
+			msg = "duplicate provider " + strconv.Quote(id)
+		case !s.knownProvider(r, id):
+			msg = "unknown provider " + strconv.Quote(id)
+		}
+		if msg != "" {
+			writeJSON(w, http.StatusBadRequest, errorResponse(fmt.Sprintf("preferred_providers[%d]: %s", i, msg)))
+			return false
+		}
+	}
+	return true
+}
+
+func (s *server) knownProvider(r *http.Request, id string) bool {
+	if s.deps.Providers != nil {
+		if _, err := s.deps.Providers.Get(id); err == nil {
+			return true
+		}
+	}
+	_, err := s.deps.Store.GetProvider(r.Context(), id)
+	return err == nil
+}
+
 func (s *server) handleDeleteRoute(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	var before *gateway.Route
+	if s.deps.Audit != nil {
+		before, _ = s.deps.Store.GetRoute(r.Context(), id)
+	}
 	if err := s.deps.Store.DeleteRoute(r.Context(), id); err != nil {
 		writeAdminError(w, r, err)
 		return
 	}
+	s.audit(r, "delete", auditRoute, id, before, nil)
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// --- Model capabilities ---
+
+// capabilitiesResponse is the payload for GET /admin/v1/models/{model}/capabilities.
+type capabilitiesResponse struct {
+	Model        string               `json:"model"`
+	Provider     string               `json:"provider,omitempty"` // provider that reported capabilities
+	Source       string               `json:"source"`             // "provider", "config", or "provider+config"
+	Capabilities gateway.Capabilities `json:"capabilities"`
+}
+
+func (s *server) handleModelCapabilities(w http.ResponseWriter, r *http.Request) {
+	resp, ok := s.modelCapabilities(r, chi.URLParam(r, "model"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorResponse("no capability information for model"))
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// modelCapabilities resolves model to its route targets and describes the
+// first one, in failover priority order, with capability information:
+// reported by its provider (gateway.CapabilityReporter), overridden by a
+// Deps.Capabilities entry for its upstream model, or both. This matches how
+// the proxy filters targets. A model with no route is looked up in the
+// overrides as an upstream name.
+func (s *server) modelCapabilities(r *http.Request, model string) (capabilitiesResponse, bool) {
+	var targets []app.ResolvedTarget
+	if s.deps.Router != nil {
+		targets, _ = s.deps.Router.ResolveModel(r.Context(), model)
+	}
+	if len(targets) == 0 {
+		targets = []app.ResolvedTarget{{Model: model}}
+	}
+	for _, target := range targets {
+		resp := capabilitiesResponse{Model: model}
+		if s.deps.Providers != nil && target.ProviderID != "" {
+			if p, err := s.deps.Providers.Get(target.ProviderID); err == nil {
+				if cr, ok := p.(gateway.CapabilityReporter); ok {
+					resp.Capabilities = cr.Capabilities(target.Model)
+					resp.Provider = target.ProviderID
+					resp.Source = "provider"
+				}
+			}
+		}
+		if override, ok := s.deps.Capabilities[target.Model]; ok {
+			resp.Capabilities = override.Apply(resp.Capabilities)
+			if resp.Source == "" {
+				resp.Source = "config"
+			} else {
+				resp.Source = "provider+config"
+			}
+		}
+		if resp.Source != "" {
+			return resp, true
+		}
+	}
+	return capabilitiesResponse{}, false
+}
+
 // --- Cache ---
 
 func (s *server) handleCachePurge(w http.ResponseWriter, r *http.Request) {
@@ -538,3 +1336,17 @@ func (s *server) handleUsageSummary(w http.ResponseWriter, r *http.Request) {
 	}
 	writeJSON(w, http.StatusOK, map[string]any{"data": rollups})
 }
+
+// handleUsageAnomalies lists the org's recent spend anomalies, optionally
+// only those of one key.
+func (s *server) handleUsageAnomalies(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := resolveOrgID(w, r)
+	if !ok {
+		return
+	}
+	anomalies := s.deps.Anomalies.Anomalies(orgID)
+	if keyID := r.URL.Query().Get("key_id"); keyID != "" {
+		anomalies = slices.DeleteFunc(anomalies, func(a gateway.UsageAnomaly) bool { return a.KeyID != keyID })
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": anomalies})
+}
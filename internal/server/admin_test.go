@@ -3,15 +3,25 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	gateway "github.com/eugener/gandalf/internal"
 	"github.com/eugener/gandalf/internal/app"
+	"github.com/eugener/gandalf/internal/auth"
+	"github.com/eugener/gandalf/internal/cache"
 	"github.com/eugener/gandalf/internal/provider"
+	"github.com/eugener/gandalf/internal/ratelimit"
+	"github.com/eugener/gandalf/internal/testutil"
 )
 
 // --- Admin-specific auth fakes ---
@@ -29,6 +39,19 @@ func (adminAuth) Authenticate(_ context.Context, _ *http.Request) (*gateway.Iden
 	}, nil
 }
 
+type superAdminAuth struct{}
+
+func (superAdminAuth) Authenticate(_ context.Context, _ *http.Request) (*gateway.Identity, error) {
+	return &gateway.Identity{
+		Subject:    "superadmin",
+		KeyID:      "key-superadmin-1",
+		OrgID:      "default",
+		Role:       "superadmin",
+		Perms:      gateway.RolePermissions["superadmin"],
+		AuthMethod: "apikey",
+	}, nil
+}
+
 type memberAuth struct{}
 
 func (memberAuth) Authenticate(_ context.Context, _ *http.Request) (*gateway.Identity, error) {
@@ -49,8 +72,11 @@ type adminFakeStore struct {
 	providers map[string]*gateway.ProviderConfig
 	keys      map[string]*gateway.APIKey
 	routes    map[string]*gateway.Route
+	orgs      map[string]*gateway.Organization
+	teams     map[string]*gateway.Team
 	usage     []gateway.UsageRecord
 	rollups   []gateway.UsageRollup
+	audit     []gateway.AuditEntry
 }
 
 func newAdminFakeStore() *adminFakeStore {
@@ -58,6 +84,8 @@ func newAdminFakeStore() *adminFakeStore {
 		providers: make(map[string]*gateway.ProviderConfig),
 		keys:      make(map[string]*gateway.APIKey),
 		routes:    make(map[string]*gateway.Route),
+		orgs:      make(map[string]*gateway.Organization),
+		teams:     make(map[string]*gateway.Team),
 	}
 }
 
@@ -160,6 +188,20 @@ func (s *adminFakeStore) CountKeys(_ context.Context, orgID string) (int, error)
 	}
 	return n, nil
 }
+func (s *adminFakeStore) CountKeysPrimary(ctx context.Context, orgID string) (int, error) {
+	return s.CountKeys(ctx, orgID)
+}
+func (s *adminFakeStore) ListPoolKeys(_ context.Context, orgID, pool string) ([]*gateway.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []*gateway.APIKey
+	for _, k := range s.keys {
+		if k.OrgID == orgID && k.Pool == pool {
+			out = append(out, k)
+		}
+	}
+	return out, nil
+}
 func (s *adminFakeStore) UpdateKey(_ context.Context, k *gateway.APIKey) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -183,8 +225,16 @@ func (s *adminFakeStore) ListBudgetedKeyIDs(context.Context) (map[string]float64
 
 func (s *adminFakeStore) CreateRoute(_ context.Context, r *gateway.Route) error {
 	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.routes[r.ID]; ok {
+		return gateway.ErrConflict
+	}
+	for _, existing := range s.routes {
+		if existing.ModelAlias == r.ModelAlias {
+			return gateway.ErrConflict
+		}
+	}
 	s.routes[r.ID] = r
-	s.mu.Unlock()
 	return nil
 }
 func (s *adminFakeStore) GetRoute(_ context.Context, id string) (*gateway.Route, error) {
@@ -238,6 +288,22 @@ func (s *adminFakeStore) DeleteRoute(_ context.Context, id string) error {
 	delete(s.routes, id)
 	return nil
 }
+func (s *adminFakeStore) MigrateProviderRoutes(_ context.Context, from, to string, keepFailover bool) ([]*gateway.Route, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var changed []*gateway.Route
+	for _, r := range s.routes {
+		targets, ok, err := gateway.MigrateTargets(r.Targets, from, to, keepFailover)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			r.Targets = targets
+			changed = append(changed, r)
+		}
+	}
+	return changed, nil
+}
 
 func (s *adminFakeStore) InsertUsage(_ context.Context, records []gateway.UsageRecord) error {
 	s.mu.Lock()
@@ -245,7 +311,7 @@ func (s *adminFakeStore) InsertUsage(_ context.Context, records []gateway.UsageR
 	s.mu.Unlock()
 	return nil
 }
-func (s *adminFakeStore) SumUsageCost(context.Context, string) (float64, error) { return 0, nil }
+func (s *adminFakeStore) SumUsageCost(context.Context, string, time.Time) (float64, error) { return 0, nil }
 func (s *adminFakeStore) QueryUsage(_ context.Context, f gateway.UsageFilter) ([]gateway.UsageRecord, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -264,6 +330,9 @@ func (s *adminFakeStore) QueryUsage(_ context.Context, f gateway.UsageFilter) ([
 	}
 	return out, nil
 }
+func (s *adminFakeStore) QueryUsagePrimary(ctx context.Context, f gateway.UsageFilter) ([]gateway.UsageRecord, error) {
+	return s.QueryUsage(ctx, f)
+}
 func (s *adminFakeStore) CountUsage(_ context.Context, f gateway.UsageFilter) (int, error) {
 	records, _ := s.QueryUsage(context.Background(), f)
 	return len(records), nil
@@ -279,26 +348,172 @@ func (s *adminFakeStore) QueryRollups(context.Context, gateway.RollupFilter) ([]
 	defer s.mu.RUnlock()
 	return s.rollups, nil
 }
+func (s *adminFakeStore) QueryRollupsPrimary(ctx context.Context, f gateway.RollupFilter) ([]gateway.UsageRollup, error) {
+	return s.QueryRollups(ctx, f)
+}
 
-func (s *adminFakeStore) CreateOrg(context.Context, *gateway.Organization) error { return nil }
-func (s *adminFakeStore) GetOrg(context.Context, string) (*gateway.Organization, error) {
-	return nil, gateway.ErrNotFound
+func (s *adminFakeStore) InsertAudit(_ context.Context, e *gateway.AuditEntry) error {
+	s.mu.Lock()
+	s.audit = append(s.audit, *e)
+	s.mu.Unlock()
+	return nil
+}
+func (s *adminFakeStore) QueryAudit(_ context.Context, f gateway.AuditFilter) ([]gateway.AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []gateway.AuditEntry
+	for _, e := range slices.Backward(s.audit) {
+		if (f.TargetType == "" || e.TargetType == f.TargetType) && (f.TargetID == "" || e.TargetID == f.TargetID) &&
+			(f.ActorKeyID == "" || e.ActorKeyID == f.ActorKeyID) && (f.OrgID == "" || e.OrgID == f.OrgID) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+func (s *adminFakeStore) CountAudit(ctx context.Context, f gateway.AuditFilter) (int, error) {
+	entries, err := s.QueryAudit(ctx, f)
+	return len(entries), err
+}
+
+func (s *adminFakeStore) CreateOrg(_ context.Context, o *gateway.Organization) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.orgs[o.ID]; ok {
+		return gateway.ErrConflict
+	}
+	s.orgs[o.ID] = o
+	return nil
+}
+func (s *adminFakeStore) GetOrg(_ context.Context, id string) (*gateway.Organization, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	o, ok := s.orgs[id]
+	if !ok {
+		return nil, gateway.ErrNotFound
+	}
+	cp := *o
+	return &cp, nil
 }
 func (s *adminFakeStore) ListOrgs(context.Context, int, int) ([]*gateway.Organization, error) {
-	return nil, nil
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []*gateway.Organization
+	for _, o := range s.orgs {
+		out = append(out, o)
+	}
+	return out, nil
 }
-func (s *adminFakeStore) UpdateOrg(context.Context, *gateway.Organization) error { return nil }
-func (s *adminFakeStore) DeleteOrg(context.Context, string) error                { return nil }
-func (s *adminFakeStore) CreateTeam(context.Context, *gateway.Team) error        { return nil }
-func (s *adminFakeStore) GetTeam(context.Context, string) (*gateway.Team, error) {
-	return nil, gateway.ErrNotFound
+func (s *adminFakeStore) CountOrgs(context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.orgs), nil
+}
+func (s *adminFakeStore) UpdateOrg(_ context.Context, o *gateway.Organization) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.orgs[o.ID]; !ok {
+		return gateway.ErrNotFound
+	}
+	s.orgs[o.ID] = o
+	return nil
+}
+func (s *adminFakeStore) DeleteOrg(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.orgs[id]; !ok {
+		return gateway.ErrNotFound
+	}
+	delete(s.orgs, id)
+	return nil
+}
+func (s *adminFakeStore) CreateTeam(_ context.Context, t *gateway.Team) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.teams[t.ID]; ok {
+		return gateway.ErrConflict
+	}
+	s.teams[t.ID] = t
+	return nil
+}
+func (s *adminFakeStore) GetTeam(_ context.Context, id string) (*gateway.Team, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.teams[id]
+	if !ok {
+		return nil, gateway.ErrNotFound
+	}
+	cp := *t
+	return &cp, nil
+}
+func (s *adminFakeStore) ListTeams(_ context.Context, orgID string, _, _ int) ([]*gateway.Team, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []*gateway.Team
+	for _, t := range s.teams {
+		if t.OrgID == orgID {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+func (s *adminFakeStore) CountTeams(ctx context.Context, orgID string) (int, error) {
+	teams, err := s.ListTeams(ctx, orgID, 0, 0)
+	return len(teams), err
+}
+func (s *adminFakeStore) UpdateTeam(_ context.Context, t *gateway.Team) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.teams[t.ID]; !ok {
+		return gateway.ErrNotFound
+	}
+	s.teams[t.ID] = t
+	return nil
+}
+func (s *adminFakeStore) DeleteTeam(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.teams[id]; !ok {
+		return gateway.ErrNotFound
+	}
+	delete(s.teams, id)
+	return nil
+}
+func (s *adminFakeStore) Close() error { return nil }
+
+func (s *adminFakeStore) ExportBackup(context.Context) (*gateway.Backup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var b gateway.Backup
+	for _, p := range s.providers {
+		b.Providers = append(b.Providers, p)
+	}
+	for _, r := range s.routes {
+		b.Routes = append(b.Routes, r)
+	}
+	for _, k := range s.keys {
+		b.Keys = append(b.Keys, &gateway.BackupKey{APIKey: *k, KeyHash: k.KeyHash})
+	}
+	return &b, nil
 }
-func (s *adminFakeStore) ListTeams(context.Context, string, int, int) ([]*gateway.Team, error) {
-	return nil, nil
+func (s *adminFakeStore) RestoreBackup(_ context.Context, b *gateway.Backup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.providers)
+	clear(s.routes)
+	clear(s.keys)
+	for _, p := range b.Providers {
+		s.providers[p.ID] = p
+	}
+	for _, r := range b.Routes {
+		s.routes[r.ID] = r
+	}
+	for _, k := range b.Keys {
+		key := k.APIKey
+		key.KeyHash = k.KeyHash
+		s.keys[key.ID] = &key
+	}
+	return nil
 }
-func (s *adminFakeStore) UpdateTeam(context.Context, *gateway.Team) error { return nil }
-func (s *adminFakeStore) DeleteTeam(context.Context, string) error        { return nil }
-func (s *adminFakeStore) Close() error                                    { return nil }
 
 // --- Helpers ---
 
@@ -314,9 +529,67 @@ func newAdminTestHandler(authProvider gateway.Authenticator) (http.Handler, *adm
 		Router:    routerSvc,
 		Keys:      app.NewKeyManager(store),
 		Store:     store,
+		Threads:   testutil.NewFakeStore(),
+		Evals:     testutil.NewFakeStore(),
+		Resolver:  testResolver,
+
+		Cache:     newTestCache(),
+
+		Backup:           store,
+		BackupSigningKey: []byte("backup-secret"),
+		ErrorLog:         app.NewErrorLog(10),
+		LatencyStats:     app.NewLatencyStats(0),
+		Audit:            store,
+		Anomalies:        fakeAnomalies{},
 	}), store
 }
 
+// fakeAnomalies serves a fixed set of anomalies across two orgs.
+type fakeAnomalies struct{}
+
+func (fakeAnomalies) Anomalies(orgID string) []gateway.UsageAnomaly {
+	all := []gateway.UsageAnomaly{
+		{OrgID: "default", Bucket: "2026-03-10T13:00:00Z", CostUSD: 10.1, MeanUSD: 2, ZScore: 40},
+		{OrgID: "default", KeyID: "key-a", Bucket: "2026-03-10T13:00:00Z", CostUSD: 9, MeanUSD: 1, ZScore: 80},
+		{OrgID: "other", KeyID: "key-x", Bucket: "2026-03-10T13:00:00Z", CostUSD: 50, MeanUSD: 1, ZScore: 500},
+	}
+	out := []gateway.UsageAnomaly{}
+	for _, a := range all {
+		if a.OrgID == orgID {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// fakeResolver resolves hostnames from a fixed table, keeping base URL
+// validation tests off the network.
+type fakeResolver map[string][]netip.Addr
+
+func (f fakeResolver) LookupNetIP(_ context.Context, _, host string) ([]netip.Addr, error) {
+	if addrs, ok := f[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+var testResolver = fakeResolver{
+	"api.openai.com":   {netip.MustParseAddr("162.159.140.245")},
+	"example.com":      {netip.MustParseAddr("93.184.215.14")},
+	"internal.corp":    {netip.MustParseAddr("10.1.2.3")},
+	"dual.example.com": {netip.MustParseAddr("93.184.215.14"), netip.MustParseAddr("::1")},
+	"ollama.lan":       {netip.MustParseAddr("192.168.1.20")},
+}
+
+// newTestCache returns a small in-memory response cache.
+func newTestCache() Cache {
+	mc, err := cache.NewMemory(100, time.Minute)
+	if err != nil {
+		panic(err)
+	}
+	return mc
+}
+
 // --- Tests ---
 
 func TestAdminProviderCRUD(t *testing.T) {
@@ -391,7 +664,7 @@ func TestAdminKeyCRUD(t *testing.T) {
 	h, _ := newAdminTestHandler(adminAuth{})
 
 	// Create
-	body := `{"org_id":"default","role":"member"}`
+	body := `{"org_id":"default","role":"member","default_model":"gpt-4o"}`
 	req := httptest.NewRequest(http.MethodPost, "/admin/v1/keys", strings.NewReader(body))
 	req.Header.Set("Authorization", "Bearer gnd_admin")
 	rec := httptest.NewRecorder()
@@ -401,10 +674,14 @@ func TestAdminKeyCRUD(t *testing.T) {
 	}
 
 	var created struct {
-		ID  string `json:"id"`
-		Key string `json:"key"`
+		ID           string `json:"id"`
+		Key          string `json:"key"`
+		DefaultModel string `json:"default_model"`
 	}
 	json.NewDecoder(rec.Body).Decode(&created)
+	if created.DefaultModel != "gpt-4o" {
+		t.Errorf("default_model = %q, want gpt-4o", created.DefaultModel)
+	}
 	if created.Key == "" {
 		t.Error("plaintext key should be returned on create")
 	}
@@ -421,8 +698,8 @@ func TestAdminKeyCRUD(t *testing.T) {
 		t.Fatalf("get: status = %d; body = %s", rec.Code, rec.Body.String())
 	}
 
-	// Update - block the key
-	body = `{"blocked":true}`
+	// Update - block the key and clear its default model
+	body = `{"blocked":true,"default_model":""}`
 	req = httptest.NewRequest(http.MethodPut, "/admin/v1/keys/"+created.ID, strings.NewReader(body))
 	req.Header.Set("Authorization", "Bearer gnd_admin")
 	rec = httptest.NewRecorder()
@@ -433,6 +710,9 @@ func TestAdminKeyCRUD(t *testing.T) {
 	if !strings.Contains(rec.Body.String(), `"blocked":true`) {
 		t.Error("key should be blocked after update")
 	}
+	if strings.Contains(rec.Body.String(), "default_model") {
+		t.Error("default_model should be cleared after update")
+	}
 
 	// List
 	req = httptest.NewRequest(http.MethodGet, "/admin/v1/keys?org_id=default", nil)
@@ -530,6 +810,16 @@ func TestAdminRBACEnforcement_MemberDenied(t *testing.T) {
 		{http.MethodPost, "/admin/v1/cache/purge"},
 		{http.MethodGet, "/admin/v1/usage"},
 		{http.MethodGet, "/admin/v1/usage/summary"},
+		{http.MethodGet, "/admin/v1/errors/recent"},
+		{http.MethodPost, "/admin/v1/providers/openai/migrate?to=azure"},
+		{http.MethodGet, "/admin/v1/providers/latency"},
+		{http.MethodGet, "/admin/v1/audit"},
+		{http.MethodGet, "/admin/v1/orgs"},
+		{http.MethodPost, "/admin/v1/orgs"},
+		{http.MethodDelete, "/admin/v1/orgs/acme"},
+		{http.MethodGet, "/admin/v1/teams"},
+		{http.MethodPost, "/admin/v1/teams"},
+		{http.MethodDelete, "/admin/v1/teams/team-1"},
 	}
 
 	for _, ep := range endpoints {
@@ -552,6 +842,47 @@ func TestAdminRBACEnforcement_MemberDenied(t *testing.T) {
 	}
 }
 
+func TestAdminProviderChangesInvalidateModels(t *testing.T) {
+	t.Parallel()
+	store := newAdminFakeStore()
+	reg := provider.NewRegistry()
+	var calls atomic.Int32
+	reg.Register("openai", &testutil.FakeProvider{
+		ProviderName: "openai",
+		ModelsFn: func(context.Context) ([]string, error) {
+			calls.Add(1)
+			return []string{"gpt-4o"}, nil
+		},
+	})
+	reg.SetModelsTTL("openai", time.Hour)
+	h := New(Deps{Auth: adminAuth{}, Providers: reg, Store: store, Resolver: testResolver})
+
+	list := func() {
+		t.Helper()
+		if _, err := reg.ListModels(context.Background(), "openai"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list()
+	list()
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("upstream calls = %d, want 1 while cached", n)
+	}
+	for i, req := range []struct{ method, path, body string }{
+		{http.MethodPost, "/admin/v1/providers", `{"name":"azure","base_url":"https://example.com/v1"}`},
+		{http.MethodPut, "/admin/v1/providers/azure", `{"name":"azure","base_url":"https://api.openai.com/v1"}`},
+		{http.MethodDelete, "/admin/v1/providers/azure", ""},
+	} {
+		if rec := adminRequest(h, req.method, req.path, req.body); rec.Code >= 300 {
+			t.Fatalf("%s %s: status = %d; body = %s", req.method, req.path, rec.Code, rec.Body.String())
+		}
+		list()
+		if n := calls.Load(); n != int32(i+2) {
+			t.Errorf("after %s: upstream calls = %d, want %d", req.method, n, i+2)
+		}
+	}
+}
+
 func TestAdminProviderNotFound(t *testing.T) {
 	t.Parallel()
 	h, _ := newAdminTestHandler(adminAuth{})
@@ -627,6 +958,126 @@ func TestAdminRouteUpdate(t *testing.T) {
 	}
 }
 
+func TestAdminRouteDuplicateAlias(t *testing.T) {
+	t.Parallel()
+	existing := func(store *adminFakeStore) {
+		store.routes["route-1"] = &gateway.Route{
+			ID: "route-1", ModelAlias: "gpt-4o",
+			Targets:  []byte(`[{"provider_id":"fake","model":"gpt-4o","priority":1}]`),
+			Strategy: "priority",
+		}
+		store.providers["other"] = &gateway.ProviderConfig{ID: "other", Name: "other"}
+	}
+	body := `{"model_alias":"gpt-4o","targets":[{"provider_id":"other","model":"gpt-4o","priority":1}]}`
+
+	t.Run("rejected by default", func(t *testing.T) {
+		t.Parallel()
+		h, store := newAdminTestHandler(adminAuth{})
+		existing(store)
+		rec := adminRequest(h, http.MethodPost, "/admin/v1/routes", body)
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("status = %d, want 409; body = %s", rec.Code, rec.Body.String())
+		}
+		if len(store.routes) != 1 || strings.Contains(string(store.routes["route-1"].Targets), "other") {
+			t.Errorf("existing route must be unchanged, got %+v", store.routes)
+		}
+	})
+
+	t.Run("replaced when configured", func(t *testing.T) {
+		t.Parallel()
+		store := newAdminFakeStore()
+		existing(store)
+		reg := provider.NewRegistry()
+		routerSvc := app.NewRouterService(store)
+		h := New(Deps{
+			Auth:                   adminAuth{},
+			Proxy:                  app.NewProxyService(reg, routerSvc, nil, nil),
+			Providers:              reg,
+			Router:                 routerSvc,
+			Store:                  store,
+			ReplaceDuplicateRoutes: true,
+		})
+		rec := adminRequest(h, http.MethodPost, "/admin/v1/routes", body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+		}
+		if loc := rec.Header().Get("Location"); loc != "/admin/v1/routes/route-1" {
+			t.Errorf("Location = %q, want the existing route", loc)
+		}
+		if len(store.routes) != 1 || !strings.Contains(string(store.routes["route-1"].Targets), "other") {
+			t.Errorf("route-1 should be replaced, got %+v", store.routes)
+		}
+
+		// A conflict on the ID rather than the alias is not a replacement.
+		idBody := `{"id":"route-1","model_alias":"new-alias","targets":[{"provider_id":"other","model":"gpt-4o","priority":1}]}`
+		rec = adminRequest(h, http.MethodPost, "/admin/v1/routes", idBody)
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("id conflict: status = %d, want 409; body = %s", rec.Code, rec.Body.String())
+		}
+		if len(store.routes) != 1 || store.routes["route-1"].ModelAlias != "gpt-4o" {
+			t.Errorf("id conflict: route-1 must be unchanged, got %+v", store.routes)
+		}
+	})
+}
+
+func TestAdminRouteTargetValidation(t *testing.T) {
+	t.Parallel()
+	target := `{"provider_id":"fake","model":"gpt-4o","priority":1}`
+	tests := []struct {
+		name    string
+		targets string
+		want    int
+		wantErr string
+	}{
+		{"at limit", "[" + strings.Repeat(target+",", DefaultMaxRouteTargets-1) + target + "]", http.StatusCreated, ""},
+		{"over limit", "[" + strings.Repeat(target+",", DefaultMaxRouteTargets) + target + "]", http.StatusBadRequest, "at most 10 allowed"},
+		{"unknown provider", `[` + target + `,{"provider_id":"nope","model":"m"}]`, http.StatusBadRequest, `targets[1]: unknown provider \"nope\"`},
+		{"stored provider", `[{"provider_id":"stored","model":"m"}]`, http.StatusCreated, ""},
+		{"missing model", `[{"provider_id":"fake"}]`, http.StatusBadRequest, "model is required"},
+		{"negative weight", `[{"provider_id":"fake","model":"m","weight":-1}]`, http.StatusBadRequest, "weight must not be negative"},
+		{"not an array", `{"provider_id":"fake"}`, http.StatusBadRequest, "targets must be an array"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			h, store := newAdminTestHandler(adminAuth{})
+			store.providers["stored"] = &gateway.ProviderConfig{ID: "stored", Name: "stored"}
+			rec := adminRequest(h, http.MethodPost, "/admin/v1/routes", `{"model_alias":"a","targets":`+tt.targets+`}`)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d; body = %s", rec.Code, tt.want, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantErr) {
+				t.Errorf("body = %s, want %q", rec.Body.String(), tt.wantErr)
+			}
+			if tt.want != http.StatusCreated && len(store.routes) != 0 {
+				t.Errorf("rejected route was stored: %+v", store.routes)
+			}
+		})
+	}
+
+	t.Run("update over limit", func(t *testing.T) {
+		t.Parallel()
+		store := newAdminFakeStore()
+		store.routes["route-1"] = &gateway.Route{ID: "route-1", ModelAlias: "a"}
+		reg := provider.NewRegistry()
+		reg.Register("fake", fakeProvider{})
+		routerSvc := app.NewRouterService(store)
+		h := New(Deps{
+			Auth:            adminAuth{},
+			Proxy:           app.NewProxyService(reg, routerSvc, nil, nil),
+			Providers:       reg,
+			Router:          routerSvc,
+			Store:           store,
+			MaxRouteTargets: 2,
+		})
+		body := `{"model_alias":"a","targets":[` + target + "," + target + "," + target + `]}`
+		rec := adminRequest(h, http.MethodPut, "/admin/v1/routes/route-1", body)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "route has 3 targets, at most 2 allowed") {
+			t.Fatalf("status = %d, body = %s; want 400 naming the limit", rec.Code, rec.Body.String())
+		}
+	})
+}
+
 func TestAdminQueryUsage(t *testing.T) {
 	t.Parallel()
 	h, store := newAdminTestHandler(adminAuth{})
@@ -714,6 +1165,127 @@ func TestAdminCreateKey_InvalidExpiry(t *testing.T) {
 	}
 }
 
+func TestAdminKeyRequestQuota(t *testing.T) {
+	t.Parallel()
+	h, store := newAdminTestHandler(adminAuth{})
+
+	if rec := adminRequest(h, http.MethodPost, "/admin/v1/keys", `{"org_id":"default","max_requests":100,"request_period":"fortnightly"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("create with bad period: status = %d, want 400; body = %s", rec.Code, rec.Body.String())
+	}
+	rec := adminRequest(h, http.MethodPost, "/admin/v1/keys", `{"org_id":"default","max_requests":100,"request_period":"monthly"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, want 201; body = %s", rec.Code, rec.Body.String())
+	}
+	var created gateway.APIKey
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.MaxRequests == nil || *created.MaxRequests != 100 || created.RequestPeriod != "monthly" {
+		t.Errorf("created key = %+v, want 100 requests monthly", created)
+	}
+
+	path := "/admin/v1/keys/" + created.ID
+	if rec := adminRequest(h, http.MethodPut, path, `{"request_period":"hourly"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("update with bad period: status = %d, want 400; body = %s", rec.Code, rec.Body.String())
+	}
+	if rec := adminRequest(h, http.MethodPut, path, `{"max_requests":500,"request_period":"daily"}`); rec.Code != http.StatusOK {
+		t.Fatalf("update: status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if k := store.keys[created.ID]; k.MaxRequests == nil || *k.MaxRequests != 500 || k.RequestPeriod != "daily" {
+		t.Errorf("stored key = %+v, want 500 requests daily", k)
+	}
+}
+
+func TestAdminKeyPreferredProviders(t *testing.T) {
+	t.Parallel()
+	h, store := newAdminTestHandler(adminAuth{})
+	store.mu.Lock()
+	store.providers["dedicated"] = &gateway.ProviderConfig{ID: "dedicated"}
+	store.providers["shared"] = &gateway.ProviderConfig{ID: "shared"}
+	store.mu.Unlock()
+
+	for _, body := range []string{
+		`{"org_id":"default","preferred_providers":["nope"]}`,
+		`{"org_id":"default","preferred_providers":["dedicated","dedicated"]}`,
+	} {
+		if rec := adminRequest(h, http.MethodPost, "/admin/v1/keys", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("create %s: status = %d, want 400; body = %s", body, rec.Code, rec.Body.String())
+		}
+	}
+	rec := adminRequest(h, http.MethodPost, "/admin/v1/keys", `{"org_id":"default","preferred_providers":["dedicated"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, want 201; body = %s", rec.Code, rec.Body.String())
+	}
+	var created gateway.APIKey
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(created.PreferredProviders, []string{"dedicated"}) {
+		t.Errorf("preferred_providers = %v, want [dedicated]", created.PreferredProviders)
+	}
+
+	path := "/admin/v1/keys/" + created.ID
+	if rec := adminRequest(h, http.MethodPut, path, `{"preferred_providers":["nope"]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("update with unknown provider: status = %d, want 400; body = %s", rec.Code, rec.Body.String())
+	}
+	if rec := adminRequest(h, http.MethodPut, path, `{"preferred_providers":["shared","dedicated"]}`); rec.Code != http.StatusOK {
+		t.Fatalf("update: status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+	}
+	if rec := adminRequest(h, http.MethodPut, path, `{"role":"member"}`); rec.Code != http.StatusOK {
+		t.Fatalf("update without preferred_providers: status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+	}
+	store.mu.Lock()
+	got := store.keys[created.ID].PreferredProviders
+	store.mu.Unlock()
+	if !slices.Equal(got, []string{"shared", "dedicated"}) {
+		t.Errorf("stored preferred_providers = %v, want [shared dedicated]", got)
+	}
+
+	if rec := adminRequest(h, http.MethodPut, path, `{"preferred_providers":[]}`); rec.Code != http.StatusOK {
+		t.Fatalf("clear: status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if got := store.keys[created.ID].PreferredProviders; len(got) != 0 {
+		t.Errorf("preferred_providers after clear = %v, want none", got)
+	}
+}
+
+func TestAdminKeyMaxPriority(t *testing.T) {
+	t.Parallel()
+	h, store := newAdminTestHandler(adminAuth{})
+
+	if rec := adminRequest(h, http.MethodPost, "/admin/v1/keys", `{"org_id":"default","max_priority":"urgent"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("create with bad priority: status = %d, want 400; body = %s", rec.Code, rec.Body.String())
+	}
+	rec := adminRequest(h, http.MethodPost, "/admin/v1/keys", `{"org_id":"default","max_priority":"high"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, want 201; body = %s", rec.Code, rec.Body.String())
+	}
+	var created gateway.APIKey
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.MaxPriority != "high" {
+		t.Errorf("max_priority = %q, want high", created.MaxPriority)
+	}
+
+	path := "/admin/v1/keys/" + created.ID
+	if rec := adminRequest(h, http.MethodPut, path, `{"max_priority":"urgent"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("update with bad priority: status = %d, want 400; body = %s", rec.Code, rec.Body.String())
+	}
+	if rec := adminRequest(h, http.MethodPut, path, `{"max_priority":""}`); rec.Code != http.StatusOK {
+		t.Fatalf("update: status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if got := store.keys[created.ID].MaxPriority; got != "" {
+		t.Errorf("stored max_priority = %q, want empty", got)
+	}
+}
+
 func TestAdminUpdateKey_InvalidExpiry(t *testing.T) {
 	t.Parallel()
 	h, store := newAdminTestHandler(adminAuth{})
@@ -755,6 +1327,7 @@ func TestAdminConflictError(t *testing.T) {
 		Router:    routerSvc,
 		Keys:      app.NewKeyManager(conflictStore),
 		Store:     conflictStore,
+		Resolver:  testResolver,
 	})
 
 	body := `{"name":"dup","base_url":"https://example.com","enabled":true}`
@@ -834,3 +1407,1086 @@ func TestAdminCrossOrgKeyAccess(t *testing.T) {
 		t.Errorf("create cross-org key: status = %d, want 403", rec.Code)
 	}
 }
+
+func TestAdminOrgCRUD(t *testing.T) {
+	t.Parallel()
+	h, _ := newAdminTestHandler(superAdminAuth{})
+
+	rec := adminRequest(h, http.MethodPost, "/admin/v1/orgs", `{"id":"acme","name":"Acme","rpm_limit":600,"allowed_models":["gpt-4o"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+	var created gateway.Organization
+	json.NewDecoder(rec.Body).Decode(&created)
+	if created.ID != "acme" || created.CreatedAt.IsZero() {
+		t.Errorf("created = %+v, want id acme with created_at set", created)
+	}
+	if rec = adminRequest(h, http.MethodPost, "/admin/v1/orgs", `{"id":"acme","name":"Acme again"}`); rec.Code != http.StatusConflict {
+		t.Errorf("duplicate create: status = %d, want 409", rec.Code)
+	}
+	if rec = adminRequest(h, http.MethodPost, "/admin/v1/orgs", `{"id":"nameless"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("create without name: status = %d, want 400", rec.Code)
+	}
+
+	rec = adminRequest(h, http.MethodPut, "/admin/v1/orgs/acme", `{"max_budget":250}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+	var updated gateway.Organization
+	json.NewDecoder(rec.Body).Decode(&updated)
+	if updated.Name != "Acme" || updated.RPMLimit == nil || *updated.RPMLimit != 600 || updated.MaxBudget == nil || *updated.MaxBudget != 250 {
+		t.Errorf("updated = %+v, want name and rpm kept, budget set", updated)
+	}
+
+	rec = adminRequest(h, http.MethodGet, "/admin/v1/orgs", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"total":1`) {
+		t.Errorf("list: status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+
+	if rec = adminRequest(h, http.MethodDelete, "/admin/v1/orgs/acme", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+	if rec = adminRequest(h, http.MethodGet, "/admin/v1/orgs/acme", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("get after delete: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestAdminDeleteOrg_WithKeys(t *testing.T) {
+	t.Parallel()
+	h, store := newAdminTestHandler(superAdminAuth{})
+
+	store.mu.Lock()
+	store.orgs["acme"] = &gateway.Organization{ID: "acme", Name: "Acme"}
+	store.keys["acme-key"] = &gateway.APIKey{ID: "acme-key", OrgID: "acme", Role: "member"}
+	store.mu.Unlock()
+
+	if rec := adminRequest(h, http.MethodDelete, "/admin/v1/orgs/acme", ""); rec.Code != http.StatusConflict {
+		t.Fatalf("delete with keys: status = %d, want 409; body = %s", rec.Code, rec.Body.String())
+	}
+	store.mu.RLock()
+	_, ok := store.orgs["acme"]
+	store.mu.RUnlock()
+	if !ok {
+		t.Fatal("org with keys was deleted")
+	}
+
+	store.mu.Lock()
+	delete(store.keys, "acme-key")
+	store.mu.Unlock()
+	if rec := adminRequest(h, http.MethodDelete, "/admin/v1/orgs/acme", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("delete without keys: status = %d, want 204; body = %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAdminCrossOrgOrgAccess(t *testing.T) {
+	t.Parallel()
+	h, store := newAdminTestHandler(adminAuth{})
+
+	store.mu.Lock()
+	store.orgs["default"] = &gateway.Organization{ID: "default", Name: "Default"}
+	store.orgs["other-org"] = &gateway.Organization{ID: "other-org", Name: "Theirs"}
+	store.mu.Unlock()
+
+	tests := []struct {
+		name, method, path, body string
+		want                     int
+	}{
+		{"get", http.MethodGet, "/admin/v1/orgs/other-org", "", http.StatusNotFound},
+		{"update", http.MethodPut, "/admin/v1/orgs/other-org", `{"name":"Mine"}`, http.StatusNotFound},
+		{"delete", http.MethodDelete, "/admin/v1/orgs/other-org", "", http.StatusNotFound},
+		{"create", http.MethodPost, "/admin/v1/orgs", `{"id":"new-org","name":"New"}`, http.StatusForbidden},
+		{"get own", http.MethodGet, "/admin/v1/orgs/default", "", http.StatusOK},
+		{"update own", http.MethodPut, "/admin/v1/orgs/default", `{"rpm_limit":60}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if rec := adminRequest(h, tt.method, tt.path, tt.body); rec.Code != tt.want {
+			t.Errorf("%s org: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+
+	rec := adminRequest(h, http.MethodGet, "/admin/v1/orgs", "")
+	var list struct {
+		Data       []gateway.Organization `json:"data"`
+		Pagination pagination             `json:"pagination"`
+	}
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list.Data) != 1 || list.Data[0].ID != "default" || list.Pagination.Total != 1 {
+		t.Errorf("list = %+v, want only the caller's org", list)
+	}
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	if got := store.orgs["other-org"]; got == nil || got.Name != "Theirs" {
+		t.Errorf("cross-org org = %+v, want it untouched", got)
+	}
+	if _, ok := store.orgs["new-org"]; ok {
+		t.Error("org admin created an org")
+	}
+}
+
+func TestAdminKeyRoleEscalation(t *testing.T) {
+	t.Parallel()
+	h, store := newAdminTestHandler(adminAuth{})
+
+	store.mu.Lock()
+	store.keys["key-m"] = &gateway.APIKey{ID: "key-m", OrgID: "default", Role: "member"}
+	store.mu.Unlock()
+
+	if rec := adminRequest(h, http.MethodPost, "/admin/v1/keys", `{"role":"superadmin"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("create superadmin key: status = %d, want 403", rec.Code)
+	}
+	if rec := adminRequest(h, http.MethodPut, "/admin/v1/keys/key-m", `{"role":"superadmin"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("promote to superadmin: status = %d, want 403", rec.Code)
+	}
+	if rec := adminRequest(h, http.MethodPost, "/admin/v1/keys", `{"role":"admin"}`); rec.Code != http.StatusCreated {
+		t.Errorf("create admin key: status = %d, want 201; body = %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAdminTeamCRUD(t *testing.T) {
+	t.Parallel()
+	h, _ := newAdminTestHandler(adminAuth{})
+
+	// Create: org defaults to the caller's, ID is generated.
+	rec := adminRequest(h, http.MethodPost, "/admin/v1/teams",
+		`{"name":"Backend","allowed_models":["gpt-4o"],"rpm_limit":100,"max_budget":50}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+	var created gateway.Team
+	json.NewDecoder(rec.Body).Decode(&created)
+	if created.ID == "" || created.OrgID != "default" || created.Name != "Backend" {
+		t.Fatalf("created = %+v, want a generated ID in org default", created)
+	}
+	if loc := rec.Header().Get("Location"); loc != "/admin/v1/teams/"+created.ID {
+		t.Errorf("Location = %q", loc)
+	}
+	if rec = adminRequest(h, http.MethodPost, "/admin/v1/teams", `{"org_id":"default"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("create without name: status = %d, want 400", rec.Code)
+	}
+
+	// Get
+	rec = adminRequest(h, http.MethodGet, "/admin/v1/teams/"+created.ID, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get: status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+
+	// Update: only the given fields change.
+	rec = adminRequest(h, http.MethodPut, "/admin/v1/teams/"+created.ID, `{"tpm_limit":5000,"allowed_models":["gpt-4o","claude"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+	var updated gateway.Team
+	json.NewDecoder(rec.Body).Decode(&updated)
+	if updated.Name != "Backend" || updated.RPMLimit == nil || *updated.RPMLimit != 100 ||
+		updated.TPMLimit == nil || *updated.TPMLimit != 5000 || len(updated.AllowedModels) != 2 {
+		t.Errorf("updated = %+v, want name and rpm kept, tpm and models changed", updated)
+	}
+
+	// List
+	rec = adminRequest(h, http.MethodGet, "/admin/v1/teams", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list: status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+	var list struct {
+		Data       []gateway.Team `json:"data"`
+		Pagination pagination     `json:"pagination"`
+	}
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list.Data) != 1 || list.Pagination.Total != 1 {
+		t.Errorf("list = %+v, want 1 team", list)
+	}
+
+	// Delete
+	rec = adminRequest(h, http.MethodDelete, "/admin/v1/teams/"+created.ID, "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+	if rec = adminRequest(h, http.MethodGet, "/admin/v1/teams/"+created.ID, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("get after delete: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestAdminCrossOrgTeamAccess(t *testing.T) {
+	t.Parallel()
+	h, store := newAdminTestHandler(adminAuth{})
+
+	store.mu.Lock()
+	store.teams["cross-org-team"] = &gateway.Team{ID: "cross-org-team", OrgID: "other-org", Name: "Theirs"}
+	store.mu.Unlock()
+
+	tests := []struct {
+		name, method, path, body string
+		want                     int
+	}{
+		{"get", http.MethodGet, "/admin/v1/teams/cross-org-team", "", http.StatusNotFound},
+		{"update", http.MethodPut, "/admin/v1/teams/cross-org-team", `{"name":"Mine"}`, http.StatusNotFound},
+		{"delete", http.MethodDelete, "/admin/v1/teams/cross-org-team", "", http.StatusNotFound},
+		{"list", http.MethodGet, "/admin/v1/teams?org_id=other-org", "", http.StatusForbidden},
+		{"create", http.MethodPost, "/admin/v1/teams", `{"org_id":"other-org","name":"Sneaky"}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if rec := adminRequest(h, tt.method, tt.path, tt.body); rec.Code != tt.want {
+			t.Errorf("%s cross-org team: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	if got := store.teams["cross-org-team"]; got == nil || got.Name != "Theirs" {
+		t.Errorf("cross-org team = %+v, want it untouched", got)
+	}
+}
+
+// capsProvider is a fakeProvider that reports model capabilities.
+type capsProvider struct{ fakeProvider }
+
+func (capsProvider) Capabilities(string) gateway.Capabilities {
+	return gateway.Capabilities{Chat: true, Tools: true, Streaming: true}
+}
+
+func TestAdminModelCapabilities(t *testing.T) {
+	t.Parallel()
+
+	store := newAdminFakeStore()
+	store.routes["r-caps"] = &gateway.Route{
+		ID: "r-caps", ModelAlias: "gpt-4o",
+		Targets:  []byte(`[{"provider_id":"caps","model":"gpt-4o","priority":1}]`),
+		Strategy: "priority",
+	}
+	store.routes["r-alias"] = &gateway.Route{
+		ID: "r-alias", ModelAlias: "smart",
+		Targets:  []byte(`[{"provider_id":"fake","model":"plain","priority":1},{"provider_id":"fake","model":"config-only","priority":2}]`),
+		Strategy: "priority",
+	}
+	store.routes["r-plain"] = &gateway.Route{
+		ID: "r-plain", ModelAlias: "plain",
+		Targets:  []byte(`[{"provider_id":"fake","model":"plain","priority":1}]`),
+		Strategy: "priority",
+	}
+	reg := provider.NewRegistry()
+	reg.Register("fake", fakeProvider{})
+	reg.Register("caps", capsProvider{})
+	routerSvc := app.NewRouterService(store)
+	vision, noTools := true, false
+	h := New(Deps{
+		Auth:      adminAuth{},
+		Proxy:     app.NewProxyService(reg, routerSvc, nil, nil),
+		Providers: reg,
+		Router:    routerSvc,
+		Keys:      app.NewKeyManager(store),
+		Store:     store,
+		Capabilities: map[string]gateway.CapabilityOverride{
+			"gpt-4o":      {Vision: &vision, Tools: &noTools},
+			"config-only": {Vision: &vision},
+		},
+	})
+
+	tests := []struct {
+		name       string
+		model      string
+		wantStatus int
+		wantSource string
+		want       gateway.Capabilities
+	}{
+		{"provider with override", "gpt-4o", http.StatusOK, "provider+config",
+			gateway.Capabilities{Chat: true, Vision: true, Streaming: true}},
+		{"config only", "config-only", http.StatusOK, "config",
+			gateway.Capabilities{Vision: true}},
+		{"alias uses target override", "smart", http.StatusOK, "config",
+			gateway.Capabilities{Vision: true}},
+		{"no reporter no override", "plain", http.StatusNotFound, "", gateway.Capabilities{}},
+		{"unknown model", "unknown", http.StatusNotFound, "", gateway.Capabilities{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(http.MethodGet, "/admin/v1/models/"+tt.model+"/capabilities", nil)
+			req.Header.Set("Authorization", "Bearer gnd_admin")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got capabilitiesResponse
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if got.Source != tt.wantSource {
+				t.Errorf("source = %q, want %q", got.Source, tt.wantSource)
+			}
+			if got.Capabilities != tt.want {
+				t.Errorf("capabilities = %+v, want %+v", got.Capabilities, tt.want)
+			}
+		})
+	}
+}
+
+func adminRequest(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer gnd_admin")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminBackupRestoreRoundTrip(t *testing.T) {
+	t.Parallel()
+	src, _ := newAdminTestHandler(superAdminAuth{})
+
+	rec := adminRequest(src, http.MethodPost, "/admin/v1/routes",
+		`{"model_alias":"team-model","targets":[{"provider_id":"fake","model":"gpt-4o","priority":1}]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create route: status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+	rec = adminRequest(src, http.MethodPost, "/admin/v1/keys", `{"org_id":"default","role":"member"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create key: status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	json.NewDecoder(rec.Body).Decode(&created)
+
+	rec = adminRequest(src, http.MethodGet, "/admin/v1/backup", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("backup: status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+	doc := rec.Body.String()
+	if strings.Contains(doc, created.Key) {
+		t.Error("backup contains plaintext key")
+	}
+
+	// Restore into an empty gateway.
+	dst, dstStore := newAdminTestHandler(superAdminAuth{})
+	rec = adminRequest(dst, http.MethodPost, "/admin/v1/restore", doc)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("restore: status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+
+	// Routing: the restored alias resolves to the provider.
+	rec = adminRequest(dst, http.MethodPost, "/v1/chat/completions",
+		`{"model":"team-model","messages":[{"role":"user","content":"hi"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("chat via restored route: status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+
+	// Auth: the original plaintext key still authenticates.
+	keyAuth, err := auth.NewAPIKeyAuth(dstStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	req.Header.Set("Authorization", "Bearer "+created.Key)
+	id, err := keyAuth.Authenticate(context.Background(), req)
+	if err != nil {
+		t.Fatalf("authenticate restored key: %v", err)
+	}
+	if id.KeyID != created.ID {
+		t.Errorf("key id = %q, want %q", id.KeyID, created.ID)
+	}
+}
+
+func TestAdminRestoreRejectsTampering(t *testing.T) {
+	t.Parallel()
+	h, store := newAdminTestHandler(superAdminAuth{})
+	adminRequest(h, http.MethodPost, "/admin/v1/routes", `{"model_alias":"keep","targets":[]}`)
+
+	rec := adminRequest(h, http.MethodGet, "/admin/v1/backup", "")
+	var doc map[string]any
+	json.NewDecoder(rec.Body).Decode(&doc)
+	doc["data"] = map[string]any{"routes": []any{}}
+	tampered, _ := json.Marshal(doc)
+
+	rec = adminRequest(h, http.MethodPost, "/admin/v1/restore", string(tampered))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("tampered restore: status = %d, want 400", rec.Code)
+	}
+	if n, _ := store.CountRoutes(context.Background()); n != 1 {
+		t.Errorf("routes after rejected restore = %d, want 1", n)
+	}
+
+	// Other signing key: rejected.
+	other := New(Deps{Auth: superAdminAuth{}, Store: store, Backup: store, BackupSigningKey: []byte("other")})
+	rec = adminRequest(h, http.MethodGet, "/admin/v1/backup", "")
+	rec = adminRequest(other, http.MethodPost, "/admin/v1/restore", rec.Body.String())
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("wrong key restore: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestAdminBackup_NonSuperadminDenied(t *testing.T) {
+	t.Parallel()
+	for _, authn := range []gateway.Authenticator{memberAuth{}, adminAuth{}} {
+		h, _ := newAdminTestHandler(authn)
+		for _, tc := range []struct{ method, path string }{
+			{http.MethodGet, "/admin/v1/backup"},
+			{http.MethodPost, "/admin/v1/restore"},
+		} {
+			if rec := adminRequest(h, tc.method, tc.path, "{}"); rec.Code != http.StatusForbidden {
+				t.Errorf("%T %s %s: status = %d, want 403", authn, tc.method, tc.path, rec.Code)
+			}
+		}
+	}
+}
+
+func TestAdminCacheWarm(t *testing.T) {
+	t.Parallel()
+	var calls atomic.Int32
+	reg := provider.NewRegistry()
+	reg.Register("fake", &testutil.FakeProvider{
+		ProviderName: "fake",
+		ChatFn: func(_ context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			calls.Add(1)
+			return &gateway.ChatResponse{
+				ID:      "chatcmpl-warm",
+				Object:  "chat.completion",
+				Model:   req.Model,
+				Choices: []gateway.Choice{{Message: gateway.Message{Role: "assistant", Content: json.RawMessage(`"warm"`)}, FinishReason: "stop"}},
+			}, nil
+		},
+	})
+	store := newAdminFakeStore()
+	routerSvc := app.NewRouterService(&fakeRouteStore{})
+	h := New(Deps{
+		Auth:      adminAuth{},
+		Proxy:     app.NewProxyService(reg, routerSvc, nil, nil),
+		Providers: reg,
+		Router:    routerSvc,
+		Store:     store,
+		Cache:     newTestCache(),
+	})
+
+	deterministic := `{"model":"gpt-4o","messages":[{"role":"user","content":"capital of France?"}],"temperature":0}`
+	body := `{"requests":[` + deterministic + `,` +
+		`{"model":"gpt-4o","messages":[{"role":"user","content":"a poem"}],"temperature":1}]}`
+	rec := adminRequest(h, http.MethodPost, "/admin/v1/cache/warm", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("warm: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var out cacheWarmResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Results) != 2 || out.Results[0].Status != warmStored || out.Results[1].Status != warmSkipped {
+		t.Fatalf("results = %+v, want [stored skipped]", out.Results)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("provider calls after warm = %d, want 1", n)
+	}
+	time.Sleep(50 * time.Millisecond) // otter async processing
+
+	// The same request from the warmed key is now a cache hit.
+	chat := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(deterministic))
+	chat.Header.Set("Content-Type", "application/json")
+	chat.Header.Set("Authorization", "Bearer gnd_admin")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, chat)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "chatcmpl-warm") {
+		t.Fatalf("chat: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("provider calls after chat = %d, want 1 (served from cache)", n)
+	}
+
+	// Warming again sends nothing upstream.
+	rec = adminRequest(h, http.MethodPost, "/admin/v1/cache/warm", `{"requests":[`+deterministic+`]}`)
+	if !strings.Contains(rec.Body.String(), `"status":"cached"`) || calls.Load() != 1 {
+		t.Errorf("re-warm: body = %s, calls = %d", rec.Body.String(), calls.Load())
+	}
+}
+
+func TestAdminCacheWarm_Rejections(t *testing.T) {
+	t.Parallel()
+	h, _ := newAdminTestHandler(adminAuth{})
+
+	req := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"temperature":0}`
+	batch := `{"requests":[` + strings.TrimSuffix(strings.Repeat(req+",", maxCacheWarmBatch+1), ",") + `]}`
+	tests := []struct {
+		name, body string
+		want       int
+	}{
+		{"empty", `{"requests":[]}`, http.StatusBadRequest},
+		{"too many", batch, http.StatusBadRequest},
+		{"body too large", `{"requests":[{"model":"` + strings.Repeat("x", maxRequestBody) + `"}]}`, http.StatusBadRequest},
+		{"unknown key", `{"key_id":"nope","requests":[` + req + `]}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if rec := adminRequest(h, http.MethodPost, "/admin/v1/cache/warm", tt.body); rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d; body = %s", tt.name, rec.Code, tt.want, rec.Body.String())
+		}
+	}
+
+	member, _ := newAdminTestHandler(memberAuth{})
+	if rec := adminRequest(member, http.MethodPost, "/admin/v1/cache/warm", `{"requests":[`+req+`]}`); rec.Code != http.StatusForbidden {
+		t.Errorf("member: status = %d, want 403", rec.Code)
+	}
+}
+
+func TestAdminCacheWarm_RequireUser(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	reg := provider.NewRegistry()
+	reg.Register("fake", &testutil.FakeProvider{
+		ProviderName: "fake",
+		ChatFn: func(_ context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			calls.Add(1)
+			return &gateway.ChatResponse{ID: "chatcmpl-warm", Object: "chat.completion", Model: req.Model}, nil
+		},
+	})
+	routerSvc := app.NewRouterService(&fakeRouteStore{})
+	h := New(Deps{
+		Auth:            adminAuth{},
+		Proxy:           app.NewProxyService(reg, routerSvc, nil, nil),
+		Providers:       reg,
+		Router:          routerSvc,
+		Store:           newAdminFakeStore(),
+		Cache:           newTestCache(),
+		RequireUserOrgs: []string{"default"},
+	})
+
+	withUser := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"temperature":0,"user":"u-1"}`
+	withoutUser := `{"model":"gpt-4o","messages":[{"role":"user","content":"bye"}],"temperature":0}`
+	rec := adminRequest(h, http.MethodPost, "/admin/v1/cache/warm", `{"requests":[`+withUser+`,`+withoutUser+`]}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "requests[1]: user is required") {
+		t.Fatalf("status = %d, body = %s; want 400 naming requests[1]", rec.Code, rec.Body.String())
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("provider calls = %d, want 0 for a rejected batch", n)
+	}
+
+	rec = adminRequest(h, http.MethodPost, "/admin/v1/cache/warm", `{"requests":[`+withUser+`]}`)
+	if rec.Code != http.StatusOK || calls.Load() != 1 {
+		t.Errorf("with user: status = %d, calls = %d; body = %s", rec.Code, calls.Load(), rec.Body.String())
+	}
+}
+
+func TestAdminProviderBaseURL(t *testing.T) {
+	t.Parallel()
+	h, _ := newAdminTestHandler(adminAuth{})
+
+	tests := []struct {
+		name    string
+		baseURL string
+	}{
+		{"loopback", "http://127.0.0.1:11434"},
+		{"localhost", "http://localhost:11434"},
+		{"metadata", "http://169.254.169.254/latest"},
+		{"private", "http://10.0.0.5/v1"},
+		{"ipv6 loopback", "http://[::1]:8080"},
+		{"resolves private", "https://internal.corp/v1"},
+		{"any record internal", "https://dual.example.com/v1"},
+		{"unresolvable", "https://nowhere.invalid/v1"},
+		{"not http", "file:///etc/passwd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"name":"p","base_url":"` + tt.baseURL + `","enabled":true}`
+			rec := adminRequest(h, http.MethodPost, "/admin/v1/providers", body)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400; body = %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	// Update is checked too.
+	rec := adminRequest(h, http.MethodPost, "/admin/v1/providers", `{"name":"ok","base_url":"https://example.com/v1","enabled":true}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create public: status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+	rec = adminRequest(h, http.MethodPut, "/admin/v1/providers/ok", `{"name":"ok","base_url":"http://127.0.0.1/v1","enabled":true}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("update to loopback: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestAdminProviderBaseURL_Allowlist(t *testing.T) {
+	t.Parallel()
+	h := New(Deps{
+		Auth:                     adminAuth{},
+		Store:                    newAdminFakeStore(),
+		Resolver:                 testResolver,
+		ProviderBaseURLAllowlist: []string{"localhost", "192.168.1.0/24"},
+	})
+
+	for i, baseURL := range []string{"http://localhost:11434", "http://ollama.lan:11434", "http://192.168.1.7:11434"} {
+		body := fmt.Sprintf(`{"name":"ollama-%d","type":"ollama","base_url":%q,"enabled":true}`, i, baseURL)
+		rec := adminRequest(h, http.MethodPost, "/admin/v1/providers", body)
+		if rec.Code != http.StatusCreated {
+			t.Errorf("%s: status = %d, want 201; body = %s", baseURL, rec.Code, rec.Body.String())
+		}
+	}
+	rec := adminRequest(h, http.MethodPost, "/admin/v1/providers", `{"name":"meta","base_url":"http://169.254.169.254","enabled":true}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("non-allowlisted internal: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestAdminRecentErrors(t *testing.T) {
+	t.Parallel()
+	reg := provider.NewRegistry()
+	reg.Register("openai", &testutil.FakeProvider{
+		ProviderName: "openai",
+		ChatFn: func(context.Context, *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			return nil, &provider.APIError{Provider: "openai", StatusCode: http.StatusServiceUnavailable, Body: "upstream secret"}
+		},
+	})
+	routes := testutil.NewFakeStore()
+	routes.AddRoute(&gateway.Route{
+		ID:         "r-1",
+		ModelAlias: "gpt-4o",
+		Targets:    []byte(`[{"provider_id":"openai","model":"gpt-4o","priority":1}]`),
+		Strategy:   "priority",
+	})
+	routerSvc := app.NewRouterService(routes)
+	proxySvc := app.NewProxyService(reg, routerSvc, nil, nil)
+	errorLog := app.NewErrorLog(10)
+	proxySvc.SetErrorLog(errorLog)
+	h := New(Deps{
+		Auth:        rateLimitAuth{rpm: 1},
+		Proxy:       proxySvc,
+		Providers:   reg,
+		Router:      routerSvc,
+		Store:       newAdminFakeStore(),
+		RateLimiter: ratelimit.NewRegistry(),
+		ErrorLog:    errorLog,
+	})
+
+	// The first request fails upstream, the second is over the RPM limit.
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+	if rec := postChatRecorder(h, body); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("first request: status = %d, want 500", rec.Code)
+	}
+	if rec := postChatRecorder(h, body); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: status = %d, want 429", rec.Code)
+	}
+
+	rec := adminRequest(h, http.MethodGet, "/admin/v1/errors/recent", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "upstream secret") {
+		t.Error("recent errors must not expose upstream error bodies")
+	}
+	var resp struct {
+		Data []app.ErrorEvent `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 2 {
+		t.Fatalf("got %d events, want 2: %s", len(resp.Data), rec.Body.String())
+	}
+	limited, failed := resp.Data[0], resp.Data[1] // newest first
+	if limited.Kind != app.ErrorKindRateLimited || limited.Status != http.StatusTooManyRequests {
+		t.Errorf("newest event = %+v, want a 429 rate_limited event", limited)
+	}
+	if failed.Kind != app.ErrorKindProvider || failed.Provider != "openai" || failed.Model != "gpt-4o" ||
+		failed.Status != http.StatusServiceUnavailable || failed.Message != "server_error" {
+		t.Errorf("provider event = %+v", failed)
+	}
+	if failed.RequestID == "" || failed.Time.IsZero() {
+		t.Errorf("provider event missing request ID or time: %+v", failed)
+	}
+
+	rec = adminRequest(h, http.MethodGet, "/admin/v1/errors/recent?limit=1", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].Kind != app.ErrorKindRateLimited {
+		t.Errorf("limit=1: got %+v", resp.Data)
+	}
+}
+
+func TestAdminRecentErrors_OrgScoped(t *testing.T) {
+	t.Parallel()
+	errorLog := app.NewErrorLog(10)
+	for _, org := range []string{"default", "other", "default"} {
+		ctx := gateway.ContextWithIdentity(context.Background(), &gateway.Identity{OrgID: org})
+		errorLog.Add(ctx, app.ErrorEvent{Kind: app.ErrorKindRateLimited, Message: org})
+	}
+
+	tests := []struct {
+		name string
+		auth gateway.Authenticator
+		want []string // event orgs, newest first
+	}{
+		{"org admin sees own org", adminAuth{}, []string{"default", "default"}},
+		{"superadmin sees every org", superAdminAuth{}, []string{"default", "other", "default"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			h := New(Deps{Auth: tt.auth, Store: newAdminFakeStore(), ErrorLog: errorLog})
+			rec := adminRequest(h, http.MethodGet, "/admin/v1/errors/recent", "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+			}
+			var resp struct {
+				Data []app.ErrorEvent `json:"data"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range resp.Data {
+				got = append(got, e.OrgID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("event orgs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdminProviderLatency(t *testing.T) {
+	t.Parallel()
+	stats := app.NewLatencyStats(0)
+	for i := 1; i <= 100; i++ {
+		stats.Observe("openai", time.Duration(i)*time.Millisecond)
+	}
+	stats.Observe("anthropic", 40*time.Millisecond)
+	h := New(Deps{
+		Auth:         adminAuth{},
+		Store:        newAdminFakeStore(),
+		LatencyStats: stats,
+	})
+
+	rec := adminRequest(h, http.MethodGet, "/admin/v1/providers/latency", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data []providerLatency `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []providerLatency{
+		{Provider: "anthropic", Samples: 1, P50Ms: 40, P95Ms: 40, P99Ms: 40},
+		{Provider: "openai", Samples: 100, P50Ms: 50, P95Ms: 95, P99Ms: 99},
+	}
+	if !slices.Equal(resp.Data, want) {
+		t.Errorf("data = %+v, want %+v", resp.Data, want)
+	}
+}
+
+func TestAdminAuditLog(t *testing.T) {
+	t.Parallel()
+	h, _ := newAdminTestHandler(adminAuth{})
+
+	rec := adminRequest(h, http.MethodPost, "/admin/v1/providers",
+		`{"name":"openai","base_url":"https://api.openai.com/v1","priority":1,"enabled":true}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+	rec = adminRequest(h, http.MethodPut, "/admin/v1/providers/openai",
+		`{"name":"openai","base_url":"https://api.openai.com/v1","priority":2,"enabled":true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+	// Failed mutations are not recorded.
+	if rec = adminRequest(h, http.MethodPut, "/admin/v1/providers/missing", `{"name":"missing"}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("update missing: status = %d, want 404", rec.Code)
+	}
+
+	rec = adminRequest(h, http.MethodGet, "/admin/v1/audit?target_type=provider", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("audit: status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data       []gateway.AuditEntry `json:"data"`
+		Pagination pagination           `json:"pagination"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 2 || resp.Pagination.Total != 2 {
+		t.Fatalf("got %d entries (total %d), want 2: %s", len(resp.Data), resp.Pagination.Total, rec.Body.String())
+	}
+	update, create := resp.Data[0], resp.Data[1] // newest first
+	for _, e := range resp.Data {
+		if e.ActorKeyID != "key-admin-1" || e.ActorSubject != "admin" || e.OrgID != "default" || e.TargetID != "openai" || e.CreatedAt.IsZero() {
+			t.Errorf("entry = %+v, want actor key-admin-1 on provider openai", e)
+		}
+	}
+	if create.Action != "create" || !strings.Contains(string(create.Diff), `"base_url":{"new":"https://api.openai.com/v1"}`) {
+		t.Errorf("create entry = %s %s", create.Action, create.Diff)
+	}
+	if update.Action != "update" || string(update.Diff) != `{"priority":{"old":1,"new":2}}` {
+		t.Errorf("update entry = %s %s, want only the priority change", update.Action, update.Diff)
+	}
+}
+
+func TestAdminAuditLogOrgScoped(t *testing.T) {
+	t.Parallel()
+	h, store := newAdminTestHandler(adminAuth{})
+	store.audit = append(store.audit,
+		gateway.AuditEntry{ID: "a-mine", OrgID: "default", Action: "create", TargetType: "key", TargetID: "k1"},
+		gateway.AuditEntry{ID: "a-other", OrgID: "other", Action: "create", TargetType: "key", TargetID: "k2"},
+	)
+
+	rec := adminRequest(h, http.MethodGet, "/admin/v1/audit", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data []gateway.AuditEntry `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].ID != "a-mine" {
+		t.Errorf("entries = %+v, want only the caller's org", resp.Data)
+	}
+	if rec := adminRequest(h, http.MethodGet, "/admin/v1/audit?org_id=other", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("other org: status = %d, want 403", rec.Code)
+	}
+}
+
+func TestAdminProviderMigrate(t *testing.T) {
+	t.Parallel()
+
+	newStore := func() (http.Handler, *adminFakeStore) {
+		h, store := newAdminTestHandler(adminAuth{})
+		store.providers["openai"] = &gateway.ProviderConfig{ID: "openai", Name: "openai"}
+		store.providers["azure"] = &gateway.ProviderConfig{ID: "azure", Name: "azure"}
+		store.routes["r-1"] = &gateway.Route{
+			ID:         "r-1",
+			ModelAlias: "gpt-4o",
+			Targets:    []byte(`[{"provider_id":"openai","model":"gpt-4o","priority":1},{"provider_id":"gemini","model":"gemini-2.0-flash","priority":2}]`),
+		}
+		store.routes["r-2"] = &gateway.Route{
+			ID:         "r-2",
+			ModelAlias: "claude",
+			Targets:    []byte(`[{"provider_id":"anthropic","model":"claude-sonnet-4","priority":1}]`),
+		}
+		return h, store
+	}
+	targets := func(t *testing.T, r *gateway.Route) []gateway.RouteTarget {
+		t.Helper()
+		var ts []gateway.RouteTarget
+		if err := json.Unmarshal(r.Targets, &ts); err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+
+	t.Run("repoints routes", func(t *testing.T) {
+		t.Parallel()
+		h, store := newStore()
+		rec := adminRequest(h, http.MethodPost, "/admin/v1/providers/openai/migrate?to=azure", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			Data []gateway.Route `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Data) != 1 || resp.Data[0].ID != "r-1" {
+			t.Fatalf("changed routes = %+v, want only r-1", resp.Data)
+		}
+		ts := targets(t, store.routes["r-1"])
+		if len(ts) != 2 || ts[0].ProviderID != "azure" || ts[0].Model != "gpt-4o" || ts[0].Priority != 1 ||
+			ts[1].ProviderID != "gemini" {
+			t.Errorf("r-1 targets = %+v", ts)
+		}
+		if ts := targets(t, store.routes["r-2"]); ts[0].ProviderID != "anthropic" {
+			t.Errorf("r-2 should be untouched, got %+v", ts)
+		}
+	})
+
+	t.Run("keep old as failover", func(t *testing.T) {
+		t.Parallel()
+		h, store := newStore()
+		rec := adminRequest(h, http.MethodPost, "/admin/v1/providers/openai/migrate?to=azure&keep_failover=true", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+		}
+		ts := targets(t, store.routes["r-1"])
+		if len(ts) != 3 {
+			t.Fatalf("r-1 targets = %+v, want 3", ts)
+		}
+		if ts[0].ProviderID != "azure" || ts[0].Priority != 1 {
+			t.Errorf("primary target = %+v, want azure at priority 1", ts[0])
+		}
+		if ts[2].ProviderID != "openai" || ts[2].Model != "gpt-4o" || ts[2].Priority != 3 {
+			t.Errorf("failover target = %+v, want openai/gpt-4o at priority 3", ts[2])
+		}
+	})
+
+	t.Run("bad requests", func(t *testing.T) {
+		t.Parallel()
+		h, _ := newStore()
+		for _, path := range []string{
+			"/admin/v1/providers/openai/migrate",
+			"/admin/v1/providers/openai/migrate?to=openai",
+			"/admin/v1/providers/openai/migrate?to=missing",
+			"/admin/v1/providers/openai/migrate?to=azure&keep_failover=maybe",
+		} {
+			if rec := adminRequest(h, http.MethodPost, path, ""); rec.Code != http.StatusBadRequest {
+				t.Errorf("%s: status = %d, want 400", path, rec.Code)
+			}
+		}
+	})
+}
+
+func TestAdminKeyLimits(t *testing.T) {
+	t.Parallel()
+	reg := provider.NewRegistry()
+	reg.Register("fake", fakeProvider{})
+	routerSvc := app.NewRouterService(&fakeRouteStore{})
+	store := newAdminFakeStore()
+	budget, rpm, maxReqs := 5.0, int64(10), int64(100)
+	store.keys["key-rl-1"] = &gateway.APIKey{ID: "key-rl-1", OrgID: "default", Role: "admin", RPMLimit: &rpm, MaxBudget: &budget, MaxRequests: &maxReqs, RequestPeriod: "monthly"}
+	store.keys["key-idle"] = &gateway.APIKey{ID: "key-idle", OrgID: "default", Role: "member"}
+	store.keys["cross-org-key"] = &gateway.APIKey{ID: "cross-org-key", OrgID: "other-org", Role: "member"}
+	quota := ratelimit.NewQuotaTracker()
+	requests := ratelimit.NewRequestQuotaTracker(nil)
+	h := New(Deps{
+		Auth:         rateLimitAuth{rpm: rpm, tpm: 1000},
+		Proxy:        app.NewProxyService(reg, routerSvc, nil, nil),
+		Providers:    reg,
+		Router:       routerSvc,
+		Store:        store,
+		RateLimiter:  ratelimit.NewRegistry(),
+		Quota:        quota,
+		RequestQuota: requests,
+		Streams:      ratelimit.NewStreamLimiter(),
+		DefaultTPM:   500,
+	})
+	requests.Record(context.Background(), "key-rl-1", ratelimit.PeriodMonthly)
+
+	for range 2 {
+		if rec := postChatRecorder(h, `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`); rec.Code != http.StatusOK {
+			t.Fatalf("chat: status = %d; body = %s", rec.Code, rec.Body.String())
+		}
+	}
+	quota.Consume("key-rl-1", 1.5)
+
+	rec := adminRequest(h, http.MethodGet, "/admin/v1/keys/key-rl-1/limits", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+	}
+	var got keyLimitsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Active {
+		t.Error("active = false, want true after requests")
+	}
+	if got.RPM == nil || got.RPM.Limit != 10 || got.RPM.Remaining != 8 || got.RPM.ResetSeconds <= 0 {
+		t.Errorf("rpm = %+v, want 8 of 10 remaining and a reset time", got.RPM)
+	}
+	if got.TPM == nil || got.TPM.Limit != 1000 || got.TPM.Remaining >= 1000 {
+		t.Errorf("tpm = %+v, want tokens consumed from 1000", got.TPM)
+	}
+	if got.Quota == nil || got.Quota.MaxBudget != 5 || got.Quota.Spent != 1.5 || got.Quota.Remaining != 3.5 {
+		t.Errorf("quota = %+v, want 1.5 of 5 spent", got.Quota)
+	}
+	if got.Requests == nil || got.Requests.Used != 1 || got.Requests.Remaining != 99 || got.Requests.ResetsAt == nil {
+		t.Errorf("requests = %+v, want 1 of 100 used and a reset time", got.Requests)
+	}
+	if got.OpenStreams == nil || *got.OpenStreams != 0 {
+		t.Errorf("open_streams = %v, want 0", got.OpenStreams)
+	}
+
+	// A key that has not made a request reports full buckets at the
+	// server defaults.
+	rec = adminRequest(h, http.MethodGet, "/admin/v1/keys/key-idle/limits", "")
+	got = keyLimitsResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Active || got.RPM != nil || got.TPM == nil || got.TPM.Remaining != 500 || got.Quota != nil || got.Requests != nil {
+		t.Errorf("idle key = %s, want inactive with a full default TPM bucket", rec.Body.String())
+	}
+
+	if rec := adminRequest(h, http.MethodGet, "/admin/v1/keys/cross-org-key/limits", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("cross-org key: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestAdminRouteResponseSchema(t *testing.T) {
+	t.Parallel()
+	h, store := newAdminTestHandler(adminAuth{})
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"valid", `{"model_alias":"tickets","targets":[{"provider_id":"fake","model":"gpt-4o","priority":1}],"response_schema":{"type":"object","required":["priority"]},"schema_policy":"retry"}`, http.StatusCreated},
+		{"unsupported keyword", `{"model_alias":"bad-kw","targets":[{"provider_id":"fake","model":"gpt-4o","priority":1}],"response_schema":{"$ref":"#/defs/x"}}`, http.StatusBadRequest},
+		{"unknown policy", `{"model_alias":"bad-policy","targets":[{"provider_id":"fake","model":"gpt-4o","priority":1}],"response_schema":{"type":"object"},"schema_policy":"ignore"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := adminRequest(h, http.MethodPost, "/admin/v1/routes", tt.body)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d; body = %s", tt.name, rec.Code, tt.want, rec.Body.String())
+		}
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.routes) != 1 {
+		t.Fatalf("stored %d routes, want only the valid one", len(store.routes))
+	}
+	for _, r := range store.routes {
+		if r.SchemaPolicy != gateway.SchemaRetry || !strings.Contains(string(r.ResponseSchema), "priority") {
+			t.Errorf("stored route = %+v, want schema and retry policy", r)
+		}
+	}
+}
+
+func TestAdminUsageAnomalies(t *testing.T) {
+	t.Parallel()
+	h, _ := newAdminTestHandler(adminAuth{})
+
+	tests := []struct {
+		path     string
+		want     int
+		wantKeys []string
+	}{
+		{"/admin/v1/usage/anomalies", http.StatusOK, []string{"", "key-a"}},
+		{"/admin/v1/usage/anomalies?key_id=key-a", http.StatusOK, []string{"key-a"}},
+		{"/admin/v1/usage/anomalies?key_id=key-x", http.StatusOK, []string{}},
+		{"/admin/v1/usage/anomalies?org_id=other", http.StatusForbidden, nil},
+	}
+	for _, tt := range tests {
+		rec := adminRequest(h, http.MethodGet, tt.path, "")
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d; body = %s", tt.path, rec.Code, tt.want, rec.Body.String())
+			continue
+		}
+		if tt.wantKeys == nil {
+			continue
+		}
+		var resp struct {
+			Data []gateway.UsageAnomaly `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		keys := []string{}
+		for _, a := range resp.Data {
+			keys = append(keys, a.KeyID)
+		}
+		if !slices.Equal(keys, tt.wantKeys) {
+			t.Errorf("%s: keys = %q, want %q", tt.path, keys, tt.wantKeys)
+		}
+	}
+
+	// The endpoint is only mounted when anomaly detection runs.
+	rec := adminRequest(newTestHandlerWith(func(d *Deps) { d.Store = newAdminFakeStore() }), http.MethodGet, "/admin/v1/usage/anomalies", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("without Anomalies: status = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+// Audit target types.
+const (
+	auditProvider = "provider"
+	auditRoute    = "route"
+	auditKey      = "key"
+	auditTeam     = "team"
+	auditOrg      = "org"
+	auditConfig   = "config" // whole-configuration changes (restore)
+)
+
+// auditChange is one field's entry in an audit diff. Old is omitted for
+// fields that did not exist before (creates), New for fields that no
+// longer exist (deletes).
+type auditChange struct {
+	Old json.RawMessage `json:"old,omitempty"`
+	New json.RawMessage `json:"new,omitempty"`
+}
+
+// audit records an admin mutation by the caller. before and after are the
+// target's state around the change (nil for creates and deletes
+// respectively) and are diffed by their JSON fields, so anything tagged
+// json:"-" (key hashes, encrypted secrets) never reaches the log. The
+// change has already been applied, so a failed write is logged rather than
+// returned to the client.
+func (s *server) audit(r *http.Request, action, targetType, targetID string, before, after any) {
+	if s.deps.Audit == nil {
+		return
+	}
+	identity := gateway.IdentityFromContext(r.Context())
+	e := gateway.AuditEntry{
+		ID:         uuid.Must(uuid.NewV7()).String(),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Diff:       auditDiff(before, after),
+		CreatedAt:  time.Now(),
+	}
+	if identity != nil {
+		e.ActorKeyID = identity.KeyID
+		e.ActorSubject = identity.Subject
+		e.OrgID = identity.OrgID
+	}
+	if err := s.deps.Audit.InsertAudit(r.Context(), &e); err != nil {
+		slog.LogAttrs(r.Context(), slog.LevelError, "audit write failed",
+			slog.String("action", action),
+			slog.String("target_type", targetType),
+			slog.String("target_id", targetID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// auditDiff returns the top-level JSON fields that differ between before
+// and after, or nil when nothing changed.
+func auditDiff(before, after any) json.RawMessage {
+	old, cur := auditFields(before), auditFields(after)
+	diff := make(map[string]auditChange)
+	for k, v := range old {
+		if nv, ok := cur[k]; !ok || !bytes.Equal(v, nv) {
+			diff[k] = auditChange{Old: v, New: nv}
+		}
+	}
+	for k, v := range cur {
+		if _, ok := old[k]; !ok {
+			diff[k] = auditChange{New: v}
+		}
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(diff)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// auditFields splits v's JSON object encoding into its fields. nil and
+// values that do not encode to an object have none.
+func auditFields(v any) map[string]json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) != nil {
+		return nil
+	}
+	return fields
+}
+
+// handleListAudit returns audit entries by actors in the caller's org,
+// newest first, filtered by actor_key_id, target_type, target_id, and
+// since/until.
+func (s *server) handleListAudit(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := resolveOrgID(w, r)
+	if !ok {
+		return
+	}
+	since, until, ok := parseSinceUntil(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	offset, limit := parsePagination(r)
+	filter := gateway.AuditFilter{
+		OrgID:      orgID,
+		ActorKeyID: q.Get("actor_key_id"),
+		TargetType: q.Get("target_type"),
+		TargetID:   q.Get("target_id"),
+		Since:      since,
+		Until:      until,
+		Offset:     offset,
+		Limit:      limit,
+	}
+	entries, err := s.deps.Audit.QueryAudit(r.Context(), filter)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse("failed to query audit log"))
+		return
+	}
+	total, _ := s.deps.Audit.CountAudit(r.Context(), filter)
+	if entries == nil {
+		entries = []gateway.AuditEntry{}
+	}
+	writeJSON(w, http.StatusOK, listResponse{
+		Data:       entries,
+		Pagination: pagination{Offset: offset, Limit: limit, Total: total},
+	})
+}
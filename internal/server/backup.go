@@ -0,0 +1,105 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+// backupVersion is the current backup document format.
+const backupVersion = 1
+
+// maxBackupBody caps restore uploads (32 MB); backups carry every key and
+// route, so the regular admin body limit is too small.
+const maxBackupBody = 32 << 20
+
+// backupDocument is the signed envelope exchanged by the backup and restore
+// endpoints. Signature is the hex HMAC-SHA256 of the raw Data bytes under
+// Deps.BackupSigningKey.
+type backupDocument struct {
+	Version   int             `json:"version"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+	Signature string          `json:"signature"`
+}
+
+// backupMAC returns the HMAC-SHA256 of data.
+func backupMAC(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func (s *server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	b, err := s.deps.Backup.ExportBackup(r.Context())
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, backupDocument{
+		Version:   backupVersion,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+		Signature: hex.EncodeToString(backupMAC(s.deps.BackupSigningKey, data)),
+	})
+}
+
+func (s *server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	var doc backupDocument
+	r.Body = http.MaxBytesReader(w, r.Body, maxBackupBody)
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse("invalid request body"))
+		return
+	}
+	if doc.Version != backupVersion {
+		writeJSON(w, http.StatusBadRequest, errorResponse("unsupported backup version"))
+		return
+	}
+	sig, err := hex.DecodeString(doc.Signature)
+	if err != nil || !hmac.Equal(sig, backupMAC(s.deps.BackupSigningKey, doc.Data)) {
+		writeJSON(w, http.StatusBadRequest, errorResponse("invalid backup signature"))
+		return
+	}
+	var b gateway.Backup
+	if err := json.Unmarshal(doc.Data, &b); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse("invalid backup data"))
+		return
+	}
+
+	// Keys that exist now may be gone or changed after the restore; drop
+	// them from the auth cache along with the restored ones.
+	var stale []string
+	if s.deps.KeyInvalidator != nil {
+		if cur, err := s.deps.Backup.ExportBackup(r.Context()); err == nil {
+			for _, k := range cur.Keys {
+				stale = append(stale, k.ID)
+			}
+		}
+	}
+	if err := s.deps.Backup.RestoreBackup(r.Context(), &b); err != nil {
+		writeAdminError(w, r, err)
+		return
+	}
+	s.audit(r, "restore", auditConfig, "", nil, map[string]int{
+		"providers": len(b.Providers), "routes": len(b.Routes), "keys": len(b.Keys),
+	})
+	if s.deps.KeyInvalidator != nil {
+		for _, id := range stale {
+			s.deps.KeyInvalidator.InvalidateByKeyID(id)
+		}
+		for _, k := range b.Keys {
+			s.deps.KeyInvalidator.InvalidateByKeyID(k.ID)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/eugener/gandalf/internal/provider"
+)
+
+// HostResolver resolves provider base URL hosts for SSRF checks.
+// *net.Resolver satisfies it.
+type HostResolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// checkBaseURL rejects provider base URLs that point at the gateway's own
+// network: loopback, private, link-local, and unspecified addresses, either
+// literal or resolved. Hosts and addresses listed in
+// Deps.ProviderBaseURLAllowlist (hostnames, IPs, or CIDRs) are exempt, which
+// is how a local Ollama is permitted. An empty base URL uses the provider
+// default and passes. The check resolves the host once; clients built for
+// these providers must also use provider.DenyInternalDials so a host that
+// later rebinds to an internal address is refused at connect time.
+func (s *server) checkBaseURL(ctx context.Context, raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("base_url must be an absolute http or https URL")
+	}
+	host := strings.ToLower(u.Hostname())
+
+	allow := provider.ParseAddrAllowlist(s.deps.ProviderBaseURLAllowlist)
+	if allow.HasHost(host) {
+		return nil
+	}
+
+	var addrs []netip.Addr
+	if a, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{a}
+	} else {
+		var resolver HostResolver = net.DefaultResolver
+		if s.deps.Resolver != nil {
+			resolver = s.deps.Resolver
+		}
+		addrs, err = resolver.LookupNetIP(ctx, "ip", host)
+		if err != nil || len(addrs) == 0 {
+			return fmt.Errorf("base_url host %q does not resolve", host)
+		}
+	}
+
+	for _, a := range addrs {
+		if !allow.Allows(a) {
+			return fmt.Errorf("base_url host %q resolves to internal address %s; add it to server.provider_base_url_allowlist to permit it", host, a.Unmap())
+		}
+	}
+	return nil
+}
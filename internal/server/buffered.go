@@ -0,0 +1,215 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/app"
+)
+
+// wantsBufferedStream reports whether a stream:true request should be
+// answered with a single JSON response: either buffering is configured for
+// all streams, or the client sent X-Gandalf-Buffer-Stream: true. Accept is
+// deliberately ignored: OpenAI SDKs send Accept: application/json on
+// streaming calls too.
+func (s *server) wantsBufferedStream(r *http.Request) bool {
+	if s.deps.BufferStreams {
+		return true
+	}
+	v := r.Header[hdrBufferStream]
+	return len(v) > 0 && strings.EqualFold(v[0], "true")
+}
+
+// handleChatCompletionBuffered streams from the provider but consumes the
+// stream internally, replying with one aggregated chat.completion body.
+// Usage and finish_reason come from the stream itself, and stop sequences
+// are applied as for non-streaming responses.
+func (s *server) handleChatCompletionBuffered(w http.ResponseWriter, r *http.Request, req *gateway.ChatRequest, identity *gateway.Identity, meta usageMeta, estimated int64) {
+	start := time.Now()
+	ch, err := s.deps.Proxy.ChatCompletionStream(r.Context(), req)
+	if err != nil {
+		writeUpstreamError(w, r.Context(), err)
+		return
+	}
+	setSchemaViolationHeader(w, r.Context())
+
+	resp, ok := s.collectStream(w, r, req, identity, meta, estimated, start, ch)
+	if !ok {
+		return
+	}
+	s.finishStream(r, req, identity, &meta, estimated, resp.Usage, start, http.StatusOK)
+	s.setResponseMeta(r.Context(), resp)
+	attachDebug(r.Context(), resp)
+	setUsageHeaders(w, resp.Usage)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// collectStream drains ch into one aggregated response with stop sequences
+// and the output filter applied. On an upstream stream error it records
+// usage and writes a 502; on client disconnect it records canceled usage
+// and writes nothing. Either way it returns false.
+func (s *server) collectStream(w http.ResponseWriter, r *http.Request, req *gateway.ChatRequest, identity *gateway.Identity, meta usageMeta, estimated int64, start time.Time, ch <-chan gateway.StreamChunk) (*gateway.ChatResponse, bool) {
+	var agg streamAggregate
+	var usage *gateway.Usage
+	for done := false; !done; {
+		select {
+		case chunk, chOpen := <-ch:
+			switch {
+			case !chOpen:
+				done = true
+			case chunk.Err != nil:
+				slog.LogAttrs(r.Context(), slog.LevelError, "stream error",
+					slog.String("error", chunk.Err.Error()),
+				)
+				s.finishStream(r, req, identity, &meta, estimated, usage, start, http.StatusBadGateway)
+				writeJSON(w, http.StatusBadGateway, errorResponse("upstream stream error"))
+				return nil, false
+			default:
+				if chunk.Usage != nil {
+					usage = chunk.Usage
+				}
+				if chunk.Done {
+					done = true
+				} else {
+					agg.add(chunk.Data)
+				}
+			}
+		case <-r.Context().Done():
+			s.cancelStream(r, req, identity, &meta, estimated, usage, start)
+			return nil, false
+		}
+	}
+
+	if s.deps.RepairToolArguments {
+		agg.repairToolArguments()
+	}
+	resp := agg.response()
+	resp.Usage = usage
+	app.ApplyStopSequences(resp, req.Stop)
+	s.filterOutput(r.Context(), resp)
+	return resp, true
+}
+
+// streamAggregate folds OpenAI-format chat.completion.chunk payloads into a
+// single chat.completion response.
+type streamAggregate struct {
+	id, model, fingerprint string
+	created                int64
+	choices                []*aggChoice // by choice index
+}
+
+type aggChoice struct {
+	role, finishReason string
+	content            strings.Builder
+	toolCalls          []*aggToolCall // by tool call index
+}
+
+type aggToolCall struct {
+	id, typ, name string
+	arguments     strings.Builder
+}
+
+// add merges one chunk. Payloads that aren't JSON objects are ignored.
+func (a *streamAggregate) add(data []byte) {
+	root := gjson.ParseBytes(data)
+	if !root.IsObject() {
+		return
+	}
+	if v := root.Get("id").Str; v != "" {
+		a.id = v
+	}
+	if v := root.Get("model").Str; v != "" {
+		a.model = v
+	}
+	if v := root.Get("system_fingerprint").Str; v != "" {
+		a.fingerprint = v
+	}
+	if v := root.Get("created").Int(); v != 0 {
+		a.created = v
+	}
+	root.Get("choices").ForEach(func(_, c gjson.Result) bool {
+		choice := growTo(&a.choices, int(c.Get("index").Int()))
+		delta := c.Get("delta")
+		if v := delta.Get("role").Str; v != "" {
+			choice.role = v
+		}
+		choice.content.WriteString(delta.Get("content").Str)
+		delta.Get("tool_calls").ForEach(func(_, tc gjson.Result) bool {
+			call := growTo(&choice.toolCalls, int(tc.Get("index").Int()))
+			if v := tc.Get("id").Str; v != "" {
+				call.id = v
+			}
+			if v := tc.Get("type").Str; v != "" {
+				call.typ = v
+			}
+			if v := tc.Get("function.name").Str; v != "" {
+				call.name = v
+			}
+			call.arguments.WriteString(tc.Get("function.arguments").Str)
+			return true
+		})
+		if v := c.Get("finish_reason").Str; v != "" {
+			choice.finishReason = v
+		}
+		return true
+	})
+}
+
+// growTo returns (*s)[i], extending s with zero values as needed. Negative
+// indexes from malformed chunks map to 0.
+func growTo[T any](s *[]*T, i int) *T {
+	i = max(i, 0)
+	for len(*s) <= i {
+		*s = append(*s, new(T))
+	}
+	return (*s)[i]
+}
+
+// response builds the aggregated chat.completion.
+func (a *streamAggregate) response() *gateway.ChatResponse {
+	resp := &gateway.ChatResponse{
+		ID:                a.id,
+		Object:            "chat.completion",
+		Created:           a.created,
+		Model:             a.model,
+		SystemFingerprint: a.fingerprint,
+		Choices:           make([]gateway.Choice, len(a.choices)),
+	}
+	for i, c := range a.choices {
+		msg := gateway.Message{Role: c.role}
+		if msg.Role == "" {
+			msg.Role = "assistant"
+		}
+		if c.content.Len() > 0 || len(c.toolCalls) == 0 {
+			msg.Content, _ = json.Marshal(c.content.String())
+		} else {
+			msg.Content = json.RawMessage("null")
+		}
+		if len(c.toolCalls) > 0 {
+			calls := make([]map[string]any, len(c.toolCalls))
+			for j, tc := range c.toolCalls {
+				typ := tc.typ
+				if typ == "" {
+					typ = "function"
+				}
+				calls[j] = map[string]any{
+					"id":   tc.id,
+					"type": typ,
+					"function": map[string]any{
+						"name":      tc.name,
+						"arguments": tc.arguments.String(),
+					},
+				}
+			}
+			msg.ToolCalls, _ = json.Marshal(calls)
+		}
+		resp.Choices[i] = gateway.Choice{Index: i, Message: msg, FinishReason: c.finishReason}
+	}
+	return resp
+}
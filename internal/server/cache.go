@@ -42,9 +42,23 @@ func isCacheable(req *gateway.ChatRequest) bool {
 // cacheKey produces a deterministic SHA-256 hash for a ChatRequest,
 // scoped to the caller's API key to prevent cross-user response leakage.
 func cacheKey(keyID string, req *gateway.ChatRequest) string {
+	return scopedCacheKey(keyID, requestFingerprint(req))
+}
+
+// scopedCacheKey derives the cache key for a request fingerprint as seen
+// by keyID.
+func scopedCacheKey(keyID, fingerprint string) string {
+	h := sha256.Sum256([]byte(keyID + "\x00" + fingerprint))
+	return hex.EncodeToString(h[:])
+}
+
+// requestFingerprint returns a hex SHA-256 of the semantic request: model,
+// normalized messages, and the sampling and tool parameters. Transport
+// details (stream, user, headers) are left out, so the same question asked
+// streaming and non-streaming, or by different keys, fingerprints the same.
+func requestFingerprint(req *gateway.ChatRequest) string {
 	// Build a normalized map for stable JSON output.
 	m := map[string]any{
-		"key_id":   keyID,
 		"model":    req.Model,
 		"messages": normalizeMessages(req.Messages),
 	}
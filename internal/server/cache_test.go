@@ -1,6 +1,9 @@
 package server
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	gateway "github.com/eugener/gandalf/internal"
@@ -104,6 +107,61 @@ func TestCacheKey_DifferentKeys(t *testing.T) {
 	}
 }
 
+func TestRequestFingerprintHeader(t *testing.T) {
+	t.Parallel()
+	h := newTestHandlerWith(func(d *Deps) { d.RequestFingerprint = true })
+
+	// Off by default.
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`))
+	req.Header.Set("Authorization", "Bearer gnd_test")
+	rec := httptest.NewRecorder()
+	newTestHandler().ServeHTTP(rec, req)
+	if fp := rec.Header().Get(hdrRequestFingerprint); fp != "" {
+		t.Errorf("default fingerprint header = %q, want none", fp)
+	}
+
+	fingerprint := func(body string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer gnd_test")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+		}
+		fp := rec.Header().Get(hdrRequestFingerprint)
+		if len(fp) != 64 {
+			t.Fatalf("fingerprint = %q, want 64 hex chars", fp)
+		}
+		return fp
+	}
+
+	base := fingerprint(`{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}],"temperature":0.2}`)
+	same := []string{
+		// Field order, whitespace, and user do not change the semantics.
+		`{"temperature":0.2, "messages":[ {"content":"hello", "role":"user"} ], "model":"gpt-4o","user":"u-1"}`,
+		`{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}],"temperature":0.20000001}`,
+	}
+	for _, body := range same {
+		if got := fingerprint(body); got != base {
+			t.Errorf("fingerprint(%s) = %s, want %s", body, got, base)
+		}
+	}
+	different := []string{
+		`{"model":"gpt-4o","messages":[{"role":"user","content":"hello!"}],"temperature":0.2}`,
+		`{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}],"temperature":0.7}`,
+		`{"model":"gpt-4o-mini","messages":[{"role":"user","content":"hello"}],"temperature":0.2}`,
+		`{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}],"temperature":0.2,"max_tokens":10}`,
+	}
+	for _, body := range different {
+		if got := fingerprint(body); got == base {
+			t.Errorf("fingerprint(%s) = base fingerprint, want a different one", body)
+		}
+	}
+}
+
 func TestIsCacheable(t *testing.T) {
 	t.Parallel()
 	lowTemp := 0.1
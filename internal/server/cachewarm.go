@@ -0,0 +1,133 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+// maxCacheWarmBatch caps the number of requests in one warm call; each one
+// is a real upstream completion.
+const maxCacheWarmBatch = 50
+
+// Cache warm outcomes, one per request.
+const (
+	warmStored  = "stored"  // fetched from the provider and cached
+	warmCached  = "cached"  // already in the cache; nothing sent upstream
+	warmSkipped = "skipped" // not cacheable (stream, n > 1, high temperature without seed, or non-stop finish on a cache_stop_only route)
+	warmFailed  = "failed"  // provider error; nothing cached
+)
+
+// cacheWarmRequest is the body of POST /admin/v1/cache/warm. Cache entries
+// are scoped per API key, so KeyID selects whose cache to warm; it must
+// belong to the caller's org and defaults to the caller's own key.
+type cacheWarmRequest struct {
+	KeyID    string                `json:"key_id,omitempty"`
+	Requests []gateway.ChatRequest `json:"requests"`
+}
+
+type cacheWarmResult struct {
+	Model  string `json:"model"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type cacheWarmResponse struct {
+	Results []cacheWarmResult `json:"results"`
+}
+
+// handleCacheWarm issues each request through the proxy and stores the
+// response under the same key a client request would hit. Route defaults
+// are applied first so a route's default temperature keys the same way.
+// Upstream usage is recorded against the caller.
+func (s *server) handleCacheWarm(w http.ResponseWriter, r *http.Request) {
+	var body cacheWarmRequest
+	if !decodeRequestBody(w, r, &body) {
+		return
+	}
+	switch n := len(body.Requests); {
+	case n == 0:
+		writeJSON(w, http.StatusBadRequest, errorResponse("requests is required"))
+		return
+	case n > maxCacheWarmBatch:
+		writeJSON(w, http.StatusBadRequest, errorResponse(fmt.Sprintf("at most %d requests per batch", maxCacheWarmBatch)))
+		return
+	}
+
+	identity := gateway.IdentityFromContext(r.Context())
+	for i := range body.Requests {
+		if s.missingUser(identity, body.Requests[i].User) {
+			writeJSON(w, http.StatusBadRequest, errorResponse(fmt.Sprintf("requests[%d]: user is required", i)))
+			return
+		}
+	}
+	keyID := identity.KeyID
+	if body.KeyID != "" && body.KeyID != keyID {
+		key, err := s.deps.Store.GetKey(r.Context(), body.KeyID)
+		if err != nil {
+			writeAdminError(w, r, err)
+			return
+		}
+		if key.OrgID != identity.OrgID {
+			writeJSON(w, http.StatusNotFound, errorResponse("not found"))
+			return
+		}
+		keyID = key.ID
+	}
+
+	results := make([]cacheWarmResult, len(body.Requests))
+	for i := range body.Requests {
+		req := &body.Requests[i]
+		results[i] = s.warmOne(r, identity, keyID, req)
+	}
+	writeJSON(w, http.StatusOK, cacheWarmResponse{Results: results})
+}
+
+// warmOne fetches and caches a single request for keyID.
+func (s *server) warmOne(r *http.Request, identity *gateway.Identity, keyID string, req *gateway.ChatRequest) cacheWarmResult {
+	res := cacheWarmResult{Model: req.Model}
+	s.applyRouteDefaults(r.Context(), req)
+	if !isCacheable(req) {
+		res.Status = warmSkipped
+		return res
+	}
+	key := cacheKey(keyID, req)
+	if _, ok := s.deps.Cache.Get(r.Context(), key); ok {
+		res.Status = warmCached
+		return res
+	}
+
+	start := time.Now()
+	resp, err := s.deps.Proxy.ChatCompletion(r.Context(), req)
+	elapsed := time.Since(start)
+	if err != nil {
+		// Same sanitizing as writeUpstreamError: log the detail, report the status.
+		status := errorStatus(err)
+		slog.LogAttrs(r.Context(), slog.LevelError, "cache warm upstream error",
+			slog.String("model", req.Model),
+			slog.Int("status", status),
+			slog.String("error", err.Error()),
+		)
+		res.Status, res.Error = warmFailed, upstreamErrorMessage(err, status)
+		s.recordUsage(r, identity, requestUsageMeta(r, req.User), req.Model, nil, elapsed, status, false)
+		return res
+	}
+	s.recordUsage(r, identity, requestUsageMeta(r, req.User), req.Model, resp.Usage, elapsed, http.StatusOK, false)
+	s.filterOutput(r.Context(), resp)
+	if !s.cacheableResponse(r.Context(), req, resp) {
+		res.Status = warmSkipped
+		return res
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		res.Status, res.Error = warmFailed, err.Error()
+		return res
+	}
+	s.deps.Cache.Set(r.Context(), key, data, s.cacheTTL(r.Context(), req))
+	res.Status = warmStored
+	return res
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/app"
+)
+
+// canDowngradeStream reports whether a failed stream request may be retried
+// without streaming: downgrading is enabled, the failure is a provider error
+// (not a client error or a missing route), and the client is still waiting.
+func (s *server) canDowngradeStream(ctx context.Context, err error) bool {
+	return s.deps.StreamDowngrade && ctx.Err() == nil && errors.Is(err, gateway.ErrProviderError)
+}
+
+// handleStreamDowngrade answers a stream request whose streaming attempts
+// all failed before anything was sent. It makes a non-streaming call, with
+// the usual failover, and replays the response to the client as SSE.
+func (s *server) handleStreamDowngrade(w http.ResponseWriter, r *http.Request, req *gateway.ChatRequest, identity *gateway.Identity, meta usageMeta, estimated int64, start time.Time, streamErr error) {
+	slog.LogAttrs(r.Context(), slog.LevelWarn, "stream failed before first byte, retrying without streaming",
+		slog.String("error", streamErr.Error()),
+	)
+	streamOpts := req.StreamOptions
+	req.Stream, req.StreamOptions = false, nil
+	resp, err := s.deps.Proxy.ChatCompletion(r.Context(), req)
+	req.Stream, req.StreamOptions = true, streamOpts
+	if err != nil {
+		writeUpstreamError(w, r.Context(), err)
+		return
+	}
+	s.filterOutput(r.Context(), resp)
+	setSchemaViolationHeader(w, r.Context())
+
+	writeSSEHeaders(w)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		slog.Error("ResponseWriter does not implement http.Flusher")
+		return
+	}
+	for _, data := range app.ResponseChunks(resp, streamOpts != nil && streamOpts.IncludeUsage) {
+		writeSSEData(w, data)
+	}
+	flusher.Flush()
+	meta.ttfb = time.Since(start)
+	s.endStream(w, resp.Usage, nil)
+	flusher.Flush()
+	s.finishStream(r, req, identity, &meta, estimated, resp.Usage, start, http.StatusOK)
+}
@@ -14,16 +14,30 @@ func (s *server) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Model allowlist check.
 	identity := gateway.IdentityFromContext(r.Context())
+	if !defaultModel(w, identity, &req.Model) {
+		return
+	}
+
+	// Model allowlist check.
 	if identity != nil && !identity.IsModelAllowed(req.Model) {
 		writeJSON(w, http.StatusForbidden, errorResponse("model not allowed"))
 		return
 	}
+	if s.modelBlocked(r.Context(), req.Model) {
+		writeJSON(w, http.StatusForbidden, errorResponse("model not allowed"))
+		return
+	}
+	if !s.requireUser(w, identity, req.User) {
+		return
+	}
+	if !s.checkTokenBudget(w, r, identity, req.Model) {
+		return
+	}
 
 	// TPM rate limit for embeddings (rough estimate).
 	estimated := int64(100)
-	if !s.consumeTPM(w, identity, estimated) {
+	if !s.consumeTPM(w, r, identity, req.Model, estimated) {
 		return
 	}
 
@@ -36,7 +50,7 @@ func (s *server) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.adjustTPM(identity, estimated, resp.Usage)
-	s.recordUsage(r, identity, req.Model, resp.Usage, elapsed, http.StatusOK, false)
+	s.recordUsage(r, identity, requestUsageMeta(r, req.User), req.Model, resp.Usage, elapsed, http.StatusOK, false)
 
 	writeJSON(w, http.StatusOK, resp)
 }
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/app"
+)
+
+// logRejection records a 429 rejection by the gateway's own limits in the
+// recent-errors log. model is "" when the request body hasn't been read.
+func (s *server) logRejection(ctx context.Context, model, reason string) {
+	if s.deps.ErrorLog == nil {
+		return
+	}
+	s.deps.ErrorLog.Add(ctx, app.ErrorEvent{
+		Kind:    app.ErrorKindRateLimited,
+		Model:   model,
+		Status:  http.StatusTooManyRequests,
+		Message: reason,
+	})
+}
+
+// handleRecentErrors returns the newest error events, up to ?limit=N
+// (default 50). Only events from the caller's org are returned unless the
+// caller has manage_all_orgs.
+func (s *server) handleRecentErrors(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 50
+	}
+	var orgID string
+	if identity := gateway.IdentityFromContext(r.Context()); !identity.Can(gateway.PermManageAllOrgs) {
+		orgID = identity.OrgID
+	}
+	events := s.deps.ErrorLog.RecentForOrg(orgID, limit)
+	writeJSON(w, http.StatusOK, listResponse{
+		Data:       events,
+		Pagination: pagination{Offset: 0, Limit: len(events), Total: len(events)},
+	})
+}
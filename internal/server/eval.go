@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+// Eval export limits: captures carry full content, so a single export is
+// bounded. Page through larger datasets with since.
+const (
+	defaultEvalExportLimit = 1000
+	maxEvalExportLimit     = 10000
+)
+
+// handleEvalExport streams the caller's org's eval captures as JSON Lines,
+// oldest first, one gateway.EvalCapture per line, filtered by label, model,
+// and since/until.
+func (s *server) handleEvalExport(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := resolveOrgID(w, r)
+	if !ok {
+		return
+	}
+	since, until, ok := parseSinceUntil(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 {
+		limit = defaultEvalExportLimit
+	}
+	limit = min(limit, maxEvalExportLimit)
+	captures, err := s.deps.Evals.ListEvalCaptures(r.Context(), gateway.EvalCaptureFilter{
+		OrgID: orgID,
+		Label: q.Get("label"),
+		Model: q.Get("model"),
+		Since: since,
+		Until: until,
+		Limit: limit,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse("failed to query eval captures"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	for i := range captures {
+		if err := enc.Encode(&captures[i]); err != nil {
+			slog.LogAttrs(r.Context(), slog.LevelWarn, "eval export write failed",
+				slog.String("error", err.Error()),
+			)
+			return
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// NewGRPCHealthServer returns a gRPC server exposing only the standard
+// grpc.health.v1 Health service, backed by the same ReadyChecker as /readyz.
+// Only the overall server status (empty service name) is known; other
+// service names return NOT_FOUND as the protocol requires.
+// A nil check always reports SERVING.
+func NewGRPCHealthServer(check ReadyChecker) *grpc.Server {
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, &grpcHealth{check: check})
+	return srv
+}
+
+// grpcHealth implements healthpb.HealthServer by probing ReadyChecker on
+// every call, so status always reflects current DB reachability.
+// Watch is left unimplemented; probes (grpc_health_probe, kubelet) use Check.
+type grpcHealth struct {
+	healthpb.UnimplementedHealthServer
+	check ReadyChecker
+}
+
+func (h *grpcHealth) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if req.GetService() != "" {
+		return nil, status.Error(codes.NotFound, "unknown service")
+	}
+	return &healthpb.HealthCheckResponse{Status: h.status(ctx)}, nil
+}
+
+func (h *grpcHealth) List(ctx context.Context, _ *healthpb.HealthListRequest) (*healthpb.HealthListResponse, error) {
+	return &healthpb.HealthListResponse{
+		Statuses: map[string]*healthpb.HealthCheckResponse{
+			"": {Status: h.status(ctx)},
+		},
+	}, nil
+}
+
+func (h *grpcHealth) status(ctx context.Context) healthpb.HealthCheckResponse_ServingStatus {
+	if h.check != nil {
+		if err := h.check(ctx); err != nil {
+			return healthpb.HealthCheckResponse_NOT_SERVING
+		}
+	}
+	return healthpb.HealthCheckResponse_SERVING
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dialGRPCHealth starts a health server on an in-memory listener and
+// returns a connected client.
+func dialGRPCHealth(t *testing.T, check ReadyChecker) healthpb.HealthClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 16)
+	srv := NewGRPCHealthServer(check)
+	go srv.Serve(lis) //nolint:errcheck // returns on Stop
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestGRPCHealth(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		check ReadyChecker
+		want  healthpb.HealthCheckResponse_ServingStatus
+	}{
+		{"db up", func(context.Context) error { return nil }, healthpb.HealthCheckResponse_SERVING},
+		{"db down", func(context.Context) error { return errors.New("db down") }, healthpb.HealthCheckResponse_NOT_SERVING},
+		{"nil check", nil, healthpb.HealthCheckResponse_SERVING},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			client := dialGRPCHealth(t, tt.check)
+
+			resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+			if err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+			if resp.GetStatus() != tt.want {
+				t.Errorf("status = %v, want %v", resp.GetStatus(), tt.want)
+			}
+		})
+	}
+}
+
+func TestGRPCHealth_UnknownService(t *testing.T) {
+	t.Parallel()
+	client := dialGRPCHealth(t, nil)
+
+	_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "other"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("code = %v, want NotFound", status.Code(err))
+	}
+}
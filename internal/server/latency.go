@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+	"time"
+)
+
+// providerLatency is one provider's entry in /admin/v1/providers/latency.
+type providerLatency struct {
+	Provider string  `json:"provider"`
+	Samples  int     `json:"samples"`
+	P50Ms    float64 `json:"p50_ms"`
+	P95Ms    float64 `json:"p95_ms"`
+	P99Ms    float64 `json:"p99_ms"`
+}
+
+// handleProviderLatency returns p50/p95/p99 upstream latency per provider
+// over the recent-calls window.
+func (s *server) handleProviderLatency(w http.ResponseWriter, r *http.Request) {
+	stats := s.deps.LatencyStats.Snapshot()
+	data := make([]providerLatency, len(stats))
+	for i, p := range stats {
+		data[i] = providerLatency{
+			Provider: p.Provider,
+			Samples:  p.Samples,
+			P50Ms:    millis(p.P50),
+			P95Ms:    millis(p.P95),
+			P99Ms:    millis(p.P99),
+		}
+	}
+	writeJSON(w, http.StatusOK, listResponse{
+		Data:       data,
+		Pagination: pagination{Offset: 0, Limit: len(data), Total: len(data)},
+	})
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -1,7 +1,11 @@
 package server
 
 import (
+	"context"
 	"log/slog"
+	"math"
+	"math/rand/v2"
+	"mime"
 	"net/http"
 	"strconv"
 	"sync"
@@ -21,7 +25,21 @@ const (
 	hdrRemainingRequests    = "X-Ratelimit-Remaining-Requests"
 	hdrRateLimitTokens      = "X-Ratelimit-Limit-Tokens"
 	hdrRemainingTokens      = "X-Ratelimit-Remaining-Tokens"
+	hdrResetRequests        = "X-Ratelimit-Reset-Requests"
+	hdrResetTokens          = "X-Ratelimit-Reset-Tokens"
 	hdrRetryAfter           = "Retry-After"
+	hdrDeadline             = "X-Gandalf-Deadline"
+	hdrPriority             = "X-Gandalf-Priority"
+	hdrDebug                = "X-Gandalf-Debug"
+	hdrRequire              = "X-Gandalf-Require"
+	hdrPromptTokens         = "X-Gandalf-Prompt-Tokens"
+	hdrCompletionTokens     = "X-Gandalf-Completion-Tokens"
+	hdrTotalTokens          = "X-Gandalf-Total-Tokens"
+	hdrSchemaViolation      = "X-Gandalf-Schema-Violation"
+	hdrRequestFingerprint   = "X-Gandalf-Request-Fingerprint"
+	hdrBufferStream         = "X-Gandalf-Buffer-Stream"
+	hdrAnthropicBeta        = "X-Anthropic-Beta"
+	hdrOpenAIBeta           = "X-OpenAI-Beta"
 	maxRequestIDLen         = 128
 )
 
@@ -107,7 +125,10 @@ func isValidToken(s string, maxLen int) bool {
 // isValidRequestID checks that s is a valid request ID (max 128 chars, [a-zA-Z0-9._-]).
 func isValidRequestID(s string) bool { return isValidToken(s, maxRequestIDLen) }
 
-// logging logs each request with method, path, status, and duration.
+// logging logs each request with method, path, status, and duration, sampling
+// successful requests at Deps.LogSampleRate. Requests slower than
+// Deps.SlowRequestThreshold also get a separate "slow request" warning
+// carrying the serving provider and model.
 func (s *server) logging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -118,18 +139,111 @@ func (s *server) logging(next http.Handler) http.Handler {
 		next.ServeHTTP(sw, r)
 		// LogAttrs with typed slog.String/Int/Int64 keeps attrs as stack values,
 		// saving ~5 allocs/req vs slog.Info which boxes every key+value into any.
-		slog.LogAttrs(r.Context(), slog.LevelInfo, "request",
-			slog.String("method", r.Method),
-			slog.String("path", r.URL.Path),
-			slog.Int("status", sw.status),
-			slog.Int64("duration_ms", time.Since(start).Milliseconds()),
-			slog.String("request_id", gateway.RequestIDFromContext(r.Context())),
-		)
+		elapsed := time.Since(start)
+		if sw.status >= http.StatusBadRequest || s.sampleLog() {
+			// A slog.Record holds 5 attrs inline; the fingerprint is only
+			// appended when set, so the common line stays allocation-free.
+			attrs := [...]slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", sw.status),
+				slog.Int64("duration_ms", elapsed.Milliseconds()),
+				slog.String("request_id", gateway.RequestIDFromContext(r.Context())),
+				{},
+			}
+			n := len(attrs) - 1
+			if fp := gateway.RequestFingerprintFromContext(r.Context()); fp != "" {
+				attrs[n] = slog.String("fingerprint", fp)
+				n++
+			}
+			slog.LogAttrs(r.Context(), slog.LevelInfo, "request", attrs[:n]...)
+		}
+		if s.deps.SlowRequestThreshold > 0 && elapsed > s.deps.SlowRequestThreshold {
+			provider, model := gateway.RequestTargetFromContext(r.Context())
+			slog.LogAttrs(r.Context(), slog.LevelWarn, "slow request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", sw.status),
+				slog.String("provider", provider),
+				slog.String("model", model),
+				slog.Int64("duration_ms", elapsed.Milliseconds()),
+				slog.Int64("threshold_ms", s.deps.SlowRequestThreshold.Milliseconds()),
+				slog.String("request_id", gateway.RequestIDFromContext(r.Context())),
+				slog.String("fingerprint", gateway.RequestFingerprintFromContext(r.Context())),
+			)
+		}
 		sw.ResponseWriter = nil
 		statusWriterPool.Put(sw)
 	})
 }
 
+// sampleLog reports whether a successful request's access log line is kept.
+func (s *server) sampleLog() bool {
+	rate := s.deps.LogSampleRate
+	return rate <= 0 || rate >= 1 || rand.Float64() < rate
+}
+
+// clientDeadline applies the X-Gandalf-Deadline header to the request
+// context so upstream work is abandoned once the client has given up. The
+// value is either a relative duration ("30s") or an absolute RFC3339 time,
+// clamped to Deps.MaxDeadline. A deadline that has already passed is
+// rejected with 504 without doing any work.
+func (s *server) clientDeadline(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vals := r.Header[hdrDeadline]
+		if len(vals) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		now := time.Now()
+		deadline, ok := parseDeadline(vals[0], now)
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, errorResponse("invalid "+hdrDeadline+" header"))
+			return
+		}
+		if s.deps.MaxDeadline > 0 {
+			if limit := now.Add(s.deps.MaxDeadline); deadline.After(limit) {
+				deadline = limit
+			}
+		}
+		if !deadline.After(now) {
+			writeJSON(w, http.StatusGatewayTimeout, errorResponse("deadline exceeded"))
+			return
+		}
+		ctx, cancel := context.WithDeadline(r.Context(), deadline)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// parseDeadline interprets v as a relative duration or an RFC3339 timestamp.
+func parseDeadline(v string, now time.Time) (time.Time, bool) {
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(d), true
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// requireJSON rejects request bodies whose Content-Type is not
+// application/json with 415. Parameters such as charset are allowed, and
+// bodyless requests pass through. Mounted on the universal API when
+// Deps.StrictContentType is set.
+func (s *server) requireJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength != 0 {
+			mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mt != "application/json" {
+				writeJSON(w, http.StatusUnsupportedMediaType, errorResponse("Content-Type must be application/json"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // authenticate validates credentials and injects Identity into context.
 // When requestMeta already exists in context (set by requestID middleware),
 // the identity is stored by mutation -- no new context or request copy needed.
@@ -203,42 +317,142 @@ func (s *server) rateLimit(next http.Handler) http.Handler {
 		// Quota check.
 		if s.deps.Quota != nil && identity.MaxBudget > 0 {
 			if !s.deps.Quota.Check(identity.KeyID, identity.MaxBudget) {
+				s.logRejection(r.Context(), "", "quota exceeded")
 				writeJSON(w, http.StatusTooManyRequests, errorResponse("quota exceeded"))
 				return
 			}
 		}
 
-		// RPM check.
-		if s.deps.RateLimiter == nil {
-			next.ServeHTTP(w, r)
-			return
+		// RPM check. A pool fallback charges the request to a pool member.
+		if s.deps.RateLimiter != nil {
+			var ok bool
+			if r, ok = s.allowRPM(w, r, identity); !ok {
+				return
+			}
+			identity = gateway.IdentityFromContext(r.Context())
 		}
-		// Fall back to config-level defaults so keys without explicit limits
-		// still get rate-limited when global defaults are configured.
-		limits := ratelimit.Limits{RPM: identity.RPMLimit, TPM: identity.TPMLimit}
+
+		// Request-count quota check, after RPM so a request RPM rejects is
+		// never weighed against it. The request is counted when its usage is
+		// recorded.
+		if billed := identity.Billed(); s.deps.RequestQuota != nil && billed.MaxRequests > 0 {
+			period := ratelimit.BudgetPeriod(billed.RequestPeriod)
+			if !s.deps.RequestQuota.Check(r.Context(), billed.KeyID, billed.MaxRequests, period) {
+				s.logRejection(r.Context(), "", "request quota exceeded")
+				if end := period.End(time.Now()); !end.IsZero() {
+					w.Header()[hdrRetryAfter] = []string{strconv.Itoa(int(time.Until(end).Seconds()) + 1)}
+				}
+				writeJSON(w, http.StatusTooManyRequests, errorResponse("request quota exceeded"))
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowRPM takes an RPM token for identity, falling back to a pool member
+// with RPM to spare; r then carries a copy of identity with the member as
+// PoolKey. It writes the rate-limit headers, and the 429 when no key has room.
+func (s *server) allowRPM(w http.ResponseWriter, r *http.Request, identity *gateway.Identity) (*http.Request, bool) {
+	// Fall back to config-level defaults so keys without explicit limits
+	// still get rate-limited when global defaults are configured.
+	limits := ratelimit.Limits{RPM: identity.RPMLimit, TPM: identity.TPMLimit}
+	if limits.RPM == 0 {
+		limits.RPM = s.deps.DefaultRPM
+	}
+	if limits.TPM == 0 {
+		limits.TPM = s.deps.DefaultTPM
+	}
+	if limits.RPM == 0 && limits.TPM == 0 {
+		return r, true
+	}
+
+	limiter := s.deps.RateLimiter.GetOrCreate(identity.KeyID, limits)
+	result := limiter.AllowRPM()
+	if !result.Allowed && len(identity.PoolMembers) > 0 {
+		if member, memberResult, ok := s.poolMember(r, identity); ok {
+			slog.LogAttrs(r.Context(), slog.LevelDebug, "rpm limit exceeded, using pool key",
+				slog.String("key_id", identity.KeyID),
+				slog.String("pool_key_id", member.KeyID),
+			)
+			pooled := *identity
+			pooled.PoolKey = member
+			r = r.WithContext(gateway.ContextWithIdentity(r.Context(), &pooled))
+			result = memberResult
+		}
+	}
+	setRPMHeaders(w, result)
+
+	if !result.Allowed {
+		if s.deps.Metrics != nil {
+			s.deps.Metrics.RateLimitRejects.WithLabelValues("rpm").Inc()
+		}
+		s.logRejection(r.Context(), "", "rpm limit exceeded")
+		writeRateLimitError(w, result)
+		return r, false
+	}
+	return r, true
+}
+
+// poolMember finds a key in identity's pool with RPM to spare, for a
+// request identity itself is rate-limited on. Members over their budget or
+// request quota are skipped. The request keeps the caller's permissions,
+// models, stream limit, and ownership; only its TPM, quotas, and usage are
+// charged to the member.
+func (s *server) poolMember(r *http.Request, identity *gateway.Identity) (*gateway.Identity, ratelimit.Result, bool) {
+	for _, m := range identity.PoolMembers {
+		if s.deps.Quota != nil && m.MaxBudget > 0 && !s.deps.Quota.Check(m.KeyID, m.MaxBudget) {
+			continue
+		}
+		limits := ratelimit.Limits{RPM: m.RPMLimit, TPM: m.TPMLimit}
 		if limits.RPM == 0 {
 			limits.RPM = s.deps.DefaultRPM
 		}
 		if limits.TPM == 0 {
 			limits.TPM = s.deps.DefaultTPM
 		}
-		if limits.RPM == 0 && limits.TPM == 0 {
-			next.ServeHTTP(w, r)
-			return
+		result := ratelimit.Result{Allowed: true}
+		if limits.RPM > 0 || limits.TPM > 0 {
+			result = s.deps.RateLimiter.GetOrCreate(m.KeyID, limits).AllowRPM()
+			if !result.Allowed {
+				continue
+			}
 		}
+		if s.deps.RequestQuota != nil && m.MaxRequests > 0 &&
+			!s.deps.RequestQuota.Check(r.Context(), m.KeyID, m.MaxRequests, ratelimit.BudgetPeriod(m.RequestPeriod)) {
+			continue
+		}
+		return m, result, true
+	}
+	return nil, ratelimit.Result{}, false
+}
 
-		limiter := s.deps.RateLimiter.GetOrCreate(identity.KeyID, limits)
-		result := limiter.AllowRPM()
-		setRPMHeaders(w, result)
-
-		if !result.Allowed {
-			if s.deps.Metrics != nil {
-				s.deps.Metrics.RateLimitRejects.WithLabelValues("rpm").Inc()
-			}
-			writeRateLimitError(w, result)
+// limitConcurrency holds a global concurrency slot for the duration of the
+// request. When all slots are busy the request queues, and X-Gandalf-Priority
+// (high, normal, low) decides who is admitted first, capped at the key's
+// max_priority (normal unless granted). A request that gives up waiting
+// (client gone or deadline hit) gets 503.
+func (s *server) limitConcurrency(next http.Handler) http.Handler {
+	if s.deps.Concurrency == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prio, ok := ratelimit.ParsePriority(r.Header.Get(hdrPriority))
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, errorResponse("invalid "+hdrPriority+" header"))
 			return
 		}
-
+		maxPrio := ratelimit.PriorityNormal
+		if id := gateway.IdentityFromContext(r.Context()); id != nil {
+			maxPrio, _ = ratelimit.ParsePriority(id.MaxPriority)
+		}
+		prio = min(prio, maxPrio)
+		if err := s.deps.Concurrency.Acquire(r.Context(), prio); err != nil {
+			writeJSON(w, http.StatusServiceUnavailable, errorResponse("server busy"))
+			return
+		}
+		defer s.deps.Concurrency.Release()
 		next.ServeHTTP(w, r)
 	})
 }
@@ -251,6 +465,7 @@ func setRPMHeaders(w http.ResponseWriter, r ratelimit.Result) {
 	h := w.Header()
 	h[hdrRateLimitRequests] = []string{strconv.FormatInt(r.Limit, 10)}
 	h[hdrRemainingRequests] = []string{strconv.FormatInt(r.Remaining, 10)}
+	h[hdrResetRequests] = []string{formatReset(r.ResetSeconds)}
 }
 
 // setTPMHeaders sets TPM rate limit headers on the response.
@@ -261,6 +476,13 @@ func setTPMHeaders(w http.ResponseWriter, r ratelimit.Result) {
 	h := w.Header()
 	h[hdrRateLimitTokens] = []string{strconv.FormatInt(r.Limit, 10)}
 	h[hdrRemainingTokens] = []string{strconv.FormatInt(r.Remaining, 10)}
+	h[hdrResetTokens] = []string{formatReset(r.ResetSeconds)}
+}
+
+// formatReset renders seconds until a bucket refills, rounded up to whole
+// seconds like Retry-After; "0" when it is already full.
+func formatReset(seconds float64) string {
+	return strconv.Itoa(int(math.Ceil(seconds)))
 }
 
 // tracingMiddleware creates a span for each HTTP request.
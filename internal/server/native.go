@@ -5,6 +5,8 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/tidwall/gjson"
@@ -29,6 +31,7 @@ func (s *server) mountNativeRoutes(r chi.Router) {
 		r.Use(normalizeAuth("X-Api-Key"))
 		r.Use(s.authenticate)
 		r.Use(s.rateLimit)
+		r.Use(s.limitConcurrency)
 		r.Post("/v1/messages", s.handleNativeProxy(
 			"anthropic",
 			func(_ *http.Request) string { return "/messages" },
@@ -43,6 +46,7 @@ func (s *server) mountNativeRoutes(r chi.Router) {
 		r.Use(normalizeAuth("X-Goog-Api-Key"))
 		r.Use(s.authenticate)
 		r.Use(s.rateLimit)
+		r.Use(s.limitConcurrency)
 
 		// generateContent, streamGenerateContent, embedContent
 		r.Post("/v1beta/models/{model}:{action}", s.handleNativeProxy(
@@ -69,6 +73,7 @@ func (s *server) mountNativeRoutes(r chi.Router) {
 		r.Use(normalizeAuth("Api-Key"))
 		r.Use(s.authenticate)
 		r.Use(s.rateLimit)
+		r.Use(s.limitConcurrency)
 
 		r.Post("/openai/deployments/{deployment}/chat/completions", s.handleNativeProxy(
 			"openai",
@@ -98,6 +103,7 @@ func (s *server) mountNativeRoutes(r chi.Router) {
 	r.Group(func(r chi.Router) {
 		r.Use(s.authenticate)
 		r.Use(s.rateLimit)
+		r.Use(s.limitConcurrency)
 
 		r.Post("/api/chat", s.handleNativeProxy(
 			"ollama",
@@ -131,7 +137,7 @@ func (s *server) handleNativeProxy(providerType string,
 		buf.Reset()
 		if _, err := buf.ReadFrom(r.Body); err != nil {
 			bodyPool.Put(buf)
-			writeJSON(w, http.StatusBadRequest, errorResponse("failed to read request body"))
+			writeNativeError(w, providerType, http.StatusBadRequest, "failed to read request body")
 			return
 		}
 		body := bytes.Clone(buf.Bytes())
@@ -139,21 +145,49 @@ func (s *server) handleNativeProxy(providerType string,
 
 		model := modelFunc(r, body)
 		if model == "" {
-			writeJSON(w, http.StatusBadRequest, errorResponse("model not specified"))
+			writeNativeError(w, providerType, http.StatusBadRequest, "model not specified")
 			return
 		}
 
 		// Model allowlist check.
 		identity := gateway.IdentityFromContext(r.Context())
 		if identity != nil && !identity.IsModelAllowed(model) {
-			writeJSON(w, http.StatusForbidden, errorResponse("model not allowed"))
+			writeNativeError(w, providerType, http.StatusForbidden, "model not allowed")
+			return
+		}
+		if s.modelBlocked(r.Context(), model) {
+			writeNativeError(w, providerType, http.StatusForbidden, "model not allowed")
+			return
+		}
+		if name := s.deniedTool(r.Context(), identity, model, nativeToolNames(providerType, body)); name != "" {
+			writeNativeError(w, providerType, http.StatusForbidden, "tool not allowed: "+name)
+			return
+		}
+		user := nativeUser(providerType, body)
+		if s.missingUser(identity, user) {
+			writeNativeError(w, providerType, http.StatusBadRequest, "user is required")
+			return
+		}
+		if !s.checkTokenBudget(w, r, identity, model) {
+			return
+		}
+
+		// TPM rate limit check. The estimate is reconciled with the usage
+		// the upstream reports once the response has been relayed.
+		estimated := s.estimateNativeTokens(providerType, model, body)
+		if !s.consumeTPM(w, r, identity, model, estimated) {
 			return
 		}
 
 		// Route model -> provider targets.
 		targets, err := s.deps.Router.ResolveModel(r.Context(), model)
 		if err != nil {
-			writeUpstreamError(w, r.Context(), err)
+			status := errorStatus(err)
+			slog.LogAttrs(r.Context(), slog.LevelError, "upstream error",
+				slog.Int("status", status),
+				slog.String("error", err.Error()),
+			)
+			writeNativeError(w, providerType, status, upstreamErrorMessage(err, status))
 			return
 		}
 
@@ -175,14 +209,30 @@ func (s *server) handleNativeProxy(providerType string,
 			r.Body = io.NopCloser(bytes.NewReader(body))
 			path := pathFunc(r)
 			if path == "" {
-				writeJSON(w, http.StatusBadRequest, errorResponse("invalid path parameters"))
+				writeNativeError(w, providerType, http.StatusBadRequest, "invalid path parameters")
 				return
 			}
-			if proxyErr := np.ProxyRequest(r.Context(), w, r, path); proxyErr != nil {
+			gateway.SetRequestTarget(r.Context(), target.ProviderID, target.Model)
+			start := time.Now()
+			uw := &nativeUsageWriter{ResponseWriter: w, s: s, providerType: providerType, model: model}
+			if proxyErr := np.ProxyRequest(r.Context(), uw, r, path); proxyErr != nil {
 				slog.LogAttrs(r.Context(), slog.LevelError, "native proxy error",
 					slog.String("provider", target.ProviderID),
 					slog.String("error", proxyErr.Error()),
 				)
+				if !responseStarted(w) {
+					writeNativeError(w, providerType, http.StatusBadGateway, "upstream request failed")
+				}
+				return
+			}
+			status := http.StatusOK
+			if sw := findStatusWriter(w); sw != nil {
+				status = sw.status
+			}
+			if status < http.StatusBadRequest {
+				usage := uw.usage(estimated)
+				s.adjustTPM(identity, estimated, usage)
+				s.recordUsage(r, identity, requestUsageMeta(r, user), model, usage, time.Since(start), status, false)
 			}
 			return
 		}
@@ -193,8 +243,334 @@ func (s *server) handleNativeProxy(providerType string,
 			slog.String("type", providerType),
 			slog.String("model", model),
 		)
-		writeJSON(w, http.StatusBadGateway, errorResponse("no matching provider available"))
+		writeNativeError(w, providerType, http.StatusBadGateway, "no matching provider available")
+	}
+}
+
+// writeNativeError writes a gateway-generated error in the error format of
+// the native API being proxied, so its SDKs parse it like an upstream error:
+// Anthropic {"type":"error","error":{type,message}}, Gemini
+// {"error":{code,message,status}}, Ollama {"error":message}, and the OpenAI
+// shape for Azure OpenAI.
+func writeNativeError(w http.ResponseWriter, providerType string, status int, msg string) {
+	switch providerType {
+	case "anthropic":
+		writeJSON(w, status, map[string]any{
+			"type":  "error",
+			"error": map[string]string{"type": anthropicErrorType(status), "message": msg},
+		})
+	case "gemini":
+		writeJSON(w, status, map[string]any{
+			"error": map[string]any{"code": status, "message": msg, "status": geminiErrorStatus(status)},
+		})
+	case "ollama":
+		writeJSON(w, status, map[string]string{"error": msg})
+	default:
+		writeJSON(w, status, errorResponse(msg))
+	}
+}
+
+// anthropicErrorType maps an HTTP status to the Anthropic API error type.
+func anthropicErrorType(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable:
+		return "overloaded_error"
+	}
+	return "api_error"
+}
+
+// geminiErrorStatus maps an HTTP status to the google.rpc.Code name the
+// Gemini API reports.
+func geminiErrorStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	case http.StatusGatewayTimeout:
+		return "DEADLINE_EXCEEDED"
+	}
+	return "INTERNAL"
+}
+
+// responseStarted reports whether anything has been written to w. A writer
+// with no statusWriter in its Unwrap chain is assumed started, so nothing is
+// written twice.
+func responseStarted(w http.ResponseWriter) bool {
+	sw := findStatusWriter(w)
+	return sw == nil || sw.wroteHeader
+}
+
+// findStatusWriter returns the first statusWriter in w's Unwrap chain, or
+// nil if there is none.
+func findStatusWriter(w http.ResponseWriter) *statusWriter {
+	for {
+		switch v := w.(type) {
+		case *statusWriter:
+			return v
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// maxNativeUsageBody caps how much of a non-streamed native response is
+// kept to read its usage. Larger bodies are relayed but charged at the
+// estimate.
+const maxNativeUsageBody = 1 << 20
+
+// nativeUsageWriter relays a native response while reading the token usage
+// the upstream reports in it. Streams (SSE and NDJSON) are read line by line
+// as they pass; other bodies are kept up to maxNativeUsageBody and read when
+// usage is called. Compressed bodies are not read.
+type nativeUsageWriter struct {
+	http.ResponseWriter
+	s            *server
+	providerType string
+	model        string
+
+	started  bool
+	stream   bool
+	skip     bool   // compressed or oversized body: usage is not read
+	buf      []byte // partial line of a stream, or the whole body
+	reported gateway.Usage
+	streamed int // estimated tokens of streamed OpenAI-format text
+}
+
+func (uw *nativeUsageWriter) Write(b []byte) (int, error) {
+	if !uw.started {
+		uw.started = true
+		h := uw.Header()
+		ct := h.Get("Content-Type")
+		uw.stream = strings.Contains(ct, "text/event-stream") ||
+			strings.Contains(ct, "application/x-ndjson") ||
+			strings.Contains(ct, "application/stream+json")
+		uw.skip = h.Get("Content-Encoding") != ""
+	}
+	n, err := uw.ResponseWriter.Write(b)
+	if uw.skip {
+		return n, err
+	}
+	if !uw.stream {
+		if len(uw.buf)+len(b) > maxNativeUsageBody {
+			uw.skip, uw.buf = true, nil
+			return n, err
+		}
+		uw.buf = append(uw.buf, b...)
+		return n, err
+	}
+	uw.buf = append(uw.buf, b...)
+	rest := uw.buf
+	for {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			break
+		}
+		uw.readLine(rest[:i])
+		rest = rest[i+1:]
 	}
+	// Keep only the partial line, at the front of the buffer.
+	uw.buf = uw.buf[:copy(uw.buf, rest)]
+	return n, err
+}
+
+// Flush delegates to the underlying ResponseWriter if it implements
+// http.Flusher, so native streams are still flushed per read.
+func (uw *nativeUsageWriter) Flush() {
+	if f, ok := uw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter.
+func (uw *nativeUsageWriter) Unwrap() http.ResponseWriter {
+	return uw.ResponseWriter
+}
+
+// readLine reads usage from one SSE or NDJSON line.
+func (uw *nativeUsageWriter) readLine(line []byte) {
+	line = bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+	if len(line) == 0 || line[0] != '{' {
+		return
+	}
+	readNativeUsage(uw.providerType, line, &uw.reported)
+	if uw.providerType == "openai" {
+		// Azure streams report usage only with stream_options.include_usage.
+		uw.streamed += uw.s.deliveredTokens(uw.model, line)
+	}
+}
+
+// usage returns the usage to charge: what the upstream reported, with the
+// prompt falling back to estimated and the completion to the streamed text.
+func (uw *nativeUsageWriter) usage(estimated int64) *gateway.Usage {
+	if !uw.stream && !uw.skip && len(uw.buf) > 0 {
+		body := gjson.ParseBytes(uw.buf)
+		if body.IsArray() {
+			// Gemini streamGenerateContent without alt=sse returns a JSON
+			// array whose last element carries the final usage.
+			arr := body.Array()
+			body = arr[len(arr)-1]
+		}
+		readNativeUsage(uw.providerType, []byte(body.Raw), &uw.reported)
+	}
+	u := uw.reported
+	if u.PromptTokens == 0 {
+		u.PromptTokens = int(estimated)
+	}
+	if u.CompletionTokens == 0 {
+		u.CompletionTokens = uw.streamed
+	}
+	u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	return &u
+}
+
+// readNativeUsage copies the token counts found in one native response body
+// or stream event into u, keeping earlier counts for fields it lacks.
+// Anthropic reports input tokens in message_start and output tokens in
+// message_delta; Gemini's usageMetadata is cumulative; Ollama reports counts
+// on its final object.
+func readNativeUsage(providerType string, data []byte, u *gateway.Usage) {
+	var prompt, completion gjson.Result
+	switch providerType {
+	case "anthropic":
+		usage := gjson.GetBytes(data, "usage")
+		if !usage.Exists() {
+			usage = gjson.GetBytes(data, "message.usage")
+		}
+		prompt, completion = usage.Get("input_tokens"), usage.Get("output_tokens")
+	case "gemini":
+		usage := gjson.GetBytes(data, "usageMetadata")
+		prompt, completion = usage.Get("promptTokenCount"), usage.Get("candidatesTokenCount")
+	case "ollama":
+		prompt, completion = gjson.GetBytes(data, "prompt_eval_count"), gjson.GetBytes(data, "eval_count")
+	default:
+		usage := gjson.GetBytes(data, "usage")
+		prompt, completion = usage.Get("prompt_tokens"), usage.Get("completion_tokens")
+	}
+	if n := int(prompt.Int()); n > 0 {
+		u.PromptTokens = n
+	}
+	if n := int(completion.Int()); n > 0 {
+		u.CompletionTokens = n
+	}
+}
+
+// estimateNativeTokens estimates prompt tokens for a native request body.
+// Each format nests its text differently, so the text is first gathered into
+// messages and then estimated the same way as OpenAI requests.
+func (s *server) estimateNativeTokens(providerType, model string, body []byte) int64 {
+	return s.estimateTokens(model, nativeMessages(providerType, body))
+}
+
+// nativeMessages extracts the prompt text of a native request as messages.
+// Only text counts toward the estimate; images and other media are ignored.
+// Content holds plain text rather than JSON and is only fit for estimation.
+func nativeMessages(providerType string, body []byte) []gateway.Message {
+	root := gjson.ParseBytes(body)
+	var msgs []gateway.Message
+	add := func(role string, text []byte) {
+		if len(text) > 0 {
+			msgs = append(msgs, gateway.Message{Role: role, Content: text})
+		}
+	}
+	switch providerType {
+	case "anthropic":
+		// system: string or text blocks; messages[].content: string or blocks.
+		add("system", nativeText(root.Get("system")))
+		root.Get("messages").ForEach(func(_, m gjson.Result) bool {
+			add(m.Get("role").String(), nativeText(m.Get("content")))
+			return true
+		})
+	case "gemini":
+		// systemInstruction.parts[], contents[].parts[] (generate), content.parts[] (embed).
+		add("system", nativeText(root.Get("systemInstruction.parts")))
+		root.Get("contents").ForEach(func(_, c gjson.Result) bool {
+			add(c.Get("role").String(), nativeText(c.Get("parts")))
+			return true
+		})
+		add("user", nativeText(root.Get("content.parts")))
+	default:
+		// OpenAI and Ollama: messages[].content (chat) or input (embeddings).
+		root.Get("messages").ForEach(func(_, m gjson.Result) bool {
+			add(m.Get("role").String(), nativeText(m.Get("content")))
+			return true
+		})
+		add("user", nativeText(root.Get("input")))
+	}
+	return msgs
+}
+
+// nativeUser returns the end-user identifier of a native request body:
+// metadata.user_id for Anthropic, the user field for OpenAI and Ollama.
+// Gemini's format has no such field, so it is always "".
+func nativeUser(providerType string, body []byte) string {
+	switch providerType {
+	case "anthropic":
+		return gjson.GetBytes(body, "metadata.user_id").String()
+	case "gemini":
+		return ""
+	default:
+		return gjson.GetBytes(body, "user").String()
+	}
+}
+
+// nativeToolNames returns the tool (function) names a native request body
+// declares, in the field its format uses.
+func nativeToolNames(providerType string, body []byte) []string {
+	switch providerType {
+	case "anthropic":
+		return toolNames(gjson.GetBytes(body, "tools.#.name"))
+	case "gemini":
+		// The REST API accepts both the camelCase and the proto field name.
+		return append(toolNames(gjson.GetBytes(body, "tools.#.functionDeclarations.#.name")),
+			toolNames(gjson.GetBytes(body, "tools.#.function_declarations.#.name"))...)
+	default:
+		return toolNames(gjson.GetBytes(body, "tools.#.function.name"))
+	}
+}
+
+// nativeText returns the text in v: the string itself, or for an array the
+// concatenated strings and "text" fields of its elements. Returns nil when v
+// holds no text.
+func nativeText(v gjson.Result) []byte {
+	if v.Type == gjson.String {
+		return []byte(v.Str)
+	}
+	if !v.IsArray() {
+		return nil
+	}
+	var out []byte
+	v.ForEach(func(_, e gjson.Result) bool {
+		if e.Type == gjson.String {
+			out = append(out, e.Str...)
+		} else {
+			out = append(out, e.Get("text").Str...)
+		}
+		return true
+	})
+	return out
 }
 
 // handleNativeProxyList returns a handler for list endpoints that don't need
@@ -204,12 +580,12 @@ func (s *server) handleNativeProxyList(providerType, path string) http.HandlerFu
 		// Find any registered provider of the given type.
 		p, err := s.deps.Providers.GetByType(providerType)
 		if err != nil {
-			writeJSON(w, http.StatusBadGateway, errorResponse("no "+providerType+" provider registered"))
+			writeNativeError(w, providerType, http.StatusBadGateway, "no "+providerType+" provider registered")
 			return
 		}
 		np, ok := p.(gateway.NativeProxy)
 		if !ok {
-			writeJSON(w, http.StatusBadGateway, errorResponse(providerType+" provider does not support native passthrough"))
+			writeNativeError(w, providerType, http.StatusBadGateway, providerType+" provider does not support native passthrough")
 			return
 		}
 		if proxyErr := np.ProxyRequest(r.Context(), w, r, path); proxyErr != nil {
@@ -217,6 +593,9 @@ func (s *server) handleNativeProxyList(providerType, path string) http.HandlerFu
 				slog.String("provider", providerType),
 				slog.String("error", proxyErr.Error()),
 			)
+			if !responseStarted(w) {
+				writeNativeError(w, providerType, http.StatusBadGateway, "upstream request failed")
+			}
 		}
 	}
 }
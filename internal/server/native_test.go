@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -11,6 +12,8 @@ import (
 	gateway "github.com/eugener/gandalf/internal"
 	"github.com/eugener/gandalf/internal/app"
 	"github.com/eugener/gandalf/internal/provider"
+	"github.com/eugener/gandalf/internal/ratelimit"
+	"github.com/eugener/gandalf/internal/tokencount"
 )
 
 // fakeNativeProvider implements both gateway.Provider and gateway.NativeProxy.
@@ -21,6 +24,12 @@ type fakeNativeProvider struct {
 	lastPath     string
 	lastBody     string
 	lastHeaders  http.Header
+	proxyErr     error // returned before anything is written
+
+	// respType and respBody replace the default JSON response; each part of
+	// respBody is a separate Write.
+	respType string
+	respBody []string
 }
 
 func (f *fakeNativeProvider) Name() string { return f.name }
@@ -33,9 +42,20 @@ func (f *fakeNativeProvider) Type() string {
 
 func (f *fakeNativeProvider) ProxyRequest(_ context.Context, w http.ResponseWriter, r *http.Request, path string) error {
 	f.lastPath = path
+	if f.proxyErr != nil {
+		return f.proxyErr
+	}
 	body, _ := io.ReadAll(r.Body)
 	f.lastBody = string(body)
 	f.lastHeaders = r.Header.Clone()
+	if f.respBody != nil {
+		w.Header().Set("Content-Type", f.respType)
+		w.WriteHeader(http.StatusOK)
+		for _, part := range f.respBody {
+			_, _ = w.Write([]byte(part))
+		}
+		return nil
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write([]byte(`{"proxied":true,"path":"` + path + `"}`))
@@ -112,6 +132,75 @@ func TestNativeAnthropicMessages(t *testing.T) {
 	}
 }
 
+func TestNativeRequireUser(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		provider string
+		path     string
+		body     string
+		want     int
+		wantUser string
+	}{
+		{"anthropic missing", "anthropic", "/v1/messages",
+			`{"model":"claude-sonnet-4-6","messages":[{"role":"user","content":"hi"}]}`, http.StatusBadRequest, ""},
+		{"anthropic metadata", "anthropic", "/v1/messages",
+			`{"model":"claude-sonnet-4-6","messages":[{"role":"user","content":"hi"}],"metadata":{"user_id":"u-7"}}`, http.StatusOK, "u-7"},
+		{"anthropic top-level user ignored", "anthropic", "/v1/messages",
+			`{"model":"claude-sonnet-4-6","messages":[{"role":"user","content":"hi"}],"user":"u-7"}`, http.StatusBadRequest, ""},
+		{"azure missing", "openai", "/openai/deployments/gpt-4o/chat/completions",
+			`{"messages":[{"role":"user","content":"hi"}]}`, http.StatusBadRequest, ""},
+		{"azure user", "openai", "/openai/deployments/gpt-4o/chat/completions",
+			`{"messages":[{"role":"user","content":"hi"}],"user":"u-8"}`, http.StatusOK, "u-8"},
+		{"ollama user", "ollama", "/api/chat",
+			`{"model":"llama3","messages":[{"role":"user","content":"hi"}],"user":"u-9"}`, http.StatusOK, "u-9"},
+		{"gemini has no user field", "gemini", "/v1beta/models/gemini-2.0-flash:generateContent",
+			`{"contents":[{"parts":[{"text":"hi"}]}]}`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fp := &fakeNativeProvider{name: tt.provider}
+			reg := provider.NewRegistry()
+			reg.Register(tt.provider, fp)
+			routerSvc := app.NewRouterService(&fakeNativeRouteStore{routes: map[string]string{
+				"claude-sonnet-4-6": tt.provider, "gpt-4o": tt.provider, "llama3": tt.provider, "gemini-2.0-flash": tt.provider,
+			}})
+			usage := &capturingRecorder{}
+			h := New(Deps{
+				Auth:            fakeAuth{},
+				Proxy:           app.NewProxyService(reg, routerSvc, nil, nil),
+				Providers:       reg,
+				Router:          routerSvc,
+				Usage:           usage,
+				RequireUserOrgs: []string{"default"},
+			})
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer gnd_test")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d; body = %s", rec.Code, tt.want, rec.Body.String())
+			}
+			usage.mu.Lock()
+			defer usage.mu.Unlock()
+			if tt.want != http.StatusOK {
+				if !strings.Contains(rec.Body.String(), "user is required") || fp.lastPath != "" {
+					t.Errorf("body = %s, forwarded to %q; want 'user is required' and nothing forwarded", rec.Body.String(), fp.lastPath)
+				}
+				return
+			}
+			if len(usage.records) != 1 || usage.records[0].EndUser != tt.wantUser {
+				t.Errorf("usage = %+v, want one record with end_user %q", usage.records, tt.wantUser)
+			}
+		})
+	}
+}
+
 func TestNativeAnthropicAuthNormalization(t *testing.T) {
 	t.Parallel()
 
@@ -367,6 +456,57 @@ func TestNativeNoProviderAvailable(t *testing.T) {
 	}
 }
 
+func TestNativeErrorFormat(t *testing.T) {
+	t.Parallel()
+
+	unreachable := &fakeNativeProvider{name: "down", providerType: "gemini", proxyErr: errors.New("dial tcp: connection refused")}
+	h := newNativeTestHandler(
+		map[string]*fakeNativeProvider{"anthropic": {name: "anthropic"}, "down": unreachable},
+		map[string]string{"elsewhere": "openai", "gemini-2.5-pro": "down"},
+	)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		want   string
+	}{
+		{"anthropic no provider", http.MethodPost, "/v1/messages", `{"model":"elsewhere"}`, http.StatusBadGateway,
+			`{"error":{"message":"no matching provider available","type":"api_error"},"type":"error"}`},
+		{"anthropic missing model", http.MethodPost, "/v1/messages", `{"max_tokens":1}`, http.StatusBadRequest,
+			`{"error":{"message":"model not specified","type":"invalid_request_error"},"type":"error"}`},
+		{"anthropic unknown route", http.MethodPost, "/v1/messages", `{"model":"nope"}`, http.StatusNotFound,
+			`{"error":{"message":"Not Found","type":"not_found_error"},"type":"error"}`},
+		{"gemini upstream unreachable", http.MethodPost, "/v1beta/models/gemini-2.5-pro:generateContent", `{}`, http.StatusBadGateway,
+			`{"error":{"code":502,"message":"upstream request failed","status":"INTERNAL"}}`},
+		{"gemini no provider", http.MethodPost, "/v1beta/models/elsewhere:generateContent", `{}`, http.StatusBadGateway,
+			`{"error":{"code":502,"message":"no matching provider available","status":"INTERNAL"}}`},
+		{"ollama no provider", http.MethodGet, "/api/tags", "", http.StatusBadGateway,
+			`{"error":"no ollama provider registered"}`},
+		{"azure no provider", http.MethodPost, "/openai/deployments/elsewhere/chat/completions", `{}`, http.StatusBadGateway,
+			`{"error":{"message":"no matching provider available","type":"invalid_request_error"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer gnd_test_key")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("body = %s\nwant   %s", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestNativeMissingModel(t *testing.T) {
 	t.Parallel()
 
@@ -439,6 +579,317 @@ func TestNativeProxy_ModelNotAllowed(t *testing.T) {
 	}
 }
 
+func TestNativeProxy_DeniedTool(t *testing.T) {
+	t.Parallel()
+
+	providers := map[string]*fakeNativeProvider{
+		"anthropic": {name: "anthropic"},
+		"gemini":    {name: "gemini"},
+		"openai":    {name: "openai"},
+		"ollama":    {name: "ollama"},
+	}
+	reg := provider.NewRegistry()
+	for name, p := range providers {
+		reg.Register(name, p)
+	}
+	routerSvc := app.NewRouterService(&fakeNativeRouteStore{routes: map[string]string{
+		"claude-sonnet-4-6": "anthropic",
+		"gemini-2.5-flash":  "gemini",
+		"gpt-4o":            "openai",
+		"llama3":            "ollama",
+	}})
+	h := New(Deps{
+		Auth:           fakeAuth{},
+		Proxy:          app.NewProxyService(reg, routerSvc, nil, nil),
+		Providers:      reg,
+		Router:         routerSvc,
+		OrgDeniedTools: map[string][]string{"default": {"shell_exec"}},
+	})
+
+	tests := []struct {
+		name, path, header, body string
+	}{
+		{"anthropic", "/v1/messages", "X-Api-Key",
+			`{"model":"claude-sonnet-4-6","messages":[],"tools":[{"name":"get_weather"},{"name":"shell_exec"}]}`},
+		{"gemini", "/v1beta/models/gemini-2.5-flash:generateContent", "X-Goog-Api-Key",
+			`{"contents":[],"tools":[{"functionDeclarations":[{"name":"get_weather"},{"name":"Shell_Exec"}]}]}`},
+		{"gemini proto name", "/v1beta/models/gemini-2.5-flash:generateContent", "X-Goog-Api-Key",
+			`{"contents":[],"tools":[{"function_declarations":[{"name":"shell_exec"}]}]}`},
+		{"azure", "/openai/deployments/gpt-4o/chat/completions", "Api-Key",
+			`{"messages":[],"tools":[{"type":"function","function":{"name":"shell_exec"}}]}`},
+		{"ollama", "/api/chat", "Authorization",
+			`{"model":"llama3","messages":[],"tools":[{"type":"function","function":{"name":"shell_exec"}}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			send := func(body string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set(tt.header, "Bearer gnd_test_key")
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, req)
+				return rec
+			}
+			if rec := send(tt.body); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "tool not allowed") {
+				t.Errorf("denied: status = %d, body = %s; want 403 tool not allowed", rec.Code, rec.Body.String())
+			}
+			allowed := strings.NewReplacer("shell_exec", "get_time", "Shell_Exec", "get_time").Replace(tt.body)
+			if rec := send(allowed); rec.Code != http.StatusOK {
+				t.Errorf("allowed: status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func nativeAnthropicRequest(h http.Handler) *httptest.ResponseRecorder {
+	body := `{"model":"claude-sonnet-4-6","max_tokens":100,"system":"be brief","messages":[{"role":"user","content":[{"type":"text","text":"hello world this is a long message"}]}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api-Key", "gnd_test_key")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestNativeProxy_RateLimited(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		rpm, tpm int64
+		header   string
+	}{
+		{"rpm", 1, 100000, "X-Ratelimit-Limit-Requests"},
+		{"tpm", 1000, 40, "X-Ratelimit-Limit-Tokens"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fp := &fakeNativeProvider{name: "anthropic"}
+			reg := provider.NewRegistry()
+			reg.Register("anthropic", fp)
+			routerSvc := app.NewRouterService(&fakeNativeRouteStore{
+				routes: map[string]string{"claude-sonnet-4-6": "anthropic"},
+			})
+			h := New(Deps{
+				Auth:         rateLimitAuth{rpm: tt.rpm, tpm: tt.tpm},
+				Proxy:        app.NewProxyService(reg, routerSvc, nil, nil),
+				Providers:    reg,
+				Router:       routerSvc,
+				RateLimiter:  ratelimit.NewRegistry(),
+				TokenCounter: tokencount.NewCounter(),
+			})
+
+			if rec := nativeAnthropicRequest(h); rec.Code != http.StatusOK {
+				t.Fatalf("first request: status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+			}
+			rec := nativeAnthropicRequest(h)
+			if rec.Code != http.StatusTooManyRequests {
+				t.Fatalf("second request: status = %d, want 429; body = %s", rec.Code, rec.Body.String())
+			}
+			if rec.Header().Get(tt.header) == "" {
+				t.Errorf("%s header should be set", tt.header)
+			}
+		})
+	}
+}
+
+func TestNativeProxy_QuotaEnforced(t *testing.T) {
+	t.Parallel()
+
+	fp := &fakeNativeProvider{name: "anthropic"}
+	reg := provider.NewRegistry()
+	reg.Register("anthropic", fp)
+	routerSvc := app.NewRouterService(&fakeNativeRouteStore{
+		routes: map[string]string{"claude-sonnet-4-6": "anthropic"},
+	})
+	qt := ratelimit.NewQuotaTracker()
+	usage := &capturingRecorder{}
+	h := New(Deps{
+		Auth:         quotaAuth{maxBudget: 0.0001},
+		Proxy:        app.NewProxyService(reg, routerSvc, nil, nil),
+		Providers:    reg,
+		Router:       routerSvc,
+		Quota:        qt,
+		Usage:        usage,
+		TokenCounter: tokencount.NewCounter(),
+	})
+
+	// First request is within budget; its estimated prompt cost is charged.
+	if rec := nativeAnthropicRequest(h); rec.Code != http.StatusOK {
+		t.Fatalf("first request: status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+	}
+	usage.mu.Lock()
+	if len(usage.records) != 1 || usage.records[0].PromptTokens == 0 || usage.records[0].CostUSD == 0 {
+		t.Errorf("usage records = %+v, want one record with estimated prompt tokens and cost", usage.records)
+	}
+	usage.mu.Unlock()
+
+	// Enough native traffic exhausts the budget.
+	var rec *httptest.ResponseRecorder
+	for range 20 {
+		if rec = nativeAnthropicRequest(h); rec.Code != http.StatusOK {
+			break
+		}
+	}
+	if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), "quota exceeded") {
+		t.Errorf("status = %d, want 429 quota exceeded; body = %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestNativeProxy_RecordsUpstreamUsage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name, providerType, path, body string
+		respType                       string
+		respBody                       []string
+		prompt, completion             int
+	}{
+		{
+			name: "anthropic json", providerType: "anthropic", path: "/v1/messages",
+			body:     `{"model":"m","max_tokens":100,"messages":[{"role":"user","content":"hi"}]}`,
+			respType: "application/json",
+			respBody: []string{`{"id":"msg_1","content":[{"type":"text","text":"hello"}],`, `"usage":{"input_tokens":12,"output_tokens":34}}`},
+			prompt:   12, completion: 34,
+		},
+		{
+			name: "anthropic stream", providerType: "anthropic", path: "/v1/messages",
+			body:     `{"model":"m","max_tokens":100,"stream":true,"messages":[{"role":"user","content":"hi"}]}`,
+			respType: "text/event-stream",
+			respBody: []string{
+				"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":12,\"output_tokens\":1}}}\n\n",
+				"event: message_delta\ndata: {\"type\":\"message_delta\",\"usa",
+				"ge\":{\"output_tokens\":40}}\n\n",
+			},
+			prompt: 12, completion: 40,
+		},
+		{
+			name: "gemini stream", providerType: "gemini", path: "/v1beta/models/m:streamGenerateContent?alt=sse",
+			body:     `{"contents":[{"parts":[{"text":"hi"}]}]}`,
+			respType: "text/event-stream",
+			respBody: []string{
+				"data: {\"usageMetadata\":{\"promptTokenCount\":8,\"candidatesTokenCount\":3}}\r\n\r\n",
+				"data: {\"usageMetadata\":{\"promptTokenCount\":8,\"candidatesTokenCount\":9}}\r\n\r\n",
+			},
+			prompt: 8, completion: 9,
+		},
+		{
+			name: "ollama ndjson", providerType: "ollama", path: "/api/chat",
+			body:     `{"model":"m","messages":[{"role":"user","content":"hi"}]}`,
+			respType: "application/x-ndjson",
+			respBody: []string{`{"message":{"content":"hi"},"done":false}` + "\n", `{"done":true,"prompt_eval_count":5,"eval_count":7}` + "\n"},
+			prompt:   5, completion: 7,
+		},
+		{
+			name: "azure stream without usage", providerType: "openai", path: "/openai/deployments/m/chat/completions",
+			body:     `{"messages":[{"role":"user","content":"hi"}],"stream":true}`,
+			respType: "text/event-stream",
+			respBody: []string{
+				"data: {\"choices\":[{\"delta\":{\"content\":\"Hello there\"}}]}\n\n",
+				"data: [DONE]\n\n",
+			},
+			completion: 3, // 11 bytes at ~4 bytes per token
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fp := &fakeNativeProvider{name: tt.providerType, respType: tt.respType, respBody: tt.respBody}
+			reg := provider.NewRegistry()
+			reg.Register(tt.providerType, fp)
+			routerSvc := app.NewRouterService(&fakeNativeRouteStore{routes: map[string]string{"m": tt.providerType}})
+			usage := &capturingRecorder{}
+			h := New(Deps{
+				Auth:               fakeAuth{},
+				Proxy:              app.NewProxyService(reg, routerSvc, nil, nil),
+				Providers:          reg,
+				Router:             routerSvc,
+				Usage:              usage,
+				FixedTokenEstimate: 100,
+			})
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer gnd_test")
+			if tt.providerType == "openai" {
+				req.Header.Set("Api-Key", "gnd_test")
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+			}
+			if got := rec.Body.String(); got != strings.Join(tt.respBody, "") {
+				t.Errorf("body = %q, want it relayed unchanged", got)
+			}
+
+			prompt := tt.prompt
+			if prompt == 0 {
+				prompt = 100 // no upstream prompt count: charged at the estimate
+			}
+			usage.mu.Lock()
+			defer usage.mu.Unlock()
+			if len(usage.records) != 1 {
+				t.Fatalf("usage records = %d, want 1", len(usage.records))
+			}
+			got := usage.records[0]
+			if got.PromptTokens != prompt || got.CompletionTokens != tt.completion || got.TotalTokens != prompt+tt.completion {
+				t.Errorf("tokens = %d/%d/%d, want %d/%d/%d", got.PromptTokens, got.CompletionTokens, got.TotalTokens,
+					prompt, tt.completion, prompt+tt.completion)
+			}
+		})
+	}
+}
+
+func TestNativeMessages(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		providerType string
+		body         string
+		want         []string // role:text
+	}{
+		{
+			"anthropic blocks", "anthropic",
+			`{"system":[{"type":"text","text":"sys"}],"messages":[{"role":"user","content":[{"type":"text","text":"a"},{"type":"image"},{"type":"text","text":"b"}]},{"role":"assistant","content":"c"}]}`,
+			[]string{"system:sys", "user:ab", "assistant:c"},
+		},
+		{
+			"gemini generate", "gemini",
+			`{"systemInstruction":{"parts":[{"text":"sys"}]},"contents":[{"role":"user","parts":[{"text":"hi"},{"inlineData":{}}]}]}`,
+			[]string{"system:sys", "user:hi"},
+		},
+		{
+			"gemini embed", "gemini",
+			`{"content":{"parts":[{"text":"embed me"}]}}`,
+			[]string{"user:embed me"},
+		},
+		{
+			"openai chat", "openai",
+			`{"messages":[{"role":"user","content":"hello"}]}`,
+			[]string{"user:hello"},
+		},
+		{
+			"ollama embed batch", "ollama",
+			`{"input":["one","two"]}`,
+			[]string{"user:onetwo"},
+		},
+	}
+	for _, tt := range tests {
+		msgs := nativeMessages(tt.providerType, []byte(tt.body))
+		var got []string
+		for _, m := range msgs {
+			got = append(got, m.Role+":"+string(m.Content))
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s: messages = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
 // restrictedModelAuth returns an identity with a restricted AllowedModels list.
 type restrictedModelAuth struct {
 	allowed []string
@@ -510,3 +961,36 @@ func TestNormalizeAuthMiddleware(t *testing.T) {
 		})
 	}
 }
+
+// unwrapWriter is a middleware-style ResponseWriter wrapper.
+type unwrapWriter struct{ http.ResponseWriter }
+
+func (u unwrapWriter) Unwrap() http.ResponseWriter { return u.ResponseWriter }
+
+func TestResponseStarted(t *testing.T) {
+	t.Parallel()
+	fresh := func() *statusWriter {
+		return &statusWriter{ResponseWriter: httptest.NewRecorder(), status: http.StatusOK}
+	}
+	written := fresh()
+	written.WriteHeader(http.StatusTeapot)
+
+	tests := []struct {
+		name string
+		w    http.ResponseWriter
+		want bool
+	}{
+		{"no statusWriter", httptest.NewRecorder(), true},
+		{"statusWriter", fresh(), false},
+		{"wrapped statusWriter", unwrapWriter{unwrapWriter{fresh()}}, false},
+		{"wrapped written", unwrapWriter{written}, true},
+	}
+	for _, tt := range tests {
+		if got := responseStarted(tt.w); got != tt.want {
+			t.Errorf("%s: responseStarted = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if sw := findStatusWriter(unwrapWriter{written}); sw == nil || sw.status != http.StatusTeapot {
+		t.Errorf("findStatusWriter = %+v, want the wrapped writer", sw)
+	}
+}
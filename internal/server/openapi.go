@@ -0,0 +1,390 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/app"
+)
+
+// apiOp documents one HTTP operation in the OpenAPI spec. Request and
+// response schemas are derived by reflection from the Go types the handlers
+// decode and encode, so field changes show up in the spec automatically.
+// Every route under /v1/ and /admin/v1/ must have an entry here
+// (enforced by TestOpenAPICoversRoutes).
+type apiOp struct {
+	method  string
+	path    string // chi pattern; {param} syntax is shared with OpenAPI
+	tag     string
+	summary string
+	query   []string // optional query parameters
+	req     any      // request body type (nil = no body)
+	resp    any      // success response type (nil = no body)
+	status  int      // success status code
+	wrap    respWrap
+}
+
+// respWrap describes how the handler wraps resp in the response body.
+type respWrap uint8
+
+const (
+	wrapNone respWrap = iota // resp is the body
+	wrapList                 // listResponse{data: []resp, pagination}
+	wrapData                 // {"data": []resp}
+)
+
+// rawObject marks opaque provider-native JSON bodies.
+type rawObject map[string]any
+
+var apiOps = []apiOp{
+	// Universal API.
+	{method: http.MethodPost, path: "/v1/chat/completions", tag: "universal", summary: "Create a chat completion (OpenAI format, any provider); SSE when stream=true",
+		req: gateway.ChatRequest{}, resp: gateway.ChatResponse{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/v1/embeddings", tag: "universal", summary: "Create embeddings (OpenAI format)",
+		req: gateway.EmbeddingRequest{}, resp: gateway.EmbeddingResponse{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/v1/models", tag: "universal", summary: "List models across all providers",
+		resp: modelListResponse{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/v1/threads", tag: "universal", summary: "Create a conversation thread (requires server.threads)",
+		req: threadCreateRequest{}, resp: gateway.Thread{}, status: http.StatusCreated},
+	{method: http.MethodPost, path: "/v1/threads/{id}/messages", tag: "universal", summary: "Append messages to a thread and complete over its full history",
+		req: gateway.ChatRequest{}, resp: gateway.ChatResponse{}, status: http.StatusOK},
+
+	// Native passthrough.
+	{method: http.MethodPost, path: "/v1/messages", tag: "native", summary: "Anthropic Messages API passthrough",
+		req: rawObject{}, resp: rawObject{}, status: http.StatusOK},
+
+	// Admin: providers.
+	{method: http.MethodGet, path: "/admin/v1/providers", tag: "admin", summary: "List providers",
+		resp: gateway.ProviderConfig{}, status: http.StatusOK, wrap: wrapList},
+	{method: http.MethodPost, path: "/admin/v1/providers", tag: "admin", summary: "Create a provider",
+		req: gateway.ProviderConfig{}, resp: gateway.ProviderConfig{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/admin/v1/providers/{id}", tag: "admin", summary: "Get a provider",
+		resp: gateway.ProviderConfig{}, status: http.StatusOK},
+	{method: http.MethodPut, path: "/admin/v1/providers/{id}", tag: "admin", summary: "Update a provider",
+		req: gateway.ProviderConfig{}, resp: gateway.ProviderConfig{}, status: http.StatusOK},
+	{method: http.MethodDelete, path: "/admin/v1/providers/{id}", tag: "admin", summary: "Delete a provider",
+		status: http.StatusNoContent},
+	{method: http.MethodPost, path: "/admin/v1/providers/{id}/migrate", tag: "admin", summary: "Repoint routes to another provider",
+		query: []string{"to", "keep_failover"}, resp: gateway.Route{}, status: http.StatusOK, wrap: wrapList},
+	{method: http.MethodPost, path: "/admin/v1/cache/purge", tag: "admin", summary: "Purge the response cache",
+		status: http.StatusNoContent},
+	{method: http.MethodPost, path: "/admin/v1/cache/warm", tag: "admin", summary: "Pre-populate the response cache (max 50 requests)",
+		req: cacheWarmRequest{}, resp: cacheWarmResponse{}, status: http.StatusOK},
+
+	// Admin: keys.
+	{method: http.MethodGet, path: "/admin/v1/keys", tag: "admin", summary: "List API keys in the caller's org",
+		query: []string{"org_id", "offset", "limit"}, resp: gateway.APIKey{}, status: http.StatusOK, wrap: wrapList},
+	{method: http.MethodPost, path: "/admin/v1/keys", tag: "admin", summary: "Create an API key (plaintext returned once)",
+		req: keyCreateRequest{}, resp: keyCreateResponse{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/admin/v1/keys/{id}", tag: "admin", summary: "Get an API key",
+		resp: gateway.APIKey{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/admin/v1/keys/{id}/limits", tag: "admin", summary: "Get a key's live rate-limit, quota, and stream state",
+		resp: keyLimitsResponse{}, status: http.StatusOK},
+	{method: http.MethodPut, path: "/admin/v1/keys/{id}", tag: "admin", summary: "Update an API key",
+		req: keyUpdateRequest{}, resp: gateway.APIKey{}, status: http.StatusOK},
+	{method: http.MethodDelete, path: "/admin/v1/keys/{id}", tag: "admin", summary: "Delete an API key",
+		status: http.StatusNoContent},
+
+	// Admin: organizations.
+	{method: http.MethodGet, path: "/admin/v1/orgs", tag: "admin", summary: "List organizations",
+		query: []string{"offset", "limit"}, resp: gateway.Organization{}, status: http.StatusOK, wrap: wrapList},
+	{method: http.MethodPost, path: "/admin/v1/orgs", tag: "admin", summary: "Create an organization",
+		req: gateway.Organization{}, resp: gateway.Organization{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/admin/v1/orgs/{id}", tag: "admin", summary: "Get an organization",
+		resp: gateway.Organization{}, status: http.StatusOK},
+	{method: http.MethodPut, path: "/admin/v1/orgs/{id}", tag: "admin", summary: "Update an organization",
+		req: orgUpdateRequest{}, resp: gateway.Organization{}, status: http.StatusOK},
+	{method: http.MethodDelete, path: "/admin/v1/orgs/{id}", tag: "admin", summary: "Delete an organization (409 while it has API keys)",
+		status: http.StatusNoContent},
+
+	// Admin: teams.
+	{method: http.MethodGet, path: "/admin/v1/teams", tag: "admin", summary: "List teams in the caller's org",
+		query: []string{"org_id", "offset", "limit"}, resp: gateway.Team{}, status: http.StatusOK, wrap: wrapList},
+	{method: http.MethodPost, path: "/admin/v1/teams", tag: "admin", summary: "Create a team",
+		req: gateway.Team{}, resp: gateway.Team{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/admin/v1/teams/{id}", tag: "admin", summary: "Get a team",
+		resp: gateway.Team{}, status: http.StatusOK},
+	{method: http.MethodPut, path: "/admin/v1/teams/{id}", tag: "admin", summary: "Update a team",
+		req: teamUpdateRequest{}, resp: gateway.Team{}, status: http.StatusOK},
+	{method: http.MethodDelete, path: "/admin/v1/teams/{id}", tag: "admin", summary: "Delete a team",
+		status: http.StatusNoContent},
+
+	// Admin: routes.
+	{method: http.MethodGet, path: "/admin/v1/routes", tag: "admin", summary: "List routes",
+		resp: gateway.Route{}, status: http.StatusOK, wrap: wrapList},
+	{method: http.MethodPost, path: "/admin/v1/routes", tag: "admin", summary: "Create a route",
+		req: gateway.Route{}, resp: gateway.Route{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/admin/v1/routes/{id}", tag: "admin", summary: "Get a route",
+		resp: gateway.Route{}, status: http.StatusOK},
+	{method: http.MethodPut, path: "/admin/v1/routes/{id}", tag: "admin", summary: "Update a route",
+		req: gateway.Route{}, resp: gateway.Route{}, status: http.StatusOK},
+	{method: http.MethodDelete, path: "/admin/v1/routes/{id}", tag: "admin", summary: "Delete a route",
+		status: http.StatusNoContent},
+	{method: http.MethodGet, path: "/admin/v1/models/{model}/capabilities", tag: "admin", summary: "Get model capabilities",
+		resp: capabilitiesResponse{}, status: http.StatusOK},
+
+	// Admin: usage.
+	{method: http.MethodGet, path: "/admin/v1/usage", tag: "admin", summary: "Query raw usage records",
+		query: []string{"org_id", "key_id", "model", "since", "until", "offset", "limit"},
+		resp:  gateway.UsageRecord{}, status: http.StatusOK, wrap: wrapList},
+	{method: http.MethodGet, path: "/admin/v1/usage/summary", tag: "admin", summary: "Query usage rollups",
+		query: []string{"org_id", "key_id", "model", "period", "since", "until"},
+		resp:  gateway.UsageRollup{}, status: http.StatusOK, wrap: wrapData},
+	{method: http.MethodGet, path: "/admin/v1/usage/anomalies", tag: "admin", summary: "List recent usage spend anomalies",
+		query: []string{"org_id", "key_id"},
+		resp:  gateway.UsageAnomaly{}, status: http.StatusOK, wrap: wrapData},
+
+	// Admin: recent errors.
+	{method: http.MethodGet, path: "/admin/v1/errors/recent", tag: "admin", summary: "List recent error events",
+		query: []string{"limit"}, resp: app.ErrorEvent{}, status: http.StatusOK, wrap: wrapList},
+
+	{method: http.MethodGet, path: "/admin/v1/providers/latency", tag: "admin", summary: "Get upstream latency percentiles per provider",
+		resp: providerLatency{}, status: http.StatusOK, wrap: wrapList},
+
+	// Admin: audit trail.
+	{method: http.MethodGet, path: "/admin/v1/audit", tag: "admin", summary: "Query the admin audit log",
+		query: []string{"actor_key_id", "target_type", "target_id", "since", "until", "offset", "limit"},
+		resp:  gateway.AuditEntry{}, status: http.StatusOK, wrap: wrapList},
+
+	// Admin: eval dataset export.
+	{method: http.MethodGet, path: "/admin/v1/eval/export", tag: "admin", summary: "Export eval captures as JSON Lines, one capture per line",
+		query: []string{"label", "model", "since", "until", "limit"},
+		resp:  gateway.EvalCapture{}, status: http.StatusOK},
+
+	// Admin: backup (mounted when a backup signing key is configured).
+	{method: http.MethodGet, path: "/admin/v1/backup", tag: "admin", summary: "Export a signed configuration backup",
+		resp: backupDocument{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/admin/v1/restore", tag: "admin", summary: "Replace configuration from a signed backup",
+		req: backupDocument{}, status: http.StatusNoContent},
+}
+
+// openAPISpec is built once on first request; the op table is static.
+var openAPISpec = sync.OnceValue(func() []byte {
+	data, err := json.Marshal(buildOpenAPI(apiOps))
+	if err != nil {
+		panic("openapi: " + err.Error()) // static input; only fails on a programming error
+	}
+	return data
+})
+
+func (s *server) handleOpenAPI(w http.ResponseWriter, _ *http.Request) {
+	w.Header()["Content-Type"] = jsonCT
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPISpec())
+}
+
+// buildOpenAPI assembles an OpenAPI 3.0 document from the op table.
+func buildOpenAPI(ops []apiOp) map[string]any {
+	g := &schemaGen{schemas: make(map[string]any)}
+	errRef := g.schema(reflect.TypeOf(apiError{}))
+
+	paths := make(map[string]map[string]any)
+	for _, op := range ops {
+		responses := map[string]any{
+			"default": map[string]any{
+				"description": "Error",
+				"content":     map[string]any{"application/json": map[string]any{"schema": errRef}},
+			},
+		}
+		o := map[string]any{
+			"tags":      []string{op.tag},
+			"summary":   op.summary,
+			"responses": responses,
+		}
+		if params := apiParams(op); len(params) > 0 {
+			o["parameters"] = params
+		}
+		if op.req != nil {
+			o["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": g.schema(reflect.TypeOf(op.req))}},
+			}
+		}
+		success := map[string]any{"description": http.StatusText(op.status)}
+		if op.resp != nil {
+			success["content"] = map[string]any{"application/json": map[string]any{"schema": g.wrapped(op)}}
+		}
+		responses[strconv.Itoa(op.status)] = success
+
+		if paths[op.path] == nil {
+			paths[op.path] = make(map[string]any)
+		}
+		paths[op.path][strings.ToLower(op.method)] = o
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "Gandalf LLM Gateway",
+			"description": "OpenAI-compatible universal API, native provider passthrough, and admin API.",
+			"version":     "v1",
+		},
+		"security": []map[string][]string{{"bearerAuth": {}}},
+		"paths":    paths,
+		"components": map[string]any{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "Gandalf API key (gnd_...). Admin endpoints additionally require role permissions.",
+				},
+			},
+		},
+	}
+}
+
+// apiParams returns path parameters parsed from the pattern plus the op's
+// declared query parameters.
+func apiParams(op apiOp) []map[string]any {
+	var params []map[string]any
+	for rest := op.path; ; {
+		i := strings.IndexByte(rest, '{')
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(rest[i:], '}')
+		if j < 0 {
+			break
+		}
+		params = append(params, map[string]any{
+			"name": rest[i+1 : i+j], "in": "path", "required": true,
+			"schema": map[string]any{"type": "string"},
+		})
+		rest = rest[i+j+1:]
+	}
+	for _, q := range op.query {
+		typ := "string"
+		if q == "offset" || q == "limit" {
+			typ = "integer"
+		}
+		params = append(params, map[string]any{
+			"name": q, "in": "query", "required": false,
+			"schema": map[string]any{"type": typ},
+		})
+	}
+	return params
+}
+
+// schemaGen converts Go types to OpenAPI schemas, registering named structs
+// as reusable components.
+type schemaGen struct {
+	schemas map[string]any
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage(nil))
+)
+
+func (g *schemaGen) wrapped(op apiOp) map[string]any {
+	item := g.schema(reflect.TypeOf(op.resp))
+	switch op.wrap {
+	case wrapList:
+		return map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"data":       map[string]any{"type": "array", "items": item},
+				"pagination": g.schema(reflect.TypeOf(pagination{})),
+			},
+		}
+	case wrapData:
+		return map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"data": map[string]any{"type": "array", "items": item},
+			},
+		}
+	default:
+		return item
+	}
+}
+
+func (g *schemaGen) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == rawType:
+		return map[string]any{"description": "arbitrary JSON"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := componentName(t)
+		if _, ok := g.schemas[name]; !ok {
+			g.schemas[name] = nil // reserve to stop recursion on self-references
+			g.schemas[name] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	default: // interface{} and anything else: unconstrained
+		return map[string]any{}
+	}
+}
+
+// object builds an object schema from a struct's JSON-visible fields,
+// flattening embedded structs the way encoding/json does.
+func (g *schemaGen) object(t reflect.Type) map[string]any {
+	props := make(map[string]any)
+	g.collectFields(t, props)
+	return map[string]any{"type": "object", "properties": props}
+}
+
+func (g *schemaGen) collectFields(t reflect.Type, props map[string]any) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			for ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.collectFields(ft, props)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+	}
+}
+
+// componentName exports unexported type names (keyCreateRequest ->
+// KeyCreateRequest) so component names read as a public API.
+func componentName(t reflect.Type) string {
+	n := t.Name()
+	return strings.ToUpper(n[:1]) + n[1:]
+}
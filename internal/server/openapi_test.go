@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// openAPIDoc is the subset of the spec the tests inspect.
+type openAPIDoc struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func fetchOpenAPI(t *testing.T, h http.Handler) openAPIDoc {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var doc openAPIDoc
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	return doc
+}
+
+// TestOpenAPICoversRoutes keeps the spec in sync with the router: every
+// registered /v1/ and /admin/v1/ route must be documented, and every
+// documented operation must be registered.
+func TestOpenAPICoversRoutes(t *testing.T) {
+	t.Parallel()
+	h, _ := newAdminTestHandler(adminAuth{})
+	doc := fetchOpenAPI(t, h)
+
+	registered := make(map[string]bool)
+	err := chi.Walk(h.(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if !strings.HasPrefix(route, "/v1/") && !strings.HasPrefix(route, "/admin/v1/") {
+			return nil
+		}
+		registered[method+" "+route] = true
+		if _, ok := doc.Paths[route][strings.ToLower(method)]; !ok {
+			t.Errorf("route %s %s missing from OpenAPI spec", method, route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(registered) == 0 {
+		t.Fatal("no routes walked")
+	}
+
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			if !registered[strings.ToUpper(method)+" "+path] {
+				t.Errorf("spec documents %s %s, which is not registered", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestOpenAPISchemasFromGoTypes(t *testing.T) {
+	t.Parallel()
+	doc := fetchOpenAPI(t, newTestHandler())
+
+	if doc.OpenAPI != "3.0.3" {
+		t.Errorf("openapi = %q, want 3.0.3", doc.OpenAPI)
+	}
+
+	tests := []struct {
+		schema  string
+		present []string
+		absent  []string
+	}{
+		{"ChatRequest", []string{"model", "messages", "temperature", "stream"}, nil},
+		{"Route", []string{"model_alias", "targets", "default_temperature"}, nil},
+		// Embedded *APIKey fields are flattened; json:"-" fields are hidden.
+		{"KeyCreateResponse", []string{"key", "id", "key_prefix"}, []string{"KeyHash", "key_hash"}},
+		{"ProviderConfig", []string{"name", "base_url"}, []string{"APIKeyEnc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schema, func(t *testing.T) {
+			t.Parallel()
+			s, ok := doc.Components.Schemas[tt.schema]
+			if !ok {
+				t.Fatalf("schema %s missing", tt.schema)
+			}
+			for _, p := range tt.present {
+				if _, ok := s.Properties[p]; !ok {
+					t.Errorf("%s.%s missing", tt.schema, p)
+				}
+			}
+			for _, p := range tt.absent {
+				if _, ok := s.Properties[p]; ok {
+					t.Errorf("%s.%s should not be exposed", tt.schema, p)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/app"
+)
+
+// filterOutput runs the output filter over resp, if one is configured, and
+// logs which detectors matched. The matched text itself is never logged.
+func (s *server) filterOutput(ctx context.Context, resp *gateway.ChatResponse) {
+	if s.deps.OutputFilter == nil {
+		return
+	}
+	matched := s.deps.OutputFilter.Apply(resp)
+	if len(matched) == 0 {
+		return
+	}
+	slog.LogAttrs(ctx, slog.LevelWarn, "output filter matched",
+		slog.String("model", resp.Model),
+		slog.Any("detectors", matched),
+	)
+}
+
+// handleFilteredStream answers a stream request when streams must be
+// scanned: the whole upstream stream is collected, filtered, and replayed
+// to the client as SSE, as for a stream downgrade. Nothing is sent until
+// the upstream stream ends.
+func (s *server) handleFilteredStream(w http.ResponseWriter, r *http.Request, req *gateway.ChatRequest, identity *gateway.Identity, meta usageMeta, estimated int64, start time.Time, ch <-chan gateway.StreamChunk) {
+	resp, ok := s.collectStream(w, r, req, identity, meta, estimated, start, ch)
+	if !ok {
+		return
+	}
+
+	writeSSEHeaders(w)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		slog.Error("ResponseWriter does not implement http.Flusher")
+		return
+	}
+	for _, data := range app.ResponseChunks(resp, req.StreamOptions != nil && req.StreamOptions.IncludeUsage) {
+		writeSSEData(w, data)
+	}
+	flusher.Flush()
+	meta.ttfb = time.Since(start)
+	s.endStream(w, resp.Usage, nil)
+	flusher.Flush()
+	s.finishStream(r, req, identity, &meta, estimated, resp.Usage, start, http.StatusOK)
+}
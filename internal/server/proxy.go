@@ -7,10 +7,17 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"unsafe"
+
+	"github.com/tidwall/gjson"
 
 	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/app"
 	"github.com/eugener/gandalf/internal/ratelimit"
 )
 
@@ -21,6 +28,10 @@ var bodyPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
 // maxRequestBody is the maximum allowed request body size (4 MB).
 const maxRequestBody = 4 << 20
 
+// statusClientClosedRequest is recorded for streams the client abandoned
+// (nginx's non-standard 499).
+const statusClientClosedRequest = 499
+
 // decodeRequestBody reads the request body via bodyPool, unmarshals JSON into
 // v, and returns false (writing a 400) on error. Parse errors are logged
 // server-side; clients receive a static message to avoid leaking internals.
@@ -48,38 +59,112 @@ func decodeRequestBody(w http.ResponseWriter, r *http.Request, v any) bool {
 	return true
 }
 
+// defaultModel fills an omitted model from the caller's key default. Writes
+// 400 and returns false when the request has neither.
+func defaultModel(w http.ResponseWriter, identity *gateway.Identity, model *string) bool {
+	if *model != "" {
+		return true
+	}
+	if identity != nil && identity.DefaultModel != "" {
+		*model = identity.DefaultModel
+		return true
+	}
+	writeJSON(w, http.StatusBadRequest, errorResponse("model is required"))
+	return false
+}
+
 func (s *server) handleChatCompletion(w http.ResponseWriter, r *http.Request) {
 	var req gateway.ChatRequest
 	if !decodeRequestBody(w, r, &req) {
 		return
 	}
 
-	// Model allowlist check.
 	identity := gateway.IdentityFromContext(r.Context())
+	if !defaultModel(w, identity, &req.Model) {
+		return
+	}
+
+	// Model allowlist check.
 	if identity != nil && !identity.IsModelAllowed(req.Model) {
 		writeJSON(w, http.StatusForbidden, errorResponse("model not allowed"))
 		return
 	}
+	if s.modelBlocked(r.Context(), req.Model) {
+		writeJSON(w, http.StatusForbidden, errorResponse("model not allowed"))
+		return
+	}
+	if !s.requireUser(w, identity, req.User) {
+		return
+	}
+	if name := s.deniedTool(r.Context(), identity, req.Model, toolNames(gjson.GetBytes(req.Tools, "#.function.name"))); name != "" {
+		writeJSON(w, http.StatusForbidden, errorResponse("tool not allowed: "+name))
+		return
+	}
+	if !s.checkTokenBudget(w, r, identity, req.Model) {
+		return
+	}
+	if !requireCapabilities(w, r) {
+		return
+	}
+	if !s.betaFeatures(w, r) {
+		return
+	}
+	meta := requestUsageMeta(r, req.User)
+	debug := debugTrace(r, identity)
 
-	// TPM rate limit check (after body decode).
-	estimated := int64(100)
-	if s.deps.TokenCounter != nil {
-		estimated = int64(s.deps.TokenCounter.EstimateRequest(req.Model, req.Messages))
+	// Route-level default temperature. Applied before the cache check so a
+	// deterministic default (e.g. 0) makes the request cacheable.
+	s.applyRouteDefaults(r.Context(), &req)
+
+	// Fingerprint of the semantic request, for correlating identical
+	// requests in logs; cacheable requests reuse it for the cache key.
+	// Hashing costs ~14 allocs, so without the opt-in it is computed only
+	// when the cache needs it.
+	var fingerprint string
+	if s.deps.RequestFingerprint {
+		fingerprint = requestFingerprint(&req)
+		w.Header()[hdrRequestFingerprint] = []string{fingerprint}
+		gateway.SetRequestFingerprint(r.Context(), fingerprint)
 	}
 
-	if !s.consumeTPM(w, identity, estimated) {
+	// TPM rate limit check (after body decode).
+	estimated := s.estimateTokens(req.Model, req.Messages)
+
+	if !s.consumeTPM(w, r, identity, req.Model, estimated) {
 		return
 	}
+	if debug != nil {
+		debug.EstimatedTokens = estimated
+	}
 
 	// Cache check (non-streaming only). Guard identity != nil to prevent
 	// nil-pointer dereference when auth middleware is bypassed (e.g. tests).
 	if !req.Stream && s.deps.Cache != nil && identity != nil && isCacheable(&req) {
-		key := cacheKey(identity.KeyID, &req)
+		if fingerprint == "" {
+			fingerprint = requestFingerprint(&req)
+		}
+		key := scopedCacheKey(identity.KeyID, fingerprint)
 		if data, ok := s.deps.Cache.Get(r.Context(), key); ok {
 			if s.deps.Metrics != nil {
 				s.deps.Metrics.CacheHits.Inc()
 			}
-			s.recordUsage(r, identity, req.Model, nil, 0, http.StatusOK, true)
+			s.recordUsage(r, identity, meta, req.Model, nil, 0, http.StatusOK, true)
+			if s.deps.ResponseMetadata || debug != nil {
+				var cached gateway.ChatResponse
+				if err := json.Unmarshal(data, &cached); err == nil {
+					if s.deps.ResponseMetadata {
+						cached.Gandalf = &gateway.ResponseMeta{Model: cached.Model, Cached: true}
+					}
+					if debug != nil {
+						debug.Cache = "hit"
+					}
+					attachDebug(r.Context(), &cached)
+					setUsageHeaders(w, cached.Usage)
+					writeJSON(w, http.StatusOK, &cached)
+					return
+				}
+			}
+			setUsageHeaders(w, cachedUsage(data))
 			w.Header()["Content-Type"] = jsonCT
 			w.WriteHeader(http.StatusOK)
 			w.Write(data)
@@ -88,10 +173,17 @@ func (s *server) handleChatCompletion(w http.ResponseWriter, r *http.Request) {
 		if s.deps.Metrics != nil {
 			s.deps.Metrics.CacheMisses.Inc()
 		}
+		if debug != nil {
+			debug.Cache = "miss"
+		}
 	}
 
 	if req.Stream {
-		s.handleChatCompletionStream(w, r, &req, identity, estimated)
+		if s.wantsBufferedStream(r) {
+			s.handleChatCompletionBuffered(w, r, &req, identity, meta, estimated)
+		} else {
+			s.handleChatCompletionStream(w, r, &req, identity, meta, estimated)
+		}
 		return
 	}
 
@@ -104,26 +196,203 @@ func (s *server) handleChatCompletion(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.adjustTPM(identity, estimated, resp.Usage)
+	s.filterOutput(r.Context(), resp)
+	setSchemaViolationHeader(w, r.Context())
 
 	// Cache store.
-	if s.deps.Cache != nil && identity != nil && isCacheable(&req) {
+	if s.deps.Cache != nil && identity != nil && isCacheable(&req) && s.cacheableResponse(r.Context(), &req, resp) {
 		if data, err := json.Marshal(resp); err == nil {
-			s.deps.Cache.Set(r.Context(), cacheKey(identity.KeyID, &req), data, s.cacheTTL(r.Context(), &req))
+			if fingerprint == "" {
+				fingerprint = requestFingerprint(&req)
+			}
+			s.deps.Cache.Set(r.Context(), scopedCacheKey(identity.KeyID, fingerprint), data, s.cacheTTL(r.Context(), &req))
 		}
 	}
 
-	s.recordUsage(r, identity, req.Model, resp.Usage, elapsed, http.StatusOK, false)
+	s.recordUsage(r, identity, meta, req.Model, resp.Usage, elapsed, http.StatusOK, false)
+	if s.deps.ShadowEval != nil {
+		s.deps.ShadowEval.Observe(r.Context(), &req, resp, elapsed)
+	}
+	if s.deps.EvalSampler != nil {
+		s.deps.EvalSampler.Observe(r.Context(), &req, resp, elapsed)
+	}
+	s.setResponseMeta(r.Context(), resp)
+	attachDebug(r.Context(), resp)
+	setUsageHeaders(w, resp.Usage)
 	writeJSON(w, http.StatusOK, resp)
 }
 
+// setUsageHeaders exposes token usage as X-Gandalf-*-Tokens response
+// headers for clients that account without parsing the body. Must run
+// before the status is written; no-op when usage is unknown.
+func setUsageHeaders(w http.ResponseWriter, u *gateway.Usage) {
+	if u == nil {
+		return
+	}
+	h := w.Header()
+	h[hdrPromptTokens] = []string{strconv.Itoa(u.PromptTokens)}
+	h[hdrCompletionTokens] = []string{strconv.Itoa(u.CompletionTokens)}
+	h[hdrTotalTokens] = []string{strconv.Itoa(u.TotalTokens)}
+}
+
+// setSchemaViolationHeader reports, under the annotate policy, why the
+// response broke its route's response schema. No-op for conforming
+// responses. Must run before the status is written.
+func setSchemaViolationHeader(w http.ResponseWriter, ctx context.Context) {
+	if reason := gateway.SchemaViolationFromContext(ctx); reason != "" {
+		w.Header().Set(hdrSchemaViolation, reason)
+	}
+}
+
+// cachedUsage extracts the usage block from a cached response body without
+// decoding the whole response.
+func cachedUsage(data []byte) *gateway.Usage {
+	u := gjson.GetBytes(data, "usage")
+	if !u.IsObject() {
+		return nil
+	}
+	return &gateway.Usage{
+		PromptTokens:     int(u.Get("prompt_tokens").Int()),
+		CompletionTokens: int(u.Get("completion_tokens").Int()),
+		TotalTokens:      int(u.Get("total_tokens").Int()),
+	}
+}
+
+// requireCapabilities records the capabilities listed in X-Gandalf-Require
+// (comma-separated, e.g. "vision,tools") so routing skips targets without
+// them. Writes a 400 and returns false for an unknown name.
+func requireCapabilities(w http.ResponseWriter, r *http.Request) bool {
+	v := r.Header.Get(hdrRequire)
+	if v == "" {
+		return true
+	}
+	var names []string
+	for name := range strings.SplitSeq(v, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !gateway.IsCapability(name) {
+			writeJSON(w, http.StatusBadRequest, errorResponse("invalid "+hdrRequire+" header: unknown capability "+strconv.Quote(name)))
+			return false
+		}
+		names = append(names, name)
+	}
+	gateway.SetRequiredCapabilities(r.Context(), names)
+	return true
+}
+
+// betaHeaders pairs each provider type whose adapter forwards beta features
+// with the request header clients list them in. key is the header's
+// canonical form, so lookups don't canonicalize per request.
+var betaHeaders = []struct{ providerType, header, key string }{
+	{"anthropic", hdrAnthropicBeta, http.CanonicalHeaderKey(hdrAnthropicBeta)},
+	{"openai", hdrOpenAIBeta, http.CanonicalHeaderKey(hdrOpenAIBeta)},
+}
+
+// betaFeatures records the beta features listed in X-Anthropic-Beta or
+// X-OpenAI-Beta (comma-separated) for providers of that type to enable.
+// Each must be on the server's allowlist for the type; otherwise it writes
+// a 400 and returns false. Without an allowlist the headers are ignored.
+func (s *server) betaFeatures(w http.ResponseWriter, r *http.Request) bool {
+	if len(s.deps.BetaFeatures) == 0 {
+		return true
+	}
+	for _, bh := range betaHeaders {
+		providerType, hdr := bh.providerType, bh.header
+		var v string
+		if vs := r.Header[bh.key]; len(vs) > 0 {
+			v = vs[0]
+		}
+		if v == "" {
+			continue
+		}
+		var features []string
+		for name := range strings.SplitSeq(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if !slices.Contains(s.deps.BetaFeatures[providerType], name) {
+				writeJSON(w, http.StatusBadRequest, errorResponse("invalid "+hdr+" header: beta feature not allowed "+strconv.Quote(name)))
+				return false
+			}
+			features = append(features, name)
+		}
+		gateway.SetBetaFeatures(r.Context(), providerType, features)
+	}
+	return true
+}
+
+// debugTrace enables a debug trace when the caller sends X-Gandalf-Debug:
+// true and may manage routes (admin). The header is ignored for everyone
+// else, so the response is unchanged.
+func debugTrace(r *http.Request, identity *gateway.Identity) *gateway.DebugTrace {
+	if identity == nil || !identity.Can(gateway.PermManageRoutes) {
+		return nil
+	}
+	// An absent header returns before ParseBool, whose error allocates.
+	v := r.Header.Get(hdrDebug)
+	if v == "" {
+		return nil
+	}
+	if on, _ := strconv.ParseBool(v); !on {
+		return nil
+	}
+	return gateway.EnableDebugTrace(r.Context())
+}
+
+// attachDebug adds the request's debug trace, if any, to resp. Like
+// setResponseMeta it runs after the cache store.
+func attachDebug(ctx context.Context, resp *gateway.ChatResponse) {
+	if dt := gateway.DebugTraceFromContext(ctx); dt != nil {
+		dt.Finish()
+		resp.Debug = dt
+	}
+}
+
+// setResponseMeta attaches the x_gandalf block to a freshly served response
+// when Deps.ResponseMetadata is enabled. Called after the cache store so
+// cached bytes never carry per-request metadata.
+func (s *server) setResponseMeta(ctx context.Context, resp *gateway.ChatResponse) {
+	if !s.deps.ResponseMetadata {
+		return
+	}
+	provider, model := gateway.RequestTargetFromContext(ctx)
+	if model == "" {
+		model = resp.Model
+	}
+	resp.Gandalf = &gateway.ResponseMeta{Provider: provider, Model: model}
+}
+
 // handleChatCompletionStream handles SSE streaming chat completion requests.
-func (s *server) handleChatCompletionStream(w http.ResponseWriter, r *http.Request, req *gateway.ChatRequest, identity *gateway.Identity, estimated int64) {
+// meta is threaded through to finishStream so the final usage record carries
+// the same client metadata as a non-streaming request.
+func (s *server) handleChatCompletionStream(w http.ResponseWriter, r *http.Request, req *gateway.ChatRequest, identity *gateway.Identity, meta usageMeta, estimated int64) {
+	// Held until the handler returns: stream end, upstream error, or client
+	// disconnect.
+	if limit := s.streamLimit(identity); limit > 0 {
+		if !s.deps.Streams.TryAcquire(identity.KeyID, limit) {
+			s.rejectStream(w, r, identity, req.Model, estimated)
+			return
+		}
+		defer s.deps.Streams.Release(identity.KeyID)
+	}
 	start := time.Now()
 	ch, err := s.deps.Proxy.ChatCompletionStream(r.Context(), req)
 	if err != nil {
+		if s.canDowngradeStream(r.Context(), err) {
+			s.handleStreamDowngrade(w, r, req, identity, meta, estimated, start, err)
+			return
+		}
 		writeUpstreamError(w, r.Context(), err)
 		return
 	}
+	setSchemaViolationHeader(w, r.Context())
+	if s.deps.OutputFilter != nil && s.deps.FilterStreams {
+		s.handleFilteredStream(w, r, req, identity, meta, estimated, start, ch)
+		return
+	}
 
 	writeSSEHeaders(w)
 	flusher, ok := w.(http.Flusher)
@@ -142,18 +411,25 @@ func (s *server) handleChatCompletionStream(w http.ResponseWriter, r *http.Reque
 		}
 	}()
 
+	// Tool-call arguments are only accumulated when repair is enabled.
+	var agg *streamAggregate
+	if s.deps.RepairToolArguments {
+		agg = &streamAggregate{}
+	}
+
 	var usage *gateway.Usage
 	for {
 		// Fast path: drain channel without ticker select when possible.
 		if keepAlive == nil {
 			select {
 			case chunk, chOpen := <-ch:
-				if usage, ok = s.processStreamChunk(w, flusher, r, chunk, chOpen, req, identity, estimated, usage, start); !ok {
+				if usage, ok = s.processStreamChunk(w, flusher, r, chunk, chOpen, req, identity, &meta, estimated, usage, start, agg); !ok {
 					return
 				}
 				// First data chunk sent; start keep-alive for long streams.
 				keepAlive = time.NewTicker(15 * time.Second)
 			case <-r.Context().Done():
+				s.cancelStream(r, req, identity, &meta, estimated, usage, start)
 				return
 			}
 			continue
@@ -161,13 +437,14 @@ func (s *server) handleChatCompletionStream(w http.ResponseWriter, r *http.Reque
 
 		select {
 		case chunk, chOpen := <-ch:
-			if usage, ok = s.processStreamChunk(w, flusher, r, chunk, chOpen, req, identity, estimated, usage, start); !ok {
+			if usage, ok = s.processStreamChunk(w, flusher, r, chunk, chOpen, req, identity, &meta, estimated, usage, start, agg); !ok {
 				return
 			}
 		case <-keepAlive.C:
 			writeSSEKeepAlive(w)
 			flusher.Flush()
 		case <-r.Context().Done():
+			s.cancelStream(r, req, identity, &meta, estimated, usage, start)
 			return
 		}
 	}
@@ -180,13 +457,13 @@ func (s *server) handleChatCompletionStream(w http.ResponseWriter, r *http.Reque
 func (s *server) processStreamChunk(
 	w http.ResponseWriter, flusher http.Flusher, r *http.Request,
 	chunk gateway.StreamChunk, chOpen bool,
-	req *gateway.ChatRequest, identity *gateway.Identity, estimated int64,
-	usage *gateway.Usage, start time.Time,
+	req *gateway.ChatRequest, identity *gateway.Identity, meta *usageMeta, estimated int64,
+	usage *gateway.Usage, start time.Time, agg *streamAggregate,
 ) (*gateway.Usage, bool) {
 	if !chOpen {
-		writeSSEDone(w)
+		s.endStream(w, usage, agg)
 		flusher.Flush()
-		s.finishStream(r, req, identity, estimated, usage, start, http.StatusOK)
+		s.finishStream(r, req, identity, meta, estimated, usage, start, http.StatusOK)
 		return usage, false
 	}
 	if chunk.Err != nil {
@@ -196,32 +473,110 @@ func (s *server) processStreamChunk(
 		writeSSEError(w, "upstream stream error")
 		writeSSEDone(w)
 		flusher.Flush()
-		s.finishStream(r, req, identity, estimated, usage, start, http.StatusBadGateway)
+		s.finishStream(r, req, identity, meta, estimated, usage, start, http.StatusBadGateway)
 		return usage, false
 	}
 	if chunk.Usage != nil {
 		usage = chunk.Usage
 	}
 	if chunk.Done {
-		writeSSEDone(w)
+		s.endStream(w, usage, agg)
 		flusher.Flush()
-		s.finishStream(r, req, identity, estimated, usage, start, http.StatusOK)
+		s.finishStream(r, req, identity, meta, estimated, usage, start, http.StatusOK)
 		return usage, false
 	}
+	if agg != nil {
+		agg.add(chunk.Data)
+	}
 	writeSSEData(w, chunk.Data)
 	flusher.Flush()
+	meta.delivered += s.deliveredTokens(req.Model, chunk.Data)
+	if meta.ttfb == 0 {
+		meta.ttfb = time.Since(start)
+	}
 	return usage, true
 }
 
+// endStream writes everything that follows the last upstream chunk of a
+// successful stream: tool argument repairs, usage (as a comment, and as an
+// "event: usage" frame when enabled), then [DONE].
+func (s *server) endStream(w http.ResponseWriter, usage *gateway.Usage, agg *streamAggregate) {
+	if agg != nil {
+		writeToolArgRepairs(w, agg)
+	}
+	writeSSEUsage(w, usage)
+	if s.deps.StreamUsageEvent {
+		writeSSEUsageEvent(w, usage)
+	}
+	writeSSEDone(w)
+}
+
 // finishStream adjusts TPM and records usage after stream completion.
-func (s *server) finishStream(r *http.Request, req *gateway.ChatRequest, identity *gateway.Identity, estimated int64, usage *gateway.Usage, start time.Time, status int) {
+func (s *server) finishStream(r *http.Request, req *gateway.ChatRequest, identity *gateway.Identity, meta *usageMeta, estimated int64, usage *gateway.Usage, start time.Time, status int) {
 	s.adjustTPM(identity, estimated, usage)
-	s.recordUsage(r, identity, req.Model, usage, time.Since(start), status, false)
+	s.recordUsage(r, identity, *meta, req.Model, usage, time.Since(start), status, false)
+}
+
+// cancelStream records usage for a stream the client abandoned. Unless the
+// provider already reported usage, the prompt is charged at its estimate and
+// the completion at an estimate of what was delivered, not at what the
+// provider might have gone on to generate. The record is marked canceled
+// with status 499.
+func (s *server) cancelStream(r *http.Request, req *gateway.ChatRequest, identity *gateway.Identity, meta *usageMeta, estimated int64, usage *gateway.Usage, start time.Time) {
+	if usage == nil {
+		usage = &gateway.Usage{
+			PromptTokens:     int(estimated),
+			CompletionTokens: meta.delivered,
+			TotalTokens:      int(estimated) + meta.delivered,
+		}
+	}
+	meta.canceled = true
+	s.finishStream(r, req, identity, meta, estimated, usage, start, statusClientClosedRequest)
+}
+
+// deliveredTokens estimates the tokens of generated text (reasoning,
+// content and tool call arguments) in one stream chunk. It reads the chunk
+// through a string view instead of copying it, and counts raw JSON string
+// bodies rather than unescaped ones, so nothing is allocated per chunk.
+func (s *server) deliveredTokens(model string, data []byte) int {
+	if len(data) == 0 {
+		return 0
+	}
+	n := 0
+	root := gjson.Parse(unsafe.String(unsafe.SliceData(data), len(data)))
+	root.Get("choices").ForEach(func(_, c gjson.Result) bool {
+		delta := c.Get("delta")
+		n += s.countDelivered(model, delta.Get("reasoning_content"))
+		n += s.countDelivered(model, delta.Get("reasoning"))
+		n += s.countDelivered(model, delta.Get("content"))
+		delta.Get("tool_calls").ForEach(func(_, tc gjson.Result) bool {
+			n += s.countDelivered(model, tc.Get("function.arguments"))
+			return true
+		})
+		return true
+	})
+	return n
 }
 
-// getLimiter returns the rate limiter for the identity, applying default
-// RPM/TPM from config when per-key limits are zero.
+// countDelivered estimates the tokens in a JSON string value with the
+// TokenCounter when one is configured, else at ~4 bytes per token like
+// estimateTokens. FixedTokenEstimate is a per-request prompt figure and
+// does not apply.
+func (s *server) countDelivered(model string, v gjson.Result) int {
+	if v.Type != gjson.String || len(v.Raw) < 3 {
+		return 0
+	}
+	text := v.Raw[1 : len(v.Raw)-1]
+	if s.deps.TokenCounter != nil {
+		return s.deps.TokenCounter.CountText(model, text)
+	}
+	return (len(text) + 3) / 4
+}
+
+// getLimiter returns the rate limiter the identity's requests are charged
+// to, applying default RPM/TPM from config when per-key limits are zero.
 func (s *server) getLimiter(id *gateway.Identity) *ratelimit.Limiter {
+	id = id.Billed()
 	if s.deps.RateLimiter == nil || id == nil || id.KeyID == "" {
 		return nil
 	}
@@ -240,8 +595,26 @@ func (s *server) getLimiter(id *gateway.Identity) *ratelimit.Limiter {
 	return s.deps.RateLimiter.GetOrCreate(id.KeyID, limits)
 }
 
+// estimateTokens estimates a request's prompt tokens for TPM limiting. It
+// uses the TokenCounter when one is configured; otherwise FixedTokenEstimate
+// when set, else ~4 bytes of message text per token, so the estimate still
+// grows with the request.
+func (s *server) estimateTokens(model string, messages []gateway.Message) int64 {
+	if s.deps.TokenCounter != nil {
+		return int64(s.deps.TokenCounter.EstimateRequest(model, messages))
+	}
+	if s.deps.FixedTokenEstimate > 0 {
+		return s.deps.FixedTokenEstimate
+	}
+	var n int
+	for _, m := range messages {
+		n += len(m.Role) + len(m.Name) + len(m.Content) + len(m.ToolCalls) + len(m.ToolCallID)
+	}
+	return max(int64(n+3)/4, 1)
+}
+
 // consumeTPM checks the TPM limit, sets headers, and returns false if denied.
-func (s *server) consumeTPM(w http.ResponseWriter, identity *gateway.Identity, estimated int64) bool {
+func (s *server) consumeTPM(w http.ResponseWriter, r *http.Request, identity *gateway.Identity, model string, estimated int64) bool {
 	if limiter := s.getLimiter(identity); limiter != nil {
 		result := limiter.ConsumeTPM(estimated)
 		setTPMHeaders(w, result)
@@ -249,6 +622,7 @@ func (s *server) consumeTPM(w http.ResponseWriter, identity *gateway.Identity, e
 			if s.deps.Metrics != nil {
 				s.deps.Metrics.RateLimitRejects.WithLabelValues("tpm").Inc()
 			}
+			s.logRejection(r.Context(), model, "tpm limit exceeded")
 			writeRateLimitError(w, result)
 			return false
 		}
@@ -256,6 +630,31 @@ func (s *server) consumeTPM(w http.ResponseWriter, identity *gateway.Identity, e
 	return true
 }
 
+// streamLimit returns the concurrent stream limit for the identity's key:
+// the per-key limit, else Deps.DefaultMaxStreams. 0 means unlimited.
+func (s *server) streamLimit(id *gateway.Identity) int64 {
+	if s.deps.Streams == nil || id == nil || id.KeyID == "" {
+		return 0
+	}
+	if id.MaxStreams > 0 {
+		return id.MaxStreams
+	}
+	return s.deps.DefaultMaxStreams
+}
+
+// rejectStream answers a stream over the key's concurrent stream limit
+// with 429 and refunds the TPM estimate charged for it.
+func (s *server) rejectStream(w http.ResponseWriter, r *http.Request, identity *gateway.Identity, model string, estimated int64) {
+	if limiter := s.getLimiter(identity); limiter != nil {
+		limiter.AdjustTPM(estimated)
+	}
+	if s.deps.Metrics != nil {
+		s.deps.Metrics.RateLimitRejects.WithLabelValues("streams").Inc()
+	}
+	s.logRejection(r.Context(), model, "concurrent stream limit exceeded")
+	writeJSON(w, http.StatusTooManyRequests, errorResponse("too many concurrent streams"))
+}
+
 // adjustTPM corrects the TPM bucket after receiving actual usage.
 func (s *server) adjustTPM(identity *gateway.Identity, estimated int64, usage *gateway.Usage) {
 	if usage == nil {
@@ -266,8 +665,76 @@ func (s *server) adjustTPM(identity *gateway.Identity, estimated int64, usage *g
 	}
 }
 
+// tagsHeader carries comma-separated client tags that are copied onto the
+// request's usage records for attribution (e.g. "team-a,batch").
+const tagsHeader = "X-Gandalf-Tags"
+
+// Bounds on client-supplied tags so a caller can't bloat usage storage.
+const (
+	maxUsageTags   = 16
+	maxUsageTagLen = 64
+)
+
+// usageMeta is client-supplied request metadata captured once at request
+// start and copied onto every usage record for the request, plus the
+// stream's time to first chunk once it is known.
+type usageMeta struct {
+	user string
+	tags []string
+	ttfb time.Duration // 0 until a stream sends its first content chunk
+
+	delivered int  // estimated completion tokens a stream has sent
+	canceled  bool // the client disconnected before the stream ended
+}
+
+// requestUsageMeta captures usage metadata from the request. user is the
+// body's "user" field. No allocation when the tags header is absent.
+func requestUsageMeta(r *http.Request, user string) usageMeta {
+	meta := usageMeta{user: user}
+	for _, v := range r.Header[tagsHeader] {
+		for tag := range strings.SplitSeq(v, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "" || len(tag) > maxUsageTagLen {
+				continue
+			}
+			if len(meta.tags) == maxUsageTags {
+				return meta
+			}
+			meta.tags = append(meta.tags, tag)
+		}
+	}
+	return meta
+}
+
+// checkTokenBudget rejects the request with 429 if any token budget for the
+// caller's key or org (overall or for this model) is exhausted.
+func (s *server) checkTokenBudget(w http.ResponseWriter, r *http.Request, identity *gateway.Identity, model string) bool {
+	if s.deps.TokenBudget == nil || identity == nil {
+		return true
+	}
+	if billed := identity.Billed(); !s.deps.TokenBudget.Check(billed.KeyID, billed.OrgID, model) {
+		if s.deps.Metrics != nil {
+			s.deps.Metrics.RateLimitRejects.WithLabelValues("token_budget").Inc()
+		}
+		s.logRejection(r.Context(), model, "token budget exceeded")
+		writeJSON(w, http.StatusTooManyRequests, errorResponse("token budget exceeded"))
+		return false
+	}
+	return true
+}
+
 // recordUsage sends a usage record to the async recorder and updates token metrics.
-func (s *server) recordUsage(r *http.Request, identity *gateway.Identity, model string, usage *gateway.Usage, elapsed time.Duration, status int, cached bool) {
+// Token budgets are charged even when no recorder is configured. Everything
+// is charged to the billed key, the pool member after a pool fallback.
+func (s *server) recordUsage(r *http.Request, identity *gateway.Identity, meta usageMeta, model string, usage *gateway.Usage, elapsed time.Duration, status int, cached bool) {
+	identity = identity.Billed()
+	if s.deps.TokenBudget != nil && identity != nil && usage != nil {
+		s.deps.TokenBudget.Consume(identity.KeyID, identity.OrgID, model, int64(usage.TotalTokens))
+	}
+	// One count per usage record, matching what a restart seeds from.
+	if s.deps.RequestQuota != nil && identity != nil && identity.MaxRequests > 0 {
+		s.deps.RequestQuota.Record(r.Context(), identity.KeyID, ratelimit.BudgetPeriod(identity.RequestPeriod))
+	}
 	if s.deps.Usage == nil {
 		return
 	}
@@ -276,8 +743,15 @@ func (s *server) recordUsage(r *http.Request, identity *gateway.Identity, model
 		LatencyMs:  int(elapsed.Milliseconds()),
 		StatusCode: status,
 		RequestID:  gateway.RequestIDFromContext(r.Context()),
+		EndUser:    meta.user,
+		Tags:       meta.tags,
 		CreatedAt:  time.Now(),
 		Cached:     cached,
+		Canceled:   meta.canceled,
+	}
+	if meta.ttfb > 0 {
+		// Round up so a sub-millisecond first chunk still marks a stream.
+		rec.TTFBMs = max(int(meta.ttfb.Milliseconds()), 1)
 	}
 	if identity != nil {
 		rec.KeyID = identity.KeyID
@@ -289,19 +763,119 @@ func (s *server) recordUsage(r *http.Request, identity *gateway.Identity, model
 		rec.PromptTokens = usage.PromptTokens
 		rec.CompletionTokens = usage.CompletionTokens
 		rec.TotalTokens = usage.TotalTokens
+		rec.CostUSD = s.costModel().Cost(pricedModel(r.Context(), model), usage, identity)
 		if s.deps.Metrics != nil {
 			s.deps.Metrics.TokensProcessed.WithLabelValues(model, "prompt").Add(float64(usage.PromptTokens))
 			s.deps.Metrics.TokensProcessed.WithLabelValues(model, "completion").Add(float64(usage.CompletionTokens))
 		}
 	}
 	if s.deps.Quota != nil && identity != nil && identity.MaxBudget > 0 && usage != nil {
-		cost := estimateCost(model, usage)
-		rec.CostUSD = cost
-		s.deps.Quota.Consume(identity.KeyID, cost)
+		s.deps.Quota.Consume(identity.KeyID, rec.CostUSD)
 	}
 	s.deps.Usage.Record(rec)
 }
 
+// applyRouteDefaults fills omitted request fields from route configuration.
+// The default is copied so the request never aliases the cached route value.
+func (s *server) applyRouteDefaults(ctx context.Context, req *gateway.ChatRequest) {
+	if req.Temperature != nil || s.deps.Router == nil {
+		return
+	}
+	if t := s.deps.Router.DefaultTemperature(ctx, req.Model); t != nil {
+		temp := *t
+		req.Temperature = &temp
+	}
+}
+
+// modelBlocked reports whether the global model policy blocks a request
+// for model. Deps.ModelDenylist blocks it when the requested name, any of
+// its normalized forms, the route alias it resolves to, or any of that
+// route's target models is listed. When Deps.ModelAllowlist is set, one of
+// the requested names must be listed, and so must every target model, since
+// the targets are what actually serve the request. Applies to every key,
+// admins included, on top of per-key allowlists.
+func (s *server) modelBlocked(ctx context.Context, model string) bool {
+	if len(s.deps.ModelDenylist) == 0 && len(s.deps.ModelAllowlist) == 0 {
+		return false
+	}
+	names, targets := []string{model}, []string(nil)
+	if s.deps.Router != nil {
+		names, targets = s.deps.Router.PolicyModels(ctx, model)
+	}
+	denied := func(m string) bool { return slices.Contains(s.deps.ModelDenylist, m) }
+	if slices.ContainsFunc(names, denied) || slices.ContainsFunc(targets, denied) {
+		return true
+	}
+	if len(s.deps.ModelAllowlist) == 0 {
+		return false
+	}
+	allowed := func(m string) bool { return slices.Contains(s.deps.ModelAllowlist, m) }
+	if !slices.ContainsFunc(names, allowed) {
+		return true
+	}
+	for _, t := range targets {
+		if !allowed(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// requireUser writes 400 and returns false when the caller's org is on
+// Deps.RequireUserOrgs and the request has no user field.
+func (s *server) requireUser(w http.ResponseWriter, identity *gateway.Identity, user string) bool {
+	if !s.missingUser(identity, user) {
+		return true
+	}
+	writeJSON(w, http.StatusBadRequest, errorResponse("user is required"))
+	return false
+}
+
+// missingUser reports whether the caller's org is on Deps.RequireUserOrgs
+// and user is blank.
+func (s *server) missingUser(identity *gateway.Identity, user string) bool {
+	return strings.TrimSpace(user) == "" && identity != nil && slices.Contains(s.deps.RequireUserOrgs, identity.OrgID)
+}
+
+// deniedTool returns the first of names, the tool (function) names a
+// request for model declares, that is on the route's or the caller's org's
+// denylist (case-insensitive), or "" if none is.
+func (s *server) deniedTool(ctx context.Context, identity *gateway.Identity, model string, names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var denied []string
+	if identity != nil {
+		denied = s.deps.OrgDeniedTools[identity.OrgID]
+	}
+	if s.deps.Router != nil {
+		denied = append(slices.Clip(denied), s.deps.Router.DeniedTools(ctx, model)...)
+	}
+	for _, name := range names {
+		for _, d := range denied {
+			if strings.EqualFold(name, d) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// toolNames returns the strings in v, flattening nested arrays such as
+// the result of a "tools.#.functionDeclarations.#.name" path.
+func toolNames(v gjson.Result) []string {
+	var names []string
+	v.ForEach(func(_, e gjson.Result) bool {
+		if e.IsArray() {
+			names = append(names, toolNames(e)...)
+		} else if e.Type == gjson.String {
+			names = append(names, e.Str)
+		}
+		return true
+	})
+	return names
+}
+
 // cacheTTL returns the cache TTL for a request. Checks route-level
 // cache_ttl_s first (allows per-model TTL tuning), falls back to 5m default.
 func (s *server) cacheTTL(ctx context.Context, req *gateway.ChatRequest) time.Duration {
@@ -313,14 +887,44 @@ func (s *server) cacheTTL(ctx context.Context, req *gateway.ChatRequest) time.Du
 	return 5 * time.Minute
 }
 
-// estimateCost provides a rough USD cost estimate based on model and token counts.
-// These are approximate and should be replaced with a proper pricing table.
-func estimateCost(model string, usage *gateway.Usage) float64 {
-	if usage == nil {
-		return 0
+// cacheableResponse reports whether resp may be stored. Routes with
+// CacheStopOnly reject any choice that didn't finish with "stop" (length,
+// content_filter, tool_calls), since clients usually retry those with
+// different parameters.
+func (s *server) cacheableResponse(ctx context.Context, req *gateway.ChatRequest, resp *gateway.ChatResponse) bool {
+	if gateway.SchemaViolationFromContext(ctx) != "" {
+		return false
+	}
+	if s.deps.Router == nil || !s.deps.Router.CacheStopOnly(ctx, req.Model) {
+		return true
+	}
+	for _, c := range resp.Choices {
+		if c.FinishReason != "stop" {
+			return false
+		}
 	}
-	// Default: $0.01 per 1K tokens (rough average).
-	return float64(usage.TotalTokens) * 0.00001
+	return true
+}
+
+// flatCostModel prices every model at the static default's flat rate.
+var flatCostModel = app.NewStaticCostModel(nil)
+
+// pricedModel returns the upstream model that served the request, which is
+// what the provider bills, falling back to the requested model when no
+// target was recorded (cache hits).
+func pricedModel(ctx context.Context, requested string) string {
+	if _, model := gateway.RequestTargetFromContext(ctx); model != "" {
+		return model
+	}
+	return requested
+}
+
+// costModel returns the configured cost model, or the flat-rate default.
+func (s *server) costModel() CostModel {
+	if s.deps.CostModel != nil {
+		return s.deps.CostModel
+	}
+	return flatCostModel
 }
 
 type apiError struct {
@@ -340,13 +944,29 @@ func errorResponse(msg string) apiError {
 // writeUpstreamError logs the full error server-side and returns a sanitized
 // message to the client. Both 4xx and 5xx responses use generic status text
 // to avoid leaking upstream provider internals (URLs, org IDs, quota details).
+//
+// ErrNoProvider and ErrDimensionMismatch are the exceptions: their messages
+// carry only the model alias and vector sizes (nothing the client doesn't
+// already know), so they are returned verbatim to make misconfiguration obvious.
+// ErrSchemaViolation likewise names only the failing path in the response.
 func writeUpstreamError(w http.ResponseWriter, ctx context.Context, err error) {
 	status := errorStatus(err)
 	slog.LogAttrs(ctx, slog.LevelError, "upstream error",
 		slog.Int("status", status),
 		slog.String("error", err.Error()),
 	)
-	writeJSON(w, status, errorResponse(http.StatusText(status)))
+	writeJSON(w, status, errorResponse(upstreamErrorMessage(err, status)))
+}
+
+// upstreamErrorMessage is the client-facing message for a proxy error. Only
+// gateway-generated errors are shown verbatim; anything that may carry
+// upstream detail is reduced to the status text.
+func upstreamErrorMessage(err error, status int) string {
+	if errors.Is(err, gateway.ErrNoProvider) || errors.Is(err, gateway.ErrDimensionMismatch) || errors.Is(err, gateway.ErrMissingField) ||
+		errors.Is(err, gateway.ErrNoCapableTarget) || errors.Is(err, gateway.ErrSchemaViolation) {
+		return err.Error()
+	}
+	return http.StatusText(status)
 }
 
 func errorStatus(err error) int {
@@ -361,8 +981,14 @@ func errorStatus(err error) int {
 		return http.StatusTooManyRequests
 	case errors.Is(err, gateway.ErrConflict):
 		return http.StatusConflict
-	case errors.Is(err, gateway.ErrBadRequest):
+	case errors.Is(err, gateway.ErrBadRequest), errors.Is(err, gateway.ErrMissingField), errors.Is(err, gateway.ErrNoCapableTarget):
 		return http.StatusBadRequest
+	case errors.Is(err, gateway.ErrNoProvider):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, gateway.ErrDimensionMismatch), errors.Is(err, gateway.ErrSchemaViolation):
+		return http.StatusBadGateway
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
 	default:
 		return http.StatusInternalServerError
 	}
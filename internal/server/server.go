@@ -4,6 +4,7 @@ package server
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
@@ -25,15 +26,44 @@ type UsageRecorder interface {
 	Record(gateway.UsageRecord)
 }
 
-// TokenCounter estimates token counts for request messages.
+// TokenCounter estimates token counts for request messages and plain text.
 type TokenCounter interface {
 	EstimateRequest(model string, messages []gateway.Message) int
+	CountText(model, text string) int
 }
 
 // QuotaChecker verifies and tracks spend budgets.
 type QuotaChecker interface {
 	Check(keyID string, limit float64) bool
 	Consume(keyID string, costUSD float64)
+	Consumed(keyID string) float64 // spend in the current budget period
+}
+
+// RequestQuotaChecker enforces per-key request-count quotas. Requests are
+// counted with Record where their usage record is written.
+type RequestQuotaChecker interface {
+	Check(ctx context.Context, keyID string, limit int64, period ratelimit.BudgetPeriod) bool
+	Record(ctx context.Context, keyID string, period ratelimit.BudgetPeriod)
+	Used(ctx context.Context, keyID string, period ratelimit.BudgetPeriod) int64 // requests in the current period
+}
+
+// TokenBudgetChecker verifies and tracks raw token budgets per key/org/model.
+type TokenBudgetChecker interface {
+	Check(keyID, orgID, model string) bool
+	Consume(keyID, orgID, model string, tokens int64)
+}
+
+// CostModel prices a request's token usage in USD. model is the upstream
+// model that served the request, not the requested alias. The identity lets
+// implementations apply org- or key-specific rates such as negotiated
+// discounts. app.StaticCostModel is the table-driven default.
+type CostModel interface {
+	Cost(model string, usage *gateway.Usage, identity *gateway.Identity) float64
+}
+
+// AnomalySource serves precomputed usage anomalies for an org, newest first.
+type AnomalySource interface {
+	Anomalies(orgID string) []gateway.UsageAnomaly
 }
 
 // KeyInvalidator invalidates cached auth entries when keys are modified.
@@ -55,12 +85,131 @@ type Deps struct {
 	ReadyCheck     ReadyChecker        // nil = always ready (for tests)
 	Usage        UsageRecorder        // nil = no usage recording
 	RateLimiter  *ratelimit.Registry  // nil = no rate limiting
-	TokenCounter TokenCounter         // nil = fixed estimate
+	Concurrency  *ratelimit.ConcurrencyLimiter // nil = unlimited concurrent requests
+	TokenCounter TokenCounter         // nil = FixedTokenEstimate, or a byte-size estimate when that is 0
+	FixedTokenEstimate int64          // flat per-request token estimate when TokenCounter is nil (0 = ~4 bytes per token)
 	Cache        Cache                // nil = no caching
 	Quota          QuotaChecker         // nil = no quota enforcement
+	RequestQuota   RequestQuotaChecker  // nil = no request-count quotas
+	TokenBudget    TokenBudgetChecker   // nil = no token budget enforcement
+	CostModel      CostModel            // nil = flat $0.01 per 1K tokens
+	Threads        storage.ThreadStore  // nil = no /v1/threads endpoints
+	ShadowEval     *app.ShadowEvaluator // nil = no shadow evaluation sampling
+	EvalSampler    *app.EvalSampler     // nil = no eval dataset sampling
+	Evals          storage.EvalCaptureStore // nil = no /admin/v1/eval/export endpoint
+	Backup         storage.BackupStore  // nil = no /admin/v1/backup and /restore endpoints
 	KeyInvalidator KeyInvalidator       // nil = no auth cache invalidation
+	ErrorLog       *app.ErrorLog        // nil = no /admin/v1/errors/recent endpoint
+	LatencyStats   *app.LatencyStats    // nil = no /admin/v1/providers/latency endpoint
+	Audit          storage.AuditStore   // nil = no audit trail and no /admin/v1/audit endpoint
+	Anomalies      AnomalySource        // nil = no /admin/v1/usage/anomalies endpoint
 	DefaultRPM     int64               // fallback RPM when per-key is 0
 	DefaultTPM     int64               // fallback TPM when per-key is 0
+	Streams        *ratelimit.StreamLimiter // nil = no concurrent stream limits
+	DefaultMaxStreams int64            // fallback stream limit when per-key is 0 (0 = unlimited)
+	MaxDeadline    time.Duration       // clamp for X-Gandalf-Deadline (0 = no clamp)
+
+	// BufferStreams answers every stream:true chat request with a single
+	// aggregated JSON response. Clients can also opt in per request with
+	// X-Gandalf-Buffer-Stream: true.
+	BufferStreams bool
+
+	// RepairToolArguments validates streamed tool-call arguments when the
+	// stream completes. Truncated JSON is closed with a final delta where
+	// possible and flagged invalid otherwise. Off by default.
+	RepairToolArguments bool
+
+	// StreamUsageEvent emits the final stream usage as a separate
+	// "event: usage" SSE frame before [DONE]. Off by default.
+	StreamUsageEvent bool
+
+	// RequestFingerprint adds X-Gandalf-Request-Fingerprint to chat
+	// completion responses and a fingerprint attribute to their request
+	// log lines. Off by default: hashing every request costs allocations.
+	RequestFingerprint bool
+
+	// ResponseMetadata adds an "x_gandalf" block (provider, model, cached) to
+	// chat completion responses. Off by default for strict clients.
+	ResponseMetadata bool
+
+	// SlowRequestThreshold logs a "slow request" warning for requests that
+	// take longer. 0 = disabled.
+	SlowRequestThreshold time.Duration
+
+	// LogSampleRate is the fraction (0..1) of successful requests that get
+	// the "request" access log line; requests answered with 4xx/5xx are
+	// always logged. 0 = log every request.
+	LogSampleRate float64
+
+	// ModelAllowlist, when non-empty, is the only set of models any key may
+	// use; ModelDenylist models are refused to every key. Both apply on top
+	// of per-key allowlists, admins included. Matched against the requested
+	// name, its normalized forms, its route alias, and the route's target
+	// models (see modelBlocked).
+	ModelAllowlist []string
+	ModelDenylist  []string
+
+	// RequireUserOrgs lists orgs whose chat, thread, embedding, cache warm,
+	// and native requests must identify the end user (`user`, or the native
+	// format's field), for abuse attribution. Others get 400 "user is
+	// required". nil = user is optional everywhere.
+	RequireUserOrgs []string
+
+	// OrgDeniedTools maps an org ID to tool (function) names its chat and
+	// native requests may not declare, on top of each route's denied_tools.
+	// nil = only route denylists apply.
+	OrgDeniedTools map[string][]string
+
+	// ReplaceDuplicateRoutes makes POST /admin/v1/routes with an alias that
+	// already has a route overwrite that route (200) instead of failing
+	// with 409.
+	ReplaceDuplicateRoutes bool
+
+	// MaxRouteTargets caps the targets an admin-created or updated route
+	// may list, bounding its failover chain. 0 = DefaultMaxRouteTargets.
+	MaxRouteTargets int
+
+	// OutputFilter scans chat completion text before it is returned and
+	// redacts or blocks disallowed content. nil = no scanning.
+	OutputFilter *app.OutputFilter
+
+	// FilterStreams buffers each SSE stream whole so OutputFilter can scan
+	// it, then replays it as SSE. Off: streams are passed through unscanned.
+	FilterStreams bool
+
+	// StreamDowngrade retries a stream request without streaming when every
+	// streaming attempt fails before anything is sent to the client, and
+	// replays the response as SSE. Failures after the first byte still end
+	// the stream with an error event. Off by default.
+	StreamDowngrade bool
+
+	// StrictContentType rejects /v1 request bodies not sent as
+	// application/json with 415. Off by default: bodies are decoded as JSON
+	// whatever their Content-Type.
+	StrictContentType bool
+
+	// BackupSigningKey signs exported backups and verifies restores. The
+	// backup endpoints are only mounted when it and Backup are set.
+	BackupSigningKey []byte
+
+	// ProviderBaseURLAllowlist exempts hostnames, IPs, or CIDRs from the
+	// internal-address check on admin-created provider base URLs (e.g.
+	// "localhost" for a local Ollama). Empty = no internal targets allowed.
+	ProviderBaseURLAllowlist []string
+
+	// Resolver resolves base URL hosts for that check. nil = net.DefaultResolver.
+	Resolver HostResolver
+
+	// Capabilities overrides provider-reported model capabilities, keyed by
+	// upstream (provider-side) model name, the same map the proxy filters
+	// route targets with. nil = provider-reported only.
+	Capabilities map[string]gateway.CapabilityOverride
+
+	// BetaFeatures allowlists, per provider type ("anthropic", "openai"),
+	// the beta features clients may request with X-Anthropic-Beta or
+	// X-OpenAI-Beta. A type without an entry accepts none. nil = the
+	// headers are ignored.
+	BetaFeatures map[string][]string
 }
 
 // New creates an http.Handler with all routes and middleware wired.
@@ -92,14 +241,26 @@ func New(deps Deps) http.Handler {
 		if deps.Tracer != nil {
 			r.Use(tracingMiddleware(deps.Tracer))
 		}
+		r.Use(s.clientDeadline)
+
+		// Machine-readable API description (no auth).
+		r.Get("/openapi.json", s.handleOpenAPI)
 
 		// Client-facing API (auth required) -- universal OpenAI-format
 		r.Group(func(r chi.Router) {
 			r.Use(s.authenticate)
+			if deps.StrictContentType {
+				r.Use(s.requireJSON)
+			}
 			r.Use(s.rateLimit)
+			r.Use(s.limitConcurrency)
 			r.Post("/v1/chat/completions", s.handleChatCompletion)
 			r.Post("/v1/embeddings", s.handleEmbeddings)
 			r.Get("/v1/models", s.handleListModels)
+			if deps.Threads != nil {
+				r.Post("/v1/threads", s.handleCreateThread)
+				r.Post("/v1/threads/{id}/messages", s.handleThreadMessage)
+			}
 		})
 
 		// Native API passthrough routes (per-provider auth normalization)
@@ -113,22 +274,50 @@ func New(deps Deps) http.Handler {
 				r.Group(func(r chi.Router) {
 					r.Use(s.requirePerm(gateway.PermManageProviders))
 					r.Get("/providers", s.handleListProviders)
+					if deps.LatencyStats != nil {
+						r.Get("/providers/latency", s.handleProviderLatency)
+					}
 					r.Post("/providers", s.handleCreateProvider)
 					r.Get("/providers/{id}", s.handleGetProvider)
 					r.Put("/providers/{id}", s.handleUpdateProvider)
 					r.Delete("/providers/{id}", s.handleDeleteProvider)
 					r.Post("/cache/purge", s.handleCachePurge)
+					if deps.Cache != nil && deps.Proxy != nil {
+						r.Post("/cache/warm", s.handleCacheWarm)
+					}
 				})
 
+				if _, ok := deps.Store.(storage.RouteMigrator); ok {
+					r.Group(func(r chi.Router) {
+						r.Use(s.requirePerm(gateway.PermManageProviders | gateway.PermManageRoutes))
+						r.Post("/providers/{id}/migrate", s.handleMigrateProvider)
+					})
+				}
+
 				r.Group(func(r chi.Router) {
 					r.Use(s.requirePerm(gateway.PermManageAllKeys))
 					r.Get("/keys", s.handleListKeys)
 					r.Post("/keys", s.handleCreateKey)
 					r.Get("/keys/{id}", s.handleGetKey)
+					r.Get("/keys/{id}/limits", s.handleKeyLimits)
 					r.Put("/keys/{id}", s.handleUpdateKey)
 					r.Delete("/keys/{id}", s.handleDeleteKey)
 				})
 
+				r.Group(func(r chi.Router) {
+					r.Use(s.requirePerm(gateway.PermManageOrgs))
+					r.Get("/orgs", s.handleListOrgs)
+					r.Post("/orgs", s.handleCreateOrg)
+					r.Get("/orgs/{id}", s.handleGetOrg)
+					r.Put("/orgs/{id}", s.handleUpdateOrg)
+					r.Delete("/orgs/{id}", s.handleDeleteOrg)
+					r.Get("/teams", s.handleListTeams)
+					r.Post("/teams", s.handleCreateTeam)
+					r.Get("/teams/{id}", s.handleGetTeam)
+					r.Put("/teams/{id}", s.handleUpdateTeam)
+					r.Delete("/teams/{id}", s.handleDeleteTeam)
+				})
+
 				r.Group(func(r chi.Router) {
 					r.Use(s.requirePerm(gateway.PermManageRoutes))
 					r.Get("/routes", s.handleListRoutes)
@@ -136,13 +325,48 @@ func New(deps Deps) http.Handler {
 					r.Get("/routes/{id}", s.handleGetRoute)
 					r.Put("/routes/{id}", s.handleUpdateRoute)
 					r.Delete("/routes/{id}", s.handleDeleteRoute)
+					r.Get("/models/{model}/capabilities", s.handleModelCapabilities)
 				})
 
 				r.Group(func(r chi.Router) {
 					r.Use(s.requirePerm(gateway.PermViewAllUsage))
 					r.Get("/usage", s.handleQueryUsage)
 					r.Get("/usage/summary", s.handleUsageSummary)
+					if deps.Anomalies != nil {
+						r.Get("/usage/anomalies", s.handleUsageAnomalies)
+					}
 				})
+
+				if deps.ErrorLog != nil {
+					r.Group(func(r chi.Router) {
+						r.Use(s.requirePerm(gateway.RolePermissions["admin"]))
+						r.Get("/errors/recent", s.handleRecentErrors)
+					})
+				}
+
+				if deps.Audit != nil {
+					r.Group(func(r chi.Router) {
+						r.Use(s.requirePerm(gateway.RolePermissions["admin"]))
+						r.Get("/audit", s.handleListAudit)
+					})
+				}
+
+				if deps.Evals != nil {
+					r.Group(func(r chi.Router) {
+						r.Use(s.requirePerm(gateway.RolePermissions["admin"]))
+						r.Get("/eval/export", s.handleEvalExport)
+					})
+				}
+
+				if deps.Backup != nil && len(deps.BackupSigningKey) > 0 {
+					r.Group(func(r chi.Router) {
+						// Backups span every org, so only a superadmin may
+						// export or restore one.
+						r.Use(s.requirePerm(gateway.RolePermissions["superadmin"]))
+						r.Get("/backup", s.handleBackup)
+						r.Post("/restore", s.handleRestore)
+					})
+				}
 			})
 		}
 	})
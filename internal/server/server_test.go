@@ -1,12 +1,20 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -14,7 +22,9 @@ import (
 	"github.com/eugener/gandalf/internal/app"
 	"github.com/eugener/gandalf/internal/cache"
 	"github.com/eugener/gandalf/internal/provider"
+	"github.com/eugener/gandalf/internal/provider/anthropic"
 	"github.com/eugener/gandalf/internal/ratelimit"
+	"github.com/eugener/gandalf/internal/testutil"
 	"github.com/eugener/gandalf/internal/tokencount"
 )
 
@@ -283,8 +293,9 @@ func TestChatCompletionStream(t *testing.T) {
 
 // rateLimitAuth returns identity with rate limits configured.
 type rateLimitAuth struct {
-	rpm int64
-	tpm int64
+	rpm        int64
+	tpm        int64
+	maxStreams int64
 }
 
 func (a rateLimitAuth) Authenticate(_ context.Context, _ *http.Request) (*gateway.Identity, error) {
@@ -297,6 +308,7 @@ func (a rateLimitAuth) Authenticate(_ context.Context, _ *http.Request) (*gatewa
 		AuthMethod: "apikey",
 		RPMLimit:   a.rpm,
 		TPMLimit:   a.tpm,
+		MaxStreams: a.maxStreams,
 	}, nil
 }
 
@@ -330,6 +342,33 @@ func TestRateLimit_RPMAllowed(t *testing.T) {
 	}
 }
 
+func TestRateLimit_ResetHeaders(t *testing.T) {
+	t.Parallel()
+	reg := provider.NewRegistry()
+	reg.Register("fake", fakeProvider{})
+	routerSvc := app.NewRouterService(&fakeRouteStore{})
+	h := New(Deps{
+		Auth:        rateLimitAuth{rpm: 10, tpm: 600},
+		Proxy:       app.NewProxyService(reg, routerSvc, nil, nil),
+		Providers:   reg,
+		Router:      routerSvc,
+		RateLimiter: ratelimit.NewRegistry(),
+	})
+
+	rec := postChatRecorder(h, `{"model":"gpt-4o","messages":[{"role":"user","content":"`+strings.Repeat("x", 400)+`"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+	}
+	// One of 10 requests refills in 6s; ~100 of 600 tokens at 10/s in ~11s.
+	if got := rec.Header().Get("X-Ratelimit-Reset-Requests"); got != "6" {
+		t.Errorf("X-Ratelimit-Reset-Requests = %q, want 6", got)
+	}
+	reset, err := strconv.Atoi(rec.Header().Get("X-Ratelimit-Reset-Tokens"))
+	if err != nil || reset < 10 || reset > 12 {
+		t.Errorf("X-Ratelimit-Reset-Tokens = %q, want ~11", rec.Header().Get("X-Ratelimit-Reset-Tokens"))
+	}
+}
+
 func TestRateLimit_RPMDenied(t *testing.T) {
 	t.Parallel()
 	reg := provider.NewRegistry()
@@ -363,6 +402,69 @@ func TestRateLimit_RPMDenied(t *testing.T) {
 	t.Error("expected 429 after exceeding RPM limit")
 }
 
+// poolAuth authenticates as key-pool-1 (1 RPM) in a pool with two
+// other 1 RPM keys. The other keys may not use gpt-4o, which must not
+// matter: a fallback keeps the caller's access.
+type poolAuth struct{}
+
+func (poolAuth) Authenticate(_ context.Context, _ *http.Request) (*gateway.Identity, error) {
+	member := func(keyID string) *gateway.Identity {
+		return &gateway.Identity{
+			Subject:    "test",
+			KeyID:      keyID,
+			OrgID:      "default",
+			Role:       "admin",
+			Perms:      gateway.RolePermissions["admin"],
+			AuthMethod: "apikey",
+			RPMLimit:   1,
+		}
+	}
+	id := member("key-pool-1")
+	for _, k := range []string{"key-pool-2", "key-pool-3"} {
+		m := member(k)
+		m.AllowedModels = []string{"other-model"}
+		id.PoolMembers = append(id.PoolMembers, m)
+	}
+	return id, nil
+}
+
+func TestRateLimit_PoolFallback(t *testing.T) {
+	t.Parallel()
+	reg := provider.NewRegistry()
+	reg.Register("fake", fakeProvider{})
+	routerSvc := app.NewRouterService(&fakeRouteStore{})
+	usage := &capturingRecorder{}
+	h := New(Deps{
+		Auth:        poolAuth{},
+		Proxy:       app.NewProxyService(reg, routerSvc, nil, nil),
+		Providers:   reg,
+		Router:      routerSvc,
+		RateLimiter: ratelimit.NewRegistry(),
+		Usage:       usage,
+	})
+
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`
+	for i := range 3 {
+		if rec := postChatRecorder(h, body); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200; body = %s", i, rec.Code, rec.Body.String())
+		}
+	}
+	rec := postChatRecorder(h, body)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429 once every pool key is limited; body = %s", rec.Code, rec.Body.String())
+	}
+
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+	var keys []string
+	for _, r := range usage.records {
+		keys = append(keys, r.KeyID)
+	}
+	if want := []string{"key-pool-1", "key-pool-2", "key-pool-3"}; !slices.Equal(keys, want) {
+		t.Errorf("usage key_ids = %v, want %v", keys, want)
+	}
+}
+
 // capturingRecorder captures usage records.
 type capturingRecorder struct {
 	mu      sync.Mutex
@@ -490,6 +592,61 @@ func TestRateLimit_QuotaExceeded(t *testing.T) {
 	}
 }
 
+func TestTokenBudgetExceeded(t *testing.T) {
+	t.Parallel()
+	tb := ratelimit.NewTokenBudgetTracker()
+	tb.SetLimit(ratelimit.ScopeKey, "key-test-1", "gpt-4o", 100)
+
+	fp := &testutil.FakeProvider{
+		ProviderName: "fake",
+		ChatFn: func(ctx context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			resp, _ := fakeProvider{}.ChatCompletion(ctx, req)
+			resp.Usage = &gateway.Usage{PromptTokens: 20, CompletionTokens: 40, TotalTokens: 60}
+			return resp, nil
+		},
+	}
+	reg := provider.NewRegistry()
+	reg.Register("fake", fp)
+	routerSvc := app.NewRouterService(&fakeRouteStore{})
+	h := New(Deps{
+		Auth:        fakeAuth{},
+		Proxy:       app.NewProxyService(reg, routerSvc, nil, nil),
+		Providers:   reg,
+		Router:      routerSvc,
+		TokenBudget: tb,
+	})
+
+	send := func(model string) *httptest.ResponseRecorder {
+		body := `{"model":"` + model + `","messages":[{"role":"user","content":"hello"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer gnd_test")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 60 then 120 of 100 tokens: both admitted, the second exhausts the budget.
+	for i := range 2 {
+		if rec := send("gpt-4o"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200; body = %s", i, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := send("gpt-4o")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429; body = %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "token budget exceeded") {
+		t.Errorf("body should contain 'token budget exceeded', got: %s", rec.Body.String())
+	}
+
+	// The budget is per model: other models are still served.
+	if rec := send("gpt-4o-mini"); rec.Code != http.StatusOK {
+		t.Errorf("other model: status = %d, want 200", rec.Code)
+	}
+}
+
 type quotaAuth struct {
 	maxBudget float64
 }
@@ -506,6 +663,92 @@ func (a quotaAuth) Authenticate(_ context.Context, _ *http.Request) (*gateway.Id
 	}, nil
 }
 
+// requestAuth authenticates as a key with a request-count quota.
+type requestAuth struct {
+	maxRequests int64
+	period      string
+	rpm         int64
+}
+
+func (a requestAuth) Authenticate(_ context.Context, _ *http.Request) (*gateway.Identity, error) {
+	return &gateway.Identity{
+		Subject:       "test",
+		KeyID:         "key-req-1",
+		OrgID:         "default",
+		Role:          "admin",
+		Perms:         gateway.RolePermissions["admin"],
+		AuthMethod:    "apikey",
+		MaxRequests:   a.maxRequests,
+		RequestPeriod: a.period,
+		RPMLimit:      a.rpm,
+	}, nil
+}
+
+func TestRequestQuotaExceeded(t *testing.T) {
+	t.Parallel()
+	reg := provider.NewRegistry()
+	reg.Register("fake", fakeProvider{})
+	routerSvc := app.NewRouterService(&fakeRouteStore{})
+	h := New(Deps{
+		Auth:         requestAuth{maxRequests: 2, period: "daily"},
+		Proxy:        app.NewProxyService(reg, routerSvc, nil, nil),
+		Providers:    reg,
+		Router:       routerSvc,
+		RequestQuota: ratelimit.NewRequestQuotaTracker(nil),
+	})
+
+	send := func() *httptest.ResponseRecorder {
+		body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer gnd_test")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := range 2 {
+		if rec := send(); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200; body = %s", i, rec.Code, rec.Body.String())
+		}
+	}
+	rec := send()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429; body = %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "request quota exceeded") {
+		t.Errorf("body should contain 'request quota exceeded', got: %s", rec.Body.String())
+	}
+	secs, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	if err != nil || secs <= 0 || secs > 24*60*60+1 {
+		t.Errorf("Retry-After = %q, want seconds until the end of the day", rec.Header().Get("Retry-After"))
+	}
+}
+
+// TestRequestQuotaCountsRecordedRequests checks that only requests that
+// get a usage record are counted, as the restart seed counts them: an RPM
+// rejection is not.
+func TestRequestQuotaCountsRecordedRequests(t *testing.T) {
+	t.Parallel()
+	requests := ratelimit.NewRequestQuotaTracker(nil)
+	h := newTestHandlerWith(func(d *Deps) {
+		d.Auth = requestAuth{maxRequests: 5, period: "daily", rpm: 1}
+		d.RateLimiter = ratelimit.NewRegistry()
+		d.RequestQuota = requests
+	})
+
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`
+	if rec := postChatRecorder(h, body); rec.Code != http.StatusOK {
+		t.Fatalf("first request: status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+	if rec := postChatRecorder(h, body); rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), "rate limit") {
+		t.Fatalf("second request: status = %d, want rpm 429; body = %s", rec.Code, rec.Body.String())
+	}
+	if got := requests.Used(context.Background(), "key-req-1", ratelimit.PeriodDaily); got != 1 {
+		t.Errorf("requests counted = %d, want 1 (RPM rejection not counted)", got)
+	}
+}
+
 func TestCacheHit(t *testing.T) {
 	t.Parallel()
 	mc, err := cache.NewMemory(100, time.Minute)
@@ -558,6 +801,95 @@ func TestCacheHit(t *testing.T) {
 	}
 }
 
+// fingerprintHandler serves chat completions carrying a system_fingerprint,
+// with optional response metadata and caching.
+func fingerprintHandler(t *testing.T, metadata bool) http.Handler {
+	t.Helper()
+	mc, err := cache.NewMemory(100, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := provider.NewRegistry()
+	reg.Register("fake", &testutil.FakeProvider{
+		ProviderName: "fake",
+		ChatFn: func(_ context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			return &gateway.ChatResponse{
+				ID:                "chatcmpl-fp",
+				Object:            "chat.completion",
+				Model:             req.Model,
+				Choices:           []gateway.Choice{{Message: gateway.Message{Role: "assistant", Content: json.RawMessage(`"hi"`)}, FinishReason: "stop"}},
+				SystemFingerprint: "fp_abc123",
+			}, nil
+		},
+	})
+	routerSvc := app.NewRouterService(&fakeRouteStore{})
+	return New(Deps{
+		Auth:             fakeAuth{},
+		Proxy:            app.NewProxyService(reg, routerSvc, nil, nil),
+		Providers:        reg,
+		Router:           routerSvc,
+		Cache:            mc,
+		ResponseMetadata: metadata,
+	})
+}
+
+func postChat(h http.Handler, body string) map[string]json.RawMessage {
+	rec := postChatRecorder(h, body)
+	var out map[string]json.RawMessage
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	return out
+}
+
+func TestSystemFingerprintPreserved(t *testing.T) {
+	t.Parallel()
+	h := fingerprintHandler(t, false)
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}],"temperature":0}`
+
+	miss := postChat(h, body)
+	time.Sleep(50 * time.Millisecond) // otter async processing
+	hit := postChat(h, body)
+
+	for name, out := range map[string]map[string]json.RawMessage{"miss": miss, "hit": hit} {
+		if got := string(out["system_fingerprint"]); got != `"fp_abc123"` {
+			t.Errorf("%s: system_fingerprint = %s, want \"fp_abc123\"", name, got)
+		}
+		if _, ok := out["x_gandalf"]; ok {
+			t.Errorf("%s: x_gandalf present with response metadata disabled", name)
+		}
+	}
+}
+
+func TestResponseMetadata(t *testing.T) {
+	t.Parallel()
+	h := fingerprintHandler(t, true)
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}],"temperature":0}`
+
+	miss := postChat(h, body)
+	time.Sleep(50 * time.Millisecond) // otter async processing
+	hit := postChat(h, body)
+
+	tests := []struct {
+		name string
+		out  map[string]json.RawMessage
+		want gateway.ResponseMeta
+	}{
+		{"miss", miss, gateway.ResponseMeta{Provider: "fake", Model: "gpt-4o"}},
+		{"hit", hit, gateway.ResponseMeta{Model: "gpt-4o", Cached: true}},
+	}
+	for _, tt := range tests {
+		var got gateway.ResponseMeta
+		if err := json.Unmarshal(tt.out["x_gandalf"], &got); err != nil {
+			t.Fatalf("%s: decode x_gandalf %s: %v", tt.name, tt.out["x_gandalf"], err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: x_gandalf = %+v, want %+v", tt.name, got, tt.want)
+		}
+		if string(tt.out["system_fingerprint"]) != `"fp_abc123"` {
+			t.Errorf("%s: system_fingerprint = %s", tt.name, tt.out["system_fingerprint"])
+		}
+	}
+}
+
 func TestStreamUsageRecording(t *testing.T) {
 	t.Parallel()
 	usage := &capturingRecorder{}
@@ -586,6 +918,130 @@ func TestStreamUsageRecording(t *testing.T) {
 	}
 }
 
+func TestUsageMetadataPropagation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		stream bool
+	}{
+		{"non-stream", false},
+		{"stream", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			usage := &capturingRecorder{}
+			h := newTestHandlerWith(func(d *Deps) {
+				d.Usage = usage
+			})
+
+			body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}],"user":"end-user-42"`
+			if tt.stream {
+				body += `,"stream":true`
+			}
+			body += `}`
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer gnd_test")
+			req.Header.Set("X-Gandalf-Tags", "team-a, batch,,nightly")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+			}
+
+			usage.mu.Lock()
+			defer usage.mu.Unlock()
+			if len(usage.records) != 1 {
+				t.Fatalf("expected 1 usage record, got %d", len(usage.records))
+			}
+			got := usage.records[0]
+			if got.EndUser != "end-user-42" {
+				t.Errorf("end_user = %q, want end-user-42", got.EndUser)
+			}
+			if want := []string{"team-a", "batch", "nightly"}; !slices.Equal(got.Tags, want) {
+				t.Errorf("tags = %v, want %v", got.Tags, want)
+			}
+		})
+	}
+}
+
+func TestRequireUser(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		orgs  []string
+		path  string
+		body  string
+		want  int
+		wantU string // recorded end_user when admitted
+	}{
+		{"chat missing", []string{"default"}, "/v1/chat/completions", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`, http.StatusBadRequest, ""},
+		{"chat blank", []string{"default"}, "/v1/chat/completions", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"user":" "}`, http.StatusBadRequest, ""},
+		{"chat present", []string{"default"}, "/v1/chat/completions", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"user":"u-7"}`, http.StatusOK, "u-7"},
+		{"embeddings missing", []string{"default"}, "/v1/embeddings", `{"model":"gpt-4o","input":"hi"}`, http.StatusBadRequest, ""},
+		{"other org", []string{"acme"}, "/v1/chat/completions", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			usage := &capturingRecorder{}
+			h := newTestHandlerWith(func(d *Deps) {
+				d.Usage = usage
+				d.RequireUserOrgs = tt.orgs
+			})
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer gnd_test")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d; body = %s", rec.Code, tt.want, rec.Body.String())
+			}
+			usage.mu.Lock()
+			defer usage.mu.Unlock()
+			if tt.want != http.StatusOK {
+				if !strings.Contains(rec.Body.String(), "user is required") {
+					t.Errorf("body = %s, want 'user is required'", rec.Body.String())
+				}
+				if len(usage.records) != 0 {
+					t.Errorf("rejected request recorded %d usage records", len(usage.records))
+				}
+				return
+			}
+			if len(usage.records) != 1 || usage.records[0].EndUser != tt.wantU {
+				t.Errorf("usage = %+v, want one record with end_user %q", usage.records, tt.wantU)
+			}
+		})
+	}
+}
+
+func TestRequestUsageMeta_Bounds(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	if meta := requestUsageMeta(req, ""); meta.tags != nil {
+		t.Errorf("no header: tags = %v, want nil", meta.tags)
+	}
+
+	many := make([]string, 20)
+	for i := range many {
+		many[i] = "t" + strconv.Itoa(i)
+	}
+	req.Header.Set("X-Gandalf-Tags", strings.Repeat("x", 65)+","+strings.Join(many, ","))
+	meta := requestUsageMeta(req, "")
+	if len(meta.tags) != 16 {
+		t.Errorf("len(tags) = %d, want 16 (capped)", len(meta.tags))
+	}
+	if len(meta.tags) > 0 && meta.tags[0] != "t0" {
+		t.Errorf("tags[0] = %q, want t0 (overlong tag dropped)", meta.tags[0])
+	}
+}
+
 func TestEmbeddingsUsageRecording(t *testing.T) {
 	t.Parallel()
 	usage := &capturingRecorder{}
@@ -678,23 +1134,192 @@ func TestUsageRecordingWithQuota(t *testing.T) {
 	}
 }
 
-func TestEstimateCost(t *testing.T) {
+// orgDiscountCostModel applies a negotiated discount to one org on top of
+// list prices.
+type orgDiscountCostModel struct {
+	base     CostModel
+	org      string
+	discount float64
+}
+
+func (m orgDiscountCostModel) Cost(model string, usage *gateway.Usage, identity *gateway.Identity) float64 {
+	cost := m.base.Cost(model, usage, identity)
+	if identity != nil && identity.OrgID == m.org {
+		cost *= 1 - m.discount
+	}
+	return cost
+}
+
+// orgAuth authenticates every request as a key in org.
+type orgAuth struct{ org string }
+
+func (a orgAuth) Authenticate(_ context.Context, _ *http.Request) (*gateway.Identity, error) {
+	return &gateway.Identity{Subject: "test", KeyID: "key-" + a.org, OrgID: a.org, Role: "member", Perms: gateway.RolePermissions["member"]}, nil
+}
+
+func TestCostModel_OrgDiscount(t *testing.T) {
 	t.Parallel()
+	fp := &testutil.FakeProvider{
+		ProviderName: "fake",
+		ChatFn: func(_ context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			resp, _ := fakeProvider{}.ChatCompletion(context.Background(), req)
+			resp.Usage = &gateway.Usage{PromptTokens: 1000, CompletionTokens: 1000, TotalTokens: 2000}
+			return resp, nil
+		},
+	}
+	costs := orgDiscountCostModel{
+		base:     app.NewStaticCostModel(map[string]gateway.ModelPrice{"gpt-4o": {InputPer1M: 2, OutputPer1M: 8}}),
+		org:      "acme",
+		discount: 0.25,
+	}
+
 	tests := []struct {
-		name  string
-		usage *gateway.Usage
-		want  float64
+		org  string
+		want float64
+	}{
+		{"acme", 0.0075}, // (0.002 + 0.008) * 0.75
+		{"other", 0.01},
+	}
+	for _, tt := range tests {
+		reg := provider.NewRegistry()
+		reg.Register("fake", fp)
+		routerSvc := app.NewRouterService(&fakeRouteStore{})
+		usage := &capturingRecorder{}
+		h := New(Deps{
+			Auth:      orgAuth{org: tt.org},
+			Proxy:     app.NewProxyService(reg, routerSvc, nil, nil),
+			Providers: reg,
+			Router:    routerSvc,
+			Usage:     usage,
+			CostModel: costs,
+		})
+		if rec := postChatRecorder(h, `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`); rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d; body = %s", tt.org, rec.Code, rec.Body.String())
+		}
+		usage.mu.Lock()
+		if len(usage.records) != 1 {
+			t.Fatalf("%s: got %d usage records, want 1", tt.org, len(usage.records))
+		}
+		if got := usage.records[0].CostUSD; math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("%s: cost = %f, want %f", tt.org, got, tt.want)
+		}
+		usage.mu.Unlock()
+	}
+}
+
+// TestCostModel_PricesTargetModel verifies that a request for a route alias
+// is priced as the upstream model that served it.
+func TestCostModel_PricesTargetModel(t *testing.T) {
+	t.Parallel()
+	fp := &testutil.FakeProvider{
+		ProviderName: "fake",
+		ChatFn: func(_ context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			resp, _ := fakeProvider{}.ChatCompletion(context.Background(), req)
+			resp.Usage = &gateway.Usage{PromptTokens: 1000, CompletionTokens: 1000, TotalTokens: 2000}
+			return resp, nil
+		},
+	}
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:         "r-fast",
+		ModelAlias: "fast",
+		Targets:    []byte(`[{"provider_id":"fake","model":"gpt-4o-mini","priority":1}]`),
+		Strategy:   "priority",
+	})
+	reg := provider.NewRegistry()
+	reg.Register("fake", fp)
+	routerSvc := app.NewRouterService(store)
+	usage := &capturingRecorder{}
+	h := New(Deps{
+		Auth:      fakeAuth{},
+		Proxy:     app.NewProxyService(reg, routerSvc, nil, nil),
+		Providers: reg,
+		Router:    routerSvc,
+		Usage:     usage,
+		CostModel: app.NewStaticCostModel(map[string]gateway.ModelPrice{
+			"fast":        {InputPer1M: 100, OutputPer1M: 100},
+			"gpt-4o-mini": {InputPer1M: 1, OutputPer1M: 2},
+		}),
+	})
+	if rec := postChatRecorder(h, `{"model":"fast","messages":[{"role":"user","content":"hello"}]}`); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+	if len(usage.records) != 1 {
+		t.Fatalf("got %d usage records, want 1", len(usage.records))
+	}
+	got := usage.records[0]
+	if got.Model != "fast" {
+		t.Errorf("record model = %q, want the requested alias fast", got.Model)
+	}
+	if want := 0.003; math.Abs(got.CostUSD-want) > 1e-12 { // 0.001 + 0.002 at gpt-4o-mini prices
+		t.Errorf("cost = %f, want %f", got.CostUSD, want)
+	}
+}
+
+// defaultModelAuth authenticates as a key whose default model is model.
+type defaultModelAuth struct{ model string }
+
+func (a defaultModelAuth) Authenticate(_ context.Context, _ *http.Request) (*gateway.Identity, error) {
+	return &gateway.Identity{Subject: "test", KeyID: "key-app", OrgID: "default", Role: "member",
+		Perms: gateway.RolePermissions["member"], DefaultModel: a.model}, nil
+}
+
+func TestKeyDefaultModel(t *testing.T) {
+	t.Parallel()
+
+	newHandler := func(model string) (http.Handler, *capturingRecorder) {
+		reg := provider.NewRegistry()
+		reg.Register("fake", fakeProvider{})
+		routerSvc := app.NewRouterService(&fakeRouteStore{})
+		usage := &capturingRecorder{}
+		return New(Deps{
+			Auth:      defaultModelAuth{model: model},
+			Proxy:     app.NewProxyService(reg, routerSvc, nil, nil),
+			Providers: reg,
+			Router:    routerSvc,
+			Usage:     usage,
+		}), usage
+	}
+	post := func(h http.Handler, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer gnd_test")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name, keyDefault, path, body string
+		wantStatus                   int
+		wantModel                    string // model recorded for usage
 	}{
-		{"nil usage", nil, 0},
-		{"100 tokens", &gateway.Usage{TotalTokens: 100}, 0.001},
-		{"1000 tokens", &gateway.Usage{TotalTokens: 1000}, 0.01},
+		{"chat uses key default", "app-model", "/v1/chat/completions", `{"messages":[{"role":"user","content":"hi"}]}`, http.StatusOK, "app-model"},
+		{"request model wins", "app-model", "/v1/chat/completions", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`, http.StatusOK, "gpt-4o"},
+		{"embeddings use key default", "app-embed", "/v1/embeddings", `{"input":"hi"}`, http.StatusOK, "app-embed"},
+		{"chat without either", "", "/v1/chat/completions", `{"messages":[{"role":"user","content":"hi"}]}`, http.StatusBadRequest, ""},
+		{"embeddings without either", "", "/v1/embeddings", `{"input":"hi"}`, http.StatusBadRequest, ""},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			got := estimateCost("gpt-4o", tt.usage)
-			if got != tt.want {
-				t.Errorf("estimateCost() = %f, want %f", got, tt.want)
+			h, usage := newHandler(tt.keyDefault)
+			rec := post(h, tt.path, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantModel == "" {
+				if !strings.Contains(rec.Body.String(), "model is required") {
+					t.Errorf("body = %s, want model is required", rec.Body.String())
+				}
+				return
+			}
+			usage.mu.Lock()
+			defer usage.mu.Unlock()
+			if len(usage.records) != 1 || usage.records[0].Model != tt.wantModel {
+				t.Errorf("usage records = %+v, want one for %s", usage.records, tt.wantModel)
 			}
 		})
 	}
@@ -715,6 +1340,8 @@ func TestErrorStatus_AllBranches(t *testing.T) {
 		{gateway.ErrConflict, http.StatusConflict},
 		{gateway.ErrRateLimited, http.StatusTooManyRequests},
 		{gateway.ErrBadRequest, http.StatusBadRequest},
+		{gateway.ErrNoProvider, http.StatusServiceUnavailable},
+		{gateway.ErrDimensionMismatch, http.StatusBadGateway},
 		{errors.New("unknown"), http.StatusInternalServerError},
 	}
 	for _, tt := range tests {
@@ -780,9 +1407,60 @@ func (streamWithUsageProvider) ChatCompletionStream(_ context.Context, _ *gatewa
 	return ch, nil
 }
 
-func TestTokenCounterIntegration(t *testing.T) {
+func TestEstimateTokens_NoCounter(t *testing.T) {
 	t.Parallel()
-	usage := &capturingRecorder{}
+	msgs := func(n int) []gateway.Message {
+		content, _ := json.Marshal(strings.Repeat("x", n))
+		return []gateway.Message{{Role: "user", Content: content}}
+	}
+
+	s := &server{}
+	small, large := s.estimateTokens("gpt-4o", msgs(40)), s.estimateTokens("gpt-4o", msgs(4000))
+	if small < 10 || small > 20 {
+		t.Errorf("40-byte estimate = %d, want ~11", small)
+	}
+	if large < 1000 || large > 1010 {
+		t.Errorf("4000-byte estimate = %d, want ~1002", large)
+	}
+	if got := s.estimateTokens("gpt-4o", nil); got != 1 {
+		t.Errorf("empty estimate = %d, want 1", got)
+	}
+
+	fixed := &server{deps: Deps{FixedTokenEstimate: 100}}
+	if a, b := fixed.estimateTokens("gpt-4o", msgs(40)), fixed.estimateTokens("gpt-4o", msgs(4000)); a != 100 || b != 100 {
+		t.Errorf("fixed estimates = %d, %d; want 100 for both", a, b)
+	}
+}
+
+// TestRateLimit_TPMNoCounter checks that without a token counter the TPM
+// charge still follows request size: a short request fits a limit that a
+// long one exceeds.
+func TestRateLimit_TPMNoCounter(t *testing.T) {
+	t.Parallel()
+	reg := provider.NewRegistry()
+	reg.Register("fake", fakeProvider{})
+	routerSvc := app.NewRouterService(&fakeRouteStore{})
+	h := New(Deps{
+		Auth:        rateLimitAuth{rpm: 1000, tpm: 200},
+		Proxy:       app.NewProxyService(reg, routerSvc, nil, nil),
+		Providers:   reg,
+		Router:      routerSvc,
+		RateLimiter: ratelimit.NewRegistry(),
+	})
+
+	rec := postChatRecorder(h, `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("short request: status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+	}
+	rec = postChatRecorder(h, `{"model":"gpt-4o","messages":[{"role":"user","content":"`+strings.Repeat("word ", 400)+`"}]}`)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("long request: status = %d, want 429", rec.Code)
+	}
+}
+
+func TestTokenCounterIntegration(t *testing.T) {
+	t.Parallel()
+	usage := &capturingRecorder{}
 	rl := ratelimit.NewRegistry()
 
 	reg := provider.NewRegistry()
@@ -813,3 +1491,1153 @@ func TestTokenCounterIntegration(t *testing.T) {
 		t.Error("X-Ratelimit-Limit-Tokens should be set when TPM is configured")
 	}
 }
+
+func TestUsageHeaders(t *testing.T) {
+	t.Parallel()
+	p := &testutil.FakeProvider{
+		ChatFn: func(_ context.Context, _ *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			return &gateway.ChatResponse{
+				ID:     "chatcmpl-usage",
+				Object: "chat.completion",
+				Model:  "gpt-4o",
+				Choices: []gateway.Choice{{
+					Message:      gateway.Message{Role: "assistant", Content: []byte(`"hi"`)},
+					FinishReason: "stop",
+				}},
+				Usage: &gateway.Usage{PromptTokens: 12, CompletionTokens: 5, TotalTokens: 17},
+			}, nil
+		},
+	}
+	h := buildHandler(t, "openai", "gpt-4o", p)
+
+	rec := postChatRecorder(h, `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+	}
+	var resp gateway.ChatResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Usage == nil {
+		t.Fatal("response has no usage")
+	}
+	for hdr, want := range map[string]int{
+		"X-Gandalf-Prompt-Tokens":     resp.Usage.PromptTokens,
+		"X-Gandalf-Completion-Tokens": resp.Usage.CompletionTokens,
+		"X-Gandalf-Total-Tokens":      resp.Usage.TotalTokens,
+	} {
+		if got := rec.Header().Get(hdr); got != strconv.Itoa(want) {
+			t.Errorf("%s = %q, want %d", hdr, got, want)
+		}
+	}
+}
+
+func TestUsageHeaders_NoUsage(t *testing.T) {
+	t.Parallel()
+	rec := postChatRecorder(newTestHandler(), `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if got := rec.Header().Get("X-Gandalf-Total-Tokens"); got != "" {
+		t.Errorf("X-Gandalf-Total-Tokens = %q, want unset", got)
+	}
+}
+
+func TestUsageStreamComment(t *testing.T) {
+	t.Parallel()
+	h := buildHandler(t, "openai", "gpt-4o", streamWithUsageProvider{})
+
+	rec := postChatRecorder(h, `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}],"stream":true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	want := ": X-Gandalf-Prompt-Tokens: 10\n: X-Gandalf-Completion-Tokens: 32\n: X-Gandalf-Total-Tokens: 42\n\n"
+	i := strings.Index(body, want)
+	if i < 0 {
+		t.Fatalf("usage comment missing; body = %s", body)
+	}
+	if j := strings.Index(body, "data: [DONE]"); j < i {
+		t.Errorf("usage comment should precede [DONE]; body = %s", body)
+	}
+}
+
+// defaultTempRouteStore is a fakeRouteStore whose routes carry a default temperature.
+type defaultTempRouteStore struct {
+	fakeRouteStore
+	temp float64
+}
+
+func (s defaultTempRouteStore) GetRouteByAlias(ctx context.Context, alias string) (*gateway.Route, error) {
+	route, _ := s.fakeRouteStore.GetRouteByAlias(ctx, alias)
+	route.DefaultTemperature = &s.temp
+	return route, nil
+}
+
+func TestRouteDefaultTemperature(t *testing.T) {
+	t.Parallel()
+	mc, err := cache.NewMemory(100, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var temps []*float64
+	fp := &testutil.FakeProvider{
+		ProviderName: "fake",
+		ChatFn: func(_ context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			mu.Lock()
+			temps = append(temps, req.Temperature)
+			mu.Unlock()
+			return fakeProvider{}.ChatCompletion(context.Background(), req)
+		},
+	}
+	reg := provider.NewRegistry()
+	reg.Register("fake", fp)
+	routerSvc := app.NewRouterService(defaultTempRouteStore{temp: 0})
+	usage := &capturingRecorder{}
+	h := New(Deps{
+		Auth:      fakeAuth{},
+		Proxy:     app.NewProxyService(reg, routerSvc, nil, nil),
+		Providers: reg,
+		Router:    routerSvc,
+		Cache:     mc,
+		Usage:     usage,
+	})
+
+	// No temperature in the request: the route default (0) applies.
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`
+	for i := range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer gnd_test")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200; body = %s", i, rec.Code, rec.Body.String())
+		}
+		// Allow otter async processing.
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(temps) != 1 {
+		t.Fatalf("provider called %d times, want 1 (second request should hit cache)", len(temps))
+	}
+	if temps[0] == nil || *temps[0] != 0 {
+		t.Errorf("provider temperature = %v, want 0", temps[0])
+	}
+
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+	if len(usage.records) < 2 {
+		t.Fatalf("expected >= 2 usage records, got %d", len(usage.records))
+	}
+	if !usage.records[1].Cached {
+		t.Error("second request should be marked as cached")
+	}
+}
+
+func TestCacheStopOnly(t *testing.T) {
+	t.Parallel()
+	var calls atomic.Int32
+	fp := &testutil.FakeProvider{
+		ProviderName: "fake",
+		ChatFn: func(_ context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			calls.Add(1)
+			resp, _ := fakeProvider{}.ChatCompletion(context.Background(), req)
+			if strings.Contains(string(req.Messages[0].Content), "long") {
+				resp.Choices[0].FinishReason = "length"
+			}
+			return resp, nil
+		},
+	}
+	reg := provider.NewRegistry()
+	reg.Register("fake", fp)
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:            "r-1",
+		ModelAlias:    "gpt-4o",
+		Targets:       []byte(`[{"provider_id":"fake","model":"gpt-4o","priority":1}]`),
+		Strategy:      "priority",
+		CacheStopOnly: true,
+	})
+	routerSvc := app.NewRouterService(store)
+	h := New(Deps{
+		Auth:      fakeAuth{},
+		Proxy:     app.NewProxyService(reg, routerSvc, nil, nil),
+		Providers: reg,
+		Router:    routerSvc,
+		Cache:     newTestCache(),
+	})
+
+	tests := []struct {
+		name      string
+		content   string
+		wantCalls int32
+	}{
+		{"length not cached", "write something long", 2},
+		{"stop cached", "hello", 1},
+	}
+	for _, tt := range tests {
+		calls.Store(0)
+		body := `{"model":"gpt-4o","temperature":0,"messages":[{"role":"user","content":"` + tt.content + `"}]}`
+		for i := range 2 {
+			if rec := postChatRecorder(h, body); rec.Code != http.StatusOK {
+				t.Fatalf("%s: request %d: status = %d; body = %s", tt.name, i, rec.Code, rec.Body.String())
+			}
+			// Allow otter async processing.
+			time.Sleep(50 * time.Millisecond)
+		}
+		if got := calls.Load(); got != tt.wantCalls {
+			t.Errorf("%s: provider called %d times, want %d", tt.name, got, tt.wantCalls)
+		}
+	}
+}
+
+func TestRouteDefaultTemperature_ClientOverride(t *testing.T) {
+	t.Parallel()
+
+	var got *float64
+	fp := &testutil.FakeProvider{
+		ProviderName: "fake",
+		ChatFn: func(_ context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			got = req.Temperature
+			return fakeProvider{}.ChatCompletion(context.Background(), req)
+		},
+	}
+	reg := provider.NewRegistry()
+	reg.Register("fake", fp)
+	routerSvc := app.NewRouterService(defaultTempRouteStore{temp: 0})
+	h := New(Deps{
+		Auth:      fakeAuth{},
+		Proxy:     app.NewProxyService(reg, routerSvc, nil, nil),
+		Providers: reg,
+		Router:    routerSvc,
+	})
+
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}],"temperature":0.9}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer gnd_test")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+	}
+	if got == nil || *got != 0.9 {
+		t.Errorf("provider temperature = %v, want client value 0.9", got)
+	}
+}
+
+func TestChatCompletion_NoAvailableProvider(t *testing.T) {
+	t.Parallel()
+
+	// fakeRouteStore targets provider "fake", which is never registered.
+	reg := provider.NewRegistry()
+	routerSvc := app.NewRouterService(&fakeRouteStore{})
+	h := New(Deps{
+		Auth:      fakeAuth{},
+		Proxy:     app.NewProxyService(reg, routerSvc, nil, nil),
+		Providers: reg,
+		Router:    routerSvc,
+	})
+
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer gnd_test")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503; body = %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), `no available provider for model \"gpt-4o\"`) {
+		t.Errorf("body should name the model, got: %s", rec.Body.String())
+	}
+}
+
+// slowChatProvider blocks until the request context is done.
+func slowChatProvider() *testutil.FakeProvider {
+	return &testutil.FakeProvider{
+		ProviderName: "fake",
+		ChatFn: func(ctx context.Context, _ *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(5 * time.Second):
+				return fakeProvider{}.ChatCompletion(ctx, nil)
+			}
+		},
+	}
+}
+
+func TestClientDeadline_SlowProvider(t *testing.T) {
+	t.Parallel()
+	reg := provider.NewRegistry()
+	reg.Register("fake", slowChatProvider())
+	h := newTestHandlerWith(func(d *Deps) {
+		d.Providers = reg
+		d.Proxy = app.NewProxyService(reg, d.Router, nil, nil)
+	})
+
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`
+	for _, deadline := range []string{"50ms", time.Now().Add(50 * time.Millisecond).UTC().Format(time.RFC3339Nano)} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer gnd_test")
+		req.Header.Set("X-Gandalf-Deadline", deadline)
+		rec := httptest.NewRecorder()
+		start := time.Now()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusGatewayTimeout {
+			t.Errorf("deadline %q: status = %d, want 504; body = %s", deadline, rec.Code, rec.Body.String())
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("deadline %q: request took %v, want it bounded by the deadline", deadline, elapsed)
+		}
+	}
+}
+
+func TestClientDeadline_ClampedToMax(t *testing.T) {
+	t.Parallel()
+	reg := provider.NewRegistry()
+	reg.Register("fake", slowChatProvider())
+	h := newTestHandlerWith(func(d *Deps) {
+		d.Providers = reg
+		d.Proxy = app.NewProxyService(reg, d.Router, nil, nil)
+		d.MaxDeadline = 50 * time.Millisecond
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`))
+	req.Header.Set("Authorization", "Bearer gnd_test")
+	req.Header.Set("X-Gandalf-Deadline", "1h")
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want 504; body = %s", rec.Code, rec.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("request took %v, want it clamped to MaxDeadline", elapsed)
+	}
+}
+
+func TestClientDeadline_Header(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler()
+
+	tests := []struct {
+		name   string
+		value  string
+		status int
+	}{
+		{"relative", "30s", http.StatusOK},
+		{"absolute", time.Now().Add(time.Minute).UTC().Format(time.RFC3339), http.StatusOK},
+		{"already_past", time.Now().Add(-time.Minute).UTC().Format(time.RFC3339), http.StatusGatewayTimeout},
+		{"zero", "0s", http.StatusGatewayTimeout},
+		{"invalid", "soon", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+				strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`))
+			req.Header.Set("Authorization", "Bearer gnd_test")
+			req.Header.Set("X-Gandalf-Deadline", tt.value)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d; body = %s", rec.Code, tt.status, rec.Body.String())
+			}
+		})
+	}
+}
+
+// TestSlowRequestLog swaps the default logger, so it must not run in parallel.
+func TestSlowRequestLog(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	var delay atomic.Int64
+	fp := &testutil.FakeProvider{
+		ProviderName: "fake",
+		ChatFn: func(ctx context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			time.Sleep(time.Duration(delay.Load()))
+			return fakeProvider{}.ChatCompletion(ctx, req)
+		},
+	}
+	reg := provider.NewRegistry()
+	reg.Register("fake", fp)
+	h := newTestHandlerWith(func(d *Deps) {
+		d.Providers = reg
+		d.Proxy = app.NewProxyService(reg, d.Router, nil, nil)
+		d.SlowRequestThreshold = 30 * time.Millisecond
+		d.RequestFingerprint = true
+	})
+
+	send := func() string {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+			strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`))
+		req.Header.Set("Authorization", "Bearer gnd_test")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+		}
+		return rec.Header().Get(hdrRequestFingerprint)
+	}
+	logs := func(msg string) []map[string]any {
+		var out []map[string]any
+		for line := range strings.SplitSeq(strings.TrimSpace(buf.String()), "\n") {
+			var rec map[string]any
+			if json.Unmarshal([]byte(line), &rec) == nil && rec["msg"] == msg {
+				out = append(out, rec)
+			}
+		}
+		return out
+	}
+
+	fingerprint := send()
+	if got := logs("slow request"); len(got) != 0 {
+		t.Fatalf("fast request logged as slow: %v", got)
+	}
+
+	delay.Store(int64(60 * time.Millisecond))
+	send()
+	got := logs("slow request")
+	if len(got) != 1 {
+		t.Fatalf("slow request warnings = %d, want 1; logs = %s", len(got), buf.String())
+	}
+	w := got[0]
+	if w["level"] != "WARN" {
+		t.Errorf("level = %v, want WARN", w["level"])
+	}
+	if w["provider"] != "fake" || w["model"] != "gpt-4o" {
+		t.Errorf("provider/model = %v/%v, want fake/gpt-4o", w["provider"], w["model"])
+	}
+	if ms, _ := w["duration_ms"].(float64); ms < 60 {
+		t.Errorf("duration_ms = %v, want >= 60", w["duration_ms"])
+	}
+	if fingerprint == "" || w["fingerprint"] != fingerprint {
+		t.Errorf("fingerprint = %v, want the response header %q", w["fingerprint"], fingerprint)
+	}
+	for _, rec := range logs("request") {
+		if rec["fingerprint"] != fingerprint {
+			t.Errorf("request log fingerprint = %v, want %q", rec["fingerprint"], fingerprint)
+		}
+	}
+}
+
+// TestLogSampling swaps the default logger, so it must not run in parallel.
+func TestLogSampling(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	h := newTestHandlerWith(func(d *Deps) { d.LogSampleRate = 0.1 })
+	send := func(body string) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer gnd_test")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	const n, bad = 1000, 20
+	for range n {
+		send(`{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`)
+	}
+	for range bad {
+		send(`{not json`)
+	}
+
+	var ok, failed int
+	for line := range strings.SplitSeq(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if json.Unmarshal([]byte(line), &rec) != nil || rec["msg"] != "request" {
+			continue
+		}
+		if rec["status"] == float64(http.StatusOK) {
+			ok++
+		} else {
+			failed++
+		}
+	}
+	// 10% of 1000 is 100; the bounds are > 6 standard deviations out.
+	if ok < 40 || ok > 160 {
+		t.Errorf("sampled success logs = %d, want about %d", ok, n/10)
+	}
+	if failed != bad {
+		t.Errorf("error logs = %d, want %d (errors are never sampled out)", failed, bad)
+	}
+}
+
+func TestShadowEval_OnlyPrimaryReturned(t *testing.T) {
+	t.Parallel()
+	var shadowCalls atomic.Int32
+	reg := provider.NewRegistry()
+	reg.Register("fake", fakeProvider{})
+	reg.Register("shadow", &testutil.FakeProvider{
+		ProviderName: "shadow",
+		ChatFn: func(_ context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			shadowCalls.Add(1)
+			return &gateway.ChatResponse{
+				ID:      "chatcmpl-shadow",
+				Model:   req.Model,
+				Choices: []gateway.Choice{{Message: gateway.Message{Role: "assistant", Content: json.RawMessage(`"shadow says hi"`)}}},
+			}, nil
+		},
+	})
+	store := testutil.NewFakeStore()
+	shadow := app.NewShadowEvaluator(reg, store, 1, []gateway.RouteTarget{{ProviderID: "shadow", Model: "claude-sonnet-4-6"}}, nil, nil)
+	h := newTestHandlerWith(func(d *Deps) {
+		d.Providers = reg
+		d.Proxy = app.NewProxyService(reg, d.Router, nil, nil)
+		d.ShadowEval = shadow
+	})
+
+	rec := postChatRecorder(h, `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "shadow") || !strings.Contains(rec.Body.String(), "chatcmpl-test") {
+		t.Errorf("client body = %s, want only the primary response", rec.Body.String())
+	}
+
+	shadow.Wait()
+	if n := shadowCalls.Load(); n != 1 {
+		t.Errorf("shadow provider called %d times, want 1", n)
+	}
+	captures := store.EvalCaptures()
+	if len(captures) != 2 {
+		t.Fatalf("captures = %d, want 2", len(captures))
+	}
+	labels := map[string]string{}
+	for _, c := range captures {
+		labels[c.Label] = c.ProviderID + "/" + c.Model
+		if !strings.Contains(string(c.Response), "chatcmpl-") {
+			t.Errorf("%s capture response = %s", c.Label, c.Response)
+		}
+	}
+	if labels[app.LabelPrimary] != "fake/gpt-4o" || labels[app.LabelShadow] != "shadow/claude-sonnet-4-6" {
+		t.Errorf("captures = %v", labels)
+	}
+}
+
+func TestEvalSample_CapturedAndExported(t *testing.T) {
+	t.Parallel()
+	store := testutil.NewFakeStore()
+	filter, err := app.NewOutputFilter(app.OutputFilterPolicy{Detectors: []string{"email"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sampler := app.NewEvalSampler(store, 0, map[string]float64{"gpt-4o": 1}, filter)
+	h := newTestHandlerWith(func(d *Deps) {
+		d.EvalSampler = sampler
+		d.Evals = store
+		d.Store = newAdminFakeStore() // mounts the admin API
+	})
+
+	rec := postChatRecorder(h, `{"model":"gpt-4o","messages":[{"role":"user","content":"mail jane@example.com"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+	}
+	// Not listed in models and sample_rate is 0: never captured.
+	postChatRecorder(h, `{"model":"gpt-4o-mini","messages":[{"role":"user","content":"hi"}]}`)
+	sampler.Wait()
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/v1/eval/export?label=sample", nil)
+	req.Header.Set("Authorization", "Bearer gnd_test")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q, want application/x-ndjson", ct)
+	}
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("exported %d lines, want 1:\n%s", len(lines), rec.Body.String())
+	}
+	var c gateway.EvalCapture
+	if err := json.Unmarshal([]byte(lines[0]), &c); err != nil {
+		t.Fatalf("line %q: %v", lines[0], err)
+	}
+	if c.Label != app.LabelSample || c.ProviderID != "fake" || c.Model != "gpt-4o" || c.GroupID != c.ID {
+		t.Errorf("capture = %+v", c)
+	}
+	if strings.Contains(string(c.Request), "jane@example.com") || !strings.Contains(string(c.Request), "[REDACTED]") {
+		t.Errorf("request = %s, want the email redacted", c.Request)
+	}
+	if !strings.Contains(string(c.Response), "chatcmpl-test") {
+		t.Errorf("response = %s, want the served response", c.Response)
+	}
+}
+
+func TestEvalExport_OrgScoped(t *testing.T) {
+	t.Parallel()
+	store := testutil.NewFakeStore()
+	store.SaveEvalCaptures(context.Background(), []gateway.EvalCapture{
+		{ID: "mine", OrgID: "default", Label: app.LabelSample},
+		{ID: "theirs", OrgID: "other-org", Label: app.LabelSample},
+	})
+	h := newTestHandlerWith(func(d *Deps) {
+		d.Evals = store
+		d.Store = newAdminFakeStore() // mounts the admin API
+	})
+	export := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin/v1/eval/export"+query, nil)
+		req.Header.Set("Authorization", "Bearer gnd_test")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := export("")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `"mine"`) || strings.Contains(body, `"theirs"`) {
+		t.Errorf("export = %s, want only the caller's org", body)
+	}
+	if rec := export("?org_id=other-org"); rec.Code != http.StatusForbidden {
+		t.Errorf("export other org: status = %d, want 403", rec.Code)
+	}
+}
+
+func postChatRecorder(h http.Handler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer gnd_test")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestConcurrencyLimit_PriorityOrder(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		maxPriority string
+		first, then string
+		want        []string
+	}{
+		{"high jumps the queue", "high", "low", "high", []string{`"high"`, `"low"`}},
+		{"high capped at normal without grant", "", "normal", "high", []string{`"normal"`, `"high"`}},
+		{"low still yields", "", "low", "high", []string{`"high"`, `"low"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := concurrencyOrder(t, priorityAuth{maxPriority: tt.maxPriority}, tt.first, tt.then); !slices.Equal(got, tt.want) {
+				t.Errorf("provider call order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// priorityAuth authenticates a key granted maxPriority.
+type priorityAuth struct{ maxPriority string }
+
+func (a priorityAuth) Authenticate(ctx context.Context, r *http.Request) (*gateway.Identity, error) {
+	id, err := fakeAuth{}.Authenticate(ctx, r)
+	if err == nil {
+		id.MaxPriority = a.maxPriority
+	}
+	return id, err
+}
+
+// concurrencyOrder queues a request at priority first, then one at then,
+// behind a single held concurrency slot, and returns the order the
+// provider saw them in.
+func concurrencyOrder(t *testing.T, auth gateway.Authenticator, first, then string) []string {
+	t.Helper()
+	var mu sync.Mutex
+	var order []string
+	reg := provider.NewRegistry()
+	reg.Register("fake", &testutil.FakeProvider{
+		ProviderName: "fake",
+		ChatFn: func(ctx context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			mu.Lock()
+			order = append(order, string(req.Messages[0].Content))
+			mu.Unlock()
+			return fakeProvider{}.ChatCompletion(ctx, nil)
+		},
+	})
+	limiter := ratelimit.NewConcurrencyLimiter(1)
+	h := newTestHandlerWith(func(d *Deps) {
+		d.Auth = auth
+		d.Providers = reg
+		d.Proxy = app.NewProxyService(reg, d.Router, nil, nil)
+		d.Concurrency = limiter
+	})
+
+	// Hold the only slot so both requests queue.
+	if err := limiter.Acquire(context.Background(), ratelimit.PriorityNormal); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	send := func(prio string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := `{"model":"gpt-4o","messages":[{"role":"user","content":"` + prio + `"}]}`
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer gnd_test")
+			req.Header.Set("X-Gandalf-Priority", prio)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Errorf("%s: status = %d, want 200; body = %s", prio, rec.Code, rec.Body.String())
+			}
+		}()
+	}
+	waitQueued := func(n int) {
+		deadline := time.Now().Add(2 * time.Second)
+		for limiter.Waiting() != n {
+			if time.Now().After(deadline) {
+				t.Fatalf("waiting = %d, want %d", limiter.Waiting(), n)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	send(first)
+	waitQueued(1)
+	send(then)
+	waitQueued(2)
+
+	limiter.Release()
+	wg.Wait()
+	return order
+}
+
+func TestConcurrencyLimit_Rejections(t *testing.T) {
+	t.Parallel()
+	limiter := ratelimit.NewConcurrencyLimiter(1)
+	h := newTestHandlerWith(func(d *Deps) { d.Concurrency = limiter })
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer gnd_test")
+	req.Header.Set("X-Gandalf-Priority", "urgent")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid priority: status = %d, want 400", rec.Code)
+	}
+
+	// Saturated: a request whose deadline passes while queued gets 503.
+	if err := limiter.Acquire(context.Background(), ratelimit.PriorityNormal); err != nil {
+		t.Fatal(err)
+	}
+	defer limiter.Release()
+	req = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer gnd_test")
+	req.Header.Set("X-Gandalf-Deadline", "30ms")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("saturated: status = %d, want 503; body = %s", rec.Code, rec.Body.String())
+	}
+	if n := limiter.Waiting(); n != 0 {
+		t.Errorf("waiting = %d after timeout, want 0", n)
+	}
+}
+
+func TestDebugTrace(t *testing.T) {
+	t.Parallel()
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`
+
+	tests := []struct {
+		name   string
+		auth   gateway.Authenticator
+		header string
+		want   bool
+	}{
+		{"admin with header", fakeAuth{}, "true", true},
+		{"admin without header", fakeAuth{}, "", false},
+		{"admin header false", fakeAuth{}, "false", false},
+		{"member with header", memberAuth{}, "true", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			h := newTestHandlerWith(func(d *Deps) { d.Auth = tt.auth })
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer gnd_test")
+			if tt.header != "" {
+				req.Header.Set(hdrDebug, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+			}
+
+			var resp gateway.ChatResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if !tt.want {
+				if resp.Debug != nil {
+					t.Errorf("x_gandalf_debug = %+v, want absent", resp.Debug)
+				}
+				return
+			}
+			dt := resp.Debug
+			if dt == nil {
+				t.Fatal("x_gandalf_debug missing")
+			}
+			if len(dt.Route) != 1 || dt.Route[0].Provider != "fake" || dt.Route[0].Model != "gpt-4o" {
+				t.Errorf("route = %+v", dt.Route)
+			}
+			if len(dt.Attempts) != 1 || dt.Attempts[0].Outcome != "ok" {
+				t.Errorf("attempts = %+v", dt.Attempts)
+			}
+			if dt.Cache != "off" {
+				t.Errorf("cache = %q, want off", dt.Cache)
+			}
+			if dt.EstimatedTokens <= 0 {
+				t.Errorf("estimated_prompt_tokens = %d, want > 0", dt.EstimatedTokens)
+			}
+		})
+	}
+}
+
+func TestChatCompletion_DeniedTool(t *testing.T) {
+	t.Parallel()
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:          "r-1",
+		ModelAlias:  "gpt-4o",
+		Targets:     []byte(`[{"provider_id":"fake","model":"gpt-4o","priority":1}]`),
+		Strategy:    "priority",
+		DeniedTools: []string{"shell_exec"},
+	})
+	h := newTestHandlerWith(func(d *Deps) {
+		routerSvc := app.NewRouterService(store)
+		d.Router = routerSvc
+		d.Proxy = app.NewProxyService(d.Providers, routerSvc, nil, nil)
+		d.OrgDeniedTools = map[string][]string{"default": {"run_sql"}, "other": {"get_weather"}}
+	})
+
+	tool := func(name string) string {
+		return `{"type":"function","function":{"name":"` + name + `","parameters":{"type":"object"}}}`
+	}
+	tests := []struct {
+		name  string
+		tools string
+		want  int
+	}{
+		{"no tools", ``, http.StatusOK},
+		{"allowed tool", `,"tools":[` + tool("get_weather") + `]`, http.StatusOK},
+		{"denied tool", `,"tools":[` + tool("get_weather") + `,` + tool("shell_exec") + `]`, http.StatusForbidden},
+		{"denied tool other case", `,"tools":[` + tool("Shell_Exec") + `]`, http.StatusForbidden},
+		{"org denied tool", `,"tools":[` + tool("run_sql") + `]`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]` + tt.tools + `}`
+		rec := postChatRecorder(h, body)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d; body = %s", tt.name, rec.Code, tt.want, rec.Body.String())
+		}
+		if tt.want == http.StatusForbidden && !strings.Contains(rec.Body.String(), "tool not allowed") {
+			t.Errorf("%s: body = %s, want tool not allowed", tt.name, rec.Body.String())
+		}
+	}
+}
+
+// TestChatCompletion_AnthropicMaxTokensRequired verifies that with default
+// max_tokens injection turned off, an Anthropic-routed request without
+// max_tokens is rejected at the gateway naming the field, and never reaches
+// the upstream.
+func TestChatCompletion_AnthropicMaxTokensRequired(t *testing.T) {
+	t.Parallel()
+
+	var upstreamCalls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		upstreamCalls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"msg_1","model":"claude-sonnet-4-6","content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn"}`)
+	}))
+	defer upstream.Close()
+
+	client := anthropic.New("anthropic", upstream.URL+"/v1", nil)
+	client.SetDefaultMaxTokens(0)
+	h := buildHandler(t, "anthropic", "claude-sonnet-4-6", client)
+
+	rec := postChatRecorder(h, `{"model":"claude-sonnet-4-6","messages":[{"role":"user","content":"hi"}]}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400; body = %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "max_tokens is required by provider anthropic") {
+		t.Errorf("body = %s, want message naming max_tokens", rec.Body.String())
+	}
+	if n := upstreamCalls.Load(); n != 0 {
+		t.Errorf("upstream calls = %d, want 0", n)
+	}
+
+	rec = postChatRecorder(h, `{"model":"claude-sonnet-4-6","messages":[{"role":"user","content":"hi"}],"max_tokens":32}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("with max_tokens: status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+
+	// With the default (injection on), the same request goes through.
+	h = buildHandler(t, "anthropic", "claude-sonnet-4-6", anthropic.New("anthropic", upstream.URL+"/v1", nil))
+	rec = postChatRecorder(h, `{"model":"claude-sonnet-4-6","messages":[{"role":"user","content":"hi"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("default injection: status = %d; body = %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestStrictContentType(t *testing.T) {
+	t.Parallel()
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`
+	tests := []struct {
+		name        string
+		strict      bool
+		contentType string
+		want        int
+	}{
+		{"lenient wrong type", false, "text/plain", http.StatusOK},
+		{"lenient missing type", false, "", http.StatusOK},
+		{"strict json", true, "application/json", http.StatusOK},
+		{"strict json with charset", true, "application/json; charset=utf-8", http.StatusOK},
+		{"strict wrong type", true, "text/plain", http.StatusUnsupportedMediaType},
+		{"strict missing type", true, "", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			h := newTestHandlerWith(func(d *Deps) { d.StrictContentType = tt.strict })
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer gnd_test")
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d; body = %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestGlobalModelPolicy(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		allow []string
+		deny  []string
+		path  string
+		model string
+		want  int
+	}{
+		{"denied chat", nil, []string{"gpt-3.5-turbo"}, "/v1/chat/completions", "gpt-3.5-turbo", http.StatusForbidden},
+		{"denied embeddings", nil, []string{"gpt-3.5-turbo"}, "/v1/embeddings", "gpt-3.5-turbo", http.StatusForbidden},
+		{"not denied", nil, []string{"gpt-3.5-turbo"}, "/v1/chat/completions", "gpt-4o", http.StatusOK},
+		{"allowed", []string{"gpt-4o"}, nil, "/v1/chat/completions", "gpt-4o", http.StatusOK},
+		{"outside allowlist", []string{"gpt-4o"}, nil, "/v1/chat/completions", "gpt-3.5-turbo", http.StatusForbidden},
+		{"deny wins over allow", []string{"gpt-4o"}, []string{"gpt-4o"}, "/v1/chat/completions", "gpt-4o", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			h := newTestHandlerWith(func(d *Deps) {
+				// An admin key whose own allowlist includes every model under test.
+				d.Auth = restrictedModelAuth{allowed: []string{"gpt-4o", "gpt-3.5-turbo"}}
+				d.ModelAllowlist = tt.allow
+				d.ModelDenylist = tt.deny
+			})
+			body := `{"model":"` + tt.model + `","messages":[{"role":"user","content":"hi"}],"input":"hi"}`
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer gnd_test")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d; body = %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+// TestGlobalModelPolicy_ResolvedModels verifies that the model policy also
+// applies to normalized names, the route alias, and the route's targets.
+func TestGlobalModelPolicy_ResolvedModels(t *testing.T) {
+	t.Parallel()
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:         "r-cheap",
+		ModelAlias: "cheap",
+		Targets:    []byte(`[{"provider_id":"fake","model":"gpt-4o","priority":1},{"provider_id":"fake","model":"gpt-3.5-turbo","priority":2}]`),
+		Strategy:   "priority",
+	})
+	store.AddRoute(&gateway.Route{
+		ID:         "r-gpt-4o",
+		ModelAlias: "gpt-4o",
+		Targets:    []byte(`[{"provider_id":"fake","model":"gpt-4o","priority":1}]`),
+		Strategy:   "priority",
+	})
+	tests := []struct {
+		name  string
+		allow []string
+		deny  []string
+		model string
+		want  int
+	}{
+		{"denied target behind alias", nil, []string{"gpt-3.5-turbo"}, "cheap", http.StatusForbidden},
+		{"denied normalized name", nil, []string{"gpt-4o"}, "GPT-4o-2024-08-06", http.StatusForbidden},
+		{"alias allowed but target not", []string{"cheap", "gpt-4o"}, nil, "cheap", http.StatusForbidden},
+		{"alias and targets allowed", []string{"cheap", "gpt-4o", "gpt-3.5-turbo"}, nil, "cheap", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			h := newTestHandlerWith(func(d *Deps) {
+				routerSvc := app.NewRouterService(store)
+				d.Router = routerSvc
+				d.Proxy = app.NewProxyService(d.Providers, routerSvc, nil, nil)
+				d.ModelAllowlist = tt.allow
+				d.ModelDenylist = tt.deny
+			})
+			rec := postChatRecorder(h, `{"model":"`+tt.model+`","messages":[{"role":"user","content":"hi"}]}`)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d; body = %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequireCapabilityHeader(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		header string
+		want   int
+	}{
+		{"vision, tools", http.StatusOK}, // fakeProvider reports no capabilities, so it is kept
+		{"telepathy", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			t.Parallel()
+			h := newTestHandler()
+			body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer gnd_test")
+			req.Header.Set("X-Gandalf-Require", tt.header)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d; body = %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+// schemaRouteStore serves fakeRouteStore's route with a response schema the
+// fake provider's plain-text reply never satisfies.
+type schemaRouteStore struct {
+	fakeRouteStore
+	policy string
+}
+
+func (s schemaRouteStore) GetRouteByAlias(ctx context.Context, alias string) (*gateway.Route, error) {
+	r, _ := s.fakeRouteStore.GetRouteByAlias(ctx, alias)
+	r.ResponseSchema = []byte(`{"type":"object"}`)
+	r.SchemaPolicy = s.policy
+	return r, nil
+}
+
+func TestResponseSchemaViolation(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		policy     string
+		wantStatus int
+		wantHeader bool
+	}{
+		{gateway.SchemaReject, http.StatusBadGateway, false},
+		{gateway.SchemaAnnotate, http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			t.Parallel()
+			h := newTestHandlerWith(func(d *Deps) {
+				d.Router = app.NewRouterService(schemaRouteStore{policy: tt.policy})
+				d.Proxy = app.NewProxyService(d.Providers, d.Router, nil, nil)
+			})
+			body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer gnd_test")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d; body = %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if got := rec.Header().Get("X-Gandalf-Schema-Violation"); (got != "") != tt.wantHeader {
+				t.Errorf("X-Gandalf-Schema-Violation = %q, want set = %v", got, tt.wantHeader)
+			}
+		})
+	}
+}
+
+func TestBetaFeatureHeaders(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+		betas  []string // forwarded to anthropic providers
+		noList bool     // no beta_features configured
+	}{
+		{"allowed", "X-Anthropic-Beta", "prompt-caching-2024-07-31, output-128k-2025-02-19", http.StatusOK, []string{"prompt-caching-2024-07-31", "output-128k-2025-02-19"}, false},
+		{"not allowlisted", "X-Anthropic-Beta", "computer-use-2024-10-22", http.StatusBadRequest, nil, false},
+		{"no allowlist for type", "X-OpenAI-Beta", "assistants=v2", http.StatusBadRequest, nil, false},
+		{"absent", "", "", http.StatusOK, nil, false},
+		{"no allowlist ignores header", "X-Anthropic-Beta", "computer-use-2024-10-22", http.StatusOK, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var got []string
+			h := newTestHandlerWith(func(d *Deps) {
+				d.Providers.Register("fake", &testutil.FakeProvider{
+					ProviderName: "fake",
+					ChatFn: func(ctx context.Context, _ *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+						got = gateway.BetaFeaturesFromContext(ctx, "anthropic")
+						return &gateway.ChatResponse{ID: "chatcmpl-test"}, nil
+					},
+				})
+				if !tt.noList {
+					d.BetaFeatures = map[string][]string{"anthropic": {"prompt-caching-2024-07-31", "output-128k-2025-02-19"}}
+				}
+			})
+			body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer gnd_test")
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d; body = %s", rec.Code, tt.want, rec.Body.String())
+			}
+			if !slices.Equal(got, tt.betas) {
+				t.Errorf("anthropic betas = %q, want %q", got, tt.betas)
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package server
 
 import (
+	"fmt"
 	"net/http"
+
+	gateway "github.com/eugener/gandalf/internal"
 )
 
 // Pre-allocated byte slices for SSE formatting. These avoid heap allocations
@@ -54,6 +57,41 @@ func writeSSEError(w http.ResponseWriter, msg string) {
 	w.Write(sseNewline)
 }
 
+// writeSSEUsage writes stream token usage as an SSE comment, since headers
+// are already sent. Clients ignore comments; accounting proxies can read
+// the same names as the non-streaming headers:
+//
+//	: X-Gandalf-Prompt-Tokens: 5
+//	: X-Gandalf-Completion-Tokens: 2
+//	: X-Gandalf-Total-Tokens: 7
+//
+// No-op when usage is unknown.
+func writeSSEUsage(w http.ResponseWriter, u *gateway.Usage) {
+	if u == nil {
+		return
+	}
+	fmt.Fprintf(w, ": %s: %d\n: %s: %d\n: %s: %d\n\n",
+		hdrPromptTokens, u.PromptTokens,
+		hdrCompletionTokens, u.CompletionTokens,
+		hdrTotalTokens, u.TotalTokens)
+}
+
+// writeSSEUsageEvent writes stream token usage as a named SSE event for
+// clients that subscribe to it:
+//
+//	event: usage
+//	data: {"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}
+//
+// OpenAI-compatible clients only read unnamed data frames and skip it.
+// No-op when usage is unknown.
+func writeSSEUsageEvent(w http.ResponseWriter, u *gateway.Usage) {
+	if u == nil {
+		return
+	}
+	fmt.Fprintf(w, "event: usage\ndata: {\"prompt_tokens\":%d,\"completion_tokens\":%d,\"total_tokens\":%d}\n\n",
+		u.PromptTokens, u.CompletionTokens, u.TotalTokens)
+}
+
 // writeSSEKeepAlive writes an SSE comment to keep the connection alive.
 func writeSSEKeepAlive(w http.ResponseWriter) {
 	w.Write(sseKeepAlive)
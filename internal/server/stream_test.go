@@ -11,12 +11,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/tidwall/gjson"
+
 	gateway "github.com/eugener/gandalf/internal"
 	"github.com/eugener/gandalf/internal/app"
 	"github.com/eugener/gandalf/internal/provider"
 	"github.com/eugener/gandalf/internal/provider/anthropic"
 	"github.com/eugener/gandalf/internal/provider/gemini"
 	"github.com/eugener/gandalf/internal/provider/openai"
+	"github.com/eugener/gandalf/internal/ratelimit"
 	"github.com/eugener/gandalf/internal/testutil"
 )
 
@@ -166,6 +169,135 @@ func TestStreamClientDisconnect(t *testing.T) {
 	}
 }
 
+// TestStreamClientCancelRecordsDelivered verifies that a stream the client
+// abandons is recorded as canceled, with completion tokens covering only
+// the content that was delivered.
+func TestStreamClientCancelRecordsDelivered(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		counter    TokenCounter
+		completion int
+	}{
+		// "think", "Hello there" and " friend" at ~4 bytes per token each: 2+3+2.
+		{"byte estimate", nil, 7},
+		{"token counter", lengthCounter{}, 23},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			reg := provider.NewRegistry()
+			reg.Register("fake", &testutil.FakeProvider{
+				ProviderName: "fake",
+				StreamFn: func(ctx context.Context, _ *gateway.ChatRequest) (<-chan gateway.StreamChunk, error) {
+					ch := make(chan gateway.StreamChunk)
+					go func() {
+						defer close(ch)
+						ch <- gateway.StreamChunk{Data: []byte(`{"id":"1","choices":[{"delta":{"reasoning_content":"think"}}]}`)}
+						for _, word := range []string{"Hello there", " friend"} {
+							ch <- gateway.StreamChunk{Data: []byte(`{"id":"1","choices":[{"delta":{"content":"` + word + `"}}]}`)}
+						}
+						<-ctx.Done()
+						ch <- gateway.StreamChunk{Data: []byte(`{"id":"1","choices":[{"delta":{"content":"` + strings.Repeat("x", 400) + `"}}]}`)}
+					}()
+					return ch, nil
+				},
+			})
+			store := testutil.NewFakeStore()
+			store.AddRoute(&gateway.Route{
+				ID:         "r-1",
+				ModelAlias: "test-model",
+				Targets:    []byte(`[{"provider_id":"fake","model":"test-model","priority":1}]`),
+				Strategy:   "priority",
+			})
+			usage := &capturingRecorder{}
+			routerSvc := app.NewRouterService(store)
+			h := New(Deps{
+				Auth:               testutil.FakeAuth{},
+				Proxy:              app.NewProxyService(reg, routerSvc, nil, nil),
+				Usage:              usage,
+				TokenCounter:       tt.counter,
+				FixedTokenEstimate: 7,
+			})
+
+			body := `{"model":"test-model","messages":[{"role":"user","content":"hi"}],"stream":true}`
+			ctx, cancel := context.WithCancel(context.Background())
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)).WithContext(ctx)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer gnd_test")
+
+			w := &flushNotifier{ResponseRecorder: httptest.NewRecorder(), match: " friend", flushed: make(chan struct{})}
+			done := make(chan struct{})
+			go func() {
+				h.ServeHTTP(w, req)
+				close(done)
+			}()
+			// Cancel once the last chunk has been flushed to the client.
+			select {
+			case <-w.flushed:
+			case <-time.After(2 * time.Second):
+				t.Fatal("last chunk was never flushed")
+			}
+			cancel()
+			select {
+			case <-done:
+			case <-time.After(2 * time.Second):
+				t.Fatal("handler did not return after context cancel")
+			}
+
+			usage.mu.Lock()
+			defer usage.mu.Unlock()
+			if len(usage.records) != 1 {
+				t.Fatalf("usage records = %d, want 1", len(usage.records))
+			}
+			got := usage.records[0]
+			if !got.Canceled || got.StatusCode != statusClientClosedRequest {
+				t.Errorf("canceled = %v, status = %d, want true, 499", got.Canceled, got.StatusCode)
+			}
+			prompt := 7
+			if tt.counter != nil {
+				prompt = tt.counter.EstimateRequest("test-model", nil)
+			}
+			if got.PromptTokens != prompt || got.CompletionTokens != tt.completion || got.TotalTokens != prompt+tt.completion {
+				t.Errorf("tokens = %d/%d/%d, want %d/%d/%d", got.PromptTokens, got.CompletionTokens, got.TotalTokens,
+					prompt, tt.completion, prompt+tt.completion)
+			}
+		})
+	}
+}
+
+// lengthCounter counts one token per byte of text and 3 per request.
+type lengthCounter struct{}
+
+func (lengthCounter) EstimateRequest(string, []gateway.Message) int { return 3 }
+func (lengthCounter) CountText(_, text string) int                  { return len(text) }
+
+// flushNotifier closes flushed on the first flush after a write containing
+// match.
+type flushNotifier struct {
+	*httptest.ResponseRecorder
+	match   string
+	seen    bool
+	flushed chan struct{}
+}
+
+func (w *flushNotifier) Write(b []byte) (int, error) {
+	if strings.Contains(string(b), w.match) {
+		w.seen = true
+	}
+	return w.ResponseRecorder.Write(b)
+}
+
+func (w *flushNotifier) Flush() {
+	w.ResponseRecorder.Flush()
+	if w.seen {
+		w.seen = false
+		close(w.flushed)
+	}
+}
+
 // TestStreamProviderFailover verifies that the stream falls back to the
 // secondary provider when the primary fails.
 func TestStreamProviderFailover(t *testing.T) {
@@ -213,6 +345,200 @@ func TestStreamProviderFailover(t *testing.T) {
 
 // buildHandler creates a test HTTP handler with a single provider and a
 // matching route for the given model alias.
+// TestStreamBufferedAggregation verifies that a stream:true request with
+// X-Gandalf-Buffer-Stream: true gets one chat.completion aggregated from the
+// upstream SSE stream, including finish_reason and usage.
+func TestStreamBufferedAggregation(t *testing.T) {
+	t.Parallel()
+
+	var upstreamStream bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Stream bool `json:"stream"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		upstreamStream = body.Stream
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w,
+			"data: {\"id\":\"c1\",\"created\":42,\"model\":\"gpt-4o\",\"system_fingerprint\":\"fp_1\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"Hi\"}}]}\n\n"+
+				"data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\" there\"}}]}\n\n"+
+				"data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":2,\"total_tokens\":7}}\n\n"+
+				"data: [DONE]\n\n",
+		)
+	}))
+	defer upstream.Close()
+
+	h := buildHandler(t, "openai", "gpt-4o", openai.New("openai", upstream.URL+"/v1", nil))
+
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"stream":true}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gandalf-Buffer-Stream", "true")
+	req.Header.Set("Authorization", "Bearer gnd_test")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	if !upstreamStream {
+		t.Error("upstream request should still use stream:true")
+	}
+
+	var resp gateway.ChatResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body.String(), err)
+	}
+	if resp.Object != "chat.completion" || resp.ID != "c1" || resp.Created != 42 || resp.SystemFingerprint != "fp_1" {
+		t.Errorf("envelope = %+v", resp)
+	}
+	if len(resp.Choices) != 1 {
+		t.Fatalf("choices = %d, want 1", len(resp.Choices))
+	}
+	c := resp.Choices[0]
+	if c.Message.Role != "assistant" || string(c.Message.Content) != `"Hi there"` || c.FinishReason != "stop" {
+		t.Errorf("choice = %s %s %q, want assistant \"Hi there\" stop", c.Message.Role, c.Message.Content, c.FinishReason)
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 7 {
+		t.Errorf("usage = %+v, want total 7", resp.Usage)
+	}
+}
+
+// TestStreamBufferedStopMatchesNonStreaming verifies that a provider which
+// ignores stop sequences is trimmed the same way whether the response is
+// aggregated from a stream, streamed live, or returned directly.
+func TestStreamBufferedStopMatchesNonStreaming(t *testing.T) {
+	t.Parallel()
+
+	fp := &testutil.FakeProvider{
+		ProviderName: "ollama",
+		ChatFn: func(_ context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			return &gateway.ChatResponse{
+				ID:      "c1",
+				Model:   req.Model,
+				Choices: []gateway.Choice{{Message: gateway.Message{Role: "assistant", Content: json.RawMessage(`"Hello END world"`)}, FinishReason: "length"}},
+			}, nil
+		},
+		StreamFn: func(context.Context, *gateway.ChatRequest) (<-chan gateway.StreamChunk, error) {
+			ch := make(chan gateway.StreamChunk, 4)
+			ch <- gateway.StreamChunk{Data: []byte(`{"id":"c1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hello E"}}]}`)}
+			ch <- gateway.StreamChunk{Data: []byte(`{"id":"c1","choices":[{"index":0,"delta":{"content":"ND world"}}]}`)}
+			ch <- gateway.StreamChunk{Data: []byte(`{"id":"c1","choices":[{"index":0,"delta":{},"finish_reason":"length"}]}`)}
+			ch <- gateway.StreamChunk{Done: true}
+			close(ch)
+			return ch, nil
+		},
+	}
+	h := buildHandler(t, "ollama", "llama3", fp)
+
+	choice := func(stream bool) gateway.Choice {
+		t.Helper()
+		body := fmt.Sprintf(`{"model":"llama3","messages":[{"role":"user","content":"hi"}],"stop":["END"],"stream":%v}`, stream)
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Gandalf-Buffer-Stream", "true")
+		req.Header.Set("Authorization", "Bearer gnd_test")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("stream=%v: status = %d; body = %s", stream, rec.Code, rec.Body.String())
+		}
+		var resp gateway.ChatResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Choices) != 1 {
+			t.Fatalf("stream=%v: decode %s: %v", stream, rec.Body.String(), err)
+		}
+		return resp.Choices[0]
+	}
+
+	direct, aggregated := choice(false), choice(true)
+	if string(direct.Message.Content) != `"Hello "` || direct.FinishReason != "stop" {
+		t.Errorf("non-streaming = %s/%s, want \"Hello \"/stop", direct.Message.Content, direct.FinishReason)
+	}
+	if string(aggregated.Message.Content) != string(direct.Message.Content) || aggregated.FinishReason != direct.FinishReason {
+		t.Errorf("aggregated = %s/%s, want %s/%s", aggregated.Message.Content, aggregated.FinishReason, direct.Message.Content, direct.FinishReason)
+	}
+
+	// Live SSE passthrough is cut at the same place.
+	body := `{"model":"llama3","messages":[{"role":"user","content":"hi"}],"stop":["END"],"stream":true}`
+	rec := postChatRecorder(h, body)
+	var content, finish string
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		r := gjson.Get(data, "choices.0")
+		content += r.Get("delta.content").String()
+		if f := r.Get("finish_reason").String(); f != "" {
+			finish = f
+		}
+	}
+	if `"`+content+`"` != string(direct.Message.Content) || finish != direct.FinishReason {
+		t.Errorf("live stream = %q/%s, want %s/%s; body = %s", content, finish, direct.Message.Content, direct.FinishReason, rec.Body.String())
+	}
+}
+
+func TestStreamAggregate_ToolCalls(t *testing.T) {
+	t.Parallel()
+
+	var agg streamAggregate
+	agg.add([]byte(`{"id":"c2","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`))
+	agg.add([]byte(`{"id":"c2","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`))
+	agg.add([]byte(`{"id":"c2","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]},"finish_reason":"tool_calls"}]}`))
+	agg.add([]byte(`not json`))
+
+	resp := agg.response()
+	if len(resp.Choices) != 1 {
+		t.Fatalf("choices = %d, want 1", len(resp.Choices))
+	}
+	msg := resp.Choices[0].Message
+	if string(msg.Content) != "null" {
+		t.Errorf("content = %s, want null", msg.Content)
+	}
+	want := `[{"function":{"arguments":"{\"city\":\"Paris\"}","name":"get_weather"},"id":"call_1","type":"function"}]`
+	if string(msg.ToolCalls) != want {
+		t.Errorf("tool_calls = %s, want %s", msg.ToolCalls, want)
+	}
+	if resp.Choices[0].FinishReason != "tool_calls" {
+		t.Errorf("finish_reason = %q, want tool_calls", resp.Choices[0].FinishReason)
+	}
+}
+
+func TestWantsBufferedStream(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		accept string
+		buffer string
+		config bool
+		want   bool
+	}{
+		{"", "", false, false},
+		{"text/event-stream", "", false, false},
+		{"application/json", "", false, false}, // what OpenAI SDKs send on streaming calls
+		{"application/json", "true", false, true},
+		{"", "false", false, false},
+		{"", "", true, true},
+	}
+	for _, tt := range tests {
+		s := &server{deps: Deps{BufferStreams: tt.config}}
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		if tt.buffer != "" {
+			r.Header.Set("X-Gandalf-Buffer-Stream", tt.buffer)
+		}
+		if got := s.wantsBufferedStream(r); got != tt.want {
+			t.Errorf("Accept %q, buffer header %q, config %v: got %v, want %v", tt.accept, tt.buffer, tt.config, got, tt.want)
+		}
+	}
+}
+
 func buildHandler(t *testing.T, providerName, modelAlias string, p gateway.Provider) http.Handler {
 	t.Helper()
 
@@ -253,3 +579,514 @@ func assertSSEResponse(t *testing.T, rec *httptest.ResponseRecorder, containsTex
 		t.Errorf("response missing %q, got:\n%s", containsSentinel, body)
 	}
 }
+
+// TestStreamRepairToolArguments verifies that a stream cut off mid tool call
+// gets a closing arguments delta, and unrepairable arguments are flagged.
+func TestStreamUsageEvent(t *testing.T) {
+	t.Parallel()
+
+	stream := func(enabled bool) string {
+		t.Helper()
+		reg := provider.NewRegistry()
+		reg.Register("fake", streamWithUsageProvider{})
+		routerSvc := app.NewRouterService(&fakeRouteStore{})
+		h := New(Deps{
+			Auth:             fakeAuth{},
+			Proxy:            app.NewProxyService(reg, routerSvc, nil, nil),
+			Router:           routerSvc,
+			StreamUsageEvent: enabled,
+		})
+		rec := postChatRecorder(h, `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"stream":true}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+		}
+		return rec.Body.String()
+	}
+
+	const event = "event: usage\ndata: {\"prompt_tokens\":10,\"completion_tokens\":32,\"total_tokens\":42}\n\n"
+	body := stream(true)
+	i := strings.Index(body, event)
+	if i < 0 {
+		t.Fatalf("usage event missing; body = %s", body)
+	}
+	if !strings.HasSuffix(body, event+"data: [DONE]\n\n") {
+		t.Errorf("usage event should come right before [DONE]; body = %s", body)
+	}
+
+	if body := stream(false); strings.Contains(body, "event: usage") {
+		t.Errorf("usage event sent while disabled; body = %s", body)
+	}
+}
+
+func TestStreamRepairToolArguments(t *testing.T) {
+	t.Parallel()
+
+	fp := &testutil.FakeProvider{
+		ProviderName: "fake",
+		StreamFn: func(context.Context, *gateway.ChatRequest) (<-chan gateway.StreamChunk, error) {
+			ch := make(chan gateway.StreamChunk, 4)
+			ch <- gateway.StreamChunk{Data: []byte(`{"id":"c3","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Par"}},{"index":1,"id":"call_2","type":"function","function":{"name":"get_time","arguments":"{\"tz\":\"UTC\","}}]}}]}`)}
+			ch <- gateway.StreamChunk{Done: true}
+			close(ch)
+			return ch, nil
+		},
+	}
+
+	stream := func(repair bool) []string {
+		t.Helper()
+		reg := provider.NewRegistry()
+		reg.Register("fake", fp)
+		routerSvc := app.NewRouterService(&fakeRouteStore{})
+		h := New(Deps{
+			Auth:                fakeAuth{},
+			Proxy:               app.NewProxyService(reg, routerSvc, nil, nil),
+			Router:              routerSvc,
+			RepairToolArguments: repair,
+		})
+		body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"stream":true}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer gnd_test")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d; body = %s", rec.Code, rec.Body.String())
+		}
+		var events []string
+		for _, line := range strings.Split(rec.Body.String(), "\n") {
+			if data, ok := strings.CutPrefix(line, "data: "); ok {
+				events = append(events, data)
+			}
+		}
+		return events
+	}
+
+	if events := stream(false); len(events) != 2 {
+		t.Errorf("repair disabled: events = %q, want upstream chunk + [DONE]", events)
+	}
+
+	events := stream(true)
+	if len(events) != 3 || events[2] != "[DONE]" {
+		t.Fatalf("events = %q, want upstream chunk, repair chunk, [DONE]", events)
+	}
+	var agg streamAggregate
+	agg.add([]byte(events[0]))
+	agg.add([]byte(events[1]))
+	resp := agg.response()
+	want := `[{"function":{"arguments":"{\"city\":\"Par\"}","name":"get_weather"},"id":"call_1","type":"function"},` +
+		`{"function":{"arguments":"{\"tz\":\"UTC\",","name":"get_time"},"id":"call_2","type":"function"}]`
+	if got := string(resp.Choices[0].Message.ToolCalls); got != want {
+		t.Errorf("client-side tool_calls = %s, want %s", got, want)
+	}
+
+	var repair struct {
+		ID      string `json:"id"`
+		Gandalf struct {
+			ToolArguments []struct {
+				Choice int    `json:"choice"`
+				Index  int    `json:"index"`
+				Status string `json:"status"`
+			} `json:"tool_arguments"`
+		} `json:"x_gandalf"`
+	}
+	if err := json.Unmarshal([]byte(events[1]), &repair); err != nil {
+		t.Fatal(err)
+	}
+	flags := repair.Gandalf.ToolArguments
+	if repair.ID != "c3" || len(flags) != 2 ||
+		flags[0].Index != 0 || flags[0].Status != "repaired" ||
+		flags[1].Index != 1 || flags[1].Status != "invalid" {
+		t.Errorf("repair chunk = %s", events[1])
+	}
+}
+
+func TestJSONRepairSuffix(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{``, `{}`, true},
+		{`{"a":1`, `}`, true},
+		{`{"a":"x`, `"}`, true},
+		{`{"a":"x\`, `\"}`, true},
+		{`{"a":[1,{"b":2`, `}]}`, true},
+		{`{"a":`, `null}`, true},
+		{`{"a"`, `:null}`, true},
+		{`{"a":"}{"`, `}`, true},
+		{`{"a":1,`, ``, false},
+		{`{"a":tru`, ``, false},
+	}
+	for _, tt := range tests {
+		got, ok := jsonRepairSuffix(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("jsonRepairSuffix(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// TestStreamRecordsTTFB verifies that a streamed request's usage record
+// carries the time to its first chunk separately from total latency.
+func TestStreamRecordsTTFB(t *testing.T) {
+	t.Parallel()
+
+	reg := provider.NewRegistry()
+	reg.Register("fake", &testutil.FakeProvider{
+		ProviderName: "fake",
+		StreamFn: func(context.Context, *gateway.ChatRequest) (<-chan gateway.StreamChunk, error) {
+			ch := make(chan gateway.StreamChunk)
+			go func() {
+				defer close(ch)
+				time.Sleep(10 * time.Millisecond)
+				for _, word := range []string{"Hello", " there", "!"} {
+					ch <- gateway.StreamChunk{Data: []byte(`{"id":"1","choices":[{"delta":{"content":"` + word + `"}}]}`)}
+					time.Sleep(30 * time.Millisecond)
+				}
+				ch <- gateway.StreamChunk{Done: true}
+			}()
+			return ch, nil
+		},
+	})
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:         "r-1",
+		ModelAlias: "test-model",
+		Targets:    []byte(`[{"provider_id":"fake","model":"test-model","priority":1}]`),
+		Strategy:   "priority",
+	})
+	usage := &capturingRecorder{}
+	routerSvc := app.NewRouterService(store)
+	h := New(Deps{
+		Auth:  testutil.FakeAuth{},
+		Proxy: app.NewProxyService(reg, routerSvc, nil, nil),
+		Usage: usage,
+	})
+
+	body := `{"model":"test-model","messages":[{"role":"user","content":"hi"}],"stream":true}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer gnd_test")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assertSSEResponse(t, rec, "Hello", "[DONE]")
+
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+	if len(usage.records) != 1 {
+		t.Fatalf("usage records = %d, want 1", len(usage.records))
+	}
+	got := usage.records[0]
+	if got.TTFBMs < 10 {
+		t.Errorf("TTFBMs = %d, want >= 10 (first chunk is delayed 10ms)", got.TTFBMs)
+	}
+	if got.TTFBMs >= got.LatencyMs {
+		t.Errorf("TTFBMs = %d, want less than LatencyMs = %d", got.TTFBMs, got.LatencyMs)
+	}
+}
+
+// TestStreamDowngrade verifies that when every streaming attempt fails
+// before the first byte, a non-streaming response from the next provider
+// is replayed to the client as SSE.
+func TestStreamDowngrade(t *testing.T) {
+	t.Parallel()
+
+	newHandler := func(downgrade bool) (http.Handler, *capturingRecorder) {
+		reg := provider.NewRegistry()
+		reg.Register("primary", &testutil.FakeProvider{
+			ProviderName: "primary",
+			ChatFn: func(context.Context, *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+				return nil, errors.New("primary down")
+			},
+			StreamFn: func(context.Context, *gateway.ChatRequest) (<-chan gateway.StreamChunk, error) {
+				return nil, errors.New("primary down")
+			},
+		})
+		// No StreamFn: the secondary can only answer without streaming.
+		reg.Register("secondary", &testutil.FakeProvider{
+			ProviderName: "secondary",
+			ChatFn: func(_ context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+				if req.Stream {
+					return nil, errors.New("downgraded request still has stream:true")
+				}
+				return &gateway.ChatResponse{
+					ID:      "chatcmpl-2",
+					Created: 1700000000,
+					Model:   req.Model,
+					Choices: []gateway.Choice{{
+						Message: gateway.Message{
+							Role:      "assistant",
+							Content:   json.RawMessage(`"from secondary"`),
+							ToolCalls: json.RawMessage(`[{"id":"call_1","type":"function","function":{"name":"f","arguments":"{}"}}]`),
+						},
+						FinishReason: "tool_calls",
+					}},
+					Usage: &gateway.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5},
+				}, nil
+			},
+		})
+		store := testutil.NewFakeStore()
+		store.AddRoute(&gateway.Route{
+			ID:         "r-1",
+			ModelAlias: "model-a",
+			Targets:    []byte(`[{"provider_id":"primary","model":"model-a","priority":1},{"provider_id":"secondary","model":"model-a","priority":2}]`),
+			Strategy:   "priority",
+		})
+		usage := &capturingRecorder{}
+		routerSvc := app.NewRouterService(store)
+		return New(Deps{
+			Auth:            testutil.FakeAuth{},
+			Proxy:           app.NewProxyService(reg, routerSvc, nil, nil),
+			Usage:           usage,
+			StreamDowngrade: downgrade,
+		}), usage
+	}
+	post := func(h http.Handler) *httptest.ResponseRecorder {
+		body := `{"model":"model-a","messages":[{"role":"user","content":"hi"}],"stream":true,"stream_options":{"include_usage":true}}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer gnd_test")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		t.Parallel()
+		h, usage := newHandler(true)
+		rec := post(h)
+		assertSSEResponse(t, rec, "from secondary", "[DONE]")
+
+		var chunks []map[string]any
+		for _, line := range strings.Split(rec.Body.String(), "\n") {
+			data, ok := strings.CutPrefix(line, "data: ")
+			if !ok || data == "[DONE]" {
+				continue
+			}
+			var c map[string]any
+			if err := json.Unmarshal([]byte(data), &c); err != nil {
+				t.Fatalf("chunk %q: %v", data, err)
+			}
+			chunks = append(chunks, c)
+		}
+		if len(chunks) != 2 {
+			t.Fatalf("got %d chunks, want a choice chunk and a usage chunk:\n%s", len(chunks), rec.Body.String())
+		}
+		if chunks[0]["object"] != "chat.completion.chunk" {
+			t.Errorf("object = %v, want chat.completion.chunk", chunks[0]["object"])
+		}
+		choice := chunks[0]["choices"].([]any)[0].(map[string]any)
+		if choice["finish_reason"] != "tool_calls" {
+			t.Errorf("finish_reason = %v, want tool_calls", choice["finish_reason"])
+		}
+		call := choice["delta"].(map[string]any)["tool_calls"].([]any)[0].(map[string]any)
+		if call["index"] != float64(0) || call["id"] != "call_1" {
+			t.Errorf("tool call delta = %v, want index 0 and id call_1", call)
+		}
+		if u, ok := chunks[1]["usage"].(map[string]any); !ok || u["total_tokens"] != float64(5) {
+			t.Errorf("usage chunk = %v, want total_tokens 5", chunks[1])
+		}
+
+		usage.mu.Lock()
+		defer usage.mu.Unlock()
+		if len(usage.records) != 1 || usage.records[0].StatusCode != http.StatusOK || usage.records[0].TotalTokens != 5 {
+			t.Errorf("usage records = %+v, want one 200 record with 5 tokens", usage.records)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		h, _ := newHandler(false)
+		rec := post(h)
+		if rec.Code == http.StatusOK {
+			t.Fatalf("status = 200, want an upstream error; body = %s", rec.Body.String())
+		}
+	})
+}
+
+// TestOutputFilter verifies that completion text with a blocked term is
+// redacted or blocked per policy, and that streams are only scanned when
+// buffered.
+func TestOutputFilter(t *testing.T) {
+	t.Parallel()
+
+	fp := &testutil.FakeProvider{
+		ProviderName: "fake",
+		ChatFn: func(_ context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			return &gateway.ChatResponse{
+				ID:      "c1",
+				Model:   req.Model,
+				Choices: []gateway.Choice{{Message: gateway.Message{Role: "assistant", Content: json.RawMessage(`"Codename Falcon ships"`)}, FinishReason: "stop"}},
+			}, nil
+		},
+		StreamFn: func(context.Context, *gateway.ChatRequest) (<-chan gateway.StreamChunk, error) {
+			ch := make(chan gateway.StreamChunk, 4)
+			ch <- gateway.StreamChunk{Data: []byte(`{"id":"c1","choices":[{"index":0,"delta":{"role":"assistant","content":"Codename Fal"}}]}`)}
+			ch <- gateway.StreamChunk{Data: []byte(`{"id":"c1","choices":[{"index":0,"delta":{"content":"con ships"},"finish_reason":"stop"}]}`)}
+			ch <- gateway.StreamChunk{Done: true}
+			close(ch)
+			return ch, nil
+		},
+	}
+	newHandler := func(t *testing.T, action string, filterStreams bool) http.Handler {
+		t.Helper()
+		filter, err := app.NewOutputFilter(app.OutputFilterPolicy{Action: action, Terms: []string{"falcon"}})
+		if err != nil {
+			t.Fatalf("NewOutputFilter: %v", err)
+		}
+		reg := provider.NewRegistry()
+		reg.Register("fake", fp)
+		store := testutil.NewFakeStore()
+		store.AddRoute(&gateway.Route{
+			ID:         "r-1",
+			ModelAlias: "model-a",
+			Targets:    []byte(`[{"provider_id":"fake","model":"model-a","priority":1}]`),
+			Strategy:   "priority",
+		})
+		return New(Deps{
+			Auth:          testutil.FakeAuth{},
+			Proxy:         app.NewProxyService(reg, app.NewRouterService(store), nil, nil),
+			OutputFilter:  filter,
+			FilterStreams: filterStreams,
+		})
+	}
+	post := func(h http.Handler, stream bool) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"model":"model-a","messages":[{"role":"user","content":"hi"}],"stream":%v}`, stream)
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer gnd_test")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	choice := func(t *testing.T, rec *httptest.ResponseRecorder) gateway.Choice {
+		t.Helper()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+		}
+		var resp gateway.ChatResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Choices) != 1 {
+			t.Fatalf("decode %s: %v", rec.Body.String(), err)
+		}
+		return resp.Choices[0]
+	}
+
+	t.Run("redact", func(t *testing.T) {
+		t.Parallel()
+		c := choice(t, post(newHandler(t, app.OutputRedact, false), false))
+		if string(c.Message.Content) != `"Codename [REDACTED] ships"` || c.FinishReason != "stop" {
+			t.Errorf("content = %s, finish_reason = %q; want redacted text and stop", c.Message.Content, c.FinishReason)
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		t.Parallel()
+		c := choice(t, post(newHandler(t, app.OutputBlock, false), false))
+		if string(c.Message.Content) != `""` || c.FinishReason != provider.FinishContentFilter {
+			t.Errorf("content = %s, finish_reason = %q; want empty content and %s", c.Message.Content, c.FinishReason, provider.FinishContentFilter)
+		}
+	})
+
+	t.Run("buffered stream", func(t *testing.T) {
+		t.Parallel()
+		rec := post(newHandler(t, app.OutputRedact, true), true)
+		assertSSEResponse(t, rec, "Codename [REDACTED] ships", "[DONE]")
+		if strings.Contains(strings.ToLower(rec.Body.String()), "falcon") {
+			t.Errorf("blocked term leaked into the stream:\n%s", rec.Body.String())
+		}
+	})
+
+	t.Run("stream passes through", func(t *testing.T) {
+		t.Parallel()
+		rec := post(newHandler(t, app.OutputRedact, false), true)
+		assertSSEResponse(t, rec, "Codename Fal", "[DONE]")
+	})
+}
+
+// TestStreamConcurrencyLimit verifies that a key at its concurrent stream
+// limit gets 429 for the next stream, and that a disconnected client frees
+// its slot.
+func TestStreamConcurrencyLimit(t *testing.T) {
+	t.Parallel()
+
+	reg := provider.NewRegistry()
+	reg.Register("fake", &testutil.FakeProvider{
+		ProviderName: "fake",
+		// Streams stay open until the client goes away.
+		StreamFn: func(ctx context.Context, _ *gateway.ChatRequest) (<-chan gateway.StreamChunk, error) {
+			ch := make(chan gateway.StreamChunk)
+			go func() {
+				defer close(ch)
+				<-ctx.Done()
+			}()
+			return ch, nil
+		},
+	})
+	store := testutil.NewFakeStore()
+	store.AddRoute(&gateway.Route{
+		ID:         "r-1",
+		ModelAlias: "test-model",
+		Targets:    []byte(`[{"provider_id":"fake","model":"test-model","priority":1}]`),
+		Strategy:   "priority",
+	})
+	streams := ratelimit.NewStreamLimiter()
+	routerSvc := app.NewRouterService(store)
+	h := New(Deps{
+		Auth:              rateLimitAuth{maxStreams: 2},
+		Proxy:             app.NewProxyService(reg, routerSvc, nil, nil),
+		Streams:           streams,
+		DefaultMaxStreams: 100, // the per-key limit wins
+	})
+
+	type openStream struct {
+		cancel context.CancelFunc
+		rec    *httptest.ResponseRecorder
+		done   chan struct{}
+	}
+	open := func() openStream {
+		ctx, cancel := context.WithCancel(context.Background())
+		body := `{"model":"test-model","messages":[{"role":"user","content":"hi"}],"stream":true}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)).WithContext(ctx)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer gnd_test")
+		s := openStream{cancel: cancel, rec: httptest.NewRecorder(), done: make(chan struct{})}
+		go func() {
+			defer close(s.done)
+			h.ServeHTTP(s.rec, req)
+		}()
+		return s
+	}
+	waitOpen := func(n int64) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for streams.Open("key-rl-1") != n {
+			if time.Now().After(deadline) {
+				t.Fatalf("open streams = %d, want %d", streams.Open("key-rl-1"), n)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	first, second := open(), open()
+	waitOpen(2)
+
+	rejected := open()
+	<-rejected.done
+	if rejected.rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("third stream: status = %d, want 429; body = %s", rejected.rec.Code, rejected.rec.Body.String())
+	}
+
+	first.cancel()
+	<-first.done
+	waitOpen(1)
+
+	accepted := open()
+	waitOpen(2)
+	for _, s := range []openStream{second, accepted} {
+		s.cancel()
+		<-s.done
+	}
+	waitOpen(0)
+	if accepted.rec.Code != http.StatusOK {
+		t.Errorf("stream after a slot freed: status = %d, want 200", accepted.rec.Code)
+	}
+}
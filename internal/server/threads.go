@@ -0,0 +1,166 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+// threadCreateRequest is the body for POST /v1/threads. Messages seed the
+// thread (e.g. a system prompt); the body may be omitted entirely.
+type threadCreateRequest struct {
+	Messages []gateway.Message `json:"messages,omitempty"`
+}
+
+func (s *server) handleCreateThread(w http.ResponseWriter, r *http.Request) {
+	var req threadCreateRequest
+	if r.ContentLength != 0 && !decodeRequestBody(w, r, &req) {
+		return
+	}
+
+	t := &gateway.Thread{
+		ID:        uuid.Must(uuid.NewV7()).String(),
+		Messages:  req.Messages,
+		CreatedAt: time.Now().UTC(),
+	}
+	if identity := gateway.IdentityFromContext(r.Context()); identity != nil {
+		t.KeyID = identity.KeyID
+		t.OrgID = identity.OrgID
+	}
+	if t.Messages == nil {
+		t.Messages = []gateway.Message{}
+	}
+	if err := s.deps.Threads.CreateThread(r.Context(), t); err != nil {
+		slog.LogAttrs(r.Context(), slog.LevelError, "create thread failed",
+			slog.String("error", err.Error()),
+		)
+		writeJSON(w, http.StatusInternalServerError, errorResponse("failed to create thread"))
+		return
+	}
+	w.Header().Set("Location", "/v1/threads/"+t.ID)
+	writeJSON(w, http.StatusCreated, t)
+}
+
+// handleThreadMessage appends the request's messages to a thread and returns
+// a completion over the full history. The body is a chat completion request
+// whose messages are only the new turn; stored history is prepended before
+// token estimation, so TPM limits see the real prompt size. Streaming is not
+// supported because the reply must be stored before responding.
+func (s *server) handleThreadMessage(w http.ResponseWriter, r *http.Request) {
+	var req gateway.ChatRequest
+	if !decodeRequestBody(w, r, &req) {
+		return
+	}
+	if len(req.Messages) == 0 {
+		writeJSON(w, http.StatusBadRequest, errorResponse("messages is required"))
+		return
+	}
+	if req.Stream {
+		writeJSON(w, http.StatusBadRequest, errorResponse("streaming is not supported for threads"))
+		return
+	}
+
+	identity := gateway.IdentityFromContext(r.Context())
+	thread, ok := s.loadThread(w, r, identity, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+
+	if !defaultModel(w, identity, &req.Model) {
+		return
+	}
+	if identity != nil && !identity.IsModelAllowed(req.Model) {
+		writeJSON(w, http.StatusForbidden, errorResponse("model not allowed"))
+		return
+	}
+	if s.modelBlocked(r.Context(), req.Model) {
+		writeJSON(w, http.StatusForbidden, errorResponse("model not allowed"))
+		return
+	}
+	if !s.requireUser(w, identity, req.User) {
+		return
+	}
+	if name := s.deniedTool(r.Context(), identity, req.Model, toolNames(gjson.GetBytes(req.Tools, "#.function.name"))); name != "" {
+		writeJSON(w, http.StatusForbidden, errorResponse("tool not allowed: "+name))
+		return
+	}
+	if !s.checkTokenBudget(w, r, identity, req.Model) {
+		return
+	}
+	if !requireCapabilities(w, r) {
+		return
+	}
+	if !s.betaFeatures(w, r) {
+		return
+	}
+	meta := requestUsageMeta(r, req.User)
+	s.applyRouteDefaults(r.Context(), &req)
+
+	turn := req.Messages
+	history := make([]gateway.Message, 0, len(thread.Messages)+len(turn))
+	history = append(history, thread.Messages...)
+	req.Messages = append(history, turn...)
+
+	estimated := s.estimateTokens(req.Model, req.Messages)
+	if !s.consumeTPM(w, r, identity, req.Model, estimated) {
+		return
+	}
+
+	start := time.Now()
+	resp, err := s.deps.Proxy.ChatCompletion(r.Context(), &req)
+	elapsed := time.Since(start)
+	if err != nil {
+		writeUpstreamError(w, r.Context(), err)
+		return
+	}
+	s.adjustTPM(identity, estimated, resp.Usage)
+	s.recordUsage(r, identity, meta, req.Model, resp.Usage, elapsed, http.StatusOK, false)
+	s.filterOutput(r.Context(), resp)
+
+	if len(resp.Choices) > 0 {
+		turn = append(turn, resp.Choices[0].Message)
+	}
+	if err := s.deps.Threads.AppendThreadMessages(r.Context(), thread.ID, turn); err != nil {
+		// The completion was already paid for; return it and log the gap.
+		slog.LogAttrs(r.Context(), slog.LevelError, "append thread messages failed",
+			slog.String("thread_id", thread.ID),
+			slog.String("error", err.Error()),
+		)
+	}
+	s.setResponseMeta(r.Context(), resp)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// loadThread fetches a thread owned by the caller. Threads belonging to other
+// keys or orgs are reported as not found so IDs can't be probed.
+func (s *server) loadThread(w http.ResponseWriter, r *http.Request, identity *gateway.Identity, id string) (*gateway.Thread, bool) {
+	thread, err := s.deps.Threads.GetThread(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, gateway.ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, errorResponse("thread not found"))
+			return nil, false
+		}
+		slog.LogAttrs(r.Context(), slog.LevelError, "get thread failed",
+			slog.String("thread_id", id),
+			slog.String("error", err.Error()),
+		)
+		writeJSON(w, http.StatusInternalServerError, errorResponse("failed to load thread"))
+		return nil, false
+	}
+	var keyID, orgID string
+	if identity != nil {
+		keyID, orgID = identity.KeyID, identity.OrgID
+	}
+	if thread.KeyID != keyID || thread.OrgID != orgID {
+		writeJSON(w, http.StatusNotFound, errorResponse("thread not found"))
+		return nil, false
+	}
+	return thread, true
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	gateway "github.com/eugener/gandalf/internal"
+	"github.com/eugener/gandalf/internal/app"
+	"github.com/eugener/gandalf/internal/provider"
+	"github.com/eugener/gandalf/internal/testutil"
+)
+
+// threadTestHandler wires a capturing provider and an in-memory thread store.
+func threadTestHandler(t *testing.T, auth gateway.Authenticator, counter TokenCounter) (http.Handler, func() [][]gateway.Message) {
+	t.Helper()
+	var mu sync.Mutex
+	var seen [][]gateway.Message
+	fp := &testutil.FakeProvider{
+		ProviderName: "fake",
+		ChatFn: func(_ context.Context, req *gateway.ChatRequest) (*gateway.ChatResponse, error) {
+			mu.Lock()
+			seen = append(seen, append([]gateway.Message(nil), req.Messages...))
+			n := len(seen)
+			mu.Unlock()
+			return &gateway.ChatResponse{
+				ID:    "chatcmpl-thread",
+				Model: "gpt-4o",
+				Choices: []gateway.Choice{{
+					Message:      gateway.Message{Role: "assistant", Content: json.RawMessage(`"reply ` + string(rune('0'+n)) + `"`)},
+					FinishReason: "stop",
+				}},
+			}, nil
+		},
+	}
+	reg := provider.NewRegistry()
+	reg.Register("fake", fp)
+	routerSvc := app.NewRouterService(&fakeRouteStore{})
+	h := New(Deps{
+		Auth:         auth,
+		Proxy:        app.NewProxyService(reg, routerSvc, nil, nil),
+		Providers:    reg,
+		Router:       routerSvc,
+		TokenCounter: counter,
+		Threads:      testutil.NewFakeStore(),
+	})
+	return h, func() [][]gateway.Message {
+		mu.Lock()
+		defer mu.Unlock()
+		return seen
+	}
+}
+
+func threadRequest(h http.Handler, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer gnd_test")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func createThread(t *testing.T, h http.Handler, body string) string {
+	t.Helper()
+	rec := threadRequest(h, "/v1/threads", body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, want 201; body = %s", rec.Code, rec.Body.String())
+	}
+	var th gateway.Thread
+	if err := json.Unmarshal(rec.Body.Bytes(), &th); err != nil {
+		t.Fatal(err)
+	}
+	if th.ID == "" {
+		t.Fatal("create: empty thread id")
+	}
+	return th.ID
+}
+
+func TestThreads_HistoryIncluded(t *testing.T) {
+	t.Parallel()
+	h, seen := threadTestHandler(t, fakeAuth{}, nil)
+
+	id := createThread(t, h, `{"messages":[{"role":"system","content":"be brief"}]}`)
+	path := "/v1/threads/" + id + "/messages"
+
+	for i, msg := range []string{"first", "second"} {
+		rec := threadRequest(h, path, `{"model":"gpt-4o","messages":[{"role":"user","content":"`+msg+`"}]}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("turn %d: status = %d, want 200; body = %s", i, rec.Code, rec.Body.String())
+		}
+	}
+
+	reqs := seen()
+	if len(reqs) != 2 {
+		t.Fatalf("provider called %d times, want 2", len(reqs))
+	}
+	if len(reqs[0]) != 2 {
+		t.Errorf("turn 1 messages = %d, want 2 (system + user)", len(reqs[0]))
+	}
+	want := []struct{ role, content string }{
+		{"system", `"be brief"`},
+		{"user", `"first"`},
+		{"assistant", `"reply 1"`},
+		{"user", `"second"`},
+	}
+	if len(reqs[1]) != len(want) {
+		t.Fatalf("turn 2 messages = %d, want %d", len(reqs[1]), len(want))
+	}
+	for i, w := range want {
+		m := reqs[1][i]
+		if m.Role != w.role || string(m.Content) != w.content {
+			t.Errorf("turn 2 messages[%d] = %s %s, want %s %s", i, m.Role, m.Content, w.role, w.content)
+		}
+	}
+}
+
+// recordingCounter records the message count of each estimate.
+type recordingCounter struct {
+	mu    sync.Mutex
+	sizes []int
+}
+
+func (c *recordingCounter) EstimateRequest(_ string, msgs []gateway.Message) int {
+	c.mu.Lock()
+	c.sizes = append(c.sizes, len(msgs))
+	c.mu.Unlock()
+	return 10
+}
+
+func (c *recordingCounter) CountText(string, string) int { return 1 }
+
+func TestThreads_TokenEstimateIncludesHistory(t *testing.T) {
+	t.Parallel()
+	counter := &recordingCounter{}
+	h, _ := threadTestHandler(t, fakeAuth{}, counter)
+
+	id := createThread(t, h, `{"messages":[{"role":"system","content":"be brief"},{"role":"user","content":"earlier"}]}`)
+	rec := threadRequest(h, "/v1/threads/"+id+"/messages", `{"model":"gpt-4o","messages":[{"role":"user","content":"now"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body = %s", rec.Code, rec.Body.String())
+	}
+
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	if len(counter.sizes) != 1 || counter.sizes[0] != 3 {
+		t.Errorf("estimated message counts = %v, want [3]", counter.sizes)
+	}
+}
+
+func TestThreads_NotFound(t *testing.T) {
+	t.Parallel()
+	h, seen := threadTestHandler(t, fakeAuth{}, nil)
+
+	rec := threadRequest(h, "/v1/threads/nope/messages", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404; body = %s", rec.Code, rec.Body.String())
+	}
+	if n := len(seen()); n != 0 {
+		t.Errorf("provider called %d times, want 0", n)
+	}
+}
+
+func TestThreads_OtherKeyNotFound(t *testing.T) {
+	t.Parallel()
+	store := testutil.NewFakeStore()
+	_ = store.CreateThread(context.Background(), &gateway.Thread{ID: "t-other", KeyID: "key-other", OrgID: "default"})
+	h := newTestHandlerWith(func(d *Deps) { d.Threads = store })
+
+	rec := threadRequest(h, "/v1/threads/t-other/messages", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404; body = %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestThreads_DisabledWithoutStore(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler()
+
+	rec := threadRequest(h, "/v1/threads", `{}`)
+	if rec.Code != http.StatusNotFound && rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want 404 or 405", rec.Code)
+	}
+}
+
+func TestThreads_DeniedTool(t *testing.T) {
+	t.Parallel()
+	store := testutil.NewFakeStore()
+	_ = store.CreateThread(context.Background(), &gateway.Thread{ID: "t-1", KeyID: "key-test-1", OrgID: "default"})
+	h := newTestHandlerWith(func(d *Deps) {
+		d.Threads = store
+		d.OrgDeniedTools = map[string][]string{"default": {"shell_exec"}}
+	})
+
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],` +
+		`"tools":[{"type":"function","function":{"name":"shell_exec","parameters":{"type":"object"}}}]}`
+	rec := threadRequest(h, "/v1/threads/t-1/messages", body)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403; body = %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "tool not allowed: shell_exec") {
+		t.Errorf("body = %s, want tool not allowed: shell_exec", rec.Body.String())
+	}
+	if th, _ := store.GetThread(context.Background(), "t-1"); len(th.Messages) != 0 {
+		t.Errorf("thread messages = %d, want 0", len(th.Messages))
+	}
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Tool argument repair outcomes reported under x_gandalf.tool_arguments.
+const (
+	toolArgsRepaired = "repaired"
+	toolArgsInvalid  = "invalid"
+)
+
+// toolArgRepair records a streamed tool call whose accumulated arguments were
+// not valid JSON when the stream completed.
+type toolArgRepair struct {
+	Choice int    `json:"choice"`
+	Index  int    `json:"index"`
+	Status string `json:"status"`
+	suffix string // appended text that closes the JSON; empty when invalid
+}
+
+// repairToolArguments validates every aggregated tool call's arguments and
+// appends the closing suffix in place for those that can be repaired. It
+// returns one entry per call that was not valid JSON.
+func (a *streamAggregate) repairToolArguments() []toolArgRepair {
+	var out []toolArgRepair
+	for i, c := range a.choices {
+		for j, tc := range c.toolCalls {
+			args := tc.arguments.String()
+			if json.Valid([]byte(args)) {
+				continue
+			}
+			r := toolArgRepair{Choice: i, Index: j, Status: toolArgsInvalid}
+			if suffix, ok := jsonRepairSuffix(args); ok {
+				r.Status, r.suffix = toolArgsRepaired, suffix
+				tc.arguments.WriteString(suffix)
+			}
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// jsonRepairSuffix returns the text that, appended to s, makes it valid
+// JSON: a closing quote for an open string, a null value for a dangling key
+// or colon, and closers for open objects and arrays. Truncations that can't
+// be fixed by appending (a trailing comma, a partial literal or escape)
+// report false.
+func jsonRepairSuffix(s string) (string, bool) {
+	if strings.TrimSpace(s) == "" {
+		return "{}", true
+	}
+	var stack []byte
+	inString, escaped := false, false
+	for i := range len(s) {
+		c := s[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			stack = append(stack, '}')
+		case '[':
+			stack = append(stack, ']')
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+
+	var head strings.Builder
+	if inString {
+		if escaped {
+			head.WriteByte('\\')
+		}
+		head.WriteByte('"')
+	}
+	closers := make([]byte, len(stack))
+	for i, c := range stack {
+		closers[len(stack)-1-i] = c
+	}
+	for _, mid := range []string{"", "null", ":null"} {
+		suffix := head.String() + mid + string(closers)
+		if json.Valid([]byte(s + suffix)) {
+			return suffix, true
+		}
+	}
+	return "", false
+}
+
+// writeToolArgRepairs emits one extra chat.completion.chunk before [DONE]
+// carrying the repair suffixes as tool_calls argument deltas, so clients that
+// concatenate deltas end up with valid JSON. Every affected call is listed
+// under x_gandalf.tool_arguments; unrepairable ones get no delta and status
+// "invalid". Writes nothing when all arguments are valid.
+func writeToolArgRepairs(w http.ResponseWriter, agg *streamAggregate) {
+	repairs := agg.repairToolArguments()
+	if len(repairs) == 0 {
+		return
+	}
+
+	type toolCallDelta struct {
+		Index    int `json:"index"`
+		Function struct {
+			Arguments string `json:"arguments"`
+		} `json:"function"`
+	}
+	type choiceDelta struct {
+		Index int `json:"index"`
+		Delta struct {
+			ToolCalls []toolCallDelta `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	}
+	type toolArgsMeta struct {
+		ToolArguments []toolArgRepair `json:"tool_arguments"`
+	}
+	choices := []*choiceDelta{}
+	for _, r := range repairs {
+		if r.Status != toolArgsRepaired {
+			continue
+		}
+		if len(choices) == 0 || choices[len(choices)-1].Index != r.Choice {
+			choices = append(choices, &choiceDelta{Index: r.Choice})
+		}
+		tc := toolCallDelta{Index: r.Index}
+		tc.Function.Arguments = r.suffix
+		c := choices[len(choices)-1]
+		c.Delta.ToolCalls = append(c.Delta.ToolCalls, tc)
+	}
+
+	data, err := json.Marshal(struct {
+		ID      string         `json:"id"`
+		Object  string         `json:"object"`
+		Created int64          `json:"created"`
+		Model   string         `json:"model"`
+		Choices []*choiceDelta `json:"choices"`
+		Gandalf toolArgsMeta   `json:"x_gandalf"`
+	}{
+		ID:      agg.id,
+		Object:  "chat.completion.chunk",
+		Created: agg.created,
+		Model:   agg.model,
+		Choices: choices,
+		Gandalf: toolArgsMeta{ToolArguments: repairs},
+	})
+	if err != nil {
+		return
+	}
+	writeSSEData(w, data)
+}
@@ -8,26 +8,38 @@ import (
 	"fmt"
 	"time"
 
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
 	gateway "github.com/eugener/gandalf/internal"
 )
 
 // CreateKey inserts a new API key.
 func (s *Store) CreateKey(ctx context.Context, key *gateway.APIKey) error {
+	return insertKey(ctx, s.write, key)
+}
+
+func insertKey(ctx context.Context, db execer, key *gateway.APIKey) error {
 	models, err := marshalJSON(key.AllowedModels)
 	if err != nil {
 		return err
 	}
+	preferred, err := marshalJSON(key.PreferredProviders)
+	if err != nil {
+		return err
+	}
 	role := key.Role
 	if role == "" {
 		role = "member"
 	}
-	_, err = s.write.ExecContext(ctx,
+	_, err = db.ExecContext(ctx,
 		`INSERT INTO api_keys (id, key_hash, key_prefix, user_id, team_id, org_id, role,
-		 allowed_models, rpm_limit, tpm_limit, max_budget, expires_at, blocked, created_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		 allowed_models, rpm_limit, tpm_limit, max_budget, max_streams, default_model, max_requests, request_period, pool, preferred_providers, max_priority, expires_at, blocked, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		key.ID, key.KeyHash, key.KeyPrefix,
 		nullStr(key.UserID), nullStr(key.TeamID), key.OrgID, role,
-		models, key.RPMLimit, key.TPMLimit, key.MaxBudget,
+		models, key.RPMLimit, key.TPMLimit, key.MaxBudget, key.MaxStreams, nullStr(key.DefaultModel),
+		key.MaxRequests, nullStr(key.RequestPeriod), nullStr(key.Pool), preferred, nullStr(key.MaxPriority),
 		timeToStr(key.ExpiresAt), boolToInt(key.Blocked), key.CreatedAt.UTC().Format(time.RFC3339),
 	)
 	return err
@@ -37,7 +49,7 @@ func (s *Store) CreateKey(ctx context.Context, key *gateway.APIKey) error {
 func (s *Store) GetKeyByHash(ctx context.Context, hash string) (*gateway.APIKey, error) {
 	row := s.read.QueryRowContext(ctx,
 		`SELECT id, key_hash, key_prefix, user_id, team_id, org_id, role,
-		 allowed_models, rpm_limit, tpm_limit, max_budget, expires_at, blocked,
+		 allowed_models, rpm_limit, tpm_limit, max_budget, max_streams, default_model, max_requests, request_period, pool, preferred_providers, max_priority, expires_at, blocked,
 		 last_used_at, created_at
 		 FROM api_keys WHERE key_hash = ?`, hash,
 	)
@@ -46,9 +58,9 @@ func (s *Store) GetKeyByHash(ctx context.Context, hash string) (*gateway.APIKey,
 
 // ListKeys returns API keys for an organization.
 func (s *Store) ListKeys(ctx context.Context, orgID string, offset, limit int) ([]*gateway.APIKey, error) {
-	rows, err := s.read.QueryContext(ctx,
+	rows, err := s.bulk().QueryContext(ctx,
 		`SELECT id, key_hash, key_prefix, user_id, team_id, org_id, role,
-		 allowed_models, rpm_limit, tpm_limit, max_budget, expires_at, blocked,
+		 allowed_models, rpm_limit, tpm_limit, max_budget, max_streams, default_model, max_requests, request_period, pool, preferred_providers, max_priority, expires_at, blocked,
 		 last_used_at, created_at
 		 FROM api_keys WHERE org_id = ? ORDER BY created_at DESC LIMIT ? OFFSET ?`,
 		orgID, limit, offset,
@@ -75,14 +87,19 @@ func (s *Store) UpdateKey(ctx context.Context, key *gateway.APIKey) error {
 	if err != nil {
 		return err
 	}
+	preferred, err := marshalJSON(key.PreferredProviders)
+	if err != nil {
+		return err
+	}
 	role := key.Role
 	if role == "" {
 		role = "member"
 	}
 	result, err := s.write.ExecContext(ctx,
 		`UPDATE api_keys SET role=?, allowed_models=?, rpm_limit=?, tpm_limit=?, max_budget=?,
-		 expires_at=?, blocked=? WHERE id=?`,
-		role, models, key.RPMLimit, key.TPMLimit, key.MaxBudget,
+		 max_streams=?, default_model=?, max_requests=?, request_period=?, pool=?, preferred_providers=?, max_priority=?, expires_at=?, blocked=? WHERE id=?`,
+		role, models, key.RPMLimit, key.TPMLimit, key.MaxBudget, key.MaxStreams, nullStr(key.DefaultModel),
+		key.MaxRequests, nullStr(key.RequestPeriod), nullStr(key.Pool), preferred, nullStr(key.MaxPriority),
 		timeToStr(key.ExpiresAt), boolToInt(key.Blocked), key.ID,
 	)
 	if err != nil {
@@ -121,6 +138,26 @@ func (s *Store) ListBudgetedKeyIDs(ctx context.Context) (map[string]float64, err
 	return out, rows.Err()
 }
 
+// ListBudgetedKeyOrgs returns a map of key ID to org ID for keys with budgets > 0.
+func (s *Store) ListBudgetedKeyOrgs(ctx context.Context) (map[string]string, error) {
+	rows, err := s.read.QueryContext(ctx,
+		`SELECT id, org_id FROM api_keys WHERE max_budget > 0`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]string)
+	for rows.Next() {
+		var id, orgID string
+		if err := rows.Scan(&id, &orgID); err != nil {
+			return nil, err
+		}
+		out[id] = orgID
+	}
+	return out, rows.Err()
+}
+
 // TouchKeyUsed updates the last_used_at timestamp.
 func (s *Store) TouchKeyUsed(ctx context.Context, id string) error {
 	_, err := s.write.ExecContext(ctx,
@@ -135,6 +172,11 @@ type scanner interface {
 	Scan(dest ...any) error
 }
 
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
 // notFoundErr translates sql.ErrNoRows to gateway.ErrNotFound.
 func notFoundErr(err error) error {
 	if errors.Is(err, sql.ErrNoRows) {
@@ -147,17 +189,53 @@ func notFoundErr(err error) error {
 func (s *Store) GetKey(ctx context.Context, id string) (*gateway.APIKey, error) {
 	row := s.read.QueryRowContext(ctx,
 		`SELECT id, key_hash, key_prefix, user_id, team_id, org_id, role,
-		 allowed_models, rpm_limit, tpm_limit, max_budget, expires_at, blocked,
+		 allowed_models, rpm_limit, tpm_limit, max_budget, max_streams, default_model, max_requests, request_period, pool, preferred_providers, max_priority, expires_at, blocked,
 		 last_used_at, created_at
 		 FROM api_keys WHERE id = ?`, id,
 	)
 	return scanKey(row)
 }
 
+// ListPoolKeys returns the keys in an organization's key pool, oldest
+// first.
+func (s *Store) ListPoolKeys(ctx context.Context, orgID, pool string) ([]*gateway.APIKey, error) {
+	rows, err := s.read.QueryContext(ctx,
+		`SELECT id, key_hash, key_prefix, user_id, team_id, org_id, role,
+		 allowed_models, rpm_limit, tpm_limit, max_budget, max_streams, default_model, max_requests, request_period, pool, preferred_providers, max_priority, expires_at, blocked,
+		 last_used_at, created_at
+		 FROM api_keys WHERE org_id = ? AND pool = ? ORDER BY created_at, id`,
+		orgID, pool,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*gateway.APIKey
+	for rows.Next() {
+		k, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
 // CountKeys returns the total number of API keys for an organization.
+// It may read a replica; use CountKeysPrimary where a stale count matters.
 func (s *Store) CountKeys(ctx context.Context, orgID string) (int, error) {
+	return countKeys(ctx, s.bulk(), orgID)
+}
+
+// CountKeysPrimary is CountKeys read from the primary.
+func (s *Store) CountKeysPrimary(ctx context.Context, orgID string) (int, error) {
+	return countKeys(ctx, s.read, orgID)
+}
+
+func countKeys(ctx context.Context, db *sql.DB, orgID string) (int, error) {
 	var n int
-	err := s.read.QueryRowContext(ctx,
+	err := db.QueryRowContext(ctx,
 		`SELECT COUNT(*) FROM api_keys WHERE org_id = ?`, orgID,
 	).Scan(&n)
 	return n, err
@@ -165,15 +243,16 @@ func (s *Store) CountKeys(ctx context.Context, orgID string) (int, error) {
 
 func scanKey(s scanner) (*gateway.APIKey, error) {
 	var k gateway.APIKey
-	var modelsJSON sql.NullString
-	var userID, teamID sql.NullString
+	var modelsJSON, preferredJSON sql.NullString
+	var userID, teamID, defaultModel, requestPeriod, pool, maxPriority sql.NullString
 	var role sql.NullString
 	var expiresAt, lastUsedAt, createdAt sql.NullString
 	var blocked int
 
 	err := s.Scan(
 		&k.ID, &k.KeyHash, &k.KeyPrefix, &userID, &teamID, &k.OrgID, &role,
-		&modelsJSON, &k.RPMLimit, &k.TPMLimit, &k.MaxBudget,
+		&modelsJSON, &k.RPMLimit, &k.TPMLimit, &k.MaxBudget, &k.MaxStreams, &defaultModel,
+		&k.MaxRequests, &requestPeriod, &pool, &preferredJSON, &maxPriority,
 		&expiresAt, &blocked, &lastUsedAt, &createdAt,
 	)
 	if err != nil {
@@ -183,6 +262,10 @@ func scanKey(s scanner) (*gateway.APIKey, error) {
 	k.Blocked = blocked != 0
 	k.UserID = userID.String
 	k.TeamID = teamID.String
+	k.DefaultModel = defaultModel.String
+	k.RequestPeriod = requestPeriod.String
+	k.Pool = pool.String
+	k.MaxPriority = maxPriority.String
 	k.Role = role.String
 	if k.Role == "" {
 		k.Role = "member"
@@ -193,6 +276,9 @@ func scanKey(s scanner) (*gateway.APIKey, error) {
 		return nil, err
 	}
 	k.AllowedModels = models
+	if k.PreferredProviders, err = unmarshalStringSlice(preferredJSON); err != nil {
+		return nil, err
+	}
 	k.ExpiresAt = parseTime(expiresAt)
 	k.LastUsedAt = parseTime(lastUsedAt)
 	if t := parseTime(createdAt); t != nil {
@@ -261,6 +347,19 @@ func nullStr(s string) sql.NullString {
 	return sql.NullString{String: s, Valid: true}
 }
 
+// checkUnique maps a UNIQUE or PRIMARY KEY constraint violation to
+// gateway.ErrConflict and returns any other error unchanged.
+func checkUnique(err error, entity string) error {
+	var se *sqlite.Error
+	if errors.As(err, &se) {
+		switch se.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return fmt.Errorf("%s: %w", entity, gateway.ErrConflict)
+		}
+	}
+	return err
+}
+
 func checkRowsAffected(result sql.Result, entity string) error {
 	n, err := result.RowsAffected()
 	if err != nil {
@@ -0,0 +1,105 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+// InsertAudit stores one audit entry.
+func (s *Store) InsertAudit(ctx context.Context, e *gateway.AuditEntry) error {
+	_, err := s.write.ExecContext(ctx,
+		`INSERT INTO audit_log (id, actor_key_id, actor_subject, org_id, action, target_type, target_id, diff, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ID, nullStr(e.ActorKeyID), nullStr(e.ActorSubject), nullStr(e.OrgID), e.Action, e.TargetType,
+		nullStr(e.TargetID), nullStr(string(e.Diff)), e.CreatedAt.UTC().Format(time.RFC3339),
+	)
+	return err
+}
+
+// QueryAudit returns audit entries matching the filter, newest first.
+func (s *Store) QueryAudit(ctx context.Context, f gateway.AuditFilter) ([]gateway.AuditEntry, error) {
+	where, args := auditWhere(f)
+	limit := f.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	args = append(args, limit, f.Offset)
+
+	rows, err := s.read.QueryContext(ctx,
+		`SELECT id, actor_key_id, actor_subject, org_id, action, target_type, target_id, diff, created_at
+		 FROM audit_log`+where+` ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []gateway.AuditEntry
+	for rows.Next() {
+		var e gateway.AuditEntry
+		var actorKeyID, actorSubject, orgID, targetID, diff sql.NullString
+		var createdAt string
+		if err := rows.Scan(&e.ID, &actorKeyID, &actorSubject, &orgID, &e.Action, &e.TargetType,
+			&targetID, &diff, &createdAt); err != nil {
+			return nil, err
+		}
+		e.ActorKeyID = actorKeyID.String
+		e.ActorSubject = actorSubject.String
+		e.OrgID = orgID.String
+		e.TargetID = targetID.String
+		if diff.Valid {
+			e.Diff = []byte(diff.String)
+		}
+		if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
+			e.CreatedAt = t
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// CountAudit returns the number of audit entries matching the filter.
+func (s *Store) CountAudit(ctx context.Context, f gateway.AuditFilter) (int, error) {
+	where, args := auditWhere(f)
+	var n int
+	err := s.read.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM audit_log`+where, args...,
+	).Scan(&n)
+	return n, err
+}
+
+func auditWhere(f gateway.AuditFilter) (string, []any) {
+	var clauses []string
+	var args []any
+	if f.OrgID != "" {
+		clauses = append(clauses, "org_id = ?")
+		args = append(args, f.OrgID)
+	}
+	if f.ActorKeyID != "" {
+		clauses = append(clauses, "actor_key_id = ?")
+		args = append(args, f.ActorKeyID)
+	}
+	if f.TargetType != "" {
+		clauses = append(clauses, "target_type = ?")
+		args = append(args, f.TargetType)
+	}
+	if f.TargetID != "" {
+		clauses = append(clauses, "target_id = ?")
+		args = append(args, f.TargetID)
+	}
+	if f.Since != "" {
+		clauses = append(clauses, "created_at >= ?")
+		args = append(args, f.Since)
+	}
+	if f.Until != "" {
+		clauses = append(clauses, "created_at < ?")
+		args = append(args, f.Until)
+	}
+	if len(clauses) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), args
+}
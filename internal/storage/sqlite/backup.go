@@ -0,0 +1,118 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+// ExportBackup reads all providers, routes, orgs, teams, and keys in one
+// read transaction so the snapshot is consistent.
+func (s *Store) ExportBackup(ctx context.Context) (*gateway.Backup, error) {
+	tx, err := s.read.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var b gateway.Backup
+	if b.Providers, err = queryAll(ctx, tx, scanProvider,
+		`SELECT id, name, type, base_url, api_key_enc, models, priority, weight, enabled, max_rps, timeout_ms
+		 FROM providers ORDER BY id`); err != nil {
+		return nil, err
+	}
+	if b.Routes, err = queryAll(ctx, tx, scanRoute,
+		`SELECT id, model_alias, targets, strategy, cache_ttl_s, default_temperature, embedding_dimensions, denied_tools, cache_stop_only,
+		 response_schema, schema_policy
+		 FROM routes ORDER BY id`); err != nil {
+		return nil, err
+	}
+	if b.Orgs, err = queryAll(ctx, tx, scanOrg,
+		`SELECT id, name, allowed_models, rpm_limit, tpm_limit, max_budget, created_at
+		 FROM organizations ORDER BY id`); err != nil {
+		return nil, err
+	}
+	if b.Teams, err = queryAll(ctx, tx, scanTeam,
+		`SELECT id, org_id, name, allowed_models, rpm_limit, tpm_limit, max_budget
+		 FROM teams ORDER BY id`); err != nil {
+		return nil, err
+	}
+	keys, err := queryAll(ctx, tx, scanKey,
+		`SELECT id, key_hash, key_prefix, user_id, team_id, org_id, role,
+		 allowed_models, rpm_limit, tpm_limit, max_budget, max_streams, default_model, max_requests, request_period, pool, preferred_providers, max_priority, expires_at, blocked,
+		 last_used_at, created_at
+		 FROM api_keys ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	b.Keys = make([]*gateway.BackupKey, len(keys))
+	for i, k := range keys {
+		b.Keys[i] = &gateway.BackupKey{APIKey: *k, KeyHash: k.KeyHash}
+	}
+	return &b, nil
+}
+
+// RestoreBackup deletes all providers, routes, orgs, teams, and keys and
+// inserts those in b. Any failure (e.g. a key referencing a missing org)
+// rolls back the whole restore. Usage history is left untouched.
+func (s *Store) RestoreBackup(ctx context.Context, b *gateway.Backup) error {
+	tx, err := s.write.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"api_keys", "teams", "organizations", "routes", "providers"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table); err != nil {
+			return err
+		}
+	}
+	for _, o := range b.Orgs {
+		if err := insertOrg(ctx, tx, o); err != nil {
+			return err
+		}
+	}
+	for _, t := range b.Teams {
+		if err := insertTeam(ctx, tx, t); err != nil {
+			return err
+		}
+	}
+	for _, p := range b.Providers {
+		if err := insertProvider(ctx, tx, p); err != nil {
+			return err
+		}
+	}
+	for _, r := range b.Routes {
+		if err := insertRoute(ctx, tx, r); err != nil {
+			return err
+		}
+	}
+	for _, k := range b.Keys {
+		key := k.APIKey
+		key.KeyHash = k.KeyHash
+		if err := insertKey(ctx, tx, &key); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// queryAll runs query on tx and scans every row with scan.
+func queryAll[T any](ctx context.Context, tx *sql.Tx, scan func(scanner) (*T, error), query string) ([]*T, error) {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*T
+	for rows.Next() {
+		v, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io/fs"
 	"runtime"
+	"sync/atomic"
 
 	"github.com/pressly/goose/v3"
 	_ "modernc.org/sqlite"
@@ -21,10 +22,23 @@ var migrations embed.FS
 type Store struct {
 	write *sql.DB // single-writer connection
 	read  *sql.DB // multi-reader pool
+
+	replicas []*sql.DB     // read-only replica pools; nil = bulk reads use read
+	next     atomic.Uint64 // round-robin cursor over replicas
 }
 
 // New opens a SQLite database, runs migrations, and returns a Store.
 func New(dsn string) (*Store, error) {
+	return NewWithReplicas(dsn, nil)
+}
+
+// NewWithReplicas opens a SQLite database like New, plus read-only replicas
+// of it (e.g. files kept current by litestream). Bulk reads -- usage
+// queries, rollups, key listings -- are spread round-robin across the
+// replicas and may lag the primary by the replication delay. Writes and
+// all other reads, including auth lookups, go to the primary. Replicas are
+// never migrated; they must already carry the primary's schema.
+func NewWithReplicas(dsn string, replicaDSNs []string) (*Store, error) {
 	pragmas := "_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=synchronous(NORMAL)&_pragma=foreign_keys(1)"
 
 	// For :memory: databases, use shared cache so read/write pools share the same data
@@ -54,7 +68,31 @@ func New(dsn string) (*Store, error) {
 		return nil, fmt.Errorf("migrations: %w", err)
 	}
 
-	return &Store{write: write, read: read}, nil
+	s := &Store{write: write, read: read}
+	for _, replica := range replicaDSNs {
+		db, err := sql.Open("sqlite", "file:"+replica+"?mode=ro&_pragma=busy_timeout(5000)&_pragma=query_only(1)")
+		if err == nil {
+			if err = db.Ping(); err != nil {
+				db.Close()
+			}
+		}
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("open read replica %q: %w", replica, err)
+		}
+		db.SetMaxOpenConns(max(4, runtime.NumCPU()))
+		s.replicas = append(s.replicas, db)
+	}
+	return s, nil
+}
+
+// bulk returns the pool for a bulk read: the next replica, or the primary
+// read pool when there are none.
+func (s *Store) bulk() *sql.DB {
+	if len(s.replicas) == 0 {
+		return s.read
+	}
+	return s.replicas[(s.next.Add(1)-1)%uint64(len(s.replicas))]
 }
 
 // runMigrations applies embedded SQL migrations using goose.
@@ -77,7 +115,11 @@ func (s *Store) Ping(ctx context.Context) error {
 	return s.read.PingContext(ctx)
 }
 
-// Close closes both database connections.
+// Close closes the primary connections and any replicas.
 func (s *Store) Close() error {
-	return errors.Join(s.write.Close(), s.read.Close())
+	errs := []error{s.write.Close(), s.read.Close()}
+	for _, db := range s.replicas {
+		errs = append(errs, db.Close())
+	}
+	return errors.Join(errs...)
 }
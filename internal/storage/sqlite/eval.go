@@ -0,0 +1,100 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+// SaveEvalCaptures inserts a capture group in one transaction.
+func (s *Store) SaveEvalCaptures(ctx context.Context, captures []gateway.EvalCapture) error {
+	tx, err := s.write.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := range captures {
+		c := &captures[i]
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO eval_captures (id, group_id, request_id, org_id, label, provider_id, model, request, response, error, latency_ms, created_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			c.ID, c.GroupID, nullStr(c.RequestID), nullStr(c.OrgID), c.Label, c.ProviderID, c.Model,
+			string(c.Request), nullStr(string(c.Response)), nullStr(c.Error), c.LatencyMs,
+			c.CreatedAt.UTC().Format(time.RFC3339),
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListEvalCaptures returns matching captures, oldest first. A zero Limit
+// returns every match.
+func (s *Store) ListEvalCaptures(ctx context.Context, f gateway.EvalCaptureFilter) ([]gateway.EvalCapture, error) {
+	var clauses []string
+	var args []any
+	if f.OrgID != "" {
+		clauses = append(clauses, "org_id = ?")
+		args = append(args, f.OrgID)
+	}
+	if f.Label != "" {
+		clauses = append(clauses, "label = ?")
+		args = append(args, f.Label)
+	}
+	if f.Model != "" {
+		clauses = append(clauses, "model = ?")
+		args = append(args, f.Model)
+	}
+	if f.Since != "" {
+		clauses = append(clauses, "created_at >= ?")
+		args = append(args, f.Since)
+	}
+	if f.Until != "" {
+		clauses = append(clauses, "created_at < ?")
+		args = append(args, f.Until)
+	}
+	where := ""
+	if len(clauses) > 0 {
+		where = " WHERE " + strings.Join(clauses, " AND ")
+	}
+	limit := f.Limit
+	if limit <= 0 {
+		limit = -1 // SQLite: no limit
+	}
+	args = append(args, limit)
+
+	rows, err := s.read.QueryContext(ctx,
+		`SELECT id, group_id, request_id, org_id, label, provider_id, model, request, response, error, latency_ms, created_at
+		 FROM eval_captures`+where+` ORDER BY created_at, id LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []gateway.EvalCapture
+	for rows.Next() {
+		var c gateway.EvalCapture
+		var requestID, orgID, response, errMsg sql.NullString
+		var request, createdAt string
+		if err := rows.Scan(&c.ID, &c.GroupID, &requestID, &orgID, &c.Label, &c.ProviderID, &c.Model,
+			&request, &response, &errMsg, &c.LatencyMs, &createdAt); err != nil {
+			return nil, err
+		}
+		c.RequestID = requestID.String
+		c.OrgID = orgID.String
+		c.Request = []byte(request)
+		if response.Valid {
+			c.Response = []byte(response.String)
+		}
+		c.Error = errMsg.String
+		if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
+			c.CreatedAt = t
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
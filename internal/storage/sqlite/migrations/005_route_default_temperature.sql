@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE routes ADD COLUMN default_temperature REAL;
+
+-- +goose Down
+ALTER TABLE routes DROP COLUMN default_temperature;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE usage_records ADD COLUMN end_user TEXT;
+ALTER TABLE usage_records ADD COLUMN tags TEXT;
+
+-- +goose Down
+ALTER TABLE usage_records DROP COLUMN tags;
+ALTER TABLE usage_records DROP COLUMN end_user;
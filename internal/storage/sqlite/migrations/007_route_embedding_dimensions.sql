@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE routes ADD COLUMN embedding_dimensions INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE routes DROP COLUMN embedding_dimensions;
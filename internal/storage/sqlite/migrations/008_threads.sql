@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS threads (
+    id         TEXT PRIMARY KEY,
+    key_id     TEXT,
+    org_id     TEXT NOT NULL,
+    created_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+-- Messages are rows rather than a JSON array on threads so appends are a
+-- plain INSERT; seq (rowid) preserves order.
+CREATE TABLE IF NOT EXISTS thread_messages (
+    seq       INTEGER PRIMARY KEY AUTOINCREMENT,
+    thread_id TEXT NOT NULL REFERENCES threads(id) ON DELETE CASCADE,
+    message   TEXT NOT NULL -- JSON-encoded Message
+);
+
+CREATE INDEX IF NOT EXISTS idx_thread_messages_thread ON thread_messages(thread_id, seq);
+
+-- +goose Down
+DROP TABLE IF EXISTS thread_messages;
+DROP TABLE IF EXISTS threads;
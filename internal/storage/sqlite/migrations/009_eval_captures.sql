@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS eval_captures (
+    id          TEXT PRIMARY KEY,
+    group_id    TEXT NOT NULL, -- shared by the primary and its shadow responses
+    request_id  TEXT,
+    label       TEXT NOT NULL, -- primary | shadow
+    provider_id TEXT NOT NULL,
+    model       TEXT NOT NULL,
+    request     TEXT NOT NULL, -- JSON-encoded ChatRequest
+    response    TEXT,          -- JSON-encoded ChatResponse; NULL on error
+    error       TEXT,
+    latency_ms  INTEGER NOT NULL DEFAULT 0,
+    created_at  TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_eval_captures_group ON eval_captures(group_id);
+CREATE INDEX IF NOT EXISTS idx_eval_captures_created ON eval_captures(created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS eval_captures;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE routes ADD COLUMN denied_tools TEXT;
+
+-- +goose Down
+ALTER TABLE routes DROP COLUMN denied_tools;
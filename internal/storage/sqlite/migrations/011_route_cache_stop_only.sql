@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE routes ADD COLUMN cache_stop_only INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE routes DROP COLUMN cache_stop_only;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE usage_records ADD COLUMN ttfb_ms INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE usage_rollups ADD COLUMN stream_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE usage_rollups ADD COLUMN ttfb_ms_sum INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE usage_rollups DROP COLUMN ttfb_ms_sum;
+ALTER TABLE usage_rollups DROP COLUMN stream_count;
+ALTER TABLE usage_records DROP COLUMN ttfb_ms;
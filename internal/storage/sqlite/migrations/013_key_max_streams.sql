@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE api_keys ADD COLUMN max_streams INTEGER;
+
+-- +goose Down
+ALTER TABLE api_keys DROP COLUMN max_streams;
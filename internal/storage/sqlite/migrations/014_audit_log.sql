@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS audit_log (
+    id            TEXT PRIMARY KEY,
+    actor_key_id  TEXT,
+    actor_subject TEXT,
+    action        TEXT NOT NULL, -- create | update | delete | migrate | restore
+    target_type   TEXT NOT NULL, -- provider | route | key | config
+    target_id     TEXT,
+    diff          TEXT,          -- JSON: {"field": {"old": ..., "new": ...}}
+    created_at    TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS audit_log;
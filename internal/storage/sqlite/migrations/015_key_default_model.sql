@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE api_keys ADD COLUMN default_model TEXT;
+
+-- +goose Down
+ALTER TABLE api_keys DROP COLUMN default_model;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE routes ADD COLUMN response_schema TEXT;
+ALTER TABLE routes ADD COLUMN schema_policy TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE routes DROP COLUMN schema_policy;
+ALTER TABLE routes DROP COLUMN response_schema;
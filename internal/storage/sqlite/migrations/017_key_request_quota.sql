@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE api_keys ADD COLUMN max_requests INTEGER;
+ALTER TABLE api_keys ADD COLUMN request_period TEXT;
+
+-- +goose Down
+ALTER TABLE api_keys DROP COLUMN request_period;
+ALTER TABLE api_keys DROP COLUMN max_requests;
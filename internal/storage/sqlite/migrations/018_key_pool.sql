@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE api_keys ADD COLUMN pool TEXT;
+CREATE INDEX idx_api_keys_pool ON api_keys(org_id, pool) WHERE pool IS NOT NULL;
+
+-- +goose Down
+DROP INDEX idx_api_keys_pool;
+ALTER TABLE api_keys DROP COLUMN pool;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE usage_records ADD COLUMN canceled INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE usage_records DROP COLUMN canceled;
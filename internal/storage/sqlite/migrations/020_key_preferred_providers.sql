@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE api_keys ADD COLUMN preferred_providers TEXT;
+
+-- +goose Down
+ALTER TABLE api_keys DROP COLUMN preferred_providers;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE audit_log ADD COLUMN org_id TEXT;
+-- Attribute existing entries to the acting key's org where it still exists.
+UPDATE audit_log SET org_id = (SELECT org_id FROM api_keys WHERE api_keys.id = audit_log.actor_key_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_org ON audit_log(org_id, created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_audit_log_org;
+ALTER TABLE audit_log DROP COLUMN org_id;
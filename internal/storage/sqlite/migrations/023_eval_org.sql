@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE eval_captures ADD COLUMN org_id TEXT;
+-- Attribute existing captures to the org of the request they came from;
+-- captures without a matching usage record stay unattributed.
+UPDATE eval_captures SET org_id = u.org_id
+FROM usage_records u
+WHERE u.request_id = eval_captures.request_id;
+CREATE INDEX IF NOT EXISTS idx_eval_captures_org ON eval_captures(org_id, created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_eval_captures_org;
+ALTER TABLE eval_captures DROP COLUMN org_id;
@@ -10,17 +10,21 @@ import (
 
 // CreateOrg inserts a new organization.
 func (s *Store) CreateOrg(ctx context.Context, org *gateway.Organization) error {
+	return insertOrg(ctx, s.write, org)
+}
+
+func insertOrg(ctx context.Context, db execer, org *gateway.Organization) error {
 	models, err := marshalJSON(org.AllowedModels)
 	if err != nil {
 		return err
 	}
-	_, err = s.write.ExecContext(ctx,
+	_, err = db.ExecContext(ctx,
 		`INSERT INTO organizations (id, name, allowed_models, rpm_limit, tpm_limit, max_budget, created_at)
 		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
 		org.ID, org.Name, models, org.RPMLimit, org.TPMLimit, org.MaxBudget,
 		org.CreatedAt.UTC().Format(time.RFC3339),
 	)
-	return err
+	return checkUnique(err, "organization")
 }
 
 // GetOrg retrieves an organization by ID.
@@ -54,6 +58,13 @@ func (s *Store) ListOrgs(ctx context.Context, offset, limit int) ([]*gateway.Org
 	return orgs, rows.Err()
 }
 
+// CountOrgs returns the total number of organizations.
+func (s *Store) CountOrgs(ctx context.Context) (int, error) {
+	var n int
+	err := s.read.QueryRowContext(ctx, `SELECT COUNT(*) FROM organizations`).Scan(&n)
+	return n, err
+}
+
 // UpdateOrg updates an organization.
 func (s *Store) UpdateOrg(ctx context.Context, org *gateway.Organization) error {
 	models, err := marshalJSON(org.AllowedModels)
@@ -82,16 +93,20 @@ func (s *Store) DeleteOrg(ctx context.Context, id string) error {
 
 // CreateTeam inserts a new team.
 func (s *Store) CreateTeam(ctx context.Context, team *gateway.Team) error {
+	return insertTeam(ctx, s.write, team)
+}
+
+func insertTeam(ctx context.Context, db execer, team *gateway.Team) error {
 	models, err := marshalJSON(team.AllowedModels)
 	if err != nil {
 		return err
 	}
-	_, err = s.write.ExecContext(ctx,
+	_, err = db.ExecContext(ctx,
 		`INSERT INTO teams (id, org_id, name, allowed_models, rpm_limit, tpm_limit, max_budget)
 		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
 		team.ID, team.OrgID, team.Name, models, team.RPMLimit, team.TPMLimit, team.MaxBudget,
 	)
-	return err
+	return checkUnique(err, "team")
 }
 
 // GetTeam retrieves a team by ID.
@@ -125,6 +140,15 @@ func (s *Store) ListTeams(ctx context.Context, orgID string, offset, limit int)
 	return teams, rows.Err()
 }
 
+// CountTeams returns the total number of teams in an organization.
+func (s *Store) CountTeams(ctx context.Context, orgID string) (int, error) {
+	var n int
+	err := s.read.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM teams WHERE org_id = ?`, orgID,
+	).Scan(&n)
+	return n, err
+}
+
 // UpdateTeam updates a team.
 func (s *Store) UpdateTeam(ctx context.Context, team *gateway.Team) error {
 	models, err := marshalJSON(team.AllowedModels)
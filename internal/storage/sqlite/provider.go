@@ -9,11 +9,15 @@ import (
 
 // CreateProvider inserts a new provider configuration.
 func (s *Store) CreateProvider(ctx context.Context, p *gateway.ProviderConfig) error {
+	return insertProvider(ctx, s.write, p)
+}
+
+func insertProvider(ctx context.Context, db execer, p *gateway.ProviderConfig) error {
 	models, err := marshalJSON(p.Models)
 	if err != nil {
 		return err
 	}
-	_, err = s.write.ExecContext(ctx,
+	_, err = db.ExecContext(ctx,
 		`INSERT INTO providers (id, name, type, base_url, api_key_enc, models, priority, weight, enabled, max_rps, timeout_ms)
 		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		p.ID, p.Name, p.Type, p.BaseURL, p.APIKeyEnc, models,
@@ -2,24 +2,38 @@ package sqlite
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
 
 	gateway "github.com/eugener/gandalf/internal"
 )
 
 // CreateRoute inserts a new route.
 func (s *Store) CreateRoute(ctx context.Context, r *gateway.Route) error {
-	_, err := s.write.ExecContext(ctx,
-		`INSERT INTO routes (id, model_alias, targets, strategy, cache_ttl_s)
-		 VALUES (?, ?, ?, ?, ?)`,
-		r.ID, r.ModelAlias, string(r.Targets), r.Strategy, r.CacheTTLs,
+	return insertRoute(ctx, s.write, r)
+}
+
+func insertRoute(ctx context.Context, db execer, r *gateway.Route) error {
+	tools, err := marshalJSON(r.DeniedTools)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx,
+		`INSERT INTO routes (id, model_alias, targets, strategy, cache_ttl_s, default_temperature, embedding_dimensions, denied_tools, cache_stop_only,
+		 response_schema, schema_policy)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ID, r.ModelAlias, string(r.Targets), r.Strategy, r.CacheTTLs, r.DefaultTemperature, r.EmbeddingDimensions, tools,
+		boolToInt(r.CacheStopOnly), schemaColumn(r.ResponseSchema), r.SchemaPolicy,
 	)
-	return err
+	return checkUnique(err, "route")
 }
 
 // GetRoute retrieves a route by its ID.
 func (s *Store) GetRoute(ctx context.Context, id string) (*gateway.Route, error) {
 	row := s.read.QueryRowContext(ctx,
-		`SELECT id, model_alias, targets, strategy, cache_ttl_s
+		`SELECT id, model_alias, targets, strategy, cache_ttl_s, default_temperature, embedding_dimensions, denied_tools, cache_stop_only,
+		 response_schema, schema_policy
 		 FROM routes WHERE id=?`, id,
 	)
 	return scanRoute(row)
@@ -42,7 +56,8 @@ func (s *Store) CountProviders(ctx context.Context) (int, error) {
 // GetRouteByAlias retrieves a route by model alias.
 func (s *Store) GetRouteByAlias(ctx context.Context, alias string) (*gateway.Route, error) {
 	row := s.read.QueryRowContext(ctx,
-		`SELECT id, model_alias, targets, strategy, cache_ttl_s
+		`SELECT id, model_alias, targets, strategy, cache_ttl_s, default_temperature, embedding_dimensions, denied_tools, cache_stop_only,
+		 response_schema, schema_policy
 		 FROM routes WHERE model_alias=?`, alias,
 	)
 	return scanRoute(row)
@@ -51,7 +66,8 @@ func (s *Store) GetRouteByAlias(ctx context.Context, alias string) (*gateway.Rou
 // ListRoutes returns all routes.
 func (s *Store) ListRoutes(ctx context.Context) ([]*gateway.Route, error) {
 	rows, err := s.read.QueryContext(ctx,
-		`SELECT id, model_alias, targets, strategy, cache_ttl_s FROM routes ORDER BY model_alias`,
+		`SELECT id, model_alias, targets, strategy, cache_ttl_s, default_temperature, embedding_dimensions, denied_tools, cache_stop_only,
+		 response_schema, schema_policy FROM routes ORDER BY model_alias`,
 	)
 	if err != nil {
 		return nil, err
@@ -71,12 +87,18 @@ func (s *Store) ListRoutes(ctx context.Context) ([]*gateway.Route, error) {
 
 // UpdateRoute updates an existing route.
 func (s *Store) UpdateRoute(ctx context.Context, r *gateway.Route) error {
+	tools, err := marshalJSON(r.DeniedTools)
+	if err != nil {
+		return err
+	}
 	result, err := s.write.ExecContext(ctx,
-		`UPDATE routes SET model_alias=?, targets=?, strategy=?, cache_ttl_s=? WHERE id=?`,
-		r.ModelAlias, string(r.Targets), r.Strategy, r.CacheTTLs, r.ID,
+		`UPDATE routes SET model_alias=?, targets=?, strategy=?, cache_ttl_s=?, default_temperature=?,
+		 embedding_dimensions=?, denied_tools=?, cache_stop_only=?, response_schema=?, schema_policy=? WHERE id=?`,
+		r.ModelAlias, string(r.Targets), r.Strategy, r.CacheTTLs, r.DefaultTemperature,
+		r.EmbeddingDimensions, tools, boolToInt(r.CacheStopOnly), schemaColumn(r.ResponseSchema), r.SchemaPolicy, r.ID,
 	)
 	if err != nil {
-		return err
+		return checkUnique(err, "route")
 	}
 	return checkRowsAffected(result, "route")
 }
@@ -93,10 +115,65 @@ func (s *Store) DeleteRoute(ctx context.Context, id string) error {
 func scanRoute(s scanner) (*gateway.Route, error) {
 	var r gateway.Route
 	var targets string
-	err := s.Scan(&r.ID, &r.ModelAlias, &targets, &r.Strategy, &r.CacheTTLs)
+	var toolsJSON sql.NullString
+	var stopOnly int
+	var schema sql.NullString
+	err := s.Scan(&r.ID, &r.ModelAlias, &targets, &r.Strategy, &r.CacheTTLs, &r.DefaultTemperature, &r.EmbeddingDimensions, &toolsJSON, &stopOnly,
+		&schema, &r.SchemaPolicy)
 	if err != nil {
 		return nil, notFoundErr(err)
 	}
 	r.Targets = []byte(targets)
+	r.CacheStopOnly = stopOnly != 0
+	if schema.Valid {
+		r.ResponseSchema = json.RawMessage(schema.String)
+	}
+	if r.DeniedTools, err = unmarshalStringSlice(toolsJSON); err != nil {
+		return nil, err
+	}
 	return &r, nil
 }
+
+// schemaColumn stores a route's response schema, with an absent or JSON
+// null schema as SQL NULL.
+func schemaColumn(raw json.RawMessage) sql.NullString {
+	if len(raw) == 0 || string(raw) == "null" {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(raw), Valid: true}
+}
+
+// MigrateProviderRoutes repoints route targets from provider from to
+// provider to (see gateway.MigrateTargets). All routes are read and
+// rewritten in one transaction, so a failure leaves every route unchanged.
+func (s *Store) MigrateProviderRoutes(ctx context.Context, from, to string, keepFailover bool) ([]*gateway.Route, error) {
+	tx, err := s.write.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	routes, err := queryAll(ctx, tx, scanRoute,
+		`SELECT id, model_alias, targets, strategy, cache_ttl_s, default_temperature, embedding_dimensions, denied_tools, cache_stop_only,
+		 response_schema, schema_policy
+		 FROM routes ORDER BY model_alias`)
+	if err != nil {
+		return nil, err
+	}
+	var changed []*gateway.Route
+	for _, r := range routes {
+		targets, ok, err := gateway.MigrateTargets(r.Targets, from, to, keepFailover)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", r.ID, err)
+		}
+		if !ok {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE routes SET targets=? WHERE id=?`, string(targets), r.ID); err != nil {
+			return nil, err
+		}
+		r.Targets = targets
+		changed = append(changed, r)
+	}
+	return changed, tx.Commit()
+}
@@ -2,6 +2,11 @@ package sqlite
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -60,8 +65,22 @@ func TestAPIKeyRoundTrip(t *testing.T) {
 		t.Fatalf("list count = %d, want 1", len(keys))
 	}
 
+	if got.MaxStreams != nil {
+		t.Errorf("max_streams = %v, want nil", *got.MaxStreams)
+	}
+	if got.DefaultModel != "" {
+		t.Errorf("default_model = %q, want empty", got.DefaultModel)
+	}
+
 	// Update
+	maxStreams, maxRequests := int64(5), int64(1000)
 	key.Blocked = true
+	key.MaxStreams = &maxStreams
+	key.DefaultModel = "gpt-4o"
+	key.MaxRequests = &maxRequests
+	key.RequestPeriod = "monthly"
+	key.PreferredProviders = []string{"dedicated", "openai"}
+	key.MaxPriority = "high"
 	if err := s.UpdateKey(ctx, key); err != nil {
 		t.Fatal("update:", err)
 	}
@@ -69,6 +88,21 @@ func TestAPIKeyRoundTrip(t *testing.T) {
 	if !got.Blocked {
 		t.Error("blocked should be true after update")
 	}
+	if got.MaxStreams == nil || *got.MaxStreams != 5 {
+		t.Errorf("max_streams = %v, want 5", got.MaxStreams)
+	}
+	if got.DefaultModel != "gpt-4o" {
+		t.Errorf("default_model = %q, want gpt-4o", got.DefaultModel)
+	}
+	if got.MaxRequests == nil || *got.MaxRequests != 1000 || got.RequestPeriod != "monthly" {
+		t.Errorf("request quota = %v/%q, want 1000/monthly", got.MaxRequests, got.RequestPeriod)
+	}
+	if !slices.Equal(got.PreferredProviders, []string{"dedicated", "openai"}) {
+		t.Errorf("preferred_providers = %v, want [dedicated openai]", got.PreferredProviders)
+	}
+	if got.MaxPriority != "high" {
+		t.Errorf("max_priority = %q, want high", got.MaxPriority)
+	}
 
 	// TouchUsed
 	if err := s.TouchKeyUsed(ctx, "key-1"); err != nil {
@@ -89,6 +123,63 @@ func TestAPIKeyRoundTrip(t *testing.T) {
 	}
 }
 
+func TestListPoolKeys(t *testing.T) {
+	t.Parallel()
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := s.CreateOrg(ctx, &gateway.Organization{ID: "other", Name: "Other", CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	for i, k := range []struct{ id, org, pool string }{
+		{"key-a", "default", "batch"},
+		{"key-b", "default", "batch"},
+		{"key-c", "default", ""},
+		{"key-d", "other", "batch"},
+	} {
+		key := &gateway.APIKey{
+			ID:        k.id,
+			KeyHash:   "hash-" + k.id,
+			KeyPrefix: "gnd_" + k.id,
+			OrgID:     k.org,
+			Pool:      k.pool,
+			CreatedAt: now.Add(time.Duration(i) * time.Second),
+		}
+		if err := s.CreateKey(ctx, key); err != nil {
+			t.Fatal("create:", err)
+		}
+	}
+
+	keys, err := s.ListPoolKeys(ctx, "default", "batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, k := range keys {
+		ids = append(ids, k.ID)
+		if k.Pool != "batch" {
+			t.Errorf("%s: pool = %q, want batch", k.ID, k.Pool)
+		}
+	}
+	if !slices.Equal(ids, []string{"key-a", "key-b"}) {
+		t.Errorf("pool keys = %v, want [key-a key-b]", ids)
+	}
+
+	// Leaving the pool.
+	keys[1].Pool = ""
+	if err := s.UpdateKey(ctx, keys[1]); err != nil {
+		t.Fatal("update:", err)
+	}
+	keys, err = s.ListPoolKeys(ctx, "default", "batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].ID != "key-a" {
+		t.Errorf("pool keys after update = %d, want only key-a", len(keys))
+	}
+}
+
 func TestProviderRoundTrip(t *testing.T) {
 	t.Parallel()
 	s := newTestStore(t)
@@ -141,11 +232,16 @@ func TestRouteRoundTrip(t *testing.T) {
 	ctx := context.Background()
 
 	r := &gateway.Route{
-		ID:         "route-1",
-		ModelAlias: "gpt-4o",
-		Targets:    []byte(`[{"provider_id":"prov-1","model":"gpt-4o","priority":1}]`),
-		Strategy:   "priority",
-		CacheTTLs:  0,
+		ID:          "route-1",
+		ModelAlias:  "gpt-4o",
+		Targets:     []byte(`[{"provider_id":"prov-1","model":"gpt-4o","priority":1}]`),
+		Strategy:    "priority",
+		CacheTTLs:   0,
+		DeniedTools: []string{"shell_exec"},
+
+		CacheStopOnly:  true,
+		ResponseSchema: []byte(`{"type":"object"}`),
+		SchemaPolicy:   gateway.SchemaRetry,
 	}
 
 	if err := s.CreateRoute(ctx, r); err != nil {
@@ -159,6 +255,15 @@ func TestRouteRoundTrip(t *testing.T) {
 	if got.Strategy != "priority" {
 		t.Errorf("strategy = %q, want %q", got.Strategy, "priority")
 	}
+	if len(got.DeniedTools) != 1 || got.DeniedTools[0] != "shell_exec" {
+		t.Errorf("denied_tools = %v, want [shell_exec]", got.DeniedTools)
+	}
+	if !got.CacheStopOnly {
+		t.Error("cache_stop_only should round-trip")
+	}
+	if string(got.ResponseSchema) != `{"type":"object"}` || got.SchemaPolicy != gateway.SchemaRetry {
+		t.Errorf("response_schema/schema_policy = %s/%q, want round-trip", got.ResponseSchema, got.SchemaPolicy)
+	}
 
 	routes, err := s.ListRoutes(ctx)
 	if err != nil {
@@ -195,6 +300,13 @@ func TestOrgAndTeamRoundTrip(t *testing.T) {
 	if got.Name != "Acme" {
 		t.Errorf("org name = %q, want %q", got.Name, "Acme")
 	}
+	// The migration seeds the default org.
+	if n, err := s.CountOrgs(ctx); err != nil || n != 2 {
+		t.Errorf("CountOrgs = %d, %v; want 2", n, err)
+	}
+	if err := s.CreateOrg(ctx, org); !errors.Is(err, gateway.ErrConflict) {
+		t.Errorf("duplicate org create: err = %v, want ErrConflict", err)
+	}
 
 	team := &gateway.Team{
 		ID:    "team-1",
@@ -212,6 +324,12 @@ func TestOrgAndTeamRoundTrip(t *testing.T) {
 	if len(teams) != 1 {
 		t.Fatalf("teams count = %d, want 1", len(teams))
 	}
+	if n, err := s.CountTeams(ctx, "org-1"); err != nil || n != 1 {
+		t.Errorf("CountTeams = %d, %v; want 1", n, err)
+	}
+	if err := s.CreateTeam(ctx, team); !errors.Is(err, gateway.ErrConflict) {
+		t.Errorf("duplicate team create: err = %v, want ErrConflict", err)
+	}
 
 	if err := s.DeleteTeam(ctx, "team-1"); err != nil {
 		t.Fatal("delete team:", err)
@@ -567,6 +685,41 @@ func TestUsageQueryAndCount(t *testing.T) {
 	}
 }
 
+func TestUsageMetadataRoundTrip(t *testing.T) {
+	t.Parallel()
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	records := []gateway.UsageRecord{
+		{ID: "um-1", KeyID: "k-meta", OrgID: "org1", Model: "gpt-4o", StatusCode: 200,
+			RequestID: "r1", EndUser: "user-7", Tags: []string{"team-a", "batch"},
+			LatencyMs: 900, TTFBMs: 120, Canceled: true, CreatedAt: time.Now().UTC()},
+	}
+	if err := s.InsertUsage(ctx, records); err != nil {
+		t.Fatal(err)
+	}
+
+	recs, err := s.QueryUsage(ctx, gateway.UsageFilter{KeyID: "k-meta"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 {
+		t.Fatalf("records = %d, want 1", len(recs))
+	}
+	if recs[0].EndUser != "user-7" {
+		t.Errorf("end_user = %q, want user-7", recs[0].EndUser)
+	}
+	if len(recs[0].Tags) != 2 || recs[0].Tags[0] != "team-a" || recs[0].Tags[1] != "batch" {
+		t.Errorf("tags = %v, want [team-a batch]", recs[0].Tags)
+	}
+	if recs[0].TTFBMs != 120 {
+		t.Errorf("ttfb_ms = %d, want 120", recs[0].TTFBMs)
+	}
+	if !recs[0].Canceled {
+		t.Error("canceled = false, want true")
+	}
+}
+
 func TestUsageSumCost(t *testing.T) {
 	t.Parallel()
 	s := newTestStore(t)
@@ -584,7 +737,7 @@ func TestUsageSumCost(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	total, err := s.SumUsageCost(ctx, "k-cost")
+	total, err := s.SumUsageCost(ctx, "k-cost", time.Time{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -592,6 +745,13 @@ func TestUsageSumCost(t *testing.T) {
 	if total < 0.14 || total > 0.16 {
 		t.Errorf("sum cost = %f, want ~0.15", total)
 	}
+
+	if n, err := s.CountRequests(ctx, "k-cost", time.Time{}); err != nil || n != 2 {
+		t.Errorf("CountRequests(all time) = %d, %v; want 2", n, err)
+	}
+	if n, err := s.CountRequests(ctx, "k-cost", time.Now().Add(time.Hour)); err != nil || n != 0 {
+		t.Errorf("CountRequests(future) = %d, %v; want 0", n, err)
+	}
 }
 
 func TestUsageRollupUpsert(t *testing.T) {
@@ -601,7 +761,8 @@ func TestUsageRollupUpsert(t *testing.T) {
 
 	rollups := []gateway.UsageRollup{
 		{OrgID: "org1", KeyID: "k1", Model: "gpt-4o", Period: "hourly",
-			Bucket: "2024-01-01T00:00:00Z", RequestCount: 10, TotalTokens: 100, CostUSD: 0.50},
+			Bucket: "2024-01-01T00:00:00Z", RequestCount: 10, TotalTokens: 100, CostUSD: 0.50,
+			StreamCount: 4, TTFBMsSum: 800},
 	}
 	if err := s.UpsertRollup(ctx, rollups); err != nil {
 		t.Fatal("first upsert:", err)
@@ -631,6 +792,9 @@ func TestUsageRollupUpsert(t *testing.T) {
 	if got[0].CostUSD < 0.24 || got[0].CostUSD > 0.26 {
 		t.Errorf("cost = %f, want ~0.25", got[0].CostUSD)
 	}
+	if got[0].StreamCount != 4 || got[0].TTFBMsSum != 800 {
+		t.Errorf("stream_count, ttfb_ms_sum = %d, %d, want 4, 800", got[0].StreamCount, got[0].TTFBMsSum)
+	}
 
 	// Query with filters that don't match.
 	got, err = s.QueryRollups(ctx, gateway.RollupFilter{OrgID: "nonexistent"})
@@ -650,6 +814,89 @@ func TestPing(t *testing.T) {
 	}
 }
 
+func TestReadReplicas(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// Each replica holds one key the primary lacks, so a result shows
+	// which database served it.
+	var replicas []string
+	for _, id := range []string{"replica-a", "replica-b"} {
+		path := dir + "/" + id + ".db"
+		r, err := New(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.CreateKey(ctx, &gateway.APIKey{ID: id, KeyHash: id, KeyPrefix: "gnd_", OrgID: "default", CreatedAt: time.Now().UTC()}); err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+		replicas = append(replicas, path)
+	}
+
+	s, err := NewWithReplicas(dir+"/primary.db", replicas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	if err := s.CreateKey(ctx, &gateway.APIKey{ID: "primary", KeyHash: "primary", KeyPrefix: "gnd_", OrgID: "default", CreatedAt: time.Now().UTC()}); err != nil {
+		t.Fatal("create:", err)
+	}
+
+	// Bulk reads alternate between the replicas and never see the write.
+	seen := map[string]int{}
+	for range 4 {
+		keys, err := s.ListKeys(ctx, "default", 0, 10)
+		if err != nil {
+			t.Fatal("list:", err)
+		}
+		if len(keys) != 1 {
+			t.Fatalf("list returned %d keys, want the replica's 1", len(keys))
+		}
+		seen[keys[0].ID]++
+	}
+	if seen["replica-a"] != 2 || seen["replica-b"] != 2 {
+		t.Errorf("reads per database = %v, want 2 on each replica", seen)
+	}
+
+	// Writes and point reads use the primary.
+	if _, err := s.GetKey(ctx, "primary"); err != nil {
+		t.Errorf("get from primary: %v", err)
+	}
+	if _, err := s.GetKeyByHash(ctx, "replica-a"); !errors.Is(err, gateway.ErrNotFound) {
+		t.Errorf("auth lookup of replica-only key: err = %v, want ErrNotFound", err)
+	}
+
+	// Primary variants of bulk reads see the write.
+	if n, err := s.CountKeysPrimary(ctx, "default"); err != nil || n != 1 {
+		t.Errorf("CountKeysPrimary = %d, %v; want 1", n, err)
+	}
+	if keys, _ := s.ListKeys(ctx, "default", 0, 10); len(keys) != 1 || keys[0].ID == "primary" {
+		t.Errorf("ListKeys = %v, want a replica's key", keys)
+	}
+	if err := s.InsertUsage(ctx, []gateway.UsageRecord{{ID: "u1", KeyID: "primary", OrgID: "default", CreatedAt: time.Now().UTC()}}); err != nil {
+		t.Fatal("insert usage:", err)
+	}
+	if recs, err := s.QueryUsage(ctx, gateway.UsageFilter{}); err != nil || len(recs) != 0 {
+		t.Errorf("QueryUsage = %d records, %v; want the replica's 0", len(recs), err)
+	}
+	if recs, err := s.QueryUsagePrimary(ctx, gateway.UsageFilter{}); err != nil || len(recs) != 1 {
+		t.Errorf("QueryUsagePrimary = %d records, %v; want 1", len(recs), err)
+	}
+	if err := s.UpsertRollup(ctx, []gateway.UsageRollup{{OrgID: "default", KeyID: "primary", Model: "m", Period: "hourly", Bucket: "2026-01-01T00:00:00Z"}}); err != nil {
+		t.Fatal("upsert rollup:", err)
+	}
+	if rollups, err := s.QueryRollupsPrimary(ctx, gateway.RollupFilter{}); err != nil || len(rollups) != 1 {
+		t.Errorf("QueryRollupsPrimary = %d rollups, %v; want 1", len(rollups), err)
+	}
+
+	if _, err := NewWithReplicas(dir+"/other.db", []string{dir + "/missing/replica.db"}); err == nil {
+		t.Error("missing replica: want error")
+	}
+}
+
 func TestRouteGetAndUpdate(t *testing.T) {
 	t.Parallel()
 	s := newTestStore(t)
@@ -702,6 +949,95 @@ func TestRouteGetAndUpdate(t *testing.T) {
 	}
 }
 
+func TestRouteDuplicateAlias(t *testing.T) {
+	t.Parallel()
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	for _, id := range []string{"route-1", "route-2"} {
+		r := &gateway.Route{ID: id, ModelAlias: id, Targets: []byte(`[]`), Strategy: "priority"}
+		if err := s.CreateRoute(ctx, r); err != nil {
+			t.Fatal("create:", err)
+		}
+	}
+
+	dup := &gateway.Route{ID: "route-3", ModelAlias: "route-1", Targets: []byte(`[]`), Strategy: "priority"}
+	if err := s.CreateRoute(ctx, dup); !errors.Is(err, gateway.ErrConflict) {
+		t.Errorf("duplicate alias create: err = %v, want ErrConflict", err)
+	}
+	dup = &gateway.Route{ID: "route-1", ModelAlias: "other", Targets: []byte(`[]`), Strategy: "priority"}
+	if err := s.CreateRoute(ctx, dup); !errors.Is(err, gateway.ErrConflict) {
+		t.Errorf("duplicate ID create: err = %v, want ErrConflict", err)
+	}
+	rename := &gateway.Route{ID: "route-2", ModelAlias: "route-1", Targets: []byte(`[]`), Strategy: "priority"}
+	if err := s.UpdateRoute(ctx, rename); !errors.Is(err, gateway.ErrConflict) {
+		t.Errorf("update to taken alias: err = %v, want ErrConflict", err)
+	}
+
+	got, err := s.GetRouteByAlias(ctx, "route-1")
+	if err != nil {
+		t.Fatal("GetRouteByAlias:", err)
+	}
+	if got.ID != "route-1" {
+		t.Errorf("alias route-1 resolves to %q, want route-1", got.ID)
+	}
+}
+
+func TestMigrateProviderRoutes(t *testing.T) {
+	t.Parallel()
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	for _, r := range []*gateway.Route{
+		{ID: "route-a", ModelAlias: "a", Strategy: "priority",
+			Targets: []byte(`[{"provider_id":"old","model":"m","priority":1},{"provider_id":"other","model":"m","priority":2}]`)},
+		{ID: "route-b", ModelAlias: "b", Strategy: "priority",
+			Targets: []byte(`[{"provider_id":"other","model":"m","priority":1}]`)},
+	} {
+		if err := s.CreateRoute(ctx, r); err != nil {
+			t.Fatal("create:", err)
+		}
+	}
+
+	changed, err := s.MigrateProviderRoutes(ctx, "old", "new", true)
+	if err != nil {
+		t.Fatal("MigrateProviderRoutes:", err)
+	}
+	if len(changed) != 1 || changed[0].ID != "route-a" {
+		t.Fatalf("changed = %+v, want only route-a", changed)
+	}
+
+	got, err := s.GetRoute(ctx, "route-a")
+	if err != nil {
+		t.Fatal("GetRoute:", err)
+	}
+	var ts []gateway.RouteTarget
+	if err := json.Unmarshal(got.Targets, &ts); err != nil {
+		t.Fatal(err)
+	}
+	want := []gateway.RouteTarget{
+		{ProviderID: "new", Model: "m", Priority: 1},
+		{ProviderID: "other", Model: "m", Priority: 2},
+		{ProviderID: "old", Model: "m", Priority: 3},
+	}
+	if len(ts) != len(want) {
+		t.Fatalf("targets = %+v, want %+v", ts, want)
+	}
+	for i := range want {
+		if ts[i] != want[i] {
+			t.Errorf("target %d = %+v, want %+v", i, ts[i], want[i])
+		}
+	}
+
+	got, err = s.GetRoute(ctx, "route-b")
+	if err != nil {
+		t.Fatal("GetRoute:", err)
+	}
+	if string(got.Targets) != `[{"provider_id":"other","model":"m","priority":1}]` {
+		t.Errorf("route-b targets = %s, want unchanged", got.Targets)
+	}
+}
+
 func TestListOrgs(t *testing.T) {
 	t.Parallel()
 	s := newTestStore(t)
@@ -735,3 +1071,292 @@ func TestListOrgs(t *testing.T) {
 		t.Errorf("paginated orgs count = %d, want 1", len(orgs))
 	}
 }
+
+func TestThreadRoundTrip(t *testing.T) {
+	t.Parallel()
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	th := &gateway.Thread{
+		ID:        "thread-1",
+		KeyID:     "key-1",
+		OrgID:     "org-1",
+		Messages:  []gateway.Message{{Role: "system", Content: []byte(`"be brief"`)}},
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.CreateThread(ctx, th); err != nil {
+		t.Fatal("create:", err)
+	}
+
+	turn := []gateway.Message{
+		{Role: "user", Content: []byte(`"hi"`)},
+		{Role: "assistant", Content: []byte(`"hello"`)},
+	}
+	if err := s.AppendThreadMessages(ctx, "thread-1", turn); err != nil {
+		t.Fatal("append:", err)
+	}
+
+	got, err := s.GetThread(ctx, "thread-1")
+	if err != nil {
+		t.Fatal("get:", err)
+	}
+	if got.KeyID != "key-1" || got.OrgID != "org-1" {
+		t.Errorf("owner = %q/%q, want key-1/org-1", got.KeyID, got.OrgID)
+	}
+	if len(got.Messages) != 3 {
+		t.Fatalf("messages = %d, want 3", len(got.Messages))
+	}
+	for i, role := range []string{"system", "user", "assistant"} {
+		if got.Messages[i].Role != role {
+			t.Errorf("messages[%d].role = %q, want %q", i, got.Messages[i].Role, role)
+		}
+	}
+
+	if err := s.AppendThreadMessages(ctx, "missing", turn); err != gateway.ErrNotFound {
+		t.Errorf("append to missing thread: err = %v, want ErrNotFound", err)
+	}
+	if _, err := s.GetThread(ctx, "missing"); err != gateway.ErrNotFound {
+		t.Errorf("get missing thread: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSaveEvalCaptures(t *testing.T) {
+	t.Parallel()
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	captures := []gateway.EvalCapture{
+		{ID: "c-1", GroupID: "g-1", RequestID: "req-1", Label: "primary", ProviderID: "openai", Model: "gpt-4o",
+			Request: []byte(`{"model":"gpt-4o"}`), Response: []byte(`{"id":"a"}`), LatencyMs: 12, CreatedAt: now},
+		{ID: "c-2", GroupID: "g-1", RequestID: "req-1", Label: "shadow", ProviderID: "anthropic", Model: "claude-sonnet-4-6",
+			Request: []byte(`{"model":"gpt-4o"}`), Error: "upstream 500", CreatedAt: now},
+	}
+	if err := s.SaveEvalCaptures(ctx, captures); err != nil {
+		t.Fatal("save:", err)
+	}
+
+	rows, err := s.read.QueryContext(ctx, `SELECT label, provider_id, response, error FROM eval_captures WHERE group_id='g-1' ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var label, providerID string
+		var response, errMsg sql.NullString
+		if err := rows.Scan(&label, &providerID, &response, &errMsg); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, label+"/"+providerID+"/"+response.String+"/"+errMsg.String)
+	}
+	want := []string{`primary/openai/{"id":"a"}/`, "shadow/anthropic//upstream 500"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+}
+
+func TestListEvalCaptures(t *testing.T) {
+	t.Parallel()
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for i, c := range []gateway.EvalCapture{
+		{ID: "c-1", GroupID: "c-1", OrgID: "default", Label: "sample", ProviderID: "openai", Model: "gpt-4o",
+			Request: []byte(`{"model":"gpt-4o"}`), Response: []byte(`{"id":"a"}`), LatencyMs: 7, CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: "c-2", GroupID: "g-1", RequestID: "req-2", OrgID: "other", Label: "primary", ProviderID: "openai", Model: "gpt-4o",
+			Request: []byte(`{"model":"gpt-4o"}`), Response: []byte(`{"id":"b"}`), CreatedAt: now.Add(-time.Hour)},
+		{ID: "c-3", GroupID: "c-3", OrgID: "default", Label: "sample", ProviderID: "anthropic", Model: "claude-sonnet-4-6",
+			Request: []byte(`{"model":"claude"}`), Error: "upstream 500", CreatedAt: now},
+	} {
+		if err := s.SaveEvalCaptures(ctx, []gateway.EvalCapture{c}); err != nil {
+			t.Fatalf("save %d: %v", i, err)
+		}
+	}
+
+	ids := func(f gateway.EvalCaptureFilter) string {
+		t.Helper()
+		got, err := s.ListEvalCaptures(ctx, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, c := range got {
+			out = append(out, c.ID)
+		}
+		return strings.Join(out, ",")
+	}
+	tests := []struct {
+		name string
+		f    gateway.EvalCaptureFilter
+		want string
+	}{
+		{"all, oldest first", gateway.EvalCaptureFilter{}, "c-1,c-2,c-3"},
+		{"label", gateway.EvalCaptureFilter{Label: "sample"}, "c-1,c-3"},
+		{"org", gateway.EvalCaptureFilter{OrgID: "other"}, "c-2"},
+		{"model", gateway.EvalCaptureFilter{Model: "gpt-4o"}, "c-1,c-2"},
+		{"since", gateway.EvalCaptureFilter{Since: now.Add(-90 * time.Minute).Format(time.RFC3339)}, "c-2,c-3"},
+		{"until", gateway.EvalCaptureFilter{Until: now.Add(-90 * time.Minute).Format(time.RFC3339)}, "c-1"},
+		{"limit", gateway.EvalCaptureFilter{Limit: 2}, "c-1,c-2"},
+	}
+	for _, tt := range tests {
+		if got := ids(tt.f); got != tt.want {
+			t.Errorf("%s: ids = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	got, err := s.ListEvalCaptures(ctx, gateway.EvalCaptureFilter{Label: "sample"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := got[0]; string(c.Request) != `{"model":"gpt-4o"}` || string(c.Response) != `{"id":"a"}` || c.LatencyMs != 7 || c.OrgID != "default" || !c.CreatedAt.Equal(now.Add(-2*time.Hour)) {
+		t.Errorf("c-1 = %+v", c)
+	}
+	if c := got[1]; c.Response != nil || c.Error != "upstream 500" || c.RequestID != "" {
+		t.Errorf("c-3 = %+v", c)
+	}
+}
+
+func TestAuditQueryAndCount(t *testing.T) {
+	t.Parallel()
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	entries := []gateway.AuditEntry{
+		{ID: "a-1", ActorKeyID: "k1", ActorSubject: "gnd_abcd", OrgID: "org-a", Action: "create", TargetType: "provider",
+			TargetID: "openai", Diff: json.RawMessage(`{"name":{"new":"openai"}}`), CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: "a-2", ActorKeyID: "k2", Action: "update", TargetType: "provider",
+			TargetID: "openai", Diff: json.RawMessage(`{"priority":{"old":1,"new":2}}`), CreatedAt: now.Add(-1 * time.Hour)},
+		{ID: "a-3", ActorKeyID: "k1", Action: "delete", TargetType: "route", TargetID: "r1", CreatedAt: now},
+	}
+	for i := range entries {
+		if err := s.InsertAudit(ctx, &entries[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := s.QueryAudit(ctx, gateway.AuditFilter{TargetType: "provider", TargetID: "openai"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].ID != "a-2" || got[1].ID != "a-1" {
+		t.Fatalf("provider entries = %+v, want a-2, a-1", got)
+	}
+	if got[1].ActorSubject != "gnd_abcd" || string(got[1].Diff) != `{"name":{"new":"openai"}}` {
+		t.Errorf("a-1 = %+v", got[1])
+	}
+	if !got[1].CreatedAt.Equal(now.Add(-2 * time.Hour)) {
+		t.Errorf("created_at = %v, want %v", got[1].CreatedAt, now.Add(-2*time.Hour))
+	}
+
+	got, err = s.QueryAudit(ctx, gateway.AuditFilter{ActorKeyID: "k1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Diff != nil {
+		t.Errorf("k1 entries = %+v, want 2 with no diff on the newest", got)
+	}
+
+	got, err = s.QueryAudit(ctx, gateway.AuditFilter{OrgID: "org-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != "a-1" || got[0].OrgID != "org-a" {
+		t.Errorf("org-a entries = %+v, want a-1", got)
+	}
+
+	n, err := s.CountAudit(ctx, gateway.AuditFilter{Since: now.Add(-90 * time.Minute).Format(time.RFC3339)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("count since = %d, want 2", n)
+	}
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	t.Parallel()
+	src := newTestStore(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	rpm := int64(100)
+	if err := src.CreateOrg(ctx, &gateway.Organization{ID: "org-1", Name: "Acme", RPMLimit: &rpm, CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.CreateTeam(ctx, &gateway.Team{ID: "team-1", OrgID: "org-1", Name: "ML"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.CreateProvider(ctx, &gateway.ProviderConfig{ID: "openai", Name: "openai", Type: "openai", BaseURL: "https://api.openai.com/v1", Models: []string{"gpt-4o"}, Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.CreateRoute(ctx, &gateway.Route{ID: "r-1", ModelAlias: "chat", Targets: []byte(`[{"provider_id":"openai","model":"gpt-4o","priority":1}]`), Strategy: "priority"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.CreateKey(ctx, &gateway.APIKey{ID: "key-1", KeyHash: "hash-1", KeyPrefix: "gnd_abc1", OrgID: "org-1", TeamID: "team-1", Role: "member", CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := src.ExportBackup(ctx)
+	if err != nil {
+		t.Fatalf("ExportBackup: %v", err)
+	}
+	if len(b.Orgs) != 2 || len(b.Teams) != 1 || len(b.Providers) != 1 || len(b.Routes) != 1 || len(b.Keys) != 1 {
+		t.Fatalf("backup counts = orgs %d teams %d providers %d routes %d keys %d, want 2/1/1/1/1",
+			len(b.Orgs), len(b.Teams), len(b.Providers), len(b.Routes), len(b.Keys))
+	}
+	if b.Keys[0].KeyHash != "hash-1" {
+		t.Errorf("backup key hash = %q, want hash-1", b.Keys[0].KeyHash)
+	}
+
+	// Restore replaces whatever the destination held.
+	dst := newTestStore(t)
+	if err := dst.CreateRoute(ctx, &gateway.Route{ID: "r-old", ModelAlias: "old", Targets: []byte(`[]`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.RestoreBackup(ctx, b); err != nil {
+		t.Fatalf("RestoreBackup: %v", err)
+	}
+	if _, err := dst.GetRouteByAlias(ctx, "old"); !errors.Is(err, gateway.ErrNotFound) {
+		t.Errorf("old route after restore: err = %v, want ErrNotFound", err)
+	}
+	if r, err := dst.GetRouteByAlias(ctx, "chat"); err != nil || string(r.Targets) != string(b.Routes[0].Targets) {
+		t.Errorf("restored route = %+v, %v", r, err)
+	}
+	k, err := dst.GetKeyByHash(ctx, "hash-1")
+	if err != nil {
+		t.Fatalf("restored key by hash: %v", err)
+	}
+	if k.ID != "key-1" || k.TeamID != "team-1" || !k.CreatedAt.Equal(now) {
+		t.Errorf("restored key = %+v", k)
+	}
+	if o, err := dst.GetOrg(ctx, "org-1"); err != nil || o.RPMLimit == nil || *o.RPMLimit != 100 {
+		t.Errorf("restored org = %+v, %v", o, err)
+	}
+}
+
+func TestRestoreBackupRollsBack(t *testing.T) {
+	t.Parallel()
+	s := newTestStore(t)
+	ctx := context.Background()
+	if err := s.CreateRoute(ctx, &gateway.Route{ID: "r-1", ModelAlias: "keep", Targets: []byte(`[]`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The key references an org the backup does not contain.
+	b := &gateway.Backup{
+		Routes: []*gateway.Route{{ID: "r-2", ModelAlias: "new", Targets: []byte(`[]`)}},
+		Keys:   []*gateway.BackupKey{{APIKey: gateway.APIKey{ID: "k", KeyPrefix: "gnd_x", OrgID: "missing"}, KeyHash: "h"}},
+	}
+	if err := s.RestoreBackup(ctx, b); err == nil {
+		t.Fatal("RestoreBackup with dangling org = nil error, want error")
+	}
+	if _, err := s.GetRouteByAlias(ctx, "keep"); err != nil {
+		t.Errorf("existing route lost after failed restore: %v", err)
+	}
+	if n, _ := s.CountRoutes(ctx); n != 1 {
+		t.Errorf("routes = %d after failed restore, want 1", n)
+	}
+}
@@ -0,0 +1,102 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+// CreateThread inserts a new thread along with any initial messages.
+func (s *Store) CreateThread(ctx context.Context, t *gateway.Thread) error {
+	tx, err := s.write.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO threads (id, key_id, org_id, created_at) VALUES (?, ?, ?, ?)`,
+		t.ID, nullStr(t.KeyID), t.OrgID, t.CreatedAt.UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return err
+	}
+	if err := insertThreadMessages(ctx, tx, t.ID, t.Messages); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetThread retrieves a thread and its messages in append order.
+func (s *Store) GetThread(ctx context.Context, id string) (*gateway.Thread, error) {
+	var t gateway.Thread
+	var keyID, createdAt sql.NullString
+	err := s.read.QueryRowContext(ctx,
+		`SELECT id, key_id, org_id, created_at FROM threads WHERE id=?`, id,
+	).Scan(&t.ID, &keyID, &t.OrgID, &createdAt)
+	if err != nil {
+		return nil, notFoundErr(err)
+	}
+	t.KeyID = keyID.String
+	if ct := parseTime(createdAt); ct != nil {
+		t.CreatedAt = *ct
+	}
+
+	rows, err := s.read.QueryContext(ctx,
+		`SELECT message FROM thread_messages WHERE thread_id=? ORDER BY seq`, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var m gateway.Message
+		if err := json.Unmarshal([]byte(raw), &m); err != nil {
+			return nil, err
+		}
+		t.Messages = append(t.Messages, m)
+	}
+	return &t, rows.Err()
+}
+
+// AppendThreadMessages adds messages to the end of an existing thread.
+func (s *Store) AppendThreadMessages(ctx context.Context, id string, msgs []gateway.Message) error {
+	tx, err := s.write.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRowContext(ctx, `SELECT 1 FROM threads WHERE id=?`, id).Scan(&exists); err != nil {
+		return notFoundErr(err)
+	}
+	if err := insertThreadMessages(ctx, tx, id, msgs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertThreadMessages(ctx context.Context, tx *sql.Tx, threadID string, msgs []gateway.Message) error {
+	for i := range msgs {
+		data, err := json.Marshal(&msgs[i])
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO thread_messages (thread_id, message) VALUES (?, ?)`,
+			threadID, string(data),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package sqlite
 
 import (
 	"context"
+	"database/sql"
 	"strings"
 	"time"
 
@@ -16,47 +17,81 @@ func (s *Store) InsertUsage(ctx context.Context, records []gateway.UsageRecord)
 
 	// cols must match the number of columns in the INSERT below.
 	// Single multi-row INSERT avoids N round-trips for large batches.
-	const cols = 18
+	const cols = 21
 	placeholders := make([]string, len(records))
 	args := make([]any, 0, len(records)*cols)
 
 	for i, r := range records {
-		placeholders[i] = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+		tags, err := marshalJSON(r.Tags)
+		if err != nil {
+			return err
+		}
+		placeholders[i] = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
 		args = append(args,
 			r.ID, r.KeyID, r.UserID, r.TeamID, r.OrgID,
 			r.CallerJWTSub, r.CallerService,
 			r.Model, r.ProviderID,
 			r.PromptTokens, r.CompletionTokens, r.TotalTokens, r.CostUSD,
-			boolToInt(r.Cached), r.LatencyMs, r.StatusCode,
-			r.RequestID, r.CreatedAt.UTC().Format(time.RFC3339),
+			boolToInt(r.Cached), r.LatencyMs, r.TTFBMs, r.StatusCode, boolToInt(r.Canceled),
+			r.RequestID, r.EndUser, tags, r.CreatedAt.UTC().Format(time.RFC3339),
 		)
 	}
 
 	query := `INSERT INTO usage_records
 		(id, key_id, user_id, team_id, org_id, caller_jwt_sub, caller_service,
 		 model, provider_id, prompt_tokens, completion_tokens, total_tokens, cost_usd,
-		 cached, latency_ms, status_code, request_id, created_at)
+		 cached, latency_ms, ttfb_ms, status_code, canceled, request_id, end_user, tags, created_at)
 		VALUES ` + strings.Join(placeholders, ", ")
 
 	_, err := s.write.ExecContext(ctx, query, args...)
 	return err
 }
 
-// SumUsageCost returns the total accumulated cost for a given API key.
-func (s *Store) SumUsageCost(ctx context.Context, keyID string) (float64, error) {
+// SumUsageCost returns the total cost for a given API key recorded at or
+// after since. A zero since sums all usage.
+func (s *Store) SumUsageCost(ctx context.Context, keyID string, since time.Time) (float64, error) {
 	var total float64
-	err := s.read.QueryRowContext(ctx,
-		`SELECT COALESCE(SUM(cost_usd), 0) FROM usage_records WHERE key_id = ?`, keyID,
-	).Scan(&total)
+	var err error
+	if since.IsZero() {
+		err = s.read.QueryRowContext(ctx,
+			`SELECT COALESCE(SUM(cost_usd), 0) FROM usage_records WHERE key_id = ?`, keyID,
+		).Scan(&total)
+	} else {
+		err = s.read.QueryRowContext(ctx,
+			`SELECT COALESCE(SUM(cost_usd), 0) FROM usage_records WHERE key_id = ? AND created_at >= ?`,
+			keyID, since.UTC().Format(time.RFC3339),
+		).Scan(&total)
+	}
 	return total, err
 }
 
-// QueryUsage returns usage records matching the filter.
+// CountRequests returns the number of usage records for a given API key
+// recorded at or after since. A zero since counts all usage.
+func (s *Store) CountRequests(ctx context.Context, keyID string, since time.Time) (int64, error) {
+	var n int64
+	err := s.read.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM usage_records WHERE key_id = ? AND created_at >= ?`,
+		keyID, since.UTC().Format(time.RFC3339),
+	).Scan(&n)
+	return n, err
+}
+
+// QueryUsage returns usage records matching the filter. It may read a
+// replica; use QueryUsagePrimary where a stale result matters.
 func (s *Store) QueryUsage(ctx context.Context, f gateway.UsageFilter) ([]gateway.UsageRecord, error) {
+	return queryUsage(ctx, s.bulk(), f)
+}
+
+// QueryUsagePrimary is QueryUsage read from the primary.
+func (s *Store) QueryUsagePrimary(ctx context.Context, f gateway.UsageFilter) ([]gateway.UsageRecord, error) {
+	return queryUsage(ctx, s.read, f)
+}
+
+func queryUsage(ctx context.Context, db *sql.DB, f gateway.UsageFilter) ([]gateway.UsageRecord, error) {
 	where, args := usageWhere(f)
 	query := `SELECT id, key_id, user_id, team_id, org_id, caller_jwt_sub, caller_service,
 		model, provider_id, prompt_tokens, completion_tokens, total_tokens, cost_usd,
-		cached, latency_ms, status_code, request_id, created_at
+		cached, latency_ms, ttfb_ms, status_code, canceled, request_id, end_user, tags, created_at
 		FROM usage_records` + where + ` ORDER BY created_at DESC LIMIT ? OFFSET ?`
 	limit := f.Limit
 	if limit <= 0 {
@@ -64,7 +99,7 @@ func (s *Store) QueryUsage(ctx context.Context, f gateway.UsageFilter) ([]gatewa
 	}
 	args = append(args, limit, f.Offset)
 
-	rows, err := s.read.QueryContext(ctx, query, args...)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -73,20 +108,26 @@ func (s *Store) QueryUsage(ctx context.Context, f gateway.UsageFilter) ([]gatewa
 	var out []gateway.UsageRecord
 	for rows.Next() {
 		var r gateway.UsageRecord
-		var cached int
+		var cached, canceled int
 		var createdAt string
+		var endUser, tags sql.NullString
 		err := rows.Scan(
 			&r.ID, &r.KeyID, &r.UserID, &r.TeamID, &r.OrgID,
 			&r.CallerJWTSub, &r.CallerService,
 			&r.Model, &r.ProviderID,
 			&r.PromptTokens, &r.CompletionTokens, &r.TotalTokens, &r.CostUSD,
-			&cached, &r.LatencyMs, &r.StatusCode,
-			&r.RequestID, &createdAt,
+			&cached, &r.LatencyMs, &r.TTFBMs, &r.StatusCode, &canceled,
+			&r.RequestID, &endUser, &tags, &createdAt,
 		)
 		if err != nil {
 			return nil, err
 		}
 		r.Cached = cached != 0
+		r.Canceled = canceled != 0
+		r.EndUser = endUser.String
+		if r.Tags, err = unmarshalStringSlice(tags); err != nil {
+			return nil, err
+		}
 		if t, e := time.Parse(time.RFC3339, createdAt); e == nil {
 			r.CreatedAt = t
 		}
@@ -99,7 +140,7 @@ func (s *Store) QueryUsage(ctx context.Context, f gateway.UsageFilter) ([]gatewa
 func (s *Store) CountUsage(ctx context.Context, f gateway.UsageFilter) (int, error) {
 	where, args := usageWhere(f)
 	var n int
-	err := s.read.QueryRowContext(ctx,
+	err := s.bulk().QueryRowContext(ctx,
 		`SELECT COUNT(*) FROM usage_records`+where, args...,
 	).Scan(&n)
 	return n, err
@@ -148,15 +189,18 @@ func (s *Store) UpsertRollup(ctx context.Context, rollups []gateway.UsageRollup)
 
 	stmt, err := tx.PrepareContext(ctx,
 		`INSERT INTO usage_rollups (org_id, key_id, model, period, bucket,
-		 request_count, prompt_tokens, completion_tokens, total_tokens, cost_usd, cached_count)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 request_count, prompt_tokens, completion_tokens, total_tokens, cost_usd, cached_count,
+		 stream_count, ttfb_ms_sum)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		 ON CONFLICT(org_id, key_id, model, period, bucket) DO UPDATE SET
 		 request_count = excluded.request_count,
 		 prompt_tokens = excluded.prompt_tokens,
 		 completion_tokens = excluded.completion_tokens,
 		 total_tokens = excluded.total_tokens,
 		 cost_usd = excluded.cost_usd,
-		 cached_count = excluded.cached_count`)
+		 cached_count = excluded.cached_count,
+		 stream_count = excluded.stream_count,
+		 ttfb_ms_sum = excluded.ttfb_ms_sum`)
 	if err != nil {
 		return err
 	}
@@ -166,6 +210,7 @@ func (s *Store) UpsertRollup(ctx context.Context, rollups []gateway.UsageRollup)
 		if _, err := stmt.ExecContext(ctx,
 			r.OrgID, r.KeyID, r.Model, r.Period, r.Bucket,
 			r.RequestCount, r.PromptTokens, r.CompletionTokens, r.TotalTokens, r.CostUSD, r.CachedCount,
+			r.StreamCount, r.TTFBMsSum,
 		); err != nil {
 			return err
 		}
@@ -173,13 +218,24 @@ func (s *Store) UpsertRollup(ctx context.Context, rollups []gateway.UsageRollup)
 	return tx.Commit()
 }
 
-// QueryRollups returns rollups matching the filter.
+// QueryRollups returns rollups matching the filter. It may read a replica;
+// use QueryRollupsPrimary where a stale result matters.
 func (s *Store) QueryRollups(ctx context.Context, f gateway.RollupFilter) ([]gateway.UsageRollup, error) {
+	return queryRollups(ctx, s.bulk(), f)
+}
+
+// QueryRollupsPrimary is QueryRollups read from the primary.
+func (s *Store) QueryRollupsPrimary(ctx context.Context, f gateway.RollupFilter) ([]gateway.UsageRollup, error) {
+	return queryRollups(ctx, s.read, f)
+}
+
+func queryRollups(ctx context.Context, db *sql.DB, f gateway.RollupFilter) ([]gateway.UsageRollup, error) {
 	where, args := rollupWhere(f)
 
-	rows, err := s.read.QueryContext(ctx,
+	rows, err := db.QueryContext(ctx,
 		`SELECT org_id, key_id, model, period, bucket,
-		 request_count, prompt_tokens, completion_tokens, total_tokens, cost_usd, cached_count
+		 request_count, prompt_tokens, completion_tokens, total_tokens, cost_usd, cached_count,
+		 stream_count, ttfb_ms_sum
 		 FROM usage_rollups`+where+` ORDER BY bucket DESC`, args...,
 	)
 	if err != nil {
@@ -191,7 +247,8 @@ func (s *Store) QueryRollups(ctx context.Context, f gateway.RollupFilter) ([]gat
 	for rows.Next() {
 		var r gateway.UsageRollup
 		err := rows.Scan(&r.OrgID, &r.KeyID, &r.Model, &r.Period, &r.Bucket,
-			&r.RequestCount, &r.PromptTokens, &r.CompletionTokens, &r.TotalTokens, &r.CostUSD, &r.CachedCount)
+			&r.RequestCount, &r.PromptTokens, &r.CompletionTokens, &r.TotalTokens, &r.CostUSD, &r.CachedCount,
+			&r.StreamCount, &r.TTFBMsSum)
 		if err != nil {
 			return nil, err
 		}
@@ -3,6 +3,7 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	gateway "github.com/eugener/gandalf/internal"
 )
@@ -14,6 +15,10 @@ type APIKeyStore interface {
 	GetKeyByHash(ctx context.Context, hash string) (*gateway.APIKey, error)
 	ListKeys(ctx context.Context, orgID string, offset, limit int) ([]*gateway.APIKey, error)
 	CountKeys(ctx context.Context, orgID string) (int, error)
+	// CountKeysPrimary is CountKeys without replica lag, for safety checks.
+	CountKeysPrimary(ctx context.Context, orgID string) (int, error)
+	// ListPoolKeys returns the keys in an org's key pool.
+	ListPoolKeys(ctx context.Context, orgID, pool string) ([]*gateway.APIKey, error)
 	UpdateKey(ctx context.Context, key *gateway.APIKey) error
 	DeleteKey(ctx context.Context, id string) error
 	TouchKeyUsed(ctx context.Context, id string) error
@@ -45,11 +50,16 @@ type RouteStore interface {
 // UsageStore manages usage record persistence.
 type UsageStore interface {
 	InsertUsage(ctx context.Context, records []gateway.UsageRecord) error
-	SumUsageCost(ctx context.Context, keyID string) (float64, error)
+	SumUsageCost(ctx context.Context, keyID string, since time.Time) (float64, error)
 	QueryUsage(ctx context.Context, filter gateway.UsageFilter) ([]gateway.UsageRecord, error)
+	// QueryUsagePrimary is QueryUsage without replica lag, for background
+	// jobs that write back what they read.
+	QueryUsagePrimary(ctx context.Context, filter gateway.UsageFilter) ([]gateway.UsageRecord, error)
 	CountUsage(ctx context.Context, filter gateway.UsageFilter) (int, error)
 	UpsertRollup(ctx context.Context, rollups []gateway.UsageRollup) error
 	QueryRollups(ctx context.Context, filter gateway.RollupFilter) ([]gateway.UsageRollup, error)
+	// QueryRollupsPrimary is QueryRollups without replica lag.
+	QueryRollupsPrimary(ctx context.Context, filter gateway.RollupFilter) ([]gateway.UsageRollup, error)
 }
 
 // OrgStore manages organization and team persistence.
@@ -57,15 +67,62 @@ type OrgStore interface {
 	CreateOrg(ctx context.Context, org *gateway.Organization) error
 	GetOrg(ctx context.Context, id string) (*gateway.Organization, error)
 	ListOrgs(ctx context.Context, offset, limit int) ([]*gateway.Organization, error)
+	CountOrgs(ctx context.Context) (int, error)
 	UpdateOrg(ctx context.Context, org *gateway.Organization) error
 	DeleteOrg(ctx context.Context, id string) error
 	CreateTeam(ctx context.Context, team *gateway.Team) error
 	GetTeam(ctx context.Context, id string) (*gateway.Team, error)
 	ListTeams(ctx context.Context, orgID string, offset, limit int) ([]*gateway.Team, error)
+	CountTeams(ctx context.Context, orgID string) (int, error)
 	UpdateTeam(ctx context.Context, team *gateway.Team) error
 	DeleteTeam(ctx context.Context, id string) error
 }
 
+// ThreadStore manages server-side conversation threads. It is optional and
+// not part of Store; the SQLite store implements it.
+type ThreadStore interface {
+	CreateThread(ctx context.Context, t *gateway.Thread) error
+	// GetThread returns the thread with its messages in append order.
+	GetThread(ctx context.Context, id string) (*gateway.Thread, error)
+	AppendThreadMessages(ctx context.Context, id string, msgs []gateway.Message) error
+}
+
+// EvalCaptureStore persists shadow evaluation and sampled captures. It is
+// optional and not part of Store; the SQLite store implements it.
+type EvalCaptureStore interface {
+	// SaveEvalCaptures stores a capture group (a primary and its shadows,
+	// or one sampled pair) together.
+	SaveEvalCaptures(ctx context.Context, captures []gateway.EvalCapture) error
+	// ListEvalCaptures returns matching captures, oldest first.
+	ListEvalCaptures(ctx context.Context, filter gateway.EvalCaptureFilter) ([]gateway.EvalCapture, error)
+}
+
+// AuditStore persists the admin audit trail. It is optional and not part
+// of Store; the SQLite store implements it.
+type AuditStore interface {
+	InsertAudit(ctx context.Context, e *gateway.AuditEntry) error
+	// QueryAudit returns matching entries, newest first.
+	QueryAudit(ctx context.Context, filter gateway.AuditFilter) ([]gateway.AuditEntry, error)
+	CountAudit(ctx context.Context, filter gateway.AuditFilter) (int, error)
+}
+
+// BackupStore exports and restores gateway configuration. It is optional
+// and not part of Store; the SQLite store implements it.
+type BackupStore interface {
+	ExportBackup(ctx context.Context) (*gateway.Backup, error)
+	// RestoreBackup replaces all providers, routes, orgs, teams, and keys
+	// with the contents of b in one transaction.
+	RestoreBackup(ctx context.Context, b *gateway.Backup) error
+}
+
+// RouteMigrator repoints routes from one provider to another. It is
+// optional and not part of Store; the SQLite store implements it.
+type RouteMigrator interface {
+	// MigrateProviderRoutes applies gateway.MigrateTargets to every route
+	// in one transaction and returns the routes that changed.
+	MigrateProviderRoutes(ctx context.Context, from, to string, keepFailover bool) ([]*gateway.Route, error)
+}
+
 // Store combines all storage interfaces.
 type Store interface {
 	APIKeyStore
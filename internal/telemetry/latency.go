@@ -0,0 +1,50 @@
+package telemetry
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ProviderLatency is one provider's rolling upstream latency quantiles.
+type ProviderLatency struct {
+	Provider  string
+	Count     uint64
+	Sum       time.Duration
+	Quantiles map[float64]time.Duration // quantile (0.5, 0.95, ...) -> latency
+}
+
+var providerLatencyDesc = prometheus.NewDesc(
+	"gandalf_provider_latency_seconds",
+	"Upstream latency per provider over a rolling window of recent calls.",
+	[]string{"provider"}, nil,
+)
+
+// latencyCollector exports summaries computed by its source on every scrape,
+// so the request path only pays for recording a sample.
+type latencyCollector struct {
+	source func() []ProviderLatency
+}
+
+// NewProviderLatencyCollector returns a collector exporting
+// gandalf_provider_latency_seconds summaries from source, which is called
+// once per scrape.
+func NewProviderLatencyCollector(source func() []ProviderLatency) prometheus.Collector {
+	return latencyCollector{source: source}
+}
+
+// Describe implements prometheus.Collector.
+func (c latencyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- providerLatencyDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c latencyCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, p := range c.source() {
+		q := make(map[float64]float64, len(p.Quantiles))
+		for k, v := range p.Quantiles {
+			q[k] = v.Seconds()
+		}
+		ch <- prometheus.MustNewConstSummary(providerLatencyDesc, p.Count, p.Sum.Seconds(), q, p.Provider)
+	}
+}
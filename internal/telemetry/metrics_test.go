@@ -2,6 +2,7 @@ package telemetry
 
 import (
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -82,3 +83,34 @@ func TestNewMetricsIncrement(t *testing.T) {
 
 // SetupTracing is not unit-tested because it requires a gRPC connection
 // to an OTLP collector, which is integration-test territory.
+
+func TestProviderLatencyCollector(t *testing.T) {
+	t.Parallel()
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(NewProviderLatencyCollector(func() []ProviderLatency {
+		return []ProviderLatency{{
+			Provider:  "openai",
+			Count:     3,
+			Sum:       600 * time.Millisecond,
+			Quantiles: map[float64]time.Duration{0.5: 200 * time.Millisecond, 0.99: 300 * time.Millisecond},
+		}}
+	}))
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	if len(families) != 1 || families[0].GetName() != "gandalf_provider_latency_seconds" {
+		t.Fatalf("families = %v, want gandalf_provider_latency_seconds", families)
+	}
+	s := families[0].GetMetric()[0].GetSummary()
+	if s.GetSampleCount() != 3 || s.GetSampleSum() != 0.6 {
+		t.Errorf("count, sum = %d, %v; want 3, 0.6", s.GetSampleCount(), s.GetSampleSum())
+	}
+	for _, q := range s.GetQuantile() {
+		if q.GetQuantile() == 0.5 && q.GetValue() != 0.2 {
+			t.Errorf("p50 = %v, want 0.2", q.GetValue())
+		}
+	}
+}
@@ -3,19 +3,25 @@ package testutil
 import (
 	"context"
 	"sync"
+	"time"
 
 	gateway "github.com/eugener/gandalf/internal"
 )
 
 // FakeStore is an in-memory implementation of storage.Store for testing.
 type FakeStore struct {
-	mu     sync.RWMutex
-	routes map[string]*gateway.Route
+	mu       sync.RWMutex
+	routes   map[string]*gateway.Route
+	threads  map[string]*gateway.Thread
+	captures []gateway.EvalCapture
 }
 
 // NewFakeStore returns a FakeStore with empty collections.
 func NewFakeStore() *FakeStore {
-	return &FakeStore{routes: make(map[string]*gateway.Route)}
+	return &FakeStore{
+		routes:  make(map[string]*gateway.Route),
+		threads: make(map[string]*gateway.Thread),
+	}
 }
 
 // AddRoute inserts a route into the fake store.
@@ -97,6 +103,78 @@ func (s *FakeStore) CountRoutes(context.Context) (int, error) {
 	return len(s.routes), nil
 }
 
+// --- ThreadStore ---
+
+// CreateThread stores a copy of the thread.
+func (s *FakeStore) CreateThread(_ context.Context, t *gateway.Thread) error {
+	cp := *t
+	cp.Messages = append([]gateway.Message(nil), t.Messages...)
+	s.mu.Lock()
+	s.threads[t.ID] = &cp
+	s.mu.Unlock()
+	return nil
+}
+
+// GetThread returns a copy of the thread so callers can't mutate stored history.
+func (s *FakeStore) GetThread(_ context.Context, id string) (*gateway.Thread, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.threads[id]
+	if !ok {
+		return nil, gateway.ErrNotFound
+	}
+	cp := *t
+	cp.Messages = append([]gateway.Message(nil), t.Messages...)
+	return &cp, nil
+}
+
+// AppendThreadMessages appends messages to a stored thread.
+func (s *FakeStore) AppendThreadMessages(_ context.Context, id string, msgs []gateway.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.threads[id]
+	if !ok {
+		return gateway.ErrNotFound
+	}
+	t.Messages = append(t.Messages, msgs...)
+	return nil
+}
+
+// --- EvalCaptureStore ---
+
+// SaveEvalCaptures appends captures in order.
+func (s *FakeStore) SaveEvalCaptures(_ context.Context, captures []gateway.EvalCapture) error {
+	s.mu.Lock()
+	s.captures = append(s.captures, captures...)
+	s.mu.Unlock()
+	return nil
+}
+
+// ListEvalCaptures returns saved captures matching the org, label, and
+// model, in save order. Time bounds are ignored.
+func (s *FakeStore) ListEvalCaptures(_ context.Context, f gateway.EvalCaptureFilter) ([]gateway.EvalCapture, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []gateway.EvalCapture
+	for _, c := range s.captures {
+		if (f.OrgID != "" && c.OrgID != f.OrgID) || (f.Label != "" && c.Label != f.Label) || (f.Model != "" && c.Model != f.Model) {
+			continue
+		}
+		out = append(out, c)
+		if f.Limit > 0 && len(out) == f.Limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+// EvalCaptures returns a copy of all saved captures.
+func (s *FakeStore) EvalCaptures() []gateway.EvalCapture {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]gateway.EvalCapture(nil), s.captures...)
+}
+
 // --- Stubs for other Store interfaces ---
 
 func (s *FakeStore) CreateKey(context.Context, *gateway.APIKey) error                         { return nil }
@@ -104,6 +182,8 @@ func (s *FakeStore) GetKey(context.Context, string) (*gateway.APIKey, error)
 func (s *FakeStore) GetKeyByHash(context.Context, string) (*gateway.APIKey, error)            { return nil, gateway.ErrNotFound }
 func (s *FakeStore) ListKeys(context.Context, string, int, int) ([]*gateway.APIKey, error)    { return nil, nil }
 func (s *FakeStore) CountKeys(context.Context, string) (int, error)                           { return 0, nil }
+func (s *FakeStore) CountKeysPrimary(context.Context, string) (int, error)                    { return 0, nil }
+func (s *FakeStore) ListPoolKeys(context.Context, string, string) ([]*gateway.APIKey, error)  { return nil, nil }
 func (s *FakeStore) UpdateKey(context.Context, *gateway.APIKey) error                         { return nil }
 func (s *FakeStore) DeleteKey(context.Context, string) error                                  { return nil }
 func (s *FakeStore) TouchKeyUsed(context.Context, string) error                               { return nil }
@@ -115,19 +195,27 @@ func (s *FakeStore) CountProviders(context.Context) (int, error)
 func (s *FakeStore) UpdateProvider(context.Context, *gateway.ProviderConfig) error            { return nil }
 func (s *FakeStore) DeleteProvider(context.Context, string) error                             { return nil }
 func (s *FakeStore) InsertUsage(context.Context, []gateway.UsageRecord) error                 { return nil }
-func (s *FakeStore) SumUsageCost(context.Context, string) (float64, error)                   { return 0, nil }
+func (s *FakeStore) SumUsageCost(context.Context, string, time.Time) (float64, error)         { return 0, nil }
 func (s *FakeStore) QueryUsage(context.Context, gateway.UsageFilter) ([]gateway.UsageRecord, error) { return nil, nil }
+func (s *FakeStore) QueryUsagePrimary(context.Context, gateway.UsageFilter) ([]gateway.UsageRecord, error) {
+	return nil, nil
+}
 func (s *FakeStore) CountUsage(context.Context, gateway.UsageFilter) (int, error)            { return 0, nil }
 func (s *FakeStore) UpsertRollup(context.Context, []gateway.UsageRollup) error               { return nil }
 func (s *FakeStore) QueryRollups(context.Context, gateway.RollupFilter) ([]gateway.UsageRollup, error) { return nil, nil }
+func (s *FakeStore) QueryRollupsPrimary(context.Context, gateway.RollupFilter) ([]gateway.UsageRollup, error) {
+	return nil, nil
+}
 func (s *FakeStore) CreateOrg(context.Context, *gateway.Organization) error                   { return nil }
 func (s *FakeStore) GetOrg(context.Context, string) (*gateway.Organization, error)            { return nil, gateway.ErrNotFound }
 func (s *FakeStore) ListOrgs(context.Context, int, int) ([]*gateway.Organization, error)      { return nil, nil }
+func (s *FakeStore) CountOrgs(context.Context) (int, error)                                   { return 0, nil }
 func (s *FakeStore) UpdateOrg(context.Context, *gateway.Organization) error                   { return nil }
 func (s *FakeStore) DeleteOrg(context.Context, string) error                                  { return nil }
 func (s *FakeStore) CreateTeam(context.Context, *gateway.Team) error                          { return nil }
 func (s *FakeStore) GetTeam(context.Context, string) (*gateway.Team, error)                   { return nil, gateway.ErrNotFound }
 func (s *FakeStore) ListTeams(context.Context, string, int, int) ([]*gateway.Team, error)     { return nil, nil }
+func (s *FakeStore) CountTeams(context.Context, string) (int, error)                          { return 0, nil }
 func (s *FakeStore) UpdateTeam(context.Context, *gateway.Team) error                          { return nil }
 func (s *FakeStore) DeleteTeam(context.Context, string) error                                 { return nil }
 func (s *FakeStore) Close() error                                                             { return nil }
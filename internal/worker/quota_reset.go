@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/eugener/gandalf/internal/ratelimit"
+)
+
+const quotaResetInterval = time.Minute
+
+// KeyOrgStore lists budgeted keys with their owning org.
+type KeyOrgStore interface {
+	// ListBudgetedKeyOrgs returns a map of key ID to org ID for keys with budgets > 0.
+	ListBudgetedKeyOrgs(ctx context.Context) (map[string]string, error)
+}
+
+// QuotaResetWorker turns MaxBudget into a recurring budget by starting a new
+// quota period for each budgeted key at its org's period boundary.
+// Consumption drops to zero and the key is re-synced so QuotaSyncWorker
+// only counts usage from the period start onward. Limits are untouched.
+type QuotaResetWorker struct {
+	tracker    *ratelimit.QuotaTracker
+	store      ratelimit.QuotaStore
+	keys       KeyOrgStore
+	period     ratelimit.BudgetPeriod            // default for orgs without an override
+	orgPeriods map[string]ratelimit.BudgetPeriod // per-org overrides
+	now        func() time.Time
+}
+
+// NewQuotaResetWorker creates a QuotaResetWorker. orgPeriods may be nil.
+func NewQuotaResetWorker(tracker *ratelimit.QuotaTracker, store ratelimit.QuotaStore, keys KeyOrgStore,
+	period ratelimit.BudgetPeriod, orgPeriods map[string]ratelimit.BudgetPeriod) *QuotaResetWorker {
+	return &QuotaResetWorker{
+		tracker:    tracker,
+		store:      store,
+		keys:       keys,
+		period:     period,
+		orgPeriods: orgPeriods,
+		now:        time.Now,
+	}
+}
+
+// Name returns the worker identifier.
+func (w *QuotaResetWorker) Name() string { return "quota_reset" }
+
+// Run aligns every budgeted key to its current period immediately, then
+// checks for period boundaries until ctx is cancelled.
+func (w *QuotaResetWorker) Run(ctx context.Context) error {
+	w.reset(ctx)
+
+	ticker := time.NewTicker(quotaResetInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.reset(ctx)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// reset starts a new period for every budgeted key whose period start has
+// moved since the last check.
+func (w *QuotaResetWorker) reset(ctx context.Context) {
+	keys, err := w.keys.ListBudgetedKeyOrgs(ctx)
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "quota reset: list budgeted keys failed",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	now := w.now()
+	for keyID, orgID := range keys {
+		period := w.period
+		if p, ok := w.orgPeriods[orgID]; ok {
+			period = p
+		}
+		start := period.Start(now)
+		if w.tracker.PeriodStart(keyID).Equal(start) {
+			continue
+		}
+		w.tracker.ResetPeriod(keyID, start)
+		// Load usage already recorded in this period (non-zero on startup).
+		if err := w.tracker.Sync(ctx, w.store, keyID); err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "quota reset: sync failed",
+				slog.String("key_id", keyID),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
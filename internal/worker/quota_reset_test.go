@@ -0,0 +1,101 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/eugener/gandalf/internal/ratelimit"
+)
+
+// periodQuotaStore sums cost records at or after since.
+type periodQuotaStore struct {
+	records map[string][]costRecord
+}
+
+type costRecord struct {
+	at   time.Time
+	cost float64
+}
+
+func (s *periodQuotaStore) SumUsageCost(_ context.Context, keyID string, since time.Time) (float64, error) {
+	var total float64
+	for _, r := range s.records[keyID] {
+		if !r.at.Before(since) {
+			total += r.cost
+		}
+	}
+	return total, nil
+}
+
+type fakeKeyOrgStore struct {
+	keys map[string]string
+}
+
+func (s *fakeKeyOrgStore) ListBudgetedKeyOrgs(context.Context) (map[string]string, error) {
+	return s.keys, nil
+}
+
+func TestQuotaResetWorker_ResetsAtPeriodBoundary(t *testing.T) {
+	t.Parallel()
+
+	jan31 := time.Date(2026, 1, 31, 23, 0, 0, 0, time.UTC)
+	store := &periodQuotaStore{records: map[string][]costRecord{
+		"monthly-key": {{at: jan31.Add(-24 * time.Hour), cost: 9}},
+		"daily-key":   {{at: jan31.Add(-time.Hour), cost: 4}},
+	}}
+	keys := &fakeKeyOrgStore{keys: map[string]string{"monthly-key": "org-m", "daily-key": "org-d"}}
+
+	tracker := ratelimit.NewQuotaTracker()
+	tracker.Preload("monthly-key", 10)
+	tracker.Preload("daily-key", 5)
+
+	w := NewQuotaResetWorker(tracker, store, keys, ratelimit.PeriodMonthly,
+		map[string]ratelimit.BudgetPeriod{"org-d": ratelimit.PeriodDaily})
+	now := jan31
+	w.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// First pass aligns keys to the current period and loads its usage.
+	w.reset(ctx)
+	if !tracker.Check("monthly-key", 10) {
+		t.Error("monthly-key: 9/10 should be within budget")
+	}
+	tracker.Consume("monthly-key", 2)
+	if tracker.Check("monthly-key", 10) {
+		t.Error("monthly-key: 11/10 should be over budget")
+	}
+	if !tracker.Check("daily-key", 5) {
+		t.Error("daily-key: 4/5 should be within budget")
+	}
+
+	// Same period: nothing resets.
+	now = jan31.Add(30 * time.Minute)
+	w.reset(ctx)
+	if tracker.Check("monthly-key", 10) {
+		t.Error("monthly-key reset before the period boundary")
+	}
+
+	// Cross into February: both periods roll over, budgets persist.
+	now = time.Date(2026, 2, 1, 0, 1, 0, 0, time.UTC)
+	w.reset(ctx)
+	if !tracker.Check("monthly-key", 10) {
+		t.Error("monthly-key should be within budget after the monthly reset")
+	}
+	if got := tracker.PeriodStart("monthly-key"); !got.Equal(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("monthly-key period start = %v, want 2026-02-01", got)
+	}
+	tracker.Consume("monthly-key", 10)
+	if tracker.Check("monthly-key", 10) {
+		t.Error("monthly-key budget should still be enforced after reset")
+	}
+
+	// A later sync (as QuotaSyncWorker does) only counts the new period.
+	if err := tracker.Sync(ctx, store, "daily-key"); err != nil {
+		t.Fatal(err)
+	}
+	tracker.Consume("daily-key", 4.5)
+	if !tracker.Check("daily-key", 5) {
+		t.Error("daily-key: pre-boundary usage should not count after reset")
+	}
+}
@@ -12,7 +12,7 @@ type fakeQuotaStore struct {
 	costs map[string]float64
 }
 
-func (s *fakeQuotaStore) SumUsageCost(_ context.Context, keyID string) (float64, error) {
+func (s *fakeQuotaStore) SumUsageCost(_ context.Context, keyID string, _ time.Time) (float64, error) {
 	return s.costs[keyID], nil
 }
 
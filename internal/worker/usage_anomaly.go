@@ -0,0 +1,283 @@
+package worker
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+const anomalyInterval = 5 * time.Minute
+
+// Defaults for AnomalyConfig fields left at zero.
+const (
+	DefaultAnomalySigma       = 3
+	DefaultAnomalyWindow      = 7 * 24 * time.Hour
+	DefaultAnomalyMinBaseline = 24
+)
+
+// minStdDevUSD floors the baseline deviation so a perfectly flat history
+// does not flag every cent of extra spend.
+const minStdDevUSD = 0.01
+
+// AnomalyRollupStore is the persistence interface consumed by
+// UsageAnomalyWorker.
+type AnomalyRollupStore interface {
+	QueryRollupsPrimary(ctx context.Context, filter gateway.RollupFilter) ([]gateway.UsageRollup, error)
+}
+
+// AnomalyNotifier is told about each newly detected anomaly once.
+type AnomalyNotifier interface {
+	NotifyAnomalies(ctx context.Context, anomalies []gateway.UsageAnomaly) error
+}
+
+// AnomalyConfig tunes anomaly detection.
+type AnomalyConfig struct {
+	Sigma       float64       // standard deviations above the mean that flag an hour (0 = DefaultAnomalySigma)
+	Window      time.Duration // baseline length, also how long anomalies are kept (0 = DefaultAnomalyWindow)
+	MinBaseline int           // hours of history a series needs before it is judged (0 = DefaultAnomalyMinBaseline)
+	MinCostUSD  float64       // hours cheaper than this are never flagged
+}
+
+// UsageAnomalyWorker flags unusual spend from hourly usage rollups. For
+// every key and every org it compares the latest complete hour's cost with
+// the mean and standard deviation of the hours before it in the window,
+// counting hours without usage as zero. An hour more than Sigma deviations
+// above the mean is an anomaly: it is logged, kept for Anomalies, and sent
+// to the notifier.
+type UsageAnomalyWorker struct {
+	store    AnomalyRollupStore
+	notifier AnomalyNotifier // nil = no notifications
+	cfg      AnomalyConfig
+	now      func() time.Time
+
+	mu        sync.RWMutex
+	anomalies []gateway.UsageAnomaly // newest bucket first
+}
+
+// NewUsageAnomalyWorker creates a UsageAnomalyWorker. notifier may be nil.
+func NewUsageAnomalyWorker(store AnomalyRollupStore, cfg AnomalyConfig, notifier AnomalyNotifier) *UsageAnomalyWorker {
+	if cfg.Sigma <= 0 {
+		cfg.Sigma = DefaultAnomalySigma
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultAnomalyWindow
+	}
+	if cfg.MinBaseline <= 0 {
+		cfg.MinBaseline = DefaultAnomalyMinBaseline
+	}
+	return &UsageAnomalyWorker{store: store, notifier: notifier, cfg: cfg, now: time.Now}
+}
+
+// Name returns the worker identifier.
+func (w *UsageAnomalyWorker) Name() string { return "usage_anomaly" }
+
+// Run checks for anomalies immediately, then periodically until ctx is
+// cancelled.
+func (w *UsageAnomalyWorker) Run(ctx context.Context) error {
+	w.detect(ctx)
+
+	ticker := time.NewTicker(anomalyInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.detect(ctx)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Anomalies returns the anomalies detected within the window for orgID,
+// newest first.
+func (w *UsageAnomalyWorker) Anomalies(orgID string) []gateway.UsageAnomaly {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	out := []gateway.UsageAnomaly{}
+	for _, a := range w.anomalies {
+		if a.OrgID == orgID {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// spendSeries identifies a key's (or, with keyID empty, an org's) spend.
+type spendSeries struct {
+	orgID, keyID string
+}
+
+func (w *UsageAnomalyWorker) detect(ctx context.Context) {
+	now := w.now().UTC()
+	latest := now.Truncate(time.Hour).Add(-time.Hour) // most recent complete hour
+	since := latest.Add(-w.cfg.Window)
+
+	rollups, err := w.store.QueryRollupsPrimary(ctx, gateway.RollupFilter{
+		Period: "hourly",
+		Since:  since.Format(time.RFC3339),
+	})
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "anomaly rollup query failed",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	// Hourly cost per series, summed across models.
+	costs := make(map[spendSeries]map[time.Time]float64)
+	add := func(s spendSeries, bucket time.Time, cost float64) {
+		if costs[s] == nil {
+			costs[s] = make(map[time.Time]float64)
+		}
+		costs[s][bucket] += cost
+	}
+	for _, r := range rollups {
+		bucket, err := time.Parse(time.RFC3339, r.Bucket)
+		if err != nil || bucket.Before(since) || bucket.After(latest) {
+			continue
+		}
+		add(spendSeries{orgID: r.OrgID, keyID: r.KeyID}, bucket.UTC(), r.CostUSD)
+		add(spendSeries{orgID: r.OrgID}, bucket.UTC(), r.CostUSD)
+	}
+
+	var found []gateway.UsageAnomaly
+	for s, hours := range costs {
+		if a, ok := w.judge(s, hours, latest); ok {
+			a.DetectedAt = now
+			found = append(found, a)
+		}
+	}
+
+	fresh := w.record(found, since)
+	for _, a := range fresh {
+		slog.LogAttrs(ctx, slog.LevelWarn, "usage anomaly detected",
+			slog.String("org_id", a.OrgID),
+			slog.String("key_id", a.KeyID),
+			slog.String("bucket", a.Bucket),
+			slog.Float64("cost_usd", a.CostUSD),
+			slog.Float64("z_score", a.ZScore),
+		)
+	}
+	if len(fresh) > 0 && w.notifier != nil {
+		if err := w.notifier.NotifyAnomalies(ctx, fresh); err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "anomaly notification failed",
+				slog.Int("anomalies", len(fresh)),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
+
+// judge compares the latest hour of a series with the hours before it,
+// from the series' first hour with usage.
+func (w *UsageAnomalyWorker) judge(s spendSeries, hours map[time.Time]float64, latest time.Time) (gateway.UsageAnomaly, bool) {
+	cost := hours[latest]
+	if cost <= 0 || cost < w.cfg.MinCostUSD {
+		return gateway.UsageAnomaly{}, false
+	}
+	first := latest
+	for h := range hours {
+		if h.Before(first) {
+			first = h
+		}
+	}
+	n := int(latest.Sub(first) / time.Hour)
+	if n < w.cfg.MinBaseline {
+		return gateway.UsageAnomaly{}, false
+	}
+
+	var sum float64
+	for h, c := range hours {
+		if h.Before(latest) {
+			sum += c
+		}
+	}
+	mean := sum / float64(n)
+	var sq float64
+	for h := first; h.Before(latest); h = h.Add(time.Hour) {
+		d := hours[h] - mean
+		sq += d * d
+	}
+	stddev := math.Sqrt(sq / float64(n))
+	z := (cost - mean) / max(stddev, minStdDevUSD)
+	if z <= w.cfg.Sigma {
+		return gateway.UsageAnomaly{}, false
+	}
+	return gateway.UsageAnomaly{
+		OrgID:     s.orgID,
+		KeyID:     s.keyID,
+		Bucket:    latest.Format(time.RFC3339),
+		CostUSD:   cost,
+		MeanUSD:   mean,
+		StdDevUSD: stddev,
+		ZScore:    z,
+	}, true
+}
+
+// record adds anomalies not already known, drops those older than since,
+// and returns the new ones.
+func (w *UsageAnomalyWorker) record(found []gateway.UsageAnomaly, since time.Time) []gateway.UsageAnomaly {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	cutoff := since.Format(time.RFC3339)
+	w.anomalies = slices.DeleteFunc(w.anomalies, func(a gateway.UsageAnomaly) bool { return a.Bucket < cutoff })
+
+	var fresh []gateway.UsageAnomaly
+	for _, a := range found {
+		known := slices.ContainsFunc(w.anomalies, func(k gateway.UsageAnomaly) bool {
+			return k.OrgID == a.OrgID && k.KeyID == a.KeyID && k.Bucket == a.Bucket
+		})
+		if !known {
+			fresh = append(fresh, a)
+		}
+	}
+	slices.SortFunc(fresh, func(a, b gateway.UsageAnomaly) int {
+		return cmp.Or(cmp.Compare(a.OrgID, b.OrgID), cmp.Compare(a.KeyID, b.KeyID))
+	})
+	w.anomalies = append(fresh, w.anomalies...)
+	return fresh
+}
+
+// WebhookNotifier posts anomalies as JSON ({"anomalies": [...]}) to URL.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client // nil = a client with a 10s timeout
+}
+
+// NotifyAnomalies sends one webhook request for the batch. A non-2xx
+// response is an error.
+func (n *WebhookNotifier) NotifyAnomalies(ctx context.Context, anomalies []gateway.UsageAnomaly) error {
+	body, err := json.Marshal(map[string]any{"anomalies": anomalies})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := n.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gateway "github.com/eugener/gandalf/internal"
+)
+
+type hourlyRollupStore struct {
+	rollups []gateway.UsageRollup
+}
+
+func (s *hourlyRollupStore) QueryRollupsPrimary(_ context.Context, f gateway.RollupFilter) ([]gateway.UsageRollup, error) {
+	var out []gateway.UsageRollup
+	for _, r := range s.rollups {
+		if r.Bucket >= f.Since {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+type recordingNotifier struct {
+	batches [][]gateway.UsageAnomaly
+}
+
+func (n *recordingNotifier) NotifyAnomalies(_ context.Context, a []gateway.UsageAnomaly) error {
+	n.batches = append(n.batches, a)
+	return nil
+}
+
+// steadyRollups gives key-a and key-b (org-1) and key-c (org-2) two days of
+// hourly spend alternating between $0.90 and $1.10, ending the hour before
+// last.
+func steadyRollups(last time.Time) []gateway.UsageRollup {
+	var out []gateway.UsageRollup
+	for i := 1; i <= 48; i++ {
+		cost := 0.9
+		if i%2 == 0 {
+			cost = 1.1
+		}
+		bucket := last.Add(-time.Duration(i) * time.Hour).Format(time.RFC3339)
+		for _, k := range [][2]string{{"org-1", "key-a"}, {"org-1", "key-b"}, {"org-2", "key-c"}} {
+			out = append(out, gateway.UsageRollup{OrgID: k[0], KeyID: k[1], Model: "gpt-4o", Period: "hourly", Bucket: bucket, CostUSD: cost})
+		}
+	}
+	return out
+}
+
+func TestUsageAnomalyWorker_FlagsSpike(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 3, 10, 14, 20, 0, 0, time.UTC)
+	last := time.Date(2026, 3, 10, 13, 0, 0, 0, time.UTC) // latest complete hour
+	store := &hourlyRollupStore{rollups: steadyRollups(last)}
+	// key-a spikes to $9 across two models; key-b and key-c stay normal.
+	store.rollups = append(store.rollups,
+		gateway.UsageRollup{OrgID: "org-1", KeyID: "key-a", Model: "gpt-4o", Period: "hourly", Bucket: last.Format(time.RFC3339), CostUSD: 6},
+		gateway.UsageRollup{OrgID: "org-1", KeyID: "key-a", Model: "o3", Period: "hourly", Bucket: last.Format(time.RFC3339), CostUSD: 3},
+		gateway.UsageRollup{OrgID: "org-1", KeyID: "key-b", Model: "gpt-4o", Period: "hourly", Bucket: last.Format(time.RFC3339), CostUSD: 1.1},
+		gateway.UsageRollup{OrgID: "org-2", KeyID: "key-c", Model: "gpt-4o", Period: "hourly", Bucket: last.Format(time.RFC3339), CostUSD: 1.05},
+	)
+	notifier := &recordingNotifier{}
+	w := NewUsageAnomalyWorker(store, AnomalyConfig{}, notifier)
+	w.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	w.detect(ctx)
+
+	got := w.Anomalies("org-1")
+	if len(got) != 2 {
+		t.Fatalf("org-1 anomalies = %+v, want org-wide and key-a", got)
+	}
+	// Org-wide spend ($10.10 vs a $2 mean) sorts before the key.
+	if got[0].KeyID != "" || got[1].KeyID != "key-a" {
+		t.Errorf("anomalies = %+v, want org-wide then key-a", got)
+	}
+	a := got[1]
+	if a.CostUSD != 9 || a.Bucket != "2026-03-10T13:00:00Z" || a.ZScore <= DefaultAnomalySigma {
+		t.Errorf("key-a anomaly = %+v", a)
+	}
+	if a.MeanUSD < 0.99 || a.MeanUSD > 1.01 {
+		t.Errorf("mean = %v, want 1", a.MeanUSD)
+	}
+	if got := w.Anomalies("org-2"); len(got) != 0 {
+		t.Errorf("org-2 anomalies = %+v, want none", got)
+	}
+	if len(notifier.batches) != 1 || len(notifier.batches[0]) != 2 {
+		t.Fatalf("notifications = %+v, want one batch of 2", notifier.batches)
+	}
+
+	// A second pass over the same hour neither duplicates nor re-notifies.
+	w.detect(ctx)
+	if len(w.Anomalies("org-1")) != 2 || len(notifier.batches) != 1 {
+		t.Errorf("second pass: anomalies = %d, notifications = %d", len(w.Anomalies("org-1")), len(notifier.batches))
+	}
+}
+
+func TestUsageAnomalyWorker_Thresholds(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 3, 10, 14, 20, 0, 0, time.UTC)
+	last := time.Date(2026, 3, 10, 13, 0, 0, 0, time.UTC)
+	spike := func(hoursOfHistory int, cost float64) *hourlyRollupStore {
+		s := &hourlyRollupStore{}
+		for i := 1; i <= hoursOfHistory; i++ {
+			s.rollups = append(s.rollups, gateway.UsageRollup{OrgID: "org-1", KeyID: "key-a", Period: "hourly",
+				Bucket: last.Add(-time.Duration(i) * time.Hour).Format(time.RFC3339), CostUSD: 0.5})
+		}
+		s.rollups = append(s.rollups, gateway.UsageRollup{OrgID: "org-1", KeyID: "key-a", Period: "hourly",
+			Bucket: last.Format(time.RFC3339), CostUSD: cost})
+		return s
+	}
+
+	tests := []struct {
+		name  string
+		store *hourlyRollupStore
+		cfg   AnomalyConfig
+		want  int
+	}{
+		{"spike", spike(30, 5), AnomalyConfig{}, 2},
+		{"too little history", spike(10, 5), AnomalyConfig{}, 0},
+		{"below min cost", spike(30, 5), AnomalyConfig{MinCostUSD: 10}, 0},
+		{"within sigma", spike(30, 0.51), AnomalyConfig{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			w := NewUsageAnomalyWorker(tt.store, tt.cfg, nil)
+			w.now = func() time.Time { return now }
+			w.detect(context.Background())
+			if got := w.Anomalies("org-1"); len(got) != tt.want {
+				t.Errorf("anomalies = %+v, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	t.Parallel()
+
+	var got struct {
+		Anomalies []gateway.UsageAnomaly `json:"anomalies"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("content-type = %q", r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	n := &WebhookNotifier{URL: srv.URL}
+	err := n.NotifyAnomalies(context.Background(), []gateway.UsageAnomaly{{OrgID: "org-1", KeyID: "key-a", CostUSD: 9}})
+	if err != nil {
+		t.Fatalf("NotifyAnomalies: %v", err)
+	}
+	if len(got.Anomalies) != 1 || got.Anomalies[0].KeyID != "key-a" {
+		t.Errorf("webhook got %+v", got.Anomalies)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	if err := (&WebhookNotifier{URL: failing.URL}).NotifyAnomalies(context.Background(), nil); err == nil {
+		t.Error("want an error for a 500 response")
+	}
+}
@@ -14,7 +14,7 @@ const (
 
 // RollupStore is the persistence interface consumed by UsageRollupWorker.
 type RollupStore interface {
-	QueryUsage(ctx context.Context, filter gateway.UsageFilter) ([]gateway.UsageRecord, error)
+	QueryUsagePrimary(ctx context.Context, filter gateway.UsageFilter) ([]gateway.UsageRecord, error)
 	UpsertRollup(ctx context.Context, rollups []gateway.UsageRollup) error
 }
 
@@ -52,7 +52,7 @@ func (w *UsageRollupWorker) rollup(ctx context.Context) {
 	since := now.Add(-2 * time.Hour).Truncate(time.Hour).Format(time.RFC3339)
 	until := now.Truncate(time.Hour).Format(time.RFC3339)
 
-	records, err := w.store.QueryUsage(ctx, gateway.UsageFilter{
+	records, err := w.store.QueryUsagePrimary(ctx, gateway.UsageFilter{
 		Since: since,
 		Until: until,
 		Limit: 10_000,
@@ -101,6 +101,10 @@ func (w *UsageRollupWorker) rollup(ctx context.Context) {
 		if r.Cached {
 			ru.CachedCount++
 		}
+		if r.TTFBMs > 0 {
+			ru.StreamCount++
+			ru.TTFBMsSum += int64(r.TTFBMs)
+		}
 	}
 
 	rollups := make([]gateway.UsageRollup, 0, len(agg))
@@ -15,7 +15,7 @@ type fakeRollupStore struct {
 	rollups []gateway.UsageRollup
 }
 
-func (s *fakeRollupStore) QueryUsage(_ context.Context, f gateway.UsageFilter) ([]gateway.UsageRecord, error) {
+func (s *fakeRollupStore) QueryUsagePrimary(_ context.Context, f gateway.UsageFilter) ([]gateway.UsageRecord, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	var out []gateway.UsageRecord
@@ -63,7 +63,7 @@ func TestUsageRollupWorker(t *testing.T) {
 			{
 				ID: "u1", KeyID: "k1", OrgID: "org1", Model: "gpt-4o",
 				PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15,
-				CostUSD: 0.01, CreatedAt: now.Add(-30 * time.Minute),
+				CostUSD: 0.01, TTFBMs: 150, CreatedAt: now.Add(-30 * time.Minute),
 			},
 			{
 				ID: "u2", KeyID: "k1", OrgID: "org1", Model: "gpt-4o",
@@ -113,6 +113,9 @@ func TestUsageRollupWorker(t *testing.T) {
 	if k1Rollup.CachedCount != 1 {
 		t.Errorf("cached_count = %d, want 1", k1Rollup.CachedCount)
 	}
+	if k1Rollup.StreamCount != 1 || k1Rollup.TTFBMsSum != 150 {
+		t.Errorf("stream_count, ttfb_ms_sum = %d, %d, want 1, 150", k1Rollup.StreamCount, k1Rollup.TTFBMsSum)
+	}
 	if k1Rollup.Period != "hourly" {
 		t.Errorf("period = %q, want hourly", k1Rollup.Period)
 	}